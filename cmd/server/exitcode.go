@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"streamer/internal/config"
+	"streamer/server"
+)
+
+// exit codes let wrapper scripts tell "fix the flags" from "try again later"
+const (
+	exitOK      = 0
+	exitConfig  = 2 // bad flags or values, retrying won't help
+	exitStartup = 3 // could not lock, bind or listen, e.g. the port is taken
+	exitRuntime = 4 // the server was up and failed
+)
+
+// startupErr marks a failure of run before the server is started as one of the server's own
+func startupErr(err error) error {
+	return &server.StartupError{Err: err}
+}
+
+// exitCode maps the error returned by run to the process exit code
+func exitCode(err error) int {
+	var startup *server.StartupError
+
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, config.ErrInvalidConfig):
+		return exitConfig
+	case errors.As(err, &startup):
+		return exitStartup
+	default:
+		return exitRuntime
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"streamer/internal/config"
+	"streamer/internal/pidfile"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"ok - no error", nil, exitOK},
+		{"ok - help requested", flag.ErrHelp, exitOK},
+		{"ok - invalid config", fmt.Errorf("%w: invalid mode", config.ErrInvalidConfig), exitConfig},
+		{"ok - listen failure", startupErr(fmt.Errorf("listen on :8081: %w", &net.OpError{Op: "listen", Err: errors.New("address already in use")})), exitStartup},
+		{"ok - pid file locked", startupErr(&pidfile.LockedError{Path: "streamer.pid", PID: 42}), exitStartup},
+		{"ok - wrapped startup failure", fmt.Errorf("run service: %w", startupErr(errors.New("boom"))), exitStartup},
+		{"ok - runtime failure", errors.New("server closed unexpectedly"), exitRuntime},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunExitCodes checks the errors coming out of run are classified end to end
+func TestRunExitCodes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"ok - help", []string{"-h"}, exitOK},
+		{"fail - unknown flag", []string{"-nope"}, exitConfig},
+		{"fail - bad value", []string{"-media.mode", "teleport"}, exitConfig},
+		{"fail - path mounted twice", []string{dir, dir}, exitConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := exitCode(run(tt.args, io.Discard, io.Discard)); got != tt.want {
+				t.Errorf("exit code for %v = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
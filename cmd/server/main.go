@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"streamer/internal/config"
+	"streamer/server"
+)
+
+func main() {
+	os.Exit(exitCode(run(os.Args[1:], os.Stdout, os.Stderr)))
+}
+
+// run does everything main does except exiting, errors are reported before they are returned. Only the
+// selftest report goes to stdout
+func run(args []string, stdout, stderr io.Writer) error {
+	// install/remove/start/stop the Windows service, other platforms have no such verbs
+	if handled, err := serviceCommand(args, stderr); handled {
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+		}
+		return err
+	}
+
+	inService := isWindowsService()
+
+	// set-up config
+	cfg := config.DefaultConfig()
+	if err := config.ParseArgs(cfg, args, stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return err
+	}
+
+	// nobody reads stderr of a service
+	if cfg.Logger.File == "" && inService {
+		cfg.Logger.File = defaultServiceLogFile()
+	}
+
+	logOut := io.Writer(stderr)
+	if cfg.Logger.File != "" {
+		logFile, err := os.OpenFile(cfg.Logger.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: open log file: %v\n", err)
+			return startupErr(err)
+		}
+		defer logFile.Close()
+		logOut = logFile
+	}
+
+	logHandler := slog.NewTextHandler(logOut, &slog.HandlerOptions{Level: cfg.Logger.Level})
+	logger := slog.New(logHandler).With("app", "streamer")
+
+	if cfg.SelfTest {
+		return server.SelfTest(cfg, logger, stdout)
+	}
+
+	// init app
+	app, err := server.New(cfg, logger, server.WithUpgrade())
+	if err != nil {
+		logger.Error("initialization failed", "error", err)
+		return startupErr(err)
+	}
+
+	// run it, under the service manager stop requests cancel the context
+	runApp := app.Run
+	if inService {
+		runApp = func(ctx context.Context) error { return runService(ctx, app.Run) }
+	}
+
+	if err := runApp(context.Background()); err != nil {
+		logger.Error("server failed", "error", err, "exit_code", exitCode(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"io"
+)
+
+// serviceCommand handles the Windows service verbs, there are none here
+func serviceCommand(args []string, stderr io.Writer) (bool, error) {
+	return false, nil
+}
+
+func isWindowsService() bool {
+	return false
+}
+
+func defaultServiceLogFile() string {
+	return ""
+}
+
+func runService(ctx context.Context, run func(context.Context) error) error {
+	return run(ctx)
+}
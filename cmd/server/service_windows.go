@@ -0,0 +1,222 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"streamer/internal/config"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	serviceName        = "streamer"
+	serviceDisplayName = "GoStream Media Server"
+	serviceDescription = "DLNA/UPnP media server streaming local videos to TVs and players."
+)
+
+// serviceCommand handles "streamer install [flags] [path]", "remove" (or "uninstall"), "start" and "stop".
+// It reports false when args are not a service verb, so they get parsed as regular flags
+func serviceCommand(args []string, stderr io.Writer) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	switch args[0] {
+	case "install":
+		return true, installService(args[1:], stderr)
+	case "remove", "uninstall":
+		return true, removeService()
+	case "start":
+		return true, startService()
+	case "stop":
+		return true, stopService()
+	default:
+		return false, nil
+	}
+}
+
+func isWindowsService() bool {
+	inService, err := svc.IsWindowsService()
+	return err == nil && inService
+}
+
+// defaultServiceLogFile puts the log next to the executable, the working dir of a service is System32
+func defaultServiceLogFile() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(exe), "streamer.log")
+}
+
+// installService registers the service to run with the given flags, they are validated first so a typo
+// doesn't end up in a service that fails on every boot
+func installService(args []string, stderr io.Writer) error {
+	if err := config.ParseArgs(config.DefaultConfig(), args, stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return fmt.Errorf("invalid service arguments: %w", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("find executable: %w", err)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists, remove it first", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("create service: %w", err)
+	}
+	defer s.Close()
+
+	fmt.Fprintf(os.Stdout, "service %s installed\n", serviceName)
+	return nil
+}
+
+func removeService() error {
+	m, s, err := openService()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("remove service: %w", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "service %s removed\n", serviceName)
+	return nil
+}
+
+func startService() error {
+	m, s, err := openService()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("start service: %w", err)
+	}
+	return nil
+}
+
+func stopService() error {
+	m, s, err := openService()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return fmt.Errorf("stop service: %w", err)
+	}
+
+	// draining streams can take a while, wait for the manager to confirm
+	deadline := time.Now().Add(time.Minute)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service %s is still stopping", serviceName)
+		}
+		time.Sleep(500 * time.Millisecond)
+
+		if status, err = s.Query(); err != nil {
+			return fmt.Errorf("query service: %w", err)
+		}
+	}
+	return nil
+}
+
+func openService() (*mgr.Mgr, *mgr.Service, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to service manager: %w", err)
+	}
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		m.Disconnect()
+		return nil, nil, fmt.Errorf("open service %s: %w", serviceName, err)
+	}
+	return m, s, nil
+}
+
+// runService hands the process to the service manager, stop and shutdown requests cancel ctx
+func runService(ctx context.Context, run func(context.Context) error) error {
+	h := &serviceHandler{run: run, ctx: ctx}
+	if err := svc.Run(serviceName, h); err != nil {
+		return fmt.Errorf("run service: %w", err)
+	}
+	return h.err
+}
+
+type serviceHandler struct {
+	ctx context.Context
+	run func(context.Context) error
+	err error // what run returned, reported once svc.Run is back
+}
+
+func (h *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(h.ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.run(ctx)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			h.err = err
+			changes <- svc.Status{State: svc.StopPending}
+			if err != nil {
+				return true, 1
+			}
+			return false, 0
+
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				// the server drains streams as on ctrl+c, the wait hint keeps the manager patient
+				changes <- svc.Status{State: svc.StopPending, WaitHint: 30000}
+				cancel()
+			}
+		}
+	}
+}
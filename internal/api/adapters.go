@@ -34,16 +34,23 @@ func (h *Handler) AdapterDirectStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w, end, ok := h.beginStream(w, r, entry, "direct")
+	if !ok {
+		return
+	}
+	defer end()
+
 	mount, err := h.Media.GetMount(entry.MountID)
 	if err == nil { // If volume found, enforce limit
-		if err := mount.Limiter.TryAcquire(r.Context()); err != nil {
+		client := clientHost(r)
+		if err := mount.Limiter.AcquirePriority(r.Context(), client, h.priority(r)); err != nil {
 			http.Error(w, "server too busy", http.StatusServiceUnavailable)
 			return
 		}
-		defer mount.Limiter.Release()
+		defer mount.Limiter.ReleaseClient(client)
 	}
 
-	resource, err := h.Media.OpenResource(entry)
+	resource, err := h.Media.OpenResource(entry, rangeLength(r))
 	if err != nil {
 		switch {
 		case errors.Is(err, media.ErrPathOutsideRoot):
@@ -66,5 +73,9 @@ func (h *Handler) AdapterDirectStream(w http.ResponseWriter, r *http.Request) {
 	// close the file when request is done
 	defer resource.Close()
 
-	h.HandleDirectStream(w, r, resource)
+	timed, finish := h.warmUp(r, resource)
+	defer finish()
+
+	setETag(w, entry, resource)
+	h.HandleDirectStream(w, r, timed)
 }
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"streamer/internal/media"
+	"streamer/internal/middleware"
+	"syscall"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// sendfileWriter is a response that tells whether what reached its ReadFrom is something net's sendfile
+// takes: a file descriptor, maybe behind the io.LimitedReader of http.ServeContent
+type sendfileWriter struct {
+	*httptest.ResponseRecorder
+	sendfile bool
+}
+
+func (w *sendfileWriter) ReadFrom(src io.Reader) (int64, error) {
+	r := src
+	if lr, ok := src.(*io.LimitedReader); ok {
+		r = lr.R
+	}
+	if conn, ok := r.(syscall.Conn); ok {
+		if _, err := conn.SyscallConn(); err == nil {
+			w.sendfile = true
+		}
+	}
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+func TestAdapterDirectStreamSendfile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		mode     media.ResourceMode
+		zeroCopy bool
+		rangeHdr string
+		want     bool
+	}{
+		{"ok - direct", media.ModeFileDirect, true, "", true},
+		{"ok - direct range", media.ModeFileDirect, true, "bytes=2-5", true},
+		{"ok - direct with zero copy off", media.ModeFileDirect, false, "", false},
+		{"ok - buffered", media.ModeFileBuffered, true, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := newTestHandler(t, map[string]string{"film.mp4": "0123456789"})
+			h.Media.Mode = tt.mode
+			h.Media.ZeroCopy = tt.zeroCopy
+
+			// the stack the server puts in front of streams
+			handler := middleware.Chain(http.HandlerFunc(h.AdapterDirectStream),
+				middleware.WithObservability(h.metrics),
+				middleware.WithRejections(h),
+				middleware.WithLogging(h.logger),
+				middleware.WithStreamTracking(nil),
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/direct/"+entryByName(t, h, "film.mp4").UUID.String()+".mp4", nil)
+			if tt.rangeHdr != "" {
+				req.Header.Set("Range", tt.rangeHdr)
+			}
+			w := &sendfileWriter{ResponseRecorder: httptest.NewRecorder()}
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK && w.Code != http.StatusPartialContent {
+				t.Fatalf("status = %d", w.Code)
+			}
+			if w.sendfile != tt.want {
+				t.Errorf("file reached sendfile = %v, want %v", w.sendfile, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdapterDirectStreamErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		path     string // of the entry on the volume, empty for none
+		wantCode int
+	}{
+		{"ok - file", "film.mp4", http.StatusOK},
+		{"fail - gone since the scan", "Ronin.mp4", http.StatusNotFound},
+		{"fail - outside the volume", "../secret.mp4", http.StatusForbidden},
+		{"fail - no such entry", "", http.StatusNotFound},
+	}
+
+	modes := map[string]media.ResourceMode{"direct": media.ModeFileDirect, "buffered": media.ModeFileBuffered}
+	for modeName, mode := range modes {
+		for _, tt := range tests {
+			t.Run(modeName+" "+tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				h := newTestHandler(t, map[string]string{"film.mp4": "0123456789"})
+				h.Media.Mode = mode
+				id := uuid.Must(uuid.NewV7())
+				if tt.path == "film.mp4" {
+					id = entryByName(t, h, "film.mp4").UUID
+				} else if tt.path != "" {
+					e, err := media.NewEntry(testMountID, tt.path, path.Base(tt.path), "", 10)
+					if err != nil {
+						t.Fatal(err)
+					}
+					h.Media.Registry.Add(e)
+					id = e.UUID
+				}
+
+				rec := httptest.NewRecorder()
+				h.AdapterDirectStream(rec, httptest.NewRequest(http.MethodGet, "/direct/"+id.String()+".mp4", nil))
+				if rec.Code != tt.wantCode {
+					t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+				}
+				if tt.wantCode == http.StatusOK && rec.Body.String() != "0123456789" {
+					t.Errorf("body = %q, want the file", rec.Body.String())
+				}
+			})
+		}
+	}
+}
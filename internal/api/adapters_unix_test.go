@@ -0,0 +1,76 @@
+//go:build unix
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"streamer/internal/media"
+	"streamer/internal/middleware"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// cpuTime is the user and system time the process has used so far
+func cpuTime(b *testing.B) time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		b.Fatal(err)
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// BenchmarkDirectStream streams a file over a real connection with and without sendfile and reports the
+// CPU time per GB, client included:
+//
+//	go test ./internal/api -run '^$' -bench DirectStream
+func BenchmarkDirectStream(b *testing.B) {
+	const size = 64 << 20
+
+	for _, zeroCopy := range []bool{true, false} {
+		b.Run(fmt.Sprintf("zeroCopy=%v", zeroCopy), func(b *testing.B) {
+			h := newTestHandler(b, map[string]string{"film.mp4": ""})
+			h.Media.Mode = media.ModeFileDirect
+			h.Media.ZeroCopy = zeroCopy
+			if err := os.Truncate(filepath.Join(h.Media.Volumes[testMountID].RootPath, "film.mp4"), size); err != nil {
+				b.Fatal(err)
+			}
+			if err := h.Media.Registry.Scan(testMountID, h.Media.Volumes[testMountID].RootPath); err != nil {
+				b.Fatal(err)
+			}
+
+			srv := httptest.NewServer(middleware.Chain(http.HandlerFunc(h.AdapterDirectStream),
+				middleware.WithObservability(h.metrics),
+				middleware.WithLogging(h.logger),
+			))
+			defer srv.Close()
+			url := srv.URL + "/direct/" + entryByName(b, h, "film.mp4").UUID.String() + ".mp4"
+
+			// the client reads in big chunks so its share of the CPU time stays small, io.Discard alone would
+			// read 8KB at a time
+			buf := make([]byte, 1<<20)
+			discard := struct{ io.Writer }{io.Discard}
+
+			b.SetBytes(size)
+			start := cpuTime(b)
+			for b.Loop() {
+				resp, err := http.Get(url)
+				if err != nil {
+					b.Fatal(err)
+				}
+				n, err := io.CopyBuffer(discard, resp.Body, buf)
+				resp.Body.Close()
+				if err != nil || n != size {
+					b.Fatalf("read %d bytes, %v", n, err)
+				}
+			}
+			gb := float64(b.N) * size / (1 << 30)
+			b.ReportMetric((cpuTime(b)-start).Seconds()/gb, "cpu-s/GB")
+		})
+	}
+}
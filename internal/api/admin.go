@@ -0,0 +1,209 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HandleShutdownStatus returns the current shutdown schedule
+func (h *Handler) HandleShutdownStatus(w http.ResponseWriter, r *http.Request) {
+	if h.Shutdown == nil {
+		http.Error(w, "shutdown control unavailable", http.StatusNotImplemented)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, h.Shutdown.ShutdownStatus())
+}
+
+// HandleShutdownSchedule sets a new shutdown time. It takes exactly one of the form values
+// delay (from now, e.g. 45m), at (HH:MM or RFC 3339) or extend (added to the current schedule, e.g. 30m)
+func (h *Handler) HandleShutdownSchedule(w http.ResponseWriter, r *http.Request) {
+	if h.Shutdown == nil {
+		http.Error(w, "shutdown control unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	at, err := parseShutdownRequest(r, time.Now(), h.Shutdown.ShutdownStatus().Scheduled)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.Shutdown.Reschedule(at)
+	h.logger.Info("shutdown rescheduled via api", "at", at.Format(time.DateTime), "remote", r.RemoteAddr)
+
+	h.writeJSON(w, http.StatusOK, h.Shutdown.ShutdownStatus())
+}
+
+// HandleShutdownCancel drops the scheduled shutdown
+func (h *Handler) HandleShutdownCancel(w http.ResponseWriter, r *http.Request) {
+	if h.Shutdown == nil {
+		http.Error(w, "shutdown control unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	h.Shutdown.CancelShutdown()
+	h.logger.Info("scheduled shutdown cancelled via api", "remote", r.RemoteAddr)
+
+	h.writeJSON(w, http.StatusOK, h.Shutdown.ShutdownStatus())
+}
+
+// adminPage is what admin.html renders, the state of the server at a glance
+type adminPage struct {
+	FriendlyName string
+	Shutdown     ShutdownStatus
+	ShutdownIn   time.Duration // until the pending or scheduled shutdown, zero without one
+	Streams      []adminStream
+	Volumes      []adminVolume
+	Entries      int
+	ScanRunning  time.Duration // zero while the scanner is idle
+	LastScan     time.Time     // zero before the first scan finished
+	Rejections   []rejection   // newest first
+}
+
+// adminStream is a Session as the admin page lists it
+type adminStream struct {
+	Title   string
+	Client  string
+	Kind    string
+	Started time.Time
+	Sent    string // with the share of the entry when its size is known
+}
+
+func toAdminStream(s Session) adminStream {
+	sent := humanBytes(s.Sent)
+	if s.Size > 0 {
+		sent += fmt.Sprintf(" of %s (%d%%)", humanBytes(s.Size), min(s.Sent*100/s.Size, 100))
+	}
+	return adminStream{Title: s.Title, Client: s.Client, Kind: s.Kind, Started: s.Started, Sent: sent}
+}
+
+type adminVolume struct {
+	ID      string
+	Path    string
+	Entries int
+	InUse   int // io slots
+	Max     int
+	Waiting string // reads waiting for a slot by priority, e.g. "1 high, 2 low"
+	Library string
+	Free    string // of the disk, empty when unknown
+}
+
+// HandleAdmin renders the admin page
+func (h *Handler) HandleAdmin(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	data := adminPage{
+		FriendlyName: h.config.FriendlyName,
+		Entries:      h.Media.Registry.Len(),
+		ScanRunning:  h.Media.ScanRunningFor().Round(time.Second),
+		LastScan:     h.Media.LastScan(),
+		Rejections:   h.rejections.list(),
+	}
+
+	if h.Shutdown != nil {
+		data.Shutdown = h.Shutdown.ShutdownStatus()
+		at := data.Shutdown.Scheduled
+		if data.Shutdown.Pending {
+			at = data.Shutdown.At
+		}
+		if !at.IsZero() {
+			data.ShutdownIn = max(at.Sub(now), 0).Round(time.Second)
+		}
+	}
+
+	for _, s := range h.Sessions() {
+		data.Streams = append(data.Streams, toAdminStream(s))
+	}
+
+	for _, v := range h.volumeStatus() {
+		vol := h.Media.Volumes[v.ID]
+		av := adminVolume{
+			ID:      v.ID,
+			Path:    v.Path,
+			Entries: v.Entries,
+			InUse:   vol.Limiter.InUse(),
+			Max:     vol.Limiter.Cap(),
+			Waiting: waitingSummary(vol.Limiter.Waiting()),
+			Library: humanBytes(v.LibraryBytes),
+		}
+		if v.FreeBytes != nil {
+			av.Free = humanBytes(*v.FreeBytes) + " of " + humanBytes(v.TotalBytes)
+		}
+		data.Volumes = append(data.Volumes, av)
+	}
+
+	h.render(w, "admin.html", data)
+}
+
+// HandleRescan asks the scanner for a pass right away, e.g. after copying new films onto a volume
+func (h *Handler) HandleRescan(w http.ResponseWriter, r *http.Request) {
+	h.Media.RescanNow()
+	h.logger.Info("rescan requested via api", "remote", r.RemoteAddr)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func parseShutdownRequest(r *http.Request, now, current time.Time) (time.Time, error) {
+	if err := r.ParseForm(); err != nil {
+		return time.Time{}, fmt.Errorf("invalid form: %w", err)
+	}
+
+	delay := strings.TrimSpace(r.Form.Get("delay"))
+	at := strings.TrimSpace(r.Form.Get("at"))
+	extend := strings.TrimSpace(r.Form.Get("extend"))
+
+	given := 0
+	for _, v := range []string{delay, at, extend} {
+		if v != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		return time.Time{}, fmt.Errorf("exactly one of delay, at or extend is required")
+	}
+
+	switch {
+	case delay != "":
+		d, err := time.ParseDuration(delay)
+		if err != nil || d <= 0 {
+			return time.Time{}, fmt.Errorf("invalid delay %q: must be a positive duration", delay)
+		}
+		return now.Add(d), nil
+
+	case extend != "":
+		d, err := time.ParseDuration(extend)
+		if err != nil || d <= 0 {
+			return time.Time{}, fmt.Errorf("invalid extend %q: must be a positive duration", extend)
+		}
+		// nothing scheduled yet, extend from now
+		if current.IsZero() || current.Before(now) {
+			current = now
+		}
+		return current.Add(d), nil
+
+	default:
+		return parseShutdownTime(at, now)
+	}
+}
+
+// parseShutdownTime accepts an absolute RFC 3339 time or HH:MM, which means the next occurrence of that time
+func parseShutdownTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		if t.Before(now) {
+			return time.Time{}, fmt.Errorf("shutdown time %q is in the past", s)
+		}
+		return t, nil
+	}
+
+	parsed, err := time.Parse("15:04", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (expected HH:MM or RFC 3339)", s)
+	}
+
+	result := time.Date(now.Year(), now.Month(), now.Day(), parsed.Hour(), parsed.Minute(), 0, 0, now.Location())
+	if result.Before(now) {
+		result = result.AddDate(0, 0, 1)
+	}
+	return result, nil
+}
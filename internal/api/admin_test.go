@@ -0,0 +1,140 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseShutdownRequest(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 6, 1, 21, 0, 0, 0, time.UTC)
+	current := now.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		current time.Time
+		want    time.Time
+		wantErr bool
+	}{
+		{"ok - delay", url.Values{"delay": {"45m"}}, current, now.Add(45 * time.Minute), false},
+		{"ok - extend current", url.Values{"extend": {"30m"}}, current, current.Add(30 * time.Minute), false},
+		{"ok - extend without schedule", url.Values{"extend": {"30m"}}, time.Time{}, now.Add(30 * time.Minute), false},
+		{"ok - at later today", url.Values{"at": {"23:30"}}, current, time.Date(2025, 6, 1, 23, 30, 0, 0, time.UTC), false},
+		{"ok - at tomorrow", url.Values{"at": {"07:00"}}, current, time.Date(2025, 6, 2, 7, 0, 0, 0, time.UTC), false},
+		{"ok - at rfc3339", url.Values{"at": {"2025-06-02T01:00:00Z"}}, current, time.Date(2025, 6, 2, 1, 0, 0, 0, time.UTC), false},
+		{"fail - nothing given", url.Values{}, current, time.Time{}, true},
+		{"fail - two given", url.Values{"delay": {"1h"}, "extend": {"1h"}}, current, time.Time{}, true},
+		{"fail - negative delay", url.Values{"delay": {"-5m"}}, current, time.Time{}, true},
+		{"fail - rubbish at", url.Values{"at": {"soon"}}, current, time.Time{}, true},
+		{"fail - past rfc3339", url.Values{"at": {"2025-06-01T20:00:00Z"}}, current, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodPost, "/api/shutdown", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			got, err := parseShutdownRequest(r, now, tt.current)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseShutdownRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseShutdownRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fixedShutdown is a ShutdownController with a schedule that doesn't move
+type fixedShutdown struct{ status ShutdownStatus }
+
+func (f *fixedShutdown) ShutdownStatus() ShutdownStatus { return f.status }
+func (f *fixedShutdown) Reschedule(at time.Time)        { f.status.Scheduled = at }
+func (f *fixedShutdown) CancelShutdown()                { f.status.Scheduled = time.Time{} }
+
+func TestHandleAdmin(t *testing.T) {
+	h := newTestHandler(t, map[string]string{"Action/Die Hard.mp4": "0123456789"})
+	h.Shutdown = &fixedShutdown{ShutdownStatus{Scheduled: time.Now().Add(90 * time.Minute), InactiveLimit: "30m0s"}}
+
+	// a stream in flight, stalled by its client
+	slow := &blockingWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		started:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	req := httptest.NewRequest(http.MethodGet, "/stream?id="+entryByName(t, h, "Die Hard.mp4").UUID.String(), nil)
+	req.RemoteAddr = "10.0.0.2:5000"
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Stream(slow, req)
+	}()
+	<-slow.started
+	defer func() {
+		close(slow.release)
+		<-done
+	}()
+
+	rejected := httptest.NewRequest(http.MethodGet, "/stream?id=x", nil)
+	rejected.RemoteAddr = "10.0.0.9:5000"
+	h.RecordRejection(rejected, http.StatusTooManyRequests)
+
+	rec := httptest.NewRecorder()
+	h.HandleAdmin(rec, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"<td>Die Hard</td><td>10.0.0.2</td><td>stream</td>",
+		"<td>" + testMountID + "</td>",
+		"<td>1</td><td>1 / 4</td>",
+		"<td>10.0.0.9</td><td>GET /stream</td><td>429</td>",
+		"(in 1h",
+		"post('/api/rescan', '')",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("admin page has no %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestHandleAdminIdle(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+
+	rec := httptest.NewRecorder()
+	h.HandleAdmin(rec, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{"No shutdown scheduled", "Nothing playing", "not scanned yet"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("admin page has no %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestRecordRejectionKeepsLatest(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+	for i := range maxRejections + 5 {
+		h.RecordRejection(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/stream?n=%d", i), nil), http.StatusServiceUnavailable)
+	}
+
+	got := h.rejections.list()
+	if len(got) != maxRejections {
+		t.Fatalf("%d rejections kept, want %d", len(got), maxRejections)
+	}
+	if got[0].At.Before(got[len(got)-1].At) {
+		t.Error("rejections not newest first")
+	}
+}
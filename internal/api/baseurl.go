@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// baseURL is what every absolute URL handed out starts with: scheme, host and path prefix, without a
+// trailing slash. The configured external URL comes first, then the X-Forwarded-* headers of a trusted
+// proxy, then the request itself
+func (h *Handler) baseURL(r *http.Request) string {
+	return h.baseURLOr(r, r.Host)
+}
+
+// baseURLOr is baseURL with host in place of the request's, when neither an external URL nor a proxy
+// says otherwise
+func (h *Handler) baseURLOr(r *http.Request, host string) string {
+	if h.config.ExternalURL != "" {
+		return h.config.ExternalURL
+	}
+
+	scheme, prefix := "http", ""
+	if h.trustedProxy(r) {
+		if proto := strings.ToLower(forwarded(r, "X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if fwdHost := forwarded(r, "X-Forwarded-Host"); fwdHost != "" && !strings.ContainsAny(fwdHost, "/?#@<>\"&' \t") {
+			host = fwdHost
+		}
+		if fwdPrefix := strings.Trim(forwarded(r, "X-Forwarded-Prefix"), "/"); fwdPrefix != "" && !strings.ContainsAny(fwdPrefix, "?#<>\"&' \t") {
+			prefix = "/" + fwdPrefix
+		}
+	}
+	return scheme + "://" + host + prefix
+}
+
+// trustedProxy reports whether the request came straight from one of the trusted proxies
+func (h *Handler) trustedProxy(r *http.Request) bool {
+	if len(h.config.TrustedProxies) == 0 {
+		return false
+	}
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, p := range h.config.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarded is the first value of an X-Forwarded-* header, proxies in a chain append theirs
+func forwarded(r *http.Request, name string) string {
+	first, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(first)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"streamer/internal/media"
+	"strings"
+	"testing"
+)
+
+func TestBaseURL(t *testing.T) {
+	t.Parallel()
+
+	proxied := http.Header{
+		"X-Forwarded-Proto":  {"https"},
+		"X-Forwarded-Host":   {"media.example.com"},
+		"X-Forwarded-Prefix": {"/media/"},
+	}
+
+	tests := []struct {
+		name     string
+		external string
+		remote   string
+		header   http.Header
+		want     string
+	}{
+		{"ok - direct", "", "192.168.1.20:5000", nil, "http://nas.lan:8081"},
+		{"ok - proxied", "", "10.0.0.2:5000", proxied, "https://media.example.com/media"},
+		{"ok - proxy chain takes the first", "", "10.0.0.2:5000", http.Header{
+			"X-Forwarded-Proto": {"https, http"},
+			"X-Forwarded-Host":  {"media.example.com, nginx.lan"},
+		}, "https://media.example.com"},
+		{"ok - proxy over ipv4 mapped ipv6", "", "[::ffff:10.0.0.2]:5000", proxied, "https://media.example.com/media"},
+		{"ok - untrusted peer is ignored", "", "192.168.1.20:5000", proxied, "http://nas.lan:8081"},
+		{"ok - bad values are ignored", "", "10.0.0.2:5000", http.Header{
+			"X-Forwarded-Proto":  {"javascript"},
+			"X-Forwarded-Host":   {"evil.com/path"},
+			"X-Forwarded-Prefix": {"/media?x=<b>"},
+		}, "http://nas.lan:8081"},
+		{"ok - external url wins", "https://tv.example.com/streamer", "10.0.0.2:5000", proxied, "https://tv.example.com/streamer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := newTestHandler(t, nil)
+			h.config.ExternalURL = tt.external
+			h.config.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+			r := httptest.NewRequest(http.MethodGet, "http://nas.lan:8081/", nil)
+			r.RemoteAddr = tt.remote
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			if got := h.baseURL(r); got != tt.want {
+				t.Errorf("baseURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseURLInGeneratedLinks(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Films/Heat.mkv": "x"})
+	h.config.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+	id := entryByName(t, h, "Heat.mkv").UUID.String()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		want    string
+	}{
+		{"ok - description", h.HandleXML, "/description.xml", "<controlURL>https://media.example.com/media/content/control</controlURL>"},
+		{"ok - m3u", h.HandleM3U, "/playlist.m3u", "https://media.example.com/media/stream?id=" + id},
+		{"ok - feed", h.HandleFeed, "/feed.xml", "https://media.example.com/media/watch/" + id},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "http://nas.lan:8081"+tt.path, nil)
+			r.RemoteAddr = "127.0.0.1:5000"
+			r.Header.Set("X-Forwarded-Proto", "https")
+			r.Header.Set("X-Forwarded-Host", "media.example.com")
+			r.Header.Set("X-Forwarded-Prefix", "/media")
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("%s has no %q:\n%s", tt.path, tt.want, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "nas.lan") {
+				t.Errorf("%s still links to the Host header:\n%s", tt.path, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("ok - didl", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodPost, "http://nas.lan:8081/content/control", nil)
+		r.RemoteAddr = "127.0.0.1:5000"
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("X-Forwarded-Host", "media.example.com")
+		r.Header.Set("X-Forwarded-Prefix", "/media")
+		didl := h.generateDIDL(rootID, nil, media.Videos(h.Media.Registry.List()), r)
+		if want := "https://media.example.com/media/direct/" + id + ".mkv"; !strings.Contains(didl, want) {
+			t.Errorf("DIDL has no %q:\n%s", want, didl)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"streamer/internal/media"
+)
+
+// changesResponse is what /api/changes answers, Seq is the since of the next call
+type changesResponse struct {
+	Seq     uint64         `json:"seq"`
+	Changes []media.Change `json:"changes"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// HandleChanges serves GET /api/changes?since=seq, the entries added, removed or modified after seq, for
+// clients keeping a copy of the library in sync without listing it all again. A since the journal can't
+// go on from, no since included, is 410 Gone with the current seq: list the library, then ask from there
+func (h *Handler) HandleChanges(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		var err error
+		if since, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			http.Error(w, "since must be a sequence number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes, seq, err := h.Media.Registry.Changes(since)
+	if errors.Is(err, media.ErrChangesTruncated) {
+		h.writeJSON(w, http.StatusGone, changesResponse{Seq: seq, Changes: []media.Change{}, Error: "changes truncated, resync the library"})
+		return
+	}
+	if changes == nil {
+		changes = []media.Change{}
+	}
+	h.writeJSON(w, http.StatusOK, changesResponse{Seq: seq, Changes: changes})
+}
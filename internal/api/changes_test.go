@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestHandleChanges(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mp4": "x", "Ronin.mkv": "x"})
+	get := func(query string) (int, changesResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.HandleChanges(rec, httptest.NewRequest(http.MethodGet, "/api/changes"+query, nil))
+		var resp changesResponse
+		if rec.Code != http.StatusBadRequest {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body.String(), err)
+			}
+		}
+		return rec.Code, resp
+	}
+
+	// a new client starts from the seq it is told to resync at
+	code, resp := get("")
+	if code != http.StatusGone || resp.Seq == 0 || resp.Error == "" {
+		t.Fatalf("no since = %d %+v, want 410 with the current seq", code, resp)
+	}
+	seq := resp.Seq
+	if _, err := h.Media.Registry.SetHidden(entryByName(t, h, "Heat.mp4").UUID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		since    string
+		wantCode int
+		wantSeq  uint64
+		want     []string // kind and path
+	}{
+		{"ok - the scan", "?since=" + strconv.FormatUint(seq-2, 10), http.StatusOK, seq + 1, []string{"added", "added", "modified Heat.mp4"}},
+		{"ok - after it", "?since=" + strconv.FormatUint(seq, 10), http.StatusOK, seq + 1, []string{"modified Heat.mp4"}},
+		{"ok - up to date", "?since=" + strconv.FormatUint(seq+1, 10), http.StatusOK, seq + 1, []string{}},
+		{"fail - before the journal", "?since=1", http.StatusGone, seq + 1, []string{}},
+		{"fail - not a number", "?since=-1", http.StatusBadRequest, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			code, resp := get(tt.since)
+			if code != tt.wantCode || resp.Seq != tt.wantSeq {
+				t.Fatalf("status %d seq %d, want %d %d", code, resp.Seq, tt.wantCode, tt.wantSeq)
+			}
+			var got []string
+			if resp.Changes != nil {
+				got = []string{}
+			}
+			for _, c := range resp.Changes {
+				if c.Kind == "added" {
+					// the scan order isn't fixed
+					got = append(got, string(c.Kind))
+					continue
+				}
+				got = append(got, string(c.Kind)+" "+c.Path)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
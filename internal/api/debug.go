@@ -0,0 +1,53 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// HandleDebugDIDL serves GET /debug/didl, the DIDL-Lite document a Browse with the same arguments gets,
+// unescaped and without the SOAP envelope, for when a TV won't list something: ?object= (default 0),
+// ?flag= (BrowseDirectChildren or BrowseMetadata), ?start=, ?count= and ?sort=, a SortCriteria. Links
+// are made for the renderer named by ?ua=, a part of its User-Agent, or for the client asking
+func (h *Handler) HandleDebugDIDL(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	browse := &BrowseRequest{
+		ObjectID:     query.Get("object"),
+		BrowseFlag:   cmp.Or(query.Get("flag"), "BrowseDirectChildren"),
+		SortCriteria: query.Get("sort"),
+	}
+	if browse.BrowseFlag != "BrowseDirectChildren" && browse.BrowseFlag != "BrowseMetadata" {
+		http.Error(w, "flag must be BrowseDirectChildren or BrowseMetadata", http.StatusBadRequest)
+		return
+	}
+	var err1, err2 error
+	browse.StartingIndex, err1 = strconv.Atoi(cmp.Or(query.Get("start"), "0"))
+	browse.RequestedCount, err2 = strconv.Atoi(cmp.Or(query.Get("count"), "0"))
+	if err1 != nil || err2 != nil || browse.StartingIndex < 0 || browse.RequestedCount < 0 {
+		http.Error(w, "start and count must be 0 or more", http.StatusBadRequest)
+		return
+	}
+	if ua := query.Get("ua"); ua != "" {
+		r = r.Clone(r.Context())
+		r.Header.Set("User-Agent", ua)
+	}
+
+	var buf bytes.Buffer
+	returned, total, err := h.browseDIDL(didlWriter{buf: &buf}, r, browse)
+	if errors.Is(err, errNoSuchObject) {
+		http.Error(w, "no such object", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errBadSort) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.Header().Set("X-Number-Returned", strconv.Itoa(returned))
+	w.Header().Set("X-Total-Matches", strconv.Itoa(total))
+	w.Write(buf.Bytes())
+}
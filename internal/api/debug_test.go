@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// browseRaw is the unescaped Result of a Browse, the DIDL-Lite document the renderer parses
+func browseRaw(t *testing.T, h *Handler, userAgent, objectID, flag string, start, count int) string {
+	t.Helper()
+
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:Browse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">
+<ObjectID>%s</ObjectID><BrowseFlag>%s</BrowseFlag><Filter>*</Filter>
+<StartingIndex>%d</StartingIndex><RequestedCount>%d</RequestedCount><SortCriteria></SortCriteria>
+</u:Browse></s:Body></s:Envelope>`, objectID, flag, start, count)
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/content/control", strings.NewReader(body))
+	r.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#Browse"`)
+	r.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	h.HandleDummyControl(w, r)
+
+	var resp struct {
+		Body struct {
+			BrowseResponse struct{ Result string }
+		}
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("Browse = %d, %v:\n%s", w.Code, err, w.Body.String())
+	}
+	return resp.Body.BrowseResponse.Result
+}
+
+func TestHandleDebugDIDL(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Films & Docs/Heat <1995>.mkv": "heat",
+		"Films & Docs/Ronin.mp4":       "ronin",
+		"Tom's.mp4":                    "x",
+	})
+	h.config.Folders = Folders
+	h.config.Recent = 10
+	h.Remux = copyRemuxer
+	h.NoMKV = []string{"Bravia"}
+	heat := entryByName(t, h, "Heat <1995>.mkv").UUID.String()
+
+	tests := []struct {
+		name      string
+		userAgent string
+		objectID  string
+		flag      string
+		start     int
+		count     int
+	}{
+		{"ok - root", "", "0", "BrowseDirectChildren", 0, 0},
+		{"ok - category", "", "category/Films & Docs", "BrowseDirectChildren", 0, 0},
+		{"ok - page", "", "all", "BrowseDirectChildren", 1, 1},
+		{"ok - folder metadata", "", "all", "BrowseMetadata", 0, 0},
+		{"ok - item metadata", "", heat, "BrowseMetadata", 0, 0},
+		{"ok - remuxing renderer", "SonyBRAVIA/1.0", "all", "BrowseDirectChildren", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			want := browseRaw(t, h, tt.userAgent, escapeXML(tt.objectID), tt.flag, tt.start, tt.count)
+
+			query := url.Values{
+				"object": {tt.objectID}, "flag": {tt.flag},
+				"start": {fmt.Sprint(tt.start)}, "count": {fmt.Sprint(tt.count)}, "ua": {tt.userAgent},
+			}
+			w := httptest.NewRecorder()
+			h.HandleDebugDIDL(w, httptest.NewRequest(http.MethodGet, "http://example.com/debug/didl?"+query.Encode(), nil))
+
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/xml; charset=utf-8" {
+				t.Fatalf("GET /debug/didl = %d %q, want 200 text/xml", w.Code, w.Header().Get("Content-Type"))
+			}
+			if got := w.Body.String(); got != want {
+				t.Errorf("/debug/didl =\n%s\nwant what Browse sent\n%s", got, want)
+			}
+		})
+	}
+
+	t.Run("fail - bad arguments", func(t *testing.T) {
+		t.Parallel()
+
+		for query, want := range map[string]int{
+			"object=nope":     http.StatusNotFound,
+			"flag=Browse":     http.StatusBadRequest,
+			"start=-1":        http.StatusBadRequest,
+			"count=ten":       http.StatusBadRequest,
+			"object=0&count=": http.StatusOK,
+		} {
+			w := httptest.NewRecorder()
+			h.HandleDebugDIDL(w, httptest.NewRequest(http.MethodGet, "http://example.com/debug/didl?"+query, nil))
+			if w.Code != want {
+				t.Errorf("GET /debug/didl?%s = %d, want %d", query, w.Code, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"streamer/internal/media"
+	"strings"
+	"sync"
+)
+
+// xmlDoubleEscaper escapes text twice over in one pass, for values in markup that is escaped itself
+var xmlDoubleEscaper = strings.NewReplacer("&", "&amp;amp;", "<", "&amp;lt;", ">", "&amp;gt;", `"`, "&amp;quot;", "'", "&amp;apos;")
+
+// didlBuffers keeps the buffers of past Browse answers, a large library's DIDL runs to megabytes and
+// growing a fresh buffer to that size each time is most of what a Browse allocates
+var didlBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// maxPooledDIDL is the largest buffer didlBuffers takes back. One Browse of a huge page shouldn't pin its
+// buffer for every Browse after it, most are a page of a folder and fit well under it
+const maxPooledDIDL = 1 << 20
+
+// putDIDLBuffer hands buf back to didlBuffers, unless it grew past maxPooledDIDL
+func putDIDLBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledDIDL {
+		return
+	}
+	didlBuffers.Put(buf)
+}
+
+// didlWriter writes DIDL-Lite to buf. With embed set the document comes out escaped, ready to go in a
+// SOAP Result as text: the markup once and the values twice, byte for byte what escaping the finished
+// document would give, without the copies
+type didlWriter struct {
+	buf   *bytes.Buffer
+	embed bool
+}
+
+// markup writes a literal piece of the document
+func (d didlWriter) markup(s string) {
+	if d.embed {
+		xmlEscaper.WriteString(d.buf, s)
+		return
+	}
+	d.buf.WriteString(s)
+}
+
+// text writes an attribute or element value
+func (d didlWriter) text(s string) {
+	if d.embed {
+		xmlDoubleEscaper.WriteString(d.buf, s)
+		return
+	}
+	xmlEscaper.WriteString(d.buf, s)
+}
+
+// int writes a number, which has nothing to escape either way
+func (d didlWriter) int(n int64) {
+	d.buf.Write(strconv.AppendInt(d.buf.AvailableBuffer(), n, 10))
+}
+
+const didlHeader = `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" ` +
+	`xmlns:dc="http://purl.org/dc/elements/1.1/" ` +
+	`xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/" ` +
+	`xmlns:dlna="urn:schemas-dlna-org:metadata-1-0/">`
+
+// writeDIDL lists the containers and then the videos, both children of parentID
+func (h *Handler) writeDIDL(d didlWriter, parentID string, containers []container, files []media.Video, r *http.Request) {
+	d.markup(didlHeader)
+
+	for _, c := range containers {
+		d.markup("\n\t<container id=\"")
+		d.text(c.ID)
+		d.markup("\" parentID=\"")
+		d.text(c.ParentID)
+		d.markup("\" childCount=\"")
+		d.int(int64(c.Count))
+		d.markup("\" restricted=\"1\">\n\t\t<dc:title>")
+		d.text(c.Title)
+		d.markup("</dc:title>\n\t\t<upnp:class>object.container.storageFolder</upnp:class>\n\t</container>")
+	}
+
+	base := h.baseURL(r)
+	for _, file := range files {
+		id := file.UUID.String()
+		ext := filepath.Ext(file.Name)
+
+		d.markup("\n\t<item id=\"")
+		d.text(id)
+		d.markup("\" parentID=\"")
+		d.text(parentID)
+		d.markup("\" restricted=\"1\">\n\t\t<dc:title>")
+		d.text(videoTitle(file))
+		d.markup("</dc:title>\n\t\t<upnp:class>object.item.videoItem</upnp:class>\n\t\t<res protocolInfo=\"")
+
+		// renderers refusing MKV get an MP4 made as they play it, of unknown size and not seekable
+		if h.remuxes(r, file.Name) {
+			d.text("http-get:*:video/mp4:" + remuxFeatures)
+			d.markup("\">")
+			d.text(base)
+			d.text("/remux/")
+			d.text(id)
+			d.text(".mp4")
+			d.markup("</res>\n\t</item>")
+			continue
+		}
+
+		// Try without any DLNA profile - just basic HTTP, unless the config sets one
+		features := "*"
+		if t, ok := h.mediaType(file.Name); ok && t.DLNAProfile != "" {
+			features = h.dlnaProfile(file.Name)
+		}
+		d.text("http-get:*:")
+		d.text(h.mimeType(file.Name))
+		d.text(":")
+		d.text(features)
+		d.markup("\"")
+
+		// the size of a URL a .strm file points at isn't known, clients take a missing one better than 0
+		if file.Size > 0 {
+			d.markup(" size=\"")
+			d.int(file.Size)
+			d.markup("\"")
+		}
+		d.markup(">")
+		d.text(base)
+		d.text("/direct/")
+		d.text(id)
+		d.text(ext)
+		d.markup("</res>\n\t</item>")
+	}
+
+	d.markup("\n</DIDL-Lite>")
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"streamer/internal/media"
+	"strings"
+	"testing"
+)
+
+// generateDIDL is the DIDL-Lite document as it is, before it's escaped into a Browse Result
+func (h *Handler) generateDIDL(parentID string, containers []container, files []media.Video, r *http.Request) string {
+	var buf bytes.Buffer
+	h.writeDIDL(didlWriter{buf: &buf}, parentID, containers, files, r)
+	return buf.String()
+}
+
+func TestWriteDIDLEmbedded(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Films/Tom & Jerry's <Best>.mkv": "matroska",
+		`Films/"Quoted".mp4`:             "mp4",
+		"Films/Plain.mp4":                "mp4",
+	})
+	h.Remux = copyRemuxer
+	h.NoMKV = []string{"Bravia"}
+	videos := media.Videos(h.Media.Registry.List())
+	containers := []container{{ID: "category/A & B", ParentID: rootID, Title: `<"A" & 'B'>`, Count: 12}}
+
+	tests := []struct {
+		name       string
+		userAgent  string
+		parentID   string
+		containers []container
+		files      []media.Video
+	}{
+		{"ok - containers", "", rootID, containers, nil},
+		{"ok - items", "", "category/Films & more", nil, videos},
+		{"ok - remuxed items", "SonyBRAVIA/1.0", rootID, nil, videos},
+		{"ok - empty", "", rootID, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodPost, "http://example.com/content/control", nil)
+			r.Header.Set("User-Agent", tt.userAgent)
+
+			// escaping as it's written must give what escaping the finished document does
+			want := escapeXML(h.generateDIDL(tt.parentID, tt.containers, tt.files, r))
+			var buf bytes.Buffer
+			h.writeDIDL(didlWriter{buf: &buf, embed: true}, tt.parentID, tt.containers, tt.files, r)
+			if got := buf.String(); got != want {
+				t.Errorf("embedded DIDL =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestPutDIDLBuffer(t *testing.T) {
+	t.Parallel()
+
+	// a buffer grown by a huge page is left to the garbage collector, the next Browse starts afresh
+	large := bytes.NewBuffer(make([]byte, 0, maxPooledDIDL+1))
+	putDIDLBuffer(large)
+	for range 10 {
+		if buf := didlBuffers.Get().(*bytes.Buffer); buf == large {
+			t.Fatalf("didlBuffers kept a buffer of %d bytes, want at most %d", buf.Cap(), maxPooledDIDL)
+		}
+	}
+}
+
+// browseBody is the SOAP Browse of a whole container
+func browseBody(objectID string) string {
+	return `<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:Browse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">
+<ObjectID>` + objectID + `</ObjectID><BrowseFlag>BrowseDirectChildren</BrowseFlag><Filter>*</Filter>
+<StartingIndex>0</StartingIndex><RequestedCount>0</RequestedCount><SortCriteria></SortCriteria>
+</u:Browse></s:Body></s:Envelope>`
+}
+
+// newLargeLibrary is a handler over n videos, with names that need escaping
+func newLargeLibrary(b *testing.B, n int) *Handler {
+	b.Helper()
+
+	files := make(map[string]string, n)
+	for i := range n {
+		files[fmt.Sprintf("Shelf %d/Film %04d & <Friends>.mp4", i%50, i)] = "x"
+	}
+	return newTestHandler(b, files)
+}
+
+// BenchmarkBrowse answers a Browse of a 5k video root, the page a renderer asking for everything gets
+func BenchmarkBrowse(b *testing.B) {
+	h := newLargeLibrary(b, 5000)
+	body := browseBody(rootID)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		r := httptest.NewRequest(http.MethodPost, "http://example.com/content/control", strings.NewReader(body))
+		r.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#Browse"`)
+		w := httptest.NewRecorder()
+		h.HandleDummyControl(w, r)
+		if w.Code != http.StatusOK {
+			b.Fatalf("Browse status = %d", w.Code)
+		}
+	}
+}
+
+// BenchmarkWriteDIDL writes the escaped DIDL of 5k videos, the part of a Browse that grows with the page
+func BenchmarkWriteDIDL(b *testing.B) {
+	h := newLargeLibrary(b, 5000)
+	files := media.Videos(h.Media.Registry.List())
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/content/control", nil)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		buf := didlBuffers.Get().(*bytes.Buffer)
+		buf.Reset()
+		h.writeDIDL(didlWriter{buf: buf, embed: true}, rootID, nil, files, r)
+		putDIDLBuffer(buf)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"streamer/internal/media"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// HandleDownload serves /download/{uuid}, the file as an attachment under its own name. It takes an IO
+// slot like a stream, ranges let an interrupted download resume
+func (h *Handler) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.FromString(r.PathValue("uuid"))
+	if err != nil {
+		http.Error(w, "bad id", http.StatusNotFound)
+		return
+	}
+
+	entry, err := h.Media.GetEntry(id)
+	if err != nil {
+		http.Error(w, "entry not found", http.StatusNotFound)
+		return
+	}
+
+	w, end, ok := h.beginStream(w, r, entry, "download")
+	if !ok {
+		return
+	}
+	defer end()
+
+	mount, err := h.Media.GetMount(entry.MountID)
+	if err != nil {
+		h.logger.Error("volume missing for entry", "vol_id", entry.MountID, "entry_id", id)
+		http.Error(w, "storage volume unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	client := clientHost(r)
+	if err := mount.Limiter.AcquirePriority(r.Context(), client, h.priority(r)); err != nil {
+		h.logger.Warn("IO limiter reached", "id", id)
+		http.Error(w, "server too busy", http.StatusServiceUnavailable)
+		return
+	}
+	defer mount.Limiter.ReleaseClient(client)
+
+	resource, err := h.Media.OpenResource(entry, rangeLength(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrPathOutsideRoot):
+			h.logger.Warn("security alert: attempted path traversal", "path", entry.Path, "remote", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+		case errors.Is(err, os.ErrNotExist):
+			http.Error(w, "file not found", http.StatusNotFound)
+		default:
+			h.logger.Error("opening resource", "path", entry.Path, "err", err)
+			http.Error(w, "file access error", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer resource.Close()
+
+	w.Header().Set("Content-Type", h.mimeType(resource.Name()))
+	w.Header().Set("Content-Disposition", attachmentDisposition(resource.Name()))
+	setETag(w, entry, resource)
+
+	active := h.metrics.ActiveStreams.WithLabelValues("download")
+	active.Inc()
+	defer active.Dec()
+
+	serveResource(w, r, resource)
+}
+
+// attachmentDisposition names the download after the file, non-ASCII names go into filename* (RFC 5987)
+func attachmentDisposition(name string) string {
+	d := mime.FormatMediaType("attachment", map[string]string{"filename": name})
+	if d == "" {
+		// a name it can't encode, the browser picks one from the URL
+		return "attachment"
+	}
+	return d
+}
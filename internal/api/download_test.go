@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHandleDownload(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Die Hard.mp4": "0123456789",
+		"Drama/Amélie.mkv":    "x",
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /download/{uuid}", h.HandleDownload)
+
+	download := func(name string) string { return "/download/" + entryByName(t, h, name).UUID.String() }
+
+	tests := []struct {
+		name            string
+		path            string
+		rangeHeader     string
+		wantCode        int
+		wantBody        string
+		wantDisposition string
+	}{
+		{"ok - whole file", download("Die Hard.mp4"), "", http.StatusOK, "0123456789", `attachment; filename="Die Hard.mp4"`},
+		{"ok - resumed", download("Die Hard.mp4"), "bytes=6-", http.StatusPartialContent, "6789", `attachment; filename="Die Hard.mp4"`},
+		{"ok - non-ascii name", download("Amélie.mkv"), "", http.StatusOK, "x", `attachment; filename*=utf-8''Am%C3%A9lie.mkv`},
+		{"fail - unknown uuid", "/download/00000000-0000-0000-0000-000000000001", "", http.StatusNotFound, "", ""},
+		{"fail - not a uuid", "/download/nope", "", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, rec.Code, tt.wantCode)
+			}
+			if tt.wantDisposition == "" {
+				return
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if got := rec.Header().Get("Content-Disposition"); got != tt.wantDisposition {
+				t.Errorf("Content-Disposition = %q, want %q", got, tt.wantDisposition)
+			}
+		})
+	}
+}
+
+func TestHandleDownloadCountsSeparately(t *testing.T) {
+	h := newTestHandler(t, map[string]string{"movie.mp4": "0123456789"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /download/{uuid}", h.HandleDownload)
+
+	slow := &blockingWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		started:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mux.ServeHTTP(slow, httptest.NewRequest(http.MethodGet, "/download/"+entryByName(t, h, "movie.mp4").UUID.String(), nil))
+	}()
+	<-slow.started
+
+	downloads := h.metrics.ActiveStreams.WithLabelValues("download")
+	if got := testutil.ToFloat64(downloads); got != 1 {
+		t.Errorf("active downloads = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(h.metrics.ActiveStreams.WithLabelValues("stream")); got != 0 {
+		t.Errorf("active streams = %v, want the download not counted as one", got)
+	}
+	// a download holds off shutdown like a stream does
+	if got := h.ActiveStreams(); got != 1 {
+		t.Errorf("ActiveStreams() = %d, want 1", got)
+	}
+
+	close(slow.release)
+	<-done
+
+	if got := testutil.ToFloat64(downloads); got != 0 {
+		t.Errorf("active downloads = %v after it finished, want 0", got)
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"streamer/internal/media"
+	"sync"
+	"time"
+)
+
+// streamTracker is the registry of the stream sessions in flight, it lets shutdown wait for them to finish
+type streamTracker struct {
+	mu       sync.Mutex
+	active   map[int]*streamSession
+	next     int // id of the next session
+	draining bool
+	refusal  string        // when set, new streams are refused with this message
+	idle     chan struct{} // closed once draining and no streams are left
+	released chan struct{} // closed by the next release, see using
+}
+
+// acquire registers a new session and gives it its ID, it fails with a reason once draining has started or
+// streams are refused
+func (t *streamTracker) acquire(s *streamSession) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		return "server is shutting down", false
+	}
+	if t.refusal != "" {
+		return t.refusal, false
+	}
+	if t.active == nil {
+		t.active = make(map[int]*streamSession)
+	}
+	t.next++
+	s.ID = t.next
+	t.active[s.ID] = s
+	return "", true
+}
+
+// release ends the session with the given id, ending one twice is harmless
+func (t *streamTracker) release(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.active[id]; !ok {
+		return
+	}
+	delete(t.active, id)
+	if t.released != nil {
+		close(t.released)
+		t.released = nil
+	}
+	if t.draining && len(t.active) == 0 {
+		close(t.idle)
+	}
+}
+
+// list returns the sessions in flight, oldest first
+func (t *streamTracker) list() []Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sessions := make([]Session, 0, len(t.active))
+	for _, s := range t.active {
+		sessions = append(sessions, s.snapshot())
+	}
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return cmp.Or(a.Started.Compare(b.Started), cmp.Compare(a.ID, b.ID))
+	})
+	return sessions
+}
+
+// using reports whether a session streams from mount, and returns a channel closed once the next session ends
+func (t *streamTracker) using(mount *media.MountPoint) (bool, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.active {
+		if s.mount == mount {
+			if t.released == nil {
+				t.released = make(chan struct{})
+			}
+			return true, t.released
+		}
+	}
+	return false, nil
+}
+
+func (t *streamTracker) drain() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// calling drain twice is harmless
+	if t.draining {
+		return
+	}
+
+	t.draining = true
+	t.idle = make(chan struct{})
+	if len(t.active) == 0 {
+		close(t.idle)
+	}
+}
+
+func (t *streamTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.active)
+}
+
+// beginStream registers a session streaming entry or answers 503 when new streams are not accepted. The
+// body goes to the returned writer so the session counts what was sent. Callers must defer the returned end
+// when it returns true, a panicking handler ends its session too
+func (h *Handler) beginStream(w http.ResponseWriter, r *http.Request, entry *media.Entry, kind string) (sw http.ResponseWriter, end func(), ok bool) {
+	// the entries of an unplugged volume are kept for when it's back, a TV that listed one before is told why
+	// it won't play instead of getting a read error
+	if h.Media.Registry.Offline(entry.MountID) {
+		http.Error(w, fmt.Sprintf("volume %s is offline", entry.MountID), http.StatusServiceUnavailable)
+		return nil, nil, false
+	}
+
+	s := &streamSession{Session: Session{
+		EntryID: entry.UUID,
+		Title:   displayTitle(entry.Name),
+		Client:  clientHost(r),
+		Kind:    kind,
+		Volume:  entry.MountID,
+		Started: time.Now(),
+		Size:    entry.Size,
+	}}
+	// the mount as of now, a reload replacing it waits for this session before letting it go
+	s.mount, _ = h.Media.GetMount(entry.MountID)
+
+	if reason, ok := h.streams.acquire(s); !ok {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return nil, nil, false
+	}
+	return &sentCounter{ResponseWriter: w, sent: &s.sent}, func() { h.streams.release(s.ID) }, true
+}
+
+// RefuseStreams answers new streams with 503 and the given reason, in-flight ones are unaffected
+func (h *Handler) RefuseStreams(reason string) {
+	h.streams.mu.Lock()
+	defer h.streams.mu.Unlock()
+	h.streams.refusal = reason
+}
+
+// AcceptStreams lifts a previous RefuseStreams
+func (h *Handler) AcceptStreams() {
+	h.RefuseStreams("")
+}
+
+// BeginDrain stops accepting new streams; they are answered with 503 from now on. The event streams of
+// the web ui end here, they have nothing left to wait for, and so do the UPnP event subscriptions
+func (h *Handler) BeginDrain() {
+	h.streams.drain()
+	h.events.close()
+	h.subscriptions.close()
+}
+
+// ActiveStreams returns the number of streams currently being served
+func (h *Handler) ActiveStreams() int {
+	return h.streams.count()
+}
+
+// WaitForStreams blocks until every in-flight stream has finished or ctx expires. It implies BeginDrain
+func (h *Handler) WaitForStreams(ctx context.Context) error {
+	h.streams.drain()
+
+	h.streams.mu.Lock()
+	idle := h.streams.idle
+	h.streams.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
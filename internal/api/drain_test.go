@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blockingWriter stalls the first body write until released, simulating a slow client mid-stream
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case <-b.started:
+	default:
+		close(b.started)
+		<-b.release
+	}
+	return b.ResponseRecorder.Write(p)
+}
+
+func TestDrainWaitsForInFlightStream(t *testing.T) {
+	h := newTestHandler(t, map[string]string{"movie.mp4": "0123456789"})
+	entry := entryByName(t, h, "movie.mp4")
+	target := "/stream?id=" + entry.UUID.String()
+
+	slow := &blockingWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		started:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+
+	streamDone := make(chan struct{})
+	go func() {
+		defer close(streamDone)
+		h.Stream(slow, httptest.NewRequest(http.MethodGet, target, nil))
+	}()
+
+	<-slow.started
+	h.BeginDrain()
+
+	// new streams are refused while draining
+	rec := httptest.NewRecorder()
+	h.Stream(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("new stream during drain: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// the in-flight stream keeps the drain from completing
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.WaitForStreams(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForStreams() with active stream error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(slow.release)
+
+	if err := h.WaitForStreams(context.Background()); err != nil {
+		t.Fatalf("WaitForStreams() after stream finished error = %v", err)
+	}
+	<-streamDone
+
+	if got := slow.Body.String(); got != "0123456789" {
+		t.Errorf("drained stream body = %q, want full content", got)
+	}
+	if got := h.ActiveStreams(); got != 0 {
+		t.Errorf("ActiveStreams() = %d, want 0", got)
+	}
+}
+
+func TestWaitForStreamsWithoutStreams(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := h.WaitForStreams(ctx); err != nil {
+		t.Fatalf("WaitForStreams() error = %v, want nil", err)
+	}
+}
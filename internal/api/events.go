@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// how often an idle /api/events connection gets a comment, it finds clients that went away and keeps
+// proxies from closing the connection
+const eventsKeepAlive = 30 * time.Second
+
+// libraryEvent is the data of a library event on /api/events
+type libraryEvent struct {
+	Version uint64 `json:"version"` // changes with every change to the library, the web ui embeds the one it shows
+	Entries int    `json:"entries"`
+}
+
+// eventHub ends the /api/events connections on shutdown, the server would otherwise wait for them
+type eventHub struct {
+	once sync.Once
+	done chan struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{done: make(chan struct{})}
+}
+
+func (e *eventHub) close() {
+	e.once.Do(func() { close(e.done) })
+}
+
+// HandleEvents serves /api/events, server-sent events telling the web ui the library changed. A library
+// event with the current version is sent right away and again after every change, until the client goes
+// away or the server shuts down
+func (h *Handler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// the connection stays open for as long as the page does, way past the write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.logger.Warn("clearing the write deadline of an event stream", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// every message is flushed at once, a failed write means the client is gone
+	send := func(msg string) bool {
+		if _, err := fmt.Fprint(w, msg); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	sendLibrary := func(version uint64) bool {
+		data, err := json.Marshal(libraryEvent{Version: version, Entries: h.Media.Registry.Len()})
+		if err != nil {
+			h.logger.Error("encoding library event", "err", err)
+			return false
+		}
+		return send("event: library\ndata: " + string(data) + "\n\n")
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	version, changed := h.Media.Registry.Watch()
+	if !sendLibrary(version) {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.events.done:
+			return
+		case <-keepAlive.C:
+			if !send(": keep-alive\n\n") {
+				return
+			}
+		case <-changed:
+			version, changed = h.Media.Registry.Watch()
+			if !sendLibrary(version) {
+				return
+			}
+		}
+	}
+}
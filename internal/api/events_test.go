@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"streamer/internal/media"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// readEvent reads the next server-sent event and returns its name and data, comments are skipped
+func readEvent(t *testing.T, r *bufio.Reader) (name, data string) {
+	t.Helper()
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// newEventServer serves HandleEvents, returned is closed once the handler returned
+func newEventServer(t *testing.T, h *Handler) (srv *httptest.Server, returned chan struct{}) {
+	t.Helper()
+
+	returned = make(chan struct{}, 1)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.HandleEvents(w, r)
+		returned <- struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, returned
+}
+
+func waitReturned(t *testing.T, returned <-chan struct{}, why string) {
+	t.Helper()
+
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("HandleEvents still running after %s", why)
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mp4": "x"})
+	srv, returned := newEventServer(t, h)
+
+	req, _ := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	events := bufio.NewReader(resp.Body)
+
+	var first, second libraryEvent
+	name, data := readEvent(t, events)
+	if err := json.Unmarshal([]byte(data), &first); name != "library" || err != nil || first.Entries != 1 {
+		t.Fatalf("first event = %s %s, want the library as it is", name, data)
+	}
+
+	// a scan found a new file
+	h.Media.Registry.Add(&media.Entry{UUID: uuid.Must(uuid.NewV7()), MountID: testMountID, Path: "Alien.mkv", Name: "Alien.mkv", Size: 1})
+	name, data = readEvent(t, events)
+	if err := json.Unmarshal([]byte(data), &second); name != "library" || err != nil || second.Entries != 2 || second.Version == first.Version {
+		t.Fatalf("event after the change = %s %s, want a new version with 2 entries", name, data)
+	}
+
+	// the page was closed
+	resp.Body.Close()
+	waitReturned(t, returned, "the client went away")
+}
+
+func TestHandleEventsEndOnDrain(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+	srv, returned := newEventServer(t, h)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer resp.Body.Close()
+	readEvent(t, bufio.NewReader(resp.Body))
+
+	h.BeginDrain()
+	waitReturned(t, returned, "the shutdown began")
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"streamer/internal/media"
+	"time"
+)
+
+// how many entries /feed.xml lists, ?limit= picks up to feedMaxItems
+const (
+	feedDefaultItems = 20
+	feedMaxItems     = 100
+)
+
+// HandleFeed serves /feed.xml, an RSS feed of the most recently added entries for feed readers. Every
+// item links to its player page and encloses the stream, so podcast clients can download it. ?category=
+// narrows it to one category, ?limit= sets how many are listed
+func (h *Handler) HandleFeed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	category := query.Get("category")
+
+	limit, err := strconv.Atoi(cmp.Or(query.Get("limit"), strconv.Itoa(feedDefaultItems)))
+	if err != nil || limit < 1 || limit > feedMaxItems {
+		http.Error(w, fmt.Sprintf("limit must be 1 to %d", feedMaxItems), http.StatusBadRequest)
+		return
+	}
+
+	entries := h.Media.Registry.List()
+	entries = slices.DeleteFunc(entries, func(e media.Entry) bool { return category != "" && e.Category != category })
+	media.SortEntries(entries, media.SortAdded, h.Media.Registry.Collation())
+	entries = entries[:min(limit, len(entries))]
+
+	title := h.config.FriendlyName
+	if category != "" {
+		title += " - " + category
+	}
+	base := h.baseURL(r)
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<rss version="2.0">`)
+	fmt.Fprintln(w, "  <channel>")
+	fmt.Fprintf(w, "    <title>%s</title>\n", escapeXML(title))
+	fmt.Fprintf(w, "    <link>%s/</link>\n", escapeXML(base))
+	fmt.Fprintln(w, "    <description>Recently added videos</description>")
+
+	for _, e := range entries {
+		fmt.Fprintln(w, "    <item>")
+		fmt.Fprintf(w, "      <title>%s</title>\n", escapeXML(displayTitle(e.Name)))
+		fmt.Fprintf(w, "      <link>%s/watch/%s</link>\n", escapeXML(base), e.UUID)
+		fmt.Fprintf(w, "      <guid isPermaLink=\"false\">urn:uuid:%s</guid>\n", e.UUID)
+		fmt.Fprintf(w, "      <pubDate>%s</pubDate>\n", e.AddedAt.UTC().Format(time.RFC1123Z))
+		fmt.Fprintf(w, "      <category>%s</category>\n", escapeXML(e.Category))
+		fmt.Fprintf(w, "      <enclosure url=\"%s\" length=\"%d\" type=\"%s\"/>\n",
+			escapeXML(streamURL(base, e)), e.StreamSize(), escapeXML(h.mimeType(e.Name)))
+		fmt.Fprintln(w, "    </item>")
+	}
+
+	fmt.Fprintln(w, "  </channel>")
+	fmt.Fprintln(w, "</rss>")
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"streamer/internal/media"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/name, -update writes it instead
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s, rerun with -update if that is intended:\n%s", path, got)
+	}
+}
+
+// feedLibrary has three entries added a day apart, the newest has characters XML has to escape
+func feedLibrary(t *testing.T) *Handler {
+	t.Helper()
+
+	h := newTestHandler(t, nil)
+	added := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+	for i, e := range []media.Entry{
+		{Name: "Heat.mp4", Category: "Action", Size: 1 << 30},
+		{Name: "Alien.mkv", Category: "Sci-Fi", Size: 2 << 30},
+		{Name: `Tom & Jerry <"Uncut">.m4v`, Category: "Kids & Family", Size: 700 << 20},
+	} {
+		e.UUID = uuid.FromStringOrNil("01900000-0000-7000-8000-00000000000" + string(rune('1'+i)))
+		e.MountID = testMountID
+		e.Path = e.Category + "/" + e.Name
+		e.ModTime = added
+		e.AddedAt = added.Add(time.Duration(i) * 24 * time.Hour)
+		h.Media.Registry.Add(&e)
+	}
+	return h
+}
+
+func TestHandleFeed(t *testing.T) {
+	t.Parallel()
+
+	h := feedLibrary(t)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		golden   string
+	}{
+		{"ok - newest first", "", http.StatusOK, "feed.xml"},
+		{"ok - category and limit", "?category=Kids+%26+Family&limit=1", http.StatusOK, "feed_category.xml"},
+		{"fail - limit too high", "?limit=101", http.StatusBadRequest, ""},
+		{"fail - bad limit", "?limit=0", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/feed.xml"+tt.query, nil)
+			req.Host = "media.local:8081"
+			rec := httptest.NewRecorder()
+			h.HandleFeed(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.golden == "" {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/rss+xml; charset=utf-8" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			golden(t, tt.golden, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"streamer/internal/media"
+	"strings"
+	"time"
+)
+
+// fileListing is one child of a directory under /files
+type fileListing struct {
+	Name    string    `json:"name"`
+	Dir     bool      `json:"dir,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time,omitzero"`
+	URL     string    `json:"url"`
+
+	SizeLabel string `json:"-"` // human readable, for the html listing
+}
+
+// filesPage is what files.html renders
+type filesPage struct {
+	Path      string
+	ParentURL string
+	Entries   []fileListing
+}
+
+// HandleFiles serves GET /files/{path...}: the volumes at /files/, then what is on them by path, e.g.
+// /files/vol_0/Action/Heat.mkv. Everything is opened through os.OpenInRoot, so neither ".." nor a symlink
+// gets out of the volume, and only videos are served. Directories answer with a listing of their
+// subdirectories and videos, JSON when the client accepts application/json
+func (h *Handler) HandleFiles(w http.ResponseWriter, r *http.Request) {
+	p := r.PathValue("path")
+	if p == "" {
+		volumes := []fileListing{}
+		for id := range h.Media.Volumes {
+			volumes = append(volumes, fileListing{Name: id, Dir: true, URL: filesURL(id, ".", true)})
+		}
+		slices.SortFunc(volumes, func(a, b fileListing) int { return strings.Compare(a.Name, b.Name) })
+		h.serveListing(w, r, filesPage{Path: "/files/", Entries: volumes})
+		return
+	}
+
+	volumeID, rel, _ := strings.Cut(p, "/")
+	mount, err := h.Media.GetMount(volumeID)
+	if err != nil {
+		http.Error(w, "volume not found", http.StatusNotFound)
+		return
+	}
+	rel = strings.TrimSuffix(rel, "/")
+	if rel == "" {
+		rel = "."
+	}
+
+	f, err := h.Media.OpenFile(mount.RootPath, rel)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrPathOutsideRoot):
+			h.logger.Warn("security alert: attempted path traversal", "path", rel, "vol_id", volumeID, "remote", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+		case errors.Is(err, os.ErrNotExist):
+			http.Error(w, "file not found", http.StatusNotFound)
+		default:
+			h.logger.Error("opening file", "path", rel, "vol_id", volumeID, "err", err)
+			http.Error(w, "file access error", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "file access error", http.StatusInternalServerError)
+		return
+	}
+
+	if info.IsDir() {
+		children, err := f.ReadDir(-1)
+		if err != nil {
+			h.logger.Error("listing directory", "path", rel, "vol_id", volumeID, "err", err)
+			http.Error(w, "file access error", http.StatusInternalServerError)
+			return
+		}
+		page := filesPage{Path: "/files/" + path.Join(volumeID, rel) + "/", ParentURL: "/files/"}
+		if rel != "." {
+			page.ParentURL = filesURL(volumeID, path.Dir(rel), true)
+		}
+		page.Entries = h.listFiles(volumeID, rel, children)
+		h.serveListing(w, r, page)
+		return
+	}
+
+	// the scan's whitelist, the rest of a volume (subtitles, nfo files, whatever else lives there) stays private
+	if !info.Mode().IsRegular() || !h.Media.Registry.IsVideo(info.Name()) {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+
+	w, end, ok := h.beginStream(w, r, &media.Entry{Name: info.Name(), Path: rel, MountID: volumeID, Size: info.Size()}, "file")
+	if !ok {
+		return
+	}
+	defer end()
+
+	client := clientHost(r)
+	if err := mount.Limiter.AcquirePriority(r.Context(), client, h.priority(r)); err != nil {
+		h.logger.Warn("IO limiter reached", "path", rel, "vol_id", volumeID)
+		http.Error(w, "server too busy", http.StatusServiceUnavailable)
+		return
+	}
+	defer mount.Limiter.ReleaseClient(client)
+
+	active := h.metrics.ActiveStreams.WithLabelValues("file")
+	active.Inc()
+	defer active.Dec()
+
+	w.Header().Set("Content-Type", h.mimeType(info.Name()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// listFiles keeps the subdirectories and videos of a directory, hidden videos left out. Symlinks are left
+// out too, following one may well be refused
+func (h *Handler) listFiles(volumeID, dir string, children []os.DirEntry) []fileListing {
+	entries := []fileListing{}
+	for _, c := range children {
+		if c.IsDir() {
+			entries = append(entries, fileListing{Name: c.Name(), Dir: true, URL: filesURL(volumeID, path.Join(dir, c.Name()), true)})
+			continue
+		}
+		if !c.Type().IsRegular() || !h.Media.Registry.IsVideo(c.Name()) {
+			continue
+		}
+		// left out like everywhere else it's listed, its path still serves it as its UUID does
+		if h.Media.Registry.IsHidden(volumeID, path.Join(dir, c.Name())) {
+			continue
+		}
+		info, err := c.Info()
+		if err != nil {
+			// gone since the directory was read
+			continue
+		}
+		entries = append(entries, fileListing{
+			Name:      c.Name(),
+			Size:      info.Size(),
+			ModTime:   info.ModTime(),
+			URL:       filesURL(volumeID, path.Join(dir, c.Name()), false),
+			SizeLabel: humanBytes(info.Size()),
+		})
+	}
+	slices.SortFunc(entries, func(a, b fileListing) int { return strings.Compare(a.Name, b.Name) })
+	return entries
+}
+
+// filesURL links to rel on a volume, every segment escaped so names with "#", "?" or "%" survive
+func filesURL(volumeID, rel string, dir bool) string {
+	u := "/files/" + url.PathEscape(volumeID)
+	if rel != "." {
+		for seg := range strings.SplitSeq(rel, "/") {
+			u += "/" + url.PathEscape(seg)
+		}
+	}
+	if dir {
+		u += "/"
+	}
+	return u
+}
+
+// serveListing answers with the children of a directory, as files.html or JSON
+func (h *Handler) serveListing(w http.ResponseWriter, r *http.Request, page filesPage) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		h.writeJSON(w, http.StatusOK, page.Entries)
+		return
+	}
+	h.render(w, "files.html", page)
+}
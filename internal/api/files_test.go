@@ -0,0 +1,234 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newFilesMux serves /files like the server does, with a secret.mp4 next to the volume and, where the
+// system allows, symlinks in the volume pointing at it
+func newFilesMux(t *testing.T) (*http.ServeMux, bool) {
+	t.Helper()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Heat.mp4":     "0123456789",
+		"Action/Heat.srt":     "subtitles",
+		"Tom & Jerry #1.mkv":  "x",
+		"Comedy/Airplane.m4v": "x",
+	})
+	root := h.Media.Volumes[testMountID].RootPath
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.mp4"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	symlinks := os.Symlink(filepath.Join(outside, "secret.mp4"), filepath.Join(root, "link.mp4")) == nil &&
+		os.Symlink(outside, filepath.Join(root, "dirlink")) == nil
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{path...}", h.HandleFiles)
+	return mux, symlinks
+}
+
+func TestHandleFiles(t *testing.T) {
+	t.Parallel()
+
+	mux, symlinks := newFilesMux(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		symlink  bool
+		wantCode int
+		wantBody string
+	}{
+		{"ok - by path", "/files/vol_0/Action/Heat.mp4", false, http.StatusOK, "0123456789"},
+		{"ok - escaped name", "/files/vol_0/Tom%20&%20Jerry%20%231.mkv", false, http.StatusOK, "x"},
+		{"ok - escaped slash", "/files/vol_0/Comedy%2FAirplane.m4v", false, http.StatusOK, "x"},
+		{"fail - not a video", "/files/vol_0/Action/Heat.srt", false, http.StatusNotFound, ""},
+		{"fail - missing", "/files/vol_0/Action/Ronin.mp4", false, http.StatusNotFound, ""},
+		{"fail - unknown volume", "/files/vol_9/Action/Heat.mp4", false, http.StatusNotFound, ""},
+		{"fail - escaped dot dot", "/files/vol_0/%2e%2e/secret.mp4", false, http.StatusForbidden, ""},
+		{"fail - dot dot behind escaped slashes", "/files/vol_0/Action%2F..%2F..%2Fsecret.mp4", false, http.StatusForbidden, ""},
+		{"fail - absolute path", "/files/vol_0/%2Fetc%2Fpasswd", false, http.StatusForbidden, ""},
+		{"fail - symlink to a file outside", "/files/vol_0/link.mp4", true, http.StatusForbidden, ""},
+		{"fail - symlink to a directory outside", "/files/vol_0/dirlink/secret.mp4", true, http.StatusForbidden, ""},
+		{"fail - listing through a symlink", "/files/vol_0/dirlink/", true, http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tt.symlink && !symlinks {
+				t.Skip("no symlinks here")
+			}
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, rec.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				if strings.Contains(rec.Body.String(), "secret") {
+					t.Errorf("GET %s leaked the file outside: %q", tt.path, rec.Body)
+				}
+				return
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandleFilesDotDot(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mp4": "x"})
+
+	// the mux redirects a literal ".." to the cleaned path before it gets here, the handler refuses it anyway
+	for _, p := range []string{"vol_0/../secret.mp4", "vol_0/Action/../../secret.mp4"} {
+		req := httptest.NewRequest(http.MethodGet, "/files/", nil)
+		req.SetPathValue("path", p)
+		rec := httptest.NewRecorder()
+		h.HandleFiles(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s status = %d, want 403", p, rec.Code)
+		}
+	}
+}
+
+func TestHandleFilesRange(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := newFilesMux(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/vol_0/Action/Heat.mp4", nil)
+	req.Header.Set("Range", "bytes=2-4")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "234" {
+		t.Errorf("ranged GET = %d %q, want 206 \"234\"", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "video/mp4" {
+		t.Errorf("Content-Type = %q, want video/mp4", ct)
+	}
+}
+
+func TestHandleFilesListing(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := newFilesMux(t)
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d", path, rec.Code)
+		}
+		return rec
+	}
+
+	listing := func(path string) []fileListing {
+		var got []fileListing
+		if err := json.Unmarshal(get(path, "application/json").Body.Bytes(), &got); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		return got
+	}
+	urls := func(l []fileListing) string {
+		var s []string
+		for _, f := range l {
+			s = append(s, f.URL)
+		}
+		return strings.Join(s, " ")
+	}
+
+	if got, want := urls(listing("/files/")), "/files/vol_0/"; got != want {
+		t.Errorf("volumes = %s, want %s", got, want)
+	}
+	// subtitles and symlinks are not listed, names are escaped
+	if got, want := urls(listing("/files/vol_0/")), "/files/vol_0/Action/ /files/vol_0/Comedy/ /files/vol_0/Tom%20&%20Jerry%20%231.mkv"; got != want {
+		t.Errorf("volume lists %s, want %s", got, want)
+	}
+	action := listing("/files/vol_0/Action")
+	if len(action) != 1 || action[0].Name != "Heat.mp4" || action[0].Size != 10 || action[0].Dir {
+		t.Errorf("Action lists %+v, want Heat.mp4 of 10 bytes", action)
+	}
+
+	rec := get("/files/vol_0/Action/", "")
+	body := rec.Body.String()
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want html", ct)
+	}
+	for _, want := range []string{`<a href="/files/vol_0/">../</a>`, `<a href="/files/vol_0/Action/Heat.mp4">Heat.mp4</a>`, `10 B`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("html listing has no %s:\n%s", want, body)
+		}
+	}
+	if body := get("/files/vol_0/", "").Body.String(); !strings.Contains(body, `Tom &amp; Jerry #1.mkv`) {
+		t.Errorf("html listing does not escape names:\n%s", body)
+	}
+}
+
+func TestHandleFilesHidden(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Heat.mp4":  "x",
+		"Action/Ronin.mp4": "x",
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{path...}", h.HandleFiles)
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	names := func() []string {
+		var listing []fileListing
+		if err := json.Unmarshal(get("/files/vol_0/Action/").Body.Bytes(), &listing); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range listing {
+			got = append(got, f.Name)
+		}
+		return got
+	}
+
+	ronin := entryByName(t, h, "Ronin.mp4")
+	if _, err := h.Media.Registry.SetHidden(ronin.UUID, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); !slices.Equal(got, []string{"Heat.mp4"}) {
+		t.Errorf("Action lists %q with Ronin hidden, want Heat.mp4 alone", got)
+	}
+	// hidden isn't gone, the path plays it as the UUID does
+	if rec := get("/files/vol_0/Action/Ronin.mp4"); rec.Code != http.StatusOK {
+		t.Errorf("GET hidden Ronin.mp4 by path = %d, want 200", rec.Code)
+	}
+
+	if _, err := h.Media.Registry.SetHidden(ronin.UUID, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); !slices.Equal(got, []string{"Heat.mp4", "Ronin.mp4"}) {
+		t.Errorf("Action lists %q with Ronin shown again, want both", got)
+	}
+}
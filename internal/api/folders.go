@@ -0,0 +1,182 @@
+package api
+
+import (
+	"path/filepath"
+	"slices"
+	"streamer/internal/media"
+	"strings"
+)
+
+// Folder is a virtual container Browse lists at the root, made from the library rather than its directories
+type Folder string
+
+const (
+	FolderAll        Folder = "all"        // every video
+	FolderRecent     Folder = "recent"     // the most recently added, as many as Config.Recent
+	FolderCategories Folder = "categories" // one per category
+)
+
+// Folders are all the virtual folders, in the order Browse lists them
+var Folders = []Folder{FolderAll, FolderRecent, FolderCategories}
+
+// container IDs, they don't change across restarts so renderers can come back to them
+const (
+	rootID           = "0"
+	allID            = "all"
+	recentID         = "recent"
+	categoryIDPrefix = "category/" // followed by the category's path with / between its directories
+)
+
+// container is a folder in a Browse result
+type container struct {
+	ID       string
+	ParentID string
+	Title    string
+	Count    int // children
+}
+
+// folder returns the container with the given id and its children: the folders in it, then the videos.
+// The root holds the folders and no videos, or every video when no folders are set
+func (h *Handler) folder(id string) (container, []container, []media.Video, bool) {
+	enabled := func(f Folder) bool { return slices.Contains(h.config.Folders, f) }
+
+	switch {
+	case id == rootID:
+		root := container{ID: rootID, ParentID: "-1", Title: h.config.FriendlyName}
+		if len(h.config.Folders) == 0 {
+			videos := media.Videos(h.Media.Registry.List())
+			root.Count = len(videos)
+			return root, nil, videos, true
+		}
+		folders := h.rootFolders()
+		root.Count = len(folders)
+		return root, folders, nil, true
+
+	case id == allID && enabled(FolderAll):
+		videos := media.Videos(h.Media.Registry.List())
+		return container{ID: allID, ParentID: rootID, Title: "All Videos", Count: len(videos)}, nil, videos, true
+
+	case id == recentID && enabled(FolderRecent):
+		entries := h.Media.Registry.List()
+		media.SortEntries(entries, media.SortAdded, h.Media.Registry.Collation())
+		videos := media.Videos(entries[:min(len(entries), h.config.Recent)])
+		return container{ID: recentID, ParentID: rootID, Title: "Recently Added", Count: len(videos)}, nil, videos, true
+
+	case strings.HasPrefix(id, categoryIDPrefix) && enabled(FolderCategories):
+		dir := strings.TrimPrefix(id, categoryIDPrefix)
+		var entries []media.Entry
+		for _, e := range h.Media.Registry.List() {
+			if filepath.ToSlash(e.Category) == dir {
+				entries = append(entries, e)
+			}
+		}
+		subfolders := categoryFolders(h.Media.Registry.Categories(), dir)
+		// a category the last scan emptied is gone, with its subcategories
+		if len(entries) == 0 && len(subfolders) == 0 {
+			return container{}, nil, nil, false
+		}
+		_, name, _ := cutLast(dir)
+		c := container{ID: id, ParentID: categoryParentID(dir), Title: name, Count: len(subfolders) + len(entries)}
+		return c, subfolders, media.Videos(entries), true
+	}
+	return container{}, nil, nil, false
+}
+
+// itemParentID is the folder the metadata of an item in category names as its parent, one that lists it:
+// its category's, else All Videos, else the root
+func (h *Handler) itemParentID(category string) string {
+	switch {
+	case slices.Contains(h.config.Folders, FolderCategories):
+		return categoryIDPrefix + filepath.ToSlash(category)
+	case slices.Contains(h.config.Folders, FolderAll):
+		return allID
+	}
+	return rootID
+}
+
+// categoryFolders are the folders of the categories right below parent, "" for the top. A category nested
+// in another, a directory in a directory, is a folder in the folder of its parent, which is there even
+// when it has no videos of its own
+func categoryFolders(categories []media.Category, parent string) []container {
+	counts := make(map[string]int) // children by category path: its videos and the folders right below it
+	seen := make(map[string]bool)  // every folder, the categories and the directories on their way
+	for _, c := range categories {
+		dir := filepath.ToSlash(c.Name)
+		counts[dir] += c.Count
+		for child := dir; !seen[child]; {
+			seen[child] = true
+			up, _, nested := cutLast(child)
+			if !nested {
+				break
+			}
+			counts[up]++
+			child = up
+		}
+	}
+
+	var folders []container
+	for dir := range seen {
+		if up, name, _ := cutLast(dir); up == parent {
+			folders = append(folders, container{ID: categoryIDPrefix + dir, ParentID: categoryParentID(dir), Title: name, Count: counts[dir]})
+		}
+	}
+	slices.SortFunc(folders, func(a, b container) int { return strings.Compare(a.ID, b.ID) })
+	return folders
+}
+
+// categoryParentID is the container holding the folder of the category at dir
+func categoryParentID(dir string) string {
+	if up, _, nested := cutLast(dir); nested {
+		return categoryIDPrefix + up
+	}
+	return rootID
+}
+
+// cutLast splits a category path at its last /, a path without one is a name with "" above it
+func cutLast(dir string) (up, name string, nested bool) {
+	i := strings.LastIndex(dir, "/")
+	if i < 0 {
+		return "", dir, false
+	}
+	return dir[:i], dir[i+1:], true
+}
+
+// rootFolders are the folders the root holds, in the order of Folders
+func (h *Handler) rootFolders() []container {
+	var folders []container
+	for _, f := range Folders {
+		if !slices.Contains(h.config.Folders, f) {
+			continue
+		}
+		switch f {
+		case FolderAll:
+			folders = append(folders, container{ID: allID, ParentID: rootID, Title: "All Videos", Count: h.Media.Registry.Len()})
+		case FolderRecent:
+			folders = append(folders, container{ID: recentID, ParentID: rootID, Title: "Recently Added", Count: min(h.Media.Registry.Len(), h.config.Recent)})
+		case FolderCategories:
+			folders = append(folders, categoryFolders(h.Media.Registry.Categories(), "")...)
+		}
+	}
+	return folders
+}
+
+// pageChildren is the part of the children of a folder a Browse asked for, its folders come before its
+// videos. A count of 0 means all from start
+func pageChildren(folders []container, videos []media.Video, start, count int) ([]container, []media.Video) {
+	paged := page(folders, start, count)
+	if count > 0 {
+		if count -= len(paged); count == 0 {
+			return paged, nil
+		}
+	}
+	return paged, page(videos, start-len(folders), count)
+}
+
+// page is the part of s a Browse asked for, a count of 0 means all from start
+func page[T any](s []T, start, count int) []T {
+	start = min(max(start, 0), len(s))
+	if count <= 0 {
+		return s[start:]
+	}
+	return s[start:min(start+count, len(s))]
+}
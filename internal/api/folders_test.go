@@ -0,0 +1,334 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// browseResult is a Browse answer with its DIDL unpacked
+type browseResult struct {
+	status     int
+	fault      int // UPnP error code
+	returned   int
+	total      int
+	containers []string // "id parent count"
+	items      []string // "title parent"
+}
+
+// browse posts a ContentDirectory Browse to h
+func browse(t *testing.T, h *Handler, objectID, flag string, start, count int) browseResult {
+	t.Helper()
+	return browseSorted(t, h, objectID, flag, "", start, count)
+}
+
+// browseSorted posts a ContentDirectory Browse with a SortCriteria to h
+func browseSorted(t *testing.T, h *Handler, objectID, flag, sort string, start, count int) browseResult {
+	t.Helper()
+
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:Browse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">
+<ObjectID>%s</ObjectID><BrowseFlag>%s</BrowseFlag><Filter>*</Filter>
+<StartingIndex>%d</StartingIndex><RequestedCount>%d</RequestedCount><SortCriteria>%s</SortCriteria>
+</u:Browse></s:Body></s:Envelope>`, objectID, flag, start, count, sort)
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/content/control", strings.NewReader(body))
+	r.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#Browse"`)
+	w := httptest.NewRecorder()
+	h.HandleDummyControl(w, r)
+
+	if w.Code != http.StatusOK {
+		var fault struct {
+			Code int `xml:"Body>Fault>detail>UPnPError>errorCode"`
+		}
+		xml.Unmarshal(w.Body.Bytes(), &fault)
+		return browseResult{status: w.Code, fault: fault.Code}
+	}
+
+	var resp struct {
+		Body struct {
+			BrowseResponse struct {
+				Result         string
+				NumberReturned int
+				TotalMatches   int
+			}
+		}
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal response: %v\n%s", err, w.Body.String())
+	}
+	var didl struct {
+		Containers []struct {
+			ID         string `xml:"id,attr"`
+			ParentID   string `xml:"parentID,attr"`
+			ChildCount int    `xml:"childCount,attr"`
+		} `xml:"container"`
+		Items []struct {
+			ParentID string `xml:"parentID,attr"`
+			Title    string `xml:"title"`
+		} `xml:"item"`
+	}
+	if err := xml.Unmarshal([]byte(resp.Body.BrowseResponse.Result), &didl); err != nil {
+		t.Fatalf("unmarshal DIDL: %v\n%s", err, resp.Body.BrowseResponse.Result)
+	}
+
+	res := browseResult{
+		status:   w.Code,
+		returned: resp.Body.BrowseResponse.NumberReturned,
+		total:    resp.Body.BrowseResponse.TotalMatches,
+	}
+	for _, c := range didl.Containers {
+		res.containers = append(res.containers, fmt.Sprintf("%s %s %d", c.ID, c.ParentID, c.ChildCount))
+	}
+	for _, i := range didl.Items {
+		res.items = append(res.items, i.Title+" "+i.ParentID)
+	}
+	return res
+}
+
+func TestBrowseFolders(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Films/Heat.mkv":  "x",
+		"Films/Ronin.mp4": "x",
+		"Films/Speed.mp4": "x",
+		"Docs/Earth.mp4":  "x",
+		"Top.mp4":         "x",
+	})
+	h.config.Folders = Folders
+	h.config.Recent = 2
+	heat := entryByName(t, h, "Heat.mkv").UUID.String()
+
+	tests := []struct {
+		name           string
+		objectID       string
+		flag           string
+		start, count   int
+		wantReturned   int
+		wantTotal      int
+		wantContainers []string
+		wantItems      []string
+	}{
+		{"ok - root", "0", "BrowseDirectChildren", 0, 0, 5, 5, []string{
+			"all 0 5", "recent 0 2", "category/Docs 0 1", "category/Films 0 3", "category/Uncategorized 0 1",
+		}, nil},
+		{"ok - root page", "0", "BrowseDirectChildren", 1, 2, 2, 5, []string{"recent 0 2", "category/Docs 0 1"}, nil},
+		{"ok - all", "all", "BrowseDirectChildren", 0, 0, 5, 5, nil, []string{"Earth all", "Heat all", "Ronin all", "Speed all", "Top all"}},
+		{"ok - all last page", "all", "BrowseDirectChildren", 3, 10, 2, 5, nil, []string{"Speed all", "Top all"}},
+		{"ok - start past the end", "all", "BrowseDirectChildren", 9, 10, 0, 5, nil, nil},
+		{"ok - recent", "recent", "BrowseDirectChildren", 0, 0, 2, 2, nil, nil},
+		{"ok - category", "category/Films", "BrowseDirectChildren", 1, 1, 1, 3, nil, []string{"Ronin category/Films"}},
+		{"ok - root metadata", "0", "BrowseMetadata", 0, 0, 1, 1, []string{"0 -1 5"}, nil},
+		{"ok - folder metadata", "category/Films", "BrowseMetadata", 0, 0, 1, 1, []string{"category/Films 0 3"}, nil},
+		{"ok - item metadata", heat, "BrowseMetadata", 0, 0, 1, 1, nil, []string{"Heat category/Films"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := browse(t, h, tt.objectID, tt.flag, tt.start, tt.count)
+			if got.status != http.StatusOK || got.returned != tt.wantReturned || got.total != tt.wantTotal {
+				t.Fatalf("Browse(%s) = %d returning %d of %d, want 200 returning %d of %d", tt.objectID, got.status, got.returned, got.total, tt.wantReturned, tt.wantTotal)
+			}
+			if len(got.containers)+len(got.items) != got.returned {
+				t.Errorf("NumberReturned %d but the DIDL has %d containers and %d items", got.returned, len(got.containers), len(got.items))
+			}
+			if !slices.Equal(got.containers, tt.wantContainers) {
+				t.Errorf("containers = %q, want %q", got.containers, tt.wantContainers)
+			}
+			if tt.wantItems != nil && !slices.Equal(got.items, tt.wantItems) {
+				t.Errorf("items = %q, want %q", got.items, tt.wantItems)
+			}
+		})
+	}
+
+	t.Run("fail - no such folder", func(t *testing.T) {
+		t.Parallel()
+
+		for _, id := range []string{"category/Music", "nope", "0194d3c2-0000-7000-8000-000000000000"} {
+			if got := browse(t, h, id, "BrowseDirectChildren", 0, 0); got.status != http.StatusInternalServerError {
+				t.Errorf("Browse(%s) status = %d, want the 500 of a fault", id, got.status)
+			}
+		}
+	})
+}
+
+func TestBrowseNestedCategories(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Films/Heat.mkv":                      "x",
+		"Films/Classics/Ran.mkv":              "x",
+		"Films/Classics/Silent/Nosferatu.mp4": "x",
+		"Shows/Drama/Lost.mp4":                "x",
+	})
+	h.config.Folders = []Folder{FolderCategories}
+
+	tests := []struct {
+		name           string
+		objectID       string
+		flag           string
+		start, count   int
+		wantTotal      int
+		wantContainers []string
+		wantItems      []string
+	}{
+		{"ok - root holds the top directories", "0", "BrowseDirectChildren", 0, 0, 2, []string{"category/Films 0 2", "category/Shows 0 1"}, nil},
+		{"ok - folders before videos", "category/Films", "BrowseDirectChildren", 0, 0, 2, []string{"category/Films/Classics category/Films 2"}, []string{"Heat category/Films"}},
+		{"ok - first page is the folder", "category/Films", "BrowseDirectChildren", 0, 1, 2, []string{"category/Films/Classics category/Films 2"}, nil},
+		{"ok - second page is the video", "category/Films", "BrowseDirectChildren", 1, 1, 2, nil, []string{"Heat category/Films"}},
+		{"ok - deepest", "category/Films/Classics/Silent", "BrowseDirectChildren", 0, 0, 1, nil, []string{"Nosferatu category/Films/Classics/Silent"}},
+		{"ok - directory without videos of its own", "category/Shows", "BrowseDirectChildren", 0, 0, 1, []string{"category/Shows/Drama category/Shows 1"}, nil},
+		{"ok - nested metadata", "category/Films/Classics", "BrowseMetadata", 0, 0, 1, []string{"category/Films/Classics category/Films 2"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := browse(t, h, tt.objectID, tt.flag, tt.start, tt.count)
+			if got.status != http.StatusOK || got.total != tt.wantTotal || got.returned != len(got.containers)+len(got.items) {
+				t.Fatalf("Browse(%s) = %d returning %d of %d, want 200 of %d", tt.objectID, got.status, got.returned, got.total, tt.wantTotal)
+			}
+			if !slices.Equal(got.containers, tt.wantContainers) || !slices.Equal(got.items, tt.wantItems) {
+				t.Errorf("containers %q items %q, want %q %q", got.containers, got.items, tt.wantContainers, tt.wantItems)
+			}
+		})
+	}
+
+	if got := browse(t, h, "category/Films/Classics/Sil", "BrowseDirectChildren", 0, 0); got.status != http.StatusInternalServerError {
+		t.Errorf("Browse of a part of a category name status = %d, want the 500 of a fault", got.status)
+	}
+}
+
+func TestBrowseMetadata(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{"Films/Classics/Ran.mkv": "x", "Top.mp4": "x"}
+	tests := []struct {
+		name           string
+		folders        []Folder
+		objectID       string // a file name stands for the UUID of that video
+		wantContainers []string
+		wantItems      []string
+		wantFault      int
+	}{
+		{"ok - root", Folders, "0", []string{"0 -1 4"}, nil, 0},
+		{"ok - root of an empty id", Folders, "", []string{"0 -1 4"}, nil, 0},
+		{"ok - root without folders", nil, "0", []string{"0 -1 2"}, nil, 0},
+		{"ok - folder", Folders, "all", []string{"all 0 2"}, nil, 0},
+		{"ok - item in its category", Folders, "Ran.mkv", nil, []string{"Ran category/Films/Classics"}, 0},
+		{"ok - uncategorized item", Folders, "Top.mp4", nil, []string{"Top category/Uncategorized"}, 0},
+		{"ok - item in all videos", []Folder{FolderAll, FolderRecent}, "Ran.mkv", nil, []string{"Ran all"}, 0},
+		{"ok - item without folders", nil, "Ran.mkv", nil, []string{"Ran 0"}, 0},
+		{"fail - unknown uuid", Folders, "0194d3c2-0000-7000-8000-000000000000", nil, nil, upnpErrNoSuchObject},
+		{"fail - unknown id", Folders, "64$0$1", nil, nil, upnpErrNoSuchObject},
+		{"fail - folder that isn't enabled", []Folder{FolderAll}, "recent", nil, nil, upnpErrNoSuchObject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := newTestHandler(t, files)
+			h.config.Folders = tt.folders
+			id := tt.objectID
+			if filepath.Ext(id) != "" {
+				id = entryByName(t, h, id).UUID.String()
+			}
+
+			got := browse(t, h, id, "BrowseMetadata", 0, 0)
+			if tt.wantFault != 0 {
+				if got.status != http.StatusInternalServerError || got.fault != tt.wantFault {
+					t.Fatalf("Browse(%s) = %d with errorCode %d, want 500 with %d", id, got.status, got.fault, tt.wantFault)
+				}
+				return
+			}
+			if got.status != http.StatusOK || got.returned != 1 || got.total != 1 {
+				t.Fatalf("Browse(%s) = %d returning %d of %d, want 200 returning 1 of 1", id, got.status, got.returned, got.total)
+			}
+			if !slices.Equal(got.containers, tt.wantContainers) || !slices.Equal(got.items, tt.wantItems) {
+				t.Errorf("containers %q items %q, want %q %q", got.containers, got.items, tt.wantContainers, tt.wantItems)
+			}
+		})
+	}
+}
+
+func TestBrowseWithoutFolders(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Films/Heat.mkv": "x", "Docs/Earth.mp4": "x"})
+
+	// the root lists every video, as before there were folders
+	got := browse(t, h, "0", "BrowseDirectChildren", 0, 0)
+	if got.total != 2 || len(got.containers) != 0 || !slices.Equal(got.items, []string{"Earth 0", "Heat 0"}) {
+		t.Errorf("Browse(0) = %d containers %q items %q, want the two videos", got.total, got.containers, got.items)
+	}
+	if got := browse(t, h, "all", "BrowseDirectChildren", 0, 0); got.status != http.StatusInternalServerError {
+		t.Errorf("Browse(all) status = %d, want a fault with the folder off", got.status)
+	}
+}
+
+func TestBrowseMax(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{}
+	for _, name := range []string{"A", "B", "C", "D", "E"} {
+		files["Films/"+name+".mp4"] = "x"
+	}
+	h := newTestHandler(t, files)
+	h.config.BrowseMax = 2
+	unclamped := newTestHandler(t, files)
+
+	tests := []struct {
+		name         string
+		h            *Handler
+		start, count int
+		wantItems    []string
+	}{
+		{"ok - everything is clamped", h, 0, 0, []string{"A 0", "B 0"}},
+		{"ok - more than the cap is clamped", h, 0, 10, []string{"A 0", "B 0"}},
+		{"ok - clamped from an offset", h, 3, 0, []string{"D 0", "E 0"}},
+		{"ok - clamped at the end", h, 4, 10, []string{"E 0"}},
+		{"ok - under the cap", h, 2, 1, []string{"C 0"}},
+		{"ok - at the cap", h, 1, 2, []string{"B 0", "C 0"}},
+		{"ok - no cap", unclamped, 0, 0, []string{"A 0", "B 0", "C 0", "D 0", "E 0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := browse(t, tt.h, "0", "BrowseDirectChildren", tt.start, tt.count)
+			if got.status != http.StatusOK || got.total != 5 {
+				t.Fatalf("Browse = %d with %d total, want 200 with 5", got.status, got.total)
+			}
+			if got.returned != len(got.items) {
+				t.Errorf("NumberReturned %d but the DIDL has %d items", got.returned, len(got.items))
+			}
+			if !slices.Equal(got.items, tt.wantItems) {
+				t.Errorf("items = %q, want %q", got.items, tt.wantItems)
+			}
+		})
+	}
+
+	t.Run("ok - folders are clamped too", func(t *testing.T) {
+		t.Parallel()
+
+		h := newTestHandler(t, files)
+		h.config.Folders = Folders
+		h.config.Recent = 10
+		h.config.BrowseMax = 2
+		got := browse(t, h, "0", "BrowseDirectChildren", 0, 0)
+		if got.returned != 2 || got.total != 3 || !slices.Equal(got.containers, []string{"all 0 5", "recent 0 5"}) {
+			t.Errorf("Browse(0) = %d of %d %q, want the first 2 of 3 folders", got.returned, got.total, got.containers)
+		}
+	})
+}
@@ -0,0 +1,412 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"streamer/internal/media"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	// a subscription lasts what it asks for within these, no TIMEOUT or infinite gets the most
+	genaMinTimeout = 60 * time.Second
+	genaMaxTimeout = 1800 * time.Second
+	// SystemUpdateID and ContainerUpdateIDs are moderated: evented at most every 2 seconds, the changes in
+	// between go out together
+	genaModeration = 2 * time.Second
+	// how long a subscriber has to answer a NOTIFY
+	genaNotifyTimeout = 5 * time.Second
+	// subscriptions kept at once, SUBSCRIBE is refused past that until some end or expire
+	genaMaxSubscriptions = 64
+	// events waiting for a subscriber, a slow one misses those past it and catches up with the next
+	genaQueue = 8
+)
+
+// upnpServer is the Server header of the UPnP answers, OS, UPnP version and product
+const upnpServer = "Linux/3.10.0 UPnP/1.0 DLNADOC/1.50 GoStream/1.0"
+
+// genaService is an evented service of the device, named after its event URL
+type genaService string
+
+const (
+	serviceContent    genaService = "content"
+	serviceConnection genaService = "connection"
+)
+
+// errTooManySubscriptions is a SUBSCRIBE past genaMaxSubscriptions
+var errTooManySubscriptions = errors.New("too many subscriptions")
+
+// subscription is a GENA subscription to the events of a service
+type subscription struct {
+	sid       string
+	service   genaService
+	callbacks []string             // the URLs a NOTIFY tries in turn until one takes it
+	expires   time.Time            // guarded by the mu of genaSubscriptions
+	events    chan []EventProperty // waiting to be sent, in order
+	done      chan struct{}        // closed once it ends: unsubscribed, expired or at shutdown
+}
+
+// genaSubscriptions are the GENA subscriptions to the services. Every subscription has a goroutine
+// sending its events in order, library changes reach those of the ContentDirectory from a goroutine
+// watching the registry, started with the first one
+type genaSubscriptions struct {
+	mu    sync.Mutex
+	bySID map[string]*subscription
+	watch sync.Once
+
+	ctx        context.Context // canceled at shutdown, ends the goroutines and NOTIFYs in flight
+	cancel     context.CancelFunc
+	client     *http.Client
+	now        func() time.Time
+	moderation time.Duration
+}
+
+func newGenaSubscriptions() *genaSubscriptions {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &genaSubscriptions{
+		bySID:      make(map[string]*subscription),
+		ctx:        ctx,
+		cancel:     cancel,
+		client:     &http.Client{Timeout: genaNotifyTimeout},
+		now:        time.Now,
+		moderation: genaModeration,
+	}
+}
+
+// add subscribes callbacks to service for timeout, with initial, the current value of every evented
+// variable, as its first event. initial is called with the lock held, no change is published in between
+func (s *genaSubscriptions) add(service genaService, callbacks []string, timeout time.Duration, initial func() []EventProperty) (*subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	if len(s.bySID) >= genaMaxSubscriptions {
+		return nil, errTooManySubscriptions
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &subscription{
+		sid:       "uuid:" + id.String(),
+		service:   service,
+		callbacks: callbacks,
+		expires:   s.now().Add(timeout),
+		events:    make(chan []EventProperty, genaQueue),
+		done:      make(chan struct{}),
+	}
+	sub.events <- initial()
+	s.bySID[sub.sid] = sub
+	return sub, nil
+}
+
+// renew extends the subscription sid to service by timeout, false when there is no such subscription
+// or it expired
+func (s *genaSubscriptions) renew(sid string, service genaService, timeout time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	sub, ok := s.bySID[sid]
+	if !ok || sub.service != service {
+		return false
+	}
+	sub.expires = s.now().Add(timeout)
+	return true
+}
+
+// remove ends the subscription sid to service, false when there is no such subscription
+func (s *genaSubscriptions) remove(sid string, service genaService) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	sub, ok := s.bySID[sid]
+	if !ok || sub.service != service {
+		return false
+	}
+	delete(s.bySID, sid)
+	close(sub.done)
+	return true
+}
+
+// publish queues an event for every subscription to service
+func (s *genaSubscriptions) publish(service genaService, props []EventProperty) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	for _, sub := range s.bySID {
+		if sub.service != service {
+			continue
+		}
+		select {
+		case sub.events <- props:
+		default:
+			// the next event carries the latest SystemUpdateID all the same
+		}
+	}
+}
+
+// prune ends the subscriptions that expired, s.mu must be held
+func (s *genaSubscriptions) prune() {
+	now := s.now()
+	for sid, sub := range s.bySID {
+		if now.After(sub.expires) {
+			delete(s.bySID, sid)
+			close(sub.done)
+		}
+	}
+}
+
+// close ends every subscription at shutdown
+func (s *genaSubscriptions) close() {
+	s.cancel()
+}
+
+// HandleContentEvent serves the event URL of the ContentDirectory: SUBSCRIBE for its SystemUpdateID and
+// ContainerUpdateIDs, sent once on subscribing and again when a scan changes the library, and UNSUBSCRIBE
+func (h *Handler) HandleContentEvent(w http.ResponseWriter, r *http.Request) {
+	h.handleSubscription(w, r, serviceContent)
+}
+
+// HandleConnectionEvent serves the event URL of the ConnectionManager, its variables never change so a
+// subscription only gets the initial event
+func (h *Handler) HandleConnectionEvent(w http.ResponseWriter, r *http.Request) {
+	h.handleSubscription(w, r, serviceConnection)
+}
+
+// handleSubscription is SUBSCRIBE, with CALLBACK and NT to subscribe or with the SID of a subscription to
+// renew it, and UNSUBSCRIBE of service as GENA has them
+func (h *Handler) handleSubscription(w http.ResponseWriter, r *http.Request, service genaService) {
+	if r.Method != "SUBSCRIBE" && r.Method != "UNSUBSCRIBE" {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sid, nt, callback := r.Header.Get("SID"), r.Header.Get("NT"), r.Header.Get("CALLBACK")
+	if sid != "" && (nt != "" || callback != "") {
+		http.Error(w, "SID comes without NT and CALLBACK", http.StatusBadRequest)
+		return
+	}
+	timeout := parseGenaTimeout(r.Header.Get("TIMEOUT"))
+
+	switch {
+	case r.Method == "UNSUBSCRIBE":
+		if !h.subscriptions.remove(sid, service) {
+			http.Error(w, "no such subscription", http.StatusPreconditionFailed)
+			return
+		}
+		h.logger.Debug("unsubscribed", "service", service, "sid", sid, "remote", r.RemoteAddr)
+		w.WriteHeader(http.StatusOK)
+
+	case sid != "":
+		if !h.subscriptions.renew(sid, service, timeout) {
+			http.Error(w, "no such subscription", http.StatusPreconditionFailed)
+			return
+		}
+		writeSubscribed(w, sid, timeout)
+
+	default:
+		callbacks, ok := parseCallbacks(callback)
+		if nt != "upnp:event" || !ok {
+			http.Error(w, "SUBSCRIBE needs NT: upnp:event and a CALLBACK with http URLs", http.StatusPreconditionFailed)
+			return
+		}
+		if service == serviceContent {
+			// watching from before the initial event, a change in between gets to the subscriber
+			h.subscriptions.watch.Do(func() {
+				_, cursor, _ := h.Media.Registry.Changes(0) // where the journal is, from the error
+				_, changed := h.Media.Registry.Watch()
+				go h.watchLibrary(cursor, changed)
+			})
+		}
+		sub, err := h.subscriptions.add(service, callbacks, timeout, func() []EventProperty { return h.eventProperties(service) })
+		if err != nil {
+			h.logger.Warn("subscription refused", "service", service, "remote", r.RemoteAddr, "err", err)
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		h.logger.Debug("subscribed", "service", service, "sid", sub.sid, "callbacks", callbacks, "remote", r.RemoteAddr)
+
+		// the initial event comes after the answer to SUBSCRIBE, the subscriber learns its SID from that
+		writeSubscribed(w, sub.sid, timeout)
+		if err := http.NewResponseController(w).Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			h.logger.Debug("flushing the answer to SUBSCRIBE", "err", err)
+		}
+		go h.sendEvents(sub)
+	}
+}
+
+// writeSubscribed answers a SUBSCRIBE that went through
+func writeSubscribed(w http.ResponseWriter, sid string, timeout time.Duration) {
+	w.Header().Set("Server", upnpServer)
+	w.Header().Set("SID", sid)
+	w.Header().Set("TIMEOUT", "Second-"+strconv.Itoa(int(timeout.Seconds())))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+// parseGenaTimeout is how long a subscription asking for TIMEOUT: Second-n lasts, between genaMinTimeout
+// and genaMaxTimeout. Infinite or none lasts the most
+func parseGenaTimeout(s string) time.Duration {
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(s), "Second-"))
+	if err != nil || n <= 0 {
+		return genaMaxTimeout
+	}
+	return min(max(time.Duration(n)*time.Second, genaMinTimeout), genaMaxTimeout)
+}
+
+// parseCallbacks reads a CALLBACK header, URLs in angle brackets one after the other. Every one has to
+// be http, false when none is
+func parseCallbacks(s string) ([]string, bool) {
+	var callbacks []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] != '<' {
+			return nil, false
+		}
+		raw, rest, ok := strings.Cut(s[1:], ">")
+		if !ok {
+			return nil, false
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme != "http" || u.Host == "" {
+			return nil, false
+		}
+		callbacks, s = append(callbacks, raw), rest
+	}
+	return callbacks, len(callbacks) > 0
+}
+
+// eventProperties is the current value of every evented variable of service, its initial event
+func (h *Handler) eventProperties(service genaService) []EventProperty {
+	if service == serviceConnection {
+		return []EventProperty{
+			{Name: "SourceProtocolInfo", Value: h.sourceProtocolInfo()},
+			{Name: "SinkProtocolInfo"},
+			{Name: "CurrentConnectionIDs", Value: "0"},
+		}
+	}
+	version, _ := h.Media.Registry.Watch()
+	return []EventProperty{
+		{Name: "SystemUpdateID", Value: strconv.FormatUint(version, 10)},
+		{Name: "ContainerUpdateIDs"},
+	}
+}
+
+// watchLibrary publishes SystemUpdateID and the folders that changed to the ContentDirectory subscriptions
+// after every change of the library, from the journal's cursor and the changed of a Watch on, until
+// shutdown
+func (h *Handler) watchLibrary(cursor uint64, changed <-chan struct{}) {
+	for {
+		select {
+		case <-h.subscriptions.ctx.Done():
+			return
+		case <-changed:
+		}
+
+		var version uint64
+		version, changed = h.Media.Registry.Watch()
+		changes, latest, err := h.Media.Registry.Changes(cursor)
+		cursor = latest
+		h.subscriptions.publish(serviceContent, []EventProperty{
+			{Name: "SystemUpdateID", Value: strconv.FormatUint(version, 10)},
+			{Name: "ContainerUpdateIDs", Value: h.containerUpdateIDs(changes, err != nil, version)},
+		})
+
+		select {
+		case <-h.subscriptions.ctx.Done():
+			return
+		case <-time.After(h.subscriptions.moderation):
+		}
+	}
+}
+
+// containerUpdateIDs is the ContainerUpdateIDs of changes, the folders listing the videos that changed
+// each with version as its update ID, as pairs separated by commas. When the journal lost track it is
+// the root
+func (h *Handler) containerUpdateIDs(changes []media.Change, truncated bool, version uint64) string {
+	var ids []string
+	if truncated {
+		ids = append(ids, rootID)
+	}
+	for _, c := range changes {
+		ids = append(ids, h.itemParentID(c.Category))
+	}
+	if len(changes) > 0 && slices.Contains(h.config.Folders, FolderAll) {
+		ids = append(ids, allID)
+	}
+	if len(changes) > 0 && slices.Contains(h.config.Folders, FolderRecent) {
+		ids = append(ids, recentID)
+	}
+	slices.Sort(ids)
+
+	// a comma or backslash in a value of a CSV variable is escaped with a backslash
+	escape := strings.NewReplacer(`\`, `\\`, ",", `\,`)
+	updateID := strconv.FormatUint(version, 10)
+	pairs := make([]string, 0, len(ids))
+	for _, id := range slices.Compact(ids) {
+		pairs = append(pairs, escape.Replace(id)+","+updateID)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// sendEvents sends the events of sub until it ends, numbered from 0 for the initial event. The number
+// wraps around to 1
+func (h *Handler) sendEvents(sub *subscription) {
+	var seq uint32
+	for {
+		select {
+		case <-h.subscriptions.ctx.Done():
+			return
+		case <-sub.done:
+			return
+		case props := <-sub.events:
+			h.notify(sub, seq, props)
+			if seq++; seq == 0 {
+				seq = 1
+			}
+		}
+	}
+}
+
+// notify sends an event of sub, to the first of its callbacks that takes it. A subscriber that misses
+// one stays subscribed until it expires, the next event tells it where the library is
+func (h *Handler) notify(sub *subscription, seq uint32, props []EventProperty) {
+	var body bytes.Buffer
+	if err := h.templates["propertyset.xml"].Execute(&body, PropertySetData{props}); err != nil {
+		h.logger.Error("error executing template", "name", "propertyset.xml", "err", err)
+		h.metrics.TemplateFailures.WithLabelValues("propertyset.xml").Inc()
+		return
+	}
+
+	for _, callback := range sub.callbacks {
+		req, err := http.NewRequestWithContext(h.subscriptions.ctx, "NOTIFY", callback, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			continue
+		}
+		req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+		req.Header.Set("NT", "upnp:event")
+		req.Header.Set("NTS", "upnp:propchange")
+		req.Header.Set("SID", sub.sid)
+		req.Header.Set("SEQ", strconv.FormatUint(uint64(seq), 10))
+
+		resp, err := h.subscriptions.client.Do(req)
+		if err != nil {
+			h.logger.Debug("event not delivered", "sid", sub.sid, "seq", seq, "callback", callback, "err", err)
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return
+		}
+		h.logger.Debug("event refused", "sid", sub.sid, "seq", seq, "callback", callback, "status", resp.StatusCode)
+	}
+}
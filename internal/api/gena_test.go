@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"streamer/internal/media"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// notification is a NOTIFY a subscriber got
+type notification struct {
+	sid, seq, nt, nts string
+	props             map[string]string
+}
+
+// newSubscriber serves a subscriber's callback URL, the NOTIFYs it gets come out of the channel
+func newSubscriber(t *testing.T) (callback string, got <-chan notification) {
+	t.Helper()
+
+	notifications := make(chan notification, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Properties []struct {
+				Variable struct {
+					XMLName xml.Name
+					Value   string `xml:",chardata"`
+				} `xml:",any"`
+			} `xml:"property"`
+		}
+		if r.Method != "NOTIFY" || xml.NewDecoder(r.Body).Decode(&body) != nil {
+			http.Error(w, "bad event", http.StatusBadRequest)
+			return
+		}
+		n := notification{sid: r.Header.Get("SID"), seq: r.Header.Get("SEQ"), nt: r.Header.Get("NT"), nts: r.Header.Get("NTS"), props: map[string]string{}}
+		for _, p := range body.Properties {
+			n.props[p.Variable.XMLName.Local] = p.Variable.Value
+		}
+		notifications <- n
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/event", notifications
+}
+
+// nextNotification waits for the next NOTIFY of got
+func nextNotification(t *testing.T, got <-chan notification) notification {
+	t.Helper()
+
+	select {
+	case n := <-got:
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("no NOTIFY")
+		return notification{}
+	}
+}
+
+// subscribe sends a SUBSCRIBE or UNSUBSCRIBE with header to serve
+func subscribe(serve http.HandlerFunc, method string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/content/event", nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	serve(w, r)
+	return w
+}
+
+func TestHandleSubscription(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+	t.Cleanup(h.subscriptions.close)
+	// nothing listens there, the initial events go nowhere
+	callback := "<http://127.0.0.1:1/event>"
+
+	tests := []struct {
+		name        string
+		method      string
+		header      map[string]string
+		wantStatus  int
+		wantTimeout string
+	}{
+		{"ok - subscribe", "SUBSCRIBE", map[string]string{"NT": "upnp:event", "CALLBACK": callback, "TIMEOUT": "Second-300"}, http.StatusOK, "Second-300"},
+		{"ok - several callbacks", "SUBSCRIBE", map[string]string{"NT": "upnp:event", "CALLBACK": callback + " <http://127.0.0.1:2/>"}, http.StatusOK, "Second-1800"},
+		{"ok - infinite gets the most", "SUBSCRIBE", map[string]string{"NT": "upnp:event", "CALLBACK": callback, "TIMEOUT": "infinite"}, http.StatusOK, "Second-1800"},
+		{"ok - too short gets the least", "SUBSCRIBE", map[string]string{"NT": "upnp:event", "CALLBACK": callback, "TIMEOUT": "Second-5"}, http.StatusOK, "Second-60"},
+		{"fail - no callback", "SUBSCRIBE", map[string]string{"NT": "upnp:event"}, http.StatusPreconditionFailed, ""},
+		{"fail - not http", "SUBSCRIBE", map[string]string{"NT": "upnp:event", "CALLBACK": "<ftp://127.0.0.1/>"}, http.StatusPreconditionFailed, ""},
+		{"fail - no brackets", "SUBSCRIBE", map[string]string{"NT": "upnp:event", "CALLBACK": "http://127.0.0.1/"}, http.StatusPreconditionFailed, ""},
+		{"fail - wrong NT", "SUBSCRIBE", map[string]string{"NT": "ssdp:all", "CALLBACK": callback}, http.StatusPreconditionFailed, ""},
+		{"fail - SID with NT", "SUBSCRIBE", map[string]string{"SID": "uuid:x", "NT": "upnp:event"}, http.StatusBadRequest, ""},
+		{"fail - renew unknown", "SUBSCRIBE", map[string]string{"SID": "uuid:x"}, http.StatusPreconditionFailed, ""},
+		{"fail - unsubscribe unknown", "UNSUBSCRIBE", map[string]string{"SID": "uuid:x"}, http.StatusPreconditionFailed, ""},
+		{"fail - unsubscribe with CALLBACK", "UNSUBSCRIBE", map[string]string{"SID": "uuid:x", "CALLBACK": callback}, http.StatusBadRequest, ""},
+		{"fail - not GENA", http.MethodGet, nil, http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			w := subscribe(h.HandleContentEvent, tt.method, tt.header)
+			if w.Code != tt.wantStatus || w.Header().Get("TIMEOUT") != tt.wantTimeout {
+				t.Fatalf("status %d TIMEOUT %q, want %d %q", w.Code, w.Header().Get("TIMEOUT"), tt.wantStatus, tt.wantTimeout)
+			}
+			if sid := w.Header().Get("SID"); tt.wantStatus == http.StatusOK && !strings.HasPrefix(sid, "uuid:") {
+				t.Errorf("SID = %q, want a uuid", sid)
+			}
+		})
+	}
+}
+
+func TestSubscriptionEvents(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Films/Heat.mkv": "x"})
+	h.config.Folders = []Folder{FolderAll, FolderCategories}
+	h.subscriptions.moderation = 0
+	t.Cleanup(h.subscriptions.close)
+	callback, got := newSubscriber(t)
+
+	w := subscribe(h.HandleContentEvent, "SUBSCRIBE", map[string]string{"NT": "upnp:event", "CALLBACK": "<" + callback + ">"})
+	sid := w.Header().Get("SID")
+	if w.Code != http.StatusOK || sid == "" {
+		t.Fatalf("SUBSCRIBE = %d SID %q, want 200 and a SID", w.Code, sid)
+	}
+
+	// the initial event has every evented variable
+	version, _ := h.Media.Registry.Watch()
+	n := nextNotification(t, got)
+	want := strconv.FormatUint(version, 10)
+	if n.sid != sid || n.seq != "0" || n.nt != "upnp:event" || n.nts != "upnp:propchange" {
+		t.Errorf("initial NOTIFY SID %q SEQ %s NT %q NTS %q, want %q 0 upnp:event upnp:propchange", n.sid, n.seq, n.nt, n.nts, sid)
+	}
+	if v, ok := n.props["ContainerUpdateIDs"]; n.props["SystemUpdateID"] != want || !ok || v != "" {
+		t.Errorf("initial properties = %q, want SystemUpdateID %s and no ContainerUpdateIDs", n.props, want)
+	}
+
+	if w := subscribe(h.HandleContentEvent, "SUBSCRIBE", map[string]string{"SID": sid, "TIMEOUT": "Second-600"}); w.Code != http.StatusOK || w.Header().Get("TIMEOUT") != "Second-600" {
+		t.Fatalf("renewal = %d %q, want 200 Second-600", w.Code, w.Header().Get("TIMEOUT"))
+	}
+
+	// a new video in Films changes its folder and All Videos
+	e, err := media.NewEntry(testMountID, "Films/Ronin.mp4", "Ronin.mp4", "Films", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Media.Registry.Add(e)
+	n = nextNotification(t, got)
+	want = strconv.FormatUint(version+1, 10)
+	if n.sid != sid || n.seq != "1" || n.props["SystemUpdateID"] != want || n.props["ContainerUpdateIDs"] != "all,"+want+",category/Films,"+want {
+		t.Errorf("NOTIFY after a change SID %q SEQ %s %q, want %q 1 and the version %s", n.sid, n.seq, n.props, sid, want)
+	}
+
+	if w := subscribe(h.HandleContentEvent, "UNSUBSCRIBE", map[string]string{"SID": sid}); w.Code != http.StatusOK {
+		t.Fatalf("UNSUBSCRIBE = %d, want 200", w.Code)
+	}
+	h.Media.Registry.Remove(testMountID, "Films/Ronin.mp4")
+	select {
+	case n := <-got:
+		t.Errorf("NOTIFY %+v after UNSUBSCRIBE", n)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if w := subscribe(h.HandleContentEvent, "UNSUBSCRIBE", map[string]string{"SID": sid}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("second UNSUBSCRIBE = %d, want 412", w.Code)
+	}
+}
+
+func TestSubscriptionExpires(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+	t.Cleanup(h.subscriptions.close)
+	var later atomic.Int64
+	h.subscriptions.now = func() time.Time { return time.Now().Add(time.Duration(later.Load())) }
+	callback, got := newSubscriber(t)
+
+	w := subscribe(h.HandleConnectionEvent, "SUBSCRIBE", map[string]string{"NT": "upnp:event", "CALLBACK": "<" + callback + ">", "TIMEOUT": "Second-60"})
+	sid := w.Header().Get("SID")
+	if w.Code != http.StatusOK {
+		t.Fatalf("SUBSCRIBE = %d, want 200", w.Code)
+	}
+	n := nextNotification(t, got)
+	if n.sid != sid || !strings.Contains(n.props["SourceProtocolInfo"], "video/mp4") || n.props["CurrentConnectionIDs"] != "0" {
+		t.Errorf("initial NOTIFY SID %q %q, want %q with the protocols", n.sid, n.props, sid)
+	}
+
+	// a subscription is the ConnectionManager's, not one of the ContentDirectory
+	if w := subscribe(h.HandleContentEvent, "SUBSCRIBE", map[string]string{"SID": sid}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("renewal at another service = %d, want 412", w.Code)
+	}
+	later.Store(int64(61 * time.Second))
+	if w := subscribe(h.HandleConnectionEvent, "SUBSCRIBE", map[string]string{"SID": sid}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("renewal after it expired = %d, want 412", w.Code)
+	}
+}
+
+func TestContainerUpdateIDs(t *testing.T) {
+	t.Parallel()
+
+	changes := []media.Change{
+		{Kind: media.ChangeAdded, Category: "Films"},
+		{Kind: media.ChangeRemoved, Category: "Tom, Jerry"},
+		{Kind: media.ChangeModified, Category: "Films"},
+	}
+
+	tests := []struct {
+		name      string
+		folders   []Folder
+		changes   []media.Change
+		truncated bool
+		want      string
+	}{
+		{"ok - categories", []Folder{FolderCategories}, changes, false, `category/Films,7,category/Tom\, Jerry,7`},
+		{"ok - every folder", Folders, changes[:1], false, "all,7,category/Films,7,recent,7"},
+		{"ok - no folders", nil, changes, false, "0,7"},
+		{"ok - nothing changed", Folders, nil, false, ""},
+		{"ok - journal lost track", []Folder{FolderCategories}, nil, true, "0,7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := newTestHandler(t, nil)
+			h.config.Folders = tt.folders
+			if got := h.containerUpdateIDs(tt.changes, tt.truncated, 7); got != tt.want {
+				t.Errorf("containerUpdateIDs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
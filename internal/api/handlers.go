@@ -1,12 +1,25 @@
 package api
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"embed"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"path/filepath"
+	"strconv"
+	"streamer/internal/bookmark"
+	"streamer/internal/hls"
 	"streamer/internal/media"
+	"streamer/internal/observability"
+	"streamer/internal/playlist"
+	"streamer/internal/preflight"
+	"streamer/internal/remux"
+	"sync"
 	"text/template"
 	"time"
 )
@@ -15,50 +28,79 @@ import (
 type Config struct {
 	FriendlyName string
 	UUID         string
+	Address      string   // host:port the server advertises, known once the listener is bound
+	Folders      []Folder // virtual folders at the root of Browse, none lists every video there
+	Recent       int      // videos in the FolderRecent folder
+	BrowseMax    int      // most children a Browse answers with at once, 0 has no cap
+	WarmUp       int64    // bytes read ahead in the background as a stream starts, 0 doesn't
+
+	// ExternalURL starts every absolute URL handed out (scheme, host, optional path prefix, no trailing
+	// slash), empty builds them from the request and the X-Forwarded-* headers of TrustedProxies
+	ExternalURL    string
+	TrustedProxies []netip.Prefix
+
+	MediaTypes map[string]MediaType // by lowercase extension with its dot, over the built-in table
+
+	Priorities []PriorityRule // io priority by User-Agent, the first rule matching wins
+
+	ReadOnly bool // kiosk mode, the SOAP actions that store something are refused
 }
 
 type Handler struct {
-	Media     *media.Manager
-	templates map[string]*template.Template
-	logger    *slog.Logger
-	config    Config
+	Media      *media.Manager
+	Shutdown   ShutdownController // optional, backs /api/shutdown and the shutdown section of /api/status
+	HLS        *hls.Manager       // optional, backs /hls, nil unless -hls is on and ffmpeg was found
+	Remux      remux.Remuxer      // optional, backs /remux, nil unless -remux.noMKV is set and ffmpeg was found
+	NoMKV      []string           // User-Agent substrings of renderers whose DIDL offers MKV remuxed to MP4
+	Bookmarks  *bookmark.Store    // resume positions behind /api/progress and the player page
+	Playlists  *playlist.Store    // the playlists saved through /api/playlists
+	templates  map[string]*template.Template
+	static     http.Handler // the embedded assets under /static/
+	logger     *slog.Logger
+	config     Config
+	metrics    *observability.Metrics
+	streams    streamTracker
+	rejections rejectionLog
+	qrCodes    qrCache   // the pngs behind /qr.png
+	events     *eventHub // the /api/events connections
+
+	subscriptions *genaSubscriptions // of the UPnP event URLs
+
+	ready     sync.Mutex
+	preflight preflight.Report  // startup checks behind /readyz
+	pending   map[string]string // reasons /readyz is still 503 after startup, see SetPending
 }
 
 //go:embed templates/*
 var templateFS embed.FS
 
-func NewHandler(m *media.Manager, cfg Config, logger *slog.Logger) (*Handler, error) {
+func NewHandler(m *media.Manager, cfg Config, metrics *observability.Metrics, logger *slog.Logger) (*Handler, error) {
 	tmpls, err := loadTemplates(templateFS)
 	if err != nil {
 		return nil, err
 	}
 
-	// these are the required templates
-	required := []string{
-		"content_scpd.xml",
-		"connection_scpd.xml",
-		"device_description.xml",
-		"index.html",
-		"browse_response.xml",
-		"protocol_info.xml",
-		"search_caps.xml",
-		"sort_caps.xml",
-		"system_update_id.xml",
-		"connection_ids.xml",
-		"connection_info.xml",
+	if err := checkTemplates(tmpls); err != nil {
+		return nil, err
 	}
 
-	for _, name := range required {
-		if _, ok := tmpls[name]; !ok {
-			return nil, fmt.Errorf("missing required template: %s", name)
-		}
+	static, err := newStaticHandler()
+	if err != nil {
+		return nil, err
 	}
 
 	return &Handler{
 		Media:     m,
+		Bookmarks: bookmark.NewStore(),
+		Playlists: playlist.NewStore(),
+		events:    newEventHub(),
 		templates: tmpls,
+		static:    static,
 		logger:    logger,
 		config:    cfg,
+		metrics:   metrics,
+
+		subscriptions: newGenaSubscriptions(),
 	}, nil
 }
 
@@ -66,13 +108,46 @@ func (h *Handler) HandleDirectStream(w http.ResponseWriter, r *http.Request, res
 	resName := res.Name()
 
 	// Set DLNA headers
-	mimeType := getMimeType(resName)
+	mimeType := h.mimeType(resName)
 	w.Header().Set("Content-Type", mimeType)
 	w.Header().Set("Accept-Ranges", "bytes")
 	w.Header().Set("transferMode.dlna.org", "Streaming")
-	w.Header().Set("contentFeatures.dlna.org", getDLNAProfile(resName))
+	w.Header().Set("contentFeatures.dlna.org", h.dlnaProfile(resName))
 
-	http.ServeContent(w, r, resName, res.ModTime(), res)
+	serveResource(w, r, res)
+}
+
+// setETag sets the validator of entry, ServeContent checks If-Range and If-None-Match against it, so a
+// resumed download or playback gets the rest of the file as long as it didn't change. A file whose size
+// at open isn't the one the scan saw, still being copied or replaced since, gets none until a scan sees it
+func setETag(w http.ResponseWriter, entry *media.Entry, res media.Resource) {
+	if entry.ETag != "" && (res.Size() < 0 || res.Size() == entry.StreamSize()) {
+		w.Header().Set("ETag", entry.ETag)
+	}
+}
+
+// serveResource sends res through http.ServeContent, with ranges and conditional requests. One whose size
+// isn't known, the URL of a .strm file whose server didn't tell, goes as it comes, chunked. It returns
+// soon after the request's context is done, the caller's io slot and file go with it
+func serveResource(w http.ResponseWriter, r *http.Request, res media.Resource) {
+	res = media.WithContext(r.Context(), res)
+
+	// a write stuck on a client that went away fails now rather than when the kernel gives up on it
+	stop := context.AfterFunc(r.Context(), func() {
+		http.NewResponseController(w).SetWriteDeadline(time.Now())
+	})
+	defer stop()
+
+	if res.Size() >= 0 {
+		http.ServeContent(w, r, res.Name(), res.ModTime(), res)
+		return
+	}
+	w.Header().Del("Accept-Ranges")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.Copy(w, res)
+	}
 }
 
 func (h *Handler) HandleSCPD(w http.ResponseWriter, r *http.Request) {
@@ -90,37 +165,16 @@ func (h *Handler) HandleXML(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Server", "Linux/3.10.0 UPnP/1.0 DLNADOC/1.50 GoStream/1.0")
-
-	data := struct {
-		UUID         string
-		BaseURL      string
-		FriendlyName string
-	}{
+	data := DeviceDescriptionData{
 		UUID:         h.config.UUID,
-		BaseURL:      fmt.Sprintf("http://%s", r.Host),
+		BaseURL:      h.baseURL(r),
 		FriendlyName: h.config.FriendlyName,
 	}
 
-	w.Header().Set("EXT", "")
-	h.render(w, "device_description.xml", data)
-}
-
-func (h *Handler) HandleDummyEvent(w http.ResponseWriter, r *http.Request) {
-	// For SUBSCRIBE, return 200 OK with minimal headers
-	if r.Method == "SUBSCRIBE" {
-		w.Header().Set("SID", "uuid:dummy-subscription-"+h.config.UUID)
-		w.Header().Set("TIMEOUT", "Second-1800")
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	if r.Method == "UNSUBSCRIBE" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	w.WriteHeader(http.StatusMethodNotAllowed)
+	h.renderWith(w, "device_description.xml", data, renderOptions{Header: http.Header{
+		"Server": {upnpServer},
+		"EXT":    {""},
+	}})
 }
 
 func loadTemplates(tfs embed.FS) (map[string]*template.Template, error) {
@@ -149,7 +203,26 @@ func loadTemplates(tfs embed.FS) (map[string]*template.Template, error) {
 	return templates, nil
 }
 
+// renderOptions shapes the response of a rendered template, the zero value is a 200 with the Content-Type
+// of the template's extension
+type renderOptions struct {
+	Status int         // 0 is 200
+	Header http.Header // set on top of Content-Type and Date
+	Block  string      // the {{define}}d block to execute instead of the whole file
+}
+
 func (h *Handler) render(w http.ResponseWriter, name string, data any) {
+	h.renderWith(w, name, data, renderOptions{})
+}
+
+// renderBlock executes only the {{define}}d block of a template file, e.g. part of a page fetched by script
+func (h *Handler) renderBlock(w http.ResponseWriter, name, block string, data any) {
+	h.renderWith(w, name, data, renderOptions{Block: block})
+}
+
+// renderWith executes the template into a buffer before anything is written, so a template failing halfway
+// answers a 500 rather than a 200 with half a page
+func (h *Handler) renderWith(w http.ResponseWriter, name string, data any, opts renderOptions) {
 	tmpl, ok := h.templates[name]
 	if !ok {
 		// shouldn't get here never happen due to NewHandler checks
@@ -158,6 +231,14 @@ func (h *Handler) render(w http.ResponseWriter, name string, data any) {
 		return
 	}
 
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, cmp.Or(opts.Block, name), data); err != nil {
+		h.logger.Error("error executing template", "name", name, "data_type", fmt.Sprintf("%T", data), "err", err)
+		h.metrics.TemplateFailures.WithLabelValues(name).Inc()
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
 	// Automate Content-Type based on the template extension
 	var contentType string
 	switch filepath.Ext(name) {
@@ -174,12 +255,11 @@ func (h *Handler) render(w http.ResponseWriter, name string, data any) {
 
 	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
-
-	// specific headers for specific files have to be done before calling render or passed in
-
-	err := tmpl.Execute(w, data)
-	if err != nil {
-		// Note: If Execute fails halfway, the status code 200 is already sentbut it's standdard behavior for streaming templates
-		h.logger.Error("error executing template", "name", name, "err", err)
+	for key, values := range opts.Header {
+		w.Header()[http.CanonicalHeaderKey(key)] = values
 	}
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+
+	w.WriteHeader(cmp.Or(opts.Status, http.StatusOK))
+	w.Write(buf.Bytes())
 }
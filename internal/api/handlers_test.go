@@ -0,0 +1,103 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"streamer/internal/media"
+	"streamer/internal/observability"
+	"testing"
+	"text/template"
+)
+
+const testMountID = "vol_0"
+
+// newTestHandler builds a Handler backed by a temp library containing the given files (name -> content)
+func newTestHandler(t testing.TB, files map[string]string) *Handler {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := media.NewManager(4096, media.ModeFileBuffered)
+	m.AddMount(testMountID, root, media.NewIOLimiter(4))
+	if err := m.Registry.Scan(testMountID, root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	metrics := observability.NewMetrics(observability.NewRegistry(false))
+
+	h, err := NewHandler(m, Config{FriendlyName: "Test Server", UUID: "uuid:test"}, metrics, logger)
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+	return h
+}
+
+// entryByName returns the registry entry with the given file name
+func entryByName(t testing.TB, h *Handler, name string) media.Entry {
+	t.Helper()
+
+	for _, e := range h.Media.Registry.List() {
+		if e.Name == name {
+			return e
+		}
+	}
+	t.Fatalf("no entry named %q", name)
+	return media.Entry{}
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+	h.templates["ok.xml"] = template.Must(template.New("ok.xml").Parse(`<a>{{.}}</a>{{define "b"}}<b/>{{end}}`))
+	h.templates["broken.html"] = template.Must(template.New("broken.html").Parse(`<p>before</p>{{index . 5}}<p>after</p>`))
+
+	tests := []struct {
+		name       string
+		template   string
+		data       any
+		opts       renderOptions
+		wantStatus int
+		wantBody   string
+		wantHeader http.Header
+	}{
+		{"ok - defaults", "ok.xml", "x", renderOptions{}, http.StatusOK, "<a>x</a>", http.Header{"Content-Type": {"text/xml; charset=utf-8"}, "Content-Length": {"8"}}},
+		{"ok - status and headers", "ok.xml", "x", renderOptions{Status: http.StatusInternalServerError, Header: http.Header{"EXT": {""}, "Server": {"test"}}}, http.StatusInternalServerError, "<a>x</a>", http.Header{"Ext": {""}, "Server": {"test"}}},
+		{"ok - block", "ok.xml", nil, renderOptions{Block: "b"}, http.StatusOK, "<b/>", nil},
+		{"fail - error mid template", "broken.html", []string{"x"}, renderOptions{}, http.StatusInternalServerError, "Internal Server Error\n", nil},
+		{"fail - no such template", "missing.xml", nil, renderOptions{}, http.StatusInternalServerError, "Template not found\n", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+			h.renderWith(w, tt.template, tt.data, tt.opts)
+
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("renderWith() = %d %q, want %d %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+			for key, want := range tt.wantHeader {
+				if got, ok := w.Header()[key]; !ok || !slices.Equal(got, want) {
+					t.Errorf("header %s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"streamer/internal/media"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// videoVisibility is an entry the way the hide api reports it
+type videoVisibility struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Category string    `json:"category"`
+	AddedAt  time.Time `json:"added_at,omitzero"`
+	Hidden   bool      `json:"hidden"`
+}
+
+func toVideoVisibility(e media.Entry) videoVisibility {
+	return videoVisibility{ID: e.UUID.String(), Name: e.Name, Category: e.Category, AddedAt: e.AddedAt, Hidden: e.Hidden}
+}
+
+// HandleHide serves POST /api/videos/{uuid}/hide: the entry stays on disk but leaves Browse, the
+// playlists and the web ui. Links and bookmarks to its UUID keep playing
+func (h *Handler) HandleHide(w http.ResponseWriter, r *http.Request) {
+	h.setHidden(w, r, true)
+}
+
+// HandleUnhide serves POST /api/videos/{uuid}/unhide, the entry is listed again
+func (h *Handler) HandleUnhide(w http.ResponseWriter, r *http.Request) {
+	h.setHidden(w, r, false)
+}
+
+func (h *Handler) setHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	id, err := uuid.FromString(r.PathValue("uuid"))
+	if err != nil {
+		http.Error(w, "bad id", http.StatusNotFound)
+		return
+	}
+	e, err := h.Media.Registry.SetHidden(id, hidden)
+	if err != nil {
+		http.Error(w, "entry not found", http.StatusNotFound)
+		return
+	}
+	h.logger.Info("entry visibility changed", "entry_id", id, "name", e.Name, "hidden", hidden)
+	h.writeJSON(w, http.StatusOK, toVideoVisibility(e))
+}
+
+// HandleHidden serves GET /api/videos/hidden, the hidden entries A to Z, to find the UUID to unhide
+func (h *Handler) HandleHidden(w http.ResponseWriter, r *http.Request) {
+	resp := []videoVisibility{}
+	for _, e := range h.Media.Registry.Hidden() {
+		resp = append(resp, toVideoVisibility(e))
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
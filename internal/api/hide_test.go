@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHandleHide(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Films/Heat.mkv": "heat", "Films/Ronin.mp4": "ronin"})
+	h.config.Folders = Folders
+	h.config.Recent = 10
+	heat := entryByName(t, h, "Heat.mkv")
+	id := heat.UUID.String()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/videos/hidden", h.HandleHidden)
+	mux.HandleFunc("POST /api/videos/{uuid}/hide", h.HandleHide)
+	mux.HandleFunc("POST /api/videos/{uuid}/unhide", h.HandleUnhide)
+	mux.HandleFunc("GET /direct/", h.AdapterDirectStream)
+	mux.HandleFunc("/playlist.m3u", h.HandleM3U)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/videos/"+id+"/hide")
+	var got videoVisibility
+	if err := json.Unmarshal(w.Body.Bytes(), &got); w.Code != http.StatusOK || err != nil || !got.Hidden || got.ID != id || !got.AddedAt.Equal(heat.AddedAt) {
+		t.Fatalf("POST hide = %d %s, want 200 and the entry hidden", w.Code, w.Body.String())
+	}
+
+	// gone from Browse, its folders and the playlists
+	if got := browse(t, h, allID, "BrowseDirectChildren", 0, 0); !slices.Equal(got.items, []string{"Ronin all"}) {
+		t.Errorf("Browse(all) items = %q, want only Ronin", got.items)
+	}
+	if got := browse(t, h, rootID, "BrowseDirectChildren", 0, 0); !slices.Contains(got.containers, "all 0 1") || !slices.Contains(got.containers, "category/Films 0 1") {
+		t.Errorf("Browse(0) containers = %q, want the hidden entry left out of the counts", got.containers)
+	}
+	if body := do(http.MethodGet, "/playlist.m3u").Body.String(); strings.Contains(body, id) || !strings.Contains(body, "Ronin") {
+		t.Errorf("playlist.m3u lists the hidden entry or lost Ronin:\n%s", body)
+	}
+	var hidden []videoVisibility
+	if err := json.Unmarshal(do(http.MethodGet, "/api/videos/hidden").Body.Bytes(), &hidden); err != nil || len(hidden) != 1 || hidden[0].ID != id {
+		t.Errorf("GET hidden = %v, %v, want Heat", hidden, err)
+	}
+
+	// an old link still plays it
+	if w := do(http.MethodGet, "/direct/"+id+".mkv"); w.Code != http.StatusOK || w.Body.String() != "heat" {
+		t.Errorf("GET direct of the hidden entry = %d %q, want 200 and the file", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodPost, "/api/videos/"+id+"/unhide"); w.Code != http.StatusOK {
+		t.Fatalf("POST unhide = %d %s, want 200", w.Code, w.Body.String())
+	}
+	if got := browse(t, h, allID, "BrowseDirectChildren", 0, 0); !slices.Equal(got.items, []string{"Heat all", "Ronin all"}) {
+		t.Errorf("Browse(all) items after unhide = %q, want both", got.items)
+	}
+	if body := do(http.MethodGet, "/api/videos/hidden").Body.String(); strings.TrimSpace(body) != "[]" {
+		t.Errorf("GET hidden after unhide = %s, want []", body)
+	}
+
+	t.Run("fail - unknown entry", func(t *testing.T) {
+		for _, path := range []string{"/api/videos/0194d3c2-0000-7000-8000-000000000000/hide", "/api/videos/nope/unhide"} {
+			if w := do(http.MethodPost, path); w.Code != http.StatusNotFound {
+				t.Errorf("POST %s = %d, want 404", path, w.Code)
+			}
+		}
+	})
+}
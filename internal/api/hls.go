@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"streamer/internal/hls"
+	"streamer/internal/media"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// how long a playlist request waits for the transcoder to write the first segment
+const hlsStartTimeout = 30 * time.Second
+
+// HandleHLS serves /hls/{uuid}/{file}. Asking for the playlist starts a remux of the entry for this
+// client, the segments it lists are served from that session
+func (h *Handler) HandleHLS(w http.ResponseWriter, r *http.Request) {
+	if h.HLS == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, err := uuid.FromString(r.PathValue("uuid"))
+	if err != nil {
+		http.Error(w, "bad id", http.StatusNotFound)
+		return
+	}
+
+	entry, err := h.Media.GetEntry(id)
+	if err != nil {
+		http.Error(w, "entry not found", http.StatusNotFound)
+		return
+	}
+
+	key := hls.Key{ID: id.String(), Client: clientHost(r)}
+	file := r.PathValue("file")
+
+	var session *hls.Session
+	if file == hls.PlaylistName {
+		var ok bool
+		if session, ok = h.startHLS(w, r, entry, key); !ok {
+			return
+		}
+	} else {
+		var ok bool
+		if session, ok = h.HLS.Lookup(key); !ok {
+			// reaped after going idle, the player has to load the playlist again
+			http.Error(w, "no hls session, request the playlist first", http.StatusNotFound)
+			return
+		}
+	}
+
+	f, err := session.Open(file)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "file access error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", hlsContentType(file))
+	// the playlist grows while the transcoder works through the file
+	if file == hls.PlaylistName {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	http.ServeContent(w, r, file, info.ModTime(), f)
+}
+
+// startHLS gets the session of key going and waits for its playlist, failures are answered here
+func (h *Handler) startHLS(w http.ResponseWriter, r *http.Request, entry *media.Entry, key hls.Key) (*hls.Session, bool) {
+	// a remux is a stream too, none are started once shutdown is draining
+	_, end, ok := h.beginStream(w, r, entry, "hls")
+	if !ok {
+		return nil, false
+	}
+	end()
+
+	mount, err := h.Media.GetMount(entry.MountID)
+	if err != nil {
+		h.logger.Error("volume missing for entry", "vol_id", entry.MountID, "entry_id", key.ID)
+		http.Error(w, "storage volume unavailable", http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	input, err := h.Media.EntryPath(entry)
+	if err != nil {
+		h.logger.Warn("security alert: attempted path traversal", "path", entry.Path, "remote", r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+
+	session, err := h.HLS.Session(key, input, mount.Limiter)
+	if err != nil {
+		switch {
+		case errors.Is(err, hls.ErrBusy):
+			h.logger.Warn("IO limiter reached", "id", key.ID)
+			http.Error(w, "server too busy", http.StatusServiceUnavailable)
+		case errors.Is(err, hls.ErrClosed):
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		default:
+			h.logger.Error("starting hls session", "id", key.ID, "err", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), hlsStartTimeout)
+	defer cancel()
+
+	if err := session.WaitPlaylist(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "remux is still starting, try again", http.StatusServiceUnavailable)
+			return nil, false
+		}
+		h.logger.Warn("hls remux failed", "id", key.ID, "name", entry.Name, "err", err)
+		http.Error(w, "remux failed", http.StatusInternalServerError)
+		return nil, false
+	}
+	return session, true
+}
+
+// clientHost is what tells the sessions of two clients apart, the port changes between connections
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func hlsContentType(name string) string {
+	switch filepath.Ext(name) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".m4s":
+		return "video/iso.segment"
+	case ".ts":
+		return "video/mp2t"
+	default:
+		return "video/mp4"
+	}
+}
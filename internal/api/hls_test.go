@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"streamer/internal/hls"
+	"strings"
+	"testing"
+	"time"
+)
+
+// copyTranscoder "remuxes" by copying the input into a single segment
+func copyTranscoder(ctx context.Context, input, dir string) error {
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "seg00000.m4s"), data, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, hls.PlaylistName), []byte("#EXTM3U\nseg00000.m4s\n#EXT-X-ENDLIST\n"), 0o644)
+}
+
+func newHLSTestHandler(t *testing.T, files map[string]string) (*Handler, *http.ServeMux) {
+	t.Helper()
+
+	h := newTestHandler(t, files)
+	h.HLS = hls.NewManager(copyTranscoder, time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	h.HLS.Dir = t.TempDir()
+	t.Cleanup(h.HLS.Close)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /hls/{uuid}/{file}", h.HandleHLS)
+	return h, mux
+}
+
+func TestHandleHLS(t *testing.T) {
+	t.Parallel()
+
+	h, mux := newHLSTestHandler(t, map[string]string{"Movies/Alien.mkv": "matroska"})
+	id := entryByName(t, h, "Alien.mkv").UUID.String()
+
+	get := func(path, client string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = client
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// segments only exist once the playlist started a session
+	if rec := get("/hls/"+id+"/seg00000.m4s", "10.0.0.2:5000"); rec.Code != http.StatusNotFound {
+		t.Errorf("segment before the playlist status = %d, want 404", rec.Code)
+	}
+
+	rec := get("/hls/"+id+"/index.m3u8", "10.0.0.2:5000")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("playlist status = %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/vnd.apple.mpegurl" {
+		t.Errorf("playlist Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "seg00000.m4s") {
+		t.Errorf("playlist = %q, want the segment listed", rec.Body)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		client   string
+		wantCode int
+	}{
+		{"ok - segment, new connection of the same client", "/hls/" + id + "/seg00000.m4s", "10.0.0.2:6000", http.StatusOK},
+		{"fail - another client", "/hls/" + id + "/seg00000.m4s", "10.0.0.3:5000", http.StatusNotFound},
+		{"fail - missing segment", "/hls/" + id + "/seg00001.m4s", "10.0.0.2:5000", http.StatusNotFound},
+		{"fail - not a segment", "/hls/" + id + "/notes.txt", "10.0.0.2:5000", http.StatusNotFound},
+		{"fail - unknown entry", "/hls/00000000-0000-0000-0000-000000000001/index.m3u8", "10.0.0.2:5000", http.StatusNotFound},
+		{"fail - bad id", "/hls/nope/index.m3u8", "10.0.0.2:5000", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(tt.path, tt.client)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, rec.Code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusOK && rec.Body.String() != "matroska" {
+				t.Errorf("segment = %q, want the remuxed file", rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandleHLSRefusedWhileDraining(t *testing.T) {
+	t.Parallel()
+
+	h, mux := newHLSTestHandler(t, map[string]string{"Alien.mkv": "matroska"})
+	id := entryByName(t, h, "Alien.mkv").UUID.String()
+	h.BeginDrain()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hls/"+id+"/index.m3u8", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+	if got := h.HLS.Len(); got != 0 {
+		t.Errorf("%d sessions started while draining", got)
+	}
+}
+
+func TestHandleWatchPrefersHLS(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{"Alien.mkv": "matroska", "Heat.mp4": "mp4"}
+
+	tests := []struct {
+		name     string
+		hls      bool
+		file     string
+		wantSrc  string
+		wantType string
+	}{
+		{"ok - mkv through hls", true, "Alien.mkv", "/hls/%s/index.m3u8", "application/vnd.apple.mpegurl"},
+		{"ok - browsers play mp4 as it is", true, "Heat.mp4", "/stream?id=%s", "video/mp4"},
+		{"ok - hls disabled", false, "Alien.mkv", "/stream?id=%s", "video/x-matroska"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := newTestHandler(t, files)
+			if tt.hls {
+				h, _ = newHLSTestHandler(t, files)
+			}
+			id := entryByName(t, h, tt.file).UUID.String()
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /watch/{uuid}", h.HandleWatch)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/watch/"+id, nil))
+
+			want := `<source src="` + strings.Replace(tt.wantSrc, "%s", id, 1) + `" type="` + tt.wantType + `">`
+			if body := rec.Body.String(); !strings.Contains(body, want) {
+				t.Errorf("player has no %s:\n%s", want, body)
+			}
+		})
+	}
+}
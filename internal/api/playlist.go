@@ -2,32 +2,312 @@ package api
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"streamer/internal/media"
 	"strings"
 )
 
+// playlistItem is an entry the way every playlist format lists it
+type playlistItem struct {
+	Title    string // the display name, without extension
+	Category string
+	URL      string
+	Logo     string // absolute /thumb link of the poster, empty when the scan found none
+}
+
+// playlistMaxLimit caps ?limit= on playlists, asking for more gets this many
+const playlistMaxLimit = 1000
+
+// playlistOptions are the ?sort=, ?collate= and ?limit= every playlist takes
+type playlistOptions struct {
+	order     media.SortOrder // empty keeps the order the entries come in
+	collation media.Collation // of sort=name
+	limit     int             // 0 lists them all
+}
+
+// parsePlaylistOptions reads the options of r, names compare under collation unless ?collate= says otherwise
+func parsePlaylistOptions(r *http.Request, collation media.Collation) (playlistOptions, error) {
+	query := r.URL.Query()
+
+	opts := playlistOptions{collation: collation}
+	if s := query.Get("sort"); s != "" {
+		order, err := media.ParseSortOrder(s)
+		if err != nil {
+			return playlistOptions{}, err
+		}
+		opts.order = order
+	}
+	if s := query.Get("collate"); s != "" {
+		c, err := media.ParseCollation(s)
+		if err != nil {
+			return playlistOptions{}, err
+		}
+		opts.collation = c
+	}
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return playlistOptions{}, fmt.Errorf("bad limit %q, want a positive number", s)
+		}
+		opts.limit = min(limit, playlistMaxLimit)
+	}
+	return opts, nil
+}
+
+// items sorts and cuts entries the way the options ask for and turns them into playlist items linking
+// below base
+func (o playlistOptions) items(base string, entries []media.Entry) []playlistItem {
+	if o.order != "" {
+		media.SortEntries(entries, o.order, o.collation)
+	}
+	if o.limit > 0 {
+		entries = entries[:min(o.limit, len(entries))]
+	}
+
+	items := make([]playlistItem, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, newPlaylistItems(base, e)...)
+	}
+	return items
+}
+
+// playlistItems lists what a playlist request asks for: ?category= narrows it to one category, ?sort=
+// (name, newest, added or size) orders it and ?limit= cuts it short. All formats go through it so the query
+// parameters mean the same everywhere; bad ones are answered with 400 and false
+func (h *Handler) playlistItems(w http.ResponseWriter, r *http.Request) ([]playlistItem, bool) {
+	return h.categoryItems(w, r, r.URL.Query().Get("category"))
+}
+
+// categoryItems lists the entries of a category, all of them when it is empty
+func (h *Handler) categoryItems(w http.ResponseWriter, r *http.Request, categoryFilter string) ([]playlistItem, bool) {
+	opts, err := parsePlaylistOptions(r, h.Media.Registry.Collation())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	var entries []media.Entry
+	for _, e := range h.Media.Registry.List() {
+		// if filter has been set, skip the others
+		if categoryFilter != "" && e.Category != categoryFilter {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+	return opts.items(h.baseURL(r), entries), true
+}
+
+// newPlaylistItems lists an entry, the parts of a split film that can't be streamed as one file one after
+// the other
+func newPlaylistItems(base string, e media.Entry) []playlistItem {
+	title := strings.TrimSuffix(e.Name, filepath.Ext(e.Name))
+	var logo string
+	if thumb := thumbURL(e); thumb != "" {
+		logo = base + thumb
+	}
+	if len(e.Parts) < 2 || e.Concatenated() {
+		return []playlistItem{{Title: title, Category: e.Category, URL: streamURL(base, e), Logo: logo}}
+	}
+
+	items := make([]playlistItem, 0, len(e.Parts))
+	for n := range len(e.Parts) {
+		items = append(items, playlistItem{
+			Title:    fmt.Sprintf("%s (part %d of %d)", title, n+1, len(e.Parts)),
+			Category: e.Category,
+			URL:      fmt.Sprintf("%s&part=%d", streamURL(base, e), n+1),
+			Logo:     logo,
+		})
+	}
+	return items
+}
+
+// streamURL is the absolute /stream link of an entry below base (see Handler.baseURL), what playlists and
+// players outside the browser need
+func streamURL(base string, e media.Entry) string {
+	return base + "/stream?id=" + e.UUID.String()
+}
+
+// HandleM3U lists the library as an M3U playlist. ?style=extended adds the attributes IPTV-style
+// players understand (tvg-name, tvg-logo, group-title, #EXTGRP)
 func (h *Handler) HandleM3U(w http.ResponseWriter, r *http.Request) {
-	entries := h.Media.Registry.List()
+	items, ok := h.playlistItems(w, r)
+	if !ok {
+		return
+	}
+	h.serveM3U(w, r, "", items)
+}
 
-	categoryFilter := r.URL.Query().Get("category")
+// serveM3U writes items as an M3U playlist in the ?style= asked for, a name goes into #PLAYLIST
+func (h *Handler) serveM3U(w http.ResponseWriter, r *http.Request, name string, items []playlistItem) {
+	writeEntry, ok := m3uStyle(w, r)
+	if !ok {
+		return
+	}
 
 	w.Header().Set("Content-Type", "audio/x-mpegurl")
 	// m3u Header
 	fmt.Fprintln(w, "#EXTM3U")
+	if name != "" {
+		fmt.Fprintf(w, "#PLAYLIST:%s\n", m3uLine(name))
+	}
 
-	for _, f := range entries {
+	for _, item := range items {
+		writeEntry(w, item)
+	}
+}
 
-		// if filter has been set, skip the others
-		if categoryFilter != "" && f.Category != categoryFilter {
-			continue
+// serveCategoryM3U is /playlist/{category}.m3u, the same playlist as /playlist.m3u?category= under a
+// path players can bookmark. An unknown category is a 404 that lists the ones with a similar name
+func (h *Handler) serveCategoryM3U(w http.ResponseWriter, r *http.Request, name string) {
+	var similar []string
+	for _, c := range h.Media.Registry.Categories() {
+		// categories of nested dirs are separated by \ on windows, links always use /
+		if filepath.ToSlash(c.Name) == name {
+			items, ok := h.categoryItems(w, r, c.Name)
+			if ok {
+				h.serveM3U(w, r, c.Name, items)
+			}
+			return
+		}
+		if similarCategory(filepath.ToSlash(c.Name), name) {
+			similar = append(similar, filepath.ToSlash(c.Name))
 		}
+	}
+
+	msg := fmt.Sprintf("unknown category %q", name)
+	if len(similar) > 0 {
+		msg += ", did you mean: " + strings.Join(similar, ", ")
+	}
+	http.Error(w, msg, http.StatusNotFound)
+}
+
+// similarCategory tells whether a category is what a mistyped name was probably meant to be: the same
+// but for case, one containing the other, or a couple of typos apart
+func similarCategory(category, name string) bool {
+	c, n := strings.ToLower(category), strings.ToLower(name)
+	if n == "" {
+		return false
+	}
+	return strings.Contains(c, n) || strings.Contains(n, c) || editDistance(c, n) <= 2
+}
+
+// editDistance is the Levenshtein distance of a and b, in runes
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// m3uStyle picks the entry writer ?style= asks for, an unknown style is answered with 400
+func m3uStyle(w http.ResponseWriter, r *http.Request) (func(w io.Writer, item playlistItem), bool) {
+	switch style := r.URL.Query().Get("style"); style {
+	case "", "basic":
+		return writeM3UEntry, true
+	case "extended":
+		return writeExtendedM3UEntry, true
+	default:
+		http.Error(w, fmt.Sprintf("unknown playlist style %q, use basic or extended", style), http.StatusBadRequest)
+		return nil, false
+	}
+}
+
+// writeM3UEntry writes the plain form every player understands
+func writeM3UEntry(w io.Writer, item playlistItem) {
+	// #EXTINF:-1,Die Hard
+	fmt.Fprintf(w, "#EXTINF:-1,%s\n", m3uLine(item.Title))
+	// http://.../stream?id=0195...
+	fmt.Fprintln(w, item.URL)
+}
+
+// writeExtendedM3UEntry writes the IPTV form, the duration stays -1 (unknown) as long as the scan
+// doesn't read it from the files
+func writeExtendedM3UEntry(w io.Writer, item playlistItem) {
+	title := m3uLine(item.Title)
+
+	// #EXTINF:-1 tvg-name="Die Hard" tvg-logo="http://.../thumb/0195..." group-title="Action",Die Hard
+	var logo string
+	if item.Logo != "" {
+		logo = " tvg-logo=" + m3uAttr(item.Logo)
+	}
+	fmt.Fprintf(w, "#EXTINF:-1 tvg-name=%s%s group-title=%s,%s\n", m3uAttr(title), logo, m3uAttr(item.Category), title)
+	fmt.Fprintf(w, "#EXTGRP:%s\n", m3uLine(item.Category))
+	fmt.Fprintln(w, item.URL)
+}
 
-		displayName := strings.TrimSuffix(f.Name, filepath.Ext(f.Name))
-		// Write the Entry to m3u
-		// #EXTINF:-1,Action - Die Hard.mp4
-		fmt.Fprintf(w, "#EXTINF:-1,%s - %s\n", f.Category, displayName)
-		// http://.../stream?file=Action/Die Hard.mp4
-		fmt.Fprintf(w, "http://%s/stream?id=%s\n", r.Host, f.UUID.String())
+// HandleXSPF lists the library as an XSPF playlist, the XML format VLC saves its playlists in
+func (h *Handler) HandleXSPF(w http.ResponseWriter, r *http.Request) {
+	items, ok := h.playlistItems(w, r)
+	if !ok {
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/xspf+xml")
+
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<playlist version="1" xmlns="http://xspf.org/ns/0/">`)
+	fmt.Fprintf(w, "  <title>%s</title>\n", escapeXML(h.config.FriendlyName))
+	fmt.Fprintln(w, "  <trackList>")
+
+	for _, item := range items {
+		fmt.Fprintln(w, "    <track>")
+		fmt.Fprintf(w, "      <location>%s</location>\n", escapeXML(item.URL))
+		fmt.Fprintf(w, "      <title>%s</title>\n", escapeXML(item.Title))
+		// players show the album next to the title, the category is the closest thing we have
+		fmt.Fprintf(w, "      <album>%s</album>\n", escapeXML(item.Category))
+		fmt.Fprintln(w, "    </track>")
+	}
+
+	fmt.Fprintln(w, "  </trackList>")
+	fmt.Fprintln(w, "</playlist>")
+}
+
+// HandlePLS lists the library as a PLS playlist, for players too old for anything else
+func (h *Handler) HandlePLS(w http.ResponseWriter, r *http.Request) {
+	items, ok := h.playlistItems(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/x-scpls")
+	fmt.Fprintln(w, "[playlist]")
+
+	// the entries are numbered from 1, a length of -1 means unknown
+	for i, item := range items {
+		fmt.Fprintf(w, "File%d=%s\n", i+1, item.URL)
+		fmt.Fprintf(w, "Title%d=%s\n", i+1, m3uLine(item.Title))
+		fmt.Fprintf(w, "Length%d=-1\n", i+1)
+	}
+
+	fmt.Fprintf(w, "NumberOfEntries=%d\n", len(items))
+	fmt.Fprintln(w, "Version=2")
+}
+
+// m3uLine keeps a value on its line, a line break would start a new (bogus) entry. PLS needs the same
+func m3uLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// m3uAttr quotes an #EXTINF attribute value. Unquoted, a comma in it would be taken for the start of
+// the title. Players don't agree on escaping quotes inside, so they become single quotes
+func m3uAttr(s string) string {
+	return `"` + strings.ReplaceAll(m3uLine(s), `"`, "'") + `"`
 }
@@ -0,0 +1,496 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// playlistEntries requests the playlist and returns its #EXTINF titles and URLs
+func playlistEntries(t *testing.T, h *Handler, query string) (titles, urls []string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.HandleM3U(rec, httptest.NewRequest(http.MethodGet, "/playlist.m3u"+query, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /playlist.m3u%s status = %d", query, rec.Code)
+	}
+
+	sc := bufio.NewScanner(rec.Body)
+	if !sc.Scan() || sc.Text() != "#EXTM3U" {
+		t.Fatalf("playlist does not start with #EXTM3U")
+	}
+	for sc.Scan() {
+		line := sc.Text()
+		if title, ok := strings.CutPrefix(line, "#EXTINF:-1,"); ok {
+			titles = append(titles, title)
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return titles, urls
+}
+
+func TestHandleM3U(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Die Hard.mp4": "yippee-ki-yay",
+		"Comedy/Airplane.m4v": "surely you can't be serious",
+	})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantTitles []string
+	}{
+		{"ok - everything", "", []string{"Airplane", "Die Hard"}},
+		{"ok - one category", "?category=Action", []string{"Die Hard"}},
+		{"ok - unknown category", "?category=Horror", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			titles, urls := playlistEntries(t, h, tt.query)
+			if strings.Join(titles, "|") != strings.Join(tt.wantTitles, "|") {
+				t.Errorf("titles = %q, want %q", titles, tt.wantTitles)
+			}
+			if len(urls) != len(titles) {
+				t.Errorf("%d urls for %d titles", len(urls), len(titles))
+			}
+		})
+	}
+}
+
+func TestHandleM3UURLsStream(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Action/Die Hard.mp4": "yippee-ki-yay"})
+
+	_, urls := playlistEntries(t, h, "")
+	if len(urls) != 1 {
+		t.Fatalf("got %d urls, want 1", len(urls))
+	}
+
+	u, err := url.Parse(urls[0])
+	if err != nil {
+		t.Fatalf("parse %q: %v", urls[0], err)
+	}
+	if u.Path != "/stream" {
+		t.Fatalf("url %q does not point at /stream", urls[0])
+	}
+
+	// follow the url through the stream handler like a player would
+	rec := httptest.NewRecorder()
+	h.Stream(rec, httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %d, want 200", u.RequestURI(), rec.Code)
+	}
+	if body, _ := io.ReadAll(rec.Body); string(body) != "yippee-ki-yay" {
+		t.Errorf("streamed %q, want the file content", body)
+	}
+}
+
+func TestHandleM3UExtended(t *testing.T) {
+	t.Parallel()
+
+	// Airplane has a poster, the other one doesn't
+	h := newTestHandler(t, map[string]string{
+		"Action/Die Hard, With a Vengeance.mp4": "x",
+		"Comedy/Airplane.m4v":                   "x",
+		"Comedy/Airplane.jpg":                   "jpeg",
+	})
+	airplane := entryByName(t, h, "Airplane.m4v")
+	vengeance := entryByName(t, h, "Die Hard, With a Vengeance.mp4")
+
+	rec := httptest.NewRecorder()
+	h.HandleM3U(rec, httptest.NewRequest(http.MethodGet, "/playlist.m3u?style=extended", nil))
+
+	want := "#EXTM3U\n" +
+		`#EXTINF:-1 tvg-name="Airplane" tvg-logo="http://example.com/thumb/` + airplane.UUID.String() + `" group-title="Comedy",Airplane` + "\n" +
+		"#EXTGRP:Comedy\n" +
+		"http://example.com/stream?id=" + airplane.UUID.String() + "\n" +
+		`#EXTINF:-1 tvg-name="Die Hard, With a Vengeance" group-title="Action",Die Hard, With a Vengeance` + "\n" +
+		"#EXTGRP:Action\n" +
+		"http://example.com/stream?id=" + vengeance.UUID.String() + "\n"
+
+	if got := rec.Body.String(); got != want {
+		t.Errorf("extended playlist =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestM3UEscaping(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		input    string
+		wantAttr string
+		wantLine string
+	}{
+		{"ok - plain", "Airplane", `"Airplane"`, "Airplane"},
+		{"ok - comma stays inside the quotes", "Die Hard, With a Vengeance", `"Die Hard, With a Vengeance"`, "Die Hard, With a Vengeance"},
+		{"ok - double quotes", `The "Naked" Gun`, `"The 'Naked' Gun"`, `The "Naked" Gun`},
+		{"ok - line breaks", "two\nlines\r", `"two lines "`, "two lines "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := m3uAttr(tt.input); got != tt.wantAttr {
+				t.Errorf("m3uAttr(%q) = %s, want %s", tt.input, got, tt.wantAttr)
+			}
+			if got := m3uLine(tt.input); got != tt.wantLine {
+				t.Errorf("m3uLine(%q) = %q, want %q", tt.input, got, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestHandleM3UStyle(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"film.mp4": "x"})
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		wantGrp  bool
+	}{
+		{"ok - default is basic", "", http.StatusOK, false},
+		{"ok - basic", "?style=basic", http.StatusOK, false},
+		{"ok - extended", "?style=extended", http.StatusOK, true},
+		{"fail - unknown style", "?style=fancy", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			h.HandleM3U(rec, httptest.NewRequest(http.MethodGet, "/playlist.m3u"+tt.query, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := strings.Contains(rec.Body.String(), "#EXTGRP:"); got != tt.wantGrp {
+				t.Errorf("has #EXTGRP = %v, want %v", got, tt.wantGrp)
+			}
+		})
+	}
+}
+
+func TestPlaylistFormats(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Die Hard.mp4":    "x",
+		"Comedy/Airplane.m4v":    "x",
+		"Comedy/Tom & Jerry.mp4": "x",
+		"Drama/Heat (1995).m4v":  "x",
+	})
+	url := func(name string) string {
+		return "http://example.com/stream?id=" + entryByName(t, h, name).UUID.String()
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		wantCT  string
+		want    string
+	}{
+		{"ok - m3u", h.HandleM3U, "/playlist.m3u?category=Comedy", "audio/x-mpegurl",
+			"#EXTM3U\n" +
+				"#EXTINF:-1,Airplane\n" + url("Airplane.m4v") + "\n" +
+				"#EXTINF:-1,Tom & Jerry\n" + url("Tom & Jerry.mp4") + "\n"},
+		{"ok - xspf", h.HandleXSPF, "/playlist.xspf?category=Comedy", "application/xspf+xml",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<playlist version="1" xmlns="http://xspf.org/ns/0/">` + "\n" +
+				"  <title>Test Server</title>\n" +
+				"  <trackList>\n" +
+				"    <track>\n" +
+				"      <location>" + url("Airplane.m4v") + "</location>\n" +
+				"      <title>Airplane</title>\n" +
+				"      <album>Comedy</album>\n" +
+				"    </track>\n" +
+				"    <track>\n" +
+				"      <location>" + url("Tom & Jerry.mp4") + "</location>\n" +
+				"      <title>Tom &amp; Jerry</title>\n" +
+				"      <album>Comedy</album>\n" +
+				"    </track>\n" +
+				"  </trackList>\n" +
+				"</playlist>\n"},
+		{"ok - pls", h.HandlePLS, "/playlist.pls?category=Comedy", "audio/x-scpls",
+			"[playlist]\n" +
+				"File1=" + url("Airplane.m4v") + "\n" +
+				"Title1=Airplane\n" +
+				"Length1=-1\n" +
+				"File2=" + url("Tom & Jerry.mp4") + "\n" +
+				"Title2=Tom & Jerry\n" +
+				"Length2=-1\n" +
+				"NumberOfEntries=2\n" +
+				"Version=2\n"},
+		{"ok - pls unknown category", h.HandlePLS, "/playlist.pls?category=Horror", "audio/x-scpls",
+			"[playlist]\nNumberOfEntries=0\nVersion=2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s status = %d", tt.path, rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != tt.wantCT {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.wantCT)
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("GET %s =\n%s\nwant\n%s", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// every format must list the same entries in the same order for the same query
+func TestPlaylistFormatsAgree(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Die Hard.mp4": "x",
+		"Action/Speed.mp4":    "x",
+		"Comedy/Airplane.m4v": "x",
+	})
+	locations := regexp.MustCompile(`http://example\.com/stream\?id=[0-9a-f-]+`)
+
+	for _, query := range []string{"", "?category=Action", "?category=Comedy", "?category=Horror"} {
+		var lists []string
+		for _, handler := range []http.HandlerFunc{h.HandleM3U, h.HandleXSPF, h.HandlePLS} {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, "/playlist"+query, nil))
+			lists = append(lists, strings.Join(locations.FindAllString(rec.Body.String(), -1), "|"))
+		}
+
+		if lists[0] != lists[1] || lists[0] != lists[2] {
+			t.Errorf("query %q lists differ between m3u, xspf and pls:\n%s", query, strings.Join(lists, "\n"))
+		}
+	}
+}
+
+func TestHandleCategoryM3U(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Kids/Cars.mp4":                  "x",
+		"Kids Movies/Up.mp4":             "x",
+		"Action/Classics/Die Hard.mp4":   "x",
+		"Documentaries/Planet Earth.mp4": "x",
+	})
+	mux := newPlaylistMux(h)
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		want     string // in the body
+	}{
+		{"ok - category", "/playlist/Kids.m3u", http.StatusOK, "#PLAYLIST:Kids\n#EXTINF:-1,Cars\n"},
+		{"ok - escaped space", "/playlist/Kids%20Movies.m3u", http.StatusOK, "#EXTINF:-1,Up\n"},
+		{"ok - nested, slash as it is", "/playlist/Action/Classics.m3u", http.StatusOK, "#EXTINF:-1,Die Hard\n"},
+		{"ok - nested, slash escaped", "/playlist/Action%2FClassics.m3u", http.StatusOK, "#EXTINF:-1,Die Hard\n"},
+		{"ok - style", "/playlist/Kids.m3u?style=extended", http.StatusOK, `group-title="Kids"`},
+		{"fail - case differs", "/playlist/kids.m3u", http.StatusNotFound, "did you mean: Kids, Kids Movies"},
+		{"fail - typo", "/playlist/Documentaris.m3u", http.StatusNotFound, "did you mean: Documentaries"},
+		{"fail - parent of a nested category", "/playlist/Action.m3u", http.StatusNotFound, "did you mean: Action/Classics"},
+		{"fail - nothing like it", "/playlist/Westerns.m3u", http.StatusNotFound, "unknown category \"Westerns\"\n"},
+		{"fail - no extension", "/playlist/Kids", http.StatusNotFound, ""},
+		{"fail - no name", "/playlist/.m3u", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s status = %d, want %d: %s", tt.path, rec.Code, tt.wantCode, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("GET %s = %q, want %q in it", tt.path, rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleCategoryM3UAgreesWithQuery(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Kids/Cars.mp4": "x", "Kids/Up.mp4": "x", "Action/Heat.mp4": "x"})
+	mux := newPlaylistMux(h)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/playlist/Kids.m3u", nil))
+	byPath := strings.Replace(rec.Body.String(), "#PLAYLIST:Kids\n", "", 1)
+
+	rec = httptest.NewRecorder()
+	h.HandleM3U(rec, httptest.NewRequest(http.MethodGet, "/playlist.m3u?category=Kids", nil))
+
+	if byPath != rec.Body.String() {
+		t.Errorf("/playlist/Kids.m3u =\n%s\nwant the entries of ?category=Kids:\n%s", byPath, rec.Body)
+	}
+}
+
+func TestPlaylistSortAndLimit(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		date := func(year int, month time.Month) time.Time { return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC) }
+
+		// Die Hard and Airplane come with the first scan, Speed and Naked Gun an hour apart after it
+		h := newTestHandler(t, map[string]string{"Action/Die Hard.mp4": "xxx", "Comedy/Airplane.m4v": "xxxxx"})
+		root := h.Media.Volumes[testMountID].RootPath
+		add := func(name, content string, mtime time.Time) {
+			path := filepath.Join(root, filepath.FromSlash(name))
+			if _, err := os.Stat(path); err != nil {
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		add("Action/Die Hard.mp4", "", date(1988, time.July))
+		add("Comedy/Airplane.m4v", "", date(1980, time.July))
+		for _, f := range []struct {
+			name, content string
+			mtime         time.Time
+		}{
+			{"Action/Speed.mp4", "xxxx", date(1994, time.June)},
+			{"Comedy/Naked Gun.mp4", "x", date(1988, time.December)},
+		} {
+			// a rescan keeps the added time of what it knows, the new mtimes of the first two included
+			if err := h.Media.Registry.Scan(testMountID, root); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Hour)
+			add(f.name, f.content, f.mtime)
+		}
+		if err := h.Media.Registry.Scan(testMountID, root); err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []uuid.UUID
+		for _, name := range []string{"Airplane.m4v", "Speed.mp4", "Die Hard.mp4"} {
+			ids = append(ids, entryByName(t, h, name).UUID)
+		}
+		saved, err := h.Playlists.Add("picked", ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mux := newPlaylistMux(h)
+		mux.HandleFunc("/playlist.m3u", h.HandleM3U)
+		mux.HandleFunc("/playlist.xspf", h.HandleXSPF)
+		mux.HandleFunc("/playlist.pls", h.HandlePLS)
+		savedURL := playlistURL(saved.ID)
+
+		titles := regexp.MustCompile(`(?m)^#EXTINF:-1,(.*)$|<title>(.*)</title>|^Title\d+=(.*)$`)
+
+		tests := []struct {
+			name     string
+			path     string
+			wantCode int
+			want     []string
+		}{
+			{"ok - recently added", "/playlist.m3u?sort=added&limit=2", http.StatusOK, []string{"Naked Gun", "Speed"}},
+			{"ok - added together by modification", "/playlist.m3u?sort=added", http.StatusOK, []string{"Naked Gun", "Speed", "Die Hard", "Airplane"}},
+			{"ok - largest", "/playlist.xspf?sort=size&limit=3", http.StatusOK, []string{"Airplane", "Speed", "Die Hard"}},
+			{"ok - newest", "/playlist.pls?sort=newest", http.StatusOK, []string{"Speed", "Naked Gun", "Die Hard", "Airplane"}},
+			{"ok - limit alone keeps the name order", "/playlist.m3u?limit=1", http.StatusOK, []string{"Airplane"}},
+			{"ok - limit past the cap", "/playlist.m3u?limit=5000", http.StatusOK, []string{"Airplane", "Die Hard", "Naked Gun", "Speed"}},
+			{"ok - with a category", "/playlist.m3u?category=Action&sort=added", http.StatusOK, []string{"Speed", "Die Hard"}},
+			{"ok - category path", "/playlist/Comedy.m3u?sort=added&limit=1", http.StatusOK, []string{"Naked Gun"}},
+			{"ok - saved keeps the picked order", savedURL + "?limit=2", http.StatusOK, []string{"Airplane", "Speed"}},
+			{"ok - saved sorted", savedURL + "?sort=name", http.StatusOK, []string{"Airplane", "Die Hard", "Speed"}},
+			{"ok - by name, naturally", "/playlist.m3u?sort=name&collate=locale", http.StatusOK, []string{"Airplane", "Die Hard", "Naked Gun", "Speed"}},
+			{"fail - unknown order", "/playlist.m3u?sort=rating", http.StatusBadRequest, nil},
+			{"fail - unknown collation", "/playlist.m3u?sort=name&collate=fr_FR", http.StatusBadRequest, nil},
+			{"fail - zero limit", "/playlist.xspf?limit=0", http.StatusBadRequest, nil},
+			{"fail - negative limit", "/playlist.pls?limit=-1", http.StatusBadRequest, nil},
+			{"fail - limit in words", "/playlist/Comedy.m3u?limit=ten", http.StatusBadRequest, nil},
+			{"fail - saved with unknown order", savedURL + "?sort=rating", http.StatusBadRequest, nil},
+		}
+
+		for _, tt := range tests {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("%s: GET %s status = %d, want %d", tt.name, tt.path, rec.Code, tt.wantCode)
+				continue
+			}
+			var got []string
+			for _, m := range titles.FindAllStringSubmatch(rec.Body.String(), -1) {
+				// the xspf has a title of its own
+				if title := m[1] + m[2] + m[3]; title != "Test Server" {
+					got = append(got, title)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("%s: GET %s lists %q, want %q", tt.name, tt.path, got, tt.want)
+			}
+		}
+	})
+}
+
+func TestHandleM3UParts(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Heat CD2.mkv":  "x",
+		"Action/Heat CD1.mkv":  "x",
+		"Action/Ronin CD1.mpg": "x",
+		"Action/Ronin CD2.mpg": "x",
+	})
+	heat := entryByName(t, h, "Heat.mkv").UUID.String()
+	ronin := entryByName(t, h, "Ronin.mpg").UUID.String()
+
+	titles, urls := playlistEntries(t, h, "")
+
+	// matroska parts follow each other, mpeg ones are joined by the server
+	wantTitles := []string{"Heat (part 1 of 2)", "Heat (part 2 of 2)", "Ronin"}
+	wantURLs := []string{
+		"http://example.com/stream?id=" + heat + "&part=1",
+		"http://example.com/stream?id=" + heat + "&part=2",
+		"http://example.com/stream?id=" + ronin,
+	}
+	if strings.Join(titles, "|") != strings.Join(wantTitles, "|") {
+		t.Errorf("titles = %q, want %q", titles, wantTitles)
+	}
+	if strings.Join(urls, "|") != strings.Join(wantURLs, "|") {
+		t.Errorf("urls = %q, want %q", urls, wantURLs)
+	}
+}
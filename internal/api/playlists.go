@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"streamer/internal/media"
+	"streamer/internal/playlist"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// limits of a saved playlist
+const (
+	maxPlaylistName    = 100
+	maxPlaylistEntries = 500
+	maxPlaylistBody    = 64 << 10
+)
+
+// newPlaylist is the body of POST /api/playlists
+type newPlaylist struct {
+	Name string   `json:"name"`
+	IDs  []string `json:"ids"`
+}
+
+// savedPlaylist is a playlist the way /api/playlists reports it
+type savedPlaylist struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Entries []string `json:"entries"`
+	URL     string   `json:"url"` // the m3u to hand to a player
+}
+
+func toSavedPlaylist(p playlist.Playlist) savedPlaylist {
+	entries := make([]string, len(p.Entries))
+	for i, id := range p.Entries {
+		entries[i] = id.String()
+	}
+	return savedPlaylist{ID: p.ID.String(), Name: p.Name, Entries: entries, URL: playlistURL(p.ID)}
+}
+
+func playlistURL(id uuid.UUID) string {
+	return "/playlist/" + id.String() + ".m3u"
+}
+
+// HandleCreatePlaylist serves POST /api/playlists. It takes JSON ({"name": ..., "ids": [...]}) and
+// answers with the playlist, or the form of the web ui (name and id, repeated) and goes back to the list
+func (h *Handler) HandleCreatePlaylist(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPlaylistBody)
+
+	var req newPlaylist
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isJSON := mediaType == "application/json"
+	if isJSON {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad playlist: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad form: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req = newPlaylist{Name: r.PostForm.Get("name"), IDs: r.PostForm["id"]}
+	}
+
+	name, ids, err := h.checkPlaylist(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.Playlists.Add(name, ids)
+	if err != nil {
+		if errors.Is(err, playlist.ErrFull) {
+			http.Error(w, "too many playlists, delete some first", http.StatusConflict)
+			return
+		}
+		h.logger.Error("saving playlist", "name", name, "err", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.logger.Info("playlist created", "playlist_id", p.ID, "name", p.Name, "entries", len(p.Entries))
+
+	if !isJSON {
+		http.Redirect(w, r, "/#playlists", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Location", playlistURL(p.ID))
+	h.writeJSON(w, http.StatusCreated, toSavedPlaylist(p))
+}
+
+// checkPlaylist validates a new playlist, every id has to be an entry of the library
+func (h *Handler) checkPlaylist(req newPlaylist) (string, []uuid.UUID, error) {
+	name := strings.TrimSpace(m3uLine(req.Name))
+	if name == "" {
+		return "", nil, errors.New("the playlist needs a name")
+	}
+	if utf8.RuneCountInString(name) > maxPlaylistName {
+		return "", nil, fmt.Errorf("playlist name longer than %d characters", maxPlaylistName)
+	}
+
+	if len(req.IDs) == 0 {
+		return "", nil, errors.New("pick at least one title")
+	}
+	if len(req.IDs) > maxPlaylistEntries {
+		return "", nil, fmt.Errorf("a playlist takes up to %d titles", maxPlaylistEntries)
+	}
+
+	ids := make([]uuid.UUID, 0, len(req.IDs))
+	for _, s := range req.IDs {
+		id, err := uuid.FromString(s)
+		if err != nil {
+			return "", nil, fmt.Errorf("bad id %q", s)
+		}
+		if _, err := h.Media.GetEntry(id); err != nil {
+			return "", nil, fmt.Errorf("unknown entry %s", id)
+		}
+		ids = append(ids, id)
+	}
+	return name, ids, nil
+}
+
+// HandlePlaylists serves GET /api/playlists, the saved playlists oldest first
+func (h *Handler) HandlePlaylists(w http.ResponseWriter, r *http.Request) {
+	resp := []savedPlaylist{}
+	for _, p := range h.Playlists.List() {
+		resp = append(resp, toSavedPlaylist(p))
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleDeletePlaylist serves DELETE /api/playlists/{id}
+func (h *Handler) HandleDeletePlaylist(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.FromString(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "bad id", http.StatusNotFound)
+		return
+	}
+	if err := h.Playlists.Delete(id); err != nil {
+		http.Error(w, "playlist not found", http.StatusNotFound)
+		return
+	}
+	h.logger.Info("playlist deleted", "playlist_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlePlaylistM3U serves GET /playlist/{file...}: a saved playlist when file is its id with .m3u,
+// otherwise the playlist of a category (see serveCategoryM3U). Entries the library lost since a playlist
+// was saved are left out, ?style=, ?sort= and ?limit= work like on /playlist.m3u, without ?sort= the titles
+// keep the order they were picked in
+func (h *Handler) HandlePlaylistM3U(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".m3u")
+	if !ok || name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := uuid.FromString(name)
+	if err != nil {
+		h.serveCategoryM3U(w, r, name)
+		return
+	}
+	p, ok := h.Playlists.Get(id)
+	if !ok {
+		http.Error(w, "playlist not found", http.StatusNotFound)
+		return
+	}
+
+	opts, err := parsePlaylistOptions(r, h.Media.Registry.Collation())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var entries []media.Entry
+	for _, entryID := range p.Entries {
+		e, err := h.Media.GetEntry(entryID)
+		if err != nil {
+			h.logger.Warn("playlist entry not in the library, skipped", "playlist_id", p.ID, "entry_id", entryID)
+			continue
+		}
+		// hidden since the playlist was saved
+		if e.Hidden {
+			continue
+		}
+		entries = append(entries, *e)
+	}
+	h.serveM3U(w, r, p.Name, opts.items(h.baseURL(r), entries))
+}
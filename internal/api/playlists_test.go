@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+func newPlaylistMux(h *Handler) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /playlist/{file...}", h.HandlePlaylistM3U)
+	mux.HandleFunc("GET /api/playlists", h.HandlePlaylists)
+	mux.HandleFunc("POST /api/playlists", h.HandleCreatePlaylist)
+	mux.HandleFunc("DELETE /api/playlists/{id}", h.HandleDeletePlaylist)
+	return mux
+}
+
+func TestHandleCreatePlaylist(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Alien.mkv": "a", "Heat.mp4": "h"})
+	mux := newPlaylistMux(h)
+	alien := entryByName(t, h, "Alien.mkv").UUID.String()
+	heat := entryByName(t, h, "Heat.mp4").UUID.String()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantCode    int
+	}{
+		{"ok - json", "application/json", `{"name": "movie night", "ids": ["` + heat + `", "` + alien + `"]}`, http.StatusCreated},
+		{"ok - web ui form", "application/x-www-form-urlencoded", url.Values{"name": {"kids"}, "id": {alien}}.Encode(), http.StatusSeeOther},
+		{"fail - no name", "application/json", `{"name": " ", "ids": ["` + heat + `"]}`, http.StatusBadRequest},
+		{"fail - name too long", "application/json", `{"name": "` + strings.Repeat("x", 101) + `", "ids": ["` + heat + `"]}`, http.StatusBadRequest},
+		{"fail - no titles", "application/json", `{"name": "empty"}`, http.StatusBadRequest},
+		{"fail - bad id", "application/json", `{"name": "bad", "ids": ["nope"]}`, http.StatusBadRequest},
+		{"fail - unknown entry", "application/json", `{"name": "gone", "ids": ["00000000-0000-0000-0000-000000000001"]}`, http.StatusBadRequest},
+		{"fail - bad json", "application/json", `{"name":`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/playlists", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+
+	if got := len(h.Playlists.List()); got != 2 {
+		t.Errorf("%d playlists saved, want 2", got)
+	}
+}
+
+func TestHandlePlaylistM3U(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Alien.mkv": "a", "Heat.mp4": "h"})
+	mux := newPlaylistMux(h)
+	alien := entryByName(t, h, "Alien.mkv").UUID
+	heat := entryByName(t, h, "Heat.mp4").UUID
+
+	// the library lost the second title since the playlist was saved
+	p, err := h.Playlists.Add("movie night", []uuid.UUID{heat, uuid.Must(uuid.NewV4()), alien})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, playlistURL(p.ID), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	want := "#EXTM3U\n#PLAYLIST:movie night\n" +
+		"#EXTINF:-1,Heat\nhttp://example.com/stream?id=" + heat.String() + "\n" +
+		"#EXTINF:-1,Alien\nhttp://example.com/stream?id=" + alien.String() + "\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("playlist =\n%s\nwant\n%s", got, want)
+	}
+
+	for _, path := range []string{"/playlist/" + p.ID.String(), "/playlist/nope.m3u", "/playlist/00000000-0000-0000-0000-000000000001.m3u"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want 404", path, rec.Code)
+		}
+	}
+}
+
+func TestHandlePlaylistsListAndDelete(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Alien.mkv": "a"})
+	mux := newPlaylistMux(h)
+	p, err := h.Playlists.Add("kids", []uuid.UUID{entryByName(t, h, "Alien.mkv").UUID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func() []savedPlaylist {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/playlists", nil))
+		var got []savedPlaylist
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatalf("decode playlists: %v", err)
+		}
+		return got
+	}
+
+	if got := list(); len(got) != 1 || got[0].Name != "kids" || got[0].URL != playlistURL(p.ID) || len(got[0].Entries) != 1 {
+		t.Fatalf("playlists = %+v", got)
+	}
+
+	del := func() int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/playlists/"+p.ID.String(), nil))
+		return rec.Code
+	}
+	if code := del(); code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want 204", code)
+	}
+	if code := del(); code != http.StatusNotFound {
+		t.Errorf("second DELETE status = %d, want 404", code)
+	}
+	if got := list(); len(got) != 0 {
+		t.Errorf("playlists after the delete = %+v, want none", got)
+	}
+}
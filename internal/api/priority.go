@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"streamer/internal/media"
+	"strings"
+)
+
+// PriorityRule gives the reads of renderers whose User-Agent holds one of Match a priority other than normal
+type PriorityRule struct {
+	Priority media.Priority
+	Match    []string // lowercase User-Agent parts
+}
+
+// priority is the class r waits for an io slot with: the priority query parameter, e.g. a download script
+// asking for ?priority=low, else the first rule matching its User-Agent, else normal
+func (h *Handler) priority(r *http.Request) media.Priority {
+	if p, err := media.ParsePriority(r.URL.Query().Get("priority")); err == nil {
+		return p
+	}
+	ua := strings.ToLower(r.Header.Get("User-Agent"))
+	for _, rule := range h.config.Priorities {
+		for _, match := range rule.Match {
+			if strings.Contains(ua, match) {
+				return rule.Priority
+			}
+		}
+	}
+	return media.PriorityNormal
+}
+
+// waitingSummary is the waiters of an io limiter by class from the highest, e.g. "1 high, 2 low", empty
+// when none wait
+func waitingSummary(waiting map[media.Priority]int) string {
+	var parts []string
+	for _, p := range media.Priorities {
+		if n := waiting[p]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, p))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"streamer/internal/media"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriority(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+	h.config.Priorities = []PriorityRule{
+		{Priority: media.PriorityHigh, Match: []string{"samsung", "bravia"}},
+		{Priority: media.PriorityLow, Match: []string{"wget"}},
+	}
+
+	tests := []struct {
+		name      string
+		url       string
+		userAgent string
+		want      media.Priority
+	}{
+		{"ok - no rule matches", "/stream?id=x", "VLC/3.0.20", media.PriorityNormal},
+		{"ok - by User-Agent", "/stream?id=x", "SEC_HHP_[TV] Samsung Q7 Series/1.0", media.PriorityHigh},
+		{"ok - the first rule matching", "/download/x", "Wget/1.21 bravia", media.PriorityHigh},
+		{"ok - low by User-Agent", "/download/x", "Wget/1.21", media.PriorityLow},
+		{"ok - query over User-Agent", "/direct/x.mp4?priority=low", "Samsung", media.PriorityLow},
+		{"ok - query without a rule", "/stream?id=x&priority=high", "curl/8.5", media.PriorityHigh},
+		{"ok - unknown query value is ignored", "/stream?id=x&priority=urgent", "Wget/1.21", media.PriorityLow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			r.Header.Set("User-Agent", tt.userAgent)
+			if got := h.priority(r); got != tt.want {
+				t.Errorf("priority() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityWaitingStatus(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mp4": "0123456789"})
+	id := entryByName(t, h, "Heat.mp4").UUID.String()
+	mount, err := h.Media.GetMount(testMountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tv holds every slot, a download script queues behind it
+	for range mount.Limiter.Cap() {
+		if err := mount.Limiter.Acquire(t.Context(), "tv"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		h.Stream(w, httptest.NewRequest(http.MethodGet, "/stream?id="+id+"&priority=low", nil))
+		done <- w
+	}()
+
+	var status struct {
+		Volumes []struct {
+			Waiting map[string]int `json:"waiting"`
+		} `json:"volumes"`
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		rec := httptest.NewRecorder()
+		h.HandleStatus(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body.String(), err)
+		}
+		if len(status.Volumes) == 1 && len(status.Volumes[0].Waiting) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the stream never queued for a slot")
+		}
+	}
+	if want := map[string]int{"low": 1}; !maps.Equal(status.Volumes[0].Waiting, want) {
+		t.Errorf("waiting = %v, want %v", status.Volumes[0].Waiting, want)
+	}
+
+	rec := httptest.NewRecorder()
+	h.HandleAdmin(rec, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if !strings.Contains(rec.Body.String(), "waiting: 1 low") {
+		t.Errorf("admin page doesn't show the waiting stream:\n%s", rec.Body.String())
+	}
+
+	mount.Limiter.ReleaseClient("tv")
+	if w := <-done; w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Errorf("stream = %d %q once a slot was free, want the file", w.Code, w.Body.String())
+	}
+	for range mount.Limiter.Cap() - 1 {
+		mount.Limiter.ReleaseClient("tv")
+	}
+}
+
+func TestWaitingSummary(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		waiting map[media.Priority]int
+		want    string
+	}{
+		{"ok - none", nil, ""},
+		{"ok - highest first", map[media.Priority]int{media.PriorityLow: 2, media.PriorityHigh: 1}, "1 high, 2 low"},
+		{"ok - all classes", map[media.Priority]int{media.PriorityLow: 1, media.PriorityNormal: 3, media.PriorityHigh: 1}, "1 high, 3 normal, 1 low"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := waitingSummary(tt.waiting); got != tt.want {
+				t.Errorf("waitingSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
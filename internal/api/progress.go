@@ -0,0 +1,91 @@
+package api
+
+import (
+	"crypto/rand"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"streamer/internal/bookmark"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// the cookie telling browsers apart, they often share an IP behind the same router. Longer values are
+// not ours and ignored
+const (
+	clientCookie    = "streamer_client"
+	maxClientCookie = 64
+)
+
+var errBadPosition = errors.New("position must be a number of seconds, 0 or more")
+
+// progress is the resume position of an entry as /api/progress reports it
+type progress struct {
+	ID       string  `json:"id"`
+	Position float64 `json:"position"` // seconds, 0 when there is no bookmark
+}
+
+// HandleProgress serves /api/progress/{uuid}. GET returns where the client stopped watching the entry,
+// POST saves the form value position (seconds), 0 clears it
+func (h *Handler) HandleProgress(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.FromString(r.PathValue("uuid"))
+	if err != nil {
+		http.Error(w, "bad id", http.StatusNotFound)
+		return
+	}
+	if _, err := h.Media.GetEntry(id); err != nil {
+		http.Error(w, "entry not found", http.StatusNotFound)
+		return
+	}
+
+	key := bookmark.Key{ID: id, Client: progressClient(r)}
+
+	if r.Method == http.MethodPost {
+		pos, err := parsePosition(r.FormValue("position"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.Bookmarks.Set(key, pos)
+	}
+
+	pos, _ := h.Bookmarks.Get(key)
+	h.writeJSON(w, http.StatusOK, progress{ID: id.String(), Position: pos.Seconds()})
+}
+
+func parsePosition(s string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil || secs < 0 || math.IsInf(secs, 0) || math.IsNaN(secs) {
+		return 0, errBadPosition
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// progressClient is whose bookmark a request is about: the browser cookie the player page hands out, or
+// the IP for renderers, which don't keep cookies
+func progressClient(r *http.Request) string {
+	if c, err := r.Cookie(clientCookie); err == nil && c.Value != "" && len(c.Value) <= maxClientCookie {
+		return "cookie:" + c.Value
+	}
+	return clientHost(r)
+}
+
+// playerClient is progressClient for the player page, a browser without the cookie gets one
+func playerClient(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(clientCookie); err == nil && c.Value != "" && len(c.Value) <= maxClientCookie {
+		return "cookie:" + c.Value
+	}
+
+	value := rand.Text()
+	http.SetCookie(w, &http.Cookie{
+		Name:     clientCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return "cookie:" + value
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleProgress(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mp4": "x"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/progress/{uuid}", h.HandleProgress)
+	mux.HandleFunc("POST /api/progress/{uuid}", h.HandleProgress)
+
+	path := "/api/progress/" + entryByName(t, h, "Heat.mp4").UUID.String()
+
+	do := func(method, path, position, client, cookie string) *httptest.ResponseRecorder {
+		var req *http.Request
+		if method == http.MethodPost {
+			req = httptest.NewRequest(method, path, strings.NewReader(url.Values{"position": {position}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest(method, path, nil)
+		}
+		req.RemoteAddr = client
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: clientCookie, Value: cookie})
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// the TV by its IP, a browser on the same IP by its cookie
+	if rec := do(http.MethodPost, path, "2520.5", "10.0.0.2:5000", ""); rec.Code != http.StatusOK {
+		t.Fatalf("POST status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, path, "60", "10.0.0.2:6000", "laptop"); rec.Code != http.StatusOK {
+		t.Fatalf("POST status = %d: %s", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		position string
+		client   string
+		cookie   string
+		wantCode int
+		wantBody string
+	}{
+		{"ok - same client, new connection", http.MethodGet, path, "", "10.0.0.2:7000", "", http.StatusOK, `"position":2520.5`},
+		{"ok - browser by its cookie", http.MethodGet, path, "", "10.0.0.2:7000", "laptop", http.StatusOK, `"position":60`},
+		{"ok - nothing saved", http.MethodGet, path, "", "10.0.0.3:5000", "", http.StatusOK, `"position":0`},
+		{"fail - negative", http.MethodPost, path, "-1", "10.0.0.2:5000", "", http.StatusBadRequest, ""},
+		{"fail - not a number", http.MethodPost, path, "half", "10.0.0.2:5000", "", http.StatusBadRequest, ""},
+		{"fail - infinite", http.MethodPost, path, "Inf", "10.0.0.2:5000", "", http.StatusBadRequest, ""},
+		{"fail - unknown uuid", http.MethodGet, "/api/progress/00000000-0000-0000-0000-000000000001", "", "10.0.0.2:5000", "", http.StatusNotFound, ""},
+		{"fail - not a uuid", http.MethodGet, "/api/progress/nope", "", "10.0.0.2:5000", "", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.path, tt.position, tt.client, tt.cookie)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("%s %s status = %d, want %d", tt.method, tt.path, rec.Code, tt.wantCode)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want %s", rec.Body, tt.wantBody)
+			}
+		})
+	}
+
+	// watched to the end
+	do(http.MethodPost, path, "0", "10.0.0.2:5000", "")
+	if rec := do(http.MethodGet, path, "", "10.0.0.2:5000", ""); !strings.Contains(rec.Body.String(), `"position":0`) {
+		t.Errorf("position 0 did not clear the bookmark: %s", rec.Body)
+	}
+}
+
+func TestHandleWatchResumes(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mp4": "x"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /watch/{uuid}", h.HandleWatch)
+	mux.HandleFunc("POST /api/progress/{uuid}", h.HandleProgress)
+	id := entryByName(t, h, "Heat.mp4").UUID.String()
+
+	// the first visit hands out the cookie
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/watch/"+id, nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != clientCookie || !cookies[0].HttpOnly {
+		t.Fatalf("first visit cookies = %v, want the client cookie", cookies)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `data-progress="/api/progress/`+id+`" data-resume="0"`) {
+		t.Errorf("player without a bookmark:\n%s", body)
+	}
+
+	// the player saves its position with it
+	req := httptest.NewRequest(http.MethodPost, "/api/progress/"+id, strings.NewReader("position=754.2"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookies[0])
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/watch/"+id, nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if got := rec.Result().Cookies(); len(got) != 0 {
+		t.Errorf("cookie handed out again: %v", got)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `data-resume="754.2"`) {
+		t.Errorf("player does not resume:\n%s", body)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strconv"
+	"streamer/internal/qr"
+	"sync"
+)
+
+// bounds of ?size= on /qr.png, in pixels
+const (
+	qrDefaultSize = 256
+	qrMinSize     = 64
+	qrMaxSize     = 1024
+)
+
+// maxQRCache bounds the generated pngs kept, there are only a few targets but every size is a key
+const maxQRCache = 64
+
+// qrKey is what a png depends on
+type qrKey struct {
+	text string
+	size int
+}
+
+// qrCache keeps the generated pngs, encoding is cheap but the same few are asked for on every page view
+type qrCache struct {
+	mu   sync.Mutex
+	pngs map[qrKey][]byte
+}
+
+func (c *qrCache) get(key qrKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, ok := c.pngs[key]
+	return data, ok
+}
+
+func (c *qrCache) put(key qrKey, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// sizes are picked by the client, start over rather than grow without end
+	if c.pngs == nil || len(c.pngs) >= maxQRCache {
+		c.pngs = make(map[qrKey][]byte)
+	}
+	c.pngs[key] = data
+}
+
+// qrTarget is the link a ?target= of /qr.png stands for. The advertised address is what a phone on the
+// network can reach, the Host header is only used until it is known. An external URL or a proxy wins
+func (h *Handler) qrTarget(r *http.Request, target string) (string, bool) {
+	base := h.baseURLOr(r, cmp.Or(h.config.Address, r.Host))
+
+	switch target {
+	case "", "web":
+		return base + "/", true
+	case "playlist":
+		return base + "/playlist.m3u", true
+	default:
+		return "", false
+	}
+}
+
+// HandleQR serves /qr.png, a QR code of the web ui (or ?target=playlist) to open it on a phone. ?size=
+// is the width in pixels, the code is drawn at the largest whole number of pixels per module that fits
+func (h *Handler) HandleQR(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	text, ok := h.qrTarget(r, query.Get("target"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown target %q, use web or playlist", query.Get("target")), http.StatusBadRequest)
+		return
+	}
+
+	size := qrDefaultSize
+	if s := query.Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < qrMinSize || n > qrMaxSize {
+			http.Error(w, fmt.Sprintf("size must be %d to %d pixels", qrMinSize, qrMaxSize), http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+
+	key := qrKey{text: text, size: size}
+	data, ok := h.qrCodes.get(key)
+	if !ok {
+		var err error
+		if data, err = renderQR(text, size); err != nil {
+			h.logger.Error("rendering qr code", "target", text, "err", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		h.qrCodes.put(key, data)
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
+}
+
+// renderQR encodes text as a png at most size pixels wide
+func renderQR(text string, size int) ([]byte, error) {
+	code, err := qr.Encode(text)
+	if err != nil {
+		return nil, err
+	}
+
+	scale := size / (code.Size + 2*qr.QuietZone)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, code.Image(scale)); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
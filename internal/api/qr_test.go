@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleQR(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantText  string
+		size      int // the size the png is cached under
+		wantWidth int
+	}{
+		// "http://example.com/" is version 2, 25 modules and the quiet zone make 33
+		{"ok - web ui by default", "", http.StatusOK, "http://example.com/", 256, 256 / 33 * 33},
+		{"ok - playlist", "?target=playlist", http.StatusOK, "http://example.com/playlist.m3u", 256, 0},
+		{"ok - smallest", "?size=64", http.StatusOK, "http://example.com/", 64, 64 / 33 * 33},
+		{"ok - largest", "?size=1024", http.StatusOK, "http://example.com/", 1024, 1024 / 33 * 33},
+		{"fail - unknown target", "?target=admin", http.StatusBadRequest, "", 0, 0},
+		{"fail - too small", "?size=63", http.StatusBadRequest, "", 0, 0},
+		{"fail - too large", "?size=1025", http.StatusBadRequest, "", 0, 0},
+		{"fail - not a number", "?size=big", http.StatusBadRequest, "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			h.HandleQR(rec, httptest.NewRequest(http.MethodGet, "/qr.png"+tt.query, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+			if err != nil {
+				t.Fatalf("not a png: %v", err)
+			}
+			if tt.wantWidth != 0 && img.Bounds().Dx() != tt.wantWidth {
+				t.Errorf("png is %d pixels wide, want %d", img.Bounds().Dx(), tt.wantWidth)
+			}
+
+			// the same target and size come from the cache
+			cached, ok := h.qrCodes.get(qrKey{text: tt.wantText, size: tt.size})
+			if !ok || !bytes.Equal(cached, rec.Body.Bytes()) {
+				t.Errorf("png for %q not cached", tt.wantText)
+			}
+		})
+	}
+}
+
+func TestHandleQRPrefersAdvertisedAddress(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+	h.SetAddress("192.168.1.20:8080")
+
+	text, ok := h.qrTarget(httptest.NewRequest(http.MethodGet, "http://localhost:8080/qr.png", nil), "web")
+	if !ok || text != "http://192.168.1.20:8080/" {
+		t.Errorf("qrTarget() = %q, %v, want the address phones can reach", text, ok)
+	}
+}
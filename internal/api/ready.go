@@ -0,0 +1,65 @@
+package api
+
+import (
+	"maps"
+	"net/http"
+	"streamer/internal/preflight"
+)
+
+type readyResponse struct {
+	Ready   bool              `json:"ready"`
+	Checks  preflight.Report  `json:"checks"`
+	Pending map[string]string `json:"pending,omitempty"` // what the server is still waiting for, by name
+}
+
+// SetPreflight records the startup checks /readyz reports on
+func (h *Handler) SetPreflight(report preflight.Report) {
+	h.ready.Lock()
+	defer h.ready.Unlock()
+	h.preflight = report
+}
+
+// SetPending keeps /readyz at 503 while the server waits for something after startup, e.g. a volume
+// to show up. An empty reason clears it
+func (h *Handler) SetPending(name, reason string) {
+	h.ready.Lock()
+	defer h.ready.Unlock()
+
+	if reason == "" {
+		delete(h.pending, name)
+		return
+	}
+	if h.pending == nil {
+		h.pending = make(map[string]string)
+	}
+	h.pending[name] = reason
+}
+
+// HandleReady answers 200 once every startup check passed, the first scan is done and nothing is
+// pending, and 503 otherwise, listing the checks either way
+func (h *Handler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	h.ready.Lock()
+	resp := readyResponse{Checks: h.preflight, Pending: maps.Clone(h.pending)}
+	h.ready.Unlock()
+
+	// a renderer browsing now would get a partial library
+	select {
+	case <-h.Media.FirstScanDone():
+	default:
+		if resp.Pending == nil {
+			resp.Pending = make(map[string]string)
+		}
+		resp.Pending["scan"] = "initial scan running"
+	}
+
+	resp.Ready = resp.Checks.OK() && len(resp.Pending) == 0
+	if resp.Checks == nil {
+		resp.Checks = preflight.Report{}
+	}
+
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	h.writeJSON(w, status, resp)
+}
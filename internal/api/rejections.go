@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// how many rejected requests the admin page shows
+const maxRejections = 20
+
+// rejection is a request the server turned away
+type rejection struct {
+	At     time.Time
+	Client string
+	Method string
+	Path   string
+	Status int
+}
+
+// rejectionLog keeps the latest rejections, the oldest are dropped past maxRejections
+type rejectionLog struct {
+	mu      sync.Mutex
+	entries []rejection // oldest first
+}
+
+func (l *rejectionLog) add(rej rejection) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.entries) == maxRejections {
+		l.entries = slices.Delete(l.entries, 0, 1)
+	}
+	l.entries = append(l.entries, rej)
+}
+
+// list returns the rejections, newest first
+func (l *rejectionLog) list() []rejection {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rejections := slices.Clone(l.entries)
+	slices.Reverse(rejections)
+	return rejections
+}
+
+// RecordRejection notes a request that was turned away for the admin page
+func (h *Handler) RecordRejection(r *http.Request, status int) {
+	h.rejections.add(rejection{
+		At:     time.Now(),
+		Client: clientHost(r),
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Status: status,
+	})
+}
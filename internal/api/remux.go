@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// remuxFeatures tells renderers the remuxed stream can't be seeked in, it's produced as it's sent
+const remuxFeatures = "DLNA.ORG_OP=00;DLNA.ORG_CI=1;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+
+// remuxes reports whether the renderer behind r is one that refuses the container of name and gets it
+// remuxed to MP4 instead. Only MKV is, and only with Remux set
+func (h *Handler) remuxes(r *http.Request, name string) bool {
+	if h.Remux == nil || !strings.EqualFold(filepath.Ext(name), ".mkv") {
+		return false
+	}
+	ua := strings.ToLower(r.Header.Get("User-Agent"))
+	for _, match := range h.NoMKV {
+		if strings.Contains(ua, strings.ToLower(match)) {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleRemux serves /remux/{uuid}.mp4, the entry's streams copied into fragmented MP4 by Remux as the
+// client reads. There's no Content-Length and no ranges, and the remux stops when the client goes away
+func (h *Handler) HandleRemux(w http.ResponseWriter, r *http.Request) {
+	if h.Remux == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, err := uuid.FromString(strings.TrimSuffix(r.PathValue("file"), ".mp4"))
+	if err != nil {
+		http.Error(w, "bad id", http.StatusNotFound)
+		return
+	}
+
+	entry, err := h.Media.GetEntry(id)
+	if err != nil {
+		http.Error(w, "entry not found", http.StatusNotFound)
+		return
+	}
+
+	w, end, ok := h.beginStream(w, r, entry, "remux")
+	if !ok {
+		return
+	}
+	defer end()
+
+	mount, err := h.Media.GetMount(entry.MountID)
+	if err != nil {
+		h.logger.Error("volume missing for entry", "vol_id", entry.MountID, "entry_id", id)
+		http.Error(w, "storage volume unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	input, err := h.Media.EntryPath(entry)
+	if err != nil {
+		h.logger.Warn("security alert: attempted path traversal", "path", entry.Path, "remote", r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("contentFeatures.dlna.org", remuxFeatures)
+	w.Header().Set("transferMode.dlna.org", "Streaming")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	client := clientHost(r)
+	if err := mount.Limiter.AcquirePriority(r.Context(), client, h.priority(r)); err != nil {
+		h.logger.Warn("IO limiter reached", "id", id)
+		http.Error(w, "server too busy", http.StatusServiceUnavailable)
+		return
+	}
+	defer mount.Limiter.ReleaseClient(client)
+
+	active := h.metrics.ActiveStreams.WithLabelValues("remux")
+	active.Inc()
+	defer active.Dec()
+
+	h.logger.Debug("remux started", "id", id, "name", entry.Name, "client", client)
+
+	// nothing is written before the remuxer's first bytes, a remux failing at once still gets a 500
+	rw := &remuxWriter{w: w}
+	err = h.Remux(r.Context(), input, rw)
+	switch {
+	case errors.Is(err, context.Canceled):
+		h.logger.Debug("remux ended by the client", "id", id)
+	case err != nil && !rw.wrote:
+		h.logger.Warn("remux failed", "id", id, "name", entry.Name, "err", err)
+		http.Error(w, "remux failed", http.StatusInternalServerError)
+	case err != nil:
+		h.logger.Warn("remux failed mid stream", "id", id, "name", entry.Name, "err", err)
+	}
+}
+
+// remuxWriter remembers whether anything was sent yet
+type remuxWriter struct {
+	w     http.ResponseWriter
+	wrote bool
+}
+
+func (rw *remuxWriter) Write(p []byte) (int, error) {
+	rw.wrote = true
+	return rw.w.Write(p)
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"streamer/internal/media"
+	"strings"
+	"testing"
+	"time"
+)
+
+// copyRemuxer "remuxes" by copying the input as it is
+func copyRemuxer(ctx context.Context, input string, w io.Writer) error {
+	f, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func newRemuxTestHandler(t *testing.T, files map[string]string, remux func(ctx context.Context, input string, w io.Writer) error) (*Handler, *http.ServeMux) {
+	t.Helper()
+
+	h := newTestHandler(t, files)
+	h.Remux = remux
+	h.NoMKV = []string{"Bravia"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /remux/{file}", h.HandleRemux)
+	return h, mux
+}
+
+func TestRemuxDIDL(t *testing.T) {
+	t.Parallel()
+
+	h, _ := newRemuxTestHandler(t, map[string]string{"Films/Heat.mkv": "matroska", "Films/Ronin.mp4": "mp4"}, copyRemuxer)
+	heat, ronin := entryByName(t, h, "Heat.mkv"), entryByName(t, h, "Ronin.mp4")
+	files := []media.Video{
+		{UUID: heat.UUID, Name: heat.Name, Size: heat.Size},
+		{UUID: ronin.UUID, Name: ronin.Name, Size: ronin.Size},
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		want      []string
+		wantNot   []string
+	}{
+		{"ok - renderer refusing mkv gets mp4", "SonyBRAVIA/1.0 UPnP/1.0", []string{
+			"http://example.com/remux/" + heat.UUID.String() + ".mp4",
+			"video/mp4:DLNA.ORG_OP=00",
+			"http://example.com/direct/" + ronin.UUID.String() + ".mp4",
+		}, []string{`size="8"`, "/direct/" + heat.UUID.String()}},
+		{"ok - other renderers get the mkv", "Samsung DLNADOC/1.50", []string{
+			"http://example.com/direct/" + heat.UUID.String() + ".mkv",
+			`size="8"`,
+		}, []string{"/remux/"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodPost, "http://example.com/content/control", nil)
+			r.Header.Set("User-Agent", tt.userAgent)
+			didl := h.generateDIDL(rootID, nil, files, r)
+			for _, want := range tt.want {
+				if !strings.Contains(didl, want) {
+					t.Errorf("DIDL has no %q:\n%s", want, didl)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(didl, unwanted) {
+					t.Errorf("DIDL has %q:\n%s", unwanted, didl)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleRemux(t *testing.T) {
+	t.Parallel()
+
+	failing := func(ctx context.Context, input string, w io.Writer) error {
+		return errors.New("Invalid data found")
+	}
+
+	tests := []struct {
+		name       string
+		remux      func(ctx context.Context, input string, w io.Writer) error
+		path       func(id string) string
+		wantStatus int
+		wantBody   string
+	}{
+		{"ok - remuxed", copyRemuxer, func(id string) string { return "/remux/" + id + ".mp4" }, http.StatusOK, "matroska"},
+		{"fail - remux fails at once", failing, func(id string) string { return "/remux/" + id + ".mp4" }, http.StatusInternalServerError, "remux failed\n"},
+		{"fail - unknown id", copyRemuxer, func(string) string { return "/remux/0194d3c2-0000-7000-8000-000000000000.mp4" }, http.StatusNotFound, "entry not found\n"},
+		{"fail - off", nil, func(id string) string { return "/remux/" + id + ".mp4" }, http.StatusNotFound, "404 page not found\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h, mux := newRemuxTestHandler(t, map[string]string{"Films/Heat.mkv": "matroska"}, tt.remux)
+			id := entryByName(t, h, "Heat.mkv").UUID.String()
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path(id), nil))
+
+			if rec.Code != tt.wantStatus || rec.Body.String() != tt.wantBody {
+				t.Fatalf("GET status = %d body %q, want %d %q", rec.Code, rec.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != "video/mp4" {
+				t.Errorf("Content-Type = %q, want video/mp4", got)
+			}
+			if got := rec.Header().Get("Content-Length"); got != "" {
+				t.Errorf("Content-Length = %q, want none", got)
+			}
+			if got := rec.Header().Get("contentFeatures.dlna.org"); !strings.HasPrefix(got, "DLNA.ORG_OP=00") {
+				t.Errorf("contentFeatures.dlna.org = %q, want no seeking", got)
+			}
+		})
+	}
+}
+
+func TestHandleRemuxClientGone(t *testing.T) {
+	t.Parallel()
+
+	stopped := make(chan struct{})
+	endless := func(ctx context.Context, input string, w io.Writer) error {
+		defer close(stopped)
+		for ctx.Err() == nil {
+			if _, err := io.WriteString(w, strings.Repeat("x", 4096)); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	}
+
+	h, mux := newRemuxTestHandler(t, map[string]string{"Films/Heat.mkv": "matroska"}, endless)
+	id := entryByName(t, h, "Heat.mkv").UUID.String()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	resp, err := srv.Client().Get(srv.URL + "/remux/" + id + ".mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("status = %d transfer encoding %q, want 200 chunked", resp.StatusCode, resp.TransferEncoding)
+	}
+	if _, err := bufio.NewReader(resp.Body).Peek(1); err != nil {
+		t.Fatalf("read first bytes: %v", err)
+	}
+	resp.Body.Close()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("remux still running after the client went away")
+	}
+
+	// the stream and its io slot are given back
+	mount, err := h.Media.GetMount(testMountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for h.ActiveStreams() != 0 || mount.Limiter.InUse() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d streams and %d io slots held after the client went away", h.ActiveStreams(), mount.Limiter.InUse())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
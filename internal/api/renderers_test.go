@@ -0,0 +1,245 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"streamer/internal/media"
+	"streamer/internal/middleware"
+	"strings"
+	"testing"
+)
+
+// rendererFilm is the one video of the library the renderer captures play, 36 bytes so ranges are easy to
+// read off
+const rendererFilm = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// TestRendererCaptures replays the requests renderers were seen sending, one file of testdata/renderers
+// each, in direct and buffered mode, and checks the responses byte for byte. A capture is a sequence of
+// exchanges, each a request and the response it must get:
+//
+//	# lines starting with # are comments
+//	-- request
+//	GET /stream?id={id}
+//	User-Agent: SEC_HHP_[TV] Samsung Q7 Series/1.0
+//	Range: bytes=10-19
+//	-- response
+//	206
+//	Content-Range: bytes 10-19/36
+//	Content-Type: *
+//	ETag: <absent>
+//
+//	abcdefghij
+//
+// The request is a method and target, then its headers. The response is the status code, then the headers
+// it must have: a value of * only asks for the header, <absent> for it not to be there, the headers left
+// out aren't checked. After a blank line comes the body, up to the next -- line and compared without the
+// line ends at its end; without one it isn't checked, a HEAD gets none anyway. The library is one file,
+// film.mp4 with rendererFilm in it, {id} stands for its UUID and {etag} for its ETag anywhere in a
+// capture, {boundary} for the boundary of a multipart/byteranges response, whose body is compared with \n
+// line ends
+func TestRendererCaptures(t *testing.T) {
+	t.Parallel()
+
+	files, err := filepath.Glob(filepath.Join("testdata", "renderers", "*.txt"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no captures in testdata/renderers: %v", err)
+	}
+	modes := map[string]media.ResourceMode{"direct": media.ModeFileDirect, "buffered": media.ModeFileBuffered}
+
+	for _, file := range files {
+		exchanges := readCapture(t, file)
+		for modeName, mode := range modes {
+			t.Run(strings.TrimSuffix(filepath.Base(file), ".txt")+" "+modeName, func(t *testing.T) {
+				t.Parallel()
+
+				h := newTestHandler(t, map[string]string{"film.mp4": rendererFilm})
+				h.Media.Mode = mode
+				entry := entryByName(t, h, "film.mp4")
+				replace := strings.NewReplacer("{id}", entry.UUID.String(), "{etag}", entry.ETag).Replace
+
+				// the stack the server puts in front of streams
+				mux := http.NewServeMux()
+				mux.HandleFunc("/stream", h.Stream)
+				mux.HandleFunc("/direct/", h.AdapterDirectStream)
+				mux.HandleFunc("GET /download/{uuid}", h.HandleDownload)
+				handler := middleware.Chain(mux,
+					middleware.WithObservability(h.metrics),
+					middleware.WithLogging(h.logger),
+					middleware.WithHEAD,
+					middleware.WithStreamTracking(nil),
+				)
+				srv := httptest.NewServer(handler)
+				t.Cleanup(srv.Close)
+
+				for n, ex := range exchanges {
+					req, err := http.NewRequest(ex.method, srv.URL+replace(ex.target), nil)
+					if err != nil {
+						t.Fatalf("exchange %d: %v", n+1, err)
+					}
+					for _, hdr := range ex.reqHeader {
+						req.Header.Add(hdr[0], replace(hdr[1]))
+					}
+					resp, err := srv.Client().Do(req)
+					if err != nil {
+						t.Fatalf("exchange %d: %s %s: %v", n+1, ex.method, ex.target, err)
+					}
+					body, err := io.ReadAll(resp.Body)
+					resp.Body.Close()
+					if err != nil {
+						t.Fatalf("exchange %d: read body: %v", n+1, err)
+					}
+					ex.check(t, n+1, resp, body, replace)
+				}
+			})
+		}
+	}
+}
+
+// exchange is a request of a capture and the response it must get
+type exchange struct {
+	method, target string
+	reqHeader      [][2]string
+
+	status     int
+	respHeader [][2]string
+	body       *string // nil when it isn't checked
+}
+
+func (ex exchange) check(t *testing.T, n int, resp *http.Response, body []byte, replace func(string) string) {
+	t.Helper()
+	at := fmt.Sprintf("exchange %d, %s %s", n, ex.method, ex.target)
+
+	if resp.StatusCode != ex.status {
+		t.Errorf("%s: status = %d, want %d", at, resp.StatusCode, ex.status)
+	}
+	boundary := ""
+	if mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && mediaType == "multipart/byteranges" {
+		boundary = params["boundary"]
+		body = []byte(strings.ReplaceAll(string(body), "\r\n", "\n"))
+	}
+	placeholders := replace
+	replace = func(s string) string { return strings.ReplaceAll(placeholders(s), "{boundary}", boundary) }
+
+	for _, hdr := range ex.respHeader {
+		name, want := hdr[0], hdr[1]
+		values, ok := resp.Header[http.CanonicalHeaderKey(name)]
+		switch {
+		case want == "<absent>":
+			if ok {
+				t.Errorf("%s: %s = %q, want none", at, name, values)
+			}
+		case !ok:
+			t.Errorf("%s: no %s, want %q", at, name, want)
+		case want != "*" && strings.Join(values, ", ") != replace(want):
+			t.Errorf("%s: %s = %q, want %q", at, name, strings.Join(values, ", "), replace(want))
+		}
+	}
+	if ex.body == nil {
+		return
+	}
+	if got, want := strings.TrimRight(string(body), "\n"), strings.TrimRight(replace(*ex.body), "\n"); got != want {
+		t.Errorf("%s: body = %q, want %q", at, got, want)
+	}
+}
+
+// readCapture reads the exchanges of a capture file, see TestRendererCaptures for its format
+func readCapture(t *testing.T, file string) []exchange {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var (
+		exchanges []exchange
+		section   string // request or response
+		first     bool   // the next line is the request or status line
+		inBody    bool
+		body      []string
+	)
+	endBody := func() {
+		if inBody && len(exchanges) > 0 {
+			b := strings.Join(body, "\n")
+			exchanges[len(exchanges)-1].body = &b
+		}
+		inBody, body = false, nil
+	}
+	header := func(line string, n int) [2]string {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			t.Fatalf("%s:%d: want a header, got %q", file, n, line)
+		}
+		return [2]string{strings.TrimSpace(name), strings.TrimSpace(value)}
+	}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		switch {
+		case line == "-- request":
+			endBody()
+			exchanges = append(exchanges, exchange{})
+			section, first = "request", true
+			continue
+		case line == "-- response":
+			if section != "request" {
+				t.Fatalf("%s:%d: a response without a request", file, n)
+			}
+			section, first = "response", true
+			continue
+		case inBody:
+			body = append(body, line)
+			continue
+		case strings.HasPrefix(line, "#"):
+			continue
+		case section == "":
+			if strings.TrimSpace(line) != "" {
+				t.Fatalf("%s:%d: %q before the first request", file, n, line)
+			}
+			continue
+		}
+
+		ex := &exchanges[len(exchanges)-1]
+		switch {
+		case line == "":
+			// a blank line ends the headers of a response, what follows is the body
+			if section == "response" && !first {
+				inBody = true
+			}
+		case section == "request" && first:
+			method, target, ok := strings.Cut(line, " ")
+			if !ok {
+				t.Fatalf("%s:%d: want a method and target, got %q", file, n, line)
+			}
+			ex.method, ex.target, first = method, target, false
+		case section == "request":
+			ex.reqHeader = append(ex.reqHeader, header(line, n))
+		case first:
+			status, err := strconv.Atoi(line)
+			if err != nil {
+				t.Fatalf("%s:%d: want a status code, got %q", file, n, line)
+			}
+			ex.status, first = status, false
+		default:
+			ex.respHeader = append(ex.respHeader, header(line, n))
+		}
+	}
+	endBody()
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for n, ex := range exchanges {
+		if ex.method == "" || ex.status == 0 {
+			t.Fatalf("%s: exchange %d has no request or response", file, n+1)
+		}
+	}
+	return exchanges
+}
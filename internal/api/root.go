@@ -0,0 +1,39 @@
+package api
+
+import (
+	"io"
+	"net/http"
+)
+
+// a LAN server has nothing for search engines
+const robotsTxt = "User-agent: *\nDisallow: /\n"
+
+// JunkPaths are the files browsers and scanners ask for at the root on their own. They are served by
+// HandleJunk, not the web ui, so they don't show up as 404s
+var JunkPaths = []string{
+	"/favicon.ico",
+	"/robots.txt",
+	"/apple-touch-icon.png",
+	"/apple-touch-icon-precomposed.png",
+	"/browserconfig.xml",
+}
+
+// HandleJunk answers the JunkPaths: the embedded icon for /favicon.ico, a robots.txt that keeps crawlers
+// out, and 204 for the rest, which have no use on a media server
+func (h *Handler) HandleJunk(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/favicon.ico":
+		// the same asset as /static/favicon.ico, with its ETag and caching. Not every mime table knows .ico
+		w.Header().Set("Content-Type", "image/x-icon")
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/static/favicon.ico"
+		r2.URL.RawPath = ""
+		h.static.ServeHTTP(w, r2)
+	case "/robots.txt":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", staticCacheControl)
+		io.WriteString(w, robotsTxt)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
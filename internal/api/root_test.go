@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleJunk(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantCT   string
+		wantBody string
+	}{
+		{"ok - robots", "/robots.txt", http.StatusOK, "text/plain; charset=utf-8", robotsTxt},
+		{"ok - touch icon", "/apple-touch-icon.png", http.StatusNoContent, "", ""},
+		{"ok - precomposed touch icon", "/apple-touch-icon-precomposed.png", http.StatusNoContent, "", ""},
+		{"ok - tile config", "/browserconfig.xml", http.StatusNoContent, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			h.HandleJunk(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, rec.Code, tt.wantCode)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != tt.wantCT {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.wantCT)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandleJunkFavicon(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+
+	rec := httptest.NewRecorder()
+	h.HandleJunk(rec, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/x-icon" {
+		t.Errorf("Content-Type = %q, want image/x-icon", ct)
+	}
+	if rec.Header().Get("ETag") == "" || rec.Header().Get("Cache-Control") != staticCacheControl {
+		t.Errorf("favicon is not cached like the other assets: %v", rec.Header())
+	}
+
+	// an icon directory with one 32px png in it
+	ico := rec.Body.Bytes()
+	if len(ico) < 22 || !bytes.Equal(ico[:6], []byte{0, 0, 1, 0, 1, 0}) {
+		t.Fatalf("favicon.ico is no icon with one image: % x", ico[:min(len(ico), 6)])
+	}
+	img, err := png.Decode(bytes.NewReader(ico[22:]))
+	if err != nil {
+		t.Fatalf("icon image: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 32 {
+		t.Errorf("icon is %v, want 32x32", b)
+	}
+}
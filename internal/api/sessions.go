@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"streamer/internal/media"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// Session is a stream in flight: what is played, by whom, from which volume and how much of it was sent
+type Session struct {
+	ID      int       `json:"id"`
+	EntryID uuid.UUID `json:"entry_id"` // nil for a file of /files
+	Title   string    `json:"title"`
+	Client  string    `json:"client"`
+	Kind    string    `json:"kind"` // stream, direct, download, file or remux, an hls one only counts while it starts
+	Volume  string    `json:"volume"`
+	Started time.Time `json:"started"`
+	Sent    int64     `json:"sent_bytes"`           // of the body so far
+	Size    int64     `json:"size_bytes,omitempty"` // of the entry, 0 when unknown
+}
+
+// streamSession is a Session as the tracker holds it while the handler serving it runs
+type streamSession struct {
+	Session
+	mount *media.MountPoint // streamed from, nil when the volume wasn't found
+	sent  atomic.Int64
+}
+
+func (s *streamSession) snapshot() Session {
+	out := s.Session
+	out.Sent = s.sent.Load()
+	return out
+}
+
+// sentCounter counts the body bytes written through it into sent
+type sentCounter struct {
+	http.ResponseWriter
+	sent *atomic.Int64
+}
+
+func (c *sentCounter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.sent.Add(int64(n))
+	return n, err
+}
+
+// ReadFrom keeps sendfile for http.ServeContent when the writer below has it
+func (c *sentCounter) ReadFrom(src io.Reader) (int64, error) {
+	rf, ok := c.ResponseWriter.(io.ReaderFrom)
+	if !ok {
+		// hide ReadFrom from io.Copy, it would call back here
+		return io.Copy(struct{ io.Writer }{c}, src)
+	}
+	n, err := rf.ReadFrom(src)
+	c.sent.Add(n)
+	return n, err
+}
+
+func (c *sentCounter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Sessions returns the streams in flight, oldest first
+func (h *Handler) Sessions() []Session {
+	return h.streams.list()
+}
+
+// WaitForVolume blocks until no session streams from mount anymore, or ctx expires. A reload replacing a
+// volume keeps the old MountPoint, its io limiter included, until the sessions holding it have ended
+func (h *Handler) WaitForVolume(ctx context.Context, mount *media.MountPoint) error {
+	for {
+		busy, released := h.streams.using(mount)
+		if !busy {
+			return nil
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"streamer/internal/media"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stallingWriter stalls the second body write until released, a client that has taken some of the stream
+type stallingWriter struct {
+	*httptest.ResponseRecorder
+	writes  int
+	stalled chan struct{}
+	release chan struct{}
+}
+
+func (s *stallingWriter) Write(p []byte) (int, error) {
+	s.writes++
+	if s.writes == 2 {
+		close(s.stalled)
+		<-s.release
+	}
+	return s.ResponseRecorder.Write(p)
+}
+
+func TestSessionsAcrossReload(t *testing.T) {
+	t.Parallel()
+
+	content := strings.Repeat("x", 256<<10)
+	h := newTestHandler(t, map[string]string{"Films/Heat.mp4": content})
+	entry := entryByName(t, h, "Heat.mp4")
+	old := h.Media.Volumes[testMountID]
+
+	slow := &stallingWriter{ResponseRecorder: httptest.NewRecorder(), stalled: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := httptest.NewRequest(http.MethodGet, "/stream?id="+entry.UUID.String(), nil)
+		r.RemoteAddr = "10.0.0.2:40000"
+		h.Stream(slow, r)
+	}()
+	<-slow.stalled
+
+	sessions := h.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("%d sessions mid stream, want 1", len(sessions))
+	}
+	s := sessions[0]
+	if s.EntryID != entry.UUID || s.Kind != "stream" || s.Client != "10.0.0.2" || s.Volume != testMountID || s.Size != int64(len(content)) {
+		t.Errorf("session = %+v, want the stream of %s to 10.0.0.2 from %s", s, entry.Name, testMountID)
+	}
+	if s.Sent <= 0 || s.Sent >= s.Size {
+		t.Errorf("session sent %d of %d bytes, want some of it", s.Sent, s.Size)
+	}
+
+	// a reload swaps the volume for a new one, the session keeps the old one and its io slot
+	h.Media.Volumes[testMountID] = media.NewMount(testMountID, old.RootPath, 4)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.WaitForVolume(ctx, old); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForVolume(old) mid stream error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := old.Limiter.InUse(); got != 1 {
+		t.Errorf("old volume has %d io slots in use, want the stream's", got)
+	}
+	if err := h.WaitForVolume(context.Background(), h.Media.Volumes[testMountID]); err != nil {
+		t.Errorf("WaitForVolume(new) error = %v, want nil with nothing streaming from it", err)
+	}
+
+	waited := make(chan error, 1)
+	go func() { waited <- h.WaitForVolume(context.Background(), old) }()
+	close(slow.release)
+	<-done
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Errorf("WaitForVolume(old) error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForVolume(old) still waiting after the stream ended")
+	}
+
+	if got := slow.Body.Len(); got != len(content) {
+		t.Errorf("stream sent %d bytes across the reload, want %d", got, len(content))
+	}
+	if got := old.Limiter.InUse(); got != 0 {
+		t.Errorf("old volume has %d io slots in use after the stream, want 0", got)
+	}
+	if got := h.Sessions(); len(got) != 0 {
+		t.Errorf("%d sessions left after the stream, want none", len(got))
+	}
+}
+
+func TestSessionEndsOnPanic(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Films/Heat.mp4": "0123456789"})
+	entry := entryByName(t, h, "Heat.mp4")
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("handler didn't panic")
+			}
+		}()
+		_, end, ok := h.beginStream(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stream", nil), &entry, "stream")
+		if !ok {
+			t.Fatal("beginStream refused the stream")
+		}
+		defer end()
+		defer end() // twice is harmless
+		panic("handler bug")
+	}()
+
+	if got := h.Sessions(); len(got) != 0 {
+		t.Errorf("%d sessions left after a panic, want none", len(got))
+	}
+	if err := h.WaitForStreams(context.Background()); err != nil {
+		t.Errorf("WaitForStreams() error = %v", err)
+	}
+}
+
+func TestToAdminStream(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		session Session
+		want    string
+	}{
+		{"ok - share of the size", Session{Sent: 512 << 20, Size: 2 << 30}, "512.0 MB of 2.0 GB (25%)"},
+		{"ok - size unknown", Session{Sent: 3 << 10}, "3.0 KB"},
+		{"ok - sent past the size", Session{Sent: 2048, Size: 1024}, "2.0 KB of 1.0 KB (100%)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := toAdminStream(tt.session).Sent; got != tt.want {
+				t.Errorf("Sent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
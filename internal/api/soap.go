@@ -1,14 +1,20 @@
 package api
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/xml"
-	"fmt"
+	"errors"
 	"io"
+	"maps"
 	"net/http"
-	"net/url"
-	"path/filepath"
+	"slices"
+	"streamer/internal/bookmark"
 	"streamer/internal/media"
 	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
 )
 
 type SOAPEnvelope struct {
@@ -24,6 +30,11 @@ type SOAPBody struct {
 	GetProtocolInfo          *GetProtocolInfoRequest          `xml:"GetProtocolInfo"`
 	GetCurrentConnectionIDs  *GetCurrentConnectionIDsRequest  `xml:"GetCurrentConnectionIDs"`
 	GetCurrentConnectionInfo *GetCurrentConnectionInfoRequest `xml:"GetCurrentConnectionInfo"`
+
+	// Samsung extensions, TVs ask for the feature list on connect and save where playback stopped
+	XGetFeatureList *XGetFeatureListRequest `xml:"X_GetFeatureList"`
+	XSetBookmark    *XSetBookmarkRequest    `xml:"X_SetBookmark"`
+	XGetBookmark    *XGetBookmarkRequest    `xml:"X_GetBookmark"`
 }
 
 type BrowseRequest struct {
@@ -44,12 +55,25 @@ type GetCurrentConnectionInfoRequest struct {
 	ConnectionID int `xml:"ConnectionID"`
 }
 
-type browseResponseData struct {
-	Result         string
-	NumberReturned int
-	TotalMatches   int
+type XGetFeatureListRequest struct{}
+
+type XSetBookmarkRequest struct {
+	CategoryType string `xml:"CategoryType"`
+	RID          string `xml:"RID"`
+	ObjectID     string `xml:"ObjectID"`
+	PosSecond    int64  `xml:"PosSecond"`
+}
+
+type XGetBookmarkRequest struct {
+	ObjectID string `xml:"ObjectID"`
 }
 
+// upnpErrNoSuchObject is the UPnP error for an ObjectID the server doesn't know
+const upnpErrNoSuchObject = 701
+
+// upnpErrNotAuthorized is the UPnP error for an action the server refuses, X_SetBookmark in kiosk mode
+const upnpErrNotAuthorized = 606
+
 func (h *Handler) HandleDummyControl(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -106,6 +130,21 @@ func (h *Handler) handleContentDirectoryAction(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if envelope.Body.XGetFeatureList != nil {
+		h.render(w, "feature_list.xml", nil)
+		return
+	}
+
+	if envelope.Body.XSetBookmark != nil {
+		h.handleSetBookmark(w, r, envelope.Body.XSetBookmark)
+		return
+	}
+
+	if envelope.Body.XGetBookmark != nil {
+		h.handleGetBookmark(w, r, envelope.Body.XGetBookmark)
+		return
+	}
+
 	http.Error(w, "Unknown action", http.StatusNotImplemented)
 }
 
@@ -134,35 +173,93 @@ func (h *Handler) handleConnectionManagerAction(w http.ResponseWriter, _ *http.R
 	http.Error(w, "unknown action", http.StatusNotImplemented)
 }
 func (h *Handler) handleBrowse(w http.ResponseWriter, r *http.Request, browse *BrowseRequest) {
-	allFiles, err := h.Media.ListFiles()
+	// the DIDL goes in the response as text, it's escaped as it's written rather than after
+	buf := didlBuffers.Get().(*bytes.Buffer)
+	defer putDIDLBuffer(buf)
+	buf.Reset()
+
+	returned, total, err := h.browseDIDL(didlWriter{buf: buf, embed: true}, r, browse)
+	if errors.Is(err, errBadSort) {
+		h.soapFault(w, upnpErrBadSort, "Unsupported or invalid sort criteria")
+		return
+	}
 	if err != nil {
-		http.Error(w, "failed to list files", http.StatusInternalServerError)
+		h.soapFault(w, upnpErrNoSuchObject, "No such object")
 		return
 	}
 
-	startIndex := browse.StartingIndex
-	requestedCount := browse.RequestedCount
-
-	if requestedCount == 0 {
-		requestedCount = len(allFiles)
+	data := BrowseResponseData{
+		Result:         buf.String(),
+		NumberReturned: returned,
+		TotalMatches:   total,
 	}
+	data.UpdateID, _ = h.Media.Registry.Watch()
+	h.render(w, "browse_response.xml", data)
+}
+
+// errNoSuchObject is a Browse of an ObjectID the server doesn't know
+var errNoSuchObject = errors.New("no such object")
+
+// browseDIDL writes the DIDL-Lite answering browse to d, and returns how many children it lists and how
+// many there are. Browse and /debug/didl both go through here, so the dump is what TVs get
+func (h *Handler) browseDIDL(d didlWriter, r *http.Request, browse *BrowseRequest) (returned, total int, err error) {
+	// renderers that know no better ask for the root with an empty id
+	id := cmp.Or(browse.ObjectID, rootID)
+
+	folder, subfolders, videos, ok := h.folder(id)
+	var parentID string
+	var containers []container
+	var files []media.Video
+	switch {
+	case browse.BrowseFlag == "BrowseMetadata" && ok:
+		parentID, containers = folder.ParentID, []container{folder}
+		returned, total = 1, 1
+
+	case browse.BrowseFlag == "BrowseMetadata":
+		entry, err := h.entryByObjectID(id)
+		if err != nil {
+			return 0, 0, errNoSuchObject
+		}
+		parentID, files = h.itemParentID(entry.Category), media.Videos([]media.Entry{*entry})
+		returned, total = 1, 1
 
-	endIndex := min(startIndex+requestedCount, len(allFiles))
-	startIndex = min(startIndex, len(allFiles))
+	case !ok:
+		return 0, 0, errNoSuchObject
 
-	mediaFiles := allFiles[startIndex:endIndex]
+	default:
+		keys, err := parseSortCriteria(browse.SortCriteria)
+		if err != nil {
+			return 0, 0, err
+		}
+		sortChildren(subfolders, videos, keys, h.Media.Registry.Collation())
+		containers, files = pageChildren(subfolders, videos, browse.StartingIndex, h.browseCount(id, browse.RequestedCount))
+		parentID, returned, total = id, len(containers)+len(files), len(subfolders)+len(videos)
+	}
 
-	didl := h.generateDIDL(mediaFiles, r.Host)
-	escapedDIDL := escapeXML(didl)
+	h.logger.Debug("browse returned", "object_id", id, "returned", returned, "total", total, "remote", r.RemoteAddr)
+	h.writeDIDL(d, parentID, containers, files, r)
+	return returned, total, nil
+}
 
-	h.logger.Debug("browse returned", "returned", len(mediaFiles), "total", len(allFiles), "remote", r.RemoteAddr)
+// browseCount is how many children a Browse gets for the count it asked for. Asking for more than
+// BrowseMax, or for everything with 0, gets BrowseMax: TotalMatches still says how many there are, so
+// clients page through the rest rather than wait on a response too big for them to parse
+func (h *Handler) browseCount(id string, requested int) int {
+	limit := h.config.BrowseMax
+	if limit <= 0 || (requested > 0 && requested <= limit) {
+		return requested
+	}
+	h.logger.Debug("browse page clamped", "object_id", id, "requested", requested, "max", limit)
+	return limit
+}
 
-	data := browseResponseData{
-		Result:         escapedDIDL,
-		NumberReturned: len(mediaFiles),
-		TotalMatches:   len(allFiles),
+// entryByObjectID is the entry behind the id of a DIDL item
+func (h *Handler) entryByObjectID(id string) (*media.Entry, error) {
+	uid, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
 	}
-	h.render(w, "browse_response.xml", data)
+	return h.Media.GetEntry(uid)
 }
 
 func (h *Handler) handleGetSearchCapabilities(w http.ResponseWriter) {
@@ -170,65 +267,94 @@ func (h *Handler) handleGetSearchCapabilities(w http.ResponseWriter) {
 }
 
 func (h *Handler) handleGetSortCapabilities(w http.ResponseWriter) {
-	h.render(w, "sort_caps.xml", nil)
+	h.render(w, "sort_caps.xml", SortCapsData{sortCaps()})
 }
 
+// handleGetSystemUpdateID answers with the version of the library, it changes with every change to it
 func (h *Handler) handleGetSystemUpdateID(w http.ResponseWriter) {
-	h.render(w, "system_update_id.xml", nil)
+	version, _ := h.Media.Registry.Watch()
+	h.render(w, "system_update_id.xml", SystemUpdateIDData{version})
 }
 
-func (h *Handler) handleGetProtocolInfo(w http.ResponseWriter) {
-	h.render(w, "protocol_info.xml", nil)
+// handleSetBookmark saves where a Samsung TV stopped playing an item, in the same store as /api/progress
+// under the TV's IP. A position of 0 clears it
+func (h *Handler) handleSetBookmark(w http.ResponseWriter, r *http.Request, req *XSetBookmarkRequest) {
+	if h.config.ReadOnly {
+		h.soapFault(w, upnpErrNotAuthorized, "Action not authorized")
+		return
+	}
+	key, ok := h.bookmarkKey(w, r, req.ObjectID)
+	if !ok {
+		return
+	}
+
+	h.Bookmarks.Set(key, time.Duration(max(req.PosSecond, 0))*time.Second)
+	h.logger.Debug("bookmark set", "object_id", req.ObjectID, "position", req.PosSecond, "remote", r.RemoteAddr)
+	h.render(w, "set_bookmark.xml", nil)
 }
 
-func (h *Handler) handleGetCurrentConnectionIDs(w http.ResponseWriter) {
-	h.render(w, "connection_ids.xml", nil)
+// handleGetBookmark returns where the TV stopped playing an item, 0 when it didn't
+func (h *Handler) handleGetBookmark(w http.ResponseWriter, r *http.Request, req *XGetBookmarkRequest) {
+	key, ok := h.bookmarkKey(w, r, req.ObjectID)
+	if !ok {
+		return
+	}
+
+	pos, _ := h.Bookmarks.Get(key)
+	h.render(w, "get_bookmark.xml", BookmarkData{req.ObjectID, int64(pos.Seconds())})
 }
 
-func (h *Handler) handleGetCurrentConnectionInfo(w http.ResponseWriter) {
-	h.render(w, "connection_info.xml", nil)
+// bookmarkKey is the bookmark of the item objectID for the renderer asking, a fault when there is no such item
+func (h *Handler) bookmarkKey(w http.ResponseWriter, r *http.Request, objectID string) (bookmark.Key, bool) {
+	id, err := uuid.FromString(objectID)
+	if err == nil {
+		_, err = h.Media.GetEntry(id)
+	}
+	if err != nil {
+		h.soapFault(w, upnpErrNoSuchObject, "No such object")
+		return bookmark.Key{}, false
+	}
+	return bookmark.Key{ID: id, Client: clientHost(r)}, true
 }
 
-func (h *Handler) generateDIDL(files []media.Video, host string) string {
-	var items strings.Builder
+// soapFault answers an action with a UPnP error
+func (h *Handler) soapFault(w http.ResponseWriter, code int, description string) {
+	h.renderWith(w, "soap_fault.xml", SOAPFaultData{code, description}, renderOptions{Status: http.StatusInternalServerError})
+}
 
-	items.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" `)
-	items.WriteString(`xmlns:dc="http://purl.org/dc/elements/1.1/" `)
-	items.WriteString(`xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/" `)
-	items.WriteString(`xmlns:dlna="urn:schemas-dlna-org:metadata-1-0/">`)
+// sourceProtocols is what GetProtocolInfo offers before the configured media types
+var sourceProtocols = []string{
+	"http-get:*:video/mp4:DLNA.ORG_OP=01;DLNA.ORG_FLAGS=01700000000000000000000000000000",
+	"http-get:*:video/x-matroska:DLNA.ORG_OP=01;DLNA.ORG_FLAGS=01700000000000000000000000000000",
+	"http-get:*:video/mpeg:DLNA.ORG_OP=01;DLNA.ORG_FLAGS=01700000000000000000000000000000",
+}
 
-	for _, file := range files {
-		// itemID := fmt.Sprintf("%d", i+1)
-		itemID := file.UUID.String()
+// handleGetProtocolInfo lists the built-in protocols and those of the configured media types
+func (h *Handler) handleGetProtocolInfo(w http.ResponseWriter) {
+	h.render(w, "protocol_info.xml", ProtocolInfoData{h.sourceProtocolInfo()})
+}
 
-		// Use simple /direct/ path - cleaner and works better
-		pathParts := strings.Split(file.Path, "/")
-		for j, part := range pathParts {
-			pathParts[j] = url.PathEscape(part)
+// sourceProtocolInfo is the built-in protocols and those of the configured media types by extension,
+// separated by commas
+func (h *Handler) sourceProtocolInfo() string {
+	protocols := slices.Clone(sourceProtocols)
+	for _, ext := range slices.Sorted(maps.Keys(h.config.MediaTypes)) {
+		t := h.config.MediaTypes[ext]
+		protocol := "http-get:*:" + t.MIME + ":*"
+		if t.DLNAProfile != "" {
+			protocol = "http-get:*:" + t.MIME + ":" + h.dlnaProfile(ext)
+		}
+		if !slices.Contains(protocols, protocol) {
+			protocols = append(protocols, protocol)
 		}
-
-		ext := filepath.Ext(file.Name)
-		streamURL := fmt.Sprintf("http://%s/direct/%s%s", host, file.UUID.String(), ext)
-
-		// Use the host from the request - this matches what Nova expects
-		// streamURL := fmt.Sprintf("http://%s/direct/%s", host, encodedPath)
-
-		fileSize := file.Size
-		mimeType := getMimeType(file.Name)
-
-		// Try without any DLNA profile - just basic HTTP
-		protocolInfo := fmt.Sprintf("http-get:*:%s:*", mimeType)
-
-		displayName := strings.TrimSuffix(file.Name, ext)
-
-		items.WriteString(fmt.Sprintf(`
-	<item id="%s" parentID="0" restricted="1">
-		<dc:title>%s</dc:title>
-		<upnp:class>object.item.videoItem</upnp:class>
-		<res protocolInfo="%s" size="%d">%s</res>
-	</item>`, itemID, escapeXML(displayName), protocolInfo, fileSize, escapeXML(streamURL)))
 	}
+	return strings.Join(protocols, ",")
+}
+
+func (h *Handler) handleGetCurrentConnectionIDs(w http.ResponseWriter) {
+	h.render(w, "connection_ids.xml", nil)
+}
 
-	items.WriteString("\n</DIDL-Lite>")
-	return items.String()
+func (h *Handler) handleGetCurrentConnectionInfo(w http.ResponseWriter) {
+	h.render(w, "connection_info.xml", nil)
 }
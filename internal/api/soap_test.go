@@ -0,0 +1,317 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"streamer/internal/media"
+	"strings"
+	"testing"
+)
+
+// samsungObjectID is the item the Samsung request bodies in testdata are about, the tests put a real one in
+const samsungObjectID = "0195d7a2-5b1c-7c3e-9f00-5a3d2c1b0e42"
+
+// samsungControl posts the Samsung request body in testdata/name to the ContentDirectory control URL
+func samsungControl(t *testing.T, h *Handler, name, objectID, remote string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = bytes.ReplaceAll(body, []byte(samsungObjectID), []byte(objectID))
+
+	action := strings.TrimSuffix(strings.TrimPrefix(name, "samsung_"), ".xml")
+	r := httptest.NewRequest(http.MethodPost, "/content/control", bytes.NewReader(body))
+	r.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	r.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#`+action+`"`)
+	r.Header.Set("User-Agent", "DLNADOC/1.50 SEC_HHP_[TV] Samsung Q7 Series (55)/1.0 UPnP/1.0")
+	r.RemoteAddr = remote
+
+	w := httptest.NewRecorder()
+	h.HandleDummyControl(w, r)
+	return w
+}
+
+func TestSamsungGetFeatureList(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mkv": "x"})
+	w := samsungControl(t, h, "samsung_get_feature_list.xml", "", "192.168.1.50:52000")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var resp struct {
+		FeatureList string `xml:"Body>X_GetFeatureListResponse>FeatureList"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response doesn't parse: %v", err)
+	}
+	// the feature list is a document of its own, escaped into the response
+	var features struct {
+		XMLName xml.Name
+		Feature []struct{} `xml:"Feature"`
+	}
+	if err := xml.Unmarshal([]byte(resp.FeatureList), &features); err != nil {
+		t.Fatalf("FeatureList %q doesn't parse: %v", resp.FeatureList, err)
+	}
+	if features.XMLName.Local != "Features" || features.XMLName.Space != "urn:schemas-upnp-org:av:avs" || len(features.Feature) != 0 {
+		t.Errorf("FeatureList = %q, want an empty Features document", resp.FeatureList)
+	}
+}
+
+func TestSamsungBookmark(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mkv": "x"})
+	id := entryByName(t, h, "Heat.mkv").UUID.String()
+	const tv = "192.168.1.50:52000"
+
+	getBookmark := func(remote string) int64 {
+		t.Helper()
+		w := samsungControl(t, h, "samsung_get_bookmark.xml", id, remote)
+		if w.Code != http.StatusOK {
+			t.Fatalf("X_GetBookmark status = %d: %s", w.Code, w.Body)
+		}
+		var resp struct {
+			ObjectID  string `xml:"Body>X_GetBookmarkResponse>ObjectID"`
+			PosSecond int64  `xml:"Body>X_GetBookmarkResponse>PosSecond"`
+		}
+		if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("X_GetBookmark response doesn't parse: %v", err)
+		}
+		if resp.ObjectID != id {
+			t.Errorf("X_GetBookmark ObjectID = %q, want %q", resp.ObjectID, id)
+		}
+		return resp.PosSecond
+	}
+
+	if got := getBookmark(tv); got != 0 {
+		t.Errorf("PosSecond before any bookmark = %d, want 0", got)
+	}
+
+	w := samsungControl(t, h, "samsung_set_bookmark.xml", id, tv)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "X_SetBookmarkResponse") {
+		t.Fatalf("X_SetBookmark = %d %s, want an X_SetBookmarkResponse", w.Code, w.Body)
+	}
+	if got := getBookmark(tv); got != 2520 {
+		t.Errorf("PosSecond = %d, want 2520", got)
+	}
+	// bookmarks are per renderer
+	if got := getBookmark("192.168.1.51:52000"); got != 0 {
+		t.Errorf("PosSecond of another TV = %d, want 0", got)
+	}
+
+	// the same store as /api/progress, a renderer is known there by its IP too
+	r := httptest.NewRequest(http.MethodGet, "/api/progress/"+id, nil)
+	r.SetPathValue("uuid", id)
+	r.RemoteAddr = tv
+	pw := httptest.NewRecorder()
+	h.HandleProgress(pw, r)
+	var p progress
+	if err := json.Unmarshal(pw.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Position != 2520 {
+		t.Errorf("/api/progress position = %v, want 2520", p.Position)
+	}
+}
+
+func TestSamsungBookmarkNoSuchObject(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mkv": "x"})
+	// after the subtests
+	t.Cleanup(func() {
+		if got := h.Bookmarks.Len(); got != 0 {
+			t.Errorf("Bookmarks.Len() = %d, want 0", got)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		body     string
+		objectID string
+	}{
+		{"fail - set, unknown entry", "samsung_set_bookmark.xml", samsungObjectID},
+		{"fail - get, unknown entry", "samsung_get_bookmark.xml", samsungObjectID},
+		{"fail - set, not one of our ids", "samsung_set_bookmark.xml", "64$0$1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := samsungControl(t, h, tt.body, tt.objectID, "192.168.1.50:52000")
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+			}
+			var fault struct {
+				Code int `xml:"Body>Fault>detail>UPnPError>errorCode"`
+			}
+			if err := xml.Unmarshal(w.Body.Bytes(), &fault); err != nil {
+				t.Fatalf("fault doesn't parse: %v", err)
+			}
+			if fault.Code != upnpErrNoSuchObject {
+				t.Errorf("errorCode = %d, want %d", fault.Code, upnpErrNoSuchObject)
+			}
+		})
+	}
+}
+
+func TestSamsungBookmarkReadOnly(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mkv": "x"})
+	h.config.ReadOnly = true
+	id := entryByName(t, h, "Heat.mkv").UUID.String()
+
+	w := samsungControl(t, h, "samsung_set_bookmark.xml", id, "192.168.1.50:52000")
+	var fault struct {
+		Code int `xml:"Body>Fault>detail>UPnPError>errorCode"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &fault); err != nil {
+		t.Fatalf("fault doesn't parse: %v", err)
+	}
+	if w.Code != http.StatusInternalServerError || fault.Code != upnpErrNotAuthorized {
+		t.Errorf("X_SetBookmark = %d with errorCode %d, want 500 with %d", w.Code, fault.Code, upnpErrNotAuthorized)
+	}
+	if got := h.Bookmarks.Len(); got != 0 {
+		t.Errorf("Bookmarks.Len() = %d, want 0", got)
+	}
+
+	// reading them is no change
+	if w := samsungControl(t, h, "samsung_get_bookmark.xml", id, "192.168.1.50:52000"); w.Code != http.StatusOK {
+		t.Errorf("X_GetBookmark status = %d, want 200", w.Code)
+	}
+}
+
+func TestGetSystemUpdateID(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Films/Heat.mkv": "x", "Films/Ronin.mp4": "x"})
+
+	updateID := func() string {
+		t.Helper()
+
+		body := `<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:GetSystemUpdateID xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1"/></s:Body></s:Envelope>`
+		r := httptest.NewRequest(http.MethodPost, "/content/control", strings.NewReader(body))
+		r.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#GetSystemUpdateID"`)
+		w := httptest.NewRecorder()
+		h.HandleDummyControl(w, r)
+
+		var resp struct {
+			ID string `xml:"Body>GetSystemUpdateIDResponse>Id"`
+		}
+		if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.ID == "" {
+			t.Fatalf("GetSystemUpdateID = %d %q, want an Id: %v", w.Code, w.Body.String(), err)
+		}
+		return resp.ID
+	}
+
+	before := updateID()
+	if again := updateID(); again != before {
+		t.Errorf("Id = %s then %s with the library unchanged, want the same", before, again)
+	}
+
+	heat := entryByName(t, h, "Heat.mkv")
+	h.Media.Registry.Remove(heat.MountID, heat.Path)
+	if after := updateID(); after == before {
+		t.Errorf("Id = %s before and after an entry left, want it to change", after)
+	}
+}
+
+func TestMediaTypes(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Films/Heat.mkv": "x", "Films/Ronin.ts": "0123456789"})
+	h.config.MediaTypes = map[string]MediaType{
+		".ts":  {MIME: "video/vnd.dlna.mpeg-tts", DLNAProfile: "MPEG_TS_HD_NA_ISO"},
+		".mkv": {MIME: "video/x-mkv"},
+	}
+
+	// the .ts file is left out until its extension is added
+	if h.Media.Registry.Len() != 1 {
+		t.Fatalf("%d entries before the .ts extension was added, want 1", h.Media.Registry.Len())
+	}
+	mount, err := h.Media.GetMount(testMountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Media.Registry.AddExtensions(".TS")
+	if err := h.Media.Registry.Scan(testMountID, mount.RootPath); err != nil {
+		t.Fatal(err)
+	}
+	ronin := entryByName(t, h, "Ronin.ts")
+
+	const features = "DLNA.ORG_PN=MPEG_TS_HD_NA_ISO;DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+
+	t.Run("ok - stream headers", func(t *testing.T) {
+		t.Parallel()
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /direct/", h.AdapterDirectStream)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/direct/"+ronin.UUID.String()+".ts", nil))
+
+		if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+			t.Fatalf("GET = %d %q, want 200 and the file", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Type"); got != "video/vnd.dlna.mpeg-tts" {
+			t.Errorf("Content-Type = %q, want video/vnd.dlna.mpeg-tts", got)
+		}
+		if got := w.Header().Get("contentFeatures.dlna.org"); got != features {
+			t.Errorf("contentFeatures.dlna.org = %q, want %q", got, features)
+		}
+	})
+
+	t.Run("ok - didl", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodPost, "http://example.com/content/control", nil)
+		didl := h.generateDIDL(rootID, nil, media.Videos(h.Media.Registry.List()), r)
+		for _, want := range []string{
+			"http-get:*:video/vnd.dlna.mpeg-tts:" + features,
+			"http-get:*:video/x-mkv:*",
+		} {
+			if !strings.Contains(didl, want) {
+				t.Errorf("DIDL has no %q:\n%s", want, didl)
+			}
+		}
+	})
+
+	t.Run("ok - protocol info", func(t *testing.T) {
+		t.Parallel()
+
+		body := `<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:GetProtocolInfo xmlns:u="urn:schemas-upnp-org:service:ConnectionManager:1"/></s:Body></s:Envelope>`
+		r := httptest.NewRequest(http.MethodPost, "/connection/control", strings.NewReader(body))
+		r.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ConnectionManager:1#GetProtocolInfo"`)
+		w := httptest.NewRecorder()
+		h.HandleDummyControl(w, r)
+
+		var resp struct {
+			Source string `xml:"Body>GetProtocolInfoResponse>Source"`
+		}
+		if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("GetProtocolInfo = %d %q: %v", w.Code, w.Body.String(), err)
+		}
+		want := strings.Join(append(slices.Clone(sourceProtocols),
+			"http-get:*:video/x-mkv:*",
+			"http-get:*:video/vnd.dlna.mpeg-tts:"+features,
+		), ",")
+		if resp.Source != want {
+			t.Errorf("Source = %q, want %q", resp.Source, want)
+		}
+	})
+}
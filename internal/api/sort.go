@@ -0,0 +1,108 @@
+package api
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"streamer/internal/media"
+	"strings"
+)
+
+// upnpErrBadSort is the UPnP error for a SortCriteria naming a property Browse can't sort by
+const upnpErrBadSort = 709
+
+// errBadSort is a Browse with a SortCriteria the server can't follow
+var errBadSort = errors.New("unsupported sort criteria")
+
+// sortField is a property Browse sorts children by
+type sortField struct {
+	name    string
+	compare func(c media.Collation, a, b media.Video) int
+	folders bool // folders have it too, the others only sort videos
+}
+
+// sortFields are the properties GetSortCapabilities advertises, in the order it lists them
+var sortFields = []sortField{
+	{"dc:title", func(c media.Collation, a, b media.Video) int { return c.Compare(videoTitle(a), videoTitle(b)) }, true},
+	{"dc:date", func(_ media.Collation, a, b media.Video) int { return a.ModTime.Compare(b.ModTime) }, false},
+	{"res@size", func(_ media.Collation, a, b media.Video) int { return cmp.Compare(a.Size, b.Size) }, false},
+}
+
+// sortCaps is the SortCaps of GetSortCapabilities, the names of sortFields
+func sortCaps() string {
+	names := make([]string, 0, len(sortFields))
+	for _, f := range sortFields {
+		names = append(names, f.name)
+	}
+	return strings.Join(names, ",")
+}
+
+// sortKey is one property of a SortCriteria, descending for a leading -
+type sortKey struct {
+	field *sortField
+	desc  bool
+}
+
+// parseSortCriteria reads a SortCriteria, properties separated by commas each with + or - in front, as
+// in "+dc:title,-dc:date". A property without a sign sorts ascending, an empty criteria keeps the order
+// children come in
+func parseSortCriteria(s string) ([]sortKey, error) {
+	var keys []sortKey
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := sortKey{desc: part[0] == '-'}
+		name := strings.TrimLeft(part, "+-")
+		i := slices.IndexFunc(sortFields, func(f sortField) bool { return f.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("sort by %q: %w", name, errBadSort)
+		}
+		key.field = &sortFields[i]
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sortChildren sorts the children of a folder by keys before they are paged, so every page of a Browse
+// comes from the same order. Folders only sort by the properties they have and still come before videos,
+// ties keep the order children come in
+func sortChildren(folders []container, videos []media.Video, keys []sortKey, c media.Collation) {
+	if len(keys) == 0 {
+		return
+	}
+	slices.SortStableFunc(videos, func(a, b media.Video) int {
+		for _, k := range keys {
+			if n := k.field.compare(c, a, b); n != 0 {
+				return k.sign() * n
+			}
+		}
+		return 0
+	})
+	slices.SortStableFunc(folders, func(a, b container) int {
+		for _, k := range keys {
+			if !k.field.folders {
+				continue
+			}
+			if n := c.Compare(a.Title, b.Title); n != 0 {
+				return k.sign() * n
+			}
+		}
+		return 0
+	})
+}
+
+func (k sortKey) sign() int {
+	if k.desc {
+		return -1
+	}
+	return 1
+}
+
+// videoTitle is the dc:title of v in DIDL-Lite, its name without the extension
+func videoTitle(v media.Video) string {
+	return strings.TrimSuffix(v.Name, filepath.Ext(v.Name))
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"streamer/internal/media"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSortCriteria(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		criteria string
+		want     []string // name, - for descending
+		wantErr  bool
+	}{
+		{"ok - empty", "", nil, false},
+		{"ok - ascending", "+dc:title", []string{"dc:title"}, false},
+		{"ok - descending", "-dc:date", []string{"-dc:date"}, false},
+		{"ok - no sign", "res@size", []string{"res@size"}, false},
+		{"ok - several", "-res@size, +dc:title", []string{"-res@size", "dc:title"}, false},
+		{"ok - trailing comma", "+dc:title,", []string{"dc:title"}, false},
+		{"fail - unknown property", "+upnp:genre", nil, true},
+		{"fail - one of several unknown", "+dc:title,-dc:creator", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			keys, err := parseSortCriteria(tt.criteria)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSortCriteria(%q) error = %v, wantErr %v", tt.criteria, err, tt.wantErr)
+			}
+			var got []string
+			for _, k := range keys {
+				if k.desc {
+					got = append(got, "-"+k.field.name)
+					continue
+				}
+				got = append(got, k.field.name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseSortCriteria(%q) = %q, want %q", tt.criteria, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortChildren(t *testing.T) {
+	t.Parallel()
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	videos := []media.Video{
+		{Name: "Heat.mkv", Size: 300, ModTime: day},
+		{Name: "Ronin.mp4", Size: 100, ModTime: day.Add(48 * time.Hour)},
+		{Name: "alien.mp4", Size: 300, ModTime: day.Add(24 * time.Hour)},
+		{Name: "10 Things.mp4", Size: 200, ModTime: day.Add(48 * time.Hour)},
+	}
+	folders := []container{{ID: "b", Title: "b"}, {ID: "A", Title: "A"}}
+
+	tests := []struct {
+		name        string
+		criteria    string
+		wantVideos  []string
+		wantFolders []string
+	}{
+		{"ok - none", "", []string{"Heat", "Ronin", "alien", "10 Things"}, []string{"b", "A"}},
+		{"ok - title", "+dc:title", []string{"10 Things", "alien", "Heat", "Ronin"}, []string{"A", "b"}},
+		{"ok - title descending", "-dc:title", []string{"Ronin", "Heat", "alien", "10 Things"}, []string{"b", "A"}},
+		{"ok - date", "+dc:date", []string{"Heat", "alien", "Ronin", "10 Things"}, []string{"b", "A"}},
+		{"ok - date descending", "-dc:date", []string{"Ronin", "10 Things", "alien", "Heat"}, []string{"b", "A"}},
+		{"ok - size", "+res@size", []string{"Ronin", "10 Things", "Heat", "alien"}, []string{"b", "A"}},
+		{"ok - size then title", "-res@size,+dc:title", []string{"alien", "Heat", "10 Things", "Ronin"}, []string{"A", "b"}},
+		{"ok - date then size", "-dc:date,-res@size", []string{"10 Things", "Ronin", "alien", "Heat"}, []string{"b", "A"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			keys, err := parseSortCriteria(tt.criteria)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, f := slices.Clone(videos), slices.Clone(folders)
+			sortChildren(f, v, keys, media.CollateLocale)
+
+			var gotVideos, gotFolders []string
+			for _, video := range v {
+				gotVideos = append(gotVideos, videoTitle(video))
+			}
+			for _, c := range f {
+				gotFolders = append(gotFolders, c.Title)
+			}
+			if !slices.Equal(gotVideos, tt.wantVideos) || !slices.Equal(gotFolders, tt.wantFolders) {
+				t.Errorf("sorted %q %q, want %q %q", gotFolders, gotVideos, tt.wantFolders, tt.wantVideos)
+			}
+		})
+	}
+}
+
+func TestBrowseSorted(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Films/Heat.mkv":    "xxx",
+		"Films/Ronin.mp4":   "x",
+		"Films/Speed.mp4":   "xx",
+		"Films/Up.mp4":      "xx",
+		"Films/Old/Ran.mp4": "x",
+	})
+	h.config.Folders = []Folder{FolderCategories}
+
+	tests := []struct {
+		name           string
+		sort           string
+		start, count   int
+		wantFault      int
+		wantContainers []string
+		wantItems      []string
+	}{
+		{"ok - title descending", "-dc:title", 0, 0, 0, []string{"category/Films/Old category/Films 1"},
+			[]string{"Up category/Films", "Speed category/Films", "Ronin category/Films", "Heat category/Films"}},
+		{"ok - size then title", "-res@size,+dc:title", 0, 0, 0, []string{"category/Films/Old category/Films 1"},
+			[]string{"Heat category/Films", "Speed category/Films", "Up category/Films", "Ronin category/Films"}},
+		{"ok - pages of the sorted order", "-res@size,+dc:title", 2, 2, 0, nil,
+			[]string{"Speed category/Films", "Up category/Films"}},
+		{"fail - unsupported", "+upnp:genre", 0, 0, upnpErrBadSort, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := browseSorted(t, h, "category/Films", "BrowseDirectChildren", tt.sort, tt.start, tt.count)
+			if got.fault != tt.wantFault {
+				t.Fatalf("fault = %d, want %d", got.fault, tt.wantFault)
+			}
+			if !slices.Equal(got.containers, tt.wantContainers) || !slices.Equal(got.items, tt.wantItems) {
+				t.Errorf("got %q %q, want %q %q", got.containers, got.items, tt.wantContainers, tt.wantItems)
+			}
+		})
+	}
+}
+
+func TestGetSortCapabilities(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+	w := httptest.NewRecorder()
+	h.handleGetSortCapabilities(w)
+
+	// every property advertised is one Browse sorts by
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<SortCaps>dc:title,dc:date,res@size</SortCaps>") {
+		t.Fatalf("GetSortCapabilities = %d\n%s", w.Code, w.Body.String())
+	}
+	if _, err := parseSortCriteria(sortCaps()); err != nil {
+		t.Errorf("parseSortCriteria(%q) error = %v", sortCaps(), err)
+	}
+}
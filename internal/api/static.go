@@ -0,0 +1,62 @@
+package api
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var staticFS embed.FS
+
+// the assets only change with the binary, browsers keep them for a day and then revalidate by ETag
+const staticCacheControl = "public, max-age=86400"
+
+// newStaticHandler serves the embedded assets under /static/. Embedded files have no modification time,
+// so each gets an ETag from its content instead
+func newStaticHandler() (http.Handler, error) {
+	assets, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		return nil, fmt.Errorf("static assets: %w", err)
+	}
+
+	etags := make(map[string]string)
+	err = fs.WalkDir(assets, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(assets, path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		etags["/"+path] = `"` + hex.EncodeToString(sum[:8]) + `"`
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("static assets: %w", err)
+	}
+
+	files := http.FileServerFS(assets)
+	return http.StripPrefix("/static", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag, ok := etags[r.URL.Path]
+		// no directory listings
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		// ServeContent answers If-None-Match with 304 from this header
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", staticCacheControl)
+		files.ServeHTTP(w, r)
+	})), nil
+}
+
+// HandleStatic serves the css, scripts and icons of the web ui
+func (h *Handler) HandleStatic(w http.ResponseWriter, r *http.Request) {
+	h.static.ServeHTTP(w, r)
+}
@@ -0,0 +1,79 @@
+// with scripts on, the next page of the listing is appended when the end of it comes into view
+(function () {
+    const items = document.getElementById('items');
+    if (!items || !('IntersectionObserver' in window)) return;
+
+    const observer = new IntersectionObserver(entries => {
+        for (const entry of entries) {
+            if (!entry.isIntersecting) continue;
+            const more = entry.target;
+            observer.unobserve(more);
+            fetch(more.dataset.next)
+                .then(resp => resp.text())
+                .then(html => {
+                    more.remove();
+                    items.insertAdjacentHTML('beforeend', html);
+                    watch();
+                });
+        }
+    });
+    const watch = () => {
+        const more = items.querySelector('.more');
+        if (more) observer.observe(more);
+    };
+
+    const next = document.querySelector('.pager .next');
+    if (next) next.hidden = true;
+    watch();
+})();
+
+// the copy buttons need scripts, without them the stream link is still there to copy by hand
+(function () {
+    const show = () => {
+        for (const button of document.querySelectorAll('button.copy[hidden]')) button.hidden = false;
+    };
+    new MutationObserver(show).observe(document.body, { childList: true, subtree: true });
+    show();
+
+    document.addEventListener('click', event => {
+        const button = event.target.closest('button.copy');
+        if (!button) return;
+        const url = button.dataset.url;
+        // the clipboard api is only there on https and localhost, on the LAN the link is offered to copy
+        if (!navigator.clipboard || !window.isSecureContext) {
+            window.prompt('Stream link', url);
+            return;
+        }
+        navigator.clipboard.writeText(url).then(() => {
+            button.textContent = 'copied';
+            setTimeout(() => { button.textContent = 'copy link'; }, 1500);
+        }, () => window.prompt('Stream link', url));
+    });
+})();
+
+// deleting a saved playlist needs scripts for the DELETE request, without them the buttons stay hidden
+(function () {
+    for (const button of document.querySelectorAll('#playlists button.delete')) {
+        button.hidden = false;
+        button.addEventListener('click', () => {
+            if (!window.confirm('Delete this playlist?')) return;
+            fetch(button.dataset.url, { method: 'DELETE' }).then(() => window.location.reload());
+        });
+    }
+})();
+
+// the library changed on the server: an untouched page reloads, one the user is busy with offers it
+(function () {
+    const version = document.body.dataset.version;
+    const notice = document.getElementById('library-changed');
+    if (!version || !notice || !window.EventSource) return;
+
+    const events = new EventSource('/api/events');
+    events.addEventListener('library', event => {
+        if (String(JSON.parse(event.data).version) === version) return;
+        events.close();
+        const busy = window.scrollY > 0 || document.querySelector('input:checked, input:focus');
+        if (busy) notice.hidden = false;
+        else window.location.reload();
+    });
+})();
@@ -0,0 +1,31 @@
+// the player starts where this browser stopped last time and keeps the server posted on the position
+(function () {
+    const video = document.querySelector('video[data-progress]');
+    if (!video) return;
+    const url = video.dataset.progress;
+
+    const resume = parseFloat(video.dataset.resume) || 0;
+    if (resume > 0) {
+        video.addEventListener('loadedmetadata', () => {
+            if (!(resume < video.duration)) return;
+            video.currentTime = resume;
+        }, { once: true });
+    }
+
+    // keepalive lets the last save through when the page is closed
+    const save = position => fetch(url, {
+        method: 'POST',
+        body: new URLSearchParams({ position: position.toFixed(1) }),
+        keepalive: true,
+    }).catch(() => {});
+
+    let saved = resume;
+    video.addEventListener('timeupdate', () => {
+        if (Math.abs(video.currentTime - saved) < 10) return;
+        saved = video.currentTime;
+        save(saved);
+    });
+    video.addEventListener('pause', () => { if (!video.ended) save(video.currentTime); });
+    // watched to the end, the next visit starts from the beginning
+    video.addEventListener('ended', () => save(0));
+})();
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleStatic(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantCT   string
+	}{
+		{"ok - css", "/static/style.css", http.StatusOK, "text/css; charset=utf-8"},
+		{"ok - script", "/static/list.js", http.StatusOK, "text/javascript; charset=utf-8"},
+		{"ok - icon", "/static/favicon.svg", http.StatusOK, "image/svg+xml"},
+		{"fail - missing", "/static/missing.css", http.StatusNotFound, ""},
+		{"fail - no listing", "/static/", http.StatusNotFound, ""},
+		{"fail - outside the assets", "/static/../handlers.go", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			h.HandleStatic(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, rec.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != tt.wantCT {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.wantCT)
+			}
+			if cc := rec.Header().Get("Cache-Control"); cc != staticCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", cc, staticCacheControl)
+			}
+			if rec.Body.Len() == 0 {
+				t.Error("empty body")
+			}
+		})
+	}
+}
+
+func TestHandleStaticETag(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+
+	rec := httptest.NewRecorder()
+	h.HandleStatic(rec, httptest.NewRequest(http.MethodGet, "/static/style.css", nil))
+	etag := rec.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) || len(etag) < 3 {
+		t.Fatalf("ETag = %q, want a quoted tag", etag)
+	}
+	if !strings.Contains(rec.Body.String(), ".video-item") {
+		t.Error("style.css does not style the listing")
+	}
+
+	// a browser revalidating its cached copy gets a 304 without a body
+	req := httptest.NewRequest(http.MethodGet, "/static/style.css", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h.HandleStatic(rec, req)
+
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d, want 304", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("304 with a body of %d bytes", rec.Body.Len())
+	}
+}
+
+func TestPagesUseStaticAssets(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mp4": "x"})
+
+	rec := httptest.NewRecorder()
+	h.HandleWeb(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := rec.Body.String()
+
+	for _, ref := range []string{`href="/static/style.css"`, `src="/static/list.js" defer`, `href="/static/favicon.svg"`} {
+		if !strings.Contains(body, ref) {
+			t.Errorf("index.html does not reference %s", ref)
+		}
+	}
+	if strings.Contains(body, "<style>") {
+		t.Error("index.html still inlines its styles")
+	}
+}
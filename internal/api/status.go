@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ShutdownStatus describes the shutdown schedule and an upcoming automatic shutdown
+type ShutdownStatus struct {
+	Scheduled     time.Time `json:"scheduled,omitzero"` // sleep timer / shutdown.at, zero if none
+	InactiveLimit string    `json:"inactive_limit"`
+	Pending       bool      `json:"pending"` // the warning phase is running
+	Reason        string    `json:"reason,omitempty"`
+	At            time.Time `json:"at,omitzero"`
+}
+
+// ShutdownController is implemented by whatever decides when the server stops
+type ShutdownController interface {
+	ShutdownStatus() ShutdownStatus
+	Reschedule(at time.Time)
+	CancelShutdown()
+}
+
+type statusResponse struct {
+	FriendlyName  string         `json:"friendly_name"`
+	UUID          string         `json:"uuid"`
+	Address       string         `json:"address,omitempty"`
+	Entries       int            `json:"entries"`
+	ActiveStreams int            `json:"active_streams"`
+	Shutdown      ShutdownStatus `json:"shutdown"`
+	Volumes       []statusVolume `json:"volumes"`
+	Sessions      []Session      `json:"sessions"` // the streams in flight, oldest first
+}
+
+// statusVolume is a volume as of its last scan, the disk fields are missing when its space is unknown
+type statusVolume struct {
+	ID           string         `json:"id"`
+	Path         string         `json:"path"`
+	Entries      int            `json:"entries"`
+	LibraryBytes int64          `json:"library_bytes"`
+	TotalBytes   int64          `json:"total_bytes,omitempty"`
+	FreeBytes    *int64         `json:"free_bytes,omitempty"` // a full disk has 0
+	Offline      bool           `json:"offline,omitempty"`    // its root can't be reached, its entries aren't listed
+	Waiting      map[string]int `json:"waiting,omitempty"`    // reads waiting for an io slot by priority
+}
+
+// volumeStatus returns every volume by ID as of its last scan
+func (h *Handler) volumeStatus() []statusVolume {
+	counts := h.Media.Registry.CountByMount()
+	scans := h.Media.VolumeScans()
+
+	volumes := make([]statusVolume, 0, len(h.Media.Volumes))
+	for _, id := range slices.Sorted(maps.Keys(h.Media.Volumes)) {
+		vol := h.Media.Volumes[id]
+		v := statusVolume{ID: id, Path: vol.RootPath, Entries: counts[id], Offline: h.Media.Registry.Offline(id)}
+		v.Waiting = map[string]int{}
+		for p, n := range vol.Limiter.Waiting() {
+			v.Waiting[p.String()] = n
+		}
+		if scan, ok := scans[id]; ok {
+			v.LibraryBytes = scan.Library
+			if scan.DiskErr == nil {
+				v.TotalBytes = scan.Disk.Total
+				v.FreeBytes = &scan.Disk.Free
+			}
+		}
+		volumes = append(volumes, v)
+	}
+	return volumes
+}
+
+// SetAddress records the advertised address for /api/status, it must be called before serving
+func (h *Handler) SetAddress(addr string) {
+	h.config.Address = addr
+}
+
+func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	resp := statusResponse{
+		FriendlyName:  h.config.FriendlyName,
+		UUID:          h.config.UUID,
+		Address:       h.config.Address,
+		Entries:       len(h.Media.Registry.List()),
+		ActiveStreams: h.ActiveStreams(),
+		Volumes:       h.volumeStatus(),
+		Sessions:      h.Sessions(),
+	}
+
+	if h.Shutdown != nil {
+		resp.Shutdown = h.Shutdown.ShutdownStatus()
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleStats summarises the library as JSON for dashboards: entries by volume and category, total bytes,
+// the largest and the newest file
+func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.Media.Registry.Stats())
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		// headers are gone already, nothing left to tell the client
+		h.logger.Debug("error encoding json response", "err", err)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleStats(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Heat.mkv":     "0123456789",
+		"Action/Ronin.mp4":    "0123",
+		"Comedy/Airplane.m4v": "01",
+	})
+
+	rec := httptest.NewRecorder()
+	h.HandleStats(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("GET /api/stats = %d %q, want 200 json", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var got struct {
+		Entries    int            `json:"entries"`
+		Bytes      int64          `json:"bytes"`
+		ByVolume   map[string]int `json:"by_volume"`
+		ByCategory map[string]int `json:"by_category"`
+		Largest    struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			Size int64  `json:"size"`
+		} `json:"largest"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+
+	if got.Entries != 3 || got.Bytes != 16 {
+		t.Errorf("stats = %d entries of %d bytes, want 3 of 16", got.Entries, got.Bytes)
+	}
+	if want := map[string]int{testMountID: 3}; !maps.Equal(got.ByVolume, want) {
+		t.Errorf("by_volume = %v, want %v", got.ByVolume, want)
+	}
+	if want := map[string]int{"Action": 2, "Comedy": 1}; !maps.Equal(got.ByCategory, want) {
+		t.Errorf("by_category = %v, want %v", got.ByCategory, want)
+	}
+	if heat := entryByName(t, h, "Heat.mkv"); got.Largest.ID != heat.UUID.String() || got.Largest.Size != 10 {
+		t.Errorf("largest = %+v, want Heat.mkv", got.Largest)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"streamer/internal/observability"
 	"strings"
 
 	"github.com/gofrs/uuid/v5"
@@ -40,6 +39,24 @@ func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// one part of a film split over several files, counted from 1
+	if s := r.URL.Query().Get("part"); s != "" {
+		n, _ := strconv.Atoi(s)
+		part, ok := entry.Part(n)
+		if !ok {
+			http.Error(w, "no such part", http.StatusNotFound)
+			return
+		}
+		entry = &part
+	}
+
+	// refuse new streams once shutdown has started draining
+	w, end, ok := h.beginStream(w, r, entry, "stream")
+	if !ok {
+		return
+	}
+	defer end()
+
 	mount, err := h.Media.GetMount(entry.MountID)
 	if err != nil {
 		h.logger.Error("volume missing for entry", "vol_id", entry.MountID, "entry_id", id)
@@ -47,15 +64,16 @@ func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//  IO slot is available (will use semaphore)
-	if err := mount.Limiter.TryAcquire(r.Context()); err != nil {
+	//  IO slot is available (will use semaphore), per client when the volume is fair
+	client := clientHost(r)
+	if err := mount.Limiter.AcquirePriority(r.Context(), client, h.priority(r)); err != nil {
 		h.logger.Warn("IO limiter reached", "id", id)
 		http.Error(w, "server too busy", http.StatusServiceUnavailable)
 		return
 	}
-	defer mount.Limiter.Release()
+	defer mount.Limiter.ReleaseClient(client)
 
-	resource, err := h.Media.OpenResource(entry)
+	resource, err := h.Media.OpenResource(entry, rangeLength(r))
 	if err != nil {
 		h.logger.Error("opening resource", "path", entry.Path, "err", err)
 		http.Error(w, "file access error", http.StatusInternalServerError)
@@ -63,8 +81,12 @@ func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
 	}
 	defer resource.Close()
 
+	// read ahead while the headers go out, within the io slot held above
+	timed, finish := h.warmUp(r, resource)
+	defer finish()
+
 	// Get mime type and DLNA profile
-	mimeType := getMimeType(resource.Name())
+	mimeType := h.mimeType(resource.Name())
 
 	// Set DLNA/UPnP headers BEFORE calling ServeContent
 	w.Header().Set("Content-Type", mimeType)
@@ -72,12 +94,10 @@ func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
 
 	// is not here, browser will attempt to download content instead of playing
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, resource.Name()))
-
-	// Some clients need explicit content length
-	w.Header().Set("Content-Length", strconv.FormatInt(resource.Size(), 10))
+	setETag(w, entry, resource)
 
 	if isDLNAClient(r) {
-		dlnaProfile := getDLNAProfile(resource.Name())
+		dlnaProfile := h.dlnaProfile(resource.Name())
 		// DLNA headers
 		w.Header().Set("transferMode.dlna.org", "Streaming")
 		w.Header().Set("contentFeatures.dlna.org", dlnaProfile)
@@ -93,11 +113,12 @@ func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
 		"mime_type", mimeType,
 	)
 
-	observability.ActiveStreams.Inc()
-	defer observability.ActiveStreams.Dec()
+	active := h.metrics.ActiveStreams.WithLabelValues("stream")
+	active.Inc()
+	defer active.Dec()
 
 	// Let ServeContent handle range requests and actual streaming
-	http.ServeContent(w, r, resource.Name(), resource.ModTime(), resource)
+	serveResource(w, r, timed)
 }
 
 // isDLNAClient checks if the request is from a DLNA/UPnP device
@@ -134,3 +155,40 @@ func isDLNAClient(r *http.Request) bool {
 	}
 	return false
 }
+
+// rangeLength is how many bytes the Range header of r asks for, 0 without one or when a range runs to the end
+// of the file. Buffered resources size their buffer by it, a header that doesn't parse is ServeContent's
+// business
+func rangeLength(r *http.Request) int64 {
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok {
+		return 0
+	}
+
+	var total int64
+	for ra := range strings.SplitSeq(spec, ",") {
+		first, last, ok := strings.Cut(strings.TrimSpace(ra), "-")
+		if !ok {
+			return 0
+		}
+		if first == "" {
+			// a suffix, the last n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return 0
+			}
+			total += n
+			continue
+		}
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil {
+			return 0
+		}
+		end, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0
+		}
+		total += end - start + 1
+	}
+	return total
+}
@@ -0,0 +1,423 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"streamer/internal/media"
+	"streamer/internal/middleware"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRangeLength(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		rng  string
+		want int64
+	}{
+		{"ok - no range", "", 0},
+		{"ok - closed range", "bytes=0-65535", 64 << 10},
+		{"ok - single byte", "bytes=100-100", 1},
+		{"ok - suffix", "bytes=-500", 500},
+		{"ok - to the end", "bytes=1000-", 0},
+		{"ok - several ranges add up", "bytes=0-99, 200-299", 200},
+		{"ok - one range to the end makes it unknown", "bytes=0-99,200-", 0},
+		{"fail - other unit", "items=0-10", 0},
+		{"fail - reversed", "bytes=10-0", 0},
+		{"fail - garbage", "bytes=a-b", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest("GET", "/direct/x.mp4", nil)
+			if tt.rng != "" {
+				r.Header.Set("Range", tt.rng)
+			}
+			if got := rangeLength(r); got != tt.want {
+				t.Errorf("rangeLength(%q) = %d, want %d", tt.rng, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamParts(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Heat CD1.mkv":  "first half",
+		"Action/Heat CD2.mkv":  "second half",
+		"Action/Ronin CD1.mpg": "0123",
+		"Action/Ronin CD2.mpg": "4567",
+	})
+	heat := entryByName(t, h, "Heat.mkv").UUID.String()
+	ronin := entryByName(t, h, "Ronin.mpg").UUID.String()
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		want     string
+	}{
+		{"ok - the entry plays its first part", "id=" + heat, http.StatusOK, "first half"},
+		{"ok - first part", "id=" + heat + "&part=1", http.StatusOK, "first half"},
+		{"ok - second part", "id=" + heat + "&part=2", http.StatusOK, "second half"},
+		{"ok - mpeg parts stream as one", "id=" + ronin, http.StatusOK, "01234567"},
+		{"ok - a range across the parts", "id=" + ronin + "&range=2-5", http.StatusPartialContent, "2345"},
+		{"fail - no such part", "id=" + heat + "&part=3", http.StatusNotFound, ""},
+		{"fail - not a number", "id=" + heat + "&part=two", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			query, rng, _ := strings.Cut(tt.query, "&range=")
+			r := httptest.NewRequest(http.MethodGet, "/stream?"+query, nil)
+			if rng != "" {
+				r.Header.Set("Range", "bytes="+rng)
+			}
+			rec := httptest.NewRecorder()
+			h.Stream(rec, r)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET /stream?%s status = %d, want %d", tt.query, rec.Code, tt.wantCode)
+			}
+			if tt.want != "" && rec.Body.String() != tt.want {
+				t.Errorf("GET /stream?%s streamed %q, want %q", tt.query, rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamSizeUnknown(t *testing.T) {
+	t.Parallel()
+
+	// a server streaming something live, with no length and no ranges
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "live ")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "from elsewhere")
+	}))
+	t.Cleanup(upstream.Close)
+
+	h := newTestHandler(t, map[string]string{"Live/Channel.strm": upstream.URL + "/channel.mp4"})
+	entry := entryByName(t, h, "Channel.mp4")
+
+	rec := httptest.NewRecorder()
+	h.Stream(rec, httptest.NewRequest(http.MethodGet, "/stream?id="+entry.UUID.String(), nil))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "live from elsewhere" {
+		t.Fatalf("GET /stream status = %d body %q, want 200 with the upstream body", rec.Code, rec.Body.String())
+	}
+	for _, header := range []string{"Content-Length", "Accept-Ranges"} {
+		if got := rec.Header().Get(header); got != "" {
+			t.Errorf("%s = %q, want none", header, got)
+		}
+	}
+
+	didl := h.generateDIDL(rootID, nil, []media.Video{{UUID: entry.UUID, Name: entry.Name, Path: entry.Path}}, httptest.NewRequest(http.MethodPost, "http://example.com/content/control", nil))
+	if strings.Contains(didl, "size=") {
+		t.Errorf("DIDL of a size-less entry has a size:\n%s", didl)
+	}
+}
+
+func TestStreamValidators(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Action/Heat.mp4": "0123456789"})
+	entry := entryByName(t, h, "Heat.mp4")
+	if entry.ETag == "" {
+		t.Fatal("entry has no ETag")
+	}
+	id := entry.UUID.String()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stream", h.Stream)
+	mux.HandleFunc("GET /direct/", h.AdapterDirectStream)
+	mux.HandleFunc("GET /download/{uuid}", h.HandleDownload)
+
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		wantCode int
+		wantBody string
+	}{
+		{"ok - if-range matching resumes", "If-Range", entry.ETag, http.StatusPartialContent, "6789"},
+		{"ok - if-range stale starts over", "If-Range", `"stale"`, http.StatusOK, "0123456789"},
+		{"ok - if-none-match matching", "If-None-Match", entry.ETag, http.StatusNotModified, ""},
+		{"ok - if-none-match stale", "If-None-Match", `"stale"`, http.StatusPartialContent, "6789"},
+	}
+
+	for _, path := range []string{"/stream?id=" + id, "/direct/" + id + ".mp4", "/download/" + id} {
+		for _, tt := range tests {
+			t.Run(path+" "+tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				r := httptest.NewRequest(http.MethodGet, path, nil)
+				r.Header.Set("Range", "bytes=6-")
+				r.Header.Set(tt.header, tt.value)
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, r)
+
+				if rec.Code != tt.wantCode || rec.Body.String() != tt.wantBody {
+					t.Errorf("GET %s with %s %s = %d %q, want %d %q", path, tt.header, tt.value, rec.Code, rec.Body.String(), tt.wantCode, tt.wantBody)
+				}
+				if got := rec.Header().Get("ETag"); got != entry.ETag {
+					t.Errorf("ETag = %q, want %q", got, entry.ETag)
+				}
+			})
+		}
+	}
+}
+
+func TestStreamGrownFile(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mp4": "0123456789"})
+	entry := entryByName(t, h, "Heat.mp4")
+	mount, err := h.Media.GetMount(testMountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the copy went on after the scan took the file
+	f, err := os.OpenFile(filepath.Join(mount.RootPath, "Heat.mp4"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("abc"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stream", h.Stream)
+	mux.HandleFunc("GET /direct/", h.AdapterDirectStream)
+	mux.HandleFunc("GET /download/{uuid}", h.HandleDownload)
+
+	id := entry.UUID.String()
+	for _, path := range []string{"/stream?id=" + id, "/direct/" + id + ".mp4", "/download/" + id} {
+		t.Run(path, func(t *testing.T) {
+			t.Parallel()
+
+			// a player resuming with the tag of the scan gets the file as it is now, from the start
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.Header.Set("Range", "bytes=6-")
+			r.Header.Set("If-Range", entry.ETag)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, r)
+
+			if rec.Code != http.StatusOK || rec.Body.String() != "0123456789abc" || rec.Header().Get("Content-Length") != "13" {
+				t.Errorf("GET %s = %d %q length %s, want the 13 bytes now there", path, rec.Code, rec.Body.String(), rec.Header().Get("Content-Length"))
+			}
+			if got := rec.Header().Get("ETag"); got != "" {
+				t.Errorf("ETag = %q, want none for a file that changed since the scan", got)
+			}
+		})
+	}
+}
+
+// cancelAfterWrite is a response whose client goes away once the first bytes reached it
+type cancelAfterWrite struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w cancelAfterWrite) Write(p []byte) (int, error) {
+	defer w.cancel()
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestStreamClientGone(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		mode media.ResourceMode
+	}{
+		{"ok - direct", media.ModeFileDirect},
+		{"ok - buffered", media.ModeFileBuffered},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// large enough for ServeContent to copy it in many reads
+			h := newTestHandler(t, map[string]string{"Action/Heat.mp4": strings.Repeat("x", 4<<20)})
+			h.Media.Mode = tt.mode
+			id := entryByName(t, h, "Heat.mp4").UUID.String()
+			mount, err := h.Media.GetMount(testMountID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			r := httptest.NewRequestWithContext(ctx, http.MethodGet, "/stream?id="+id, nil)
+			w := cancelAfterWrite{httptest.NewRecorder(), cancel}
+
+			start := time.Now()
+			h.Stream(w, r)
+
+			if got := w.Body.Len(); got >= 4<<20 {
+				t.Errorf("streamed all %d bytes to a client that went away", got)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Stream() returned after %v, want it to stop at the next read", elapsed)
+			}
+			if mount.Limiter.InUse() != 0 {
+				t.Errorf("%d io slots held after the stream returned", mount.Limiter.InUse())
+			}
+		})
+	}
+}
+
+func TestStreamVolumeOffline(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Action/Heat.mp4": "0123456789"})
+	id := entryByName(t, h, "Heat.mp4").UUID.String()
+	h.Media.Registry.SetOffline(testMountID, true)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stream", h.Stream)
+	mux.HandleFunc("GET /direct/", h.AdapterDirectStream)
+	mux.HandleFunc("GET /download/{uuid}", h.HandleDownload)
+
+	for _, path := range []string{"/stream?id=" + id, "/direct/" + id + ".mp4", "/download/" + id} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if want := "volume " + testMountID + " is offline\n"; rec.Code != http.StatusServiceUnavailable || rec.Body.String() != want {
+			t.Errorf("GET %s = %d %q, want 503 %q", path, rec.Code, rec.Body.String(), want)
+		}
+	}
+	if got := browse(t, h, rootID, "BrowseDirectChildren", 0, 0); got.total != 0 {
+		t.Errorf("Browse lists %d entries of an offline volume, want none", got.total)
+	}
+
+	// back, as it was
+	h.Media.Registry.SetOffline(testMountID, false)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream?id="+id, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Errorf("GET /stream = %d %q once the volume is back, want 200 with the file", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStreamMultiRange(t *testing.T) {
+	t.Parallel()
+
+	// what VLC asks for, the head of the file and a block a megabyte in
+	const ranges = "bytes=0-1023,1048576-1049599"
+	content := make([]byte, 2<<20)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	wantParts := []struct {
+		start, end int
+	}{{0, 1023}, {1048576, 1049599}}
+
+	tests := []struct {
+		name      string
+		mode      media.ResourceMode
+		path      func(id string) string
+		userAgent string
+	}{
+		{"ok - stream direct", media.ModeFileDirect, func(id string) string { return "/stream?id=" + id }, ""},
+		{"ok - stream buffered", media.ModeFileBuffered, func(id string) string { return "/stream?id=" + id }, ""},
+		{"ok - direct to a renderer", media.ModeFileDirect, func(id string) string { return "/direct/" + id + ".mp4" }, "VLC/3.0.20 LibVLC/3.0.20"},
+		{"ok - buffered to a renderer", media.ModeFileBuffered, func(id string) string { return "/direct/" + id + ".mp4" }, "VLC/3.0.20 LibVLC/3.0.20"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := newTestHandler(t, map[string]string{"Action/Heat.mp4": string(content)})
+			h.Media.Mode = tt.mode
+			id := entryByName(t, h, "Heat.mp4").UUID.String()
+
+			// the stack the server puts in front of streams
+			mux := http.NewServeMux()
+			mux.HandleFunc("/stream", h.Stream)
+			mux.HandleFunc("/direct/", h.AdapterDirectStream)
+			handler := middleware.Chain(mux,
+				middleware.WithObservability(h.metrics),
+				middleware.WithLogging(h.logger),
+				middleware.WithHEAD,
+				middleware.WithStreamTracking(nil),
+			)
+			srv := httptest.NewServer(handler)
+			t.Cleanup(srv.Close)
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL+tt.path(id), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Range", ranges)
+			req.Header.Set("User-Agent", tt.userAgent)
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("read body: %v", err)
+			}
+
+			if resp.StatusCode != http.StatusPartialContent {
+				t.Fatalf("status = %d, want 206", resp.StatusCode)
+			}
+			if resp.ContentLength != int64(len(body)) {
+				t.Errorf("Content-Length = %d, the body has %d bytes", resp.ContentLength, len(body))
+			}
+			mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+			if err != nil || mediaType != "multipart/byteranges" {
+				t.Fatalf("Content-Type = %q, want multipart/byteranges", resp.Header.Get("Content-Type"))
+			}
+
+			mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+			for i, want := range wantParts {
+				part, err := mr.NextPart()
+				if err != nil {
+					t.Fatalf("part %d: %v", i, err)
+				}
+				if got := part.Header.Get("Content-Type"); got != "video/mp4" {
+					t.Errorf("part %d Content-Type = %q, want video/mp4", i, got)
+				}
+				wantRange := fmt.Sprintf("bytes %d-%d/%d", want.start, want.end, len(content))
+				if got := part.Header.Get("Content-Range"); got != wantRange {
+					t.Errorf("part %d Content-Range = %q, want %q", i, got, wantRange)
+				}
+				data, err := io.ReadAll(part)
+				if err != nil {
+					t.Fatalf("read part %d: %v", i, err)
+				}
+				if !bytes.Equal(data, content[want.start:want.end+1]) {
+					t.Errorf("part %d has %d bytes, not bytes %d-%d of the file", i, len(data), want.start, want.end)
+				}
+			}
+			if _, err := mr.NextPart(); err != io.EOF {
+				t.Errorf("after the last part: %v, want io.EOF", err)
+			}
+			if got := resp.Header.Get("Content-Range"); got != "" {
+				t.Errorf("Content-Range = %q on a multipart answer", got)
+			}
+		})
+	}
+}
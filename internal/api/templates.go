@@ -0,0 +1,151 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"maps"
+	"slices"
+	"text/template"
+	"time"
+)
+
+// the data of the XML templates, one type per template so the handlers rendering them and the golden
+// tests share a contract. The templates not listed here render nil
+
+// DeviceDescriptionData is what device_description.xml renders
+type DeviceDescriptionData struct {
+	UUID         string
+	BaseURL      string // the service URLs start with it, no trailing slash
+	FriendlyName string
+}
+
+// BrowseResponseData is what browse_response.xml renders
+type BrowseResponseData struct {
+	Result         string // the DIDL-Lite, already escaped to be embedded
+	NumberReturned int
+	TotalMatches   int
+	UpdateID       uint64 // the library version, as GetSystemUpdateID answers
+}
+
+// ProtocolInfoData is what protocol_info.xml renders
+type ProtocolInfoData struct {
+	Source string // the protocolInfo of every type served, comma separated
+}
+
+// SortCapsData is what sort_caps.xml renders
+type SortCapsData struct {
+	Caps string // the properties Browse sorts by, separated by commas
+}
+
+// PropertySetData is what propertyset.xml renders, the body of a GENA NOTIFY
+type PropertySetData struct {
+	Properties []EventProperty
+}
+
+// EventProperty is an evented state variable and its value
+type EventProperty struct {
+	Name  string
+	Value string
+}
+
+// SystemUpdateIDData is what system_update_id.xml renders
+type SystemUpdateIDData struct {
+	ID uint64 // the library version
+}
+
+// BookmarkData is what get_bookmark.xml renders
+type BookmarkData struct {
+	ObjectID  string
+	PosSecond int64
+}
+
+// SOAPFaultData is what soap_fault.xml renders
+type SOAPFaultData struct {
+	Code        int
+	Description string
+}
+
+// templateSamples are the required templates, each with data of the type it's rendered with. NewHandler
+// executes every one against its samples, so a template using a field its data doesn't have fails at
+// startup rather than when the first TV asks for it. Templates with branches get a sample for each, a
+// branch that never runs isn't checked
+var templateSamples = map[string][]any{
+	"content_scpd.xml":       {nil},
+	"connection_scpd.xml":    {nil},
+	"device_description.xml": {DeviceDescriptionData{UUID: "uuid:sample", BaseURL: "http://sample:8081", FriendlyName: "Tom & Jerry's"}},
+	"browse_response.xml":    {BrowseResponseData{Result: html.EscapeString(sampleDIDL), NumberReturned: 1, TotalMatches: 3, UpdateID: 1}},
+	"protocol_info.xml":      {ProtocolInfoData{Source: "http-get:*:video/mp4:*"}},
+	"search_caps.xml":        {nil},
+	"sort_caps.xml":          {SortCapsData{Caps: "dc:title,dc:date,res@size"}},
+	"system_update_id.xml":   {SystemUpdateIDData{ID: 1}},
+	"propertyset.xml": {PropertySetData{Properties: []EventProperty{
+		{Name: "SystemUpdateID", Value: "1"}, {Name: "ContainerUpdateIDs", Value: "all,1,category/Tom & Jerry,1"},
+	}}},
+	"connection_ids.xml":  {nil},
+	"connection_info.xml": {nil},
+	"feature_list.xml":    {nil},
+	"set_bookmark.xml":    {nil},
+	"get_bookmark.xml":    {BookmarkData{ObjectID: "sample", PosSecond: 60}},
+	"soap_fault.xml":      {SOAPFaultData{Code: upnpErrNoSuchObject, Description: "No such object"}},
+	"index.html":          {sampleWebPage(viewList), sampleWebPage(viewGrid), webPage{Query: "nothing", View: viewList, Sort: "name"}},
+	"watch.html": {watchPage{
+		Title: "Sample", Category: "Films", FileName: "Sample.mkv", Size: "1.0 GB", ModTime: time.Unix(0, 0),
+		Source: "/stream", MimeType: "video/mp4", BackURL: "/", DownloadURL: "/download", ProgressURL: "/api/progress",
+		Parts: []webLink{{Label: "1", URL: "/watch", Selected: true}},
+		Prev:  &webLink{Label: "Prev", URL: "/watch"}, Next: &webLink{Label: "Next", URL: "/watch"},
+	}},
+	"files.html": {filesPage{Path: "/files/vol_0/", ParentURL: "/files/", Entries: []fileListing{
+		{Name: "Films", Dir: true, URL: "/files/vol_0/Films/"},
+		{Name: "Sample.mkv", Size: 1, URL: "/files/vol_0/Sample.mkv", SizeLabel: "1 B"},
+	}}},
+	"admin.html": {
+		adminPage{
+			FriendlyName: "Sample", Shutdown: ShutdownStatus{Pending: true, At: time.Unix(0, 0)}, ShutdownIn: time.Minute,
+			Streams:     []adminStream{{Title: "Sample", Client: "10.0.0.2", Kind: "stream", Started: time.Unix(0, 0), Sent: "1 B"}},
+			Volumes:     []adminVolume{{ID: "vol_0", Path: "/media", Entries: 1, Max: 4, Library: "1 B", Free: "1 GB"}},
+			Entries:     1,
+			ScanRunning: time.Second,
+			Rejections:  []rejection{{At: time.Unix(0, 0), Client: "10.0.0.2", Method: "GET", Path: "/", Status: 503}},
+		},
+		adminPage{FriendlyName: "Sample", Shutdown: ShutdownStatus{Scheduled: time.Unix(0, 0)}, LastScan: time.Unix(0, 0), Volumes: []adminVolume{{ID: "vol_0"}}},
+		adminPage{FriendlyName: "Sample"},
+	},
+}
+
+// sampleDIDL is the Result of the browse_response.xml sample before escaping, one item of three
+const sampleDIDL = `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">` +
+	`<item id="sample" parentID="0" restricted="1"><dc:title>Tom &amp; Jerry</dc:title><upnp:class>object.item.videoItem</upnp:class>` +
+	`<res protocolInfo="http-get:*:video/mp4:*">http://sample:8081/direct/sample.mp4</res></item></DIDL-Lite>`
+
+// sampleWebPage is a page of the library shown as view, with every link set
+func sampleWebPage(view string) webPage {
+	link := webLink{Label: "Sample", Count: 1, URL: "/", Selected: true}
+	return webPage{
+		Items: []VideoItem{{
+			Name: "Sample", Category: "Films", EncodedPath: "sample", Size: "1.0 GB", URL: "/stream", WatchURL: "/watch",
+			StreamURL: "http://sample:8081/stream", DownloadURL: "/download", ThumbURL: "/thumb",
+		}},
+		Category: "Films", Query: "sample", Sort: "newest", View: view, Page: 2, Pages: 3, Size: 1, Total: 3,
+		PrevURL: "/", NextURL: "/", NextItemURL: "/web/items",
+		Categories: []webLink{link}, AllURL: "/", Sorts: []webLink{link}, Views: []webLink{link},
+		Playlists: []webPlaylist{{Name: "Sample", Count: 1, URL: "/playlist", DeleteURL: "/api/playlists"}},
+		Version:   1,
+	}
+}
+
+// checkTemplates makes sure every required template is there and executes against its samples
+func checkTemplates(tmpls map[string]*template.Template) error {
+	for _, name := range slices.Sorted(maps.Keys(templateSamples)) {
+		tmpl, ok := tmpls[name]
+		if !ok {
+			return fmt.Errorf("missing required template: %s", name)
+		}
+		for _, sample := range templateSamples[name] {
+			if err := tmpl.Execute(io.Discard, sample); err != nil {
+				return fmt.Errorf("template %s with %T: %w", name, sample, err)
+			}
+		}
+	}
+	return nil
+}
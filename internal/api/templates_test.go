@@ -0,0 +1,276 @@
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCheckTemplates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		edit    func(tmpls map[string]*template.Template)
+		wantErr string
+	}{
+		{"ok - shipped templates", func(map[string]*template.Template) {}, ""},
+		{"fail - missing template", func(tmpls map[string]*template.Template) {
+			delete(tmpls, "soap_fault.xml")
+		}, "missing required template: soap_fault.xml"},
+		{"fail - field the data lacks", func(tmpls map[string]*template.Template) {
+			tmpls["browse_response.xml"] = template.Must(template.New("browse_response.xml").Parse("<Result>{{.Results}}</Result>"))
+		}, "template browse_response.xml with api.BrowseResponseData"},
+		{"fail - field in a branch", func(tmpls map[string]*template.Template) {
+			tmpls["index.html"] = template.Must(template.New("index.html").Parse(`{{if eq .View "grid"}}{{.Poster}}{{end}}`))
+		}, "template index.html with api.webPage"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpls, err := loadTemplates(templateFS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(tmpls)
+
+			err = checkTemplates(tmpls)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkTemplates() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("checkTemplates() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderFailure(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+	var logs bytes.Buffer
+	h.logger = slog.New(slog.NewTextHandler(&logs, nil))
+	// fails after it wrote the start of the document
+	h.templates["get_bookmark.xml"] = template.Must(template.New("get_bookmark.xml").Parse(`<?xml version="1.0"?><s:Envelope>{{.Position}}`))
+
+	w := httptest.NewRecorder()
+	h.render(w, "get_bookmark.xml", BookmarkData{ObjectID: "x", PosSecond: 1})
+
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "Envelope") {
+		t.Errorf("render = %d %q, want a 500 without the partial XML", w.Code, w.Body.String())
+	}
+	if got := testutil.ToFloat64(h.metrics.TemplateFailures.WithLabelValues("get_bookmark.xml")); got != 1 {
+		t.Errorf("streamer_template_failures_total{template=get_bookmark.xml} = %v, want 1", got)
+	}
+	if !strings.Contains(logs.String(), "data_type=api.BookmarkData") {
+		t.Errorf("log has no data type:\n%s", logs.String())
+	}
+}
+
+// soapResponse is any SOAP answer, Action is the element the body holds
+type soapResponse struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    struct {
+		Action struct {
+			XMLName xml.Name
+			Inner   []byte `xml:",innerxml"`
+		} `xml:",any"`
+	} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+// scpd is the part of a service description listing its actions
+type scpd struct {
+	XMLName xml.Name `xml:"urn:schemas-upnp-org:service-1-0 scpd"`
+	Actions []string `xml:"actionList>action>name"`
+}
+
+// checkSCPD wants the actions of the SCPD to be the ones the control URL implements
+func checkSCPD(actions ...string) func(t *testing.T, out []byte) {
+	return func(t *testing.T, out []byte) {
+		t.Helper()
+
+		var got scpd
+		if err := xml.Unmarshal(out, &got); err != nil {
+			t.Fatalf("SCPD doesn't parse: %v", err)
+		}
+		if !slices.Equal(slices.Sorted(slices.Values(got.Actions)), slices.Sorted(slices.Values(actions))) {
+			t.Errorf("actions = %q, want %q", got.Actions, actions)
+		}
+	}
+}
+
+// checkAction wants a SOAP answer holding action, and check to hold for its body
+func checkAction(action string, check func(t *testing.T, inner []byte)) func(t *testing.T, out []byte) {
+	return func(t *testing.T, out []byte) {
+		t.Helper()
+
+		var got soapResponse
+		if err := xml.Unmarshal(out, &got); err != nil {
+			t.Fatalf("SOAP answer doesn't parse: %v", err)
+		}
+		if got.Body.Action.XMLName.Local != action {
+			t.Fatalf("body holds %s, want %s", got.Body.Action.XMLName.Local, action)
+		}
+		if check != nil {
+			check(t, []byte("<r>"+string(got.Body.Action.Inner)+"</r>"))
+		}
+	}
+}
+
+// TestTemplatesGolden renders every XML template with its samples, checks the output is what a renderer
+// expects and compares it with testdata/templates. A change to a template or its data shows up here
+// before a TV stops understanding it, -update rewrites the golden files
+func TestTemplatesGolden(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, nil)
+
+	checks := map[string]func(t *testing.T, out []byte){
+		"device_description.xml": func(t *testing.T, out []byte) {
+			var got struct {
+				XMLName      xml.Name `xml:"urn:schemas-upnp-org:device-1-0 root"`
+				FriendlyName string   `xml:"device>friendlyName"`
+				UDN          string   `xml:"device>UDN"`
+				Services     []struct {
+					Type     string `xml:"serviceType"`
+					SCPD     string `xml:"SCPDURL"`
+					Control  string `xml:"controlURL"`
+					EventSub string `xml:"eventSubURL"`
+				} `xml:"device>serviceList>service"`
+			}
+			if err := xml.Unmarshal(out, &got); err != nil {
+				t.Fatalf("device description doesn't parse: %v", err)
+			}
+			if got.FriendlyName != "Tom & Jerry's" || got.UDN != "uuid:sample" {
+				t.Errorf("friendlyName %q UDN %q, want the sample's", got.FriendlyName, got.UDN)
+			}
+			var services []string
+			for _, s := range got.Services {
+				services = append(services, strings.Join([]string{s.Type, s.SCPD, s.Control, s.EventSub}, " "))
+			}
+			want := []string{
+				"urn:schemas-upnp-org:service:ContentDirectory:1 http://sample:8081/content http://sample:8081/content/control http://sample:8081/content/event",
+				"urn:schemas-upnp-org:service:ConnectionManager:1 http://sample:8081/connection http://sample:8081/connection/control http://sample:8081/connection/event",
+			}
+			if !slices.Equal(services, want) {
+				t.Errorf("services = %q, want %q", services, want)
+			}
+		},
+		"content_scpd.xml": checkSCPD("Browse", "GetSearchCapabilities", "GetSortCapabilities", "GetSystemUpdateID",
+			"X_GetFeatureList", "X_SetBookmark", "X_GetBookmark"),
+		"connection_scpd.xml": checkSCPD("GetProtocolInfo", "GetCurrentConnectionIDs", "GetCurrentConnectionInfo"),
+		"browse_response.xml": checkAction("BrowseResponse", func(t *testing.T, inner []byte) {
+			var got struct {
+				Result         string `xml:"Result"`
+				NumberReturned int    `xml:"NumberReturned"`
+				TotalMatches   int    `xml:"TotalMatches"`
+			}
+			if err := xml.Unmarshal(inner, &got); err != nil {
+				t.Fatal(err)
+			}
+			// the DIDL is a document of its own inside Result, escaped once
+			var didl struct {
+				XMLName xml.Name `xml:"urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/ DIDL-Lite"`
+				Titles  []string `xml:"item>title"`
+			}
+			if err := xml.Unmarshal([]byte(got.Result), &didl); err != nil {
+				t.Fatalf("Result %q isn't DIDL-Lite: %v", got.Result, err)
+			}
+			if got.Result != sampleDIDL || !slices.Equal(didl.Titles, []string{"Tom & Jerry"}) {
+				t.Errorf("Result = %q, want the sample DIDL", got.Result)
+			}
+			if got.NumberReturned != 1 || got.TotalMatches != 3 {
+				t.Errorf("NumberReturned %d TotalMatches %d, want 1 and 3", got.NumberReturned, got.TotalMatches)
+			}
+		}),
+		"protocol_info.xml":    checkAction("GetProtocolInfoResponse", nil),
+		"search_caps.xml":      checkAction("GetSearchCapabilitiesResponse", nil),
+		"sort_caps.xml":        checkAction("GetSortCapabilitiesResponse", nil),
+		"system_update_id.xml": checkAction("GetSystemUpdateIDResponse", nil),
+		"connection_ids.xml":   checkAction("GetCurrentConnectionIDsResponse", nil),
+		"connection_info.xml":  checkAction("GetCurrentConnectionInfoResponse", nil),
+		"feature_list.xml":     checkAction("X_GetFeatureListResponse", nil),
+		"set_bookmark.xml":     checkAction("X_SetBookmarkResponse", nil),
+		"get_bookmark.xml": checkAction("X_GetBookmarkResponse", func(t *testing.T, inner []byte) {
+			var got BookmarkData
+			if err := xml.Unmarshal(inner, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != (BookmarkData{ObjectID: "sample", PosSecond: 60}) {
+				t.Errorf("bookmark = %+v, want the sample's", got)
+			}
+		}),
+		"propertyset.xml": func(t *testing.T, out []byte) {
+			var got struct {
+				XMLName    xml.Name `xml:"urn:schemas-upnp-org:event-1-0 propertyset"`
+				Properties []struct {
+					Variable struct {
+						XMLName xml.Name
+						Value   string `xml:",chardata"`
+					} `xml:",any"`
+				} `xml:"property"`
+			}
+			if err := xml.Unmarshal(out, &got); err != nil {
+				t.Fatalf("propertyset doesn't parse: %v", err)
+			}
+			var props []string
+			for _, p := range got.Properties {
+				props = append(props, p.Variable.XMLName.Local+"="+p.Variable.Value)
+			}
+			if want := []string{"SystemUpdateID=1", "ContainerUpdateIDs=all,1,category/Tom & Jerry,1"}; !slices.Equal(props, want) {
+				t.Errorf("properties = %q, want %q", props, want)
+			}
+		},
+		"soap_fault.xml": checkAction("Fault", func(t *testing.T, inner []byte) {
+			var got struct {
+				Code int `xml:"detail>UPnPError>errorCode"`
+			}
+			if err := xml.Unmarshal(inner, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Code != upnpErrNoSuchObject {
+				t.Errorf("errorCode = %d, want %d", got.Code, upnpErrNoSuchObject)
+			}
+		}),
+	}
+
+	// every XML template has a check, a new one can't slip by
+	for _, name := range slices.Sorted(maps.Keys(templateSamples)) {
+		if _, ok := checks[name]; !ok && path.Ext(name) == ".xml" {
+			t.Errorf("no check for %s", name)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(checks)) {
+		for i, sample := range templateSamples[name] {
+			t.Run(fmt.Sprintf("ok - %s %d", name, i), func(t *testing.T) {
+				t.Parallel()
+
+				w := httptest.NewRecorder()
+				h.render(w, name, sample)
+				if w.Code != http.StatusOK {
+					t.Fatalf("render status = %d", w.Code)
+				}
+				checks[name](t, w.Body.Bytes())
+				golden(t, path.Join("templates", fmt.Sprintf("%s.%d.xml", strings.TrimSuffix(name, ".xml"), i)), w.Body.String())
+			})
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// posters only change when someone replaces the file, browsers keep them for a day and then revalidate
+const thumbCacheControl = "public, max-age=86400"
+
+// HandleThumb serves /thumb/{uuid}, the poster image found next to the entry. 404 when there is none,
+// the web ui shows a placeholder for those without asking
+func (h *Handler) HandleThumb(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.FromString(r.PathValue("uuid"))
+	if err != nil {
+		http.Error(w, "bad id", http.StatusNotFound)
+		return
+	}
+	entry, err := h.Media.GetEntry(id)
+	if err != nil {
+		http.Error(w, "entry not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := h.Media.OpenThumb(entry)
+	if err != nil {
+		http.Error(w, "no thumbnail", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "file access error", http.StatusInternalServerError)
+		return
+	}
+
+	if ct := mime.TypeByExtension(filepath.Ext(entry.Thumb)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("Cache-Control", thumbCacheControl)
+	http.ServeContent(w, r, entry.Thumb, info.ModTime(), f)
+}
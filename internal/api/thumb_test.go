@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleThumb(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Heat.mkv":        "x",
+		"Heat-poster.png": "poster",
+		"Ronin.mp4":       "x",
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /thumb/{uuid}", h.HandleThumb)
+
+	thumb := func(name string) string { return "/thumb/" + entryByName(t, h, name).UUID.String() }
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantType string
+	}{
+		{"ok - poster", thumb("Heat.mkv"), http.StatusOK, "image/png"},
+		{"fail - entry without a poster", thumb("Ronin.mp4"), http.StatusNotFound, ""},
+		{"fail - unknown uuid", "/thumb/00000000-0000-0000-0000-000000000001", http.StatusNotFound, ""},
+		{"fail - not a uuid", "/thumb/nope", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, rec.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if got := rec.Body.String(); got != "poster" {
+				t.Errorf("body = %q, want the poster", got)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != thumbCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, thumbCacheControl)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"path/filepath"
 	"strings"
 )
@@ -24,20 +25,48 @@ func getMimeType(filename string) string {
 		return "video/x-flv"
 	case ".webm":
 		return "video/webm"
-	case ".mpg", ".mpeg":
+	case ".mpg", ".mpeg", ".vob":
 		return "video/mpeg"
+	case ".m2ts":
+		return "video/mp2t"
 	default:
 		return "application/octet-stream"
 	}
 }
 
+// browserPlayable reports whether browsers play the container as it is, the others go through /hls when
+// it's enabled
+func browserPlayable(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mp4", ".m4v", ".webm":
+		return true
+	default:
+		return false
+	}
+}
+
+// humanBytes formats a size with the units the config's parseBytes reads, 1024 based with one decimal
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	units := []string{"KB", "MB", "GB"}
+	v := float64(n) / unit
+	i := 0
+	for v >= unit && i < len(units)-1 {
+		v /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
+
+// xmlEscaper escapes text for XML in one pass, and hands back text with nothing to escape as it is
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+
 func escapeXML(s string) string {
-	s = strings.ReplaceAll(s, "&", "&amp;")
-	s = strings.ReplaceAll(s, "<", "&lt;")
-	s = strings.ReplaceAll(s, ">", "&gt;")
-	s = strings.ReplaceAll(s, "\"", "&quot;")
-	s = strings.ReplaceAll(s, "'", "&apos;")
-	return s
+	return xmlEscaper.Replace(s)
 }
 
 func getDLNAProfile(filename string) string {
@@ -61,3 +90,32 @@ func getDLNAProfile(filename string) string {
 		return commonProfile
 	}
 }
+
+// MediaType is how the files of an extension are declared to clients, set in the config over the built-in
+// table of getMimeType and getDLNAProfile
+type MediaType struct {
+	MIME        string
+	DLNAProfile string // the DLNA.ORG_PN of protocolInfo and contentFeatures.dlna.org, e.g. MPEG_TS_HD_NA_ISO, empty sends none
+}
+
+// mediaType is the configured media type of filename's extension, false when the built-in table applies
+func (h *Handler) mediaType(filename string) (MediaType, bool) {
+	t, ok := h.config.MediaTypes[strings.ToLower(filepath.Ext(filename))]
+	return t, ok
+}
+
+// mimeType is getMimeType with the configured media types over it
+func (h *Handler) mimeType(filename string) string {
+	if t, ok := h.mediaType(filename); ok {
+		return t.MIME
+	}
+	return getMimeType(filename)
+}
+
+// dlnaProfile is getDLNAProfile led by the DLNA.ORG_PN of the configured media type, if it has one
+func (h *Handler) dlnaProfile(filename string) string {
+	if t, ok := h.mediaType(filename); ok && t.DLNAProfile != "" {
+		return "DLNA.ORG_PN=" + t.DLNAProfile + ";" + getDLNAProfile(filename)
+	}
+	return getDLNAProfile(filename)
+}
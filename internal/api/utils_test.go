@@ -0,0 +1,31 @@
+package api
+
+import "testing"
+
+func TestHumanBytes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		n    int64
+		want string
+	}{
+		{"ok - zero", 0, "0 B"},
+		{"ok - below a KB", 1023, "1023 B"},
+		{"ok - one KB", 1024, "1.0 KB"},
+		{"ok - rounded", 1536, "1.5 KB"},
+		{"ok - MB", 700 * 1024 * 1024, "700.0 MB"},
+		{"ok - GB", 4_700_000_000, "4.4 GB"},
+		{"ok - GB is the largest unit", 2 * 1024 * 1024 * 1024 * 1024, "2048.0 GB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := humanBytes(tt.n); got != tt.want {
+				t.Errorf("humanBytes(%d) = %q, want %q", tt.n, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"streamer/internal/media"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// warmUp starts reading the first config.WarmUp bytes of res in the background, while the headers go out
+// and before ServeContent's first read, so a sleeping disk is spinning by the time it comes. A request whose
+// range starts past them skips it. It returns res timed: finish waits for the warm-up and logs how long the
+// first read took. Call finish once the response is done, before res is closed and the io slot released,
+// the warm-up reads within the slot of the stream
+func (h *Handler) warmUp(r *http.Request, res media.Resource) (timed media.Resource, finish func()) {
+	start := time.Now()
+	first := &firstRead{start: start}
+	timed = first.wrap(res)
+
+	offset := rangeStart(r, res.Size())
+	n := h.config.WarmUp - offset
+	if n <= 0 || r.Method == http.MethodHead {
+		return timed, func() { h.logFirstRead(res, first, offset, 0) }
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	done := make(chan int64, 1)
+	go func() {
+		warmed, err := media.WarmUp(ctx, res, offset, n)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			h.logger.Debug("warm-up failed", "name", res.Name(), "err", err)
+		}
+		h.logger.Debug("warm-up done", "name", res.Name(), "offset", offset, "bytes", warmed, "took", time.Since(start))
+		done <- warmed
+	}()
+
+	return timed, func() {
+		cancel()
+		h.logFirstRead(res, first, offset, <-done)
+	}
+}
+
+// logFirstRead logs the wait for the first bytes of res, with and without warm-up, to tell whether it helps
+func (h *Handler) logFirstRead(res media.Resource, first *firstRead, offset, warmed int64) {
+	latency, ok := first.latency()
+	if !ok {
+		return
+	}
+	h.logger.Debug("first byte", "name", res.Name(), "latency", latency, "range_start", offset, "warm_up", warmed)
+}
+
+// rangeStart is the first byte the Range header of r asks for, 0 without one or when it doesn't parse. A
+// suffix range counts back from the end of a file of size bytes
+func rangeStart(r *http.Request, size int64) int64 {
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok {
+		return 0
+	}
+	first, _, _ := strings.Cut(spec, ",")
+	from, last, ok := strings.Cut(strings.TrimSpace(first), "-")
+	if !ok {
+		return 0
+	}
+	if from == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || size < 0 {
+			return 0
+		}
+		return max(size-n, 0)
+	}
+	start, err := strconv.ParseInt(from, 10, 64)
+	if err != nil || start < 0 {
+		return 0
+	}
+	return start
+}
+
+// firstRead notes when the first read of a resource returned. http.ServeContent reads the first bytes
+// through Read even when sendfile sends the rest
+type firstRead struct {
+	start time.Time
+	once  sync.Once
+	at    time.Time
+}
+
+func (f *firstRead) wrap(res media.Resource) media.Resource {
+	t := timedResource{Resource: res, first: f}
+	if _, ok := res.(syscall.Conn); ok {
+		return timedConnResource{t}
+	}
+	return t
+}
+
+func (f *firstRead) latency() (time.Duration, bool) {
+	if f.at.IsZero() {
+		return 0, false
+	}
+	return f.at.Sub(f.start), true
+}
+
+// timedResource is a Resource whose first read is noted in first
+type timedResource struct {
+	media.Resource
+	first *firstRead
+}
+
+func (t timedResource) Read(p []byte) (int, error) {
+	n, err := t.Resource.Read(p)
+	t.first.once.Do(func() { t.first.at = time.Now() })
+	return n, err
+}
+
+// timedConnResource is a timedResource over one that hands its file to sendfile
+type timedConnResource struct {
+	timedResource
+}
+
+func (t timedConnResource) SyscallConn() (syscall.RawConn, error) {
+	return t.Resource.(syscall.Conn).SyscallConn()
+}
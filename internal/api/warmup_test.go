@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"streamer/internal/media"
+	"strings"
+	"testing"
+)
+
+func TestRangeStart(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		rng   string
+		size  int64
+		start int64
+	}{
+		{"ok - no range", "", 1000, 0},
+		{"ok - from the start", "bytes=0-", 1000, 0},
+		{"ok - open ended", "bytes=500-", 1000, 500},
+		{"ok - closed", "bytes=200-299", 1000, 200},
+		{"ok - first of several", "bytes=300-399, 0-99", 1000, 300},
+		{"ok - suffix", "bytes=-100", 1000, 900},
+		{"ok - suffix longer than the file", "bytes=-5000", 1000, 0},
+		{"ok - suffix of an unknown size", "bytes=-100", -1, 0},
+		{"ok - not bytes", "items=5-", 1000, 0},
+		{"ok - garbage", "bytes=x-", 1000, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(http.MethodGet, "/stream", nil)
+			if tt.rng != "" {
+				r.Header.Set("Range", tt.rng)
+			}
+			if got := rangeStart(r, tt.size); got != tt.start {
+				t.Errorf("rangeStart(%q) = %d, want %d", tt.rng, got, tt.start)
+			}
+		})
+	}
+}
+
+func TestStreamWarmUp(t *testing.T) {
+	t.Parallel()
+
+	content := make([]byte, 256<<10)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	tests := []struct {
+		name       string
+		mode       media.ResourceMode
+		warmUp     int64
+		rng        string
+		wantBody   []byte
+		wantWarmUp string // the start of its log line, empty when it's skipped
+	}{
+		{"ok - whole file", media.ModeFileBuffered, 64 << 10, "", content, `msg="warm-up done" name=Heat.mp4 offset=0 `},
+		{"ok - whole file direct", media.ModeFileDirect, 64 << 10, "", content, `msg="warm-up done" name=Heat.mp4 offset=0 `},
+		{"ok - range in the warm-up", media.ModeFileBuffered, 64 << 10, "bytes=1024-", content[1024:], `msg="warm-up done" name=Heat.mp4 offset=1024 `},
+		{"ok - range past the warm-up", media.ModeFileBuffered, 64 << 10, "bytes=200000-", content[200000:], ""},
+		{"ok - off", media.ModeFileBuffered, 0, "", content, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := newTestHandler(t, map[string]string{"Heat.mp4": string(content)})
+			h.Media.Mode = tt.mode
+			h.config.WarmUp = tt.warmUp
+			var logs bytes.Buffer
+			h.logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			id := entryByName(t, h, "Heat.mp4").UUID.String()
+
+			for _, path := range []string{"/stream?id=" + id, "/direct/" + id + ".mp4"} {
+				logs.Reset()
+				r := httptest.NewRequest(http.MethodGet, path, nil)
+				if tt.rng != "" {
+					r.Header.Set("Range", tt.rng)
+				}
+				w := httptest.NewRecorder()
+				if strings.HasPrefix(path, "/stream") {
+					h.Stream(w, r)
+				} else {
+					h.AdapterDirectStream(w, r)
+				}
+
+				if !bytes.Equal(w.Body.Bytes(), tt.wantBody) {
+					t.Errorf("%s got %d bytes, want the %d asked for", path, w.Body.Len(), len(tt.wantBody))
+				}
+				// the handler returns once the warm-up is over, its lines are in
+				got := logs.String()
+				if !strings.Contains(got, `msg="first byte" name=Heat.mp4 latency=`) {
+					t.Errorf("%s logged %s, want the first byte latency", path, got)
+				}
+				if warmedUp := strings.Contains(got, "warm-up done"); warmedUp != (tt.wantWarmUp != "") || !strings.Contains(got, tt.wantWarmUp) {
+					t.Errorf("%s logged %s, want the warm-up %q", path, got, tt.wantWarmUp)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"streamer/internal/bookmark"
+	"streamer/internal/media"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// watchPage is what watch.html renders, the player for one entry
+type watchPage struct {
+	Title       string
+	Category    string
+	FileName    string
+	Size        string // human readable
+	ModTime     time.Time
+	Source      string // what the <video> element plays
+	MimeType    string // of Source
+	BackURL     string // the listing of the category
+	DownloadURL string
+	ProgressURL string  // where the player reads and saves its position, empty when it doesn't save it
+	Resume      float64 // seconds into the film the player starts at, where this browser stopped
+
+	Parts      []webLink // of a film split over files the player can't join, the playing one selected
+	Prev, Next *webLink  // the neighbours in the same category, nil at its ends
+}
+
+// HandleWatch renders /watch/{uuid}, a page playing the entry in the browser
+func (h *Handler) HandleWatch(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.FromString(r.PathValue("uuid"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	entry, err := h.Media.GetEntry(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	page := watchPage{
+		Title:       displayTitle(entry.Name),
+		Category:    entry.Category,
+		FileName:    entry.Name,
+		Size:        humanBytes(entry.Size),
+		ModTime:     entry.ModTime,
+		BackURL:     "/?" + url.Values{"category": {entry.Category}}.Encode(),
+		DownloadURL: "/download/" + entry.UUID.String(),
+	}
+	page.Source, page.MimeType = h.playSource(*entry)
+
+	// a split film the player can't get as one file plays a part at a time, ?part= picks which
+	part := 1
+	if len(entry.Parts) > 1 && !entry.Concatenated() {
+		if n, err := strconv.Atoi(r.URL.Query().Get("part")); err == nil && n >= 1 && n <= len(entry.Parts) {
+			part = n
+		}
+		for n := range len(entry.Parts) {
+			page.Parts = append(page.Parts, webLink{
+				Label:    fmt.Sprintf("part %d", n+1),
+				URL:      fmt.Sprintf("/watch/%s?part=%d", entry.UUID, n+1),
+				Selected: n+1 == part,
+			})
+		}
+		// hls transcodes the entry's path, the first part, the others go as they are
+		if p, _ := entry.Part(part); part > 1 || h.HLS == nil || browserPlayable(p.Name) {
+			page.Source = fmt.Sprintf("/stream?id=%s&part=%d", entry.UUID, part)
+			page.MimeType = h.mimeType(p.Name)
+			page.FileName, page.Size = p.Name, humanBytes(p.Size)
+		}
+	}
+
+	// the position is kept for the entry, it only means something in the first part
+	if part == 1 {
+		page.ProgressURL = "/api/progress/" + entry.UUID.String()
+		if pos, ok := h.Bookmarks.Get(bookmark.Key{ID: entry.UUID, Client: playerClient(w, r)}); ok {
+			page.Resume = pos.Seconds()
+		}
+	}
+
+	// prev/next go through the category in the order the listing shows it
+	var siblings []media.Entry
+	for _, e := range h.Media.Registry.List() {
+		if e.Category == entry.Category {
+			siblings = append(siblings, e)
+		}
+	}
+	for i, e := range siblings {
+		if e.UUID != entry.UUID {
+			continue
+		}
+		if i > 0 {
+			page.Prev = watchLink(siblings[i-1])
+		}
+		if i < len(siblings)-1 {
+			page.Next = watchLink(siblings[i+1])
+		}
+		break
+	}
+
+	h.render(w, "watch.html", page)
+}
+
+func watchLink(e media.Entry) *webLink {
+	return &webLink{Label: displayTitle(e.Name), URL: "/watch/" + e.UUID.String()}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleWatch(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Die Hard.mp4": "yippee-ki-yay",
+		"Action/Heat.mp4":     "x",
+		"Action/Speed.mp4":    "x",
+		"Comedy/Airplane.m4v": "x",
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /watch/{uuid}", h.HandleWatch)
+
+	watch := func(name string) string { return "/watch/" + entryByName(t, h, name).UUID.String() }
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		want     []string
+		wantNot  []string
+	}{
+		{"ok - middle of the category", watch("Heat.mp4"), http.StatusOK, []string{
+			"<h1>Heat</h1>",
+			`<source src="/stream?id=` + entryByName(t, h, "Heat.mp4").UUID.String() + `" type="video/mp4">`,
+			`<a href="` + watch("Die Hard.mp4") + `">&laquo; Die Hard</a>`,
+			`<a href="` + watch("Speed.mp4") + `">Speed &raquo;</a>`,
+			`<a href="/?category=Action">&laquo; Action</a>`,
+			"Heat.mp4 &middot; 1 B",
+		}, nil},
+		{"ok - first of the category", watch("Die Hard.mp4"), http.StatusOK, []string{
+			`<a href="` + watch("Heat.mp4") + `">Heat &raquo;</a>`,
+		}, []string{"&laquo; Airplane", "&laquo; Speed"}},
+		{"ok - alone in its category", watch("Airplane.m4v"), http.StatusOK, []string{"<h1>Airplane</h1>"},
+			[]string{"&raquo;</a>", "&laquo; Die Hard"}},
+		{"fail - unknown uuid", "/watch/00000000-0000-0000-0000-000000000001", http.StatusNotFound, nil, nil},
+		{"fail - not a uuid", "/watch/nope", http.StatusNotFound, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			body := rec.Body.String()
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, rec.Code, tt.wantCode)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("page has no %s in\n%s", s, body)
+				}
+			}
+			for _, s := range tt.wantNot {
+				if strings.Contains(body, s) {
+					t.Errorf("page has %s in\n%s", s, body)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleWatchParts(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Heat CD1.mkv":  "first half",
+		"Action/Heat CD2.mkv":  "second half",
+		"Action/Ronin CD1.mpg": "x",
+		"Action/Ronin CD2.mpg": "x",
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /watch/{uuid}", h.HandleWatch)
+
+	heat := entryByName(t, h, "Heat.mkv").UUID.String()
+	ronin := entryByName(t, h, "Ronin.mpg").UUID.String()
+
+	tests := []struct {
+		name    string
+		path    string
+		want    []string
+		wantNot []string
+	}{
+		{"ok - first part by default", "/watch/" + heat, []string{
+			`<source src="/stream?id=` + heat + `&part=1" type="video/x-matroska">`,
+			`<a href="/watch/` + heat + `?part=1" class="selected">part 1</a>`,
+			`<a href="/watch/` + heat + `?part=2">part 2</a>`,
+			`data-progress="/api/progress/` + heat + `"`,
+			"Heat CD1.mkv &middot; 10 B",
+		}, nil},
+		{"ok - second part", "/watch/" + heat + "?part=2", []string{
+			`<source src="/stream?id=` + heat + `&part=2" type="video/x-matroska">`,
+			`<a href="/watch/` + heat + `?part=2" class="selected">part 2</a>`,
+			"Heat CD2.mkv &middot; 11 B",
+		}, []string{"data-progress"}},
+		{"ok - out of range is the first part", "/watch/" + heat + "?part=9", []string{
+			`<a href="/watch/` + heat + `?part=1" class="selected">part 1</a>`,
+		}, nil},
+		{"ok - joined parts play as one", "/watch/" + ronin, []string{
+			`<source src="/stream?id=` + ronin + `" type="video/mpeg">`,
+		}, []string{`class="parts"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			body := rec.Body.String()
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s status = %d, want 200", tt.path, rec.Code)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("page has no %s in\n%s", s, body)
+				}
+			}
+			for _, s := range tt.wantNot {
+				if strings.Contains(body, s) {
+					t.Errorf("page has %s in\n%s", s, body)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleWebLinksToPlayer(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mp4": "x"})
+
+	rec := httptest.NewRecorder()
+	h.HandleWeb(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := `<a href="/watch/` + entryByName(t, h, "Heat.mp4").UUID.String() + `">`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("listing has no %s", want)
+	}
+}
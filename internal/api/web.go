@@ -1,15 +1,95 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"strconv"
+	"streamer/internal/hls"
+	"streamer/internal/media"
 	"strings"
 )
 
+// page sizes of the web ui, a TV browser chokes on thousands of entries in one page
+const (
+	defaultPageSize = 100
+	maxPageSize     = 500
+)
+
+var errBadPage = errors.New("page and size must be positive numbers")
+
+// the layouts of the listing, ?view= picks one and the cookie keeps it for the next visit
+const (
+	viewList   = "list"
+	viewGrid   = "grid" // posters, for browsing by cover
+	viewCookie = "streamer_view"
+)
+
+var errBadView = errors.New("view must be list or grid")
+
+// the sort controls of the web ui, in the order they are shown
+var webSortOrders = []struct {
+	Order media.SortOrder
+	Label string
+}{
+	{media.SortName, "name"},
+	{media.SortNewest, "newest"},
+	{media.SortSize, "size"},
+}
+
 type VideoItem struct {
 	Name        string
 	Category    string
 	EncodedPath string
+	Size        string // human readable, e.g. 1.4 GB
+	URL         string // where the player gets it from, /hls for containers browsers can't play
+	WatchURL    string // the player page
+	StreamURL   string // absolute, for copying into players and casting apps
+	DownloadURL string
+	ThumbURL    string // the poster, empty when the entry has none
+}
+
+// webPage is what index.html renders, one page of the (filtered) library
+type webPage struct {
+	Items    []VideoItem
+	Category string // the ?category= filter, empty for all
+	Query    string // the ?q= search, empty for all
+	Sort     media.SortOrder
+	Collate  media.Collation // the ?collate= of sort=name, empty for the configured one
+	View     string          // viewList or viewGrid
+	Page     int             // 1-based
+	Pages    int
+	Size     int
+	Total    int // entries across all pages
+
+	PrevURL     string // empty on the first page
+	NextURL     string // empty on the last page
+	NextItemURL string // the next page as a fragment, for infinite scrolling
+
+	Categories []webLink // every category, to filter by
+	AllURL     string    // the listing without category filter
+	Sorts      []webLink // the sort orders
+	Views      []webLink // list and grid
+
+	Playlists []webPlaylist // the saved playlists, only on the full page
+	Version   uint64        // of the library shown, the page reloads when /api/events reports another
+}
+
+// webPlaylist is a saved playlist in the list below the library
+type webPlaylist struct {
+	Name      string
+	Count     int // titles in it, including ones the library lost since
+	URL       string
+	DeleteURL string
+}
+
+// webLink is a link of the navigation, Selected marks the current one
+type webLink struct {
+	Label    string
+	Count    int // entries behind a category link
+	URL      string
+	Selected bool
 }
 
 func (h *Handler) HandleWeb(w http.ResponseWriter, r *http.Request) {
@@ -18,23 +98,265 @@ func (h *Handler) HandleWeb(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	files, err := h.Media.ListFiles()
+	page, err := h.webPage(r)
 	if err != nil {
-		http.Error(w, "could not list files", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	// a view picked by a link sticks for the next visit to /
+	if r.URL.Query().Has("view") {
+		http.SetCookie(w, &http.Cookie{
+			Name:     viewCookie,
+			Value:    page.View,
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	page.Version, _ = h.Media.Registry.Watch()
+	for _, p := range h.Playlists.List() {
+		page.Playlists = append(page.Playlists, webPlaylist{
+			Name:      p.Name,
+			Count:     len(p.Entries),
+			URL:       playlistURL(p.ID),
+			DeleteURL: "/api/playlists/" + p.ID.String(),
+		})
+	}
 
-	// prepare the data for the template
-	var items []VideoItem
-	for _, f := range files {
-		displayName := strings.TrimSuffix(f.Name, filepath.Ext(f.Name))
+	h.render(w, "index.html", page)
+}
 
-		items = append(items, VideoItem{
-			Name:        displayName,
+// HandleWebItems renders only the entries of a page, the web ui appends them while scrolling
+func (h *Handler) HandleWebItems(w http.ResponseWriter, r *http.Request) {
+	page, err := h.webPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.renderBlock(w, "index.html", "items", page)
+}
+
+// webPage reads ?page=, ?size=, ?category=, ?q=, ?sort=, ?collate= and ?view= and cuts the page out of the library.
+// A size above maxPageSize is capped, a page past the end shows the last one
+func (h *Handler) webPage(r *http.Request) (webPage, error) {
+	query := r.URL.Query()
+
+	pageNum, err := positiveParam(query, "page", 1)
+	if err != nil {
+		return webPage{}, err
+	}
+	size, err := positiveParam(query, "size", defaultPageSize)
+	if err != nil {
+		return webPage{}, err
+	}
+	size = min(size, maxPageSize)
+
+	order, err := media.ParseSortOrder(query.Get("sort"))
+	if err != nil {
+		return webPage{}, err
+	}
+	collation := h.Media.Registry.Collation()
+	var collate media.Collation
+	if s := query.Get("collate"); s != "" {
+		if collate, err = media.ParseCollation(s); err != nil {
+			return webPage{}, err
+		}
+		collation = collate
+	}
+
+	view, err := webView(r)
+	if err != nil {
+		return webPage{}, err
+	}
+
+	category, q := query.Get("category"), strings.TrimSpace(query.Get("q"))
+
+	// Search hands them over by name already, in the registry's cached order
+	files := h.Media.Registry.Search(q)
+	if order != media.SortName || collate != "" {
+		media.SortEntries(files, order, collation)
+	}
+	if category != "" {
+		filtered := files[:0]
+		for _, f := range files {
+			if f.Category == category {
+				filtered = append(filtered, f)
+			}
+		}
+		files = filtered
+	}
+
+	pages := max(1, (len(files)+size-1)/size)
+	pageNum = min(pageNum, pages)
+
+	start := (pageNum - 1) * size
+	end := min(start+size, len(files))
+
+	page := webPage{
+		Category: category,
+		Query:    q,
+		Sort:     order,
+		Collate:  collate,
+		View:     view,
+		Page:     pageNum,
+		Pages:    pages,
+		Size:     size,
+		Total:    len(files),
+	}
+
+	// prepare the data for the template
+	base := h.baseURL(r)
+	for _, f := range files[start:end] {
+		url, _ := h.playSource(f)
+		page.Items = append(page.Items, VideoItem{
+			Name:        displayTitle(f.Name),
 			Category:    f.Category,
 			EncodedPath: f.UUID.String(),
+			Size:        humanBytes(f.Size),
+			URL:         url,
+			WatchURL:    "/watch/" + f.UUID.String(),
+			StreamURL:   streamURL(base, f),
+			DownloadURL: "/download/" + f.UUID.String(),
+			ThumbURL:    thumbURL(f),
+		})
+	}
+
+	// picking a category or sort order starts over on the first page
+	all := page
+	all.Category = ""
+	page.AllURL = all.url("/", 1)
+	for _, c := range h.Media.Registry.Categories() {
+		link := page
+		link.Category = c.Name
+		page.Categories = append(page.Categories, webLink{
+			Label:    c.Name,
+			Count:    c.Count,
+			URL:      link.url("/", 1),
+			Selected: c.Name == category,
+		})
+	}
+	for _, o := range webSortOrders {
+		link := page
+		link.Sort = o.Order
+		page.Sorts = append(page.Sorts, webLink{
+			Label:    o.Label,
+			URL:      link.url("/", 1),
+			Selected: o.Order == order,
 		})
 	}
 
-	h.render(w, "index.html", items)
+	for _, v := range []string{viewList, viewGrid} {
+		link := page
+		link.View = v
+		u := link.url("/", pageNum)
+		if v == viewList {
+			// spelled out, otherwise the cookie would bring the grid back
+			u += "&view=" + viewList
+		}
+		page.Views = append(page.Views, webLink{
+			Label:    v,
+			URL:      u,
+			Selected: v == view,
+		})
+	}
+
+	if pageNum > 1 {
+		page.PrevURL = page.url("/", pageNum-1)
+	}
+	if pageNum < pages {
+		page.NextURL = page.url("/", pageNum+1)
+		page.NextItemURL = page.url("/web/items", pageNum+1)
+	}
+	return page, nil
+}
+
+// url links to another page with the same filter, search and order, defaults are left out to keep
+// links short
+func (p webPage) url(path string, page int) string {
+	v := url.Values{}
+	if p.Category != "" {
+		v.Set("category", p.Category)
+	}
+	if p.Query != "" {
+		v.Set("q", p.Query)
+	}
+	if p.Sort != media.SortName {
+		v.Set("sort", string(p.Sort))
+	}
+	if p.Collate != "" {
+		v.Set("collate", string(p.Collate))
+	}
+	if p.View != viewList {
+		v.Set("view", p.View)
+	}
+	v.Set("page", strconv.Itoa(page))
+	if p.Size != defaultPageSize {
+		v.Set("size", strconv.Itoa(p.Size))
+	}
+	return path + "?" + v.Encode()
+}
+
+// positiveParam reads an optional positive number from the query
+// webView is the layout a request asks for: ?view=, else the one the cookie remembers, else the list
+func webView(r *http.Request) (string, error) {
+	view := r.URL.Query().Get("view")
+	if view == "" {
+		if c, err := r.Cookie(viewCookie); err == nil {
+			view = c.Value
+		}
+	}
+
+	switch view {
+	case "", viewList:
+		return viewList, nil
+	case viewGrid:
+		return viewGrid, nil
+	default:
+		if !r.URL.Query().Has("view") {
+			// a cookie from an older version, not worth an error page
+			return viewList, nil
+		}
+		return "", errBadView
+	}
+}
+
+// thumbURL is where the poster of e is served, empty when the scan found none
+func thumbURL(e media.Entry) string {
+	if e.Thumb == "" {
+		return ""
+	}
+	return "/thumb/" + e.UUID.String()
+}
+
+func positiveParam(query url.Values, name string, fallback int) (int, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, errBadPage
+	}
+	return n, nil
+}
+
+// playSource is where a browser plays the entry from and its content type, containers it can't play go
+// through /hls when enabled
+func (h *Handler) playSource(e media.Entry) (url, mimeType string) {
+	if h.HLS != nil && !browserPlayable(e.Name) {
+		return "/hls/" + e.UUID.String() + "/" + hls.PlaylistName, hlsContentType(hls.PlaylistName)
+	}
+	return "/stream?id=" + e.UUID.String(), h.mimeType(e.Name)
+}
+
+// displayTitle is the name of a file as the web ui shows it, without its extension
+func displayTitle(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// HandleCategories lists the categories with their entry counts as JSON, what the web ui navigates by
+func (h *Handler) HandleCategories(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.Media.Registry.Categories())
 }
@@ -0,0 +1,537 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"streamer/internal/media"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// webLibrary has 5 action and 3 comedy films, named so they sort in this order
+func webLibrary(t *testing.T) *Handler {
+	t.Helper()
+
+	files := map[string]string{}
+	for i := range 5 {
+		files[fmt.Sprintf("Action/a%d.mp4", i)] = "x"
+	}
+	for i := range 3 {
+		files[fmt.Sprintf("Comedy/c%d.mp4", i)] = "x"
+	}
+	return newTestHandler(t, files)
+}
+
+var itemNames = regexp.MustCompile(`🎬 (.+) - `)
+
+// listedNames returns the entries a rendered page or fragment lists
+func listedNames(body string) []string {
+	var names []string
+	for _, m := range itemNames.FindAllStringSubmatch(body, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+func TestWebPage(t *testing.T) {
+	t.Parallel()
+
+	h := webLibrary(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantNames []string
+		wantPage  int
+		wantPages int
+		wantPrev  string
+		wantNext  string
+	}{
+		{"ok - everything fits the default size", "", []string{"a0", "a1", "a2", "a3", "a4", "c0", "c1", "c2"}, 1, 1, "", ""},
+		{"ok - first page", "?size=3", []string{"a0", "a1", "a2"}, 1, 3, "", "/?page=2&size=3"},
+		{"ok - middle page", "?size=3&page=2", []string{"a3", "a4", "c0"}, 2, 3, "/?page=1&size=3", "/?page=3&size=3"},
+		{"ok - last page", "?size=3&page=3", []string{"c1", "c2"}, 3, 3, "/?page=2&size=3", ""},
+		{"ok - past the end shows the last page", "?size=3&page=9", []string{"c1", "c2"}, 3, 3, "/?page=2&size=3", ""},
+		{"ok - category and pages compose", "?category=Action&size=2&page=2", []string{"a2", "a3"}, 2, 3,
+			"/?category=Action&page=1&size=2", "/?category=Action&page=3&size=2"},
+		{"ok - unknown category", "?category=Horror", nil, 1, 1, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			page, err := h.webPage(req)
+			if err != nil {
+				t.Fatalf("webPage() error = %v", err)
+			}
+
+			var names []string
+			for _, item := range page.Items {
+				names = append(names, item.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("names = %v, want %v", names, tt.wantNames)
+			}
+			if page.Page != tt.wantPage || page.Pages != tt.wantPages {
+				t.Errorf("page %d of %d, want %d of %d", page.Page, page.Pages, tt.wantPage, tt.wantPages)
+			}
+			if page.PrevURL != tt.wantPrev || page.NextURL != tt.wantNext {
+				t.Errorf("prev = %q, next = %q, want %q and %q", page.PrevURL, page.NextURL, tt.wantPrev, tt.wantNext)
+			}
+
+			// the rendered page lists the same entries and links
+			rec := httptest.NewRecorder()
+			h.HandleWeb(rec, req)
+			body := rec.Body.String()
+			if got := listedNames(body); strings.Join(got, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("rendered names = %v, want %v", got, tt.wantNames)
+			}
+			if tt.wantNext != "" && !strings.Contains(body, `href="`+tt.wantNext+`"`) {
+				t.Errorf("page does not link to %s", tt.wantNext)
+			}
+			if tt.wantPrev != "" && !strings.Contains(body, `href="`+tt.wantPrev+`"`) {
+				t.Errorf("page does not link to %s", tt.wantPrev)
+			}
+		})
+	}
+}
+
+func TestWebPageSize(t *testing.T) {
+	t.Parallel()
+
+	h := webLibrary(t)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		wantSize int
+	}{
+		{"ok - default", "", http.StatusOK, defaultPageSize},
+		{"ok - capped", "?size=100000", http.StatusOK, maxPageSize},
+		{"fail - zero size", "?size=0", http.StatusBadRequest, 0},
+		{"fail - negative page", "?page=-1", http.StatusBadRequest, 0},
+		{"fail - not a number", "?page=two", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			h.HandleWeb(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			page, _ := h.webPage(req)
+			if page.Size != tt.wantSize {
+				t.Errorf("size = %d, want %d", page.Size, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestHandleWebItems(t *testing.T) {
+	t.Parallel()
+
+	h := webLibrary(t)
+
+	rec := httptest.NewRecorder()
+	h.HandleWebItems(rec, httptest.NewRequest(http.MethodGet, "/web/items?category=Action&size=2&page=2", nil))
+	body := rec.Body.String()
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if got := listedNames(body); strings.Join(got, ",") != "a2,a3" {
+		t.Errorf("fragment lists %v, want a2 and a3", got)
+	}
+	// a fragment, not a page, pointing at the fragment after it
+	if strings.Contains(body, "<html>") || strings.Contains(body, "pager") {
+		t.Errorf("fragment contains page markup:\n%s", body)
+	}
+	if !strings.Contains(body, `data-next="/web/items?category=Action&page=3&size=2"`) {
+		t.Errorf("fragment does not point at the next one:\n%s", body)
+	}
+
+	// the last fragment ends the scrolling
+	rec = httptest.NewRecorder()
+	h.HandleWebItems(rec, httptest.NewRequest(http.MethodGet, "/web/items?category=Action&size=2&page=3", nil))
+	if strings.Contains(rec.Body.String(), "data-next") {
+		t.Errorf("last fragment points at another one:\n%s", rec.Body)
+	}
+}
+
+func TestHandleWebEscapesNames(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Tom & Jerry/Cat & Mouse.mp4": "x"})
+
+	rec := httptest.NewRecorder()
+	h.HandleWeb(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if body := rec.Body.String(); !strings.Contains(body, "Cat &amp; Mouse - Tom &amp; Jerry") {
+		t.Errorf("names are not escaped:\n%s", body)
+	}
+}
+
+func TestHandleWebItemDetails(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Action/Heat.mp4": strings.Repeat("x", 1536)})
+	link := "http://tv.local:8081/stream?id=" + entryByName(t, h, "Heat.mp4").UUID.String()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "tv.local:8081"
+	rec := httptest.NewRecorder()
+	h.HandleWeb(rec, req)
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"1.5 KB",
+		`<a href="` + link + `">open in player</a>`,
+		`data-url="` + link + `"`,
+		`<a href="/download/` + entryByName(t, h, "Heat.mp4").UUID.String() + `" download>download</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("item has no %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestHandleWebPlaylists(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{"Heat.mp4": "x"})
+	heat := entryByName(t, h, "Heat.mp4").UUID
+	p, err := h.Playlists.Add("Tom & Jerry night", []uuid.UUID{heat})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.HandleWeb(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`<input type="checkbox" name="id" value="` + heat.String() + `" form="new-playlist"`,
+		`<a href="/playlist/` + p.ID.String() + `.m3u">Tom &amp; Jerry night</a> (1 titles)`,
+		`data-url="/api/playlists/` + p.ID.String() + `"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page has no %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestHandleWebSearch(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Die Hard.mp4":        "x",
+		"Action/Speed.mp4":           "x",
+		"Comedy/Hard Boiled Fun.mp4": "x",
+		"Comedy/Airplane.m4v":        "x",
+	})
+
+	tests := []struct {
+		name      string
+		query     string
+		wantNames []string
+		wantEmpty bool
+	}{
+		{"ok - matches name", "?q=hard", []string{"Die Hard", "Hard Boiled Fun"}, false},
+		{"ok - keeps the category", "?q=hard&category=Comedy", []string{"Hard Boiled Fun"}, false},
+		{"ok - nothing found", "?q=alien", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			h.HandleWeb(rec, httptest.NewRequest(http.MethodGet, "/"+tt.query, nil))
+			body := rec.Body.String()
+
+			if got := listedNames(body); strings.Join(got, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("names = %v, want %v", got, tt.wantNames)
+			}
+			if got := strings.Contains(body, "Nothing found"); got != tt.wantEmpty {
+				t.Errorf("nothing found shown = %v, want %v", got, tt.wantEmpty)
+			}
+		})
+	}
+}
+
+func TestHandleWebSearchPages(t *testing.T) {
+	t.Parallel()
+
+	h := webLibrary(t)
+
+	page, err := h.webPage(httptest.NewRequest(http.MethodGet, "/?q=a&category=Action&size=2", nil))
+	if err != nil {
+		t.Fatalf("webPage() error = %v", err)
+	}
+	// the next page keeps the search and the category
+	if want := "/?category=Action&page=2&q=a&size=2"; page.NextURL != want {
+		t.Errorf("next = %q, want %q", page.NextURL, want)
+	}
+}
+
+func TestHandleWebSearchEscapesQuery(t *testing.T) {
+	t.Parallel()
+
+	h := webLibrary(t)
+
+	rec := httptest.NewRecorder()
+	h.HandleWeb(rec, httptest.NewRequest(http.MethodGet, `/?q=%22%3E%3Cscript%3Ealert(1)%3C/script%3E`, nil))
+	body := rec.Body.String()
+
+	if strings.Contains(body, "<script>alert") || strings.Contains(body, `"><`) {
+		t.Errorf("query echoed unescaped:\n%s", body)
+	}
+	if !strings.Contains(body, `value="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"`) {
+		t.Errorf("query not echoed into the search box:\n%s", body)
+	}
+}
+
+func TestHandleWebSortAndCategories(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Action/Die Hard.mp4": "xx",
+		"Action/Speed.mp4":    "xxxx",
+		"Comedy/Airplane.m4v": "xxx",
+	})
+
+	// Speed is the newest, Die Hard the oldest
+	root := h.Media.Volumes[testMountID].RootPath
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"Action/Die Hard.mp4", "Comedy/Airplane.m4v", "Action/Speed.mp4"} {
+		mtime := base.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(filepath.Join(root, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Media.Registry.Scan(testMountID, root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantNames []string
+		wantLinks []string
+	}{
+		{"ok - by name", "", http.StatusOK, []string{"Airplane", "Die Hard", "Speed"},
+			[]string{`<a href="/?category=Action&page=1">Action (2)</a>`, `<a href="/?page=1&sort=newest">newest</a>`}},
+		{"ok - newest first", "?sort=newest", http.StatusOK, []string{"Speed", "Airplane", "Die Hard"},
+			[]string{`<a href="/?category=Comedy&page=1&sort=newest">Comedy (1)</a>`, `<a href="/?page=1&sort=newest" class="selected">newest</a>`}},
+		{"ok - largest first in a category", "?sort=size&category=Action", http.StatusOK, []string{"Speed", "Die Hard"},
+			[]string{`<a href="/?page=1&sort=size">all</a>`, `<a href="/?category=Action&page=1&sort=size" class="selected">Action (2)</a>`,
+				`<a href="/?category=Action&page=1">name</a>`}},
+		{"fail - unknown sort", "?sort=rating", http.StatusBadRequest, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			h.HandleWeb(rec, httptest.NewRequest(http.MethodGet, "/"+tt.query, nil))
+			body := rec.Body.String()
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := listedNames(body); strings.Join(got, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("names = %v, want %v", got, tt.wantNames)
+			}
+			// links keep the other selections, the current ones are marked
+			for _, link := range tt.wantLinks {
+				if !strings.Contains(body, link) {
+					t.Errorf("page has no %s in\n%s", link, body)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleWebCollation(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{"Films/10 Things.mp4": "x", "Films/2 Fast.mp4": "x", "Films/épisode.mp4": "x", "Films/Zebra.mp4": "x"}
+	h := newTestHandler(t, files)
+	natural := newTestHandler(t, files)
+	natural.Media.Registry.SetCollation(media.CollateLocale)
+
+	tests := []struct {
+		name      string
+		h         *Handler
+		query     string
+		wantCode  int
+		wantNames []string
+		wantLink  string
+	}{
+		{"ok - bytes", h, "", http.StatusOK, []string{"10 Things", "2 Fast", "Zebra", "épisode"}, `<a href="/?page=1&sort=newest">newest</a>`},
+		{"ok - asked for", h, "?collate=locale", http.StatusOK, []string{"2 Fast", "10 Things", "épisode", "Zebra"}, `<a href="/?collate=locale&page=1&sort=newest">newest</a>`},
+		{"ok - configured", natural, "", http.StatusOK, []string{"2 Fast", "10 Things", "épisode", "Zebra"}, `<a href="/?page=1&sort=newest">newest</a>`},
+		{"ok - configured, bytes asked for", natural, "?collate=bytes", http.StatusOK, []string{"10 Things", "2 Fast", "Zebra", "épisode"}, `<a href="/?collate=bytes&page=1&sort=newest">newest</a>`},
+		{"fail - unknown collation", h, "?collate=fr_FR", http.StatusBadRequest, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			tt.h.HandleWeb(rec, httptest.NewRequest(http.MethodGet, "/"+tt.query, nil))
+			body := rec.Body.String()
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := listedNames(body); strings.Join(got, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("names = %v, want %v", got, tt.wantNames)
+			}
+			if !strings.Contains(body, tt.wantLink) {
+				t.Errorf("page has no %s in\n%s", tt.wantLink, body)
+			}
+		})
+	}
+}
+
+func TestHandleCategories(t *testing.T) {
+	t.Parallel()
+
+	h := webLibrary(t)
+
+	rec := httptest.NewRecorder()
+	h.HandleCategories(rec, httptest.NewRequest(http.MethodGet, "/api/categories", nil))
+
+	if got, want := strings.TrimSpace(rec.Body.String()), `[{"name":"Action","count":5},{"name":"Comedy","count":3}]`; got != want {
+		t.Errorf("categories = %s, want %s", got, want)
+	}
+}
+
+func TestHandleWebViews(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandler(t, map[string]string{
+		"Heat.mkv":        "x",
+		"Heat-poster.jpg": "x",
+		"Ronin.mp4":       "x",
+	})
+	heatThumb := `<img src="/thumb/` + entryByName(t, h, "Heat.mkv").UUID.String() + `" alt="" loading="lazy" decoding="async">`
+
+	tests := []struct {
+		name       string
+		target     string
+		cookie     string
+		wantCode   int
+		wantGrid   bool
+		wantCookie string
+	}{
+		{"ok - list by default", "/", "", http.StatusOK, false, ""},
+		{"ok - grid asked for", "/?view=grid", "", http.StatusOK, true, "grid"},
+		{"ok - grid remembered", "/", "grid", http.StatusOK, true, ""},
+		{"ok - list asked for over the cookie", "/?view=list", "grid", http.StatusOK, false, "list"},
+		{"ok - unknown cookie", "/", "cards", http.StatusOK, false, ""},
+		{"fail - unknown view", "/?view=cards", "", http.StatusBadRequest, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: viewCookie, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			h.HandleWeb(rec, req)
+			body := rec.Body.String()
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s status = %d, want %d", tt.target, rec.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var gotCookie string
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == viewCookie {
+					gotCookie = c.Value
+				}
+			}
+			if gotCookie != tt.wantCookie {
+				t.Errorf("view cookie set to %q, want %q", gotCookie, tt.wantCookie)
+			}
+
+			if !tt.wantGrid {
+				if got := listedNames(body); strings.Join(got, ",") != "Heat,Ronin" {
+					t.Errorf("list shows %v", got)
+				}
+				if strings.Contains(body, `class="card"`) || !strings.Contains(body, `<div id="items" class="list">`) {
+					t.Errorf("list page has grid markup:\n%s", body)
+				}
+				return
+			}
+			for _, want := range []string{
+				`<div id="items" class="grid">`,
+				heatThumb,
+				`<span class="placeholder">`,
+				`<span class="title">Ronin</span>`,
+				`<a href="/?page=1&view=list">list</a>`,
+				`<a href="/?page=1&view=grid" class="selected">grid</a>`,
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("grid page has no %s:\n%s", want, body)
+				}
+			}
+			if got := strings.Count(body, `<img src="/thumb/`); got != 1 {
+				t.Errorf("grid has %d images, want 1 for the one poster", got)
+			}
+			if got := listedNames(body); len(got) != 0 {
+				t.Errorf("grid page also lists %v", got)
+			}
+		})
+	}
+}
+
+func TestHandleWebItemsGrid(t *testing.T) {
+	t.Parallel()
+
+	h := webLibrary(t)
+
+	rec := httptest.NewRecorder()
+	h.HandleWebItems(rec, httptest.NewRequest(http.MethodGet, "/web/items?view=grid&size=2&page=2", nil))
+	body := rec.Body.String()
+
+	if got := strings.Count(body, `<a class="card"`); got != 2 {
+		t.Errorf("fragment has %d cards, want 2:\n%s", got, body)
+	}
+	if !strings.Contains(body, `data-next="/web/items?page=3&size=2&view=grid"`) {
+		t.Errorf("next fragment is not a grid one:\n%s", body)
+	}
+	// the fragments come from the scrolling script, only links someone follows pick a view for good
+	if c := rec.Result().Cookies(); len(c) != 0 {
+		t.Errorf("fragment sets cookies %v", c)
+	}
+}
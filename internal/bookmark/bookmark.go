@@ -0,0 +1,133 @@
+// Package bookmark keeps resume positions: where a client stopped watching an entry, so the next time it
+// can pick up from there
+package bookmark
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// DefaultMax is how many bookmarks a store keeps before it forgets the oldest
+const DefaultMax = 10000
+
+// Key is whose bookmark it is, an entry and the client that watched it
+type Key struct {
+	ID     uuid.UUID `json:"id"`
+	Client string    `json:"client"` // the IP of a renderer, or the cookie of a browser
+}
+
+// Bookmark is a resume position, the form the registry cache keeps them in
+type Bookmark struct {
+	Key
+	Position time.Duration `json:"position"`
+	Updated  time.Time     `json:"updated"`
+}
+
+// Store holds the bookmarks in memory, it is safe for concurrent use
+type Store struct {
+	Max int // the oldest bookmarks are forgotten past this many
+
+	mu    sync.Mutex
+	marks map[Key]Bookmark
+}
+
+func NewStore() *Store {
+	return &Store{
+		Max:   DefaultMax,
+		marks: make(map[Key]Bookmark),
+	}
+}
+
+// Set remembers the position of key, zero forgets it, e.g. once the film has been watched to the end
+func (s *Store) Set(key Key, pos time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pos <= 0 {
+		delete(s.marks, key)
+		return
+	}
+	s.marks[key] = Bookmark{Key: key, Position: pos, Updated: time.Now()}
+	s.evict()
+}
+
+// Get returns the position of key, false when there is none
+func (s *Store) Get(key Key) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.marks[key]
+	return b.Position, ok
+}
+
+// Len returns the number of bookmarks
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.marks)
+}
+
+// Prune forgets the bookmarks of entries exists doesn't know anymore and returns how many went
+func (s *Store) Prune(exists func(uuid.UUID) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := 0
+	for key := range s.marks {
+		if !exists(key.ID) {
+			delete(s.marks, key)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// List returns every bookmark, ordered by entry and client so the cache file only changes with them
+func (s *Store) List() []Bookmark {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	marks := make([]Bookmark, 0, len(s.marks))
+	for _, b := range s.marks {
+		marks = append(marks, b)
+	}
+	slices.SortFunc(marks, func(a, b Bookmark) int {
+		return cmp.Or(bytes.Compare(a.ID[:], b.ID[:]), cmp.Compare(a.Client, b.Client))
+	})
+	return marks
+}
+
+// Restore puts the bookmarks of a cache back, ones already set are kept
+func (s *Store) Restore(marks []Bookmark) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range marks {
+		if _, ok := s.marks[b.Key]; ok || b.ID.IsNil() || b.Position <= 0 {
+			continue
+		}
+		s.marks[b.Key] = b
+	}
+	s.evict()
+}
+
+// evict forgets the least recently updated bookmarks past Max, every client with a new cookie adds some
+func (s *Store) evict() {
+	if s.Max <= 0 || len(s.marks) <= s.Max {
+		return
+	}
+
+	marks := make([]Bookmark, 0, len(s.marks))
+	for _, b := range s.marks {
+		marks = append(marks, b)
+	}
+	slices.SortFunc(marks, func(a, b Bookmark) int { return a.Updated.Compare(b.Updated) })
+	for _, b := range marks[:len(marks)-s.Max] {
+		delete(s.marks, b.Key)
+	}
+}
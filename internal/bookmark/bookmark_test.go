@@ -0,0 +1,120 @@
+package bookmark
+
+import (
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	s := NewStore()
+	film, other := uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7())
+	tv := Key{ID: film, Client: "10.0.0.2"}
+
+	s.Set(tv, 42*time.Minute)
+	s.Set(Key{ID: film, Client: "cookie:abc"}, time.Minute)
+
+	tests := []struct {
+		name   string
+		key    Key
+		want   time.Duration
+		wantOK bool
+	}{
+		{"ok - set", tv, 42 * time.Minute, true},
+		{"ok - per client", Key{ID: film, Client: "cookie:abc"}, time.Minute, true},
+		{"fail - other client", Key{ID: film, Client: "10.0.0.3"}, 0, false},
+		{"fail - other entry", Key{ID: other, Client: "10.0.0.2"}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := s.Get(tt.key)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Get(%v) = %v, %v, want %v, %v", tt.key, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// watched to the end
+	s.Set(tv, 0)
+	if _, ok := s.Get(tv); ok {
+		t.Error("Set() with zero kept the bookmark")
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	t.Parallel()
+
+	s := NewStore()
+	kept, removed := uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7())
+	s.Set(Key{ID: kept, Client: "a"}, time.Minute)
+	s.Set(Key{ID: removed, Client: "a"}, time.Minute)
+	s.Set(Key{ID: removed, Client: "b"}, time.Minute)
+
+	if got := s.Prune(func(id uuid.UUID) bool { return id == kept }); got != 2 {
+		t.Errorf("Prune() = %d, want 2", got)
+	}
+	if got := s.Len(); got != 1 {
+		t.Errorf("Len() = %d after pruning, want 1", got)
+	}
+}
+
+func TestStoreRestore(t *testing.T) {
+	t.Parallel()
+
+	before := NewStore()
+	a := Key{ID: uuid.Must(uuid.NewV7()), Client: "a"}
+	b := Key{ID: uuid.Must(uuid.NewV7()), Client: "b"}
+	before.Set(b, 2*time.Minute)
+	before.Set(a, time.Minute)
+
+	after := NewStore()
+	after.Set(a, 5*time.Minute)
+	after.Restore(append(before.List(), Bookmark{Key: Key{Client: "no id"}, Position: time.Minute}))
+
+	if got, _ := after.Get(a); got != 5*time.Minute {
+		t.Errorf("restored over a newer bookmark: %v", got)
+	}
+	if got, _ := after.Get(b); got != 2*time.Minute {
+		t.Errorf("Get(b) = %v, want the restored position", got)
+	}
+	if got := after.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+
+	// ordered so the cache doesn't change when nothing did
+	list := after.List()
+	if list[0].ID.String() > list[1].ID.String() {
+		t.Errorf("List() not ordered by entry: %v", list)
+	}
+}
+
+func TestStoreForgetsOldest(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		s := NewStore()
+		s.Max = 2
+
+		keys := []Key{{ID: uuid.Must(uuid.NewV7())}, {ID: uuid.Must(uuid.NewV7())}, {ID: uuid.Must(uuid.NewV7())}}
+		for _, k := range keys[:2] {
+			s.Set(k, time.Minute)
+			time.Sleep(time.Second)
+		}
+		// touching the first makes the second the oldest
+		s.Set(keys[0], 2*time.Minute)
+		time.Sleep(time.Second)
+		s.Set(keys[2], time.Minute)
+
+		if got := s.Len(); got != 2 {
+			t.Fatalf("Len() = %d, want Max", got)
+		}
+		if _, ok := s.Get(keys[1]); ok {
+			t.Error("the least recently updated bookmark was kept")
+		}
+	})
+}
@@ -1,13 +1,22 @@
 package config
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"streamer/internal/api"
 	"streamer/internal/media"
+	"streamer/internal/middleware"
+	"streamer/internal/schedule"
 	"strings"
 	"time"
 	"unicode"
@@ -20,28 +29,81 @@ type HttpTimeoutsConfig struct {
 	Idle     time.Duration
 	Write    time.Duration
 	Shutdown time.Duration // how long we give the shutdown process to gracefully terminate
+	Drain    time.Duration // how long in-flight streams may keep playing once shutdown starts
 }
 
 type HTTPConfig struct {
 	Addr         string
 	Timeouts     HttpTimeoutsConfig
 	TrustedProxy bool
+	BindRetries  int           // extra attempts when the port is still in use, 0 fails at once
+	BindBackoff  time.Duration // wait before the first retry, doubled after each one
+
+	// ExternalURL is what every absolute URL handed out starts with (scheme, host and an optional path
+	// prefix), empty builds them from the request
+	ExternalURL string
+	// TrustedProxies are the peers whose X-Forwarded-Proto, -Host and -Prefix headers build the URLs
+	TrustedProxies []netip.Prefix
 }
 
 type ShutdownTimersConfig struct {
 	InactiveLimit time.Duration
 	SleepTimer    time.Duration
 	TimeToEnd     time.Time
+	Warning       time.Duration              // announce the shutdown this long before it happens
+	WarningRefuse bool                       // refuse new streams during the warning of a scheduled shutdown
+	Exec          string                     // command run after a timer-initiated shutdown, e.g. poweroff
+	ExecTimeout   time.Duration              // how long Exec may run before it is killed
+	Ignore        []middleware.ActivityClass // requests of these classes don't reset InactiveLimit
 }
 
 type MediaConfig struct {
 	Mode         media.ResourceMode // "direct" or "buffered"
 	BufferSize   int
+	ZeroCopy     bool               // sendfile in direct mode, off for filesystems where it misbehaves
+	FairIO       bool               // share the read slots of a volume between clients instead of first come first served
+	Priorities   []api.PriorityRule // read slot priority of renderers by User-Agent, the first match wins
+	MaxWait      time.Duration      // how long a lower priority read may be passed over for a slot
 	FriendlyName string
-	UUID         string
+	UUID         string // empty until the app settles it, from UUIDFile or a new one
+	UUIDFile     string // keeps the UUID generated when none was given, so it's the same after a restart
 	Volumes      []VolumeConfig
+	Startup      StartupPolicy            // what to do when no volume is usable at startup
+	ScanOnStart  ScanOnStart              // whether the first scan holds up serving
+	ScanTimeout  time.Duration            // how long a blocking first scan may hold it up
+	ScanStall    time.Duration            // how long a scan may go without getting through a directory before the watchdog counts it stuck
+	Incremental  bool                     // periodic scans read only the directories whose mtime changed
+	FullEvery    int                      // with Incremental, every how many periodic scans still read everything
+	Settle       time.Duration            // how long a video must go unwritten before a scan takes it
+	Cache        string                   // file keeping entry UUIDs and resume positions across restarts, empty keeps them in memory
+	Folders      []api.Folder             // virtual folders at the root of Browse, none lists every video there
+	Recent       int                      // videos in the recently added folder
+	BrowseMax    int                      // most children a Browse answers with at once, 0 has no cap
+	Collation    media.Collation          // how names sort, wherever entries are listed by name
+	MinFree      int64                    // warn when a scan finds less free space on a volume, 0 never does
+	WarmUp       int64                    // bytes read ahead in the background when a stream starts, 0 doesn't
+	Journal      int                      // library changes /api/changes keeps
+	MediaTypes   map[string]api.MediaType // MIME type and DLNA profile by lowercase extension, over the built-in ones
 }
 
+// ScanOnStart decides whether the server waits for the first scan before it serves and announces
+type ScanOnStart string
+
+const (
+	ScanBlock      ScanOnStart = "block"      // serve once the first scan is done or timed out
+	ScanBackground ScanOnStart = "background" // serve right away, /readyz is 503 until the scan is done
+)
+
+// StartupPolicy decides what happens when none of the volumes can be used at startup, e.g. the USB
+// drive they live on isn't plugged in
+type StartupPolicy string
+
+const (
+	StartupFail       StartupPolicy = "fail"        // refuse to start
+	StartupWait       StartupPolicy = "wait"        // start, but only announce once a volume has entries
+	StartupServeEmpty StartupPolicy = "serve-empty" // start and announce an empty library
+)
+
 type VolumeConfig struct {
 	ID    string
 	MaxIO int
@@ -50,6 +112,31 @@ type VolumeConfig struct {
 
 type LogConfig struct {
 	Level slog.Level
+	File  string // append logs here instead of stderr
+}
+
+type AdminConfig struct {
+	Token string // shared secret for the admin api, empty disables it
+}
+
+type ServeConfig struct {
+	Windows  []schedule.Window // when the server is on the air, empty means always
+	Location *time.Location    // where the window times are read, nil means local time
+}
+
+type MetricsConfig struct {
+	Runtime bool // include the process and Go runtime collectors
+}
+
+type HLSConfig struct {
+	Enabled bool
+	FFmpeg  string        // the ffmpeg binary, looked up in PATH unless it is a path
+	Idle    time.Duration // a remux session is removed once its client stopped asking for it this long
+}
+
+type RemuxConfig struct {
+	NoMKV  []string // User-Agent substrings of renderers that refuse MKV, they get it remuxed to MP4
+	FFmpeg string   // the ffmpeg binary, looked up in PATH unless it is a path
 }
 
 type Config struct {
@@ -57,6 +144,16 @@ type Config struct {
 	ShutdownTimers ShutdownTimersConfig
 	Media          MediaConfig
 	Logger         LogConfig
+	Metrics        MetricsConfig
+	Admin          AdminConfig
+	Serve          ServeConfig
+	HLS            HLSConfig
+	Remux          RemuxConfig
+	PIDFile        string        // single-instance lock, empty disables it
+	Preflight      bool          // check ports, multicast, volumes and the advertised IP before starting
+	UpgradeTimeout time.Duration // how long the new process gets to start serving on SIGUSR2
+	SelfTest       bool          // boot against a generated library, check it the way a renderer would and exit
+	Kiosk          bool          // browsing and streaming only, no route that administers or changes state
 }
 
 type mountFlag []VolumeConfig
@@ -96,8 +193,72 @@ func (m *mountFlag) Set(value string) error {
 	return nil
 }
 
+type mediaTypeFlag map[string]api.MediaType
+
+func (m *mediaTypeFlag) String() string {
+	return "Media type: EXT:MIME[:PROFILE]"
+}
+
+func (m *mediaTypeFlag) Set(value string) error {
+	// Expected: ".ts:video/vnd.dlna.mpeg-tts:MPEG_TS_HD_NA_ISO"
+	ext, t, err := parseMediaType(value)
+	if err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = make(mediaTypeFlag)
+	}
+	(*m)[ext] = t
+	return nil
+}
+
+// parseMediaType reads an EXT:MIME[:PROFILE] override, the extension lowercased with its dot
+func parseMediaType(value string) (string, api.MediaType, error) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) < 2 {
+		return "", api.MediaType{}, fmt.Errorf("invalid format %q, expected 'ext:mime' or 'ext:mime:profile'", value)
+	}
+
+	ext := strings.ToLower(strings.TrimSpace(parts[0]))
+	if len(ext) < 2 || !strings.HasPrefix(ext, ".") || strings.ContainsAny(ext[1:], "./\\ ") {
+		return "", api.MediaType{}, fmt.Errorf("invalid extension %q, expected a dot and a name, e.g. .ts", parts[0])
+	}
+
+	mime := strings.TrimSpace(parts[1])
+	typ, subtype, ok := strings.Cut(mime, "/")
+	if !ok || typ == "" || subtype == "" || strings.ContainsAny(mime, " ,;:") || strings.Count(mime, "/") != 1 {
+		return "", api.MediaType{}, fmt.Errorf("invalid mime type %q, expected type/subtype", mime)
+	}
+
+	var profile string
+	if len(parts) == 3 {
+		// it ends up in protocolInfo, where these separate the fields
+		if profile = strings.TrimSpace(parts[2]); profile == "" || strings.ContainsAny(profile, " ,;:") {
+			return "", api.MediaType{}, fmt.Errorf("invalid DLNA profile %q", parts[2])
+		}
+	}
+	return ext, api.MediaType{MIME: mime, DLNAProfile: profile}, nil
+}
+
+type windowFlag []schedule.Window
+
+func (w *windowFlag) String() string {
+	return "Serving window: [days] HH:MM-HH:MM"
+}
+
+func (w *windowFlag) Set(value string) error {
+	// Expected: "mon-fri 17:00-23:30"
+	window, err := schedule.ParseWindow(value)
+	if err != nil {
+		return err
+	}
+	*w = append(*w, window)
+	return nil
+}
+
 const (
 	defaultBufferSize = 10 * 1024 * 1024
+	defaultMinFree    = 1024 * 1024 * 1024
 	noTimeout         = time.Duration(0)
 )
 
@@ -110,28 +271,78 @@ func DefaultConfig() *Config {
 				Idle:     30 * time.Second,
 				Write:    1 * time.Hour,
 				Shutdown: 15 * time.Second,
+				Drain:    30 * time.Minute,
 			},
 			TrustedProxy: false,
+			BindRetries:  0,
+			BindBackoff:  500 * time.Millisecond,
 		},
 		Media: MediaConfig{
 			Mode:         media.ModeFileBuffered,
 			BufferSize:   defaultBufferSize,
+			MinFree:      defaultMinFree,
+			MaxWait:      10 * time.Second,
+			ZeroCopy:     true,
 			FriendlyName: "GoStream Server",
 			UUID:         "",
+			UUIDFile:     defaultUUIDFile(),
 			Volumes:      []VolumeConfig{},
+			Startup:      StartupFail,
+			ScanOnStart:  ScanBackground,
+			ScanTimeout:  30 * time.Second,
+			ScanStall:    30 * time.Minute,
+			Incremental:  false,
+			FullEvery:    12,
+			Settle:       10 * time.Second,
+			Folders:      api.Folders,
+			Recent:       50,
+			Journal:      media.DefaultJournalSize,
+			BrowseMax:    500,
+			Collation:    media.CollateBytes,
 		},
 		ShutdownTimers: ShutdownTimersConfig{
 			InactiveLimit: 30 * time.Minute,
 			SleepTimer:    noTimeout,
 			TimeToEnd:     time.Time{},
+			Warning:       60 * time.Second,
+			WarningRefuse: false,
+			ExecTimeout:   30 * time.Second,
+			Ignore:        []middleware.ActivityClass{middleware.ActivityDiscovery},
 		},
 		Logger: LogConfig{
 			Level: slog.LevelInfo,
 		},
+		Metrics: MetricsConfig{
+			Runtime: true,
+		},
+		HLS: HLSConfig{
+			Enabled: false,
+			FFmpeg:  "ffmpeg",
+			Idle:    2 * time.Minute,
+		},
+		Remux: RemuxConfig{
+			FFmpeg: "ffmpeg",
+		},
+		Preflight:      true,
+		UpgradeTimeout: 30 * time.Second,
 	}
 }
 
+// ErrInvalidConfig is wrapped by every error ParseArgs returns, except flag.ErrHelp
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// ParseArgs fills cfg from the command line and validates it
 func ParseArgs(cfg *Config, args []string, stderr io.Writer) error {
+	if err := parseArgs(cfg, args, stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	return nil
+}
+
+func parseArgs(cfg *Config, args []string, stderr io.Writer) error {
 	defaultCfg := DefaultConfig()
 
 	fs := flag.NewFlagSet("gomediaserver", flag.ContinueOnError)
@@ -148,42 +359,206 @@ func ParseArgs(cfg *Config, args []string, stderr io.Writer) error {
 
 	fs.StringVar(&cfg.HTTP.Addr, "http.addr", defaultCfg.HTTP.Addr, "http address to listen on")
 
+	fs.IntVar(&cfg.HTTP.BindRetries, "http.bindRetries", defaultCfg.HTTP.BindRetries, "Retry binding http.addr this many times while the port is still in use (e.g. right after a restart)")
+
+	fs.DurationVar(&cfg.HTTP.BindBackoff, "http.bindBackoff", defaultCfg.HTTP.BindBackoff, "Wait before the first bind retry, doubled for each further one")
+
+	fs.DurationVar(&cfg.HTTP.Timeouts.Drain, "http.timeouts.drain", defaultCfg.HTTP.Timeouts.Drain, "How long active streams may finish before shutdown cuts them (e.g. 30m)")
+
 	var modeStr string
 	fs.StringVar(&modeStr, "media.mode", "buffered", "Resource mode: direct, buffered")
 
 	var bufferSizeStr string
 	fs.StringVar(&bufferSizeStr, "media.bufferSize", "10MB", "Read buffer size (e.g. 10MB, 512KB)")
 
+	fs.BoolVar(&cfg.Media.ZeroCopy, "media.zeroCopy", defaultCfg.Media.ZeroCopy, "In direct mode, send files with sendfile; turn off for filesystems where it misbehaves (some FUSE mounts)")
+
 	var logLevelStr string
 	fs.StringVar(&logLevelStr, "logger.level", "info", "Log level (debug, info, warn, error)")
 
+	fs.StringVar(&cfg.Logger.File, "logger.file", defaultCfg.Logger.File, "Append logs to this file instead of stderr (a Windows service logs next to the executable by default)")
+
 	var friendlyNameStr string
 	fs.StringVar(&friendlyNameStr, "media.friendlyName", defaultCfg.Media.FriendlyName, "DLNA server name (max 64 chars)")
 
 	// we can store the parsing result in the cfg object as the default uuid is a blank string
-	fs.StringVar(&cfg.Media.UUID, "media.uuid", defaultCfg.Media.UUID, "Server UUID (unique identifier). Generated randomly on startup if empty.")
+	fs.StringVar(&cfg.Media.UUID, "media.uuid", defaultCfg.Media.UUID, "Server UUID (unique identifier). Read from -media.uuidFile if empty, or generated and kept there")
+
+	fs.StringVar(&cfg.Media.UUIDFile, "media.uuidFile", defaultCfg.Media.UUIDFile, "File keeping the generated server UUID across restarts, empty generates a new one on every start")
 
 	fs.DurationVar(&cfg.ShutdownTimers.InactiveLimit, "shutdown.inactive", defaultCfg.ShutdownTimers.InactiveLimit, "Shutdown after duration of inactivity (e.g. 30m)")
 
 	fs.DurationVar(&cfg.ShutdownTimers.SleepTimer, "shutdown.sleep", defaultCfg.ShutdownTimers.SleepTimer, "Shutdown after specific duration (e.g. 2h)")
 
+	fs.DurationVar(&cfg.ShutdownTimers.Warning, "shutdown.warning", defaultCfg.ShutdownTimers.Warning, "Announce an automatic shutdown this long before it happens (0 disables)")
+
+	fs.BoolVar(&cfg.ShutdownTimers.WarningRefuse, "shutdown.warningRefuse", defaultCfg.ShutdownTimers.WarningRefuse, "Refuse new streams while a scheduled shutdown is imminent")
+
+	// only called when the flag is given, so an explicitly empty command is caught
+	fs.Func("shutdown.exec", "Command to run after the server stopped on a timer (e.g. \"systemctl poweroff\"), not after ctrl+c", func(v string) error {
+		command, err := validateShutdownExec(v)
+		cfg.ShutdownTimers.Exec = command
+		return err
+	})
+
+	fs.Func("shutdown.ignore", "Request classes that don't count as activity, comma separated from discovery, browse, stream, playlist, web and admin, empty counts all (default discovery)", func(v string) error {
+		classes, err := parseActivityClasses(v)
+		cfg.ShutdownTimers.Ignore = classes
+		return err
+	})
+
+	fs.DurationVar(&cfg.ShutdownTimers.ExecTimeout, "shutdown.execTimeout", defaultCfg.ShutdownTimers.ExecTimeout, "Kill the shutdown.exec command after this long")
+
 	var timeToEndStr string
 	fs.StringVar(&timeToEndStr, "shutdown.at", "", "Shutdown at specific time (format HH:MM, e.g. 23:30)")
 
+	var startupStr string
+	fs.StringVar(&startupStr, "media.startup", string(defaultCfg.Media.Startup), "When no volume is usable at startup: fail, wait (announce once a volume has entries) or serve-empty")
+
+	var scanOnStartStr string
+	fs.StringVar(&scanOnStartStr, "media.scanOnStart", string(defaultCfg.Media.ScanOnStart), "Initial scan: block (serve and announce once it is done) or background")
+
+	fs.DurationVar(&cfg.Media.ScanTimeout, "media.scanTimeout", defaultCfg.Media.ScanTimeout, "With media.scanOnStart=block, start serving after this long even if the scan is still running")
+
+	fs.DurationVar(&cfg.Media.ScanStall, "media.scanStall", defaultCfg.Media.ScanStall, "Under the systemd watchdog, count a scan as stuck once it went this long without getting through a directory")
+
+	fs.BoolVar(&cfg.Media.Incremental, "media.incrementalScan", defaultCfg.Media.Incremental, "Periodic scans only read the directories whose mtime changed since the last one")
+
+	fs.IntVar(&cfg.Media.FullEvery, "media.fullScanEvery", defaultCfg.Media.FullEvery, "With media.incrementalScan, every how many periodic scans still read every directory")
+	fs.DurationVar(&cfg.Media.Settle, "media.settle", defaultCfg.Media.Settle, "Leave videos written to within this long out of a scan until the next one, so files still being copied aren't listed half done; 0 takes them as they are")
+
+	fs.StringVar(&cfg.Media.Cache, "media.cache", defaultCfg.Media.Cache, "Keep entry ids and resume positions in this file across restarts, empty keeps them in memory only")
+
+	fs.Func("media.folders", "Virtual folders at the root of what TVs browse, comma separated from all, recent and categories, empty lists every video there (default all,recent,categories)", func(v string) error {
+		folders, err := parseFolders(v)
+		cfg.Media.Folders = folders
+		return err
+	})
+
+	fs.IntVar(&cfg.Media.Recent, "media.recent", defaultCfg.Media.Recent, "Videos in the recently added folder")
+	fs.IntVar(&cfg.Media.Journal, "media.journal", defaultCfg.Media.Journal, "Library changes kept for /api/changes, a client further behind lists everything again")
+	fs.IntVar(&cfg.Media.BrowseMax, "media.browseMax", defaultCfg.Media.BrowseMax, "Most videos or folders a Browse answers with at once, clients asking for more page through the rest (0 has no cap)")
+
+	fs.Func("media.collation", "How names sort: bytes, natural (numbers in names compare as numbers) or locale (Unicode collation ignoring case and accents, numbers as numbers), locale:<language> for the order of a language such as locale:sv (default bytes)", func(v string) error {
+		c, err := media.ParseCollation(v)
+		cfg.Media.Collation = c
+		return err
+	})
+
+	var warmUpStr string
+	fs.StringVar(&warmUpStr, "media.warmUp", "0", "Read the first bytes of a file in the background as its stream starts, to wake a sleeping disk before the TV gives up (e.g. 8MB), 0 doesn't")
+
+	var minFreeStr string
+	fs.StringVar(&minFreeStr, "media.minFree", "1GB", "Warn when a scan finds less free space than this on a volume's disk (e.g. 5GB), 0 never does")
+
 	var maxIO int
 	// TODO make this a little better - magic number here?
 	fs.IntVar(&maxIO, "media.maxIO", 10, "Max concurrent disk reads")
 
+	fs.BoolVar(&cfg.Media.FairIO, "media.fairIO", defaultCfg.Media.FairIO, "Hand a free read slot to a client that holds none before one that already reads")
+
+	fs.Func("media.priority", "Read slot priority of renderers by a part of their User-Agent, as class=part,part (e.g. \"high=samsung,bravia\" or \"low=wget,curl\"), repeatable; the priority query parameter overrides it", func(v string) error {
+		rule, err := parsePriorityRule(v)
+		cfg.Media.Priorities = append(cfg.Media.Priorities, rule)
+		return err
+	})
+
+	fs.DurationVar(&cfg.Media.MaxWait, "media.priorityMaxWait", defaultCfg.Media.MaxWait, "Serve a read of a lower priority like a high one once it waited this long for a slot, 0 lets it wait as long as higher ones come")
+
 	var mounts mountFlag
 	fs.Var(&mounts, "media.mount", "Mount grouped volumes: ID:Limit:Path1,Path2,...")
 
+	var mediaTypes mediaTypeFlag
+	fs.Var(&mediaTypes, "media.type", "Serve files with this extension as this MIME type and DLNA profile: EXT:MIME[:PROFILE] (e.g. .ts:video/vnd.dlna.mpeg-tts:MPEG_TS_HD_NA_ISO), the files are scanned too. Can be repeated")
+
+	var windows windowFlag
+	fs.Var(&windows, "serve.window", "Only serve and announce during this window: [days] HH:MM-HH:MM (e.g. \"mon-fri 17:00-23:30\"). Can be repeated")
+
+	var timezoneStr string
+	fs.StringVar(&timezoneStr, "serve.timezone", "", "Time zone of the serve.window times (e.g. Europe/Lisbon), local time if empty")
+
 	fs.BoolVar(&cfg.HTTP.TrustedProxy, "http.trustedProxy", false, "Trust X-Forwarded-For headers (use only behind a reverse proxy)")
 
+	fs.StringVar(&cfg.HTTP.ExternalURL, "http.externalURL", defaultCfg.HTTP.ExternalURL, "Base of every absolute URL handed out (e.g. https://example.com/media), empty builds them from the request")
+
+	fs.Func("http.trustedProxies", "Addresses or CIDRs of reverse proxies whose X-Forwarded-Proto, -Host and -Prefix headers build the URLs handed out, comma separated", func(v string) error {
+		prefixes, err := parseTrustedProxies(v)
+		cfg.HTTP.TrustedProxies = prefixes
+		return err
+	})
+
+	fs.StringVar(&cfg.Admin.Token, "admin.token", defaultCfg.Admin.Token, "Token protecting the admin api and page (bearer or basic auth password). Empty disables them")
+
+	fs.StringVar(&cfg.PIDFile, "pidfile", defaultCfg.PIDFile, "Lock this file and write the PID to it, a second instance using the same file refuses to start")
+
+	fs.BoolVar(&cfg.Preflight, "preflight", defaultCfg.Preflight, "Check the ports, multicast, volume paths and advertised IP before starting, and report all problems at once")
+
+	fs.BoolVar(&cfg.Kiosk, "kiosk", false, "Read-only: serve browsing, playlists and streams only, without the admin api, rescans, playlist changes, hiding, saved progress or event subscriptions")
+
+	fs.BoolVar(&cfg.SelfTest, "selftest", false, "Start on a free port against a generated library, find, browse and stream from it the way a TV would, print a report and exit")
+
+	fs.DurationVar(&cfg.UpgradeTimeout, "upgrade.timeout", defaultCfg.UpgradeTimeout, "On SIGUSR2, how long the new process may take to start serving before the upgrade is called off")
+
+	fs.BoolVar(&cfg.HLS.Enabled, "hls", defaultCfg.HLS.Enabled, "Remux containers browsers can't play (e.g. MKV) to HLS with ffmpeg under /hls")
+
+	fs.StringVar(&cfg.HLS.FFmpeg, "hls.ffmpeg", defaultCfg.HLS.FFmpeg, "ffmpeg binary used by -hls")
+
+	fs.DurationVar(&cfg.HLS.Idle, "hls.idle", defaultCfg.HLS.Idle, "Stop a remux and remove its segments once the client stopped asking for them this long")
+
+	fs.Func("remux.noMKV", "Renderers that refuse MKV by a part of their User-Agent, comma separated (e.g. \"bravia,sony\"); they are offered it remuxed to MP4 with ffmpeg", func(v string) error {
+		cfg.Remux.NoMKV = nil
+		for match := range strings.SplitSeq(v, ",") {
+			if match = strings.TrimSpace(match); match != "" {
+				cfg.Remux.NoMKV = append(cfg.Remux.NoMKV, match)
+			}
+		}
+		return nil
+	})
+
+	fs.StringVar(&cfg.Remux.FFmpeg, "remux.ffmpeg", defaultCfg.Remux.FFmpeg, "ffmpeg binary used by -remux.noMKV")
+
+	fs.BoolVar(&cfg.Metrics.Runtime, "metrics.runtime", defaultCfg.Metrics.Runtime, "Expose process and Go runtime metrics on /metrics")
+
+	var configFile string
+	fs.StringVar(&configFile, "config", "", "Read settings from this TOML file, keys are the flag names with their prefix as a table (e.g. addr under [http]); flags on the command line win over it")
+
 	// parse all flags
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
+	// the environment fills what the command line left out, then the config file what both did, validated
+	// with the rest below
+	if err := applyEnv(fs, os.Getenv); err != nil {
+		return err
+	}
+	if configFile != "" {
+		if err := applyConfigFile(fs, configFile); err != nil {
+			return err
+		}
+	}
+
+	// validate http.addr
+	addr, err := validateHTTPAddr(cfg.HTTP.Addr)
+	if err != nil {
+		return err
+	}
+	cfg.HTTP.Addr = addr
+
+	// validate http.externalURL
+	externalURL, err := validateExternalURL(cfg.HTTP.ExternalURL)
+	if err != nil {
+		return err
+	}
+	cfg.HTTP.ExternalURL = externalURL
+
+	if cfg.HTTP.BindRetries < 0 {
+		return fmt.Errorf("http.bindRetries cannot be negative")
+	}
+	if cfg.HTTP.BindBackoff <= 0 {
+		return fmt.Errorf("http.bindBackoff must be positive")
+	}
+
 	// validate mode
 	mode, err := validateMode(modeStr)
 	if err != nil {
@@ -210,6 +585,12 @@ func ParseArgs(cfg *Config, args []string, stderr io.Writer) error {
 	if err != nil {
 		return err
 	}
+	// two servers left at the default name look like one to some TVs, the host tells them apart
+	if !isSet(fs, "media.friendlyName") {
+		if hostname, err := os.Hostname(); err == nil {
+			friendlyName = withHostname(friendlyName, hostname)
+		}
+	}
 	cfg.Media.FriendlyName = friendlyName
 
 	// validate media.uuid
@@ -219,6 +600,68 @@ func ParseArgs(cfg *Config, args []string, stderr io.Writer) error {
 	}
 	cfg.Media.UUID = mediaUuid
 
+	// validate media.startup
+	startup, err := validateStartupPolicy(startupStr)
+	if err != nil {
+		return err
+	}
+	cfg.Media.Startup = startup
+
+	// validate media.scanOnStart
+	scanOnStart, err := validateScanOnStart(scanOnStartStr)
+	if err != nil {
+		return err
+	}
+	cfg.Media.ScanOnStart = scanOnStart
+
+	if cfg.Media.ScanTimeout <= 0 {
+		return fmt.Errorf("media.scanTimeout must be positive")
+	}
+	if cfg.Media.ScanStall <= 0 {
+		return fmt.Errorf("media.scanStall must be positive")
+	}
+	if cfg.Media.Settle < 0 {
+		return fmt.Errorf("media.settle cannot be negative")
+	}
+
+	if cfg.Media.FullEvery < 1 {
+		return fmt.Errorf("media.fullScanEvery must be at least 1")
+	}
+
+	if cfg.HLS.Idle <= 0 {
+		return fmt.Errorf("hls.idle must be positive")
+	}
+	if cfg.HLS.FFmpeg == "" {
+		return fmt.Errorf("hls.ffmpeg cannot be empty")
+	}
+
+	// validate media.minFree
+	minFree, err := parseBytes(minFreeStr)
+	if err != nil {
+		return fmt.Errorf("media.minFree: %w", err)
+	}
+	cfg.Media.MinFree = minFree
+
+	// validate media.warmUp
+	warmUp, err := parseBytes(warmUpStr)
+	if err != nil {
+		return fmt.Errorf("media.warmUp: %w", err)
+	}
+	cfg.Media.WarmUp = warmUp
+
+	if cfg.Media.Recent <= 0 {
+		return fmt.Errorf("media.recent must be positive")
+	}
+	if cfg.Media.Journal <= 0 {
+		return fmt.Errorf("media.journal must be positive")
+	}
+	if cfg.Media.BrowseMax < 0 {
+		return fmt.Errorf("media.browseMax cannot be negative")
+	}
+	if cfg.Remux.FFmpeg == "" {
+		return fmt.Errorf("remux.ffmpeg cannot be empty")
+	}
+
 	// validate timeToEnd
 	timeToEnd, err := validateTimeToEnd(timeToEndStr)
 	if err != nil {
@@ -226,6 +669,25 @@ func ParseArgs(cfg *Config, args []string, stderr io.Writer) error {
 	}
 	cfg.ShutdownTimers.TimeToEnd = timeToEnd
 
+	if cfg.ShutdownTimers.ExecTimeout <= 0 {
+		return fmt.Errorf("shutdown.execTimeout must be positive")
+	}
+
+	// validate serve.timezone
+	location, err := validateTimezone(timezoneStr)
+	if err != nil {
+		return err
+	}
+	cfg.Serve.Location = location
+
+	if len(windows) > 0 {
+		cfg.Serve.Windows = windows
+	}
+
+	if len(mediaTypes) > 0 {
+		cfg.Media.MediaTypes = mediaTypes
+	}
+
 	// parse the mounts
 	if len(mounts) > 0 {
 		cfg.Media.Volumes = mounts
@@ -330,6 +792,42 @@ func validateBufferSize(bufStr string) (int, error) {
 	return int(bufSize64), nil
 }
 
+// isSet reports whether the flag name was given on the command line
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// withHostname is name followed by the short form of hostname, cut to fit the 64 chars of a friendly
+// name
+func withHostname(name, hostname string) string {
+	host, _, _ := strings.Cut(strings.TrimSpace(hostname), ".")
+	if host == "" {
+		return name
+	}
+	if room := 64 - len(name) - len(" ()"); len(host) > room {
+		host = strings.ToValidUTF8(host[:max(room, 0)], "")
+	}
+	if host == "" {
+		return name
+	}
+	return name + " (" + host + ")"
+}
+
+// defaultUUIDFile is where the generated server UUID is kept, empty when the system has no config dir
+func defaultUUIDFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "streamer", "uuid")
+}
+
 func validateFriendlyName(fNameStr string) (string, error) {
 	fNameStr = strings.TrimSpace(fNameStr)
 
@@ -410,23 +908,192 @@ func validateLoggerLevel(logLevelStr string) (slog.Level, error) {
 	return level, nil
 }
 
+// validateUUID normalises a given UUID to its "uuid:" form, an empty one is left for the app to settle
+// from -media.uuidFile
 func validateUUID(uuidStr string) (string, error) {
-	// user did provide a uuid
-	if uuidStr != "" {
-		// check if user provided "uuid:" prefix
-		cleanUuid := strings.TrimPrefix(uuidStr, "uuid:")
-		id, err := uuid.FromString(cleanUuid)
+	if uuidStr == "" {
+		return "", nil
+	}
+	// check if user provided "uuid:" prefix
+	cleanUuid := strings.TrimPrefix(uuidStr, "uuid:")
+	id, err := uuid.FromString(cleanUuid)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse UUID %q: %v", uuidStr, err)
+	}
+	return "uuid:" + id.String(), nil
+}
+
+// validateShutdownExec refuses commands that can only be mistakes: blank ones, or several lines where the
+// later ones would run unnoticed
+func validateShutdownExec(command string) (string, error) {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return "", fmt.Errorf("shutdown.exec: command is empty")
+	}
+	if strings.ContainsFunc(command, unicode.IsControl) {
+		return "", fmt.Errorf("shutdown.exec: command %q contains control characters", command)
+	}
+	return command, nil
+}
+
+// parseFolders reads a comma separated list of virtual folders, an empty list has none
+func parseFolders(value string) ([]api.Folder, error) {
+	var folders []api.Folder
+	for name := range strings.SplitSeq(value, ",") {
+		folder := api.Folder(strings.ToLower(strings.TrimSpace(name)))
+		if folder == "" {
+			continue
+		}
+		if !slices.Contains(api.Folders, folder) {
+			return nil, fmt.Errorf("media.folders: unknown folder %q, want one of %v", name, api.Folders)
+		}
+		if !slices.Contains(folders, folder) {
+			folders = append(folders, folder)
+		}
+	}
+	return folders, nil
+}
+
+// parsePriorityRule reads a class and the User-Agent parts it applies to, as class=part,part
+func parsePriorityRule(value string) (api.PriorityRule, error) {
+	class, parts, ok := strings.Cut(value, "=")
+	if !ok {
+		return api.PriorityRule{}, fmt.Errorf("media.priority: want class=part,part, got %q", value)
+	}
+	priority, err := media.ParsePriority(strings.ToLower(strings.TrimSpace(class)))
+	if err != nil {
+		return api.PriorityRule{}, fmt.Errorf("media.priority: %w", err)
+	}
+
+	rule := api.PriorityRule{Priority: priority}
+	for match := range strings.SplitSeq(parts, ",") {
+		if match = strings.ToLower(strings.TrimSpace(match)); match != "" {
+			rule.Match = append(rule.Match, match)
+		}
+	}
+	if len(rule.Match) == 0 {
+		return api.PriorityRule{}, fmt.Errorf("media.priority: no User-Agent part for %s", priority)
+	}
+	return rule, nil
+}
+
+// parseActivityClasses reads a comma separated list of request classes, an empty list ignores none
+func parseActivityClasses(value string) ([]middleware.ActivityClass, error) {
+	var classes []middleware.ActivityClass
+	for name := range strings.SplitSeq(value, ",") {
+		class := middleware.ActivityClass(strings.ToLower(strings.TrimSpace(name)))
+		if class == "" {
+			continue
+		}
+		if !slices.Contains(middleware.ActivityClasses, class) {
+			return nil, fmt.Errorf("shutdown.ignore: unknown class %q, want one of %v", name, middleware.ActivityClasses)
+		}
+		if !slices.Contains(classes, class) {
+			classes = append(classes, class)
+		}
+	}
+	return classes, nil
+}
+
+// parseTrustedProxies reads a comma separated list of addresses and CIDRs, an address alone is a prefix
+// holding only itself
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for s := range strings.SplitSeq(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(s); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
 		if err != nil {
-			return "", fmt.Errorf("failed to parse UUID %q: %v", uuidStr, err)
+			return nil, fmt.Errorf("http.trustedProxies: %q is no address or CIDR", s)
 		}
-		return "uuid:" + id.String(), nil
+		prefixes = append(prefixes, prefix.Masked())
 	}
-	// create a new uuid otherwise
-	id, err := uuid.NewV7()
+	return prefixes, nil
+}
+
+// validateExternalURL checks the base URL behind a reverse proxy and drops a trailing slash, empty is none
+func validateExternalURL(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	u, err := url.Parse(s)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate UUID: %w", err)
+		return "", fmt.Errorf("invalid http.externalURL %q: %w", s, err)
 	}
-	return "uuid:" + id.String(), nil
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("invalid http.externalURL %q: want http(s)://host[/prefix]", s)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", fmt.Errorf("invalid http.externalURL %q: no query, fragment or credentials", s)
+	}
+	return strings.TrimRight(s, "/"), nil
+}
+
+// validateHTTPAddr normalizes the listen address. A bare port means all interfaces (IPv4 and IPv6),
+// a host without a port is refused rather than silently ending up on a random one
+func validateHTTPAddr(addr string) (string, error) {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return "", fmt.Errorf("http.addr cannot be empty")
+	}
+
+	// "8081" is meant as ":8081"
+	if _, err := strconv.Atoi(addr); err == nil {
+		addr = ":" + addr
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid http.addr %q (expected host:port, :port or [ipv6]:port): %w", addr, err)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return "", fmt.Errorf("invalid http.addr %q: port %q must be a number between 0 and 65535", addr, portStr)
+	}
+
+	if strings.ContainsAny(host, " /") {
+		return "", fmt.Errorf("invalid http.addr %q: bad host %q", addr, host)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+func validateStartupPolicy(policy string) (StartupPolicy, error) {
+	switch p := StartupPolicy(strings.ToLower(policy)); p {
+	case StartupFail, StartupWait, StartupServeEmpty:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid media.startup %q: must be 'fail', 'wait' or 'serve-empty'", policy)
+	}
+}
+
+func validateScanOnStart(mode string) (ScanOnStart, error) {
+	switch m := ScanOnStart(strings.ToLower(mode)); m {
+	case ScanBlock, ScanBackground:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid media.scanOnStart %q: must be 'block' or 'background'", mode)
+	}
+}
+
+// validateTimezone loads a named time zone, empty stays nil so the local zone is used
+func validateTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", name, err)
+	}
+	return loc, nil
 }
 
 func validateTimeToEnd(timeToEndStr string) (time.Time, error) {
@@ -1,7 +1,16 @@
 package config
 
 import (
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"streamer/internal/api"
+	"streamer/internal/media"
+	"streamer/internal/middleware"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseBytes(t *testing.T) {
@@ -38,3 +47,450 @@ func TestParseBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateShutdownExec(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"ok - simple command", "systemctl poweroff", "systemctl poweroff", false},
+		{"ok - surrounding spaces trimmed", "  sudo poweroff  ", "sudo poweroff", false},
+		{"fail - empty", "", "", true},
+		{"fail - only whitespace", " \t ", "", true},
+		{"fail - second line", "echo bye\nrm -rf /", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := validateShutdownExec(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateShutdownExec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("validateShutdownExec() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseShutdownExecTimeout(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		args    []string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"ok - default", []string{}, 30 * time.Second, false},
+		{"ok - set", []string{"-shutdown.execTimeout", "2m"}, 2 * time.Minute, false},
+		{"fail - zero", []string{"-shutdown.execTimeout", "0s"}, 0, true},
+		{"fail - negative", []string{"-shutdown.execTimeout", "-5s"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := DefaultConfig()
+			err := ParseArgs(cfg, tt.args, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && cfg.ShutdownTimers.ExecTimeout != tt.want {
+				t.Errorf("ExecTimeout = %v, want %v", cfg.ShutdownTimers.ExecTimeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseActivityClasses(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    string
+		expected []middleware.ActivityClass
+		wantErr  bool
+	}{
+		{"ok - one", "discovery", []middleware.ActivityClass{middleware.ActivityDiscovery}, false},
+		{"ok - several with spaces and case", " discovery, Admin ,discovery", []middleware.ActivityClass{middleware.ActivityDiscovery, middleware.ActivityAdmin}, false},
+		{"ok - empty ignores none", "", nil, false},
+		{"fail - unknown class", "discovery,ssdp", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseActivityClasses(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseActivityClasses() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("parseActivityClasses() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseFolders(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    string
+		expected []api.Folder
+		wantErr  bool
+	}{
+		{"ok - all of them", "all,recent,categories", api.Folders, false},
+		{"ok - spaces, case and repeats", " Recent , recent", []api.Folder{api.FolderRecent}, false},
+		{"ok - empty has none", "", nil, false},
+		{"fail - unknown folder", "all,genres", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseFolders(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFolders() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("parseFolders() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParsePriorityRule(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    string
+		expected api.PriorityRule
+		wantErr  bool
+	}{
+		{"ok - high", "high=samsung,bravia", api.PriorityRule{Priority: media.PriorityHigh, Match: []string{"samsung", "bravia"}}, false},
+		{"ok - spaces and case", " Low = Wget, curl ,", api.PriorityRule{Priority: media.PriorityLow, Match: []string{"wget", "curl"}}, false},
+		{"fail - no class", "samsung", api.PriorityRule{}, true},
+		{"fail - unknown class", "urgent=samsung", api.PriorityRule{}, true},
+		{"fail - no User-Agent part", "high= , ", api.PriorityRule{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parsePriorityRule(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePriorityRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Priority != tt.expected.Priority || !slices.Equal(got.Match, tt.expected.Match) {
+				t.Errorf("parsePriorityRule() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    string
+		expected []netip.Prefix
+		wantErr  bool
+	}{
+		{"ok - address and cidr", "127.0.0.1, 10.1.2.3/8", []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("10.0.0.0/8")}, false},
+		{"ok - ipv6", "::1,fd00::/8", []netip.Prefix{netip.MustParsePrefix("::1/128"), netip.MustParsePrefix("fd00::/8")}, false},
+		{"ok - empty has none", "", nil, false},
+		{"fail - host name", "nginx", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseTrustedProxies(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTrustedProxies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("parseTrustedProxies() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateExternalURL(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"ok - with prefix", "https://example.com/media/", "https://example.com/media", false},
+		{"ok - host only", "http://nas.lan:8081", "http://nas.lan:8081", false},
+		{"ok - empty is none", "", "", false},
+		{"fail - no scheme", "example.com/media", "", true},
+		{"fail - other scheme", "ftp://example.com", "", true},
+		{"fail - query", "https://example.com/media?x=1", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := validateExternalURL(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateExternalURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("validateExternalURL() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseMediaType(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    string
+		ext      string
+		expected api.MediaType
+		wantErr  bool
+	}{
+		{"ok - with profile", ".TS:video/vnd.dlna.mpeg-tts:MPEG_TS_HD_NA_ISO", ".ts", api.MediaType{MIME: "video/vnd.dlna.mpeg-tts", DLNAProfile: "MPEG_TS_HD_NA_ISO"}, false},
+		{"ok - mime only", ".avi:video/x-msvideo", ".avi", api.MediaType{MIME: "video/x-msvideo"}, false},
+		{"fail - no dot", "ts:video/mp2t", "", api.MediaType{}, true},
+		{"fail - dot only", ".:video/mp2t", "", api.MediaType{}, true},
+		{"fail - no mime", ".ts", "", api.MediaType{}, true},
+		{"fail - no subtype", ".ts:video", "", api.MediaType{}, true},
+		{"fail - empty type", ".ts:/mp2t", "", api.MediaType{}, true},
+		{"fail - empty profile", ".ts:video/mp2t:", "", api.MediaType{}, true},
+		{"fail - profile with a separator", ".ts:video/mp2t:A;B", "", api.MediaType{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ext, got, err := parseMediaType(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMediaType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ext != tt.ext || got != tt.expected {
+				t.Errorf("parseMediaType() = %q %+v, want %q %+v", ext, got, tt.ext, tt.expected)
+			}
+		})
+	}
+
+	t.Run("ok - repeated", func(t *testing.T) {
+		t.Parallel()
+		cfg := DefaultConfig()
+		args := []string{"-media.type", ".ts:video/mp2t", "-media.type", ".m2ts:video/vnd.dlna.mpeg-tts:MPEG_TS_HD_NA_ISO", "-media.type", ".TS:video/vnd.dlna.mpeg-tts"}
+		if err := ParseArgs(cfg, args, io.Discard); err != nil {
+			t.Fatalf("ParseArgs() error = %v", err)
+		}
+		if len(cfg.Media.MediaTypes) != 2 || cfg.Media.MediaTypes[".ts"].MIME != "video/vnd.dlna.mpeg-tts" {
+			t.Errorf("MediaTypes = %v, want .m2ts and the last .ts", cfg.Media.MediaTypes)
+		}
+	})
+}
+
+func TestParseServeWindows(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		args     []string
+		windows  int
+		location string
+		wantErr  bool
+	}{
+		{"ok - none", []string{}, 0, "", false},
+		{"ok - repeated", []string{"-serve.window", "mon-fri 17:00-23:30", "-serve.window", "sat,sun 10:00-01:00"}, 2, "", false},
+		{"ok - timezone", []string{"-serve.window", "17:00-23:30", "-serve.timezone", "UTC"}, 1, "UTC", false},
+		{"fail - bad window", []string{"-serve.window", "mon-fri 17:00"}, 0, "", true},
+		{"fail - bad timezone", []string{"-serve.timezone", "Mars/Olympus"}, 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := DefaultConfig()
+			err := ParseArgs(cfg, tt.args, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(cfg.Serve.Windows) != tt.windows {
+				t.Errorf("got %d windows, want %d", len(cfg.Serve.Windows), tt.windows)
+			}
+			if got := cfg.Serve.Location; (got == nil) != (tt.location == "") || (got != nil && got.String() != tt.location) {
+				t.Errorf("Location = %v, want %q", got, tt.location)
+			}
+		})
+	}
+}
+
+func TestWithHostname(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		fName    string
+		hostname string
+		expected string
+	}{
+		{"ok - short host", "GoStream Server", "nas", "GoStream Server (nas)"},
+		{"ok - domain dropped", "GoStream Server", "office-pc.fritz.box", "GoStream Server (office-pc)"},
+		{"ok - cut to 64 chars", "GoStream Server", strings.Repeat("h", 80), "GoStream Server (" + strings.Repeat("h", 46) + ")"},
+		{"ok - no host", "GoStream Server", " ", "GoStream Server"},
+		{"ok - no room", strings.Repeat("n", 64), "nas", strings.Repeat("n", 64)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := withHostname(tt.fName, tt.hostname)
+			if got != tt.expected {
+				t.Errorf("withHostname(%q, %q) = %q, want %q", tt.fName, tt.hostname, got, tt.expected)
+			}
+			if len(got) > 64 {
+				t.Errorf("withHostname(%q, %q) is %d chars, want at most 64", tt.fName, tt.hostname, len(got))
+			}
+		})
+	}
+}
+
+func TestParseFriendlyName(t *testing.T) {
+	t.Parallel()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("no hostname: %v", err)
+	}
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"ok - default gets the host", nil, withHostname("GoStream Server", hostname)},
+		{"ok - given is kept", []string{"-media.friendlyName", "Living Room"}, "Living Room"},
+		{"ok - given default is kept", []string{"-media.friendlyName", "GoStream Server"}, "GoStream Server"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := DefaultConfig()
+			if err := ParseArgs(cfg, tt.args, io.Discard); err != nil {
+				t.Fatalf("ParseArgs() error = %v", err)
+			}
+			if cfg.Media.FriendlyName != tt.expected {
+				t.Errorf("FriendlyName = %q, want %q", cfg.Media.FriendlyName, tt.expected)
+			}
+			if cfg.Media.UUID != "" {
+				t.Errorf("UUID = %q, want it left for the app to settle", cfg.Media.UUID)
+			}
+		})
+	}
+}
+
+func TestValidateHTTPAddr(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"ok - port only", ":8081", ":8081", false},
+		{"ok - bare port", "8081", ":8081", false},
+		{"ok - ipv4 wildcard", "0.0.0.0:8081", "0.0.0.0:8081", false},
+		{"ok - ipv4 address", "192.168.1.50:8081", "192.168.1.50:8081", false},
+		{"ok - ipv6 wildcard", "[::]:8081", "[::]:8081", false},
+		{"ok - ipv6 address", "[fe80::1]:8081", "[fe80::1]:8081", false},
+		{"ok - host name", "media.lan:8081", "media.lan:8081", false},
+		{"ok - ephemeral port", ":0", ":0", false},
+		{"ok - leading zeros", ":08081", ":8081", false},
+		{"fail - empty", "", "", true},
+		{"fail - host name without port", "media.lan", "", true},
+		{"fail - ipv4 without port", "192.168.1.50", "", true},
+		{"fail - ipv6 without brackets", "::1:8081", "", true},
+		{"fail - named port", ":http", "", true},
+		{"fail - port out of range", ":65536", "", true},
+		{"fail - negative port", "-1", "", true},
+		{"fail - url", "http://media.lan:8081", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := validateHTTPAddr(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateHTTPAddr(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("validateHTTPAddr(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateStartupPolicy(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    string
+		expected StartupPolicy
+		wantErr  bool
+	}{
+		{"ok - fail", "fail", StartupFail, false},
+		{"ok - wait", "wait", StartupWait, false},
+		{"ok - serve-empty", "serve-empty", StartupServeEmpty, false},
+		{"ok - upper case", "WAIT", StartupWait, false},
+		{"fail - empty", "", "", true},
+		{"fail - unknown", "retry", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := validateStartupPolicy(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateStartupPolicy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("validateStartupPolicy(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateScanOnStart(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    string
+		expected ScanOnStart
+		wantErr  bool
+	}{
+		{"ok - block", "block", ScanBlock, false},
+		{"ok - background", "background", ScanBackground, false},
+		{"ok - mixed case", "Block", ScanBlock, false},
+		{"fail - empty", "", "", true},
+		{"fail - unknown", "sync", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := validateScanOnStart(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateScanOnStart(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("validateScanOnStart(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// envVars are the environment variables a container can configure the server with instead of flags, by
+// the flag each one sets
+var envVars = []struct {
+	name string
+	flag string
+	sep  string // splits a list of values, each set like a repeated flag
+}{
+	{name: "STREAMER_HTTP_ADDR", flag: "http.addr"},
+	{name: "STREAMER_MEDIA_MODE", flag: "media.mode"},
+	{name: "STREAMER_MEDIA_BUFFERSIZE", flag: "media.bufferSize"},
+	{name: "STREAMER_MEDIA_MOUNTS", flag: "media.mount", sep: ";"},
+	{name: "STREAMER_LOG_LEVEL", flag: "logger.level"},
+	{name: "STREAMER_SHUTDOWN_INACTIVE", flag: "shutdown.inactive"},
+	{name: "STREAMER_SHUTDOWN_SLEEP", flag: "shutdown.sleep"},
+	{name: "STREAMER_SHUTDOWN_WARNING", flag: "shutdown.warning"},
+	{name: "STREAMER_SHUTDOWN_AT", flag: "shutdown.at"},
+}
+
+// applyEnv sets the flags of fs from the environment variables getenv returns, except those already set on
+// the command line. A value goes through its flag the way it would from the command line, so it is
+// validated the same way. Empty variables count as unset
+func applyEnv(fs *flag.FlagSet, getenv func(string) string) error {
+	onCommandLine := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { onCommandLine[f.Name] = true })
+
+	for _, env := range envVars {
+		value := strings.TrimSpace(getenv(env.name))
+		if value == "" || onCommandLine[env.flag] {
+			continue
+		}
+
+		values := []string{value}
+		if env.sep != "" {
+			values = nil
+			for v := range strings.SplitSeq(value, env.sep) {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+		for _, v := range values {
+			if err := fs.Set(env.flag, v); err != nil {
+				return fmt.Errorf("%s: %w", env.name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"slices"
+	"streamer/internal/media"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseArgsEnv(t *testing.T) {
+	// no t.Parallel, t.Setenv changes the whole process
+	t.Setenv("STREAMER_HTTP_ADDR", ":9000")
+	t.Setenv("STREAMER_MEDIA_MODE", "direct")
+	t.Setenv("STREAMER_MEDIA_BUFFERSIZE", "512KB")
+	t.Setenv("STREAMER_LOG_LEVEL", "warn")
+	t.Setenv("STREAMER_MEDIA_MOUNTS", "usb:2:/mnt/usb; nas:8:/mnt/nas/films,/mnt/nas/shows")
+	t.Setenv("STREAMER_SHUTDOWN_INACTIVE", "45m")
+	t.Setenv("STREAMER_SHUTDOWN_AT", "23:30")
+	file := writeConfigFile(t, "[http]\naddr = \":8000\"\n")
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantAddr  string
+		wantLevel slog.Level
+		wantVols  []string // "" for the volume of positional paths, its ID is made up
+	}{
+		{"ok - env over the defaults", nil, ":9000", slog.LevelWarn, []string{"usb", "nas"}},
+		{"ok - flags over env", []string{"-http.addr", ":7000", "-logger.level", "debug"}, ":7000", slog.LevelDebug, []string{"usb", "nas"}},
+		{"ok - mounts on the command line replace env's", []string{"-media.mount", "ssd:4:/mnt/ssd"}, ":9000", slog.LevelWarn, []string{"ssd"}},
+		{"ok - env over the config file", []string{"-config", file}, ":9000", slog.LevelWarn, []string{"usb", "nas"}},
+		{"ok - a positional path doesn't", []string{"/srv/videos"}, ":9000", slog.LevelWarn, []string{"usb", "nas", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			if err := ParseArgs(cfg, tt.args, io.Discard); err != nil {
+				t.Fatalf("ParseArgs() error = %v", err)
+			}
+			if cfg.HTTP.Addr != tt.wantAddr || cfg.Logger.Level != tt.wantLevel {
+				t.Errorf("Addr %q Level %v, want %q %v", cfg.HTTP.Addr, cfg.Logger.Level, tt.wantAddr, tt.wantLevel)
+			}
+			// the same validators as the flags
+			if cfg.Media.Mode != media.ModeFileDirect || cfg.Media.BufferSize != 512*1024 {
+				t.Errorf("Mode %v BufferSize %d, want direct and 512KB", cfg.Media.Mode, cfg.Media.BufferSize)
+			}
+			if cfg.ShutdownTimers.InactiveLimit != 45*time.Minute || cfg.ShutdownTimers.TimeToEnd.IsZero() {
+				t.Errorf("InactiveLimit %v TimeToEnd %v, want 45m and 23:30", cfg.ShutdownTimers.InactiveLimit, cfg.ShutdownTimers.TimeToEnd)
+			}
+			var ids []string
+			for i, v := range cfg.Media.Volumes {
+				if i < len(tt.wantVols) && tt.wantVols[i] == "" {
+					v.ID = ""
+				}
+				ids = append(ids, v.ID)
+			}
+			if !slices.Equal(ids, tt.wantVols) {
+				t.Errorf("Volumes = %q, want %q", ids, tt.wantVols)
+			}
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"ok - nothing set", nil, ""},
+		{"ok - empty counts as unset", map[string]string{"STREAMER_SHUTDOWN_SLEEP": " "}, ""},
+		{"ok - empty mounts are skipped", map[string]string{"STREAMER_MEDIA_MOUNTS": "usb:2:/mnt/usb;;"}, ""},
+		{"fail - bad duration", map[string]string{"STREAMER_SHUTDOWN_SLEEP": "soon"}, "STREAMER_SHUTDOWN_SLEEP: "},
+		{"fail - bad mount", map[string]string{"STREAMER_MEDIA_MOUNTS": "usb:2:/mnt/usb;nas"}, "STREAMER_MEDIA_MOUNTS: invalid format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.Duration("shutdown.sleep", 0, "")
+			var mounts mountFlag
+			fs.Var(&mounts, "media.mount", "")
+			for _, env := range envVars {
+				if fs.Lookup(env.flag) == nil {
+					fs.String(env.flag, "", "")
+				}
+			}
+
+			err := applyEnv(fs, func(name string) string { return tt.env[name] })
+			if (err != nil) != (tt.wantErr != "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("applyEnv() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoadFile is the configuration of the binary started with -config path and no other flag
+func LoadFile(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if err := ParseArgs(cfg, []string{"-config", path}, io.Discard); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// fileSetting is one key of a config file with its values, more than one for an array
+type fileSetting struct {
+	key    string // the flag it sets, e.g. http.addr
+	values []string
+	line   int
+}
+
+// applyConfigFile sets the flags of fs from the config file at path, except those already set on the
+// command line. Each value goes through the flag like it would from the command line, so it is
+// validated the same way
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	defer f.Close()
+
+	settings, err := parseConfigFile(f)
+	if err != nil {
+		return fmt.Errorf("%s:%w", path, err)
+	}
+
+	onCommandLine := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { onCommandLine[f.Name] = true })
+
+	seen := map[string]int{}
+	for _, s := range settings {
+		if s.key == "config" || fs.Lookup(s.key) == nil {
+			return fmt.Errorf("%s:%d: unknown key %q", path, s.line, s.key)
+		}
+		if line, ok := seen[s.key]; ok {
+			return fmt.Errorf("%s:%d: %q is already set on line %d", path, s.line, s.key, line)
+		}
+		seen[s.key] = s.line
+
+		if onCommandLine[s.key] {
+			continue
+		}
+		for _, v := range s.values {
+			if err := fs.Set(s.key, v); err != nil {
+				return fmt.Errorf("%s:%d: %s: %w", path, s.line, s.key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseConfigFile reads the part of TOML a config needs: [tables], dotted keys, strings, bare values
+// (numbers, booleans, durations) and arrays of them, which may span lines. A key is its table and name
+// joined with dots, the name of the flag it sets. Errors start with the line number
+func parseConfigFile(r io.Reader) ([]fileSetting, error) {
+	var (
+		settings []fileSetting
+		table    string
+		pending  *fileSetting // an array still open at the end of its line
+		rest     string
+	)
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+
+		if pending != nil {
+			values, closed, err := parseValues(line)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %s: %w", n, pending.key, err)
+			}
+			pending.values = append(pending.values, values...)
+			if closed {
+				settings = append(settings, *pending)
+				pending = nil
+			}
+			continue
+		}
+
+		line = strings.TrimSpace(stripComment(line))
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "["):
+			name, ok := strings.CutSuffix(line, "]")
+			if !ok || strings.HasPrefix(name, "[[") {
+				return nil, fmt.Errorf("%d: bad table %s", n, line)
+			}
+			table = strings.TrimSpace(name[1:])
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("%d: want key = value, got %s", n, line)
+		}
+		if table != "" {
+			key = table + "." + key
+		}
+		s := fileSetting{key: key, line: n}
+
+		if rest, ok = strings.CutPrefix(value, "["); ok {
+			values, closed, err := parseValues(rest)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %s: %w", n, key, err)
+			}
+			s.values = values
+			if !closed {
+				pending = &s
+				continue
+			}
+		} else {
+			v, err := parseValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %s: %w", n, key, err)
+			}
+			s.values = []string{v}
+		}
+		settings = append(settings, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("0: %w", err)
+	}
+	if pending != nil {
+		return nil, fmt.Errorf("%d: %s: array is never closed", pending.line, pending.key)
+	}
+	return settings, nil
+}
+
+// parseValues reads the elements of an array from s, the part of a line after its [ or a line within
+// it. closed tells whether s holds the closing ]
+func parseValues(s string) (values []string, closed bool, err error) {
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		switch {
+		case s == "" || s[0] == '#':
+			return values, false, nil
+		case s[0] == ']':
+			if rest := strings.TrimSpace(stripComment(s[1:])); rest != "" {
+				return nil, false, fmt.Errorf("unexpected %s after the array", rest)
+			}
+			return values, true, nil
+		}
+
+		end := strings.IndexAny(s, ",]#")
+		if s[0] == '"' || s[0] == '\'' {
+			end = closingQuote(s) + 1
+		}
+		if end <= 0 {
+			end = len(s)
+		}
+		v, err := parseValue(strings.TrimSpace(s[:end]))
+		if err != nil {
+			return nil, false, err
+		}
+		values = append(values, v)
+		s = s[end:]
+	}
+}
+
+// parseValue is a single value as the flag takes it: a string without its quotes, anything else as it is
+func parseValue(s string) (string, error) {
+	s = strings.TrimSpace(stripComment(s))
+	switch {
+	case s == "":
+		return "", errors.New("missing value")
+	case s[0] == '\'':
+		// a literal string, no escapes
+		if len(s) < 2 || closingQuote(s) != len(s)-1 {
+			return "", fmt.Errorf("bad string %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case s[0] == '"':
+		if closingQuote(s) != len(s)-1 {
+			return "", fmt.Errorf("bad string %s", s)
+		}
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("bad string %s", s)
+		}
+		return v, nil
+	case strings.ContainsAny(s, " \t\"'[]"):
+		return "", fmt.Errorf("bad value %s, quote strings", s)
+	}
+	return s, nil
+}
+
+// closingQuote is the index of the quote closing the string s starts with, -1 when there is none
+func closingQuote(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripComment cuts a # comment off s, leaving the ones inside strings
+func stripComment(s string) string {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '#':
+			return s[:i]
+		case '"', '\'':
+			end := closingQuote(s[i:])
+			if end < 0 {
+				return s
+			}
+			i += end
+		}
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes content to a config file in a temp dir and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "streamer.toml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const twoVolumes = `# the living room box
+pidfile = "/run/streamer.pid"
+kiosk = true
+
+[http]
+addr = ":9000"
+timeouts.drain = "30s" # dotted key inside a table
+
+[logger]
+level = "warn"
+
+[media]
+friendlyName = 'Living Room #2'
+mount = [
+  "usb:2:/mnt/usb",
+  "nas:8:/mnt/nas/films,/mnt/nas/shows", # two paths
+]
+`
+
+func TestLoadFile(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := LoadFile(writeConfigFile(t, twoVolumes))
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.HTTP.Addr != ":9000" || cfg.HTTP.Timeouts.Drain != 30*time.Second {
+		t.Errorf("http = %q drain %v, want :9000 and 30s", cfg.HTTP.Addr, cfg.HTTP.Timeouts.Drain)
+	}
+	if cfg.PIDFile != "/run/streamer.pid" || !cfg.Kiosk || cfg.Logger.Level != slog.LevelWarn {
+		t.Errorf("pidfile %q kiosk %v level %v, want the file's", cfg.PIDFile, cfg.Kiosk, cfg.Logger.Level)
+	}
+	if cfg.Media.FriendlyName != "Living Room #2" {
+		t.Errorf("FriendlyName = %q, want the # kept inside the string", cfg.Media.FriendlyName)
+	}
+	if vols := cfg.Media.Volumes; len(vols) != 2 || vols[0].ID != "usb" || vols[1].ID != "nas" || len(vols[1].Paths) != 2 {
+		t.Errorf("Volumes = %+v, want usb and nas with two paths", vols)
+	}
+}
+
+func TestConfigFileFlagsWin(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfigFile(t, twoVolumes)
+	tests := []struct {
+		name      string
+		args      []string
+		wantLevel slog.Level
+		wantVols  []string
+	}{
+		{"ok - file only", []string{"-config", path}, slog.LevelWarn, []string{"usb", "nas"}},
+		{"ok - level on the command line", []string{"-config", path, "-logger.level", "debug"}, slog.LevelDebug, []string{"usb", "nas"}},
+		{"ok - flag before -config", []string{"-logger.level", "debug", "-config", path}, slog.LevelDebug, []string{"usb", "nas"}},
+		{"ok - mounts on the command line replace the file's", []string{"-config", path, "-media.mount", "ssd:4:/mnt/ssd"}, slog.LevelWarn, []string{"ssd"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := DefaultConfig()
+			if err := ParseArgs(cfg, tt.args, io.Discard); err != nil {
+				t.Fatalf("ParseArgs() error = %v", err)
+			}
+			if cfg.Logger.Level != tt.wantLevel {
+				t.Errorf("Level = %v, want %v", cfg.Logger.Level, tt.wantLevel)
+			}
+			var ids []string
+			for _, v := range cfg.Media.Volumes {
+				ids = append(ids, v.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantVols, ",") {
+				t.Errorf("Volumes = %q, want %q", ids, tt.wantVols)
+			}
+			// the rest still comes from the file
+			if cfg.HTTP.Addr != ":9000" {
+				t.Errorf("Addr = %q, want the file's", cfg.HTTP.Addr)
+			}
+		})
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"fail - unknown key", "[media]\nmode = \"direct\"\nmoed = \"buffered\"\n", `:3: unknown key "media.moed"`},
+		{"fail - unknown table", "\n[htpp]\naddr = \":9000\"\n", `:3: unknown key "htpp.addr"`},
+		{"fail - -config itself", "config = \"other.toml\"\n", `:1: unknown key "config"`},
+		{"fail - bad value rejected by its flag", "[http]\nbindRetries = \"many\"\n", ":2: http.bindRetries"},
+		{"fail - set twice", "kiosk = true\nkiosk = false\n", `:2: "kiosk" is already set on line 1`},
+		{"fail - unquoted string", "[media]\nfriendlyName = Living Room\n", ":2: media.friendlyName"},
+		{"fail - unterminated string", "pidfile = \"/run/streamer.pid\n", ":1: pidfile"},
+		{"fail - no value", "[http]\naddr =\n", ":2: want key = value"},
+		{"fail - array never closed", "[media]\nmount = [\n  \"usb:2:/mnt/usb\",\n", ":2: media.mount: array is never closed"},
+		{"fail - array of tables", "[[media]]\n", ":1: bad table"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := writeConfigFile(t, tt.content)
+			_, err := LoadFile(path)
+			if err == nil || !strings.Contains(err.Error(), path+tt.wantErr) {
+				t.Errorf("LoadFile() error = %v, want it to contain %q", err, path+tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("fail - missing file", func(t *testing.T) {
+		t.Parallel()
+		if _, err := LoadFile(filepath.Join(t.TempDir(), "nope.toml")); err == nil {
+			t.Error("LoadFile() error = nil, want the file not found")
+		}
+	})
+}
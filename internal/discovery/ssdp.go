@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"streamer/internal/supervise"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,8 +24,23 @@ const (
 	ssdpResponseDelay = 10 * time.Millisecond
 )
 
+// MulticastAddr is the SSDP group renderers search and listen on
+const MulticastAddr = ssdpAddr
+
+// bootID tells renderers the device restarted when it goes up, set before announcing starts
 var bootID = time.Now().UTC().Unix()
 
+// BootID is the BOOTID.UPNP.ORG this process announces
+func BootID() int64 {
+	return bootID
+}
+
+// FollowBootID makes sure the announced BOOTID is above previous, that of the process this one took
+// over from. Renderers only notice a restart when it goes up. Call it before announcing
+func FollowBootID(previous int64) {
+	bootID = max(bootID, previous+1)
+}
+
 func getAdvertisedTypes(deviceUUID string) []advertisedType {
 	// All types that should be advertised per DLNA spec
 	return []advertisedType{
@@ -55,25 +72,62 @@ func getAdvertisedTypes(deviceUUID string) []advertisedType {
 	}
 }
 
-func StartSSDP(ctx context.Context, logger *slog.Logger, hostIP string, port int, deviceUUID string) {
+// aliveBurstRepeat is how often an on-demand announcement is sent, UDP multicast gets lost easily
+const aliveBurstRepeat = 2
+
+// Announcer sends the periodic ssdp:alive messages and the byebye when it stops. It can be paused,
+// renderers then get a byebye and hear nothing until it is resumed
+type Announcer struct {
+	done       chan struct{}
+	announceCh chan struct{}
+	pauseCh    chan struct{}
+	paused     atomic.Bool
+	handedOff  atomic.Bool // stop without byebye, another process announces the device now
+
+	Supervisor *supervise.Supervisor // restarts the announce loop when it panics, nil runs it unsupervised
+}
+
+// NewAnnouncer returns an Announcer that stays quiet until Start, Pause may already be called
+func NewAnnouncer() *Announcer {
+	return &Announcer{
+		done:       make(chan struct{}),
+		announceCh: make(chan struct{}, 1),
+		pauseCh:    make(chan struct{}, 1),
+	}
+}
+
+// StartSSDP announces the device until ctx is cancelled
+func StartSSDP(ctx context.Context, logger *slog.Logger, hostIP string, port int, deviceUUID string) *Announcer {
+	a := NewAnnouncer()
+	a.Start(ctx, logger, hostIP, port, deviceUUID)
+	return a
+}
+
+// Start announces the device until ctx is cancelled, it must only be called once
+func (a *Announcer) Start(ctx context.Context, logger *slog.Logger, hostIP string, port int, deviceUUID string) {
 	addr, err := net.ResolveUDPAddr("udp", ssdpAddr)
 	if err != nil {
 		logger.Error("SSDP resolve", "error", err)
+		close(a.done)
 		return
 	}
 
 	conn, err := net.DialUDP("udp", nil, addr)
 	if err != nil {
 		logger.Error("SSDP dial", "error", err)
+		close(a.done)
 		return
 	}
 
 	targets := getAdvertisedTypes(deviceUUID)
 
-	go func() {
-		defer conn.Close()
-
-		sendSSDPNotify(conn, logger, hostIP, port, targets)
+	// the connection outlives restarts of the loop
+	loopDone := a.Supervisor.Go(ctx, "ssdp announcer", func(ctx context.Context) {
+		// silent mirrors what renderers were last told, a.paused is what they should be told
+		silent := a.paused.Load()
+		if !silent {
+			sendSSDPNotify(conn, logger, hostIP, port, targets)
+		}
 
 		tickInterval := 30 * time.Second
 		ticker := time.NewTicker(tickInterval)
@@ -83,15 +137,90 @@ func StartSSDP(ctx context.Context, logger *slog.Logger, hostIP string, port int
 			select {
 			case <-ctx.Done():
 				logger.Info("stopping SSDP broadcaster")
-				sendSSDPByebye(conn, targets)
+				if !silent && !a.handedOff.Load() {
+					sendSSDPByebye(conn, targets)
+				}
 				return
 			case <-ticker.C:
-				sendSSDPNotify(conn, logger, hostIP, port, targets)
+				if !silent {
+					sendSSDPNotify(conn, logger, hostIP, port, targets)
+				}
+			case <-a.announceCh:
+				if silent {
+					continue
+				}
+				logger.Info("re-announcing over SSDP")
+				for range aliveBurstRepeat {
+					sendSSDPNotify(conn, logger, hostIP, port, targets)
+				}
+				ticker.Reset(tickInterval)
+			case <-a.pauseCh:
+				switch paused := a.paused.Load(); {
+				case paused && !silent:
+					logger.Info("SSDP paused, sending byebye")
+					sendSSDPByebye(conn, targets)
+				case !paused && silent:
+					logger.Info("SSDP resumed")
+					for range aliveBurstRepeat {
+						sendSSDPNotify(conn, logger, hostIP, port, targets)
+					}
+					ticker.Reset(tickInterval)
+				}
+				silent = a.paused.Load()
 			}
 		}
+	})
+
+	go func() {
+		<-loopDone
+		conn.Close()
+		close(a.done)
 	}()
 }
 
+// Announce sends a fresh ssdp:alive burst right away instead of waiting for the next tick
+func (a *Announcer) Announce() {
+	select {
+	case a.announceCh <- struct{}{}:
+	default:
+	}
+}
+
+// Pause sends byebye and stops announcing until Resume, M-SEARCH listeners given Paused go quiet too
+func (a *Announcer) Pause() {
+	a.paused.Store(true)
+	a.nudgePause()
+}
+
+// Resume announces the device again after a Pause
+func (a *Announcer) Resume() {
+	a.paused.Store(false)
+	a.nudgePause()
+}
+
+// HandOff makes the announcer stop without byebye, for when another process with the same device UUID
+// has taken over and renderers should not drop the device
+func (a *Announcer) HandOff() {
+	a.handedOff.Store(true)
+}
+
+// Paused reports whether the device is currently off the air
+func (a *Announcer) Paused() bool {
+	return a.paused.Load()
+}
+
+func (a *Announcer) nudgePause() {
+	select {
+	case a.pauseCh <- struct{}{}:
+	default:
+	}
+}
+
+// Done is closed once the broadcaster has stopped, i.e. after the byebye messages have gone out
+func (a *Announcer) Done() <-chan struct{} {
+	return a.done
+}
+
 func sendSSDPNotify(conn *net.UDPConn, logger *slog.Logger, hostIP string, port int, targets []advertisedType) {
 	logger.Debug("broadcasting SSDP notify", "num_types", len(targets))
 
@@ -135,29 +264,30 @@ func sendSSDPByebye(conn *net.UDPConn, targets []advertisedType) {
 	}
 }
 
-func ListenForSearch(ctx context.Context, logger *slog.Logger, hostIP string, port int, deviceUUID string) {
+// ListenForSearch answers M-SEARCH requests until ctx is cancelled, except while paused returns true
+// (nil means never). sup restarts the listener when it panics, nil runs it unsupervised. The returned
+// channel is closed once the listener has stopped
+func ListenForSearch(ctx context.Context, logger *slog.Logger, hostIP string, port int, deviceUUID string, paused func() bool, sup *supervise.Supervisor) <-chan struct{} {
+	done := make(chan struct{})
+
 	addr, err := net.ResolveUDPAddr("udp", ssdpAddr)
 	if err != nil {
 		logger.Error("resolve UDP address", "error", err)
-		return
+		close(done)
+		return done
 	}
 
 	conn, err := net.ListenMulticastUDP("udp", nil, addr)
 	if err != nil {
 		logger.Error("M-SEARCH listener", "error", err)
-		return
+		close(done)
+		return done
 	}
 
-	go func() {
-		<-ctx.Done()
-		logger.Info("stopping M-SEARCH listener")
-		conn.Close()
-	}()
-
 	targets := getAdvertisedTypes(deviceUUID)
 
-	go func() {
-		defer conn.Close()
+	// the socket outlives restarts of the read loop
+	loopDone := sup.Go(ctx, "ssdp search listener", func(ctx context.Context) {
 		buf := make([]byte, 2048)
 
 		for {
@@ -172,6 +302,11 @@ func ListenForSearch(ctx context.Context, logger *slog.Logger, hostIP string, po
 				return
 			}
 
+			// off the air, renderers must not find us
+			if paused != nil && paused() {
+				continue
+			}
+
 			msg := string(buf[:n])
 			if strings.Contains(msg, "M-SEARCH") {
 				logger.Debug("received M-SEARCH", "source", src)
@@ -192,7 +327,21 @@ func ListenForSearch(ctx context.Context, logger *slog.Logger, hostIP string, po
 				RespondToSearch(logger, src, hostIP, port, searchTarget, targets)
 			}
 		}
+	})
+
+	go func() {
+		defer close(done)
+
+		select {
+		case <-ctx.Done():
+			logger.Info("stopping M-SEARCH listener")
+		case <-loopDone:
+		}
+		conn.Close()
+		<-loopDone
 	}()
+
+	return done
 }
 
 func RespondToSearch(logger *slog.Logger, dst *net.UDPAddr, hostIP string, port int, searchTarget string, targets []advertisedType) {
@@ -0,0 +1,53 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// segment length in seconds, ffmpeg can only cut on keyframes so real ones vary around it
+const segmentSeconds = "6"
+
+// FFmpeg remuxes with the ffmpeg binary at path. The streams are copied into fMP4 segments, not
+// re-encoded, so it is cheap but only helps when the codecs themselves are playable
+func FFmpeg(path string) Transcoder {
+	return func(ctx context.Context, input, dir string) error {
+		cmd := exec.CommandContext(ctx, path, ffmpegArgs(input, dir)...)
+		cmd.Dir = dir
+
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			// killed because the session went away
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+}
+
+func ffmpegArgs(input, dir string) []string {
+	return []string{
+		"-nostdin", "-hide_banner", "-loglevel", "error",
+		"-i", input,
+		// first video and audio track, a missing audio track is fine
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-c", "copy",
+		"-f", "hls",
+		"-hls_time", segmentSeconds,
+		"-hls_list_size", "0",
+		// the playlist grows while ffmpeg works through the file and gets an end tag once it's done
+		"-hls_playlist_type", "event",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", "init.mp4",
+		"-hls_segment_filename", filepath.Join(dir, "seg%05d.m4s"),
+		filepath.Join(dir, PlaylistName),
+	}
+}
@@ -0,0 +1,275 @@
+// Package hls remuxes media browsers can't play, e.g. MKV, into HLS on the fly. Every client watching an
+// entry gets its own session: a transcoder writing the playlist and segments into a temp dir, which is
+// stopped and removed again once the client stops asking for them
+package hls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PlaylistName is the file a Transcoder must write the playlist to
+const PlaylistName = "index.m3u8"
+
+// how often WaitPlaylist looks for the playlist while the transcoder is starting up
+const pollInterval = 100 * time.Millisecond
+
+var (
+	ErrBusy       = errors.New("no io slot free for a new session")
+	ErrClosed     = errors.New("hls sessions are shut down")
+	ErrNoPlaylist = errors.New("transcoder exited without writing a playlist")
+	ErrBadName    = errors.New("not a playlist or segment name")
+)
+
+// Transcoder writes PlaylistName and its segments for input into dir. It returns once it is done or ctx
+// is cancelled, the segments stay servable after it returned
+type Transcoder func(ctx context.Context, input, dir string) error
+
+// Limiter caps the sessions reading from one volume at a time, media.IOLimiter is one
+type Limiter interface {
+	AcquireNow() bool
+	Release()
+}
+
+// Key identifies a session, two clients of the same entry get one each
+type Key struct {
+	ID     string // the media entry
+	Client string // e.g. the remote IP
+}
+
+type Manager struct {
+	Transcode Transcoder
+	Idle      time.Duration // a session nobody requested anything from for this long is removed
+	Dir       string        // where the session dirs are created, os.TempDir() if empty
+	Logger    *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[Key]*Session
+	closed   bool
+}
+
+func NewManager(transcode Transcoder, idle time.Duration, logger *slog.Logger) *Manager {
+	return &Manager{
+		Transcode: transcode,
+		Idle:      idle,
+		Logger:    logger,
+		sessions:  make(map[Key]*Session),
+	}
+}
+
+type Session struct {
+	key      Key
+	dir      string
+	cancel   context.CancelFunc
+	exited   chan struct{} // closed once the transcoder returned
+	err      error         // what the transcoder returned, only read once exited is closed
+	lastUsed atomic.Int64  // unix nanos of the last request
+}
+
+// Session returns the session of key, starting the transcoder for input when there is none yet. A new
+// session holds a slot of lim while its transcoder runs and fails with ErrBusy when none is free
+func (m *Manager) Session(key Key, input string, lim Limiter) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	if s, ok := m.sessions[key]; ok {
+		// a failed transcoder gets another go, the client asking again is likely a reload
+		if !s.failed() {
+			s.touch()
+			return s, nil
+		}
+		delete(m.sessions, key)
+		s.stop()
+	}
+
+	if !lim.AcquireNow() {
+		return nil, ErrBusy
+	}
+
+	dir, err := os.MkdirTemp(m.Dir, "streamer-hls-")
+	if err != nil {
+		lim.Release()
+		return nil, fmt.Errorf("create session dir: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Session{
+		key:    key,
+		dir:    dir,
+		cancel: cancel,
+		exited: make(chan struct{}),
+	}
+	s.touch()
+	m.sessions[key] = s
+
+	go func() {
+		defer close(s.exited)
+		// the segments are on the temp dir now, the volume is free for others
+		defer lim.Release()
+
+		s.err = m.Transcode(ctx, input, dir)
+		if s.err != nil && ctx.Err() == nil {
+			m.Logger.Warn("hls transcoder failed", "id", key.ID, "client", key.Client, "err", s.err)
+		}
+	}()
+
+	m.Logger.Debug("hls session started", "id", key.ID, "client", key.Client, "dir", dir)
+	return s, nil
+}
+
+// Lookup returns the running session of key, segment requests don't start new ones
+func (m *Manager) Lookup(key Key) (*Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[key]
+	if ok {
+		s.touch()
+	}
+	return s, ok
+}
+
+// Len returns the number of sessions
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// Run removes idle sessions until ctx is done, then all of them
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(m.Idle/2, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.Close()
+			return
+		case <-ticker.C:
+			m.reap(time.Now())
+		}
+	}
+}
+
+// reap stops the sessions that were idle at now
+func (m *Manager) reap(now time.Time) {
+	m.mu.Lock()
+	var idle []*Session
+	for key, s := range m.sessions {
+		if now.Sub(s.used()) >= m.Idle {
+			idle = append(idle, s)
+			delete(m.sessions, key)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, s := range idle {
+		m.Logger.Debug("hls session idle, removing", "id", s.key.ID, "client", s.key.Client)
+		s.stop()
+	}
+}
+
+// Close stops all sessions and removes their files, new ones are refused afterwards
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	sessions := m.sessions
+	m.sessions = make(map[Key]*Session)
+	m.mu.Unlock()
+
+	for _, s := range sessions {
+		s.stop()
+	}
+}
+
+// WaitPlaylist blocks until the transcoder wrote the playlist, it fails once the transcoder exited
+// without one or ctx is done
+func (s *Session) WaitPlaylist(ctx context.Context) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.hasPlaylist() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.exited:
+			// it may have written the playlist just before returning
+			if s.hasPlaylist() {
+				return nil
+			}
+			if s.err != nil {
+				return s.err
+			}
+			return ErrNoPlaylist
+		case <-ticker.C:
+		}
+	}
+}
+
+// Open opens the playlist or a segment of the session
+func (s *Session) Open(name string) (*os.File, error) {
+	if !validName(name) {
+		return nil, fmt.Errorf("%w: %q", ErrBadName, name)
+	}
+	s.touch()
+	return os.OpenInRoot(s.dir, name)
+}
+
+func (s *Session) hasPlaylist() bool {
+	_, err := os.Stat(filepath.Join(s.dir, PlaylistName))
+	return err == nil
+}
+
+// failed reports whether the transcoder exited with an error
+func (s *Session) failed() bool {
+	select {
+	case <-s.exited:
+		return s.err != nil
+	default:
+		return false
+	}
+}
+
+func (s *Session) touch() {
+	s.lastUsed.Store(time.Now().UnixNano())
+}
+
+func (s *Session) used() time.Time {
+	return time.Unix(0, s.lastUsed.Load())
+}
+
+// stop cancels the transcoder, waits for it and removes the session dir
+func (s *Session) stop() {
+	s.cancel()
+	<-s.exited
+	os.RemoveAll(s.dir)
+}
+
+// validName accepts the plain file names a transcoder writes, nothing with a path in it
+func validName(name string) bool {
+	if name == "" || name != filepath.Base(name) || filepath.IsAbs(name) {
+		return false
+	}
+	switch filepath.Ext(name) {
+	case ".m3u8", ".ts", ".m4s", ".mp4":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,318 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"streamer/internal/media"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// fakeTranscoder writes a playlist with one segment and then runs until it is cancelled
+type fakeTranscoder struct {
+	started atomic.Int32
+	running atomic.Int32
+}
+
+func (f *fakeTranscoder) transcode(ctx context.Context, input, dir string) error {
+	f.started.Add(1)
+	f.running.Add(1)
+	defer f.running.Add(-1)
+
+	if err := os.WriteFile(filepath.Join(dir, "seg00000.m4s"), []byte(input), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, PlaylistName), []byte("#EXTM3U\nseg00000.m4s\n"), 0o644); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func newTestManager(t *testing.T, transcode Transcoder) *Manager {
+	t.Helper()
+
+	m := NewManager(transcode, time.Minute, discardLogger())
+	m.Dir = t.TempDir()
+	t.Cleanup(m.Close)
+	return m
+}
+
+// sessionDirs lists the session dirs left in the manager's dir
+func sessionDirs(t *testing.T, m *Manager) []os.DirEntry {
+	t.Helper()
+
+	entries, err := os.ReadDir(m.Dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	return entries
+}
+
+func TestSessionServesSegments(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeTranscoder{}
+	m := newTestManager(t, fake.transcode)
+	lim := media.NewIOLimiter(2)
+
+	key := Key{ID: "movie", Client: "10.0.0.2"}
+	s, err := m.Session(key, "/media/movie.mkv", lim)
+	if err != nil {
+		t.Fatalf("Session() error = %v", err)
+	}
+	if err := s.WaitPlaylist(t.Context()); err != nil {
+		t.Fatalf("WaitPlaylist() error = %v", err)
+	}
+
+	f, err := s.Open("seg00000.m4s")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "/media/movie.mkv" {
+		t.Errorf("segment = %q, want what the transcoder wrote", data)
+	}
+
+	// the same client gets the same session, a second one its own
+	again, err := m.Session(key, "/media/movie.mkv", lim)
+	if err != nil || again != s {
+		t.Errorf("Session() for the same key = %p, %v, want the running session %p", again, err, s)
+	}
+	other, err := m.Session(Key{ID: "movie", Client: "10.0.0.3"}, "/media/movie.mkv", lim)
+	if err != nil {
+		t.Fatalf("Session() for another client error = %v", err)
+	}
+	if err := other.WaitPlaylist(t.Context()); err != nil {
+		t.Fatalf("WaitPlaylist() error = %v", err)
+	}
+	if got := fake.started.Load(); got != 2 {
+		t.Errorf("transcoder started %d times, want 2", got)
+	}
+	if got := lim.InUse(); got != 2 {
+		t.Errorf("io slots in use = %d, want one per running transcoder", got)
+	}
+
+	if _, ok := m.Lookup(Key{ID: "other", Client: "10.0.0.2"}); ok {
+		t.Error("Lookup() found a session that was never started")
+	}
+}
+
+func TestSessionOpenRejectsPaths(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeTranscoder{}
+	m := newTestManager(t, fake.transcode)
+
+	s, err := m.Session(Key{ID: "movie"}, "in", media.NewIOLimiter(1))
+	if err != nil {
+		t.Fatalf("Session() error = %v", err)
+	}
+	if err := s.WaitPlaylist(t.Context()); err != nil {
+		t.Fatalf("WaitPlaylist() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{"ok - playlist", PlaylistName, false},
+		{"ok - segment", "seg00000.m4s", false},
+		{"fail - parent dir", "../seg00000.m4s", true},
+		{"fail - sub dir", "x/seg00000.m4s", true},
+		{"fail - absolute", "/etc/passwd", true},
+		{"fail - other extension", "notes.txt", true},
+		{"fail - empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := s.Open(tt.file)
+			if f != nil {
+				f.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Open(%q) error = %v, wantErr %v", tt.file, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionLimiter(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		// a transcoder that is done once its playlist is written, like ffmpeg at the end of the file
+		finish := make(chan struct{})
+		m := newTestManager(t, func(ctx context.Context, input, dir string) error {
+			<-finish
+			return os.WriteFile(filepath.Join(dir, PlaylistName), nil, 0o644)
+		})
+		lim := media.NewIOLimiter(1)
+
+		if _, err := m.Session(Key{ID: "a"}, "a", lim); err != nil {
+			t.Fatalf("Session() error = %v", err)
+		}
+		if _, err := m.Session(Key{ID: "b"}, "b", lim); !errors.Is(err, ErrBusy) {
+			t.Fatalf("Session() with the volume busy error = %v, want ErrBusy", err)
+		}
+
+		// the slot is given back once the transcoder is done, not when the session goes away
+		close(finish)
+		synctest.Wait()
+		if got := lim.InUse(); got != 0 {
+			t.Fatalf("io slots in use = %d after the transcoder finished, want 0", got)
+		}
+		if _, err := m.Session(Key{ID: "b"}, "b", lim); err != nil {
+			t.Errorf("Session() after the slot was freed error = %v", err)
+		}
+		if got := m.Len(); got != 2 {
+			t.Errorf("Len() = %d, want 2", got)
+		}
+	})
+}
+
+func TestSessionIdleCleanup(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		fake := &fakeTranscoder{}
+		m := newTestManager(t, fake.transcode)
+		lim := media.NewIOLimiter(2)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			m.Run(ctx)
+		}()
+
+		watched, err := m.Session(Key{ID: "watched"}, "in", lim)
+		if err != nil {
+			t.Fatalf("Session() error = %v", err)
+		}
+		if _, err := m.Session(Key{ID: "abandoned"}, "in", lim); err != nil {
+			t.Fatalf("Session() error = %v", err)
+		}
+		synctest.Wait()
+
+		// the player keeps fetching segments of one, the other was closed
+		for range 4 {
+			time.Sleep(20 * time.Second)
+			f, err := watched.Open("seg00000.m4s")
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			f.Close()
+		}
+		synctest.Wait()
+
+		if _, ok := m.Lookup(Key{ID: "abandoned"}); ok {
+			t.Error("idle session still there")
+		}
+		if _, ok := m.Lookup(Key{ID: "watched"}); !ok {
+			t.Error("session in use was removed")
+		}
+		if got := fake.running.Load(); got != 1 {
+			t.Errorf("%d transcoders running, want the one of the watched session", got)
+		}
+		if got := lim.InUse(); got != 1 {
+			t.Errorf("io slots in use = %d, want 1", got)
+		}
+		if got := len(sessionDirs(t, m)); got != 1 {
+			t.Errorf("%d session dirs left, want 1", got)
+		}
+
+		// stopping removes the rest
+		cancel()
+		<-done
+		if got := fake.running.Load(); got != 0 {
+			t.Errorf("%d transcoders still running after Run returned", got)
+		}
+		if got := len(sessionDirs(t, m)); got != 0 {
+			t.Errorf("%d session dirs left after Run returned", got)
+		}
+		if _, err := m.Session(Key{ID: "late"}, "in", lim); !errors.Is(err, ErrClosed) {
+			t.Errorf("Session() after Run returned error = %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestSessionTranscoderFails(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		errCodec := errors.New("unsupported codec")
+		var runs atomic.Int32
+		m := newTestManager(t, func(ctx context.Context, input, dir string) error {
+			if runs.Add(1) == 1 {
+				return errCodec
+			}
+			if err := os.WriteFile(filepath.Join(dir, PlaylistName), nil, 0o644); err != nil {
+				return err
+			}
+			<-ctx.Done()
+			return nil
+		})
+		lim := media.NewIOLimiter(1)
+		key := Key{ID: "movie"}
+
+		s, err := m.Session(key, "in", lim)
+		if err != nil {
+			t.Fatalf("Session() error = %v", err)
+		}
+		if err := s.WaitPlaylist(t.Context()); !errors.Is(err, errCodec) {
+			t.Fatalf("WaitPlaylist() error = %v, want the transcoder's", err)
+		}
+
+		// asking again starts over instead of serving the failure until it is idle
+		retry, err := m.Session(key, "in", lim)
+		if err != nil {
+			t.Fatalf("Session() after a failure error = %v", err)
+		}
+		if retry == s {
+			t.Fatal("Session() returned the failed session")
+		}
+		if err := retry.WaitPlaylist(t.Context()); err != nil {
+			t.Errorf("WaitPlaylist() of the retry error = %v", err)
+		}
+		if got := len(sessionDirs(t, m)); got != 1 {
+			t.Errorf("%d session dirs, the failed one must be removed", got)
+		}
+	})
+}
+
+func TestWaitPlaylistCancelled(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		// never writes a playlist, e.g. ffmpeg stuck on a slow disk
+		m := newTestManager(t, func(ctx context.Context, input, dir string) error {
+			<-ctx.Done()
+			return nil
+		})
+
+		s, err := m.Session(Key{ID: "movie"}, "in", media.NewIOLimiter(1))
+		if err != nil {
+			t.Fatalf("Session() error = %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer cancel()
+		if err := s.WaitPlaylist(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("WaitPlaylist() error = %v, want the deadline", err)
+		}
+	})
+}
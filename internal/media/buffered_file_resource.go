@@ -1,29 +1,158 @@
 package media
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"os"
+	"sync"
 	"time"
 )
 
+// bufferPools holds a *sync.Pool of read buffers for every buffer size in use, so the short range requests
+// of TVs don't allocate 10MB each. The key is the size, the pools hold *[]byte
+var bufferPools sync.Map
+
+func bufferPool(size int) *sync.Pool {
+	if p, ok := bufferPools.Load(size); ok {
+		return p.(*sync.Pool)
+	}
+	p, _ := bufferPools.LoadOrStore(size, &sync.Pool{
+		New: func() any {
+			buf := make([]byte, size)
+			return &buf
+		},
+	})
+	return p.(*sync.Pool)
+}
+
+// minBufferSize is where buffers start and the smallest they shrink to
+const minBufferSize = 64 << 10
+
+// BufferedFileResource reads a file through a buffer sized by how it is read. It starts at minBufferSize, or
+// at what the request said it is going to read, doubles every time a sequential read empties it, up to the
+// configured size, and after a seek shrinks to the length of the run that came before. Short ranges, a TV
+// probing the file with 64KB requests, bypass it until they turn out to read on
 type BufferedFileResource struct {
-	file   *os.File
-	reader *bufio.Reader
-	info   os.FileInfo
+	file *os.File
+	info os.FileInfo
+
+	max   int                                        // the configured buffer size, buffers grow up to it
+	size  int                                        // the current buffer size, 0 bypasses the buffer
+	sized func(name string, size int, reason string) // optional, told every size picked
+
+	buf    *[]byte // from bufferPool(size), taken on the first fill and owned until Close or a resize hands it back
+	r, w   int     // (*buf)[r:w] is read from the file but not handed out yet
+	run    int64   // bytes handed out since open or the last seek
+	closed bool
+	gone   goneReporter
 }
 
-func newBufferedFileResource(file *os.File, info os.FileInfo, bufferSize int) *BufferedFileResource {
-	return &BufferedFileResource{
-		file:   file,
-		reader: bufio.NewReaderSize(file, bufferSize),
-		info:   info,
+// newBufferedFileResource opens a buffered resource for a request expecting to read expect bytes, 0 when it
+// reads to the end or doesn't say
+func newBufferedFileResource(file *os.File, info os.FileInfo, bufferSize int, expect int64, sized func(name string, size int, reason string)) *BufferedFileResource {
+	b := &BufferedFileResource{
+		file:  file,
+		info:  info,
+		max:   bufferSize,
+		sized: sized,
+	}
+
+	start := b.startSize()
+	switch {
+	case expect > 0 && expect <= int64(start):
+		// a buffer would be filled once and thrown away, the caller's reads are as good
+		b.resize(0, "open")
+	case expect > int64(start):
+		b.resize(b.sizeFor(expect), "open")
+	default:
+		b.resize(start, "open")
 	}
+	return b
+}
+
+func (b *BufferedFileResource) startSize() int {
+	return min(minBufferSize, b.max)
+}
+
+// sizeFor is the smallest power of two times the start size holding n bytes, at most the configured size.
+// Sticking to a few sizes keeps the pools few
+func (b *BufferedFileResource) sizeFor(n int64) int {
+	size := b.startSize()
+	for int64(size) < n && size < b.max {
+		size *= 2
+	}
+	return min(size, b.max)
+}
+
+// resize switches to a buffer of another size, only while nothing is buffered
+func (b *BufferedFileResource) resize(size int, reason string) {
+	if b.buf != nil && len(*b.buf) != size {
+		bufferPool(len(*b.buf)).Put(b.buf)
+		b.buf = nil
+	}
+	b.size = size
+	if b.sized != nil {
+		b.sized(b.Name(), size, reason)
+	}
+}
+
+// buffered is how much of the buffer is yet to be read
+func (b *BufferedFileResource) buffered() int {
+	return b.w - b.r
 }
 
 func (b *BufferedFileResource) Read(p []byte) (int, error) {
-	return b.reader.Read(p)
+	// the buffer may belong to another stream by now
+	if b.closed {
+		return 0, os.ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if b.r == b.w {
+		// bypassing, or a read as large as the buffer: copying it through the buffer gains nothing
+		if b.size == 0 || len(p) >= b.size {
+			n, err := b.file.Read(p)
+			b.advance(n)
+			return n, b.gone.check(b.Name(), err)
+		}
+
+		// a whole buffer went out without a seek, the next one may as well be bigger
+		if b.run >= int64(b.size) && b.size < b.max {
+			b.resize(min(2*b.size, b.max), "grow")
+		}
+		if b.buf == nil {
+			b.buf = bufferPool(b.size).Get().(*[]byte)
+		}
+		n, err := b.file.Read(*b.buf)
+		b.r, b.w = 0, n
+		if n == 0 {
+			return 0, b.gone.check(b.Name(), err)
+		}
+	}
+
+	n := copy(p, (*b.buf)[b.r:b.w])
+	b.r += n
+	b.advance(n)
+	return n, nil
+}
+
+// ReadAt reads the file directly, past the buffer and without moving the offset Read continues from. Like
+// FileResource.ReadAt it leaves reporting a gone file to Read
+func (b *BufferedFileResource) ReadAt(p []byte, off int64) (int, error) {
+	if b.closed {
+		return 0, os.ErrClosed
+	}
+	return b.file.ReadAt(p, off)
+}
+
+// advance counts n bytes handed out, a bypassed resource read through like a stream starts buffering
+func (b *BufferedFileResource) advance(n int) {
+	b.run += int64(n)
+	if b.size == 0 && b.run > int64(b.startSize()) {
+		b.resize(b.sizeFor(b.run), "sequential")
+	}
 }
 
 func (b *BufferedFileResource) Seek(offset int64, whence int) (int64, error) {
@@ -35,28 +164,25 @@ func (b *BufferedFileResource) Seek(offset int64, whence int) (int64, error) {
 		if err != nil {
 			return 0, fmt.Errorf("seek buffer %q: %w", fileName, err)
 		}
-		return curPos - int64(b.reader.Buffered()), nil
+		return curPos - int64(b.buffered()), nil
 	}
 
 	// Optimization: Forward seek within the current buffer
-	if whence == io.SeekCurrent && offset > 0 && offset <= int64(b.reader.Buffered()) {
-		_, err := b.reader.Discard(int(offset))
-		if err != nil {
-			return 0, err // Should technically not happen if Buffered() is correct
-		}
+	if whence == io.SeekCurrent && offset > 0 && offset <= int64(b.buffered()) {
+		b.r += int(offset)
 		// Return the new logical position
 		curPos, err := b.file.Seek(0, io.SeekCurrent)
 		if err != nil {
 			return 0, fmt.Errorf("seek buffer %q: %w", fileName, err)
 		}
-		return curPos - int64(b.reader.Buffered()), err
+		return curPos - int64(b.buffered()), err
 	}
 
 	// For relative seeks, account for buffered data
 	if whence == io.SeekCurrent {
 		// Adjust offset by how much data is still in the buffer
 		// (file is ahead of where the reader appears to be)
-		offset -= int64(b.reader.Buffered())
+		offset -= int64(b.buffered())
 	}
 
 	newPos, err := b.file.Seek(offset, whence)
@@ -65,11 +191,27 @@ func (b *BufferedFileResource) Seek(offset int64, whence int) (int64, error) {
 	}
 
 	// Seeking invalidates buffer
-	b.reader.Reset(b.file)
+	b.r, b.w = 0, 0
+
+	// the run that ended here is what the next one is likely to be. Seeks before any read (ServeContent
+	// finding the size and the start of the range) tell nothing
+	if b.run > 0 {
+		if size := b.sizeFor(b.run); b.size != 0 && size < b.size {
+			b.resize(size, "shrink")
+		}
+		b.run = 0
+	}
 	return newPos, nil
 }
 
+// Close closes the file and hands the buffer back to the pool, the resource can't be read from after
 func (b *BufferedFileResource) Close() error {
+	if b.buf != nil {
+		b.r, b.w = 0, 0
+		bufferPool(len(*b.buf)).Put(b.buf)
+		b.buf = nil
+	}
+	b.closed = true
 	return b.file.Close()
 }
 
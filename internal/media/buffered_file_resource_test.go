@@ -2,9 +2,16 @@
 package media
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
+	"slices"
+	"sync"
 	"testing"
 )
 
@@ -32,7 +39,7 @@ func TestBufferedFileResourceSeek(t *testing.T) {
 	info, _ := file.Stat()
 
 	// Create buffered resource with small buffer (5 bytes)
-	br := newBufferedFileResource(file, info, 5)
+	br := newBufferedFileResource(file, info, 5, 0, nil)
 	defer br.Close()
 
 	// Read first 3 bytes - fills buffer with "01234"
@@ -98,7 +105,7 @@ func TestBufferedFileResourceSeekRelative(t *testing.T) {
 	defer file.Close()
 	info, _ := file.Stat()
 
-	br := newBufferedFileResource(file, info, 5)
+	br := newBufferedFileResource(file, info, 5, 0, nil)
 	defer br.Close()
 
 	// Read to position 5
@@ -118,3 +125,250 @@ func TestBufferedFileResourceSeekRelative(t *testing.T) {
 		t.Errorf("Expected 'A' after relative seek, got '%c'", buf[0])
 	}
 }
+
+func TestBufferedFileResourceReadAfterClose(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "film.mp4")
+	if err := os.WriteFile(path, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := file.Stat()
+
+	br := newBufferedFileResource(file, info, 4, 0, nil)
+	if err := br.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the buffer went back to the pool, reading now must not touch it
+	if _, err := br.Read(make([]byte, 2)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Read() after Close error = %v, want %v", err, os.ErrClosed)
+	}
+	if err := br.Close(); err == nil {
+		t.Error("second Close() succeeded")
+	}
+}
+
+// many streams opening, seeking, reading and closing at once must each read their own file through their own
+// buffer, run with -race
+func TestBufferedFileResourcePoolConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const files, size = 8, 64 << 10
+	dir := t.TempDir()
+	contents := make([][]byte, files)
+	for i := range contents {
+		contents[i] = make([]byte, size)
+		for j := range contents[i] {
+			contents[i][j] = byte(i*31 + j%251)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.mp4", i)), contents[i], 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewManager(4096, ModeFileBuffered)
+	m.AddMount("vol_0", dir, NewIOLimiter(1))
+
+	var wg sync.WaitGroup
+	for g := range 16 {
+		wg.Go(func() {
+			rng := rand.New(rand.NewPCG(uint64(g), 0))
+			p := make([]byte, 10000)
+			for range 200 {
+				i := rng.IntN(files)
+				res, err := m.OpenResource(&Entry{Path: fmt.Sprintf("%d.mp4", i), MountID: "vol_0"}, 0)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				off := rng.Int64N(size - 2*int64(len(p)))
+				if _, err := res.Seek(off, io.SeekStart); err != nil {
+					t.Error(err)
+				}
+				// small reads go through the buffer
+				if _, err := io.ReadFull(res, p[:rng.IntN(len(p))+1]); err != nil {
+					t.Error(err)
+				}
+				n := rng.IntN(len(p)) + 1
+				pos, _ := res.Seek(0, io.SeekCurrent)
+				if _, err := io.ReadFull(res, p[:n]); err != nil {
+					t.Error(err)
+				} else if !bytes.Equal(p[:n], contents[i][pos:pos+int64(n)]) {
+					t.Errorf("%d.mp4 at %d read someone else's bytes", i, pos)
+				}
+				res.Close()
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// BenchmarkBufferedFileResource is a short range request of a TV: open, read 64KB, close. bufio is how every
+// request allocated its buffer before the pool
+func BenchmarkBufferedFileResource(b *testing.B) {
+	const bufferSize = 10 << 20
+
+	path := filepath.Join(b.TempDir(), "film.mp4")
+	if err := os.WriteFile(path, make([]byte, 1<<20), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	p := make([]byte, 64<<10)
+
+	b.Run("bufio", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			file, err := os.Open(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := io.ReadFull(bufio.NewReaderSize(file, bufferSize), p); err != nil {
+				b.Fatal(err)
+			}
+			file.Close()
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			file, err := os.Open(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			info, _ := file.Stat()
+			br := newBufferedFileResource(file, info, bufferSize, int64(len(p)), nil)
+			if _, err := io.ReadFull(br, p); err != nil {
+				b.Fatal(err)
+			}
+			br.Close()
+		}
+	})
+}
+
+func TestBufferedFileResourceAdaptive(t *testing.T) {
+	t.Parallel()
+
+	const size = 4 << 20
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	path := filepath.Join(t.TempDir(), "film.mp4")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a step seeks to seek, or with read set reads that many bytes chunk bytes at a time
+	type step struct {
+		seek        int64
+		read, chunk int
+	}
+	seek := func(off int64) step { return step{seek: off} }
+	read := func(n, chunk int) step { return step{read: n, chunk: chunk} }
+	type sized struct {
+		size   int
+		reason string
+	}
+
+	tests := []struct {
+		name   string
+		max    int
+		expect int64
+		steps  []step
+		want   []sized
+	}{
+		{
+			"ok - grows on sequential reads",
+			1 << 20, 0,
+			[]step{read(2<<20, 32<<10)},
+			[]sized{{64 << 10, "open"}, {128 << 10, "grow"}, {256 << 10, "grow"}, {512 << 10, "grow"}, {1 << 20, "grow"}},
+		},
+		{
+			"ok - sized by the range",
+			1 << 20, 300 << 10,
+			[]step{seek(1000), read(300<<10, 32<<10)},
+			[]sized{{512 << 10, "open"}},
+		},
+		{
+			"ok - short range bypasses the buffer",
+			1 << 20, 64 << 10,
+			[]step{seek(1 << 20), read(64<<10, 32<<10)},
+			[]sized{{0, "open"}},
+		},
+		{
+			"ok - short range reading on starts buffering",
+			1 << 20, 16 << 10,
+			[]step{read(256<<10, 32<<10)},
+			[]sized{{0, "open"}, {128 << 10, "sequential"}, {256 << 10, "grow"}},
+		},
+		{
+			"ok - seek shrinks to the run before it",
+			1 << 20, 0,
+			[]step{read(1<<20, 32<<10), seek(0), read(100<<10, 10<<10), seek(2 << 20), read(300<<10, 32<<10)},
+			[]sized{{64 << 10, "open"}, {128 << 10, "grow"}, {256 << 10, "grow"}, {512 << 10, "grow"}, {1 << 20, "grow"}, {128 << 10, "shrink"}, {256 << 10, "grow"}},
+		},
+		{
+			"ok - seeks before reading tell nothing",
+			1 << 20, 0,
+			[]step{seek(size - 1), seek(0), seek(3 << 20), read(32<<10, 32<<10)},
+			[]sized{{64 << 10, "open"}},
+		},
+		{
+			"ok - configured size below the start size",
+			4096, 1 << 20,
+			[]step{read(64<<10, 1000)},
+			[]sized{{4096, "open"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, _ := file.Stat()
+
+			var got []sized
+			br := newBufferedFileResource(file, info, tt.max, tt.expect, func(name string, size int, reason string) {
+				got = append(got, sized{size, reason})
+			})
+			defer br.Close()
+
+			var pos int64
+			for i, s := range tt.steps {
+				if s.read == 0 {
+					if pos, err = br.Seek(s.seek, io.SeekStart); err != nil {
+						t.Fatalf("step %d: Seek(%d) error = %v", i, s.seek, err)
+					}
+					continue
+				}
+				p := make([]byte, s.chunk)
+				for done := 0; done < s.read; done += s.chunk {
+					if _, err := io.ReadFull(br, p); err != nil {
+						t.Fatalf("step %d: read at %d error = %v", i, pos, err)
+					}
+					if !bytes.Equal(p, content[pos:pos+int64(s.chunk)]) {
+						t.Fatalf("step %d: wrong bytes at %d", i, pos)
+					}
+					pos += int64(s.chunk)
+				}
+				// the buffer must not have lost track of where the reader is
+				if cur, err := br.Seek(0, io.SeekCurrent); err != nil || cur != pos {
+					t.Fatalf("step %d: position = %d, %v, want %d", i, cur, err, pos)
+				}
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("buffer sizes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package media
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// CachedEntry is what the registry cache keeps of a file, enough to give it the same UUID, added time and
+// hidden flag after a restart
+type CachedEntry struct {
+	UUID    uuid.UUID `json:"uuid"`
+	MountID string    `json:"mount_id"`
+	Path    string    `json:"path"`
+	AddedAt time.Time `json:"added_at,omitzero"` // zero in caches of older versions, the next scan sets it
+	Hidden  bool      `json:"hidden,omitempty"`
+}
+
+// Cached returns the UUID of every file the scans know, ordered by mount and path. Files of a volume
+// that is unplugged keep theirs until the volume is scanned without them
+func (r *Registry) Cached() []CachedEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cached := make([]CachedEntry, 0, len(r.known))
+	for key, f := range r.known {
+		cached = append(cached, CachedEntry{UUID: f.id, MountID: key.mountID, Path: key.path, AddedAt: f.added, Hidden: f.hidden})
+	}
+	slices.SortFunc(cached, func(a, b CachedEntry) int {
+		return cmp.Or(cmp.Compare(a.MountID, b.MountID), cmp.Compare(a.Path, b.Path))
+	})
+	return cached
+}
+
+// Restore hands the registry the UUIDs, added times and hidden flags of a cache, scans finding these files again
+// give them the same ones. Call it before the first scan
+func (r *Registry) Restore(cached []CachedEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range cached {
+		if c.UUID.IsNil() || c.MountID == "" || c.Path == "" {
+			continue
+		}
+		r.known[fileKey{c.MountID, c.Path}] = knownFile{id: c.UUID, added: c.AddedAt, hidden: c.Hidden}
+	}
+}
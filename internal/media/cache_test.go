@@ -0,0 +1,119 @@
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+func TestRegistryRestoreKeepsUUIDs(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, name := range []string{"Heat.mp4", "Action/Speed.mp4"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := NewRegistry()
+	if err := before.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	cached := before.Cached()
+	if len(cached) != 2 {
+		t.Fatalf("Cached() = %v, want both files", cached)
+	}
+
+	// a restart: same files, new registry
+	unplugged := CachedEntry{UUID: uuid.Must(uuid.NewV7()), MountID: "usb_0", Path: "Alien.mkv"}
+	after := NewRegistry()
+	after.Restore(append(cached, unplugged))
+	if err := after.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	for _, e := range before.List() {
+		got, err := after.Get(e.UUID)
+		if err != nil || got.Path != e.Path {
+			t.Errorf("%s after the restart: %v, %v, want the UUID it had", e.Path, got, err)
+			continue
+		}
+		if !got.AddedAt.Equal(e.AddedAt) {
+			t.Errorf("%s added at %v after the restart, want %v", e.Path, got.AddedAt, e.AddedAt)
+		}
+	}
+
+	// a file that is gone loses its UUID, the unscanned volume keeps its own
+	if err := os.Remove(filepath.Join(root, "Heat.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := after.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	speed := entryByName(t, before, "Speed.mp4")
+	got := after.Cached()
+	want := []CachedEntry{
+		unplugged,
+		{UUID: speed.UUID, MountID: "vol_0", Path: "Action/Speed.mp4", AddedAt: speed.AddedAt},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Cached() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Cached()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func entryByName(t *testing.T, r *Registry, name string) Entry {
+	t.Helper()
+
+	for _, e := range r.List() {
+		if e.Name == name {
+			return e
+		}
+	}
+	t.Fatalf("no entry %s", name)
+	return Entry{}
+}
+
+func TestRegistryRestoreKeepsHidden(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, name := range []string{"Heat.mp4", "Speed.mp4"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := NewRegistry()
+	if err := before.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	heat := entryByName(t, before, "Heat.mp4")
+	if _, err := before.SetHidden(heat.UUID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restart: the cache hides the path before the first scan finds it
+	after := NewRegistry()
+	after.Restore(before.Cached())
+	if err := after.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := after.List(); len(got) != 1 || got[0].Name != "Speed.mp4" {
+		t.Errorf("List() after the restart = %v, want only Speed.mp4", got)
+	}
+	if e, err := after.Get(heat.UUID); err != nil || !e.Hidden {
+		t.Errorf("Get(Heat) after the restart = %+v, %v, want it hidden with the same UUID", e, err)
+	}
+}
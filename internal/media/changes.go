@@ -0,0 +1,86 @@
+package media
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// ErrChangesTruncated is returned by Changes for a sequence number the journal can't go on from: the
+// changes after it were dropped, or it is from before a restart. The caller has to read the whole library
+// again
+var ErrChangesTruncated = errors.New("changes truncated")
+
+// DefaultJournalSize is how many changes the journal keeps unless SetJournalSize says otherwise
+const DefaultJournalSize = 10000
+
+// ChangeKind is what happened to an entry
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified" // its file changed, or it was hidden or shown again
+)
+
+// Change is a change of the library in the journal, numbered in the order they happened. The numbers of a
+// run start where the clock is, past those of the runs before, so a number is never handed out twice
+type Change struct {
+	Seq      uint64     `json:"seq"`
+	Kind     ChangeKind `json:"kind"`
+	UUID     uuid.UUID  `json:"uuid"`
+	MountID  string     `json:"mount_id"`
+	Path     string     `json:"path"`
+	Category string     `json:"category"`
+	At       time.Time  `json:"at"`
+}
+
+// journal is the latest changes of the registry, guarded by its mu
+type journal struct {
+	size    int      // changes kept
+	changes []Change // the latest, up to twice size long so dropping the oldest doesn't copy every time
+	seq     uint64   // of the latest change, where the run started before the first
+}
+
+func newJournal(now time.Time) journal {
+	return journal{size: DefaultJournalSize, seq: uint64(now.UnixMicro())}
+}
+
+// record adds a change of e, r.mu must be held for writing
+func (r *Registry) record(kind ChangeKind, e *Entry, at time.Time) {
+	j := &r.journal
+	j.seq++
+	j.changes = append(j.changes, Change{Seq: j.seq, Kind: kind, UUID: e.UUID, MountID: e.MountID, Path: e.Path, Category: e.Category, At: at})
+	if len(j.changes) >= 2*j.size {
+		j.changes = slices.Clone(j.changes[len(j.changes)-j.size:])
+	}
+}
+
+// kept is the changes the journal still has, oldest first. r.mu must be held
+func (j *journal) kept() []Change {
+	return j.changes[max(len(j.changes)-j.size, 0):]
+}
+
+// SetJournalSize sets how many changes the journal keeps, at least one. Call it before the first scan
+func (r *Registry) SetJournalSize(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.journal.size = max(n, 1)
+}
+
+// Changes returns the changes after the sequence number since, oldest first, and the number of the latest,
+// what to ask from the next time. A number from another run, 0 included, is truncated: start from the
+// number that comes with the error and read the library once
+func (r *Registry) Changes(since uint64) ([]Change, uint64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	kept := r.journal.kept()
+	first := r.journal.seq + 1 - uint64(len(kept))
+	if since > r.journal.seq || since+1 < first {
+		return nil, r.journal.seq, ErrChangesTruncated
+	}
+	return slices.Clone(kept[since+1-first:]), r.journal.seq, nil
+}
@@ -0,0 +1,163 @@
+package media
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestRegistryChanges(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.mp4"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+
+	// a client starting out learns where the journal is from the error
+	_, seq, err := r.Changes(0)
+	if !errors.Is(err, ErrChangesTruncated) || seq == 0 {
+		t.Fatalf("Changes(0) = %d, %v, want the current seq and ErrChangesTruncated", seq, err)
+	}
+
+	steps := []struct {
+		name   string
+		change func() error
+		want   []string // kind and path
+	}{
+		{"ok - first scan", func() error { return r.Scan("vol_0", root) }, []string{"added a.mp4"}},
+		{"ok - nothing new", func() error { return r.Scan("vol_0", root) }, nil},
+		{"ok - file added", func() error {
+			if err := os.WriteFile(filepath.Join(root, "b.mp4"), []byte("x"), 0o644); err != nil {
+				return err
+			}
+			return r.Scan("vol_0", root)
+		}, []string{"added b.mp4"}},
+		{"ok - file grew", func() error {
+			if err := os.WriteFile(filepath.Join(root, "b.mp4"), []byte("xx"), 0o644); err != nil {
+				return err
+			}
+			return r.Scan("vol_0", root)
+		}, []string{"modified b.mp4"}},
+		{"ok - hidden", func() error {
+			_, err := r.SetHidden(r.byPath[fileKey{"vol_0", "b.mp4"}], true)
+			return err
+		}, []string{"modified b.mp4"}},
+		{"ok - file removed", func() error {
+			if err := os.Remove(filepath.Join(root, "a.mp4")); err != nil {
+				return err
+			}
+			return r.Scan("vol_0", root)
+		}, []string{"removed a.mp4"}},
+		{"ok - gone while streaming", func() error {
+			r.Remove("vol_0", "b.mp4")
+			return nil
+		}, []string{"removed b.mp4"}},
+	}
+
+	// the steps build on each other, no subtests
+	for _, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		changes, latest, err := r.Changes(seq)
+		if err != nil {
+			t.Fatalf("%s: Changes(%d) error = %v", step.name, seq, err)
+		}
+		var got []string
+		for n, c := range changes {
+			if c.Seq != seq+uint64(n)+1 || c.MountID != "vol_0" || c.At.IsZero() {
+				t.Errorf("%s: change %+v, want seq %d on vol_0", step.name, c, seq+uint64(n)+1)
+			}
+			got = append(got, string(c.Kind)+" "+c.Path)
+		}
+		if !slices.Equal(got, step.want) || latest != seq+uint64(len(step.want)) {
+			t.Errorf("%s: changes = %q up to %d, want %q after %d", step.name, got, latest, step.want, seq)
+		}
+		seq = latest
+	}
+
+	if _, _, err := r.Changes(seq + 1); !errors.Is(err, ErrChangesTruncated) {
+		t.Errorf("Changes() from the future error = %v, want ErrChangesTruncated", err)
+	}
+}
+
+func TestRegistryChangesTruncated(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	r.SetJournalSize(3)
+	_, start, _ := r.Changes(0)
+	for n := range 10 {
+		addEntry(t, r, strconv.Itoa(n)+".mp4")
+	}
+	latest := start + 10
+
+	tests := []struct {
+		name      string
+		since     uint64
+		wantPaths []string
+		wantErr   bool
+	}{
+		{"ok - up to date", latest, nil, false},
+		{"ok - the last one", latest - 1, []string{"9.mp4"}, false},
+		{"ok - all that are kept", latest - 3, []string{"7.mp4", "8.mp4", "9.mp4"}, false},
+		{"fail - one dropped", latest - 4, nil, true},
+		{"fail - from the start", start, nil, true},
+		{"fail - another run", 42, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			changes, seq, err := r.Changes(tt.since)
+			if errors.Is(err, ErrChangesTruncated) != tt.wantErr || seq != latest {
+				t.Fatalf("Changes(%d) = %d, %v, want %d, truncated %v", tt.since, seq, err, latest, tt.wantErr)
+			}
+			var paths []string
+			for _, c := range changes {
+				paths = append(paths, c.Path)
+			}
+			if !slices.Equal(paths, tt.wantPaths) {
+				t.Errorf("Changes(%d) = %q, want %q", tt.since, paths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestRegistryChangesConcurrent(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	_, start, _ := r.Changes(0)
+	var wg sync.WaitGroup
+	for n := range 50 {
+		wg.Go(func() { addEntry(t, r, strconv.Itoa(n)+".mp4") })
+	}
+	wg.Wait()
+
+	changes, seq, err := r.Changes(start)
+	if err != nil || len(changes) != 50 || seq != start+50 {
+		t.Fatalf("Changes() = %d changes up to %d, %v, want 50 up to %d", len(changes), seq, err, start+50)
+	}
+	for n, c := range changes {
+		if c.Seq != start+uint64(n)+1 {
+			t.Fatalf("change %d has seq %d, want %d", n, c.Seq, start+uint64(n)+1)
+		}
+	}
+}
+
+func addEntry(t *testing.T, r *Registry, path string) {
+	t.Helper()
+	e, err := NewEntry("vol_0", path, path, "", 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	r.Add(e)
+}
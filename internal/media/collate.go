@@ -0,0 +1,162 @@
+package media
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collation is how names compare when entries are sorted by name
+type Collation string
+
+const (
+	CollateBytes   Collation = "bytes"   // byte by byte: "Z" before "a" before "É", "10" before "2"
+	CollateNatural Collation = "natural" // runs of digits compare as numbers: "2 Fast" before "10 Things"
+	// the Unicode Collation Algorithm ignoring case and accents, numbers by value: "Épisode 2" next to
+	// "episode 2" and before "Episode 10". "locale" alone is the order common to most languages,
+	// "locale:sv" the one of the language with that BCP 47 tag, where Å comes after Z
+	CollateLocale Collation = "locale"
+)
+
+// ParseCollation checks a collation from the config or a query. The language of locale:<tag> comes back
+// in its canonical form, "locale:sv-se" as "locale:sv-SE"
+func ParseCollation(s string) (Collation, error) {
+	switch c := Collation(s); c {
+	case CollateBytes, CollateNatural, CollateLocale:
+		return c, nil
+	}
+	if tag, ok := strings.CutPrefix(s, string(CollateLocale)+":"); ok {
+		t, err := language.Parse(tag)
+		if err != nil {
+			return "", fmt.Errorf("collation %q: %w", s, err)
+		}
+		return Collation(string(CollateLocale) + ":" + t.String()), nil
+	}
+	return "", fmt.Errorf("unknown collation %q, use bytes, natural, locale or locale:<language>", s)
+}
+
+// Compare orders a and b, names that are equal under c (e.g. "heat" and "Heat" under CollateLocale) go
+// byte by byte so the order stays total. The empty collation is CollateBytes
+func (c Collation) Compare(a, b string) int {
+	switch {
+	case c == CollateNatural:
+		return cmp.Or(naturalCompare(a, b), strings.Compare(a, b))
+	case c.locale():
+		pool := c.collators()
+		col := pool.Get().(*collate.Collator)
+		defer pool.Put(col)
+		return cmp.Or(col.CompareString(a, b), strings.Compare(a, b))
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// locale reports whether c is CollateLocale, with a language or without
+func (c Collation) locale() bool {
+	return c == CollateLocale || strings.HasPrefix(string(c), string(CollateLocale)+":")
+}
+
+// tag is the language of a locale collation, und (the root order) for CollateLocale
+func (c Collation) tag() language.Tag {
+	tag, _ := strings.CutPrefix(string(c), string(CollateLocale)+":")
+	return language.Make(tag)
+}
+
+// newCollator is the collate.Collator of a locale collation. Loose ignores case, accents and width
+func (c Collation) newCollator() *collate.Collator {
+	return collate.New(c.tag(), collate.Loose, collate.Numeric)
+}
+
+// collatorPools keeps a pool of collators by locale collation, a Collator keeps buffers of its own and
+// can't be shared between goroutines, making one for every comparison costs more than the comparison
+var collatorPools sync.Map
+
+func (c Collation) collators() *sync.Pool {
+	if pool, ok := collatorPools.Load(c); ok {
+		return pool.(*sync.Pool)
+	}
+	pool, _ := collatorPools.LoadOrStore(c, &sync.Pool{New: func() any { return c.newCollator() }})
+	return pool.(*sync.Pool)
+}
+
+// sortByName sorts s by the name of its elements under c. A locale collation works out the sort key of
+// every name once and compares those: a Collator comparing two names does the work of both keys each time,
+// and a sort compares every name many times
+func sortByName[E any](s []E, name func(E) string, c Collation) {
+	if !c.locale() {
+		slices.SortFunc(s, func(a, b E) int { return c.Compare(name(a), name(b)) })
+		return
+	}
+
+	type keyed struct {
+		key []byte
+		e   E
+	}
+	col := c.newCollator()
+	var buf collate.Buffer
+	keys := make([]keyed, len(s))
+	for i, e := range s {
+		keys[i] = keyed{col.KeyFromString(&buf, name(e)), e}
+	}
+	slices.SortFunc(keys, func(a, b keyed) int {
+		return cmp.Or(bytes.Compare(a.key, b.key), strings.Compare(name(a.e), name(b.e)))
+	})
+	for i, k := range keys {
+		s[i] = k.e
+	}
+}
+
+// naturalCompare compares a and b rune by rune, a run of digits against another as the number it is.
+// Leading zeros don't count, "007" and "7" are equal. It allocates nothing, sorting calls it a lot
+func naturalCompare(a, b string) int {
+	// the common prefix compares equal either way, unless a number or a rune runs on past its end
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	for n > 0 && (isDigit(a[n-1]) || n < len(a) && !utf8.RuneStart(a[n]) || n < len(b) && !utf8.RuneStart(b[n])) {
+		n--
+	}
+
+	i, j := n, n
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			na, nb := digits(a[i:]), digits(b[j:])
+			// the longer number without its leading zeros is the larger one, same lengths go digit by digit
+			da, db := strings.TrimLeft(a[i:i+na], "0"), strings.TrimLeft(b[j:j+nb], "0")
+			if c := cmp.Or(cmp.Compare(len(da), len(db)), strings.Compare(da, db)); c != 0 {
+				return c
+			}
+			i, j = i+na, j+nb
+			continue
+		}
+
+		ra, wa := utf8.DecodeRuneInString(a[i:])
+		rb, wb := utf8.DecodeRuneInString(b[j:])
+		if ra != rb {
+			return cmp.Compare(ra, rb)
+		}
+		i, j = i+wa, j+wb
+	}
+	return cmp.Compare(len(a)-i, len(b)-j)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// digits returns the length of the run of ASCII digits s starts with
+func digits(s string) int {
+	n := 0
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	return n
+}
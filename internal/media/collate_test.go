@@ -0,0 +1,248 @@
+package media
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+func TestCollationSort(t *testing.T) {
+	t.Parallel()
+
+	names := []string{"Zebra.mp4", "épisode 2.mkv", "Episode 10.mkv", "10 Things.mp4", "2 Fast 2 Furious.mp4", "Alien 3.mkv", "alien.mkv", "Alien 003.mkv", "Épisode 1.mkv", "Ålesund.mp4"}
+
+	tests := []struct {
+		collation Collation
+		want      []string
+	}{
+		{CollateBytes, []string{"10 Things.mp4", "2 Fast 2 Furious.mp4", "Alien 003.mkv", "Alien 3.mkv", "Episode 10.mkv", "Zebra.mp4", "alien.mkv", "Ålesund.mp4", "Épisode 1.mkv", "épisode 2.mkv"}},
+		{"", []string{"10 Things.mp4", "2 Fast 2 Furious.mp4", "Alien 003.mkv", "Alien 3.mkv", "Episode 10.mkv", "Zebra.mp4", "alien.mkv", "Ålesund.mp4", "Épisode 1.mkv", "épisode 2.mkv"}},
+		{CollateNatural, []string{"2 Fast 2 Furious.mp4", "10 Things.mp4", "Alien 003.mkv", "Alien 3.mkv", "Episode 10.mkv", "Zebra.mp4", "alien.mkv", "Ålesund.mp4", "Épisode 1.mkv", "épisode 2.mkv"}},
+		{CollateLocale, []string{"2 Fast 2 Furious.mp4", "10 Things.mp4", "Ålesund.mp4", "Alien 003.mkv", "Alien 3.mkv", "alien.mkv", "Épisode 1.mkv", "épisode 2.mkv", "Episode 10.mkv", "Zebra.mp4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("ok - "+string(tt.collation), func(t *testing.T) {
+			t.Parallel()
+
+			got := slices.Clone(names)
+			slices.SortFunc(got, tt.collation.Compare)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sorted = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNaturalCompare(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		a, b string
+		want int
+	}{
+		{"ok - numbers by value", "Part 9", "Part 10", -1},
+		{"ok - leading zeros ignored", "Part 007", "Part 7", 0},
+		{"ok - longer number after", "Rocky 2", "Rocky 2b", -1},
+		{"ok - prefix first", "Heat", "Heat 2", -1},
+		{"ok - digits before letters", "1917", "Alien", -1},
+		{"ok - case kept", "alien", "Alien", 1},
+		{"ok - huge numbers", "Part 123456789012345678901234567890", "Part 99", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := naturalCompare(tt.a, tt.b); got != tt.want {
+				t.Errorf("naturalCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := naturalCompare(tt.b, tt.a); got != -tt.want {
+				t.Errorf("naturalCompare(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+			}
+		})
+	}
+}
+
+func TestLocaleCompare(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		collation Collation
+		a, b      string
+		want      int // before the names are told apart byte by byte
+	}{
+		{"ok - case folded", CollateLocale, "alien", "Alien", 0},
+		{"ok - accents folded", CollateLocale, "Élan", "elan", 0},
+		{"ok - sharp s", CollateLocale, "Straße", "STRASSE", 0},
+		{"ok - latin extended-b", CollateLocale, "Ǎrbor", "arbor", 0},
+		{"ok - greek accents", CollateLocale, "Ελένη", "ελενη", 0},
+		{"ok - cyrillic accents", CollateLocale, "Ёлка", "елка", 0},
+		{"ok - numbers by value", CollateLocale, "Part 9", "Part 10", -1},
+		{"ok - leading zeros ignored", CollateLocale, "Part 007", "Part 7", 0},
+		{"ok - root keeps Å with the a", CollateLocale, "Ålesund", "Zebra", -1},
+		{"ok - swedish puts Å after z", "locale:sv", "Ålesund", "Zebra", 1},
+		{"ok - german keeps Ä with the a", "locale:de", "Ärger", "Bar", -1},
+		{"ok - swedish puts Ä after z", "locale:sv", "Ärger", "Zebra", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			col := tt.collation.newCollator()
+			if got := col.CompareString(tt.a, tt.b); got != tt.want {
+				t.Errorf("%s CompareString(%q, %q) = %d, want %d", tt.collation, tt.a, tt.b, got, tt.want)
+			}
+			// Compare stays total, names equal under the collation go byte by byte
+			if got, want := tt.collation.Compare(tt.a, tt.b), cmp.Or(tt.want, strings.Compare(tt.a, tt.b)); got != want {
+				t.Errorf("%s Compare(%q, %q) = %d, want %d", tt.collation, tt.a, tt.b, got, want)
+			}
+		})
+	}
+}
+
+// sorting by the keys of the names must give what sorting with Compare does
+func TestSortByNameKeys(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewPCG(3, 4))
+	words := []string{"Heat", "heat", "épisode", "Episode", "Alien", "Straße", "strasse", "Ålesund", "Part 007", "Part 7", "Part 10", "Über", "ёлка", "Ελένη"}
+	names := make([]string, 500)
+	for i := range names {
+		names[i] = words[rng.IntN(len(words))] + " " + words[rng.IntN(len(words))]
+	}
+
+	for _, c := range []Collation{CollateLocale, "locale:sv", "locale:de"} {
+		want := slices.Clone(names)
+		slices.SortFunc(want, c.Compare)
+		got := slices.Clone(names)
+		sortByName(got, func(s string) string { return s }, c)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s sortByName() = %q, want %q", c, got, want)
+		}
+	}
+}
+
+func TestParseCollation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		s       string
+		want    Collation
+		wantErr bool
+	}{
+		{"ok - bytes", "bytes", CollateBytes, false},
+		{"ok - natural", "natural", CollateNatural, false},
+		{"ok - locale", "locale", CollateLocale, false},
+		{"ok - language", "locale:sv", "locale:sv", false},
+		{"ok - language made canonical", "locale:de-de", "locale:de-DE", false},
+		{"fail - empty", "", "", true},
+		{"fail - case", "Locale", "", true},
+		{"fail - language alone", "fr_FR", "", true},
+		{"fail - empty language", "locale:", "", true},
+		{"fail - bad language", "locale:not a tag", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseCollation(tt.s)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseCollation(%q) = %q, %v, want %q, error %t", tt.s, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegistryCollation(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	for _, name := range []string{"Heat 10.mkv", "heat 9.mkv", "Heat 2.mkv"} {
+		e, err := NewEntry("vol_0", name, name, "", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Add(e)
+	}
+	names := func() []string {
+		var got []string
+		for _, e := range r.List() {
+			got = append(got, e.Name)
+		}
+		return got
+	}
+
+	if got, want := names(), []string{"Heat 10.mkv", "Heat 2.mkv", "heat 9.mkv"}; !slices.Equal(got, want) {
+		t.Errorf("List() = %q, want %q byte by byte", got, want)
+	}
+	version, _ := r.Watch()
+	r.SetCollation(CollateLocale)
+	if got, want := names(), []string{"Heat 2.mkv", "heat 9.mkv", "Heat 10.mkv"}; !slices.Equal(got, want) {
+		t.Errorf("List() = %q, want %q under locale", got, want)
+	}
+	if got, _ := r.Watch(); got == version {
+		t.Error("registry version unchanged with the order")
+	}
+}
+
+// BenchmarkSortEntries sorts a library of 50k entries by name the way a request does, under every collation
+func BenchmarkSortEntries(b *testing.B) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	words := []string{"Heat", "épisode", "Alien", "the", "Return", "of", "Ålesund", "night", "Part", "Über"}
+	entries := make([]Entry, 50_000)
+	for i := range entries {
+		name := fmt.Sprintf("%s %s %d %s.mkv", words[rng.IntN(len(words))], words[rng.IntN(len(words))], rng.IntN(200), words[rng.IntN(len(words))])
+		entries[i] = Entry{UUID: uuid.Must(uuid.NewV7()), Name: name}
+	}
+
+	for _, c := range []Collation{CollateBytes, CollateNatural, CollateLocale} {
+		b.Run(string(c), func(b *testing.B) {
+			sorted := make([]Entry, len(entries))
+			b.ReportAllocs()
+			for b.Loop() {
+				copy(sorted, entries)
+				SortEntries(sorted, SortName, c)
+			}
+		})
+	}
+}
+
+// BenchmarkRegistryList lists a library of 50k entries under the locale collation, as it stands and after
+// every change, when the sorted order can't come from the cache
+func BenchmarkRegistryList(b *testing.B) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	words := []string{"Heat", "épisode", "Alien", "the", "Return", "of", "Ålesund", "night", "Part", "Über"}
+	r := NewRegistry()
+	r.SetCollation(CollateLocale)
+	var last *Entry
+	for i := range 50_000 {
+		name := fmt.Sprintf("%s %s %d %s.mkv", words[rng.IntN(len(words))], words[rng.IntN(len(words))], rng.IntN(200), words[rng.IntN(len(words))])
+		last = &Entry{UUID: uuid.Must(uuid.NewV7()), MountID: "vol_0", Path: fmt.Sprint(i), Name: name}
+		r.Add(last)
+	}
+
+	b.Run("unchanged", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			r.List()
+		}
+	})
+	b.Run("changed", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			r.Add(last)
+			r.List()
+		}
+	})
+}
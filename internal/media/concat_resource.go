@@ -0,0 +1,94 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// ConcatResource streams the parts of an entry one after the other as if they were one file, for
+// containers that allow it (see Concatenable). Seeks land in the right part
+type ConcatResource struct {
+	name    string
+	modTime time.Time
+	files   []*os.File
+	offsets []int64 // where each part starts
+	size    int64
+	pos     int64
+	gone    goneReporter
+}
+
+// newConcatResource takes over files, the parts in order, and closes them with the resource
+func newConcatResource(name string, files []*os.File) (*ConcatResource, error) {
+	c := &ConcatResource{name: name, files: files}
+	for _, f := range files {
+		info, err := f.Stat()
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("stat part: %w", err)
+		}
+		c.offsets = append(c.offsets, c.size)
+		c.size += info.Size()
+		if info.ModTime().After(c.modTime) {
+			c.modTime = info.ModTime()
+		}
+	}
+	return c, nil
+}
+
+func (c *ConcatResource) Read(p []byte) (int, error) {
+	if c.pos >= c.size {
+		return 0, io.EOF
+	}
+
+	// the part holding pos, reads don't cross into the next one
+	i := sort.Search(len(c.offsets), func(i int) bool { return c.offsets[i] > c.pos }) - 1
+	end := c.size
+	if i+1 < len(c.offsets) {
+		end = c.offsets[i+1]
+	}
+	p = p[:min(int64(len(p)), end-c.pos)]
+
+	n, err := c.files[i].ReadAt(p, c.pos-c.offsets[i])
+	c.pos += int64(n)
+	if errors.Is(err, io.EOF) {
+		if n < len(p) {
+			// the part is shorter than when it was opened
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, c.gone.check(c.name, err)
+}
+
+func (c *ConcatResource) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += c.pos
+	case io.SeekEnd:
+		offset += c.size
+	default:
+		return 0, fmt.Errorf("seek %q: invalid whence %d", c.name, whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek %q: negative position", c.name)
+	}
+	c.pos = offset
+	return offset, nil
+}
+
+func (c *ConcatResource) Close() error {
+	var errs []error
+	for _, f := range c.files {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (c *ConcatResource) Name() string       { return c.name }
+func (c *ConcatResource) ModTime() time.Time { return c.modTime }
+func (c *ConcatResource) Size() int64        { return c.size }
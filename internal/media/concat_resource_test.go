@@ -0,0 +1,134 @@
+package media
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openParts writes contents as parts in a temp dir and opens them in order
+func openParts(t *testing.T, contents ...string) []*os.File {
+	t.Helper()
+
+	dir := t.TempDir()
+	var files []*os.File
+	for i, c := range contents {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := os.WriteFile(path, []byte(c), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+func TestConcatResourceRead(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		parts   []string
+		bufSize int
+	}{
+		{"ok - one byte at a time", []string{"0123", "456", "789"}, 1},
+		{"ok - reads stop at the end of a part", []string{"0123", "456", "789"}, 64},
+		{"ok - an empty part is skipped", []string{"0123", "", "456789"}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := newConcatResource("film.mpg", openParts(t, tt.parts...))
+			if err != nil {
+				t.Fatalf("newConcatResource() error = %v", err)
+			}
+			defer c.Close()
+
+			var got []byte
+			buf := make([]byte, tt.bufSize)
+			for {
+				n, err := c.Read(buf)
+				got = append(got, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Read() error = %v", err)
+				}
+			}
+			if string(got) != "0123456789" || c.Size() != 10 {
+				t.Errorf("read %q of size %d, want 0123456789 of size 10", got, c.Size())
+			}
+		})
+	}
+}
+
+func TestConcatResourceSeek(t *testing.T) {
+	t.Parallel()
+
+	c, err := newConcatResource("film.mpg", openParts(t, "0123", "456", "789"))
+	if err != nil {
+		t.Fatalf("newConcatResource() error = %v", err)
+	}
+	defer c.Close()
+
+	tests := []struct {
+		offset int64
+		whence int
+		want   string // the next 3 bytes
+	}{
+		{3, io.SeekStart, "3"},        // reads stop at the end of the first part
+		{1, io.SeekCurrent, "56"},     // from 4 to 5, in the second part
+		{-4, io.SeekEnd, "6"},         // the last byte of the second part
+		{0, io.SeekCurrent, "789"},    // and on into the third
+		{0, io.SeekEnd, ""},           // nothing after the end
+		{4, io.SeekStart, "456"},      // right on a boundary
+		{100, io.SeekStart, ""},       // past the end reads nothing
+		{-100, io.SeekEnd, "invalid"}, // negative positions are refused
+	}
+
+	for _, tt := range tests {
+		pos, err := c.Seek(tt.offset, tt.whence)
+		if tt.want == "invalid" {
+			if err == nil {
+				t.Errorf("Seek(%d, %d) = %d, want an error", tt.offset, tt.whence, pos)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Seek(%d, %d) error = %v", tt.offset, tt.whence, err)
+		}
+		buf := make([]byte, 3)
+		n, err := c.Read(buf)
+		if string(buf[:n]) != tt.want || (n == 0 && err != io.EOF) {
+			t.Errorf("after Seek(%d, %d) to %d read %q (%v), want %q", tt.offset, tt.whence, pos, buf[:n], err, tt.want)
+		}
+	}
+}
+
+func TestConcatResourcePartShrunk(t *testing.T) {
+	t.Parallel()
+
+	files := openParts(t, "0123", "456")
+	c, err := newConcatResource("film.mpg", files)
+	if err != nil {
+		t.Fatalf("newConcatResource() error = %v", err)
+	}
+	defer c.Close()
+
+	// cut short after it was opened, what is missing must not read as the start of the next part
+	if err := os.Truncate(files[0].Name(), 2); err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(c)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadAll() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
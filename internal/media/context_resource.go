@@ -0,0 +1,50 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+)
+
+// WithContext makes res fail its reads and seeks once ctx is done, so a stream whose client went away
+// stops at the next read instead of running on against a dead connection while it holds an io slot and
+// the file. A resource handing its file to sendfile keeps doing so until ctx is done
+func WithContext(ctx context.Context, res Resource) Resource {
+	c := contextResource{Resource: res, ctx: ctx}
+	if _, ok := res.(syscall.Conn); ok {
+		return contextConnResource{c}
+	}
+	return c
+}
+
+// contextResource is a Resource bound to the context of its request
+type contextResource struct {
+	Resource
+	ctx context.Context
+}
+
+func (c contextResource) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, fmt.Errorf("read %q: %w", c.Name(), err)
+	}
+	return c.Resource.Read(p)
+}
+
+func (c contextResource) Seek(offset int64, whence int) (int64, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, fmt.Errorf("seek %q: %w", c.Name(), err)
+	}
+	return c.Resource.Seek(offset, whence)
+}
+
+// contextConnResource is a contextResource over one that hands its file to sendfile
+type contextConnResource struct {
+	contextResource
+}
+
+func (c contextConnResource) SyscallConn() (syscall.RawConn, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Resource.(syscall.Conn).SyscallConn()
+}
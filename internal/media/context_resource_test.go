@@ -0,0 +1,76 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWithContext(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entry := &Entry{Name: "film.mp4", Path: "film.mp4", MountID: "vol_0"}
+
+	tests := []struct {
+		name     string
+		mode     ResourceMode
+		wantConn bool
+	}{
+		{"ok - direct keeps sendfile", ModeFileDirect, true},
+		{"ok - buffered", ModeFileBuffered, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := NewManager(4, tt.mode)
+			m.AddMount("vol_0", dir, NewIOLimiter(1))
+			res, err := m.OpenResource(entry, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Close()
+
+			ctx, cancel := context.WithCancel(t.Context())
+			res = WithContext(ctx, res)
+
+			conn, isConn := res.(syscall.Conn)
+			if isConn != tt.wantConn {
+				t.Fatalf("WithContext() is a syscall.Conn = %v, want %v", isConn, tt.wantConn)
+			}
+			if isConn {
+				if _, err := conn.SyscallConn(); err != nil {
+					t.Errorf("SyscallConn() error = %v before the cancel", err)
+				}
+			}
+
+			p := make([]byte, 4)
+			if n, err := res.Read(p); err != nil || string(p[:n]) != "0123" {
+				t.Fatalf("Read() = %q, %v, want 0123", p[:n], err)
+			}
+
+			// the client went away mid stream
+			cancel()
+			if _, err := res.Read(p); !errors.Is(err, context.Canceled) {
+				t.Errorf("Read() after the cancel error = %v, want context.Canceled", err)
+			}
+			if _, err := res.Seek(0, io.SeekStart); !errors.Is(err, context.Canceled) {
+				t.Errorf("Seek() after the cancel error = %v, want context.Canceled", err)
+			}
+			if isConn {
+				if _, err := conn.SyscallConn(); !errors.Is(err, context.Canceled) {
+					t.Errorf("SyscallConn() after the cancel error = %v, want context.Canceled", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Kind is what an entry is on disk
+type Kind string
+
+const (
+	KindFile   Kind = ""       // a video file, or a film split over several
+	KindDVD    Kind = "dvd"    // a VIDEO_TS folder, played from the VOBs of its main title
+	KindBluRay Kind = "bluray" // a BDMV folder, played from its largest stream
+)
+
+// discKind tells the folder of a disc rip by its name, KindFile for any other folder
+func discKind(name string) Kind {
+	switch strings.ToUpper(name) {
+	case "VIDEO_TS":
+		return KindDVD
+	case "BDMV":
+		return KindBluRay
+	default:
+		return KindFile
+	}
+}
+
+// vobPattern matches the VOBs of a title set, VTS_01_1.VOB to VTS_01_9.VOB. VTS_01_0.VOB is its menu
+var vobPattern = regexp.MustCompile(`(?i)^VTS_([0-9]{2})_([1-9])\.VOB$`)
+
+// readDisc reads the disc rip in dir, the VIDEO_TS or BDMV folder of a film named title, as one video
+// playing its main title. It fails on structures it doesn't know how to play, the scan leaves them out
+// rather than serve a menu or a fragment
+func readDisc(fsys fs.FS, dir string, kind Kind, title, category string) (fileMetadata, error) {
+	var v fileMetadata
+	var err error
+	switch kind {
+	case KindDVD:
+		v, err = readDVD(fsys, dir)
+		v.name = title + ".vob"
+	case KindBluRay:
+		v, err = readBluRay(fsys, dir)
+		v.name = title + ".m2ts"
+	}
+	if err != nil {
+		return fileMetadata{}, fmt.Errorf("read disc %s: %w", dir, err)
+	}
+	v.category = category
+	v.kind = kind
+	v.disc = path.Dir(dir)
+	return v, nil
+}
+
+// readDVD picks the title set with the most data, the film rather than the extras, and plays its VOBs
+// one after the other
+func readDVD(fsys fs.FS, dir string) (fileMetadata, error) {
+	children, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fileMetadata{}, err
+	}
+
+	sets := make(map[int][]fileMetadata) // title set -> VOBs by number, from 1
+	sizes := make(map[int]int64)
+	for _, c := range children {
+		m := vobPattern.FindStringSubmatch(c.Name())
+		if m == nil || !c.Type().IsRegular() {
+			continue
+		}
+		info, err := c.Info()
+		if err != nil {
+			continue
+		}
+		set, _ := strconv.Atoi(m[1])
+		n, _ := strconv.Atoi(m[2])
+		vobs := sets[set]
+		for len(vobs) < n {
+			vobs = append(vobs, fileMetadata{})
+		}
+		vobs[n-1] = fileMetadata{path: path.Join(dir, c.Name()), size: info.Size(), modTime: info.ModTime()}
+		sets[set] = vobs
+		sizes[set] += info.Size()
+	}
+
+	main := -1
+	for set, size := range sizes {
+		if main == -1 || size > sizes[main] || (size == sizes[main] && set < main) {
+			main = set
+		}
+	}
+	if main == -1 {
+		return fileMetadata{}, errors.New("no title VOBs")
+	}
+
+	var v fileMetadata
+	for i, vob := range sets[main] {
+		if vob.path == "" {
+			return fileMetadata{}, fmt.Errorf("title set %02d has no VTS_%02d_%d.VOB", main, main, i+1)
+		}
+		v.parts = append(v.parts, Part{Path: vob.path, Size: vob.size})
+		v.size += vob.size
+		if vob.modTime.After(v.modTime) {
+			v.modTime = vob.modTime
+		}
+	}
+	v.path = v.parts[0].Path
+	if len(v.parts) == 1 {
+		v.parts = nil
+	}
+	return v, nil
+}
+
+// readBluRay plays the largest stream of BDMV/STREAM, on most discs the film. Films spread over several
+// clips by a playlist only play the largest one
+func readBluRay(fsys fs.FS, dir string) (fileMetadata, error) {
+	children, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fileMetadata{}, err
+	}
+	i := slices.IndexFunc(children, func(c fs.DirEntry) bool { return c.IsDir() && strings.EqualFold(c.Name(), "STREAM") })
+	if i < 0 {
+		return fileMetadata{}, errors.New("no STREAM folder")
+	}
+
+	streamDir := path.Join(dir, children[i].Name())
+	streams, err := fs.ReadDir(fsys, streamDir)
+	if err != nil {
+		return fileMetadata{}, err
+	}
+	var v fileMetadata
+	for _, c := range streams {
+		if !c.Type().IsRegular() || !strings.EqualFold(path.Ext(c.Name()), ".m2ts") {
+			continue
+		}
+		info, err := c.Info()
+		if err != nil {
+			continue
+		}
+		if info.Size() > v.size {
+			v = fileMetadata{path: path.Join(streamDir, c.Name()), size: info.Size(), modTime: info.ModTime()}
+		}
+	}
+	if v.path == "" {
+		return fileMetadata{}, errors.New("no m2ts streams")
+	}
+	return v, nil
+}
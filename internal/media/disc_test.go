@@ -0,0 +1,159 @@
+package media
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadDisc(t *testing.T) {
+	t.Parallel()
+
+	file := func(size int) *fstest.MapFile { return &fstest.MapFile{Data: make([]byte, size)} }
+
+	tests := []struct {
+		name      string
+		files     fstest.MapFS
+		dir       string
+		kind      Kind
+		wantPath  string
+		wantParts []string
+		wantSize  int64
+		wantErr   string
+	}{
+		{"ok - dvd main title", fstest.MapFS{
+			"Heat/VIDEO_TS/VIDEO_TS.VOB": file(50),
+			"Heat/VIDEO_TS/VTS_01_0.VOB": file(50),
+			"Heat/VIDEO_TS/VTS_01_1.VOB": file(10),
+			"Heat/VIDEO_TS/VTS_02_0.VOB": file(5),
+			"Heat/VIDEO_TS/VTS_02_1.VOB": file(30),
+			"Heat/VIDEO_TS/VTS_02_2.VOB": file(20),
+			"Heat/VIDEO_TS/VTS_02_1.IFO": file(1),
+		}, "Heat/VIDEO_TS", KindDVD, "Heat/VIDEO_TS/VTS_02_1.VOB", []string{"Heat/VIDEO_TS/VTS_02_1.VOB", "Heat/VIDEO_TS/VTS_02_2.VOB"}, 50, ""},
+		{"ok - dvd in lowercase with one vob", fstest.MapFS{
+			"Heat/video_ts/vts_01_1.vob": file(10),
+		}, "Heat/video_ts", KindDVD, "Heat/video_ts/vts_01_1.vob", nil, 10, ""},
+		{"ok - blu-ray largest stream", fstest.MapFS{
+			"Heat/BDMV/index.bdmv":         file(1),
+			"Heat/BDMV/STREAM/00000.m2ts":  file(10),
+			"Heat/BDMV/STREAM/00800.m2ts":  file(90),
+			"Heat/BDMV/STREAM/00801.m2ts":  file(20),
+			"Heat/BDMV/CLIPINF/00800.clpi": file(1),
+		}, "Heat/BDMV", KindBluRay, "Heat/BDMV/STREAM/00800.m2ts", nil, 90, ""},
+		{"fail - dvd with a vob missing", fstest.MapFS{
+			"Heat/VIDEO_TS/VTS_01_1.VOB": file(10),
+			"Heat/VIDEO_TS/VTS_01_3.VOB": file(10),
+		}, "Heat/VIDEO_TS", KindDVD, "", nil, 0, "title set 01 has no VTS_01_2.VOB"},
+		{"fail - dvd with menus only", fstest.MapFS{
+			"Heat/VIDEO_TS/VIDEO_TS.VOB": file(10),
+			"Heat/VIDEO_TS/VTS_01_0.VOB": file(10),
+		}, "Heat/VIDEO_TS", KindDVD, "", nil, 0, "no title VOBs"},
+		{"fail - blu-ray without streams", fstest.MapFS{
+			"Heat/BDMV/index.bdmv": file(1),
+		}, "Heat/BDMV", KindBluRay, "", nil, 0, "no STREAM folder"},
+		{"fail - blu-ray with an empty stream folder", fstest.MapFS{
+			"Heat/BDMV/STREAM/readme.txt": file(1),
+		}, "Heat/BDMV", KindBluRay, "", nil, 0, "no m2ts streams"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v, err := readDisc(tt.files, tt.dir, tt.kind, "Heat", "Films")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readDisc() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readDisc() error = %v", err)
+			}
+
+			var parts []string
+			for _, p := range v.parts {
+				parts = append(parts, p.Path)
+			}
+			if v.path != tt.wantPath || !slices.Equal(parts, tt.wantParts) || v.size != tt.wantSize {
+				t.Errorf("readDisc() = %q %q sized %d, want %q %q sized %d", v.path, parts, v.size, tt.wantPath, tt.wantParts, tt.wantSize)
+			}
+			if v.kind != tt.kind || v.category != "Films" || v.disc != "Heat" {
+				t.Errorf("readDisc() kind %q in %q from %q, want %q in Films from Heat", v.kind, v.category, v.disc, tt.kind)
+			}
+		})
+	}
+}
+
+func TestRegistryScanDiscs(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"Films/Heat/VIDEO_TS/VIDEO_TS.VOB":     "menu",
+		"Films/Heat/VIDEO_TS/VTS_01_1.VOB":     "0123",
+		"Films/Heat/VIDEO_TS/VTS_01_2.VOB":     "4567",
+		"Films/Heat/folder.jpg":                "poster",
+		"Films/Ronin/BDMV/STREAM/00001.m2ts":   "the film",
+		"Films/Ronin/BDMV/STREAM/00002.m2ts":   "trailer",
+		"Films/Broken/VIDEO_TS/VTS_01_2.VOB":   "x",
+		"Films/Broken/VIDEO_TS/VIDEO_TS.IFO":   "x",
+		"Films/Broken/VIDEO_TS/stray.mkv":      "x",
+		"Films/Speed.mkv":                      "x",
+		"Films/Speed/BDMV/BACKUP/00001.m2ts":   "x",
+		"Films/Speed/BDMV/BACKUP/index.bdmv":   "x",
+		"Films/Heat/VIDEO_TS/not a folder.mp4": "x",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRegistry()
+	summary, err := r.ScanIncremental("vol_0", root, true)
+	if err != nil {
+		t.Fatalf("ScanIncremental() error = %v", err)
+	}
+
+	// the broken rips are left out, nothing inside a rip shows up on its own
+	var got []string
+	for _, e := range r.List() {
+		got = append(got, e.Category+"/"+e.Name+" "+string(e.Kind)+" "+e.Path)
+	}
+	want := []string{
+		"Films/Heat.vob dvd Films/Heat/VIDEO_TS/VTS_01_1.VOB",
+		"Films/Ronin.m2ts bluray Films/Ronin/BDMV/STREAM/00001.m2ts",
+		"Films/Speed.mkv  Films/Speed.mkv",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if err := summary.DiscErr; err == nil || !strings.Contains(err.Error(), "Films/Broken/VIDEO_TS") || !strings.Contains(err.Error(), "Films/Speed/BDMV") {
+		t.Errorf("DiscErr = %v, want the two broken rips", err)
+	}
+
+	heat := r.List()[0]
+	if heat.Thumb != "Films/Heat/folder.jpg" {
+		t.Errorf("Thumb = %q, want Films/Heat/folder.jpg", heat.Thumb)
+	}
+
+	m := NewManager(1024, ModeFileBuffered)
+	m.Registry = r
+	m.AddMount("vol_0", root, NewIOLimiter(1))
+	res, err := m.OpenResource(&heat, 0)
+	if err != nil {
+		t.Fatalf("OpenResource() error = %v", err)
+	}
+	defer res.Close()
+	if data, err := io.ReadAll(res); err != nil || string(data) != "01234567" {
+		t.Errorf("read %q (%v), want the title VOBs one after the other", data, err)
+	}
+}
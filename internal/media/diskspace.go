@@ -0,0 +1,12 @@
+package media
+
+import "errors"
+
+// errDiskSpaceUnsupported is what diskSpace returns where the platform has no way to ask
+var errDiskSpaceUnsupported = errors.New("disk space not available on this platform")
+
+// DiskSpace is the size of the filesystem a volume lives on
+type DiskSpace struct {
+	Total int64 // bytes
+	Free  int64 // bytes the server's user can still write, less than what is free to root on most unixes
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package media
+
+// diskSpace is unknown where there's no statfs to ask
+func diskSpace(path string) (DiskSpace, error) {
+	return DiskSpace{}, errDiskSpaceUnsupported
+}
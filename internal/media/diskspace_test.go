@@ -0,0 +1,84 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiskSpace(t *testing.T) {
+	t.Parallel()
+
+	got, err := diskSpace(t.TempDir())
+	if errors.Is(err, errDiskSpaceUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("diskSpace() error = %v", err)
+	}
+	if got.Total <= 0 || got.Free < 0 || got.Free > got.Total {
+		t.Errorf("diskSpace() = %+v, want 0 <= free <= total and total > 0", got)
+	}
+
+	if _, err := diskSpace(filepath.Join(t.TempDir(), "unplugged")); err == nil {
+		t.Error("diskSpace() of a missing path error = nil")
+	}
+}
+
+func TestManagerScanDiskSpace(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		disk     DiskSpace
+		diskErr  error
+		wantWarn bool
+	}{
+		{"ok - plenty free", DiskSpace{Total: 1000, Free: 500}, nil, false},
+		{"ok - low on space", DiskSpace{Total: 1000, Free: 50}, nil, true},
+		{"ok - unknown", DiskSpace{}, errDiskSpaceUnsupported, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			for name, content := range map[string]string{"Heat.mkv": "0123456789", "Ronin.mp4": "01234"} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m := NewManager(1024, ModeFileDirect)
+			m.AddMount("vol_0", dir, NewIOLimiter(1))
+			m.MinFree = 100
+			m.space = func(path string) (DiskSpace, error) {
+				if path != dir {
+					t.Errorf("space asked about %q, want the volume's root %q", path, dir)
+				}
+				return tt.disk, tt.diskErr
+			}
+			var told VolumeScan
+			m.VolumeScanned = func(id string, scan VolumeScan) { told = scan }
+
+			var logs bytes.Buffer
+			m.scanVolume(m.Volumes["vol_0"], true, slog.New(slog.NewTextHandler(&logs, nil)))
+
+			scan := m.VolumeScans()["vol_0"]
+			if scan.Library != 15 || scan.Disk != tt.disk || !errors.Is(scan.DiskErr, tt.diskErr) {
+				t.Errorf("VolumeScans() = library %d disk %+v (%v), want 15 %+v (%v)", scan.Library, scan.Disk, scan.DiskErr, tt.disk, tt.diskErr)
+			}
+			if told.Library != scan.Library || told.Disk != scan.Disk {
+				t.Errorf("VolumeScanned told %+v, want %+v", told, scan)
+			}
+			if got := strings.Contains(logs.String(), "volume low on free space"); got != tt.wantWarn {
+				t.Errorf("warned = %v, want %v:\n%s", got, tt.wantWarn, logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+
+package media
+
+import "golang.org/x/sys/unix"
+
+// diskSpace asks statfs about the filesystem path is on
+func diskSpace(path string) (DiskSpace, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return DiskSpace{}, err
+	}
+	return DiskSpace{
+		Total: int64(st.Blocks) * int64(st.Bsize),
+		Free:  int64(st.Bavail) * int64(st.Bsize),
+	}, nil
+}
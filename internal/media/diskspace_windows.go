@@ -0,0 +1,18 @@
+//go:build windows
+
+package media
+
+import "golang.org/x/sys/windows"
+
+// diskSpace asks GetDiskFreeSpaceEx about the drive or share path is on
+func diskSpace(path string) (DiskSpace, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return DiskSpace{}, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, &totalFree); err != nil {
+		return DiskSpace{}, err
+	}
+	return DiskSpace{Total: int64(total), Free: int64(free)}, nil
+}
@@ -5,4 +5,6 @@ import "errors"
 var (
 	ErrUnsupportedMode = errors.New("unsupported resource mode")
 	ErrPathOutsideRoot = errors.New("path outside root directory")
+	ErrFileGone        = errors.New("file gone")      // deleted or unplugged while it was read
+	ErrVolumeOffline   = errors.New("volume offline") // its root can't be reached, e.g. the disk was unplugged
 )
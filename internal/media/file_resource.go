@@ -1,25 +1,49 @@
 package media
 
 import (
+	"errors"
 	"os"
+	"syscall"
 	"time"
 )
 
+// errNoZeroCopy turns sendfile down, the copy falls back to reading and writing
+var errNoZeroCopy = errors.New("zero copy disabled")
+
 // FileResource provides direct file access without buffering
 type FileResource struct {
-	file *os.File
-	info os.FileInfo
+	file     *os.File
+	info     os.FileInfo
+	zeroCopy bool // hand the file to sendfile
+	gone     goneReporter
 }
 
-func newFileResource(file *os.File, info os.FileInfo) *FileResource {
+func newFileResource(file *os.File, info os.FileInfo, zeroCopy bool) *FileResource {
 	return &FileResource{
-		file: file,
-		info: info,
+		file:     file,
+		info:     info,
+		zeroCopy: zeroCopy,
+	}
+}
+
+// SyscallConn exposes the file descriptor to the sendfile path of net, which io.Copy reaches through the
+// io.LimitedReader of http.ServeContent. The file then goes from the page cache to the socket directly
+func (f *FileResource) SyscallConn() (syscall.RawConn, error) {
+	if !f.zeroCopy {
+		return nil, errNoZeroCopy
 	}
+	return f.file.SyscallConn()
 }
 
 func (f *FileResource) Read(p []byte) (int, error) {
-	return f.file.Read(p)
+	n, err := f.file.Read(p)
+	return n, f.gone.check(f.Name(), err)
+}
+
+// ReadAt reads without moving the offset Read continues from. Unlike Read it doesn't report a gone file, it
+// runs alongside Read and the reporter isn't safe for that
+func (f *FileResource) ReadAt(p []byte, off int64) (int, error) {
+	return f.file.ReadAt(p, off)
 }
 
 func (f *FileResource) Seek(offset int64, whence int) (int64, error) {
@@ -0,0 +1,57 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// isGone reports whether a read failed because the file isn't there anymore: deleted or replaced on a
+// network share (ESTALE), or the disk holding it went away. A file deleted on a local disk stays readable
+// through the open descriptor until it is closed, that doesn't fail at all
+func isGone(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) ||
+		errors.Is(err, syscall.ESTALE) ||
+		errors.Is(err, syscall.ENODEV) ||
+		errors.Is(err, syscall.ENXIO)
+}
+
+// goneReporter turns the read errors of a resource saying its file is gone into ErrFileGone, and reports
+// the first of them. Like the resources holding it, it isn't safe for concurrent use
+type goneReporter struct {
+	report func(err error) // optional
+	done   bool
+}
+
+// check returns err, wrapped in ErrFileGone when it says name is gone
+func (g *goneReporter) check(name string, err error) error {
+	if err == nil || !isGone(err) {
+		return err
+	}
+	if !g.done && g.report != nil {
+		g.done = true
+		g.report(err)
+	}
+	return fmt.Errorf("read %q: %w: %w", name, ErrFileGone, err)
+}
+
+// fileGone returns what the resources of entry report to when its file is gone mid read: the entry leaves
+// the registry at once, so TVs stop listing it before the next scan would have noticed. When the whole
+// volume went with it, e.g. the disk was unplugged, the volume is marked offline instead and the entry kept
+func (m *Manager) fileGone(entry *Entry) func(err error) {
+	e := *entry
+	return func(err error) {
+		if vol, ok := m.Volumes[e.MountID]; ok {
+			if _, rootErr := os.Stat(vol.RootPath); rootErr != nil {
+				m.setOffline(e.MountID, true, fmt.Errorf("%w: %w", ErrVolumeOffline, err))
+				return
+			}
+		}
+		m.Registry.Remove(e.MountID, e.Path)
+		if m.FileGone != nil {
+			m.FileGone(e, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestIsGone(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"ok - deleted on a share", &fs.PathError{Op: "read", Path: "Heat.mkv", Err: syscall.ESTALE}, true},
+		{"ok - not found", &fs.PathError{Op: "read", Path: "Heat.mkv", Err: syscall.ENOENT}, true},
+		{"ok - disk unplugged", fmt.Errorf("read part: %w", syscall.ENODEV), true},
+		{"fail - end of file", io.EOF, false},
+		{"fail - closed", os.ErrClosed, false},
+		{"fail - bad sector", &fs.PathError{Op: "read", Path: "Heat.mkv", Err: syscall.EIO}, false},
+		{"fail - nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := isGone(tt.err); got != tt.want {
+				t.Errorf("isGone(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// goneOf is the reporter of a file resource
+func goneOf(t *testing.T, res Resource) *goneReporter {
+	t.Helper()
+
+	switch r := res.(type) {
+	case *FileResource:
+		return &r.gone
+	case *BufferedFileResource:
+		return &r.gone
+	case *ConcatResource:
+		return &r.gone
+	}
+	t.Fatalf("%T has no gone reporter", res)
+	return nil
+}
+
+func TestManagerFileGone(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []ResourceMode{ModeFileDirect, ModeFileBuffered} {
+		t.Run(fmt.Sprint(mode), func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "Heat.mkv")
+			if err := os.WriteFile(path, []byte("0123456789"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			m := NewManager(4, mode)
+			m.AddMount("vol_0", dir, NewIOLimiter(1))
+			if err := m.Registry.Scan("vol_0", dir); err != nil {
+				t.Fatal(err)
+			}
+			entry := m.Registry.List()[0]
+
+			var told []Entry
+			m.FileGone = func(e Entry, err error) {
+				if !errors.Is(err, syscall.ESTALE) {
+					t.Errorf("FileGone told %v, want the read error", err)
+				}
+				told = append(told, e)
+			}
+
+			res, err := m.OpenResource(&entry, 0)
+			if err != nil {
+				t.Fatalf("OpenResource() error = %v", err)
+			}
+			defer res.Close()
+
+			p := make([]byte, 2)
+			if _, err := res.Read(p); err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+
+			// a local disk keeps a deleted file readable through the open descriptor, that's no error
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := res.Read(p); err != nil {
+				t.Fatalf("Read() after the remove error = %v", err)
+			}
+			if m.Registry.Len() != 1 {
+				t.Fatalf("registry has %d entries after a clean read, want 1", m.Registry.Len())
+			}
+
+			// a network share answers ESTALE instead
+			version, _ := m.Registry.Watch()
+			stale := &fs.PathError{Op: "read", Path: path, Err: syscall.ESTALE}
+			for range 2 {
+				err := goneOf(t, res).check(res.Name(), stale)
+				if !errors.Is(err, ErrFileGone) || !errors.Is(err, syscall.ESTALE) {
+					t.Errorf("check() = %v, want ErrFileGone wrapping ESTALE", err)
+				}
+			}
+
+			if _, err := m.Registry.Get(entry.UUID); err == nil {
+				t.Error("entry still in the registry after its file is gone")
+			}
+			if got, _ := m.Registry.Watch(); got == version {
+				t.Error("registry version unchanged, TVs aren't told")
+			}
+			if len(told) != 1 || told[0].UUID != entry.UUID {
+				t.Errorf("FileGone told %d times, want once for %s", len(told), entry.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package media
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPResource reads a video another server serves, the URL of a .strm file. Reads go through one GET from
+// the current position, a seek drops it and the next read asks for a range from where it landed. Size is
+// -1 when the server doesn't tell
+type HTTPResource struct {
+	client  *http.Client
+	url     string
+	name    string
+	size    int64
+	modTime time.Time
+
+	pos  int64
+	body io.ReadCloser // of a response starting at pos, nil after a seek
+}
+
+// newHTTPResource requests url from the start, the response tells the size and modification time
+func newHTTPResource(client *http.Client, url, name string) (*HTTPResource, error) {
+	h := &HTTPResource{client: client, url: url, name: name, size: -1}
+	resp, err := h.get(0)
+	if err != nil {
+		return nil, err
+	}
+	h.body = resp.Body
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		h.size = contentRangeSize(resp.Header.Get("Content-Range"))
+	case http.StatusOK:
+		h.size = resp.ContentLength
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		h.modTime = t
+	}
+	return h, nil
+}
+
+// get requests the video from byte from on. Servers that don't do ranges are only read from the start
+func (h *HTTPResource) get(from int64) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("request %q: %w", h.name, err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", from))
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get %q: %w", h.name, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent, resp.StatusCode == http.StatusOK && from == 0:
+		return resp, nil
+	case resp.StatusCode == http.StatusOK:
+		resp.Body.Close()
+		return nil, fmt.Errorf("get %q from byte %d: the server doesn't take ranges", h.name, from)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("get %q: %s", h.name, resp.Status)
+	}
+}
+
+// contentRangeSize is the complete length in a Content-Range header, "bytes 0-99/1000", -1 when it's "*"
+// or doesn't parse
+func contentRangeSize(header string) int64 {
+	_, size, ok := strings.Cut(header, "/")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func (h *HTTPResource) Read(p []byte) (int, error) {
+	if h.body == nil {
+		if h.size >= 0 && h.pos >= h.size {
+			return 0, io.EOF
+		}
+		resp, err := h.get(h.pos)
+		if err != nil {
+			return 0, err
+		}
+		h.body = resp.Body
+	}
+
+	n, err := h.body.Read(p)
+	h.pos += int64(n)
+	return n, err
+}
+
+func (h *HTTPResource) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += h.pos
+	case io.SeekEnd:
+		if h.size < 0 {
+			return 0, fmt.Errorf("seek %q from the end: size unknown", h.name)
+		}
+		offset += h.size
+	default:
+		return 0, fmt.Errorf("seek %q: invalid whence %d", h.name, whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek %q: negative position", h.name)
+	}
+
+	if offset != h.pos && h.body != nil {
+		h.body.Close()
+		h.body = nil
+	}
+	h.pos = offset
+	return offset, nil
+}
+
+func (h *HTTPResource) Close() error {
+	if h.body == nil {
+		return nil
+	}
+	err := h.body.Close()
+	h.body = nil
+	return err
+}
+
+func (h *HTTPResource) Name() string       { return h.name }
+func (h *HTTPResource) ModTime() time.Time { return h.modTime }
+func (h *HTTPResource) Size() int64        { return h.size }
@@ -0,0 +1,102 @@
+package media
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPResource(t *testing.T) {
+	t.Parallel()
+
+	const content = "0123456789ABCDEFGHIJ"
+	modTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		wantSize int64
+		wantSeek bool // reading after a seek works
+	}{
+		{"ok - ranges", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "heat.mkv", modTime, strings.NewReader(content))
+		}, 20, true},
+		{"ok - no ranges but a length", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+			w.Header().Set("Content-Length", "20")
+			io.WriteString(w, content)
+		}, 20, false},
+		{"ok - neither", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+			io.WriteString(w, content[:10])
+			w.(http.Flusher).Flush()
+			io.WriteString(w, content[10:])
+		}, -1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			res, err := newHTTPResource(srv.Client(), srv.URL+"/heat.mkv", "Heat.mkv")
+			if err != nil {
+				t.Fatalf("newHTTPResource() error = %v", err)
+			}
+			defer res.Close()
+
+			if res.Size() != tt.wantSize || !res.ModTime().Equal(modTime) || res.Name() != "Heat.mkv" {
+				t.Errorf("resource %q sized %d from %v, want Heat.mkv sized %d from %v", res.Name(), res.Size(), res.ModTime(), tt.wantSize, modTime)
+			}
+
+			buf := make([]byte, 4)
+			if _, err := io.ReadFull(res, buf); err != nil || string(buf) != "0123" {
+				t.Fatalf("first read %q (%v), want 0123", buf, err)
+			}
+
+			// finding the size and going back where it was, what ServeContent does, keeps the response
+			if tt.wantSize >= 0 {
+				if _, err := res.Seek(0, io.SeekEnd); err != nil {
+					t.Fatalf("Seek(0, end) error = %v", err)
+				}
+			}
+			if _, err := res.Seek(4, io.SeekStart); err != nil {
+				t.Fatalf("Seek(4) error = %v", err)
+			}
+
+			if _, err := res.Seek(10, io.SeekStart); err != nil {
+				t.Fatalf("Seek(10) error = %v", err)
+			}
+			rest, err := io.ReadAll(res)
+			if tt.wantSeek {
+				if err != nil || string(rest) != content[10:] {
+					t.Errorf("after Seek(10) read %q (%v), want %q", rest, err, content[10:])
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("after Seek(10) read %q, want an error from a server without ranges", rest)
+			}
+		})
+	}
+}
+
+func TestHTTPResourceErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	if _, err := newHTTPResource(srv.Client(), srv.URL+"/gone.mkv", "Gone.mkv"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("newHTTPResource() error = %v, want the 404", err)
+	}
+
+	if got := contentRangeSize("bytes 0-99/*"); got != -1 {
+		t.Errorf("contentRangeSize(*) = %d, want -1", got)
+	}
+}
@@ -1,25 +1,213 @@
 package media
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Priority orders the reads waiting for an io slot, a freed slot goes to the highest. The zero value is
+// PriorityNormal
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+)
+
+// Priorities lists the classes from the highest down
+var Priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority reads a class by its name: low, normal or high
+func ParsePriority(s string) (Priority, error) {
+	for _, p := range Priorities {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority %q, want low, normal or high", s)
+}
 
 type IOLimiter struct {
-	sem chan struct{} //acts as a semaphore
+	sem chan struct{} // counts the slots taken
+
+	// Fair hands a freed slot to a waiting client that holds none before one that already reads, so a
+	// renderer opening many range connections at once can't keep another out. Among waiters of the same
+	// priority only. Set before first use
+	Fair bool
+
+	// MaxWait is how long a waiter of a lower priority may be passed over, after that it is served like
+	// the highest so a busy TV can't starve a download for good. 0 never promotes. Set before first use
+	MaxWait time.Duration
+
+	mu      sync.Mutex
+	holders map[string]int // slots held per client
+	waiters []*ioWaiter    // in arrival order
+}
+
+// ioWaiter is an Acquire waiting for a slot, ready is closed once it was handed one
+type ioWaiter struct {
+	client   string
+	priority Priority
+	since    time.Time
+	ready    chan struct{}
 }
 
 func NewIOLimiter(maxConcurrent int) *IOLimiter {
-	return &IOLimiter{sem: make(chan struct{}, maxConcurrent)}
+	return &IOLimiter{sem: make(chan struct{}, maxConcurrent), holders: make(map[string]int)}
 }
 
 // Acquire blocks until a slot is free OR context is cancelled
 func (i *IOLimiter) TryAcquire(ctx context.Context) error {
+	return i.Acquire(ctx, "")
+}
+
+// Acquire blocks until client, e.g. the remote IP, gets a slot or ctx is cancelled. The slot is given back
+// with ReleaseClient and the same client
+func (i *IOLimiter) Acquire(ctx context.Context, client string) error {
+	return i.AcquirePriority(ctx, client, PriorityNormal)
+}
+
+// AcquirePriority is Acquire for a read of the given priority, it gets a freed slot before the waiters of
+// lower ones
+func (i *IOLimiter) AcquirePriority(ctx context.Context, client string, priority Priority) error {
+	i.mu.Lock()
+	if len(i.waiters) == 0 && i.grant(client) {
+		i.mu.Unlock()
+		return nil
+	}
+	w := &ioWaiter{client: client, priority: priority, since: time.Now(), ready: make(chan struct{})}
+	i.waiters = append(i.waiters, w)
+	i.mu.Unlock()
+
 	select {
+	case <-w.ready:
+		return nil
 	case <-ctx.Done():
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		select {
+		case <-w.ready:
+			// handed a slot just as ctx ended, pass it on
+			i.release(client)
+		default:
+			i.waiters = removeWaiter(i.waiters, w)
+		}
 		return ctx.Err()
-	case i.sem <- struct{}{}:
-		return nil
 	}
 }
 
 func (i *IOLimiter) Release() {
+	i.ReleaseClient("")
+}
+
+// ReleaseClient gives back a slot taken by Acquire for client
+func (i *IOLimiter) ReleaseClient(client string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.release(client)
+}
+
+// grant takes a slot for client if one is free, with i.mu held
+func (i *IOLimiter) grant(client string) bool {
+	select {
+	case i.sem <- struct{}{}:
+		i.holders[client]++
+		return true
+	default:
+		return false
+	}
+}
+
+// release gives back a slot of client and hands it to the next waiter. With i.mu held
+func (i *IOLimiter) release(client string) {
 	<-i.sem
+	if i.holders[client]--; i.holders[client] <= 0 {
+		delete(i.holders, client)
+	}
+	if len(i.waiters) == 0 {
+		return
+	}
+
+	next := i.next()
+	i.waiters = removeWaiter(i.waiters, next)
+	i.grant(next.client)
+	close(next.ready)
+}
+
+// next picks the waiter a freed slot goes to: the first of the highest priority, counting those waiting
+// longer than MaxWait as high, and when fair the first of them holding no slot. With i.mu held
+func (i *IOLimiter) next() *ioWaiter {
+	now := time.Now()
+	var (
+		best     *ioWaiter
+		bestPrio Priority
+	)
+	for _, w := range i.waiters {
+		prio := w.priority
+		if i.MaxWait > 0 && now.Sub(w.since) >= i.MaxWait {
+			prio = PriorityHigh
+		}
+		switch {
+		case best == nil, prio > bestPrio:
+		case prio == bestPrio && i.Fair && i.holders[best.client] > 0 && i.holders[w.client] == 0:
+		default:
+			continue
+		}
+		best, bestPrio = w, prio
+	}
+	return best
+}
+
+func removeWaiter(waiters []*ioWaiter, w *ioWaiter) []*ioWaiter {
+	for n, other := range waiters {
+		if other == w {
+			return append(waiters[:n:n], waiters[n+1:]...)
+		}
+	}
+	return waiters
+}
+
+// InUse returns how many reads currently hold a slot
+func (i *IOLimiter) InUse() int {
+	return len(i.sem)
+}
+
+// Cap returns the maximum number of concurrent reads
+func (i *IOLimiter) Cap() int {
+	return cap(i.sem)
+}
+
+// Waiting returns how many reads wait for a slot by the priority they asked with, classes without any
+// are left out
+func (i *IOLimiter) Waiting() map[Priority]int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	waiting := map[Priority]int{}
+	for _, w := range i.waiters {
+		waiting[w.priority]++
+	}
+	return waiting
+}
+
+// AcquireNow takes a slot if one is free and never blocks, for work that should rather be refused than wait
+func (i *IOLimiter) AcquireNow() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	// waiting clients come first
+	return len(i.waiters) == 0 && i.grant("")
 }
@@ -0,0 +1,206 @@
+package media
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestIOLimiterFair(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		l := NewIOLimiter(2)
+		l.Fair = true
+
+		// the first tv opens both slots and queues three more range connections before the second asks
+		for range 2 {
+			if err := l.Acquire(t.Context(), "tv-1"); err != nil {
+				t.Fatalf("Acquire(tv-1) error = %v", err)
+			}
+		}
+
+		var mu sync.Mutex
+		var granted []string
+		acquire := func(client string) {
+			go func() {
+				if err := l.Acquire(t.Context(), client); err != nil {
+					return
+				}
+				mu.Lock()
+				granted = append(granted, client)
+				mu.Unlock()
+			}()
+			synctest.Wait()
+		}
+		for range 3 {
+			acquire("tv-1")
+		}
+		acquire("tv-2")
+
+		// tv-1 hands back a slot, tv-2 holds none and comes first
+		l.ReleaseClient("tv-1")
+		synctest.Wait()
+		mu.Lock()
+		if len(granted) != 1 || granted[0] != "tv-2" {
+			t.Fatalf("granted = %q after one release, want [tv-2]", granted)
+		}
+		mu.Unlock()
+
+		// then tv-1 again, in the order it asked
+		l.ReleaseClient("tv-1")
+		synctest.Wait()
+		mu.Lock()
+		if len(granted) != 2 || granted[1] != "tv-1" {
+			t.Fatalf("granted = %q after two releases, want [tv-2 tv-1]", granted)
+		}
+		mu.Unlock()
+
+		if l.InUse() != 2 {
+			t.Errorf("InUse() = %d, want 2", l.InUse())
+		}
+
+		// nothing jumps the queue while tv-1 still waits
+		if l.AcquireNow() {
+			t.Error("AcquireNow() = true with clients waiting")
+		}
+	})
+}
+
+func TestIOLimiterFairNeverOverCap(t *testing.T) {
+	t.Parallel()
+
+	l := NewIOLimiter(2)
+	l.Fair = true
+
+	var mu sync.Mutex
+	held, most := 0, 0
+	var wg sync.WaitGroup
+	for _, client := range []string{"tv-1", "tv-1", "tv-1", "tv-1", "tv-2", "tv-2", "tv-3"} {
+		wg.Go(func() {
+			for range 50 {
+				if err := l.Acquire(t.Context(), client); err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				held++
+				most = max(most, held)
+				mu.Unlock()
+
+				time.Sleep(10 * time.Microsecond)
+
+				mu.Lock()
+				held--
+				mu.Unlock()
+				l.ReleaseClient(client)
+			}
+		})
+	}
+	wg.Wait()
+
+	if most > 2 || l.InUse() != 0 {
+		t.Errorf("at most %d held, %d in use at the end, want at most 2 and 0", most, l.InUse())
+	}
+}
+
+func TestIOLimiterFairCancel(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		l := NewIOLimiter(1)
+		l.Fair = true
+		if err := l.Acquire(t.Context(), "tv-1"); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		defer cancel()
+		if err := l.Acquire(ctx, "tv-2"); err != context.DeadlineExceeded {
+			t.Fatalf("Acquire() error = %v, want the deadline", err)
+		}
+
+		// the slot isn't handed to the waiter that gave up
+		l.ReleaseClient("tv-1")
+		if l.InUse() != 0 || !l.AcquireNow() {
+			t.Errorf("InUse() = %d after the release, want 0 and a free slot", l.InUse())
+		}
+	})
+}
+
+func TestIOLimiterPriority(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxWait time.Duration
+		wait    time.Duration // between the low waiters queueing and the others
+		want    []string
+	}{
+		{"ok - high overtakes queued low", 0, time.Minute, []string{"tv", "phone", "script-1", "script-2"}},
+		{"ok - low waited too long", 30 * time.Second, time.Minute, []string{"script-1", "script-2", "tv", "phone"}},
+		{"ok - low not waiting long enough", 30 * time.Second, time.Second, []string{"tv", "phone", "script-1", "script-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				l := NewIOLimiter(1)
+				l.MaxWait = tt.maxWait
+				if err := l.Acquire(t.Context(), "script-0"); err != nil {
+					t.Fatal(err)
+				}
+
+				var mu sync.Mutex
+				var granted []string
+				acquire := func(client string, priority Priority) {
+					go func() {
+						if err := l.AcquirePriority(t.Context(), client, priority); err != nil {
+							return
+						}
+						mu.Lock()
+						granted = append(granted, client)
+						mu.Unlock()
+					}()
+					synctest.Wait()
+				}
+				// a download script queues first, then the tv and a phone ask
+				acquire("script-1", PriorityLow)
+				acquire("script-2", PriorityLow)
+				time.Sleep(tt.wait)
+				acquire("phone", PriorityNormal)
+				acquire("tv", PriorityHigh)
+
+				want := map[Priority]int{PriorityLow: 2, PriorityNormal: 1, PriorityHigh: 1}
+				if got := l.Waiting(); !maps.Equal(got, want) {
+					t.Errorf("Waiting() = %v, want %v", got, want)
+				}
+
+				holder := "script-0"
+				for range tt.want {
+					l.ReleaseClient(holder)
+					synctest.Wait()
+					mu.Lock()
+					holder = granted[len(granted)-1]
+					mu.Unlock()
+				}
+				if !slices.Equal(granted, tt.want) {
+					t.Errorf("granted = %q, want %q", granted, tt.want)
+				}
+				if got := l.Waiting(); len(got) != 0 {
+					t.Errorf("Waiting() = %v after all were served, want none", got)
+				}
+			})
+		})
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	t.Parallel()
+	for _, p := range Priorities {
+		if got, err := ParsePriority(p.String()); err != nil || got != p {
+			t.Errorf("ParsePriority(%q) = %v, %v, want %v", p, got, err, p)
+		}
+	}
+	if _, err := ParsePriority("urgent"); err == nil {
+		t.Error("ParsePriority(urgent) error = nil, want one")
+	}
+}
@@ -5,9 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"streamer/internal/supervise"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofrs/uuid/v5"
+	"golang.org/x/sync/errgroup"
 )
 
 // ResourceMode determines how resources are opened
@@ -27,11 +34,72 @@ type MountPoint struct {
 	Limiter  *IOLimiter
 }
 
+// Clock is where the scanner gets "now" from, tests can pin it
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
 type Manager struct {
-	BufferSize int
-	Mode       ResourceMode
-	Registry   *Registry
-	Volumes    map[string]*MountPoint // key means volume ID ("vol1", "vol2")
+	BufferSize  int
+	Mode        ResourceMode
+	ZeroCopy    bool // in direct mode, let the kernel send files with sendfile instead of copying them through Go
+	Registry    *Registry
+	Volumes     map[string]*MountPoint // key means volume ID ("vol1", "vol2")
+	Clock       Clock
+	Supervisor  *supervise.Supervisor // restarts the scanner when it panics, nil runs it unsupervised
+	AfterScan   func()                // optional, called after every pass, e.g. to drop what refers to removed entries
+	ScanWorkers int                   // how many volumes are scanned at once
+	HTTPClient  *http.Client          // fetches what .strm files point at, http.DefaultClient when nil
+	MinFree     int64                 // warn after a scan that finds less free space on a volume, 0 never does
+
+	// VolumeScanned is optional, told how every volume's scan went as soon as it's done, e.g. for gauges
+	VolumeScanned func(id string, scan VolumeScan)
+
+	// FileGone is optional, told when the file of an entry turned out to be gone while it was read. The
+	// entry is out of the registry by then
+	FileGone func(e Entry, err error)
+
+	// VolumeOffline is optional, told when a volume goes offline and why, or comes back with a nil err.
+	// See Registry.SetOffline
+	VolumeOffline func(id string, offline bool, err error)
+
+	// IncrementalScan makes the periodic passes read only the directories whose mtime changed, every
+	// FullScanEvery-th pass still reads everything for filesystems where directory mtimes can't be trusted
+	IncrementalScan bool
+	FullScanEvery   int
+
+	// BufferSized is optional, told every buffer size a buffered resource picks and why: "open", "grow" on
+	// sequential reads, "shrink" after a seek, "sequential" when a short range read on. 0 bypasses the buffer
+	BufferSized func(name string, size int, reason string)
+
+	scanStarted atomic.Int64  // unix nanos of the running scan, 0 while idle
+	seenDirs    atomic.Uint64 // Registry.DirsScanned as ScanStalledFor last saw it
+	seenDirsAt  atomic.Int64  // unix nanos of when ScanStalledFor saw it move
+	lastScan    atomic.Int64  // unix nanos of when the last full pass finished, 0 before the first
+	rescanCh    chan struct{} // asks the background scanner for an immediate pass
+	scannedCh   chan struct{} // signals a finished pass
+	firstScan   chan struct{} // closed once the first pass has finished
+	firstOnce   sync.Once     // a restarted scanner must not close firstScan again
+
+	scan    func(mountID, rootPath string, full bool) (ScanSummary, error) // Registry.ScanIncremental when nil, tests slow it down
+	space   func(path string) (DiskSpace, error)                           // diskSpace when nil, tests fill the disk
+	scansMu sync.Mutex
+	scans   map[string]VolumeScan // how the last scan of every volume went, by volume ID
+}
+
+// VolumeScan is how the last scan of a volume went
+type VolumeScan struct {
+	ScanSummary
+	Took time.Duration
+	Err  error // nil when the walk went fine
+
+	Library int64     // bytes of the volume's entries
+	Disk    DiskSpace // of the filesystem the volume is on, as of the scan
+	DiskErr error     // why Disk is unknown
 }
 
 type Video struct {
@@ -40,6 +108,8 @@ type Video struct {
 	Path     string
 	Category string
 	Size     int64
+	ModTime  time.Time
+	AddedAt  time.Time // when a scan first found it
 }
 
 func NewMount(id, rootPath string, maxIO int) *MountPoint {
@@ -52,10 +122,16 @@ func NewMount(id, rootPath string, maxIO int) *MountPoint {
 
 func NewManager(bufferSize int, mode ResourceMode) *Manager {
 	return &Manager{
-		BufferSize: bufferSize,
-		Mode:       mode,
-		Registry:   NewRegistry(),
-		Volumes:    make(map[string]*MountPoint),
+		BufferSize:  bufferSize,
+		Mode:        mode,
+		ZeroCopy:    true,
+		ScanWorkers: 4,
+		Registry:    NewRegistry(),
+		Volumes:     make(map[string]*MountPoint),
+		Clock:       systemClock{},
+		rescanCh:    make(chan struct{}, 1),
+		scannedCh:   make(chan struct{}, 1),
+		firstScan:   make(chan struct{}),
 	}
 }
 
@@ -90,8 +166,11 @@ func (m *Manager) GetEntry(uuid uuid.UUID) (*Entry, error) {
 }
 
 func (m *Manager) ListFiles() ([]Video, error) {
-	entries := m.Registry.List()
+	return Videos(m.Registry.List()), nil
+}
 
+// Videos returns what ListFiles does for the given entries, in their order
+func Videos(entries []Entry) []Video {
 	results := make([]Video, 0, len(entries))
 	for _, e := range entries {
 		results = append(results, Video{
@@ -99,29 +178,47 @@ func (m *Manager) ListFiles() ([]Video, error) {
 			Name: e.Name,
 			// Path:     e.Path, // Note: Frontend shouldn't see this, but helpful for debugging
 			Category: e.Category,
-			Size:     e.Size,
+			Size:     e.StreamSize(),
+			ModTime:  e.ModTime,
+			AddedAt:  e.AddedAt,
 		})
 	}
-	return results, nil
+	return results
 }
 
-func (m *Manager) OpenResource(entry *Entry) (Resource, error) {
+// OpenResource opens an entry for a request expecting to read expect bytes of it, 0 when it reads to the end
+// or doesn't say. Buffered resources size their buffer by it
+func (m *Manager) OpenResource(entry *Entry, expect int64) (Resource, error) {
 	vol, ok := m.Volumes[entry.MountID]
 	if !ok {
 		return nil, fmt.Errorf("volume %q not found", entry.MountID)
 	}
 
+	// split films whose container allows it play as one file, the others play their first part
+	if entry.Concatenated() {
+		return m.openConcat(vol.RootPath, entry)
+	}
+
+	// a .strm file plays what it points at
+	path := entry.Path
+	if entry.Target != "" {
+		if isURL(entry.Target) {
+			return m.openHTTP(entry)
+		}
+		path = entry.Target
+	}
+
 	switch m.Mode {
 	case ModeFileDirect:
-		return m.openDirectFile(vol.RootPath, entry.Path)
+		return m.openDirectFile(vol.RootPath, path, m.fileGone(entry))
 	case ModeFileBuffered:
-		return m.openBufferedFile(vol.RootPath, entry.Path)
+		return m.openBufferedFile(vol.RootPath, path, expect, m.fileGone(entry))
 	default:
 		return nil, fmt.Errorf("open resource: %w (mode: %d)", ErrUnsupportedMode, m.Mode)
 	}
 }
 
-func (m *Manager) openDirectFile(rootPath, path string) (*FileResource, error) {
+func (m *Manager) openDirectFile(rootPath, path string, gone func(err error)) (*FileResource, error) {
 	file, err := m.OpenFile(rootPath, path)
 	if err != nil {
 		return nil, fmt.Errorf("open direct file: %w", err)
@@ -132,10 +229,12 @@ func (m *Manager) openDirectFile(rootPath, path string) (*FileResource, error) {
 		file.Close()
 		return nil, fmt.Errorf("stat file: %w", err)
 	}
-	return newFileResource(file, info), nil
+	res := newFileResource(file, info, m.ZeroCopy)
+	res.gone.report = gone
+	return res, nil
 }
 
-func (m *Manager) openBufferedFile(rootPath, path string) (*BufferedFileResource, error) {
+func (m *Manager) openBufferedFile(rootPath, path string, expect int64, gone func(err error)) (*BufferedFileResource, error) {
 	file, err := m.OpenFile(rootPath, path)
 	if err != nil {
 		return nil, fmt.Errorf("open buffered file: %w", err)
@@ -146,23 +245,232 @@ func (m *Manager) openBufferedFile(rootPath, path string) (*BufferedFileResource
 		file.Close()
 		return nil, fmt.Errorf("stat file: %w", err)
 	}
-	return newBufferedFileResource(file, info, m.BufferSize), nil
+	res := newBufferedFileResource(file, info, m.BufferSize, expect, m.BufferSized)
+	res.gone.report = gone
+	return res, nil
 }
 
-func (m *Manager) StartScanning(ctx context.Context, logger *slog.Logger) {
-	scanAll := func() {
-		// Iterate over all logical volumes
-		for _, vol := range m.Volumes {
-			if err := m.Registry.Scan(vol.ID, vol.RootPath); err != nil {
-				logger.Error("scan failed", "vol_id", vol.ID, "path", vol.RootPath, "err", err)
+func (m *Manager) openHTTP(entry *Entry) (*HTTPResource, error) {
+	client := m.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := newHTTPResource(client, entry.Target, entry.Name)
+	if err != nil {
+		return nil, fmt.Errorf("open url: %w", err)
+	}
+	return res, nil
+}
+
+func (m *Manager) openConcat(rootPath string, entry *Entry) (*ConcatResource, error) {
+	files := make([]*os.File, 0, len(entry.Parts))
+	for _, p := range entry.Parts {
+		file, err := m.OpenFile(rootPath, p.Path)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
 			}
+			return nil, fmt.Errorf("open part: %w", err)
+		}
+		files = append(files, file)
+	}
+	res, err := newConcatResource(entry.Name, files)
+	if err != nil {
+		return nil, err
+	}
+	res.gone.report = m.fileGone(entry)
+	return res, nil
+}
+
+// ScanRunningFor returns how long the current scan has been running, zero when the scanner is idle
+func (m *Manager) ScanRunningFor() time.Duration {
+	started := m.scanStarted.Load()
+	if started == 0 {
+		return 0
+	}
+	return m.Clock.Now().Sub(time.Unix(0, started))
+}
+
+// ScanStalledFor returns how long the current scan has gone without getting through a directory, zero
+// when the scanner is idle. Progress is noticed by the calls themselves, so they should come regularly,
+// e.g. from the watchdog
+func (m *Manager) ScanStalledFor() time.Duration {
+	started := m.scanStarted.Load()
+	if started == 0 {
+		return 0
+	}
+	now := m.Clock.Now()
+	if dirs := m.Registry.DirsScanned(); m.seenDirs.Swap(dirs) != dirs {
+		m.seenDirsAt.Store(now.UnixNano())
+	}
+	return now.Sub(time.Unix(0, max(started, m.seenDirsAt.Load())))
+}
+
+// LastScan returns when the last pass over all volumes finished, zero before the first one did
+func (m *Manager) LastScan() time.Time {
+	finished := m.lastScan.Load()
+	if finished == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, finished)
+}
+
+// RescanNow asks the background scanner for a pass right away, e.g. after a drive was plugged back in.
+// Requests made while a scan is already queued are folded into it
+func (m *Manager) RescanNow() {
+	select {
+	case m.rescanCh <- struct{}{}:
+	default:
+	}
+}
+
+// Scanned receives after a pass over all volumes has finished. Passes finishing while nobody is
+// listening are folded into one
+func (m *Manager) Scanned() <-chan struct{} {
+	return m.scannedCh
+}
+
+// FirstScanDone is closed once the first pass over all volumes has finished, or was cut short because
+// the scanner is stopping
+func (m *Manager) FirstScanDone() <-chan struct{} {
+	return m.firstScan
+}
+
+// VolumeScans returns how the last scan of every volume went, by volume ID
+func (m *Manager) VolumeScans() map[string]VolumeScan {
+	m.scansMu.Lock()
+	defer m.scansMu.Unlock()
+	return maps.Clone(m.scans)
+}
+
+// scanVolume runs one volume's scan and records how it went
+func (m *Manager) scanVolume(vol *MountPoint, full bool, logger *slog.Logger) {
+	scan := m.scan
+	if scan == nil {
+		scan = m.Registry.ScanIncremental
+	}
+
+	start := m.Clock.Now()
+	summary, err := scan(vol.ID, vol.RootPath, full)
+	took := m.Clock.Now().Sub(start)
+	offline := errors.Is(err, ErrVolumeOffline)
+	m.setOffline(vol.ID, offline, err)
+	switch {
+	case offline:
+		logger.Debug("volume offline, scan skipped", "vol_id", vol.ID, "err", err)
+	case err != nil:
+		logger.Error("scan failed", "vol_id", vol.ID, "path", vol.RootPath, "took", took, "err", err)
+	default:
+		logger.Debug("volume scanned", "vol_id", vol.ID, "took", took, "full", summary.Full,
+			"dirs_read", summary.DirsRead, "dirs_skipped", summary.DirsSkipped, "entries", summary.Entries, "growing", summary.Growing)
+		if summary.DiscErr != nil {
+			logger.Debug("disc rips skipped", "vol_id", vol.ID, "err", summary.DiscErr)
+		}
+		if summary.StrmErr != nil {
+			logger.Warn(".strm files skipped", "vol_id", vol.ID, "err", summary.StrmErr)
+		}
+	}
+
+	// a volume that suddenly has fewer files either fell over or filled up, these tell which
+	space := m.space
+	if space == nil {
+		space = diskSpace
+	}
+	disk, diskErr := space(vol.RootPath)
+	switch {
+	case diskErr != nil:
+		logger.Debug("disk space unknown", "vol_id", vol.ID, "err", diskErr)
+	case disk.Free < m.MinFree:
+		logger.Warn("volume low on free space", "vol_id", vol.ID, "path", vol.RootPath, "free_bytes", disk.Free, "total_bytes", disk.Total)
+	}
+
+	s := VolumeScan{ScanSummary: summary, Took: took, Err: err, Library: m.Registry.SizeByMount()[vol.ID], Disk: disk, DiskErr: diskErr}
+	if m.VolumeScanned != nil {
+		m.VolumeScanned(vol.ID, s)
+	}
+
+	m.scansMu.Lock()
+	defer m.scansMu.Unlock()
+	if m.scans == nil {
+		m.scans = make(map[string]VolumeScan)
+	}
+	m.scans[vol.ID] = s
+}
+
+// setOffline marks the volume offline or back and tells VolumeOffline when that changed anything
+func (m *Manager) setOffline(id string, offline bool, err error) {
+	if m.Registry.SetOffline(id, offline) && m.VolumeOffline != nil {
+		m.VolumeOffline(id, offline, err)
+	}
+}
+
+// fullPass reports whether the pass-th periodic pass reads every directory
+func (m *Manager) fullPass(pass int) bool {
+	return !m.IncrementalScan || m.FullScanEvery <= 1 || pass%m.FullScanEvery == 0
+}
+
+// StartScanning scans every volume now and then periodically until ctx is done. The returned channel
+// is closed once the scanner has stopped, scans in progress finish their volume first
+func (m *Manager) StartScanning(ctx context.Context, logger *slog.Logger) <-chan struct{} {
+	scanAll := func(full bool) {
+		m.scanStarted.Store(m.Clock.Now().UnixNano())
+		defer m.scanStarted.Store(0)
+
+		// volumes are scanned side by side, at most ScanWorkers at once, so files on a fast disk show up
+		// without waiting for a slow network share
+		var (
+			g        errgroup.Group
+			mu       sync.Mutex
+			panicked any
+		)
+		g.SetLimit(max(m.ScanWorkers, 1))
+		for _, vol := range m.Volumes {
+			g.Go(func() error {
+				// Go doesn't watch ctx while it waits for a worker, a stop meanwhile skips the volume
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				// errgroup doesn't recover panics and the supervisor only recovers the scanner's own
+				// goroutine, a panic is handed to it below
+				defer func() {
+					if p := recover(); p != nil {
+						mu.Lock()
+						defer mu.Unlock()
+						if panicked == nil {
+							panicked = p
+						}
+					}
+				}()
+				m.scanVolume(vol, full, logger)
+				return nil
+			})
+		}
+		err := g.Wait()
+		if panicked != nil {
+			panic(panicked)
+		}
+		if err != nil {
+			return
+		}
+
+		m.lastScan.Store(m.Clock.Now().UnixNano())
+		if m.AfterScan != nil {
+			m.AfterScan()
+		}
+
+		select {
+		case m.scannedCh <- struct{}{}:
+		default:
 		}
 	}
 
-	go func() {
+	// a restart after a panic starts over with a full pass
+	return m.Supervisor.Go(ctx, "scanner", func(ctx context.Context) {
 		logger.Info("background scanner started")
-		scanAll()
+		scanAll(true)
+		m.firstOnce.Do(func() { close(m.firstScan) })
 
+		passes := 0
 		defaultTickerDuration := 5 * time.Minute
 		ticker := time.NewTicker(defaultTickerDuration)
 		defer ticker.Stop()
@@ -170,10 +478,17 @@ func (m *Manager) StartScanning(ctx context.Context, logger *slog.Logger) {
 		for {
 			select {
 			case <-ctx.Done():
+				logger.Info("background scanner stopped")
 				return
 			case <-ticker.C:
-				scanAll()
+				passes++
+				scanAll(m.fullPass(passes))
+			case <-m.rescanCh:
+				// asked for, e.g. after copying files onto a volume, so nothing is taken on trust
+				logger.Info("rescan requested")
+				scanAll(true)
+				ticker.Reset(defaultTickerDuration)
 			}
 		}
-	}()
+	})
 }
@@ -0,0 +1,529 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"streamer/internal/supervise"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestManagerRescanNow(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	m := NewManager(1024, ModeFileDirect)
+	m.AddMount("vol_0", dir, NewIOLimiter(1))
+
+	m.StartScanning(t.Context(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// the drive comes back with a film on it long before the next periodic scan
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("not really a film"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Registry.CountByMount()["vol_0"] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("file not picked up after RescanNow")
+		}
+		m.RescanNow()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManagerFirstScanDone(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("not really a film"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(1024, ModeFileDirect)
+	m.AddMount("vol_0", dir, NewIOLimiter(1))
+
+	select {
+	case <-m.FirstScanDone():
+		t.Fatal("FirstScanDone closed before scanning started")
+	default:
+	}
+
+	m.StartScanning(t.Context(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	select {
+	case <-m.FirstScanDone():
+	case <-time.After(5 * time.Second):
+		t.Fatal("FirstScanDone not closed after the first pass")
+	}
+
+	// everything the first pass found is there by the time it is reported done
+	if got := m.Registry.Len(); got != 1 {
+		t.Errorf("Registry.Len() = %d after the first scan, want 1", got)
+	}
+}
+
+func TestManagerScanParallel(t *testing.T) {
+	t.Parallel()
+
+	m := NewManager(1024, ModeFileDirect)
+	for _, id := range []string{"fast", "slow"} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, id+".mp4"), []byte("not really a film"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m.AddMount(id, dir, NewIOLimiter(1))
+	}
+
+	// the slow volume is a network share that answers once the fast one has been scanned, and the fast one
+	// only starts after the slow one did: scanned one after the other, in either order, neither finishes
+	slowStarted, release := make(chan struct{}), make(chan struct{})
+	m.scan = func(mountID, rootPath string, full bool) (ScanSummary, error) {
+		wait := slowStarted
+		if mountID == "slow" {
+			close(slowStarted)
+			wait = release
+		}
+		select {
+		case <-wait:
+		case <-t.Context().Done():
+			return ScanSummary{}, context.Canceled
+		}
+		return m.Registry.ScanIncremental(mountID, rootPath, full)
+	}
+
+	m.StartScanning(t.Context(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Registry.CountByMount()["fast"] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("fast volume waited for the slow one")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := m.Registry.CountByMount()["slow"]; got != 0 {
+		t.Fatalf("slow volume has %d entries before it was scanned", got)
+	}
+	close(release)
+
+	select {
+	case <-m.FirstScanDone():
+	case <-time.After(5 * time.Second):
+		t.Fatal("FirstScanDone not closed after the slow volume finished")
+	}
+	if counts := m.Registry.CountByMount(); counts["fast"] != 1 || counts["slow"] != 1 {
+		t.Errorf("CountByMount() = %v after the first scan, want one entry on each", counts)
+	}
+	scans := m.VolumeScans()
+	for _, id := range []string{"fast", "slow"} {
+		if s, ok := scans[id]; !ok || s.Err != nil {
+			t.Errorf("VolumeScans()[%q] = %+v, %t, want a scan without error", id, s, ok)
+		}
+	}
+}
+
+// steppedClock is a Clock that only moves when told to
+type steppedClock struct{ now atomic.Int64 }
+
+func (c *steppedClock) Now() time.Time { return time.Unix(0, c.now.Load()) }
+
+func (c *steppedClock) advance(d time.Duration) { c.now.Add(int64(d)) }
+
+func TestManagerScanStalledFor(t *testing.T) {
+	t.Parallel()
+
+	clock := &steppedClock{}
+	clock.now.Store(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	m := NewManager(1024, ModeFileDirect)
+	m.Clock = clock
+	m.AddMount("vol_0", t.TempDir(), NewIOLimiter(1))
+
+	if got := m.ScanStalledFor(); got != 0 {
+		t.Fatalf("ScanStalledFor() = %v before scanning, want 0", got)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	m.scan = func(mountID, rootPath string, full bool) (ScanSummary, error) {
+		close(started)
+		<-release
+		return m.Registry.ScanIncremental(mountID, rootPath, full)
+	}
+	m.StartScanning(t.Context(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	<-started
+
+	clock.advance(10 * time.Minute)
+	if got := m.ScanStalledFor(); got != 10*time.Minute {
+		t.Errorf("ScanStalledFor() = %v with no directory read, want 10m", got)
+	}
+
+	// a big volume getting through its directories is slow, not stuck
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "Films", "Old"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Registry.ScanIncremental("vol_1", dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.ScanStalledFor(); got != 0 {
+		t.Errorf("ScanStalledFor() = %v right after directories were read, want 0", got)
+	}
+	clock.advance(5 * time.Minute)
+	if got := m.ScanStalledFor(); got != 5*time.Minute {
+		t.Errorf("ScanStalledFor() = %v five minutes after, want 5m", got)
+	}
+
+	close(release)
+	select {
+	case <-m.FirstScanDone():
+	case <-time.After(5 * time.Second):
+		t.Fatal("FirstScanDone not closed after the scan was released")
+	}
+	if got := m.ScanStalledFor(); got != 0 {
+		t.Errorf("ScanStalledFor() = %v once the scan finished, want 0", got)
+	}
+}
+
+func TestManagerFullPass(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		incremental bool
+		every, pass int
+		want        bool
+	}{
+		{"ok - every pass is full without incremental scans", false, 12, 5, true},
+		{"ok - incremental pass", true, 12, 5, false},
+		{"ok - every nth pass is full", true, 12, 24, true},
+		{"ok - every 1 is always full", true, 1, 5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := NewManager(1024, ModeFileDirect)
+			m.IncrementalScan = tt.incremental
+			m.FullScanEvery = tt.every
+			if got := m.fullPass(tt.pass); got != tt.want {
+				t.Errorf("fullPass(%d) = %t, want %t", tt.pass, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagerScanStopWaitingForWorker(t *testing.T) {
+	t.Parallel()
+
+	m := NewManager(1024, ModeFileDirect)
+	m.ScanWorkers = 1
+	m.AddMount("vol_0", t.TempDir(), NewIOLimiter(1))
+	m.AddMount("vol_1", t.TempDir(), NewIOLimiter(1))
+
+	started, release := make(chan string, 2), make(chan struct{})
+	m.scan = func(mountID, rootPath string, full bool) (ScanSummary, error) {
+		started <- mountID
+		<-release
+		return m.Registry.ScanIncremental(mountID, rootPath, full)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := m.StartScanning(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	first := <-started
+
+	// the scan in progress finishes its volume, the one waiting for the worker isn't started
+	cancel()
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scanner didn't stop")
+	}
+	select {
+	case id := <-started:
+		t.Errorf("%s scanned after the stop, only %s should have been", id, first)
+	default:
+	}
+	if !m.LastScan().IsZero() {
+		t.Errorf("LastScan() = %v after a stopped pass, want zero", m.LastScan())
+	}
+}
+
+func TestManagerScanPanicInWorker(t *testing.T) {
+	t.Parallel()
+
+	m := NewManager(1024, ModeFileDirect)
+	m.AddMount("vol_0", t.TempDir(), NewIOLimiter(1))
+	m.AddMount("vol_1", t.TempDir(), NewIOLimiter(1))
+
+	panics := make(chan string, 1)
+	m.Supervisor = supervise.New(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	m.Supervisor.Backoff = time.Millisecond
+	m.Supervisor.OnPanic = func(component string) { panics <- component }
+
+	var once atomic.Bool
+	m.scan = func(mountID, rootPath string, full bool) (ScanSummary, error) {
+		if mountID == "vol_1" && once.CompareAndSwap(false, true) {
+			panic("corrupt directory entry")
+		}
+		return m.Registry.ScanIncremental(mountID, rootPath, full)
+	}
+
+	m.StartScanning(t.Context(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// a worker's panic reaches the supervisor instead of killing the process, and the restart scans again
+	select {
+	case got := <-panics:
+		if got != "scanner" {
+			t.Errorf("panic reported for %q, want scanner", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic of a scan worker not reported")
+	}
+	select {
+	case <-m.FirstScanDone():
+	case <-time.After(5 * time.Second):
+		t.Fatal("FirstScanDone not closed after the restart")
+	}
+}
+
+func TestManagerOpenResourceZeroCopy(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("not really a film"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entry := &Entry{Name: "film.mp4", Path: "film.mp4", MountID: "vol_0"}
+
+	tests := []struct {
+		name     string
+		mode     ResourceMode
+		zeroCopy bool
+		want     bool
+	}{
+		{"ok - direct hands the file to sendfile", ModeFileDirect, true, true},
+		{"ok - direct with zero copy off", ModeFileDirect, false, false},
+		{"ok - buffered copies from its buffer", ModeFileBuffered, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := NewManager(1024, tt.mode)
+			m.ZeroCopy = tt.zeroCopy
+			m.AddMount("vol_0", dir, NewIOLimiter(1))
+
+			res, err := m.OpenResource(entry, 0)
+			if err != nil {
+				t.Fatalf("OpenResource() error = %v", err)
+			}
+			defer res.Close()
+
+			// what net's sendfile looks for
+			got := false
+			if conn, ok := res.(syscall.Conn); ok {
+				_, err := conn.SyscallConn()
+				got = err == nil
+			}
+			if got != tt.want {
+				t.Errorf("sendfile reaches the file = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagerVolumeOffline(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		unplug func(t *testing.T, root string) // takes the volume away
+		replug func(t *testing.T, root string) // brings it back as it was
+	}{
+		{"ok - root gone", func(t *testing.T, root string) {
+			if err := os.Rename(root, root+".away"); err != nil {
+				t.Fatal(err)
+			}
+		}, func(t *testing.T, root string) {
+			if err := os.Rename(root+".away", root); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"ok - root replaced by a file", func(t *testing.T, root string) {
+			if err := os.Rename(root, root+".away"); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(root, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}, func(t *testing.T, root string) {
+			if err := os.Remove(root); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(root+".away", root); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := filepath.Join(t.TempDir(), "usb")
+			if err := os.MkdirAll(filepath.Join(root, "Films"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(root, "Films", "Heat.mkv"), []byte("matroska"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			m := NewManager(1024, ModeFileDirect)
+			m.AddMount("vol_0", root, NewIOLimiter(1))
+			var told []bool
+			m.VolumeOffline = func(id string, offline bool, err error) {
+				if offline != errors.Is(err, ErrVolumeOffline) {
+					t.Errorf("VolumeOffline(%s, %t) told %v", id, offline, err)
+				}
+				told = append(told, offline)
+			}
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+			m.scanVolume(m.Volumes["vol_0"], true, logger)
+			entry := m.Registry.List()[0]
+			version, _ := m.Registry.Watch()
+
+			tt.unplug(t, root)
+			m.scanVolume(m.Volumes["vol_0"], true, logger)
+			if !m.Registry.Offline("vol_0") || !errors.Is(m.VolumeScans()["vol_0"].Err, ErrVolumeOffline) {
+				t.Fatalf("volume online after it was unplugged, scan error %v", m.VolumeScans()["vol_0"].Err)
+			}
+			if got := m.Registry.List(); len(got) != 0 {
+				t.Errorf("List() = %d entries of an offline volume, want none", len(got))
+			}
+			if _, err := m.Registry.Get(entry.UUID); err != nil {
+				t.Errorf("entry dropped while its volume is offline: %v", err)
+			}
+			if got, _ := m.Registry.Watch(); got == version {
+				t.Error("registry version unchanged going offline, TVs aren't told")
+			}
+
+			// another pass while it's still away changes nothing
+			version, _ = m.Registry.Watch()
+			m.scanVolume(m.Volumes["vol_0"], true, logger)
+			if got, _ := m.Registry.Watch(); got != version {
+				t.Error("registry version changed while the volume stayed offline")
+			}
+
+			tt.replug(t, root)
+			m.scanVolume(m.Volumes["vol_0"], false, logger)
+			if m.Registry.Offline("vol_0") {
+				t.Fatal("volume still offline after it came back")
+			}
+			if got := m.Registry.List(); len(got) != 1 || got[0].UUID != entry.UUID {
+				t.Errorf("List() = %v after the volume came back, want %s with its UUID", got, entry.Name)
+			}
+			if got, _ := m.Registry.Watch(); got == version {
+				t.Error("registry version unchanged coming back")
+			}
+			if !slices.Equal(told, []bool{true, false}) {
+				t.Errorf("VolumeOffline told %v, want offline then back", told)
+			}
+		})
+	}
+
+	t.Run("ok - unplugged while streaming", func(t *testing.T) {
+		t.Parallel()
+
+		root := filepath.Join(t.TempDir(), "usb")
+		if err := os.Mkdir(root, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, "Heat.mkv"), []byte("matroska"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m := NewManager(1024, ModeFileDirect)
+		m.AddMount("vol_0", root, NewIOLimiter(1))
+		if err := m.Registry.Scan("vol_0", root); err != nil {
+			t.Fatal(err)
+		}
+		entry := m.Registry.List()[0]
+		m.FileGone = func(e Entry, err error) {
+			t.Errorf("FileGone told %s is gone, want its volume offline", e.Name)
+		}
+
+		if err := os.Rename(root, root+".away"); err != nil {
+			t.Fatal(err)
+		}
+		m.fileGone(&entry)(syscall.ENODEV)
+		if !m.Registry.Offline("vol_0") {
+			t.Error("volume online after a read found it gone")
+		}
+		if _, err := m.Registry.Get(entry.UUID); err != nil {
+			t.Errorf("entry dropped with its volume: %v", err)
+		}
+	})
+}
+
+func TestManagerMountsIsolated(t *testing.T) {
+	t.Parallel()
+
+	// the same path on both, with different films in it
+	roots := map[string]string{"usb": t.TempDir(), "nas": t.TempDir()}
+	for id, root := range roots {
+		if err := os.WriteFile(filepath.Join(root, "film.mp4"), []byte("film on "+id), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(roots["nas"], "extra.mkv"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(1024, ModeFileDirect)
+	for id, root := range roots {
+		m.AddMount(id, root, NewIOLimiter(1))
+		if err := m.Registry.Scan(id, root); err != nil {
+			t.Fatalf("Scan(%s) error = %v", id, err)
+		}
+	}
+
+	// every entry opens the file of the mount the scan stamped on it
+	for _, e := range m.Registry.List() {
+		if _, ok := roots[e.MountID]; !ok {
+			t.Fatalf("entry %s has mount %q, want one of the scanned", e.Path, e.MountID)
+		}
+		if e.Path != "film.mp4" {
+			continue
+		}
+		res, err := m.OpenResource(&e, 0)
+		if err != nil {
+			t.Fatalf("OpenResource(%s on %s) error = %v", e.Path, e.MountID, err)
+		}
+		got, err := io.ReadAll(res)
+		res.Close()
+		if err != nil || string(got) != "film on "+e.MountID {
+			t.Errorf("%s on %s = %q, %v, want its own film", e.Path, e.MountID, got, err)
+		}
+	}
+
+	// a scan of the emptied usb stick leaves what it found on the nas alone
+	if err := os.Remove(filepath.Join(roots["usb"], "film.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Registry.Scan("usb", roots["usb"]); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Registry.CountByMount(), map[string]int{"nas": 2}; !maps.Equal(got, want) {
+		t.Errorf("CountByMount() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,139 @@
+package media
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Part is one file of an entry split over several, e.g. "Heat CD1.mkv" and "Heat CD2.mkv"
+type Part struct {
+	Path string
+	Size int64
+}
+
+// Concatenated reports whether the parts of e stream as one file
+func (e *Entry) Concatenated() bool {
+	return len(e.Parts) > 1 && Concatenable(e.Name)
+}
+
+// StreamSize is how much streaming e sends: every part when they are concatenated, else the first one
+func (e *Entry) StreamSize() int64 {
+	if len(e.Parts) > 1 && !e.Concatenated() {
+		return e.Parts[0].Size
+	}
+	return e.Size
+}
+
+// Part returns part n (from 1) of e as an entry of its own, false when e has no such part
+func (e *Entry) Part(n int) (Entry, bool) {
+	if n < 1 || n > len(e.Parts) {
+		return Entry{}, false
+	}
+	part := *e
+	part.Path = e.Parts[n-1].Path
+	part.Name = path.Base(part.Path)
+	part.Size = e.Parts[n-1].Size
+	part.Parts = nil
+	part.ETag = etag(e.MountID, fileMetadata{path: part.Path, size: part.Size, modTime: part.ModTime})
+	return part, true
+}
+
+// partPattern matches the part marker at the end of a name without extension: "Heat CD1", "Heat.disc2",
+// "Heat [cd1]", "Heat-part1" or "Heat.pt2". "part" and "pt" must not be followed by a space, "Deathly
+// Hallows Part 1" and "Part 2" are two films
+var partPattern = regexp.MustCompile(`(?i)^(.+?)[ ._-]+[(\[]?(?:(?:cd|dis[ck])[ ._-]?|(?:part|pt)[._-]?)([1-9])[)\]]?$`)
+
+// splitPart splits the name of a part into the title and the part number, false when it isn't one
+func splitPart(name string) (title string, n int, ok bool) {
+	ext := path.Ext(name)
+	m := partPattern.FindStringSubmatch(strings.TrimSuffix(name, ext))
+	if m == nil {
+		return "", 0, false
+	}
+	n, _ = strconv.Atoi(m[2])
+	return strings.TrimSpace(m[1]) + ext, n, true
+}
+
+// concatExtensions are the containers whose parts play as one file when they are sent one after the
+// other, MPEG program streams and the VOBs of DVDs. MP4 and Matroska have their index in each file,
+// their parts are served one at a time
+var concatExtensions = []string{".mpg", ".mpeg", ".vob"}
+
+// Concatenable reports whether parts of the container of name can be streamed as one file
+func Concatenable(name string) bool {
+	return slices.Contains(concatExtensions, strings.ToLower(path.Ext(name)))
+}
+
+// groupParts puts the parts of a film in one directory together, the first part carrying the others.
+// It only groups what is clearly one film: two to nine parts with the same title and extension,
+// numbered from 1 without gaps, and no file named like the film itself next to them
+func groupParts(videos []fileMetadata) []fileMetadata {
+	type group struct {
+		title    string
+		parts    map[int]fileMetadata
+		conflict bool // a part number twice, "Heat CD1.mkv" and "Heat cd1.mkv": not something to guess about
+	}
+	groups := make(map[string]*group)
+	plain := make(map[string]bool) // names without marker, lowercased
+	for _, v := range videos {
+		plain[strings.ToLower(v.name)] = true
+		if v.target != "" {
+			// a .strm file points somewhere else, its parts would be the pointer files
+			continue
+		}
+		title, n, ok := splitPart(v.name)
+		if !ok {
+			continue
+		}
+		key := strings.ToLower(title)
+		g := groups[key]
+		if g == nil {
+			g = &group{title: title, parts: make(map[int]fileMetadata)}
+			groups[key] = g
+		}
+		if _, dup := g.parts[n]; dup {
+			g.conflict = true
+		}
+		g.parts[n] = v
+	}
+
+	grouped := make(map[string]bool) // paths now carried by a first part
+	var out []fileMetadata
+	for key, g := range groups {
+		if plain[key] || g.conflict || len(g.parts) < 2 || len(g.parts) != maxPart(g.parts) {
+			continue
+		}
+
+		first := g.parts[1]
+		first.name = g.title
+		first.size = 0
+		for n := 1; n <= len(g.parts); n++ {
+			p := g.parts[n]
+			first.parts = append(first.parts, Part{Path: p.path, Size: p.size})
+			first.size += p.size
+			if p.modTime.After(first.modTime) {
+				first.modTime = p.modTime
+			}
+			grouped[p.path] = true
+		}
+		out = append(out, first)
+	}
+
+	for _, v := range videos {
+		if !grouped[v.path] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func maxPart(parts map[int]fileMetadata) int {
+	n := 0
+	for k := range parts {
+		n = max(n, k)
+	}
+	return n
+}
@@ -0,0 +1,195 @@
+package media
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitPart(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		file      string
+		wantTitle string
+		wantN     int
+		wantOK    bool
+	}{
+		{"ok - cd", "Heat CD1.mkv", "Heat.mkv", 1, true},
+		{"ok - cd lowercase with dot", "heat.cd2.mkv", "heat.mkv", 2, true},
+		{"ok - disc", "Heat - Disc 2.mp4", "Heat.mp4", 2, true},
+		{"ok - bracketed", "Heat [cd1].avi", "Heat.avi", 1, true},
+		{"ok - part", "Heat-part1.mpg", "Heat.mpg", 1, true},
+		{"ok - pt", "Heat.pt2.mpg", "Heat.mpg", 2, true},
+		{"fail - part with a space is a title", "Deathly Hallows Part 1.mkv", "", 0, false},
+		{"fail - no marker", "Heat.mkv", "", 0, false},
+		{"fail - part 0", "Heat CD0.mkv", "", 0, false},
+		{"fail - marker in the middle", "CD1 Heat.mkv", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			title, n, ok := splitPart(tt.file)
+			if title != tt.wantTitle || n != tt.wantN || ok != tt.wantOK {
+				t.Errorf("splitPart(%q) = %q, %d, %v, want %q, %d, %v", tt.file, title, n, ok, tt.wantTitle, tt.wantN, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGroupParts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		files []string
+		want  []string // name with its part paths, sorted
+	}{
+		{"ok - cd1 cd2", []string{"Heat CD1.mkv", "Heat CD2.mkv"}, []string{"Heat.mkv: Heat CD1.mkv, Heat CD2.mkv"}},
+		{"ok - found out of order", []string{"Heat.pt3.mpg", "Heat.pt1.mpg", "Heat.pt2.mpg"}, []string{"Heat.mpg: Heat.pt1.mpg, Heat.pt2.mpg, Heat.pt3.mpg"}},
+		{"ok - markers told apart by case", []string{"Heat [cd1].avi", "Heat [CD2].avi"}, []string{"Heat.avi: Heat [cd1].avi, Heat [CD2].avi"}},
+		{"ok - others left alone", []string{"Heat CD1.mkv", "Heat CD2.mkv", "Ronin.mkv"}, []string{"Heat.mkv: Heat CD1.mkv, Heat CD2.mkv", "Ronin.mkv"}},
+		{"fail - titles with part", []string{"Deathly Hallows Part 1.mkv", "Deathly Hallows Part 2.mkv"}, []string{"Deathly Hallows Part 1.mkv", "Deathly Hallows Part 2.mkv"}},
+		{"fail - a gap", []string{"Heat CD1.mkv", "Heat CD3.mkv"}, []string{"Heat CD1.mkv", "Heat CD3.mkv"}},
+		{"fail - no first part", []string{"Heat CD2.mkv", "Heat CD3.mkv"}, []string{"Heat CD2.mkv", "Heat CD3.mkv"}},
+		{"fail - a lone part", []string{"Heat CD1.mkv"}, []string{"Heat CD1.mkv"}},
+		{"fail - mixed containers", []string{"Heat CD1.mkv", "Heat CD2.avi"}, []string{"Heat CD1.mkv", "Heat CD2.avi"}},
+		{"fail - the film itself is there", []string{"Heat.mkv", "Heat CD1.mkv", "Heat CD2.mkv"}, []string{"Heat CD1.mkv", "Heat CD2.mkv", "Heat.mkv"}},
+		{"fail - a part number twice", []string{"Heat CD1.mkv", "Heat cd1.mkv", "Heat CD2.mkv"}, []string{"Heat CD1.mkv", "Heat CD2.mkv", "Heat cd1.mkv"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var videos []fileMetadata
+			for i, f := range tt.files {
+				videos = append(videos, fileMetadata{path: "Films/" + f, name: f, size: int64(i + 1)})
+			}
+
+			var got []string
+			for _, v := range groupParts(videos) {
+				if v.parts == nil {
+					got = append(got, v.name)
+					continue
+				}
+				var paths []string
+				for _, p := range v.parts {
+					paths = append(paths, strings.TrimPrefix(p.Path, "Films/"))
+				}
+				got = append(got, v.name+": "+strings.Join(paths, ", "))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("groupParts(%q) = %q, want %q", tt.files, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryScanParts(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("Films/Heat CD1.mkv", "first")
+	write("Films/Ronin.mkv", "x")
+
+	r := NewRegistry()
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	lone := r.List()
+	if len(lone) != 2 || lone[0].Name != "Heat CD1.mkv" {
+		t.Fatalf("before the second part List() = %v, want Heat CD1.mkv and Ronin.mkv", lone)
+	}
+	id := lone[0].UUID
+
+	// the second part turning up makes a film of the first, under the same uuid
+	write("Films/Heat CD2.mkv", "second")
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	entries := r.List()
+	if len(entries) != 2 {
+		t.Fatalf("List() has %d entries, want 2", len(entries))
+	}
+	heat := entries[0]
+	if heat.Name != "Heat.mkv" || heat.UUID != id || heat.Path != "Films/Heat CD1.mkv" {
+		t.Errorf("entry = %q %v at %q, want Heat.mkv %v at Films/Heat CD1.mkv", heat.Name, heat.UUID, heat.Path, id)
+	}
+	wantParts := []Part{{Path: "Films/Heat CD1.mkv", Size: 5}, {Path: "Films/Heat CD2.mkv", Size: 6}}
+	if !slices.Equal(heat.Parts, wantParts) || heat.Size != 11 {
+		t.Errorf("parts = %v with size %d, want %v with size 11", heat.Parts, heat.Size, wantParts)
+	}
+	if heat.Concatenated() || heat.StreamSize() != 5 {
+		t.Errorf("Concatenated() = %v, StreamSize() = %d, want false and 5 for matroska", heat.Concatenated(), heat.StreamSize())
+	}
+
+	part, ok := heat.Part(2)
+	if !ok || part.Name != "Heat CD2.mkv" || part.Path != "Films/Heat CD2.mkv" || part.Size != 6 || part.UUID != id {
+		t.Errorf("Part(2) = %+v, %v, want Heat CD2.mkv of the same entry", part, ok)
+	}
+	if _, ok := heat.Part(3); ok {
+		t.Error("Part(3) found, want false")
+	}
+}
+
+func TestManagerOpenResourceParts(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{"Heat CD1.mpg": "0123", "Heat CD2.mpg": "456", "Heat CD3.mpg": "789"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRegistry()
+	if err := r.Scan("vol_0", dir); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	entry := r.List()[0]
+	if !entry.Concatenated() || entry.StreamSize() != 10 {
+		t.Fatalf("entry %q Concatenated() = %v, StreamSize() = %d, want true and 10", entry.Name, entry.Concatenated(), entry.StreamSize())
+	}
+
+	for _, mode := range []ResourceMode{ModeFileDirect, ModeFileBuffered} {
+		m := NewManager(1024, mode)
+		m.AddMount("vol_0", dir, NewIOLimiter(1))
+
+		res, err := m.OpenResource(&entry, 0)
+		if err != nil {
+			t.Fatalf("OpenResource() error = %v", err)
+		}
+		got, err := io.ReadAll(res)
+		res.Close()
+		if err != nil || string(got) != "0123456789" || res.Size() != 10 || res.Name() != "Heat.mpg" {
+			t.Errorf("mode %v read %q (%v) of %q sized %d, want 0123456789 of Heat.mpg sized 10", mode, got, err, res.Name(), res.Size())
+		}
+	}
+
+	// a part gone since the scan fails the open
+	if err := os.Remove(filepath.Join(dir, "Heat CD3.mpg")); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(1024, ModeFileDirect)
+	m.AddMount("vol_0", dir, NewIOLimiter(1))
+	if _, err := m.OpenResource(&entry, 0); err == nil {
+		t.Error("OpenResource() with a missing part succeeded, want an error")
+	}
+}
@@ -1,14 +1,22 @@
 package media
 
 import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 )
@@ -20,25 +28,88 @@ type Entry struct {
 	Name     string
 	Category string
 	Size     int64
+	ModTime  time.Time // of the file, as of the last scan
+	AddedAt  time.Time // when a scan first found the file, kept across restarts by the cache
+	Thumb    string    // path of the poster image next to the file on the same mount, empty when there is none
+	Parts    []Part    // a film split over several files, in order, the first one at Path. Nil for a single file
+	Kind     Kind      // a file, or a disc rip whose main title is at Path
+	Target   string    // what the .strm file at Path points at: an http(s) URL, or a path on the same mount
+	ETag     string    // quoted validator of the content as of the last scan, empty for URLs, see etag
+	Hidden   bool      // left out of List and everything listing the library, still streamed by UUID. See SetHidden
 	// CachedChunks map[int][]byte
 }
 
 type Registry struct {
 	mu     sync.RWMutex
-	byUUID map[uuid.UUID]*Entry // lookup UUID -> *Entry
-	byPath map[string]uuid.UUID // lookup Path -> UUID
+	byUUID map[uuid.UUID]*Entry            // lookup UUID -> *Entry
+	byPath map[fileKey]uuid.UUID           // lookup mount and path -> UUID, the same path on two mounts are two entries
+	known  map[fileKey]knownFile           // every file the scans found, restored from the cache so it survives restarts
+	dirs   map[string]map[string]*dirState // by mount ID and directory, as the last scan read them
+	exts   []string                        // taken on top of videoExtensions, see AddExtensions
+
+	// mount IDs whose root can't be reached, their entries are kept but left out of List. See SetOffline
+	offline map[string]bool
+
+	collation Collation     // of List, see SetCollation
+	settle    time.Duration // how long a file must go unchanged before a scan takes it, see SetSettle
+
+	// every entry in the order of List, built by the first List after a change. Sorting under a collation
+	// other than bytes takes long enough on a big library (see BenchmarkSortEntries) not to redo it for
+	// every Browse and page of the web ui
+	sortMu     sync.Mutex
+	sorted     []*Entry
+	sortedFrom uint64 // the version sorted is of
+
+	version uint64        // counts the changes to the entries
+	changed chan struct{} // closed by the next change, see Watch
+	journal journal       // what the changes were, see Changes
+
+	dirsScanned atomic.Uint64 // directories every scan got through, see DirsScanned
+}
+
+// fileKey is a file on a mount
+type fileKey struct {
+	mountID, path string
+}
+
+// knownFile is what a file keeps while it is gone from the registry, e.g. across a restart
+type knownFile struct {
+	id     uuid.UUID
+	added  time.Time
+	hidden bool // by path, a rescan finding the file again keeps it hidden
 }
 
 func NewRegistry() *Registry {
 	return &Registry{
-		byUUID: make(map[uuid.UUID]*Entry),
-		byPath: make(map[string]uuid.UUID),
+		byUUID:  make(map[uuid.UUID]*Entry),
+		byPath:  make(map[fileKey]uuid.UUID),
+		known:   make(map[fileKey]knownFile),
+		dirs:    make(map[string]map[string]*dirState),
+		offline: make(map[string]bool),
+		changed: make(chan struct{}),
+		journal: newJournal(time.Now()),
 	}
 }
 
+// Watch returns the version of the entries and a channel that is closed once they change, e.g. a scan
+// found new files. Watch again after it is closed for the next change
+func (r *Registry) Watch() (version uint64, changed <-chan struct{}) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version, r.changed
+}
+
+// bump wakes the watchers, r.mu must be held for writing
+func (r *Registry) bump() {
+	r.version++
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// NewEntry makes an entry with a new UUID. A size of 0 is one that isn't known, a URL a .strm file points at
 func NewEntry(mountID, path, name, category string, size int64) (*Entry, error) {
-	if mountID == "" || path == "" || name == "" || size == 0 {
-		return nil, errors.New("an entry needs a path, name and size")
+	if mountID == "" || path == "" || name == "" || size < 0 {
+		return nil, errors.New("an entry needs a path and name")
 	}
 	// create a new uuid otherwise
 	id, err := uuid.NewV7()
@@ -73,29 +144,238 @@ func (r *Registry) Get(uuid uuid.UUID) (*Entry, error) {
 	return entry, nil
 }
 
+// listed reports whether e is in List: not hidden and on a mount that's online, r.mu must be held
+func (r *Registry) listed(e *Entry) bool {
+	return !e.Hidden && !r.offline[e.MountID]
+}
+
+// Len returns the number of entries across all mounts, hidden ones and those on offline mounts left out
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n := 0
+	for _, e := range r.byUUID {
+		if r.listed(e) {
+			n++
+		}
+	}
+	return n
+}
+
+// CountByMount returns the number of entries per mount ID, hidden ones too
+func (r *Registry) CountByMount() map[string]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, e := range r.byUUID {
+		counts[e.MountID]++
+	}
+	return counts
+}
+
+// SizeByMount returns the bytes of the entries on every mount, by mount ID, hidden ones too
+func (r *Registry) SizeByMount() map[string]int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sizes := make(map[string]int64)
+	for _, e := range r.byUUID {
+		sizes[e.MountID] += e.Size
+	}
+	return sizes
+}
+
+// List returns the entries that aren't hidden and whose mount is online, A to Z
 func (r *Registry) List() []Entry {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	entries := make([]Entry, 0, len(r.byUUID))
+	for _, e := range r.byName() {
+		if r.listed(e) {
+			entries = append(entries, *e)
+		}
+	}
+	return entries
+}
+
+// byName returns every entry sorted by name under the collation, from the cache while nothing changed.
+// r.mu must be held, the version can't move under it
+func (r *Registry) byName() []*Entry {
+	r.sortMu.Lock()
+	defer r.sortMu.Unlock()
+
+	if r.sorted != nil && r.sortedFrom == r.version {
+		return r.sorted
+	}
+	sorted := slices.Collect(maps.Values(r.byUUID))
+	sortByName(sorted, func(e *Entry) string { return e.Name }, r.collation)
+	r.sorted, r.sortedFrom = sorted, r.version
+	return sorted
+
+}
+
+// SetCollation sets how List compares names, CollateBytes until it is called. The order of everything
+// listed changes with it, so it wakes the watchers
+func (r *Registry) SetCollation(c Collation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.collation != c {
+		r.collation = c
+		r.bump()
+	}
+}
 
+// Collation returns how List compares names
+func (r *Registry) Collation() Collation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return cmp.Or(r.collation, CollateBytes)
+}
+
+// Search returns the entries, in List order, whose name or category contains every word of query.
+// Case is ignored, an empty query matches everything
+func (r *Registry) Search(query string) []Entry {
+	words := strings.Fields(strings.ToLower(query))
+
+	var found []Entry
+	for _, e := range r.List() {
+		name, category := strings.ToLower(e.Name), strings.ToLower(e.Category)
+
+		matches := true
+		for _, w := range words {
+			if !strings.Contains(name, w) && !strings.Contains(category, w) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// SortOrder is an order entries can be listed in
+type SortOrder string
+
+const (
+	SortName   SortOrder = "name"   // A to Z, the order of List
+	SortNewest SortOrder = "newest" // most recently modified first
+	SortAdded  SortOrder = "added"  // most recently found by a scan first
+	SortSize   SortOrder = "size"   // largest first
+)
+
+// ParseSortOrder checks a sort order from a query, empty means SortName
+func ParseSortOrder(s string) (SortOrder, error) {
+	switch order := SortOrder(s); order {
+	case "":
+		return SortName, nil
+	case SortName, SortNewest, SortAdded, SortSize:
+		return order, nil
+	default:
+		return "", fmt.Errorf("unknown sort order %q, use name, newest, added or size", s)
+	}
+}
+
+// SortEntries sorts entries in place, by name under c for SortName. Ties keep the name order of List
+func SortEntries(entries []Entry, order SortOrder, c Collation) {
+	switch order {
+	case SortNewest:
+		slices.SortStableFunc(entries, func(a, b Entry) int { return b.ModTime.Compare(a.ModTime) })
+	case SortAdded:
+		// files found by the same scan, e.g. all of them on the first start, go by modification time
+		slices.SortStableFunc(entries, func(a, b Entry) int {
+			return cmp.Or(b.AddedAt.Compare(a.AddedAt), b.ModTime.Compare(a.ModTime))
+		})
+	case SortSize:
+		slices.SortStableFunc(entries, func(a, b Entry) int { return cmp.Compare(b.Size, a.Size) })
+	default:
+		// Compare only ties on the very same name, which order those come in doesn't matter
+		sortByName(entries, func(e Entry) string { return e.Name }, c)
+	}
+}
+
+// Category is a category with the number of entries in it
+type Category struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Categories returns the categories that have entries in List, A to Z
+func (r *Registry) Categories() []Category {
+	r.mu.RLock()
+	counts := make(map[string]int)
 	for _, e := range r.byUUID {
-		entries = append(entries, *e)
+		if r.listed(e) {
+			counts[e.Category]++
+		}
+	}
+	r.mu.RUnlock()
+
+	categories := make([]Category, 0, len(counts))
+	for _, name := range slices.Sorted(maps.Keys(counts)) {
+		categories = append(categories, Category{Name: name, Count: counts[name]})
 	}
+	return categories
+}
+
+// Stats summarises the library, hidden entries included
+type Stats struct {
+	Entries    int            `json:"entries"`
+	Hidden     int            `json:"hidden"` // of the entries
+	Bytes      int64          `json:"bytes"`
+	ByVolume   map[string]int `json:"by_volume"`         // entries by mount ID
+	ByCategory map[string]int `json:"by_category"`       // entries by category
+	Largest    *StatsEntry    `json:"largest,omitempty"` // hidden entries left out
+	Newest     *StatsEntry    `json:"newest,omitempty"`  // by modification time, as sort=newest, hidden entries left out
+}
 
-	// previously we ranged through a map so need to sort here for predictable order
-	slices.SortFunc(entries, func(a, b Entry) int {
-		switch {
-		case a.Name < b.Name:
-			return -1
-		case a.Name > b.Name:
-			return 1
-		default:
-			return 0
+// StatsEntry is an entry standing out in Stats
+type StatsEntry struct {
+	UUID    uuid.UUID `json:"id"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	AddedAt time.Time `json:"added_at,omitzero"`
+}
+
+// Stats summarises the entries in one pass under the read lock. A hundred thousand of them take some
+// tens of milliseconds (see BenchmarkRegistryStats), cheap enough for a dashboard polling it
+func (r *Registry) Stats() Stats {
+	stats := Stats{ByVolume: make(map[string]int), ByCategory: make(map[string]int)}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var largest, newest *Entry
+	for _, e := range r.byUUID {
+		stats.Entries++
+		stats.Bytes += e.Size
+		stats.ByVolume[e.MountID]++
+		stats.ByCategory[e.Category]++
+		// counted, but a hidden video mustn't come back as the one standing out
+		if e.Hidden {
+			stats.Hidden++
+			continue
 		}
-	})
-	return entries
 
+		// ties go to the lower UUID, the map order mustn't pick
+		if largest == nil || e.Size > largest.Size || e.Size == largest.Size && bytes.Compare(e.UUID[:], largest.UUID[:]) < 0 {
+			largest = e
+		}
+		if newest == nil || e.ModTime.After(newest.ModTime) || e.ModTime.Equal(newest.ModTime) && bytes.Compare(e.UUID[:], newest.UUID[:]) < 0 {
+			newest = e
+		}
+	}
+	if largest != nil {
+		stats.Largest = &StatsEntry{UUID: largest.UUID, Name: largest.Name, Size: largest.Size, ModTime: largest.ModTime, AddedAt: largest.AddedAt}
+		stats.Newest = &StatsEntry{UUID: newest.UUID, Name: newest.Name, Size: newest.Size, ModTime: newest.ModTime, AddedAt: newest.AddedAt}
+	}
+	return stats
 }
 
 func (r *Registry) Add(e *Entry) {
@@ -107,10 +387,94 @@ func (r *Registry) Add(e *Entry) {
 	defer r.mu.Unlock()
 
 	r.byUUID[e.UUID] = e
-	r.byPath[e.Path] = e.UUID
+	r.byPath[fileKey{e.MountID, e.Path}] = e.UUID
+	r.record(ChangeAdded, e, time.Now())
+	r.bump()
 }
 
-func (r *Registry) Remove(path string) {
+// Hidden returns the hidden entries, A to Z
+func (r *Registry) Hidden() []Entry {
+	r.mu.RLock()
+	var entries []Entry
+	for _, e := range r.byUUID {
+		if e.Hidden {
+			entries = append(entries, *e)
+		}
+	}
+	collation := r.collation
+	r.mu.RUnlock()
+
+	SortEntries(entries, SortName, collation)
+	return entries
+}
+
+// IsHidden reports whether the entry of the file at path on the mount is hidden, false when there is none
+func (r *Registry) IsHidden(mountID, path string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.byPath[fileKey{mountID, path}]
+	return ok && r.byUUID[id].Hidden
+}
+
+// SetHidden hides the entry with the given UUID from List and everything built on it, or shows it again.
+// Streaming it by its UUID keeps working. It sticks to the path, rescans and the cache keep it
+func (r *Registry) SetHidden(id uuid.UUID, hidden bool) (Entry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.byUUID[id]
+	if !ok {
+		return Entry{}, errors.New("no such entry")
+	}
+	if e.Hidden == hidden {
+		return *e, nil
+	}
+
+	// a copy, streams may be reading the old one without the lock
+	updated := *e
+	updated.Hidden = hidden
+	r.byUUID[id] = &updated
+
+	key := fileKey{e.MountID, e.Path}
+	known := r.known[key]
+	known.id, known.hidden = id, hidden
+	if known.added.IsZero() {
+		known.added = e.AddedAt
+	}
+	r.known[key] = known
+	r.record(ChangeModified, &updated, time.Now())
+	r.bump()
+	return updated, nil
+}
+
+// SetOffline marks a mount as offline, e.g. its disk was unplugged, or as back. The entries of an offline
+// mount stay in the registry with their UUIDs but leave List and everything built on it, so they come back
+// at once with the mount. It reports whether that changed anything, a change wakes the watchers
+func (r *Registry) SetOffline(mountID string, offline bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.offline[mountID] == offline {
+		return false
+	}
+	if offline {
+		r.offline[mountID] = true
+	} else {
+		delete(r.offline, mountID)
+	}
+	r.bump()
+	return true
+}
+
+// Offline reports whether the mount was marked offline with SetOffline
+func (r *Registry) Offline(mountID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.offline[mountID]
+}
+
+func (r *Registry) Remove(mountID, path string) {
 	if path == "" {
 		return
 	}
@@ -118,66 +482,336 @@ func (r *Registry) Remove(path string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	uuid, ok := r.byPath[path]
+	key := fileKey{mountID, path}
+	uuid, ok := r.byPath[key]
 	if !ok {
 		// does not exist
 		return
 	}
-	delete(r.byPath, path)
+	r.record(ChangeRemoved, r.byUUID[uuid], time.Now())
+	delete(r.byPath, key)
 	delete(r.byUUID, uuid)
+	r.bump()
 }
 
-type registryUpdate struct {
-	toAdd    []*Entry
-	toRemove []string
+// the containers a scan takes, anything else in a volume is left out
+var videoExtensions = []string{".mp4", ".m4v", ".mkv", ".mpg", ".mpeg"}
+
+// IsVideo reports whether name has the extension of a file the library serves
+func IsVideo(name string) bool {
+	return slices.Contains(videoExtensions, strings.ToLower(filepath.Ext(name)))
 }
 
-func (r *Registry) Scan(mountID, rootPath string) error {
+// AddExtensions has the scans take files with the given extensions too, e.g. ".ts". Set it before the
+// first scan, the directories already read are only read again once they change
+func (r *Registry) AddExtensions(exts ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ext := range exts {
+		if ext = strings.ToLower(ext); !slices.Contains(r.exts, ext) {
+			// a new slice, a scan may still hold the old one
+			r.exts = append(slices.Clip(r.exts), ext)
+		}
+	}
+}
 
-	type fileMetadata struct {
-		path, name, category string
-		size                 int64
+// IsVideo reports whether name has the extension of a file the library serves, counting AddExtensions
+func (r *Registry) IsVideo(name string) bool {
+	r.mu.RLock()
+	exts := r.exts
+	r.mu.RUnlock()
+	return isVideo(exts)(name)
+}
+
+// isVideo is IsVideo taking the extensions exts too
+func isVideo(exts []string) func(name string) bool {
+	return func(name string) bool {
+		ext := strings.ToLower(filepath.Ext(name))
+		return slices.Contains(videoExtensions, ext) || slices.Contains(exts, ext)
 	}
+}
 
-	meta := make(map[string]fileMetadata)
-	allowedExtensions := []string{".mp4", ".m4v"}
+// the images a scan takes for posters
+var thumbExtensions = []string{".jpg", ".jpeg", ".png", ".webp"}
+
+// findThumb picks the poster of the file at path among images, the way Kodi and Jellyfin name them:
+// "Heat.jpg", "Heat-poster.jpg" or "Heat-thumb.jpg" next to "Heat.mkv", or a "poster.jpg" or "folder.jpg"
+// for everything in the folder
+func findThumb(path string, images map[string]string) string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	dir := filepath.ToSlash(filepath.Dir(path))
+
+	var candidates []string
+	for _, name := range []string{base, base + "-poster", base + "-thumb", dir + "/poster", dir + "/folder"} {
+		for _, ext := range thumbExtensions {
+			candidates = append(candidates, strings.TrimPrefix(name, "./")+ext)
+		}
+	}
+	for _, c := range candidates {
+		if image, ok := images[c]; ok {
+			return image
+		}
+	}
+	return ""
+}
+
+// fileMetadata is what a scan keeps of a video before it becomes an entry
+type fileMetadata struct {
+	path, name, category string
+	size                 int64
+	modTime              time.Time
+	thumb                string
+	parts                []Part // with more than one file, see groupParts
+	kind                 Kind
+	disc                 string // the folder holding the VIDEO_TS or BDMV folder of a disc rip
+	target               string // of a .strm file, see Entry.Target
+}
+
+// etag is the validator of a video found on mountID: a hash of where it is, its size and mtime, not of its
+// content, cheap enough for every scan. Quoted for the ETag header. URLs get none, what they serve can
+// change without the scan seeing it
+func etag(mountID string, v fileMetadata) string {
+	if isURL(v.target) {
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d\x00%d", mountID, v.path, v.target, v.size, v.modTime.UnixNano())
+	for _, p := range v.parts {
+		fmt.Fprintf(h, "\x00%s\x00%d", p.Path, p.Size)
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:8]) + `"`
+}
+
+// dirState is a directory as the last scan read it. An incremental scan takes a directory whose mtime is
+// unchanged as it was instead of reading it again, only its subdirectories are looked at
+type dirState struct {
+	modTime time.Time      // zero when it was too recent to trust, the next scan reads it again
+	videos  []fileMetadata // thumb is left empty, posters are matched after the walk
+	images  []string       // poster candidates
+	subdirs []string       // names
+	strmErr error          // why .strm files were left out, joined
+	growing []string       // paths of videos left out as empty or still being written, see SetSettle
+}
+
+// racyWindow is how recent a directory mtime may be before an incremental scan stops trusting it: a file
+// added within the same second as the scan read the directory may leave the mtime unchanged on filesystems
+// that keep it in whole seconds
+const racyWindow = 2 * time.Second
+
+// SetSettle sets how long a video must go unwritten before a scan takes it, so one still being copied
+// into the library isn't listed with half its size. Scans skip it, and those that read its directory
+// again until it settled. 0, the default, takes files as they are
+func (r *Registry) SetSettle(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.settle = d
+}
+
+// DirsScanned counts the directories scans got through, read or skipped, since the registry was made. A
+// scan that keeps it moving is slow rather than stuck
+func (r *Registry) DirsScanned() uint64 {
+	return r.dirsScanned.Load()
+}
+
+// ScanSummary is what a scan of a volume did
+type ScanSummary struct {
+	Full        bool // every directory was read, none taken from the last scan
+	DirsRead    int
+	DirsSkipped int   // unchanged since the last scan
+	Entries     int   // videos on the volume
+	Growing     int   // videos left out for now as empty or still being written, see SetSettle
+	DiscErr     error // why disc rips were left out, joined, nil when none were
+	StrmErr     error // why .strm files of the directories read were left out, joined
+}
 
-	err := fs.WalkDir(os.DirFS(rootPath), ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
-			return nil
+// readDir reads what a scan takes from dir, in the volume at root: videos, poster candidates and
+// subdirectories. isVideo tells the videos by their name, growing the files to leave for a later scan
+func readDir(fsys fs.FS, root, dir string, isVideo func(name string) bool, growing func(fs.FileInfo) bool) (*dirState, error) {
+	children, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	category := categoryOf(dir)
+	state := &dirState{}
+	for _, d := range children {
+		name := path.Join(dir, d.Name())
+		if d.IsDir() {
+			state.subdirs = append(state.subdirs, d.Name())
+			continue
 		}
 
-		ext := strings.ToLower(filepath.Ext(path))
-		if !slices.Contains(allowedExtensions, ext) {
-			return nil
+		ext := strings.ToLower(filepath.Ext(name))
+		if slices.Contains(thumbExtensions, ext) {
+			state.images = append(state.images, name)
+			continue
+		}
+		if ext == strmExtension && d.Type().IsRegular() {
+			v, err := readStrm(fsys, root, name, isVideo)
+			if err != nil {
+				state.strmErr = errors.Join(state.strmErr, err)
+				continue
+			}
+			v.path, v.category = name, category
+			state.videos = append(state.videos, v)
+			continue
+		}
+		if !isVideo(name) {
+			continue
 		}
 
 		info, err := d.Info()
 		if err != nil {
-			return nil
+			continue
 		}
-
-		category := filepath.Dir(path)
-		if category == "." {
-			category = "Uncategorized"
+		// empty files are copies that haven't started
+		if info.Size() == 0 || growing(info) {
+			state.growing = append(state.growing, name)
+			continue
 		}
-
-		// Store RAW data. Don't create Entry yet.
-		meta[path] = fileMetadata{
-			path:     path,
+		state.videos = append(state.videos, fileMetadata{
+			path:     name,
 			name:     d.Name(),
 			category: category,
 			size:     info.Size(),
+			modTime:  info.ModTime(),
+		})
+	}
+	return state, nil
+}
+
+// categoryOf is the category of the videos in dir
+func categoryOf(dir string) string {
+	if dir == "." {
+		return "Uncategorized"
+	}
+	return filepath.FromSlash(dir)
+}
+
+// Scan walks all of rootPath and brings the entries of mountID in line with what it finds. Scans of
+// different mounts can run at once, the walk holds no lock and the update touches only the mount's own
+// entries
+func (r *Registry) Scan(mountID, rootPath string) error {
+	_, err := r.ScanIncremental(mountID, rootPath, true)
+	return err
+}
+
+// ScanIncremental is Scan, reading only the directories whose mtime changed since the last scan of the
+// mount unless full is set. Changes that don't touch a directory's mtime, a file growing or rewritten in
+// place, are only picked up by the next full scan
+func (r *Registry) ScanIncremental(mountID, rootPath string, full bool) (ScanSummary, error) {
+	r.mu.RLock()
+	prev := r.dirs[mountID]
+	isVideo := isVideo(r.exts)
+	settle := r.settle
+	r.mu.RUnlock()
+	if prev == nil {
+		full = true
+	}
+
+	summary := ScanSummary{Full: full}
+	fsys := os.DirFS(rootPath)
+
+	// a root that's gone is a volume that's unplugged rather than emptied, its entries are kept for when it
+	// comes back
+	if info, err := fs.Stat(fsys, "."); err != nil {
+		return summary, fmt.Errorf("%w: %w", ErrVolumeOffline, err)
+	} else if !info.IsDir() {
+		return summary, fmt.Errorf("%w: %s is not a directory", ErrVolumeOffline, rootPath)
+	}
+	now := time.Now()
+	// written within the settle window either side of now, a NAS clock running ahead doesn't hold a file
+	// back for good
+	growing := func(info fs.FileInfo) bool {
+		age := now.Sub(info.ModTime())
+		return age < settle && age > -settle
+	}
+	next := make(map[string]*dirState)
+	meta := make(map[string]fileMetadata)
+	pending := make(map[string]bool)  // growing videos, an entry they already have is kept as it is
+	images := make(map[string]string) // poster candidates by path with the extension lowercased, matched to the files after the walk
+
+	var visit func(dir string)
+	visit = func(dir string) {
+		info, err := fs.Stat(fsys, dir)
+		if err != nil {
+			// gone or unreadable, like WalkDir the scan carries on without it
+			return
 		}
-		return nil
-	})
 
-	if err != nil {
-		return fmt.Errorf("walkdir: %w", err)
+		state := prev[dir]
+		if full || state == nil || state.modTime.IsZero() || !state.modTime.Equal(info.ModTime()) {
+			if state, err = readDir(fsys, rootPath, dir, isVideo, growing); err != nil {
+				return
+			}
+			summary.StrmErr = errors.Join(summary.StrmErr, state.strmErr)
+			// a file being written doesn't change the directory's mtime, the next scan has to look again
+			if now.Sub(info.ModTime()) >= racyWindow && len(state.growing) == 0 {
+				state.modTime = info.ModTime()
+			}
+			summary.DirsRead++
+		} else {
+			summary.DirsSkipped++
+		}
+		r.dirsScanned.Add(1)
+		next[dir] = state
+
+		for _, v := range groupParts(state.videos) {
+			meta[v.path] = v
+		}
+		for _, p := range state.growing {
+			pending[p] = true
+		}
+		for _, image := range state.images {
+			ext := filepath.Ext(image)
+			images[strings.TrimSuffix(image, ext)+strings.ToLower(ext)] = image
+		}
+		for _, sub := range state.subdirs {
+			// a disc rip is one film named after the folder holding it, in that folder's category
+			if kind := discKind(sub); kind != KindFile {
+				title := path.Base(dir)
+				if dir == "." {
+					title = filepath.Base(rootPath)
+				}
+				v, err := readDisc(fsys, path.Join(dir, sub), kind, title, categoryOf(path.Dir(dir)))
+				if err != nil {
+					summary.DiscErr = errors.Join(summary.DiscErr, err)
+					continue
+				}
+				meta[v.path] = v
+				continue
+			}
+			visit(path.Join(dir, sub))
+		}
 	}
+	visit(".")
+
+	for path, m := range meta {
+		m.thumb = findThumb(path, images)
+		if m.thumb == "" && m.parts != nil {
+			// "Heat.jpg" next to "Heat CD1.mkv" and "Heat CD2.mkv"
+			m.thumb = findThumb(filepath.ToSlash(filepath.Join(filepath.Dir(path), m.name)), images)
+		}
+		if m.thumb == "" && m.kind != KindFile {
+			// "Heat/folder.jpg" next to "Heat/VIDEO_TS", or "Heat.jpg" next to "Heat"
+			m.thumb = cmp.Or(findThumb(filepath.ToSlash(filepath.Join(m.disc, m.name)), images), findThumb(m.disc+filepath.Ext(m.name), images))
+		}
+		meta[path] = m
+	}
+	summary.Entries = len(meta)
+	summary.Growing = len(pending)
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	r.dirs[mountID] = next
+
+	// a scan that finds everything as it was wakes no watchers
+	changed := false
+	defer func() {
+		if changed {
+			r.bump()
+		}
+	}()
 
 	// Check for deletions
 	for uuid, entry := range r.byUUID {
@@ -186,9 +820,16 @@ func (r *Registry) Scan(mountID, rootPath string) error {
 		if entry.MountID != mountID {
 			continue
 		}
-		if _, ok := meta[entry.Path]; !ok {
-			delete(r.byPath, entry.Path)
+		if _, ok := meta[entry.Path]; !ok && !pending[entry.Path] {
+			delete(r.byPath, fileKey{mountID, entry.Path})
 			delete(r.byUUID, uuid)
+			r.record(ChangeRemoved, entry, now)
+			changed = true
+		}
+	}
+	for key := range r.known {
+		if _, ok := meta[key.path]; key.mountID == mountID && !ok && !pending[key.path] {
+			delete(r.known, key)
 		}
 	}
 
@@ -196,12 +837,25 @@ func (r *Registry) Scan(mountID, rootPath string) error {
 	for path, fileMeta := range meta {
 
 		// check if the path exists
-		if existingUUID, ok := r.byPath[path]; ok {
+		if existingUUID, ok := r.byPath[fileKey{mountID, path}]; ok {
 
 			existing := r.byUUID[existingUUID]
-
-			if existing.MountID == mountID && existing.Size != fileMeta.size {
-				existing.Size = fileMeta.size // size has changed: update
+			tag := etag(mountID, fileMeta)
+
+			if existing.Size != fileMeta.size || !existing.ModTime.Equal(fileMeta.modTime) || existing.Thumb != fileMeta.thumb ||
+				existing.Name != fileMeta.name || !slices.Equal(existing.Parts, fileMeta.parts) || existing.Target != fileMeta.target || existing.ETag != tag {
+				// a copy, streams may be reading the old one without the lock
+				updated := *existing
+				updated.Size = fileMeta.size // size, mtime, poster or parts may have changed: update
+				updated.ModTime = fileMeta.modTime
+				updated.Thumb = fileMeta.thumb
+				updated.Name = fileMeta.name // a second part showed up, or went
+				updated.Parts = fileMeta.parts
+				updated.Target = fileMeta.target
+				updated.ETag = tag
+				r.byUUID[existingUUID] = &updated
+				r.record(ChangeModified, &updated, now)
+				changed = true
 			}
 
 			continue
@@ -211,9 +865,31 @@ func (r *Registry) Scan(mountID, rootPath string) error {
 		if err != nil {
 			continue
 		}
+		entry.ModTime = fileMeta.modTime
+		entry.AddedAt = now
+		entry.Thumb = fileMeta.thumb
+		entry.Parts = fileMeta.parts
+		entry.Kind = fileMeta.kind
+		entry.Target = fileMeta.target
+		entry.ETag = etag(mountID, fileMeta)
+
+		// a file seen before keeps its UUID, links and bookmarks of it stay valid
+		key := fileKey{mountID, entry.Path}
+		if known, ok := r.known[key]; ok {
+			if _, taken := r.byUUID[known.id]; !taken {
+				entry.UUID = known.id
+			}
+			if !known.added.IsZero() {
+				entry.AddedAt = known.added
+			}
+			entry.Hidden = known.hidden
+		}
+		r.known[key] = knownFile{id: entry.UUID, added: entry.AddedAt, hidden: entry.Hidden}
 
 		r.byUUID[entry.UUID] = entry
-		r.byPath[entry.Path] = entry.UUID
+		r.byPath[key] = entry.UUID
+		r.record(ChangeAdded, entry, now)
+		changed = true
 	}
-	return nil
+	return summary, nil
 }
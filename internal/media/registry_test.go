@@ -0,0 +1,843 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+func TestRegistrySearch(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, name := range []string{"Action/Die Hard.mp4", "Action/Speed.mp4", "Comedy/Airplane.m4v", "Comedy/Hard Boiled Laughs.mp4"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRegistry()
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"ok - empty matches everything", "", []string{"Airplane.m4v", "Die Hard.mp4", "Hard Boiled Laughs.mp4", "Speed.mp4"}},
+		{"ok - case is ignored", "HARD", []string{"Die Hard.mp4", "Hard Boiled Laughs.mp4"}},
+		{"ok - every word must match", "hard action", []string{"Die Hard.mp4"}},
+		{"ok - category", "comedy", []string{"Airplane.m4v", "Hard Boiled Laughs.mp4"}},
+		{"ok - extra spaces", "  speed  ", []string{"Speed.mp4"}},
+		{"ok - nothing found", "alien", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, e := range r.Search(tt.query) {
+				got = append(got, e.Name)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortEntries(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Name: "Airplane.m4v", Size: 300, ModTime: base.Add(2 * time.Hour), AddedAt: base},
+		{Name: "Die Hard.mp4", Size: 100, ModTime: base, AddedAt: base.Add(time.Hour)},
+		{Name: "Heat.mp4", Size: 300, ModTime: base.Add(time.Hour), AddedAt: base},
+		{Name: "Speed.mp4", Size: 200, ModTime: base.Add(2 * time.Hour), AddedAt: base},
+	}
+
+	tests := []struct {
+		name  string
+		order SortOrder
+		want  []string
+	}{
+		{"ok - name", SortName, []string{"Airplane.m4v", "Die Hard.mp4", "Heat.mp4", "Speed.mp4"}},
+		{"ok - newest first, ties by name", SortNewest, []string{"Airplane.m4v", "Speed.mp4", "Heat.mp4", "Die Hard.mp4"}},
+		{"ok - added last first, ties by modification", SortAdded, []string{"Die Hard.mp4", "Airplane.m4v", "Speed.mp4", "Heat.mp4"}},
+		{"ok - largest first, ties by name", SortSize, []string{"Airplane.m4v", "Heat.mp4", "Speed.mp4", "Die Hard.mp4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sorted := slices.Clone(entries)
+			SortEntries(sorted, tt.order, CollateBytes)
+
+			var got []string
+			for _, e := range sorted {
+				got = append(got, e.Name)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("SortEntries(%s) = %q, want %q", tt.order, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSortOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		want    SortOrder
+		wantErr bool
+	}{
+		{"ok - empty is name", "", SortName, false},
+		{"ok - newest", "newest", SortNewest, false},
+		{"ok - added", "added", SortAdded, false},
+		{"ok - size", "size", SortSize, false},
+		{"fail - unknown", "rating", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseSortOrder(tt.input)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseSortOrder(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryScanModTime(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	path := filepath.Join(root, "film.mp4")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	first := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, first, first); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry()
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := r.List()[0].ModTime; !got.Equal(first) {
+		t.Errorf("ModTime = %v, want %v", got, first)
+	}
+
+	// a replaced file keeps its entry, with the new mtime
+	later := first.Add(24 * time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	id, tag := r.List()[0].UUID, r.List()[0].ETag
+	held, err := r.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if e := r.List()[0]; e.UUID != id || !e.ModTime.Equal(later) {
+		t.Errorf("after rescan entry %v with ModTime %v, want %v with %v", e.UUID, e.ModTime, id, later)
+	}
+	// a stream that got the entry before keeps what it got, its ETag still the one of that mtime
+	if !held.ModTime.Equal(first) || held.ETag != tag {
+		t.Errorf("entry held across the rescan has ModTime %v ETag %q, want %v %q", held.ModTime, held.ETag, first, tag)
+	}
+	// its content may have changed, resumed downloads must start over
+	if e := r.List()[0]; e.ETag == "" || e.ETag == tag {
+		t.Errorf("after rescan ETag = %q, was %q, want a new one", e.ETag, tag)
+	}
+}
+
+// a rescan of a changed file must leave the entry streams got from Get as it was, run with -race
+func TestRegistryScanChangedWhileRead(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	path := filepath.Join(root, "film.mp4")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	id := r.List()[0].UUID
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			e, err := r.Get(id)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			// what a stream reads while it opens the file
+			_ = fmt.Sprint(e.Name, e.Size, e.Parts, e.ModTime, e.Target, e.ETag, e.Thumb)
+		}
+	})
+
+	for i := range 50 {
+		if err := os.WriteFile(path, bytes.Repeat([]byte("x"), i+2), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Scan("vol_0", root); err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if e, _ := r.Get(id); e.Size != 51 {
+		t.Errorf("Size = %d after the last rescan, want 51", e.Size)
+	}
+}
+
+func TestRegistryScanAddedAt(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		root := t.TempDir()
+		if err := os.WriteFile(filepath.Join(root, "old.mp4"), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		r := NewRegistry()
+		if err := r.Scan("vol_0", root); err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+		firstScan := time.Now()
+
+		// a file copied over later, rescanned a while after
+		time.Sleep(time.Hour)
+		if err := os.WriteFile(filepath.Join(root, "new.mp4"), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Hour)
+		if err := r.Scan("vol_0", root); err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+
+		for _, e := range r.List() {
+			want := firstScan
+			if e.Name == "new.mp4" {
+				want = firstScan.Add(2 * time.Hour)
+			}
+			if !e.AddedAt.Equal(want) {
+				t.Errorf("%s AddedAt = %v, want %v", e.Name, e.AddedAt, want)
+			}
+		}
+	})
+}
+
+// two volumes with the same layout, e.g. a backup of the other, scanned at once. Each keeps its own entries
+func TestRegistryScanSamePathOnTwoMounts(t *testing.T) {
+	t.Parallel()
+
+	roots := map[string]string{"vol_0": t.TempDir(), "vol_1": t.TempDir()}
+	for _, root := range roots {
+		if err := os.MkdirAll(filepath.Join(root, "Action"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, "Action", "Heat.mkv"), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRegistry()
+	for range 2 {
+		var wg sync.WaitGroup
+		for id, root := range roots {
+			wg.Go(func() {
+				if err := r.Scan(id, root); err != nil {
+					t.Errorf("Scan(%s) error = %v", id, err)
+				}
+			})
+		}
+		wg.Wait()
+
+		if got, want := r.CountByMount(), map[string]int{"vol_0": 1, "vol_1": 1}; !maps.Equal(got, want) {
+			t.Fatalf("CountByMount() = %v, want %v", got, want)
+		}
+	}
+
+	// removing the file from one volume leaves the other's entry alone
+	if err := os.Remove(filepath.Join(roots["vol_0"], "Action", "Heat.mkv")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Scan("vol_0", roots["vol_0"]); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.CountByMount(), map[string]int{"vol_1": 1}; !maps.Equal(got, want) {
+		t.Errorf("CountByMount() after removing vol_0's copy = %v, want %v", got, want)
+	}
+	r.Remove("vol_1", "Action/Heat.mkv")
+	if got := r.Len(); got != 0 {
+		t.Errorf("Len() after Remove = %d, want 0", got)
+	}
+}
+
+func TestRegistryScanIncremental(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, name := range []string{"Action/Heat.mkv", "Drama/Amour.mp4", "Drama/Old/Ran.mkv"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// directories changed a moment ago aren't trusted, these were last changed an hour ago
+	touch := func(dir string, at time.Time) {
+		t.Helper()
+		if err := os.Chtimes(filepath.Join(root, dir), at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hourAgo := time.Now().Add(-time.Hour)
+	for _, dir := range []string{".", "Action", "Drama", "Drama/Old"} {
+		touch(dir, hourAgo)
+	}
+
+	r := NewRegistry()
+	scan := func(full bool) ScanSummary {
+		t.Helper()
+		summary, err := r.ScanIncremental("vol_0", root, full)
+		if err != nil {
+			t.Fatalf("ScanIncremental() error = %v", err)
+		}
+		return summary
+	}
+
+	// the first scan of a mount reads everything, incremental or not
+	if got, want := scan(false), (ScanSummary{Full: true, DirsRead: 4, Entries: 3}); got != want {
+		t.Fatalf("first scan = %+v, want %+v", got, want)
+	}
+	if got, want := scan(false), (ScanSummary{DirsSkipped: 4, Entries: 3}); got != want {
+		t.Errorf("scan of an unchanged volume = %+v, want %+v", got, want)
+	}
+
+	// a film added to Drama: only Drama is read again, Drama/Old below it is still taken as it was
+	if err := os.WriteFile(filepath.Join(root, "Drama", "Ikiru.mkv"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	touch("Drama", hourAgo.Add(time.Minute))
+	if got, want := scan(false), (ScanSummary{DirsRead: 1, DirsSkipped: 3, Entries: 4}); got != want {
+		t.Errorf("scan after touching Drama = %+v, want %+v", got, want)
+	}
+	if got := r.CountByMount()["vol_0"]; got != 4 {
+		t.Errorf("CountByMount() = %d after adding Ikiru, want 4", got)
+	}
+
+	// a film removed from the deepest directory, its parents untouched
+	if err := os.Remove(filepath.Join(root, "Drama", "Old", "Ran.mkv")); err != nil {
+		t.Fatal(err)
+	}
+	touch("Drama/Old", hourAgo.Add(2*time.Minute))
+	if got, want := scan(false), (ScanSummary{DirsRead: 1, DirsSkipped: 3, Entries: 3}); got != want {
+		t.Errorf("scan after removing Ran = %+v, want %+v", got, want)
+	}
+	names := make([]string, 0, 3)
+	for _, e := range r.List() {
+		names = append(names, e.Path)
+	}
+	slices.Sort(names)
+	if want := []string{"Action/Heat.mkv", "Drama/Amour.mp4", "Drama/Ikiru.mkv"}; !slices.Equal(names, want) {
+		t.Errorf("entries = %v, want %v", names, want)
+	}
+
+	// a directory changed just now is read again until its mtime has settled
+	if err := os.WriteFile(filepath.Join(root, "Action", "Ronin.mp4"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if got, want := scan(false), (ScanSummary{DirsRead: 1, DirsSkipped: 3, Entries: 4}); got != want {
+			t.Errorf("scan after adding Ronin = %+v, want %+v", got, want)
+		}
+	}
+
+	if got, want := scan(true), (ScanSummary{Full: true, DirsRead: 4, Entries: 4}); got != want {
+		t.Errorf("full scan = %+v, want %+v", got, want)
+	}
+}
+
+func TestRegistryScanGrowing(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	hourAgo := time.Now().Add(-time.Hour)
+	write := func(name, content string, at time.Time) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(root, name), at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("Heat.mkv", "xx", hourAgo)
+	touch := func(at time.Time) {
+		t.Helper()
+		if err := os.Chtimes(root, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touch(hourAgo)
+
+	r := NewRegistry()
+	r.SetSettle(time.Minute)
+	// the steps build on each other, no subtests. Writing to a file leaves the directory's mtime as it was,
+	// the scans after the first are incremental but the one that has to find a file rewritten in place
+	steps := []struct {
+		name        string
+		change      func()
+		wantSizes   map[string]int64
+		wantGrowing int
+	}{
+		{"ok - settled file", func() {}, map[string]int64{"Heat.mkv": 2}, 0},
+		{"ok - copy started", func() {
+			write("Ronin.mp4", "", hourAgo)
+			touch(hourAgo.Add(time.Minute))
+		}, map[string]int64{"Heat.mkv": 2}, 1},
+		{"ok - copy going on", func() {
+			write("Ronin.mp4", "xxx", time.Now())
+		}, map[string]int64{"Heat.mkv": 2}, 1},
+		{"ok - copy done", func() {
+			write("Ronin.mp4", "xxxxx", hourAgo)
+		}, map[string]int64{"Heat.mkv": 2, "Ronin.mp4": 5}, 0},
+		{"ok - rewritten in place keeps the entry", func() {
+			write("Heat.mkv", "xxx", time.Now())
+		}, map[string]int64{"Heat.mkv": 2, "Ronin.mp4": 5}, 1},
+		{"ok - rewrite done", func() {
+			write("Heat.mkv", "xxxx", hourAgo)
+		}, map[string]int64{"Heat.mkv": 4, "Ronin.mp4": 5}, 0},
+	}
+
+	for n, step := range steps {
+		step.change()
+		summary, err := r.ScanIncremental("vol_0", root, n == 0 || n == 4)
+		if err != nil {
+			t.Fatalf("%s: ScanIncremental() error = %v", step.name, err)
+		}
+		sizes := map[string]int64{}
+		for _, e := range r.List() {
+			sizes[e.Path] = e.Size
+		}
+		if !maps.Equal(sizes, step.wantSizes) || summary.Growing != step.wantGrowing {
+			t.Errorf("%s: sizes %v growing %d, want %v %d", step.name, sizes, summary.Growing, step.wantSizes, step.wantGrowing)
+		}
+	}
+}
+
+func TestRegistryAddExtensions(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for name, content := range map[string]string{"Heat.mp4": "x", "Ronin.TS": "x", "Ronin.strm": "Ronin.TS\n", "notes.txt": "x"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := func(r *Registry) []string {
+		var names []string
+		for _, e := range r.List() {
+			names = append(names, e.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	r := NewRegistry()
+	summary, err := r.ScanIncremental("vol_0", root, true)
+	if err != nil || summary.StrmErr == nil {
+		t.Fatalf("ScanIncremental() error = %v, StrmErr = %v, want the .strm pointing at a .ts refused", err, summary.StrmErr)
+	}
+	if got := names(r); !slices.Equal(got, []string{"Heat.mp4"}) {
+		t.Errorf("entries = %q without .ts added, want [Heat.mp4]", got)
+	}
+
+	r = NewRegistry()
+	r.AddExtensions(".ts", ".ts")
+	if !r.IsVideo("Ronin.TS") || IsVideo("Ronin.TS") || r.IsVideo("notes.txt") {
+		t.Errorf("IsVideo(Ronin.TS) = %v, package IsVideo(Ronin.TS) = %v, IsVideo(notes.txt) = %v, want true false false",
+			r.IsVideo("Ronin.TS"), IsVideo("Ronin.TS"), r.IsVideo("notes.txt"))
+	}
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := names(r); !slices.Equal(got, []string{"Heat.mp4", "Ronin.TS", "Ronin.TS"}) {
+		t.Errorf("entries = %q with .ts added, want Heat.mp4 and Ronin.TS twice, the file and its .strm", got)
+	}
+}
+
+func TestRegistryHidden(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, name := range []string{"Action/Heat.mkv", "Action/Ronin.mp4", "Drama/Amour.mp4"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// directories changed a moment ago aren't trusted, incremental scans skip these
+	hourAgo := time.Now().Add(-time.Hour)
+	for _, dir := range []string{".", "Action", "Drama"} {
+		if err := os.Chtimes(filepath.Join(root, dir), hourAgo, hourAgo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRegistry()
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	amour := entryByName(t, r, "Amour.mp4")
+	version, _ := r.Watch()
+
+	got, err := r.SetHidden(amour.UUID, true)
+	if err != nil || !got.Hidden {
+		t.Fatalf("SetHidden() = %+v, %v, want it hidden", got, err)
+	}
+	if v, _ := r.Watch(); v == version {
+		t.Error("hiding an entry didn't wake the watchers")
+	}
+
+	// listed nowhere, still there by UUID for links and bookmarks
+	visible := func() []string {
+		t.Helper()
+		var names []string
+		for _, e := range r.List() {
+			names = append(names, e.Name)
+		}
+		return names
+	}
+	check := func(when string) {
+		t.Helper()
+		if got := visible(); !slices.Equal(got, []string{"Heat.mkv", "Ronin.mp4"}) {
+			t.Errorf("%s: List() = %q, want Amour.mp4 left out", when, got)
+		}
+		if r.Len() != 2 || len(r.Search("amour")) != 0 {
+			t.Errorf("%s: Len() = %d, Search(amour) = %v, want 2 and nothing", when, r.Len(), r.Search("amour"))
+		}
+		if got := r.Categories(); !slices.Equal(got, []Category{{Name: "Action", Count: 2}}) {
+			t.Errorf("%s: Categories() = %v, want only Action", when, got)
+		}
+		if e, err := r.Get(amour.UUID); err != nil || !e.Hidden || e.Path != amour.Path {
+			t.Errorf("%s: Get() = %+v, %v, want the hidden entry with its UUID", when, e, err)
+		}
+		if hidden := r.Hidden(); len(hidden) != 1 || hidden[0].UUID != amour.UUID {
+			t.Errorf("%s: Hidden() = %v, want Amour.mp4", when, hidden)
+		}
+		if stats := r.Stats(); stats.Entries != 3 || stats.Hidden != 1 {
+			t.Errorf("%s: Stats() = %d entries %d hidden, want 3 and 1", when, stats.Entries, stats.Hidden)
+		}
+	}
+	check("hidden")
+
+	// rescans don't bring it back as a new visible entry, not even once the file changed
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	check("full rescan")
+	if _, err := r.ScanIncremental("vol_0", root, false); err != nil {
+		t.Fatalf("ScanIncremental() error = %v", err)
+	}
+	check("incremental rescan")
+	if err := os.WriteFile(filepath.Join(root, "Drama", "Amour.mp4"), []byte("remastered"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	check("file replaced")
+
+	// the file leaving and coming back between two scans is the same path, still hidden
+	if err := os.Rename(filepath.Join(root, "Drama", "Amour.mp4"), filepath.Join(root, "Amour.part")); err != nil {
+		t.Fatal(err)
+	}
+	r.Remove("vol_0", amour.Path)
+	if err := os.Rename(filepath.Join(root, "Amour.part"), filepath.Join(root, "Drama", "Amour.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	check("removed and found again")
+
+	if _, err := r.SetHidden(amour.UUID, false); err != nil {
+		t.Fatalf("SetHidden() error = %v", err)
+	}
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := visible(); !slices.Equal(got, []string{"Amour.mp4", "Heat.mkv", "Ronin.mp4"}) {
+		t.Errorf("unhidden: List() = %q, want all three", got)
+	}
+
+	t.Run("fail - unknown entry", func(t *testing.T) {
+		t.Parallel()
+		if _, err := NewRegistry().SetHidden(uuid.Must(uuid.NewV7()), true); err == nil {
+			t.Error("SetHidden() error = nil, want no such entry")
+		}
+	})
+}
+
+func TestRegistryWatch(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.mp4"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+
+	closed := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	steps := []struct {
+		name        string
+		change      func() error
+		wantChanged bool
+	}{
+		{"ok - first scan", func() error { return r.Scan("vol_0", root) }, true},
+		{"ok - nothing new", func() error { return r.Scan("vol_0", root) }, false},
+		{"ok - file added", func() error {
+			if err := os.WriteFile(filepath.Join(root, "b.mp4"), []byte("x"), 0o644); err != nil {
+				return err
+			}
+			return r.Scan("vol_0", root)
+		}, true},
+		{"ok - file grew", func() error {
+			if err := os.WriteFile(filepath.Join(root, "b.mp4"), []byte("xx"), 0o644); err != nil {
+				return err
+			}
+			return r.Scan("vol_0", root)
+		}, true},
+		{"ok - file removed", func() error {
+			if err := os.Remove(filepath.Join(root, "a.mp4")); err != nil {
+				return err
+			}
+			return r.Scan("vol_0", root)
+		}, true},
+		{"ok - other volume empty", func() error { return r.Scan("vol_1", t.TempDir()) }, false},
+	}
+
+	// the steps build on each other, no subtests
+	for _, step := range steps {
+		before, changed := r.Watch()
+		if err := step.change(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		after, _ := r.Watch()
+		if closed(changed) != step.wantChanged || (after != before) != step.wantChanged {
+			t.Errorf("%s: changed = %v, version %d -> %d, want changed %v", step.name, closed(changed), before, after, step.wantChanged)
+		}
+	}
+}
+
+func TestRegistryCategories(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	for _, e := range []Entry{
+		{Path: "a", Name: "a.mp4", Category: "Comedy"},
+		{Path: "b", Name: "b.mp4", Category: "Action"},
+		{Path: "c", Name: "c.mp4", Category: "Comedy"},
+	} {
+		e.UUID = uuid.Must(uuid.NewV7())
+		r.Add(&e)
+	}
+
+	want := []Category{{Name: "Action", Count: 1}, {Name: "Comedy", Count: 2}}
+	if got := r.Categories(); !slices.Equal(got, want) {
+		t.Errorf("Categories() = %v, want %v", got, want)
+	}
+}
+
+func TestFindThumb(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		path   string
+		images []string
+		want   string
+	}{
+		{"ok - same name", "Heat.mkv", []string{"Heat.jpg"}, "Heat.jpg"},
+		{"ok - poster suffix", "Action/Heat.mkv", []string{"Action/Heat-poster.png"}, "Action/Heat-poster.png"},
+		{"ok - thumb suffix", "Action/Heat.mkv", []string{"Action/Heat-thumb.webp"}, "Action/Heat-thumb.webp"},
+		{"ok - extension in capitals", "Heat.mkv", []string{"Heat.JPG"}, "Heat.JPG"},
+		{"ok - folder poster", "Heat (1995)/Heat.mkv", []string{"Heat (1995)/poster.jpg"}, "Heat (1995)/poster.jpg"},
+		{"ok - folder image", "Heat (1995)/Heat.mkv", []string{"Heat (1995)/folder.jpeg"}, "Heat (1995)/folder.jpeg"},
+		{"ok - own image before the folder's", "Action/Heat.mkv", []string{"Action/poster.jpg", "Action/Heat.jpg"}, "Action/Heat.jpg"},
+		{"ok - poster in the root", "Heat.mkv", []string{"poster.png"}, "poster.png"},
+		{"fail - another film's poster", "Action/Heat.mkv", []string{"Action/Ronin.jpg"}, ""},
+		{"fail - poster of a subfolder", "Heat.mkv", []string{"Action/poster.jpg"}, ""},
+		{"fail - nothing", "Heat.mkv", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			images := make(map[string]string)
+			for _, image := range tt.images {
+				ext := filepath.Ext(image)
+				images[strings.TrimSuffix(image, ext)+strings.ToLower(ext)] = image
+			}
+			if got := findThumb(tt.path, images); got != tt.want {
+				t.Errorf("findThumb(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryScanThumb(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, name := range []string{"Heat.mkv", "Heat-poster.jpg", "Ronin.mp4"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRegistry()
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := len(r.List()); got != 2 {
+		t.Fatalf("scan found %d entries, want 2, posters are no entries", got)
+	}
+	thumbs := func() map[string]string {
+		got := make(map[string]string)
+		for _, e := range r.List() {
+			got[e.Name] = e.Thumb
+		}
+		return got
+	}
+	if got, want := thumbs(), map[string]string{"Heat.mkv": "Heat-poster.jpg", "Ronin.mp4": ""}; !maps.Equal(got, want) {
+		t.Errorf("thumbs = %v, want %v", got, want)
+	}
+
+	// a poster dropped in later is picked up by the next scan, and watchers hear of it
+	version, _ := r.Watch()
+	if err := os.WriteFile(filepath.Join(root, "Ronin.png"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got, want := thumbs(), map[string]string{"Heat.mkv": "Heat-poster.jpg", "Ronin.mp4": "Ronin.png"}; !maps.Equal(got, want) {
+		t.Errorf("after rescan thumbs = %v, want %v", got, want)
+	}
+	if after, _ := r.Watch(); after == version {
+		t.Error("a new poster did not change the library version")
+	}
+}
+
+func TestRegistryStats(t *testing.T) {
+	t.Parallel()
+
+	if got := NewRegistry().Stats(); got.Entries != 0 || got.Largest != nil || got.Newest != nil {
+		t.Errorf("Stats() of an empty registry = %+v, want nothing", got)
+	}
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	r := NewRegistry()
+	for _, e := range []Entry{
+		{MountID: "vol_0", Path: "a", Name: "Heat.mkv", Category: "Action", Size: 700, ModTime: day},
+		{MountID: "vol_0", Path: "b", Name: "Ronin.mp4", Category: "Action", Size: 900, ModTime: day.Add(-time.Hour)},
+		{MountID: "vol_1", Path: "c", Name: "Airplane.m4v", Category: "Comedy", Size: 300, ModTime: day.Add(time.Hour)},
+		// hidden, the largest and newest of all
+		{MountID: "vol_1", Path: "d", Name: "Secret.mkv", Category: "Private", Size: 5000, ModTime: day.Add(48 * time.Hour), Hidden: true},
+	} {
+		e.UUID = uuid.Must(uuid.NewV7())
+		r.Add(&e)
+	}
+
+	got := r.Stats()
+	if got.Entries != 4 || got.Hidden != 1 || got.Bytes != 6900 {
+		t.Errorf("Stats() = %d entries (%d hidden) of %d bytes, want 4 (1 hidden) of 6900", got.Entries, got.Hidden, got.Bytes)
+	}
+	if want := map[string]int{"vol_0": 2, "vol_1": 2}; !maps.Equal(got.ByVolume, want) {
+		t.Errorf("ByVolume = %v, want %v", got.ByVolume, want)
+	}
+	if want := map[string]int{"Action": 2, "Comedy": 1, "Private": 1}; !maps.Equal(got.ByCategory, want) {
+		t.Errorf("ByCategory = %v, want %v", got.ByCategory, want)
+	}
+	if got.Largest == nil || got.Largest.Name != "Ronin.mp4" {
+		t.Errorf("Largest = %+v, want Ronin.mp4", got.Largest)
+	}
+	if got.Newest == nil || got.Newest.Name != "Airplane.m4v" {
+		t.Errorf("Newest = %+v, want Airplane.m4v", got.Newest)
+	}
+}
+
+// BenchmarkRegistryStats summarises a library of a hundred thousand entries
+func BenchmarkRegistryStats(b *testing.B) {
+	r := NewRegistry()
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 100_000 {
+		r.Add(&Entry{
+			UUID:     uuid.Must(uuid.NewV7()),
+			MountID:  fmt.Sprintf("vol_%d", i%4),
+			Path:     fmt.Sprintf("film%d.mkv", i),
+			Name:     fmt.Sprintf("film%d.mkv", i),
+			Category: fmt.Sprintf("Category %d", i%50),
+			Size:     int64(i),
+			ModTime:  start.Add(time.Duration(i%1000) * time.Minute),
+		})
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		r.Stats()
+	}
+}
@@ -5,14 +5,22 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 )
 
 func (m *Manager) OpenFile(rootPath, relPath string) (*os.File, error) {
+	// refused before touching the disk, a missing directory on the way must not turn it into a not found
+	if !filepath.IsLocal(relPath) {
+		return nil, fmt.Errorf("open %s: %w", relPath, ErrPathOutsideRoot)
+	}
+
 	f, err := os.OpenInRoot(rootPath, relPath)
 	if err != nil {
 		switch {
-		// os.OpenInRoot returns fs.ErrInvalid if the path escapes the root
-		case errors.Is(err, fs.ErrInvalid):
+		// os.OpenInRoot returns fs.ErrInvalid for bad names, a local path can only escape through a symlink
+		case errors.Is(err, fs.ErrInvalid), escapesByLink(rootPath, relPath):
 			// to avoid error msg stuttering, jus wrap the original error here
 			return nil, fmt.Errorf("%w (%w)", ErrPathOutsideRoot, err)
 		// case errors.Is(err, fs.ErrPermission):
@@ -24,3 +32,74 @@ func (m *Manager) OpenFile(rootPath, relPath string) (*os.File, error) {
 	}
 	return f, nil
 }
+
+// escapesByLink reports whether relPath, local as it is, leads out of rootPath once its symlinks are
+// followed, by the rules os.Root refuses them with: a link to an absolute path, or one whose ".." climbs
+// above the root. os keeps the error it returns for those unexported
+func escapesByLink(rootPath, relPath string) bool {
+	rest := strings.Split(filepath.ToSlash(relPath), "/")
+	dir := "." // resolved so far, relative to rootPath
+	for links := 0; len(rest) > 0; {
+		name := rest[0]
+		rest = rest[1:]
+		next := path.Join(dir, name)
+		if next == ".." || strings.HasPrefix(next, "../") {
+			return true
+		}
+		target, err := os.Readlink(filepath.Join(rootPath, filepath.FromSlash(next)))
+		if err != nil {
+			// not a link, or nothing there
+			dir = next
+			continue
+		}
+		// a loop is os.Root's ELOOP, not an escape
+		if links++; links > 255 {
+			return false
+		}
+		target = filepath.ToSlash(target)
+		if filepath.IsAbs(target) || strings.HasPrefix(target, "/") {
+			return true
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return false
+}
+
+// EntryPath returns where entry lives on disk, for tools like ffmpeg that open the file themselves. They
+// open it outside os.Root, so a path leading out of the volume through a symlink is refused here the way
+// OpenFile refuses it
+func (m *Manager) EntryPath(entry *Entry) (string, error) {
+	vol, ok := m.Volumes[entry.MountID]
+	if !ok {
+		return "", fmt.Errorf("volume %q not found", entry.MountID)
+	}
+
+	target := entry.Path
+	if entry.Target != "" {
+		// a URL goes as it is, ffmpeg reads those too
+		if isURL(entry.Target) {
+			return entry.Target, nil
+		}
+		target = entry.Target
+	}
+	rel := filepath.FromSlash(target)
+	if !filepath.IsLocal(rel) || escapesByLink(vol.RootPath, rel) {
+		return "", fmt.Errorf("path of %s: %w", entry.Path, ErrPathOutsideRoot)
+	}
+	return filepath.Join(vol.RootPath, rel), nil
+}
+
+// ErrNoThumb is returned for entries without a poster image
+var ErrNoThumb = errors.New("entry has no thumbnail")
+
+// OpenThumb opens the poster image of entry, confined to its volume like the entry itself
+func (m *Manager) OpenThumb(entry *Entry) (*os.File, error) {
+	if entry.Thumb == "" {
+		return nil, ErrNoThumb
+	}
+	vol, ok := m.Volumes[entry.MountID]
+	if !ok {
+		return nil, fmt.Errorf("volume %q not found", entry.MountID)
+	}
+	return m.OpenFile(vol.RootPath, entry.Thumb)
+}
@@ -0,0 +1,158 @@
+package media
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenFile(t *testing.T) {
+	t.Parallel()
+
+	// base/root is the volume, base/outside/secret.mp4 is what nothing may reach through it
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	for _, dir := range []string{filepath.Join(root, "Action"), filepath.Join(base, "outside")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(root, "Action", "Heat.mp4"), filepath.Join(base, "outside", "secret.mp4")} {
+		if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlinks := true
+	if err := os.Symlink(filepath.Join(base, "outside", "secret.mp4"), filepath.Join(root, "link.mp4")); err != nil {
+		// e.g. windows without the privilege
+		symlinks = false
+	} else if err := os.Symlink(filepath.Join(base, "outside"), filepath.Join(root, "dirlink")); err != nil {
+		t.Fatal(err)
+	} else if err := os.Symlink("Action", filepath.Join(root, "inlink")); err != nil {
+		t.Fatal(err)
+	} else if err := os.Symlink(filepath.Join("..", "outside"), filepath.Join(root, "uplink")); err != nil {
+		t.Fatal(err)
+	} else if err := os.Symlink(filepath.Join(root, "Action"), filepath.Join(root, "abslink")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		symlink bool
+		wantErr error
+	}{
+		{"ok - file", "Action/Heat.mp4", false, nil},
+		{"ok - dot dot inside the root", "Action/../Action/Heat.mp4", false, nil},
+		{"ok - directory", "Action", false, nil},
+		{"fail - missing", "Action/Ronin.mp4", false, os.ErrNotExist},
+		{"fail - dot dot", "../outside/secret.mp4", false, ErrPathOutsideRoot},
+		{"fail - dot dot through a missing directory", "Drama/../../outside/secret.mp4", false, ErrPathOutsideRoot},
+		{"fail - dot dot from a subdirectory", "Action/../../outside/secret.mp4", false, ErrPathOutsideRoot},
+		{"fail - absolute", filepath.Join(base, "outside", "secret.mp4"), false, ErrPathOutsideRoot},
+		{"fail - symlink to a file outside", "link.mp4", true, ErrPathOutsideRoot},
+		{"fail - symlink to a directory outside", "dirlink/secret.mp4", true, ErrPathOutsideRoot},
+		{"fail - missing behind a symlink outside", "dirlink/Ronin.mp4", true, ErrPathOutsideRoot},
+		{"ok - symlink inside the root", "inlink/Heat.mp4", true, nil},
+		{"fail - missing behind a symlink inside", "inlink/Ronin.mp4", true, os.ErrNotExist},
+		{"fail - relative symlink climbing out", "uplink/secret.mp4", true, ErrPathOutsideRoot},
+		{"fail - missing behind a relative symlink climbing out", "uplink/Ronin.mp4", true, ErrPathOutsideRoot},
+		// os.Root refuses absolute links even when they stay inside
+		{"fail - absolute symlink inside the root", "abslink/Heat.mp4", true, ErrPathOutsideRoot},
+	}
+
+	m := NewManager(1024, ModeFileDirect)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tt.symlink && !symlinks {
+				t.Skip("no symlinks here")
+			}
+
+			f, err := m.OpenFile(root, tt.path)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("OpenFile(%q) error = %v", tt.path, err)
+				}
+				f.Close()
+				return
+			}
+			if err == nil {
+				f.Close()
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("OpenFile(%q) error = %v, want %v", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	t.Parallel()
+
+	// base/root is the volume, base/outside/secret.mp4 is what ffmpeg mustn't be pointed at through it
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	for _, dir := range []string{filepath.Join(root, "Action"), filepath.Join(base, "outside")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(root, "Action", "Heat.mkv"), filepath.Join(base, "outside", "secret.mp4")} {
+		if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlinks := true
+	if err := os.Symlink(filepath.Join(base, "outside", "secret.mp4"), filepath.Join(root, "link.mkv")); err != nil {
+		// e.g. windows without the privilege
+		symlinks = false
+	} else if err := os.Symlink(filepath.Join("..", "outside"), filepath.Join(root, "dirlink")); err != nil {
+		t.Fatal(err)
+	} else if err := os.Symlink("Action", filepath.Join(root, "inlink")); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(1024, ModeFileDirect)
+	m.AddMount("vol_0", root, NewIOLimiter(1))
+
+	tests := []struct {
+		name    string
+		entry   Entry
+		symlink bool
+		want    string
+		wantErr error
+	}{
+		{"ok - file", Entry{MountID: "vol_0", Path: "Action/Heat.mkv"}, false, filepath.Join(root, "Action", "Heat.mkv"), nil},
+		{"ok - .strm target", Entry{MountID: "vol_0", Path: "Heat.strm", Target: "Action/Heat.mkv"}, false, filepath.Join(root, "Action", "Heat.mkv"), nil},
+		{"ok - url", Entry{MountID: "vol_0", Path: "Heat.strm", Target: "https://example.com/heat.mkv"}, false, "https://example.com/heat.mkv", nil},
+		{"ok - symlink inside the volume", Entry{MountID: "vol_0", Path: "inlink/Heat.mkv"}, true, filepath.Join(root, "inlink", "Heat.mkv"), nil},
+		{"fail - dot dot", Entry{MountID: "vol_0", Path: "Heat.strm", Target: "../outside/secret.mp4"}, false, "", ErrPathOutsideRoot},
+		{"fail - symlink to a file outside", Entry{MountID: "vol_0", Path: "link.mkv"}, true, "", ErrPathOutsideRoot},
+		{"fail - symlink to a directory outside", Entry{MountID: "vol_0", Path: "dirlink/secret.mp4"}, true, "", ErrPathOutsideRoot},
+		{"fail - .strm target through a symlink outside", Entry{MountID: "vol_0", Path: "Heat.strm", Target: "dirlink/secret.mp4"}, true, "", ErrPathOutsideRoot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tt.symlink && !symlinks {
+				t.Skip("no symlinks here")
+			}
+
+			got, err := m.EntryPath(&tt.entry)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("EntryPath(%q) = %q, %v, want %v", tt.entry.Path, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("EntryPath(%q) = %q, %v, want %q", tt.entry.Path, got, err, tt.want)
+			}
+		})
+	}
+}
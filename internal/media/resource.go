@@ -2,6 +2,7 @@ package media
 
 import (
 	"io"
+	"syscall"
 	"time"
 )
 
@@ -10,11 +11,16 @@ type Resource interface {
 	io.ReadSeekCloser
 	Name() string
 	ModTime() time.Time
-	Size() int64
+	Size() int64 // -1 when it isn't known
 }
 
 // ensure interface satisfaction
 var (
-	_ Resource = (*FileResource)(nil)
-	_ Resource = (*BufferedFileResource)(nil)
+	_ Resource     = (*FileResource)(nil)
+	_ Resource     = (*BufferedFileResource)(nil)
+	_ Resource     = (*ConcatResource)(nil)
+	_ Resource     = (*HTTPResource)(nil)
+	_ syscall.Conn = (*FileResource)(nil)
+	_ io.ReaderAt  = (*FileResource)(nil)
+	_ io.ReaderAt  = (*BufferedFileResource)(nil)
 )
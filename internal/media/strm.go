@@ -0,0 +1,104 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// strmExtension is the extension of Kodi's pointer files: a URL or a path to play in place of the file
+const strmExtension = ".strm"
+
+// maxStrmSize is far more than a pointer file needs, larger ones are not what they claim to be
+const maxStrmSize = 64 << 10
+
+// isURL reports whether target, what a .strm file points at, is a URL rather than a path
+func isURL(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// readStrm reads the .strm file at name, a path in fsys, the volume at root. Its first line that isn't empty
+// or a "#" comment is either an http(s) URL, whose size stays unknown, or the path of a video on the same
+// volume, relative to the .strm file or absolute within root. The video takes the name of the .strm file
+// with the extension of what it points at, which isVideo has to take
+func readStrm(fsys fs.FS, root, name string, isVideo func(name string) bool) (fileMetadata, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return fileMetadata{}, err
+	}
+	if info.Size() > maxStrmSize {
+		return fileMetadata{}, fmt.Errorf("read %s: %d bytes is too large for a .strm file", name, info.Size())
+	}
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return fileMetadata{}, err
+	}
+
+	var line string
+	sc := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	for sc.Scan() {
+		if l := strings.TrimSpace(sc.Text()); l != "" && !strings.HasPrefix(l, "#") {
+			line = l
+			break
+		}
+	}
+	if line == "" {
+		return fileMetadata{}, fmt.Errorf("read %s: no url or path in it", name)
+	}
+
+	title := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	if isURL(line) {
+		u, err := url.Parse(line)
+		if err != nil || u.Host == "" {
+			return fileMetadata{}, fmt.Errorf("read %s: bad url", name)
+		}
+		return fileMetadata{name: title + path.Ext(u.Path), target: line, modTime: info.ModTime()}, nil
+	}
+	if strings.Contains(line, "://") {
+		return fileMetadata{}, fmt.Errorf("read %s: only http and https urls are played", name)
+	}
+
+	target, err := strmTarget(root, path.Dir(name), line)
+	if err != nil {
+		return fileMetadata{}, fmt.Errorf("read %s: %w", name, err)
+	}
+	if !isVideo(target) {
+		return fileMetadata{}, fmt.Errorf("read %s: %s is not a video", name, target)
+	}
+	targetInfo, err := fs.Stat(fsys, target)
+	if err != nil {
+		return fileMetadata{}, fmt.Errorf("read %s: %w", name, err)
+	}
+	if !targetInfo.Mode().IsRegular() {
+		return fileMetadata{}, fmt.Errorf("read %s: %s is not a file", name, target)
+	}
+	return fileMetadata{
+		name:    title + path.Ext(target),
+		target:  target,
+		size:    targetInfo.Size(),
+		modTime: targetInfo.ModTime(),
+	}, nil
+}
+
+// strmTarget resolves the path p of a .strm file in dir to a path in the volume at root
+func strmTarget(root, dir, p string) (string, error) {
+	var rel string
+	if filepath.IsAbs(p) {
+		r, err := filepath.Rel(root, p)
+		if err != nil {
+			return "", ErrPathOutsideRoot
+		}
+		rel = filepath.ToSlash(r)
+	} else {
+		rel = path.Join(dir, filepath.ToSlash(p))
+	}
+	if !fs.ValidPath(rel) || rel == "." {
+		return "", ErrPathOutsideRoot
+	}
+	return rel, nil
+}
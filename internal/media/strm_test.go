@@ -0,0 +1,223 @@
+package media
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestReadStrm(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	strm := func(content string) fstest.MapFS {
+		return fstest.MapFS{
+			"Films/Heat.strm":   {Data: []byte(content)},
+			"Films/Heat.mkv":    {Data: []byte("0123456789")},
+			"Other/Ronin.mp4":   {Data: []byte("x")},
+			"Films/notes.txt":   {Data: []byte("x")},
+			"Films/Speed.mkv/x": {Data: []byte("x")},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		content    string
+		wantName   string
+		wantTarget string
+		wantSize   int64
+		wantErr    string
+	}{
+		{"ok - url", "https://example.com/films/heat.mkv?token=1\n", "Heat.mkv", "https://example.com/films/heat.mkv?token=1", 0, ""},
+		{"ok - url without extension", "http://example.com/watch?v=1", "Heat", "http://example.com/watch?v=1", 0, ""},
+		{"ok - comments, blank lines and a bom first", "\ufeff#KODIPROP:x=y\n\n  http://example.com/heat.mp4  \r\n", "Heat.mp4", "http://example.com/heat.mp4", 0, ""},
+		{"ok - relative path", "Heat.mkv", "Heat.mkv", "Films/Heat.mkv", 10, ""},
+		{"ok - relative path up and down", "../Other/Ronin.mp4", "Heat.mp4", "Other/Ronin.mp4", 1, ""},
+		{"ok - absolute path in the volume", filepath.Join(root, "Other", "Ronin.mp4"), "Heat.mp4", "Other/Ronin.mp4", 1, ""},
+		{"fail - empty", "\n  \n# only a comment\n", "", "", 0, "no url or path"},
+		{"fail - other scheme", "plugin://plugin.video.x/?id=1", "", "", 0, "only http and https"},
+		{"fail - url without host", "http:///heat.mkv", "", "", 0, "bad url"},
+		{"fail - out of the volume", "../../etc/passwd.mkv", "", "", 0, ErrPathOutsideRoot.Error()},
+		{"fail - absolute path elsewhere", filepath.Join(filepath.Dir(root), "Heat.mkv"), "", "", 0, ErrPathOutsideRoot.Error()},
+		{"fail - not a video", "notes.txt", "", "", 0, "not a video"},
+		{"fail - missing", "Missing.mkv", "", "", 0, "Missing.mkv"},
+		{"fail - a directory", "Speed.mkv", "", "", 0, "not a file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v, err := readStrm(strm(tt.content), root, "Films/Heat.strm", IsVideo)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readStrm() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readStrm() error = %v", err)
+			}
+			if v.name != tt.wantName || v.target != tt.wantTarget || v.size != tt.wantSize {
+				t.Errorf("readStrm() = %q -> %q sized %d, want %q -> %q sized %d", v.name, v.target, v.size, tt.wantName, tt.wantTarget, tt.wantSize)
+			}
+		})
+	}
+
+	t.Run("fail - too large", func(t *testing.T) {
+		t.Parallel()
+
+		fsys := fstest.MapFS{"Heat.strm": {Data: []byte(strings.Repeat("x", maxStrmSize+1))}}
+		if _, err := readStrm(fsys, root, "Heat.strm", IsVideo); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("readStrm() error = %v, want too large", err)
+		}
+	})
+}
+
+func TestRegistryScanStrm(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "heat.mkv", time.Time{}, strings.NewReader("from far away"))
+	}))
+	t.Cleanup(srv.Close)
+
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"Films/Heat.strm":        srv.URL + "/heat.mkv\n",
+		"Films/Ronin.strm":       "../Archive/ronin-1998.mp4",
+		"Archive/ronin-1998.mp4": "close by",
+		"Films/Broken.strm":      "ftp://example.com/broken.mkv",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewManager(1024, ModeFileBuffered)
+	m.AddMount("vol_0", root, NewIOLimiter(1))
+	summary, err := m.Registry.ScanIncremental("vol_0", root, true)
+	if err != nil {
+		t.Fatalf("ScanIncremental() error = %v", err)
+	}
+	if summary.StrmErr == nil || !strings.Contains(summary.StrmErr.Error(), "Films/Broken.strm") {
+		t.Errorf("StrmErr = %v, want Films/Broken.strm", summary.StrmErr)
+	}
+
+	tests := []struct {
+		name     string
+		entry    string
+		want     string
+		wantSize int64
+	}{
+		{"ok - url", "Heat.mkv", "from far away", 13},
+		{"ok - path on the volume", "Ronin.mp4", "close by", 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var entry *Entry
+			for _, e := range m.Registry.List() {
+				if e.Name == tt.entry {
+					entry = &e
+				}
+			}
+			if entry == nil {
+				t.Fatalf("no entry %q in %v", tt.entry, m.Registry.List())
+			}
+
+			res, err := m.OpenResource(entry, 0)
+			if err != nil {
+				t.Fatalf("OpenResource() error = %v", err)
+			}
+			defer res.Close()
+			data, err := io.ReadAll(res)
+			if err != nil || string(data) != tt.want || res.Size() != tt.wantSize {
+				t.Errorf("read %q (%v) sized %d, want %q sized %d", data, err, res.Size(), tt.want, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestRegistryScanStrmRetargeted(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"Films/Ronin.strm":         "../Archive/ronin-1998.mp4",
+		"Archive/ronin-1998.mp4":   "the cinema cut",
+		"Archive/ronin-remake.mp4": "the remake",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewManager(1024, ModeFileDirect)
+	m.AddMount("vol_0", root, NewIOLimiter(1))
+	if err := m.Registry.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	entries := m.Registry.List()
+	if len(entries) != 3 {
+		t.Fatalf("entries = %v, want the two files and the .strm", entries)
+	}
+	i := slices.IndexFunc(entries, func(e Entry) bool { return e.Path == "Films/Ronin.strm" })
+	if i < 0 {
+		t.Fatalf("no entry for Films/Ronin.strm in %v", entries)
+	}
+	id := entries[i].UUID
+	held, err := m.Registry.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "Films", "Ronin.strm"), []byte("../Archive/ronin-remake.mp4"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Registry.Scan("vol_0", root); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	// a stream that got the entry before the rescan plays what it pointed at then, with that file's size
+	read := func(e *Entry) string {
+		t.Helper()
+		res, err := m.OpenResource(e, 0)
+		if err != nil {
+			t.Fatalf("OpenResource() error = %v", err)
+		}
+		defer res.Close()
+		data, err := io.ReadAll(res)
+		if err != nil || res.Size() != int64(len(data)) {
+			t.Fatalf("read %q (%v) sized %d", data, err, res.Size())
+		}
+		return string(data)
+	}
+	if got := read(held); got != "the cinema cut" || held.Target != "Archive/ronin-1998.mp4" {
+		t.Errorf("held entry -> %q reads %q, want Archive/ronin-1998.mp4 and the cinema cut", held.Target, got)
+	}
+	updated, err := m.Registry.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(updated); got != "the remake" || updated.Target != "Archive/ronin-remake.mp4" {
+		t.Errorf("entry after the rescan -> %q reads %q, want Archive/ronin-remake.mp4 and the remake", updated.Target, got)
+	}
+}
@@ -0,0 +1,40 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// warmUpChunk is how much WarmUp reads at once
+const warmUpChunk = 1 << 20
+
+// WarmUp reads n bytes of res from off and drops them, so a disk that went to sleep spins up and the page
+// cache holds them by the time the stream asks. It reads with ReadAt, which leaves the offset of res alone,
+// and can run alongside the reads serving the request. Resources that can't, concatenated parts or a
+// remote URL, aren't warmed up. It returns how much it read, stopping early at the end of the file
+func WarmUp(ctx context.Context, res Resource, off, n int64) (int64, error) {
+	ra, ok := res.(io.ReaderAt)
+	if !ok {
+		return 0, nil
+	}
+
+	buf := bufferPool(warmUpChunk).Get().(*[]byte)
+	defer bufferPool(warmUpChunk).Put(buf)
+
+	var read int64
+	for read < n {
+		if err := ctx.Err(); err != nil {
+			return read, err
+		}
+		m, err := ra.ReadAt((*buf)[:min(n-read, warmUpChunk)], off+read)
+		read += int64(m)
+		if errors.Is(err, io.EOF) {
+			return read, nil
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
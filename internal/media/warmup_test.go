@@ -0,0 +1,92 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWarmUp(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), make([]byte, 3*warmUpChunk/2), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entry := &Entry{Name: "film.mp4", Path: "film.mp4", MountID: "vol_0"}
+
+	tests := []struct {
+		name     string
+		mode     ResourceMode
+		off, n   int64
+		wantRead int64
+	}{
+		{"ok - direct", ModeFileDirect, 0, 1000, 1000},
+		{"ok - buffered", ModeFileBuffered, 0, 1000, 1000},
+		{"ok - more than a chunk", ModeFileDirect, 0, warmUpChunk + 10, warmUpChunk + 10},
+		{"ok - from an offset", ModeFileBuffered, warmUpChunk, 100, 100},
+		{"ok - stops at the end", ModeFileDirect, warmUpChunk, warmUpChunk, warmUpChunk / 2},
+		{"ok - past the end", ModeFileBuffered, 2 * warmUpChunk, 100, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := NewManager(4096, tt.mode)
+			m.AddMount("vol_0", dir, NewIOLimiter(1))
+			res, err := m.OpenResource(entry, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Close()
+
+			read, err := WarmUp(t.Context(), res, tt.off, tt.n)
+			if err != nil || read != tt.wantRead {
+				t.Fatalf("WarmUp() = %d, %v, want %d", read, err, tt.wantRead)
+			}
+			// the stream still starts where it was
+			if pos, err := res.Seek(0, io.SeekCurrent); err != nil || pos != 0 {
+				t.Errorf("offset after WarmUp = %d, %v, want 0", pos, err)
+			}
+		})
+	}
+
+	t.Run("ok - concatenated parts aren't warmed up", func(t *testing.T) {
+		t.Parallel()
+
+		f, err := os.Open(filepath.Join(dir, "film.mp4"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := newConcatResource("film.mp4", []*os.File{f})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Close()
+		if read, err := WarmUp(t.Context(), res, 0, 1000); read != 0 || err != nil {
+			t.Errorf("WarmUp() = %d, %v, want 0, nil", read, err)
+		}
+	})
+
+	t.Run("fail - canceled", func(t *testing.T) {
+		t.Parallel()
+
+		m := NewManager(4096, ModeFileDirect)
+		m.AddMount("vol_0", dir, NewIOLimiter(1))
+		res, err := m.OpenResource(entry, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Close()
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		if _, err := WarmUp(ctx, res, 0, 1000); !errors.Is(err, context.Canceled) {
+			t.Errorf("WarmUp() error = %v, want context.Canceled", err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import "net/http"
+
+// ActivityClass is the kind of request a route serves. The shutdown monitor decides by it whether a
+// request is somebody using the server or a device checking it is still there
+type ActivityClass string
+
+const (
+	ActivityDiscovery ActivityClass = "discovery" // device and service descriptions, eventing, ConnectionManager: what idle TVs poll
+	ActivityBrowse    ActivityClass = "browse"    // ContentDirectory control, a renderer looking through the library
+	ActivityStream    ActivityClass = "stream"
+	ActivityPlaylist  ActivityClass = "playlist"
+	ActivityWeb       ActivityClass = "web"
+	ActivityAdmin     ActivityClass = "admin" // status and the admin api
+)
+
+// ActivityClasses are all the classes, in the order they're documented
+var ActivityClasses = []ActivityClass{ActivityDiscovery, ActivityBrowse, ActivityStream, ActivityPlaylist, ActivityWeb, ActivityAdmin}
+
+// ActivityNotifier is told about every request, with the class of its route
+type ActivityNotifier interface {
+	NotifyActivity(class ActivityClass)
+}
+
+// WithActivity reports every request to the notifier as activity of the given class
+func WithActivity(notifier ActivityNotifier, class ActivityClass) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if notifier != nil {
+				notifier.NotifyActivity(class)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// StreamNotifier is told when a long-running stream request starts and ends
+type StreamNotifier interface {
+	StreamStarted()
+	StreamEnded()
+}
+
+// WithStreamTracking reports the lifetime of each request to the notifier, meant for the streaming routes
+// where a single request can last for hours and must not look like inactivity
+func WithStreamTracking(notifier StreamNotifier) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if notifier == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			notifier.StreamStarted()
+			defer notifier.StreamEnded()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RequireToken protects admin routes. The token is accepted as a bearer token or as the basic auth
+// password, the latter lets a browser prompt for it. An empty token disables the routes entirely
+func RequireToken(token string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				http.Error(w, "admin api disabled (set -admin.token)", http.StatusForbidden)
+				return
+			}
+
+			if !validToken(r, token) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="streamer admin", charset="UTF-8"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func validToken(r *http.Request, token string) bool {
+	var given string
+
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		given = strings.TrimSpace(bearer)
+	} else if _, password, ok := r.BasicAuth(); ok {
+		given = password
+	}
+
+	if given == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
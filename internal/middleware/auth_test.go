@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireToken(t *testing.T) {
+	t.Parallel()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name     string
+		token    string
+		setAuth  func(r *http.Request)
+		wantCode int
+	}{
+		{"ok - bearer", "secret", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }, http.StatusNoContent},
+		{"ok - basic password", "secret", func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusNoContent},
+		{"fail - wrong bearer", "secret", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized},
+		{"fail - no credentials", "secret", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"fail - disabled", "", func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") }, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			tt.setAuth(r)
+			rec := httptest.NewRecorder()
+
+			RequireToken(tt.token)(ok).ServeHTTP(rec, r)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Gate decides whether requests are let through at all. An empty reason lets them pass, otherwise
+// retryAfter (zero if unknown) tells clients when to come back
+type Gate interface {
+	Refusal() (reason string, retryAfter time.Duration)
+}
+
+// WithGate answers 503 while the gate refuses requests, requests already in flight are not affected
+func WithGate(gate Gate) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reason, retryAfter := gate.Refusal()
+			if reason == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			}
+			http.Error(w, reason, http.StatusServiceUnavailable)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bytes"
+	"cmp"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// bufferedBodyMax is the most of a response WithHEAD holds back to learn its length, longer ones go out as
+// they come, chunked, to GET and HEAD alike
+const bufferedBodyMax = 1 << 20
+
+// WithHEAD gives HEAD the headers GET gets, Content-Length included, whether or not the handler tells the
+// two apart: DLNA clients probe with HEAD before they play and take any difference badly. A response that
+// doesn't say how long it is is held back until the handler returns (up to bufferedBodyMax) and sent with
+// its length, the server then drops the body of a HEAD. Responses with a length of their own, e.g. from
+// http.ServeContent, pass through as they are
+func WithHEAD(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		lw := &lengthWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+		lw.finish()
+	})
+}
+
+// lengthWriter holds back the header and body of a response until its length is known
+type lengthWriter struct {
+	http.ResponseWriter
+	status  int          // held back, 0 before WriteHeader
+	body    bytes.Buffer // held back
+	through bool         // the header is sent, writes go straight to the connection
+}
+
+func (w *lengthWriter) WriteHeader(code int) {
+	if w.through || code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status != 0 {
+		return
+	}
+	w.status = code
+	if w.Header().Get("Content-Length") != "" || !bodyAllowed(code) {
+		w.send()
+	}
+}
+
+func (w *lengthWriter) Write(p []byte) (int, error) {
+	if w.status == 0 && !w.through {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.through && w.body.Len()+len(p) > bufferedBodyMax {
+		w.send()
+	}
+	if w.through {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.body.Write(p)
+}
+
+// ReadFrom keeps sendfile for responses passing through, see statusRecorder.ReadFrom
+func (w *lengthWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.through {
+		return io.Copy(struct{ io.Writer }{w}, src)
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(w.ResponseWriter, src)
+}
+
+// Flush sends what is held back, a flushed response is one that streams and goes without a length
+func (w *lengthWriter) Flush() {
+	if !w.through {
+		w.send()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to set a write deadline
+func (w *lengthWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// send writes the header and the body held back, what follows goes straight through
+func (w *lengthWriter) send() {
+	w.through = true
+	w.ResponseWriter.WriteHeader(cmp.Or(w.status, http.StatusOK))
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
+
+// finish sends a response held back to the end, now that its length is known
+func (w *lengthWriter) finish() {
+	if w.through {
+		return
+	}
+	if w.Header().Get("Content-Length") == "" && bodyAllowed(cmp.Or(w.status, http.StatusOK)) {
+		w.Header().Set("Content-Length", strconv.Itoa(w.body.Len()))
+	}
+	w.send()
+}
+
+// bodyAllowed tells whether a response with status code has a body, see RFC 9110 section 6.4.1
+func bodyAllowed(code int) bool {
+	return code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified
+}
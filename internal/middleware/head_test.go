@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithHEAD(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantLength string // Content-Length, empty for none
+		wantBody   string // of the GET
+	}{
+		{"ok - length added", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "audio/x-mpegurl")
+			io.WriteString(w, "#EXTM3U\n")
+			io.WriteString(w, "http://example.com/stream?id=1\n")
+		}, http.StatusOK, "39", "#EXTM3U\nhttp://example.com/stream?id=1\n"},
+		{"ok - status kept", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unknown category", http.StatusNotFound)
+		}, http.StatusNotFound, "17", "unknown category\n"},
+		{"ok - nothing written", func(w http.ResponseWriter, r *http.Request) {}, http.StatusOK, "0", ""},
+		{"ok - own length kept", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "4")
+			if r.Method != http.MethodHead {
+				io.WriteString(w, "0123")
+			}
+		}, http.StatusOK, "4", "0123"},
+		{"ok - no length without a body", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotModified)
+		}, http.StatusNotModified, "", ""},
+		{"ok - too long to hold back", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, strings.Repeat("x", bufferedBodyMax))
+			io.WriteString(w, "y")
+		}, http.StatusOK, "", strings.Repeat("x", bufferedBodyMax) + "y"},
+		{"ok - flushed", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "data: 1\n\n")
+			http.NewResponseController(w).Flush()
+			io.WriteString(w, "data: 2\n\n")
+		}, http.StatusOK, "", "data: 1\n\ndata: 2\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := WithHEAD(tt.handler)
+			get, head := httptest.NewRecorder(), httptest.NewRecorder()
+			h.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/", nil))
+			h.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/", nil))
+
+			for _, rec := range []*httptest.ResponseRecorder{get, head} {
+				if rec.Code != tt.wantStatus || rec.Header().Get("Content-Length") != tt.wantLength {
+					t.Errorf("status %d with Content-Length %q, want %d with %q", rec.Code, rec.Header().Get("Content-Length"), tt.wantStatus, tt.wantLength)
+				}
+			}
+			if get.Body.String() != tt.wantBody {
+				t.Errorf("GET body = %.40q, want %.40q", get.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("ok - other methods untouched", func(t *testing.T) {
+		t.Parallel()
+
+		h := WithHEAD(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := w.(*lengthWriter); ok {
+				t.Error("POST went through the lengthWriter")
+			}
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	})
+
+	t.Run("ok - sendfile kept", func(t *testing.T) {
+		t.Parallel()
+
+		h := WithHEAD(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// what http.ServeContent does
+			w.Header().Set("Content-Length", "4")
+			w.WriteHeader(http.StatusOK)
+			io.Copy(w, io.LimitReader(strings.NewReader("0123456789"), 4))
+		}))
+		w := &readerFromWriter{ResponseRecorder: httptest.NewRecorder()}
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+		if w.readFrom != 1 || w.Body.String() != "0123" {
+			t.Errorf("ReadFrom called %d times, body %q, want once and %q", w.readFrom, w.Body.String(), "0123")
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"io"
 	"net/http"
 	"slices"
 )
@@ -24,6 +25,20 @@ func (r *statusRecorder) WriteHeader(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the connection through the recorder, e.g. to flush
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// ReadFrom keeps the io.ReaderFrom of the connection reachable: http.ServeContent copies files through it
+// and a TCP connection sends them with sendfile from there, without the bytes passing through Go
+func (r *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := r.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(r.ResponseWriter, src)
+}
+
 func wrapWriter(w http.ResponseWriter) *statusRecorder {
 	if recorder, ok := w.(*statusRecorder); ok {
 		return recorder
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readerFromWriter stands in for the server's response, which sends files with sendfile from ReadFrom
+type readerFromWriter struct {
+	*httptest.ResponseRecorder
+	readFrom int
+}
+
+func (w *readerFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.readFrom++
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+func TestStatusRecorderReadFrom(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// what http.ServeContent does with the file
+		io.Copy(w, io.LimitReader(strings.NewReader("0123456789"), 4))
+	}), WithRejections(&fakeRejections{}), WithLogging(logger))
+
+	w := &readerFromWriter{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	if w.readFrom != 1 {
+		t.Errorf("ReadFrom of the response called %d times through the middlewares, want 1", w.readFrom)
+	}
+	if got := w.Body.String(); got != "0123" {
+		t.Errorf("body = %q, want %q", got, "0123")
+	}
+
+	// a writer without ReadFrom still gets everything
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if got := rec.Body.String(); got != "0123" {
+		t.Errorf("body without ReadFrom = %q, want %q", got, "0123")
+	}
+}
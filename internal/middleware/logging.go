@@ -8,18 +8,9 @@ import (
 	"time"
 )
 
-type ActivityNotifier interface {
-	NotifyActivity()
-}
-
-func WithLogging(logger *slog.Logger, monitor ActivityNotifier) Middleware {
+func WithLogging(logger *slog.Logger) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// notifies the shutdown monitor activity
-			if monitor != nil {
-				monitor.NotifyActivity()
-			}
-
 			recorder := wrapWriter(w)
 
 			start := time.Now()
@@ -37,7 +28,7 @@ func WithLogging(logger *slog.Logger, monitor ActivityNotifier) Middleware {
 	}
 }
 
-func WithObservability() Middleware {
+func WithObservability(metrics *observability.Metrics) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -47,10 +38,10 @@ func WithObservability() Middleware {
 			next.ServeHTTP(recorder, r)
 			duration := time.Since(start).Seconds()
 
-			observability.RequestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+			metrics.RequestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
 
 			statusStr := strconv.Itoa(recorder.statusCode)
-			observability.RequestsTotal.WithLabelValues(r.Method, r.URL.Path, statusStr).Inc()
+			metrics.RequestsTotal.WithLabelValues(r.Method, r.URL.Path, statusStr).Inc()
 		})
 	}
 }
@@ -0,0 +1,25 @@
+package middleware
+
+import "net/http"
+
+// RejectionRecorder is told about the requests the server turned away
+type RejectionRecorder interface {
+	RecordRejection(r *http.Request, status int)
+}
+
+// WithRejections reports requests answered with 429 or 503, turned away by the rate limiter, a full IO
+// limiter, the serving window or a shutdown. Failed logins are left out, every browser tries without
+// credentials first
+func WithRejections(rec RejectionRecorder) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := wrapWriter(w)
+			next.ServeHTTP(recorder, r)
+
+			switch recorder.statusCode {
+			case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+				rec.RecordRejection(r, recorder.statusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeRejections struct{ statuses []int }
+
+func (f *fakeRejections) RecordRejection(r *http.Request, status int) {
+	f.statuses = append(f.statuses, status)
+}
+
+func TestWithRejections(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		status int
+		want   bool
+	}{
+		{"ok - rate limited", http.StatusTooManyRequests, true},
+		{"ok - busy", http.StatusServiceUnavailable, true},
+		{"ok - served", http.StatusOK, false},
+		{"ok - not found is no rejection", http.StatusNotFound, false},
+		{"ok - failed login is no rejection", http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := &fakeRejections{}
+			h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}), WithRejections(rec))
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+			if got := len(rec.statuses) == 1; got != tt.want {
+				t.Errorf("recorded %v, want recorded = %v", rec.statuses, tt.want)
+			}
+		})
+	}
+}
@@ -2,34 +2,138 @@ package observability
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-var (
+// Metrics holds every collector the server exposes. Collectors are registered against an injected
+// registry instead of the global default one, so several handlers (e.g. in tests) can coexist
+type Metrics struct {
 	// Counter: Total HTTP requests
-	RequestsTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "streamer_http_requests_total",
-			Help: "The total number of processed HTTP requests",
-		},
-		[]string{"method", "path", "status"},
-	)
+	RequestsTotal *prometheus.CounterVec
 
 	// Histogram: Response time
-	RequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "streamer_http_request_duration_seconds",
-			Help:    "The latency of the HTTP requests",
-			Buckets: prometheus.DefBuckets, // .005s to 10s
-		},
-		[]string{"method", "path"},
-	)
-
-	// Gauge: Active Streams (Goes up and down)
-	ActiveStreams = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "streamer_active_streams_current",
-			Help: "The current number of active media streams",
-		},
-	)
-)
+	RequestDuration *prometheus.HistogramVec
+
+	// Gauge: Active Streams (Goes up and down), by kind: "stream" for playback, "download" for /download
+	ActiveStreams *prometheus.GaugeVec
+
+	// Counter: recovered panics of background goroutines
+	ComponentPanics *prometheus.CounterVec
+
+	// Histogram: buffer sizes buffered resources pick, by reason ("open", "grow", "shrink", "sequential")
+	ReadBufferSize *prometheus.HistogramVec
+
+	// Gauges: size and free space of the filesystem every volume is on, and the bytes of its entries, as of
+	// its last scan
+	VolumeTotalBytes *prometheus.GaugeVec
+	VolumeFreeBytes  *prometheus.GaugeVec
+	LibraryBytes     *prometheus.GaugeVec
+
+	// Counter: files found gone (deleted, unplugged) while they were streamed, by volume
+	FilesGone *prometheus.CounterVec
+
+	// Counter: templates that failed to execute, by template name, the request got a 500
+	TemplateFailures *prometheus.CounterVec
+}
+
+// NewRegistry creates a private registry, optionally including the standard process and Go runtime collectors
+func NewRegistry(withRuntime bool) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+
+	if withRuntime {
+		reg.MustRegister(
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+			collectors.NewGoCollector(),
+		)
+	}
+	return reg
+}
+
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		RequestsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "streamer_http_requests_total",
+				Help: "The total number of processed HTTP requests",
+			},
+			[]string{"method", "path", "status"},
+		),
+
+		RequestDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "streamer_http_request_duration_seconds",
+				Help:    "The latency of the HTTP requests",
+				Buckets: prometheus.DefBuckets, // .005s to 10s
+			},
+			[]string{"method", "path"},
+		),
+
+		ActiveStreams: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "streamer_active_streams_current",
+				Help: "The current number of active media streams",
+			},
+			[]string{"kind"},
+		),
+
+		ComponentPanics: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "streamer_component_panics_total",
+				Help: "Panics recovered in background components (scanner, discovery, shutdown monitor, ...)",
+			},
+			[]string{"component"},
+		),
+
+		ReadBufferSize: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "streamer_read_buffer_bytes",
+				Help:    "The read buffer sizes picked by buffered resources, 0 when reads bypass the buffer",
+				Buckets: append([]float64{0}, prometheus.ExponentialBuckets(64<<10, 2, 9)...), // 64KB to 16MB
+			},
+			[]string{"reason"},
+		),
+
+		VolumeTotalBytes: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "streamer_volume_total_bytes",
+				Help: "The size of the filesystem a volume is on, as of its last scan",
+			},
+			[]string{"volume"},
+		),
+
+		VolumeFreeBytes: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "streamer_volume_free_bytes",
+				Help: "The free space on the filesystem a volume is on, as of its last scan",
+			},
+			[]string{"volume"},
+		),
+
+		LibraryBytes: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "streamer_library_bytes",
+				Help: "The bytes of the media entries on a volume, as of its last scan",
+			},
+			[]string{"volume"},
+		),
+
+		FilesGone: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "streamer_files_gone_total",
+				Help: "Files that turned out to be gone (deleted, unplugged) while they were streamed",
+			},
+			[]string{"volume"},
+		),
+
+		TemplateFailures: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "streamer_template_failures_total",
+				Help: "Templates that failed to execute, the request was answered with a 500",
+			},
+			[]string{"template"},
+		),
+	}
+}
@@ -0,0 +1,62 @@
+package observability
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewMetricsIsolatedRegistries(t *testing.T) {
+	t.Parallel()
+
+	// two sets of metrics must not panic on duplicate registration
+	first := NewMetrics(NewRegistry(false))
+	second := NewMetrics(NewRegistry(false))
+
+	first.ActiveStreams.WithLabelValues("stream").Inc()
+
+	if got := testutil.ToFloat64(first.ActiveStreams.WithLabelValues("stream")); got != 1 {
+		t.Errorf("first.ActiveStreams = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(second.ActiveStreams.WithLabelValues("stream")); got != 0 {
+		t.Errorf("second.ActiveStreams = %v, want 0", got)
+	}
+}
+
+func TestNewRegistryRuntimeCollectors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		withRuntime bool
+		wantGo      bool
+	}{
+		{"ok - runtime enabled", true, true},
+		{"ok - runtime disabled", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reg := NewRegistry(tt.withRuntime)
+			NewMetrics(reg)
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatalf("Gather() error = %v", err)
+			}
+
+			var hasGo bool
+			for _, mf := range families {
+				if mf.GetName() == "go_goroutines" {
+					hasGo = true
+				}
+			}
+
+			if hasGo != tt.wantGo {
+				t.Errorf("go_goroutines present = %v, want %v", hasGo, tt.wantGo)
+			}
+		})
+	}
+}
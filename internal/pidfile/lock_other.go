@@ -0,0 +1,15 @@
+//go:build (!unix && !windows) || solaris || aix
+
+package pidfile
+
+import (
+	"errors"
+	"os"
+)
+
+var errWouldBlock = errors.New("would block")
+
+// lock is a no-op where flock isn't available, the PID is still written
+func lock(f *os.File) error {
+	return nil
+}
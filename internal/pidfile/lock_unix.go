@@ -0,0 +1,20 @@
+//go:build unix && !solaris && !aix
+
+package pidfile
+
+import (
+	"os"
+	"syscall"
+)
+
+var errWouldBlock = syscall.EWOULDBLOCK
+
+// lock takes an exclusive flock, it belongs to the open file so the kernel drops it when the process dies
+func lock(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
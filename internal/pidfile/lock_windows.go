@@ -0,0 +1,20 @@
+//go:build windows
+
+package pidfile
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var errWouldBlock = windows.ERROR_LOCK_VIOLATION
+
+// lockOffset is far past the PID so the locked range never covers the bytes others read
+const lockOffset = 1 << 30
+
+// lock takes an exclusive lock on a single byte, Windows drops it when the process dies
+func lock(f *os.File) error {
+	ol := &windows.Overlapped{Offset: lockOffset}
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+}
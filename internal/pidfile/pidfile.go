@@ -0,0 +1,134 @@
+// Package pidfile keeps a second instance from running against the same PID file. The lock on the
+// file is what counts, a stale file left behind by a crash doesn't block anyone
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is matched by LockedError with errors.Is
+var ErrLocked = errors.New("pid file is locked by another process")
+
+// LockedError names the process holding the lock, PID is 0 when the file couldn't be read
+type LockedError struct {
+	Path string
+	PID  int
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("%s is locked by another instance", e.Path)
+	}
+	return fmt.Sprintf("another instance is already running (pid %d, %s)", e.PID, e.Path)
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// File is a held PID file, the lock lasts until Release or process exit
+type File struct {
+	path string
+	f    *os.File
+}
+
+// Acquire locks path, creating it if needed, and writes the current PID to it
+func Acquire(path string) (*File, error) {
+	// a releasing owner may delete the file between our open and lock, in that case start over
+	for range 3 {
+		f, err := lockFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if sameFile(f, path) {
+			if err := writePID(f); err != nil {
+				f.Close()
+				return nil, err
+			}
+			return &File{path: path, f: f}, nil
+		}
+		f.Close()
+	}
+	return nil, fmt.Errorf("lock pid file: %s keeps being replaced", path)
+}
+
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open pid file: %w", err)
+	}
+
+	if err := lock(f); err != nil {
+		pid := readPID(f)
+		f.Close()
+
+		if errors.Is(err, errWouldBlock) {
+			return nil, &LockedError{Path: path, PID: pid}
+		}
+		return nil, fmt.Errorf("lock pid file: %w", err)
+	}
+	return f, nil
+}
+
+// sameFile reports whether the locked file is still the one at path
+func sameFile(f *os.File, path string) bool {
+	locked, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(locked, current)
+}
+
+func writePID(f *os.File) error {
+	// whatever was there belongs to a process that no longer holds the lock
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("truncate pid file: %w", err)
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		return fmt.Errorf("write pid file: %w", err)
+	}
+	return nil
+}
+
+// Release removes the file and drops the lock
+func (p *File) Release() error {
+	var removeErr, closeErr error
+
+	if runtime.GOOS == "windows" {
+		// open files can't be removed there
+		closeErr = p.f.Close()
+		removeErr = os.Remove(p.path)
+	} else {
+		// removed while still locked, so nobody can lock the file we are about to delete
+		removeErr = os.Remove(p.path)
+		closeErr = p.f.Close()
+	}
+
+	if removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+		return fmt.Errorf("remove pid file: %w", removeErr)
+	}
+	return closeErr
+}
+
+func readPID(f *os.File) int {
+	buf, err := io.ReadAll(io.NewSectionReader(f, 0, 32))
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
@@ -0,0 +1,110 @@
+package pidfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAcquireWritesPID(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "streamer.pid")
+
+	p, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read pid file: %v", err)
+	}
+	if got, want := strings.TrimSpace(string(data)), strconv.Itoa(os.Getpid()); got != want {
+		t.Errorf("pid file contains %q, want %q", got, want)
+	}
+
+	if err := p.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("pid file still exists after Release, stat error = %v", err)
+	}
+}
+
+func TestAcquireWhileLocked(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "streamer.pid")
+
+	p, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer p.Release()
+
+	// the lock belongs to the open file, so a second open in the same process conflicts too
+	_, err = Acquire(path)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Acquire() error = %v, want %v", err, ErrLocked)
+	}
+
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("second Acquire() error is %T, want *LockedError", err)
+	}
+	if locked.PID != os.Getpid() {
+		t.Errorf("LockedError.PID = %d, want %d", locked.PID, os.Getpid())
+	}
+	if !strings.Contains(err.Error(), strconv.Itoa(os.Getpid())) {
+		t.Errorf("error %q does not name the other pid", err)
+	}
+}
+
+func TestAcquireStaleFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "streamer.pid")
+
+	// left behind by a crashed process, nobody holds the lock
+	if err := os.WriteFile(path, []byte("999999\nleftover"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire() over a stale file error = %v", err)
+	}
+	defer p.Release()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), strconv.Itoa(os.Getpid())+"\n"; got != want {
+		t.Errorf("pid file contains %q, want %q", got, want)
+	}
+}
+
+func TestAcquireAfterRelease(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "streamer.pid")
+
+	p, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if err := p.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	p, err = Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire() after Release error = %v", err)
+	}
+	p.Release()
+}
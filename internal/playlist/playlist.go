@@ -0,0 +1,112 @@
+// Package playlist keeps the playlists users put together from the library, e.g. a handful of titles for
+// a movie night, in the order they were picked
+package playlist
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// DefaultMax is how many playlists a store takes before it refuses new ones
+const DefaultMax = 100
+
+var (
+	ErrFull     = errors.New("too many playlists")
+	ErrNotFound = errors.New("playlist not found")
+)
+
+// Playlist is a named list of entries, the form the registry cache keeps them in
+type Playlist struct {
+	ID      uuid.UUID   `json:"id"`
+	Name    string      `json:"name"`
+	Entries []uuid.UUID `json:"entries"`
+	Created time.Time   `json:"created"`
+}
+
+// Store holds the playlists in memory, it is safe for concurrent use
+type Store struct {
+	Max int // new playlists are refused past this many, they are only dropped by deleting them
+
+	mu        sync.Mutex
+	playlists map[uuid.UUID]Playlist
+}
+
+func NewStore() *Store {
+	return &Store{
+		Max:       DefaultMax,
+		playlists: make(map[uuid.UUID]Playlist),
+	}
+}
+
+// Add stores a new playlist of entries under name
+func (s *Store) Add(name string, entries []uuid.UUID) (Playlist, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return Playlist{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Max > 0 && len(s.playlists) >= s.Max {
+		return Playlist{}, ErrFull
+	}
+	p := Playlist{ID: id, Name: name, Entries: slices.Clone(entries), Created: time.Now()}
+	s.playlists[id] = p
+	return p, nil
+}
+
+// Get returns the playlist with id, false when there is none
+func (s *Store) Get(id uuid.UUID) (Playlist, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.playlists[id]
+	return p, ok
+}
+
+// Delete removes the playlist with id
+func (s *Store) Delete(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.playlists[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.playlists, id)
+	return nil
+}
+
+// List returns every playlist, oldest first
+func (s *Store) List() []Playlist {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playlists := make([]Playlist, 0, len(s.playlists))
+	for _, p := range s.playlists {
+		playlists = append(playlists, p)
+	}
+	slices.SortFunc(playlists, func(a, b Playlist) int {
+		return cmp.Or(a.Created.Compare(b.Created), cmp.Compare(a.ID.String(), b.ID.String()))
+	})
+	return playlists
+}
+
+// Restore puts the playlists of a cache back, ones already there are kept. Entries the registry doesn't
+// know (yet) stay in, the volume they are on may just not be mounted
+func (s *Store) Restore(playlists []Playlist) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range playlists {
+		if _, ok := s.playlists[p.ID]; ok || p.ID.IsNil() {
+			continue
+		}
+		s.playlists[p.ID] = p
+	}
+}
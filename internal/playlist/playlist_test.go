@@ -0,0 +1,79 @@
+package playlist
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		s := NewStore()
+		s.Max = 2
+		a, b := uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7())
+
+		entries := []uuid.UUID{b, a}
+		night, err := s.Add("movie night", entries)
+		if err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+		// the caller's slice is not kept
+		entries[0] = uuid.Nil
+
+		time.Sleep(time.Second)
+		other, err := s.Add("other", []uuid.UUID{a})
+		if err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+		if _, err := s.Add("one too many", nil); !errors.Is(err, ErrFull) {
+			t.Errorf("Add() past Max error = %v, want ErrFull", err)
+		}
+
+		got, ok := s.Get(night.ID)
+		if !ok || got.Name != "movie night" || !slices.Equal(got.Entries, []uuid.UUID{b, a}) {
+			t.Errorf("Get() = %+v, %v, want the entries in the order given", got, ok)
+		}
+		if list := s.List(); len(list) != 2 || list[0].ID != night.ID || list[1].ID != other.ID {
+			t.Errorf("List() = %+v, want oldest first", list)
+		}
+
+		if err := s.Delete(night.ID); err != nil {
+			t.Errorf("Delete() error = %v", err)
+		}
+		if err := s.Delete(night.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete() twice error = %v, want ErrNotFound", err)
+		}
+		if _, ok := s.Get(night.ID); ok {
+			t.Error("deleted playlist still there")
+		}
+	})
+}
+
+func TestStoreRestore(t *testing.T) {
+	t.Parallel()
+
+	s := NewStore()
+	kept, err := s.Add("kept", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Restore([]Playlist{
+		{ID: kept.ID, Name: "from the cache"},
+		{ID: uuid.Must(uuid.NewV4()), Name: "restored"},
+		{Name: "no id"},
+	})
+
+	if got := s.List(); len(got) != 2 {
+		t.Fatalf("List() = %+v, want the kept and the restored playlist", got)
+	}
+	if got, _ := s.Get(kept.ID); got.Name != "kept" {
+		t.Errorf("Restore() replaced %q with %q", "kept", got.Name)
+	}
+}
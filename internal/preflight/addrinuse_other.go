@@ -0,0 +1,13 @@
+//go:build !windows
+
+package preflight
+
+import (
+	"errors"
+	"syscall"
+)
+
+// IsAddrInUse reports whether err means another socket holds the address
+func IsAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
@@ -0,0 +1,12 @@
+package preflight
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// IsAddrInUse reports whether err means another socket holds the address
+func IsAddrInUse(err error) bool {
+	return errors.Is(err, windows.WSAEADDRINUSE)
+}
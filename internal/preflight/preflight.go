@@ -0,0 +1,202 @@
+// Package preflight checks the environment before the server starts: ports, multicast, volume paths and
+// the advertised address. Every check runs, so all problems are reported at once with a hint each
+package preflight
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// Check is one environmental requirement. A failed Fatal check stops the startup, the others only
+// make the server report itself as not ready
+type Check struct {
+	Name  string
+	Fatal bool
+	Run   func() error
+}
+
+// Result is the outcome of a check, shown in the logs and on /readyz
+type Result struct {
+	Name  string `json:"name"`
+	Fatal bool   `json:"fatal,omitempty"`
+	Error string `json:"error,omitempty"`
+	Hint  string `json:"hint,omitempty"`
+}
+
+// OK reports whether the check passed
+func (r Result) OK() bool {
+	return r.Error == ""
+}
+
+// Report holds the results of all checks in the order they ran
+type Report []Result
+
+// Run runs every check, a failing one doesn't stop the rest
+func Run(checks []Check) Report {
+	report := make(Report, 0, len(checks))
+
+	for _, c := range checks {
+		res := Result{Name: c.Name, Fatal: c.Fatal}
+		if err := c.Run(); err != nil {
+			res.Error = err.Error()
+			res.Hint = hintOf(err)
+		}
+		report = append(report, res)
+	}
+	return report
+}
+
+// OK reports whether every check passed
+func (r Report) OK() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the checks that did not pass
+func (r Report) Failed() []Result {
+	var failed []Result
+	for _, res := range r {
+		if !res.OK() {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// Err joins the failed fatal checks, nil if the server can start
+func (r Report) Err() error {
+	var errs []error
+	for _, res := range r.Failed() {
+		if res.Fatal {
+			errs = append(errs, fmt.Errorf("%s: %s", res.Name, res.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hintedError carries a suggestion on how to fix the problem next to the error itself
+type hintedError struct {
+	err  error
+	hint string
+}
+
+func (e *hintedError) Error() string { return e.err.Error() }
+func (e *hintedError) Unwrap() error { return e.err }
+
+func withHint(err error, hint string) error {
+	return &hintedError{err: err, hint: hint}
+}
+
+func hintOf(err error) string {
+	var h *hintedError
+	if errors.As(err, &h) {
+		return h.hint
+	}
+	return ""
+}
+
+// Bindable checks a TCP address can be listened on, by binding it for a moment
+func Bindable(addr string) Check {
+	return Check{
+		Name:  "http port " + addr,
+		Fatal: true,
+		Run: func() error {
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				switch {
+				case IsAddrInUse(err):
+					return withHint(err, "another program is listening on this port, stop it or pick another one with -http.addr")
+				case errors.Is(err, syscall.EACCES):
+					return withHint(err, "ports below 1024 need root or CAP_NET_BIND_SERVICE, or use a port above 1024")
+				case errors.Is(err, syscall.EADDRNOTAVAIL):
+					return withHint(err, "the IP in -http.addr is not assigned to this machine")
+				}
+				return withHint(err, "check the -http.addr value")
+			}
+			return ln.Close()
+		},
+	}
+}
+
+// Multicast checks the SSDP multicast group can be joined, renderers won't find the server otherwise
+func Multicast(group string) Check {
+	return Check{
+		Name: "ssdp multicast " + group,
+		Run: func() error {
+			addr, err := net.ResolveUDPAddr("udp", group)
+			if err != nil {
+				return err
+			}
+			conn, err := net.ListenMulticastUDP("udp", nil, addr)
+			if err != nil {
+				if IsAddrInUse(err) {
+					return withHint(err, "another DLNA server (minidlna, Plex, ...) holds the SSDP port exclusively, stop it")
+				}
+				return withHint(err, "multicast looks blocked, check the firewall allows UDP 1900 and the interface has multicast enabled")
+			}
+			return conn.Close()
+		},
+	}
+}
+
+// Directory checks a volume path is a directory whose entries can be listed
+func Directory(path string) Check {
+	return Check{
+		Name: "volume " + path,
+		Run: func() error {
+			info, err := os.Stat(path)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return withHint(err, "the path does not exist, is the drive mounted?")
+				}
+				if errors.Is(err, os.ErrPermission) {
+					return withHint(err, "the server user may not access this path, check the permissions of its parents")
+				}
+				return err
+			}
+			if !info.IsDir() {
+				return withHint(fmt.Errorf("%s is not a directory", path), "mount a directory, not a single file")
+			}
+
+			dir, err := os.Open(path)
+			if err != nil {
+				return withHint(err, "the server user may not read this directory, check its permissions")
+			}
+			defer dir.Close()
+
+			if _, err := dir.ReadDir(1); err != nil && !errors.Is(err, io.EOF) {
+				return withHint(err, "the directory can't be listed, check its permissions")
+			}
+			return nil
+		},
+	}
+}
+
+// LocalAddress checks the advertised IP belongs to one of this machine's interfaces
+func LocalAddress(ip string) Check {
+	return Check{
+		Name: "advertised address " + ip,
+		Run: func() error {
+			want := net.ParseIP(ip)
+			if want == nil {
+				return fmt.Errorf("%q is not an IP address", ip)
+			}
+
+			addrs, err := net.InterfaceAddrs()
+			if err != nil {
+				return fmt.Errorf("list interface addresses: %w", err)
+			}
+
+			for _, a := range addrs {
+				if n, ok := a.(*net.IPNet); ok && n.IP.Equal(want) {
+					return nil
+				}
+			}
+			return withHint(fmt.Errorf("%s is not assigned to any interface", ip),
+				"renderers would be sent to an address that isn't ours, check the network setup or bind -http.addr to a local IP")
+		},
+	}
+}
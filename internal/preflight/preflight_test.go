@@ -0,0 +1,85 @@
+package preflight
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunReportsEverything(t *testing.T) {
+	t.Parallel()
+
+	boom := errors.New("boom")
+	report := Run([]Check{
+		{Name: "first", Fatal: true, Run: func() error { return withHint(boom, "fix it") }},
+		{Name: "second", Run: func() error { return nil }},
+		{Name: "third", Run: func() error { return boom }},
+	})
+
+	if len(report) != 3 {
+		t.Fatalf("got %d results, want 3", len(report))
+	}
+	if report.OK() {
+		t.Error("OK() = true with failed checks")
+	}
+	if got := len(report.Failed()); got != 2 {
+		t.Errorf("Failed() has %d results, want 2", got)
+	}
+	if report[0].Hint != "fix it" {
+		t.Errorf("hint = %q, want %q", report[0].Hint, "fix it")
+	}
+
+	// only the fatal failure stops the startup
+	err := report.Err()
+	if err == nil || err.Error() != "first: boom" {
+		t.Errorf("Err() = %v, want first: boom", err)
+	}
+}
+
+func TestChecks(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "movie.mp4")
+	if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { taken.Close() })
+
+	tests := []struct {
+		name     string
+		check    Check
+		wantErr  bool
+		wantHint bool
+	}{
+		{"ok - free port", Bindable("127.0.0.1:0"), false, false},
+		{"fail - port taken", Bindable(taken.Addr().String()), true, true},
+		{"ok - directory", Directory(dir), false, false},
+		{"fail - missing directory", Directory(filepath.Join(dir, "nope")), true, true},
+		{"fail - file instead of directory", Directory(file), true, true},
+		{"ok - loopback is local", LocalAddress("127.0.0.1"), false, false},
+		{"fail - foreign address", LocalAddress("192.0.2.1"), true, true},
+		{"fail - not an address", LocalAddress("server.lan"), true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			res := Run([]Check{tt.check})[0]
+			if res.OK() == tt.wantErr {
+				t.Fatalf("%s: error = %q, wantErr %v", res.Name, res.Error, tt.wantErr)
+			}
+			if (res.Hint != "") != tt.wantHint {
+				t.Errorf("%s: hint = %q, wantHint %v", res.Name, res.Hint, tt.wantHint)
+			}
+		})
+	}
+}
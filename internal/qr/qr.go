@@ -0,0 +1,225 @@
+// Package qr encodes short texts, like the URL of the web ui, as QR codes (byte mode, error correction
+// level M, versions 1 to 10, which is up to 213 bytes)
+package qr
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+// MaxLen is the longest text Encode takes
+const MaxLen = 213
+
+var ErrTooLong = errors.New("text too long for a qr code")
+
+// QuietZone is the light border around the code, in modules, scanners need it to find the code
+const QuietZone = 4
+
+// version is the block structure of a version at level M: its error correction codewords per block
+// and the data codewords of each block, the shorter blocks first
+type version struct {
+	ecPerBlock int
+	blocks     []int
+	alignment  []int // centre coordinates of the alignment patterns
+}
+
+var versions = []version{
+	1:  {10, []int{16}, nil},
+	2:  {16, []int{28}, []int{6, 18}},
+	3:  {26, []int{44}, []int{6, 22}},
+	4:  {18, []int{32, 32}, []int{6, 26}},
+	5:  {24, []int{43, 43}, []int{6, 30}},
+	6:  {16, []int{27, 27, 27, 27}, []int{6, 34}},
+	7:  {18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	8:  {22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	9:  {22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	10: {26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+func (v version) dataCodewords() int {
+	n := 0
+	for _, b := range v.blocks {
+		n += b
+	}
+	return n
+}
+
+// Code is an encoded QR code
+type Code struct {
+	Size     int      // modules per side, without the quiet zone
+	modules  [][]bool // [y][x], true is dark
+	function [][]bool // finder, timing, alignment and format modules, data and masks leave them alone
+}
+
+// Dark reports whether the module at x, y is dark, outside the code is the light quiet zone
+func (c *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+	return c.modules[y][x]
+}
+
+// Image draws the code with scale pixels per module, quiet zone included
+func (c *Code) Image(scale int) *image.Paletted {
+	scale = max(scale, 1)
+	side := (c.Size + 2*QuietZone) * scale
+
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := range side {
+		for x := range side {
+			if c.Dark(x/scale-QuietZone, y/scale-QuietZone) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img
+}
+
+// Encode picks the smallest version text fits in and the mask with the lowest penalty
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	if len(data) > MaxLen {
+		return nil, ErrTooLong
+	}
+
+	ver := 1
+	for ; ver < len(versions); ver++ {
+		if 4+countBits(ver)+8*len(data) <= 8*versions[ver].dataCodewords() {
+			break
+		}
+	}
+
+	codewords := addErrorCorrection(encodeData(data, ver), versions[ver])
+
+	c := newCode(ver)
+	c.placeData(codewords)
+
+	// the mask with the lowest penalty, each one is tried on the same code
+	best, bestPenalty := 0, -1
+	for mask := range 8 {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask) // masking twice undoes it
+	}
+	c.applyMask(best)
+	c.drawFormat(best)
+	return c, nil
+}
+
+// countBits is the length of the character count of byte mode
+func countBits(ver int) int {
+	if ver < 10 {
+		return 8
+	}
+	return 16
+}
+
+// encodeData turns data into the data codewords of ver: byte mode, count, data, terminator and padding
+func encodeData(data []byte, ver int) []byte {
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	bits.append(len(data), countBits(ver))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	capacity := 8 * versions[ver].dataCodewords()
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	return bits.bytes()
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, v>>i&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// addErrorCorrection splits the data into the blocks of ver, adds their error correction and interleaves
+// them the way the code is read: the i-th data codeword of every block, then the i-th ecc codeword
+func addErrorCorrection(data []byte, ver version) []byte {
+	divisor := rsDivisor(ver.ecPerBlock)
+
+	var blocks, eccs [][]byte
+	for _, n := range ver.blocks {
+		blocks = append(blocks, data[:n])
+		eccs = append(eccs, rsRemainder(data[:n], divisor))
+		data = data[n:]
+	}
+
+	var out []byte
+	for i := range ver.blocks[len(ver.blocks)-1] {
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := range ver.ecPerBlock {
+		for _, e := range eccs {
+			out = append(out, e[i])
+		}
+	}
+	return out
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMul(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x1D
+		z ^= (y >> i & 1) * x
+	}
+	return z
+}
+
+// rsDivisor is the Reed-Solomon generator polynomial of the degree, highest coefficient (always 1) left out
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	var root byte = 1
+	for range degree {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder is the error correction of data, the remainder of dividing it by divisor
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMul(d, factor)
+		}
+	}
+	return result
+}
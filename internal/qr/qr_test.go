@@ -0,0 +1,216 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	t.Parallel()
+
+	// "HELLO WORLD" at 1-M, the worked example of the thonky.com qr tutorial
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder() = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	t.Parallel()
+
+	// from the format and version information tables of the spec
+	if got := fmt.Sprintf("%015b", formatBits(0)); got != "101010000010010" {
+		t.Errorf("formatBits(0) = %s", got)
+	}
+	if got := fmt.Sprintf("%015b", formatBits(5)); got != "100000011001110" {
+		t.Errorf("formatBits(5) = %s", got)
+	}
+	if got := fmt.Sprintf("%018b", versionBits(7)); got != "000111110010010100" {
+		t.Errorf("versionBits(7) = %s", got)
+	}
+	if got := fmt.Sprintf("%018b", versionBits(10)); got != "001010010011010011" {
+		t.Errorf("versionBits(10) = %s", got)
+	}
+}
+
+func TestEncodeData(t *testing.T) {
+	t.Parallel()
+
+	// byte mode, 2 bytes, terminator, then the pad bytes
+	want := []byte{0x40, 0x26, 0x86, 0x90, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	if got := encodeData([]byte("hi"), 1); !bytes.Equal(got, want) {
+		t.Errorf("encodeData() = % x, want % x", got, want)
+	}
+}
+
+// decode reads a code back the way a scanner does once it found the finders
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+
+	ver := (c.Size - 17) / 4
+
+	// the first copy of the format information tells the mask
+	var bits int
+	for i := range 6 {
+		bits |= b2i(c.Dark(8, i)) << i
+	}
+	bits |= b2i(c.Dark(8, 7))<<6 | b2i(c.Dark(8, 8))<<7 | b2i(c.Dark(7, 8))<<8
+	for i := 9; i < 15; i++ {
+		bits |= b2i(c.Dark(14-i, 8)) << i
+	}
+	mask := -1
+	for m := range 8 {
+		if formatBits(m) == bits {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("format bits %015b are not level M", bits)
+	}
+
+	// unmask a copy and read the codewords in placement order
+	plain := newCode(ver)
+	for y := range c.Size {
+		for x := range c.Size {
+			if !plain.function[y][x] {
+				plain.modules[y][x] = c.modules[y][x]
+			}
+		}
+	}
+	plain.applyMask(mask)
+
+	total := versions[ver].dataCodewords() + versions[ver].ecPerBlock*len(versions[ver].blocks)
+	codewords := make([]byte, total)
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range c.Size {
+			y := vert
+			if (right+1)&2 == 0 {
+				y = c.Size - 1 - vert
+			}
+			for j := range 2 {
+				if x := right - j; !plain.function[y][x] && i < total*8 {
+					codewords[i/8] |= byte(b2i(plain.modules[y][x])) << (7 - i%8)
+					i++
+				}
+			}
+		}
+	}
+
+	// undo the interleaving and check every block against its error correction
+	blocks := versions[ver].blocks
+	data := make([][]byte, len(blocks))
+	k := 0
+	for i := range blocks[len(blocks)-1] {
+		for b, n := range blocks {
+			if i < n {
+				data[b] = append(data[b], codewords[k])
+				k++
+			}
+		}
+	}
+	ecc := make([][]byte, len(blocks))
+	for range versions[ver].ecPerBlock {
+		for b := range blocks {
+			ecc[b] = append(ecc[b], codewords[k])
+			k++
+		}
+	}
+	var stream []byte
+	for b := range blocks {
+		if want := rsRemainder(data[b], rsDivisor(versions[ver].ecPerBlock)); !bytes.Equal(ecc[b], want) {
+			t.Fatalf("block %d error correction does not match its data", b)
+		}
+		stream = append(stream, data[b]...)
+	}
+
+	// mode and count are 12 bits up to version 9, 20 from 10 on
+	if stream[0]>>4 != 0b0100 {
+		t.Fatalf("mode = %04b, want byte mode", stream[0]>>4)
+	}
+	var n, start int
+	if ver < 10 {
+		n, start = int(stream[0]&0xF)<<4|int(stream[1]>>4), 12
+	} else {
+		n, start = int(stream[0]&0xF)<<12|int(stream[1])<<4|int(stream[2]>>4), 20
+	}
+	out := make([]byte, n)
+	for i := range out {
+		bit := start + 8*i
+		out[i] = stream[bit/8]<<(bit%8) | stream[bit/8+1]>>(8-bit%8)
+	}
+	return string(out)
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		text     string
+		wantSize int
+		wantErr  error
+	}{
+		{"ok - short", "hi", 21, nil},
+		{"ok - web ui", "http://192.168.1.20:8080/", 25, nil},
+		{"ok - fills version 1", strings.Repeat("a", 14), 21, nil},
+		{"ok - version 2", strings.Repeat("a", 15), 25, nil},
+		{"ok - version info", strings.Repeat("b", 110), 45, nil},
+		{"ok - long count", strings.Repeat("c", 200), 57, nil},
+		{"ok - longest", strings.Repeat("d", MaxLen), 57, nil},
+		{"fail - too long", strings.Repeat("e", MaxLen+1), 0, ErrTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := Encode(tt.text)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Encode() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if c.Size != tt.wantSize {
+				t.Errorf("Size = %d, want %d", c.Size, tt.wantSize)
+			}
+			if got := decode(t, c); got != tt.text {
+				t.Errorf("decoded %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestImage(t *testing.T) {
+	t.Parallel()
+
+	c, err := Encode("hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := c.Image(3)
+
+	if got, want := img.Bounds().Dx(), (21+2*QuietZone)*3; got != want {
+		t.Fatalf("image is %d pixels wide, want %d", got, want)
+	}
+	// quiet zone, then the corner of the top left finder
+	if img.ColorIndexAt(0, 0) != 0 || img.ColorIndexAt(QuietZone*3, QuietZone*3) != 1 {
+		t.Error("quiet zone or finder missing")
+	}
+}
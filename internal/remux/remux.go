@@ -0,0 +1,56 @@
+// Package remux copies the streams of a container into fragmented MP4 on the fly, for renderers that play
+// the codecs inside but refuse the container, e.g. MKV. The output is written as ffmpeg produces it, so its
+// length isn't known up front and it can't be seeked in
+package remux
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// how long a killed ffmpeg gets to let go of its output before Remux stops waiting for it
+const waitDelay = 2 * time.Second
+
+// Remuxer writes input remuxed to w. It returns once it is done, writing failed or ctx is cancelled
+type Remuxer func(ctx context.Context, input string, w io.Writer) error
+
+// FFmpeg remuxes with the ffmpeg binary at path, killed as soon as ctx is cancelled, e.g. by the client
+// going away
+func FFmpeg(path string) Remuxer {
+	return func(ctx context.Context, input string, w io.Writer) error {
+		cmd := exec.CommandContext(ctx, path, ffmpegArgs(input)...)
+		cmd.Stdout = w
+		cmd.WaitDelay = waitDelay
+
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			// killed because the client went away
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+}
+
+func ffmpegArgs(input string) []string {
+	return []string{
+		"-nostdin", "-hide_banner", "-loglevel", "error",
+		"-i", input,
+		// first video and audio track, a missing audio track is fine
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-c", "copy",
+		// no seeking back to write the index at the end, a pipe can't
+		"-movflags", "frag_keyframe+empty_moov",
+		"-f", "mp4",
+		"pipe:1",
+	}
+}
@@ -0,0 +1,97 @@
+//go:build unix
+
+package remux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// stubFFmpeg writes a shell script standing in for ffmpeg, it ignores the arguments
+func stubFFmpeg(t *testing.T, script string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFFmpeg(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		script  string
+		want    string
+		wantErr string
+	}{
+		{"ok - output passed on", "printf 'ftyp'; printf 'moof'\n", "ftypmoof", ""},
+		{"fail - exit status with stderr", "printf 'ftyp'; echo 'Invalid data found' >&2; exit 1\n", "ftyp", "Invalid data found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			err := FFmpeg(stubFFmpeg(t, tt.script))(t.Context(), "Heat.mkv", &out)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Remux() error = %v, want %q", err, tt.wantErr)
+			}
+			if out.String() != tt.want {
+				t.Errorf("Remux() wrote %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// cancelOnWrite cancels once the first bytes arrived, a client hanging up mid stream
+type cancelOnWrite struct {
+	cancel context.CancelFunc
+}
+
+func (c cancelOnWrite) Write(p []byte) (int, error) {
+	c.cancel()
+	return len(p), nil
+}
+
+func TestFFmpegKilledOnCancel(t *testing.T) {
+	t.Parallel()
+
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	path := stubFFmpeg(t, "echo $$ > "+pidFile+"\nprintf 'ftyp'\nexec sleep 60\n")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	start := time.Now()
+	err := FFmpeg(path)(ctx, "Heat.mkv", cancelOnWrite{cancel})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Remux() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > waitDelay+time.Second {
+		t.Errorf("Remux() returned after %v, want it killed at once", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Errorf("process %d still there after Remux() returned: %v", pid, err)
+	}
+}
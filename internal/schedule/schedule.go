@@ -0,0 +1,231 @@
+// Package schedule works out whether a point in time falls into a set of weekly time windows, e.g.
+// "mon-fri 17:00-23:30". Windows are wall clock times, so they follow DST changes of their location
+package schedule
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// Window is a daily time range on some weekdays. End at or before Start means the window runs past
+// midnight, it then belongs to the day it opens on
+type Window struct {
+	Days  [7]bool       // indexed by time.Weekday
+	Start time.Duration // wall clock offset from midnight
+	End   time.Duration // wall clock offset from midnight, up to 24h
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseWindow reads "[days] HH:MM-HH:MM". Days are a comma separated list of names or ranges like
+// "mon-fri" or "fri-sun", without them the window applies every day
+func ParseWindow(s string) (Window, error) {
+	fields := strings.Fields(strings.ToLower(s))
+
+	var w Window
+	var times string
+
+	switch len(fields) {
+	case 1:
+		for d := range w.Days {
+			w.Days[d] = true
+		}
+		times = fields[0]
+	case 2:
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return Window{}, err
+		}
+		w.Days = days
+		times = fields[1]
+	default:
+		return Window{}, fmt.Errorf("invalid window %q, expected '[days] HH:MM-HH:MM'", s)
+	}
+
+	startStr, endStr, ok := strings.Cut(times, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid time range %q, expected HH:MM-HH:MM", times)
+	}
+
+	start, err := parseClock(startStr)
+	if err != nil {
+		return Window{}, err
+	}
+	if start == day {
+		return Window{}, fmt.Errorf("window cannot start at 24:00")
+	}
+
+	end, err := parseClock(endStr)
+	if err != nil {
+		return Window{}, err
+	}
+	if start == end {
+		return Window{}, fmt.Errorf("window %q is empty", times)
+	}
+
+	w.Start, w.End = start, end
+	return w, nil
+}
+
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+
+	for part := range strings.SplitSeq(s, ",") {
+		fromStr, toStr, isRange := strings.Cut(part, "-")
+
+		from, ok := weekdays[fromStr]
+		if !ok {
+			return days, fmt.Errorf("unknown day %q (expected mon, tue, ..., sun)", fromStr)
+		}
+		if !isRange {
+			days[from] = true
+			continue
+		}
+
+		to, ok := weekdays[toStr]
+		if !ok {
+			return days, fmt.Errorf("unknown day %q (expected mon, tue, ..., sun)", toStr)
+		}
+
+		// ranges may wrap around the end of the week, e.g. fri-mon
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock reads HH:MM into an offset from midnight, 24:00 is allowed for the end of the day
+func parseClock(s string) (time.Duration, error) {
+	hourStr, minStr, ok := strings.Cut(s, ":")
+	if !ok || len(minStr) != 2 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+
+	hour, err := strconv.Atoi(hourStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: %w", s, err)
+	}
+	minute, err := strconv.Atoi(minStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: %w", s, err)
+	}
+
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q, out of range", s)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// String formats the window the way ParseWindow reads it
+func (w Window) String() string {
+	var days []string
+	all := true
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if w.Days[d] {
+			days = append(days, strings.ToLower(d.String()[:3]))
+		} else {
+			all = false
+		}
+	}
+
+	times := formatClock(w.Start) + "-" + formatClock(w.End)
+	if all {
+		return times
+	}
+	return strings.Join(days, ",") + " " + times
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+// Schedule is a set of windows in a location, nil Location means local time
+type Schedule struct {
+	Windows  []Window
+	Location *time.Location
+}
+
+func (s Schedule) location() *time.Location {
+	if s.Location == nil {
+		return time.Local
+	}
+	return s.Location
+}
+
+// at is the instant the wall clock in loc shows offset on the given date
+func at(year int, month time.Month, date int, offset time.Duration, loc *time.Location) time.Time {
+	return time.Date(year, month, date, int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, loc)
+}
+
+// spans calls fn with the opening and closing instant of every window opening on the days from the
+// given date offsets around t
+func (s Schedule) spans(t time.Time, fromDay, toDay int, fn func(start, end time.Time)) {
+	lt := t.In(s.location())
+	y, m, d := lt.Date()
+
+	for offset := fromDay; offset <= toDay; offset++ {
+		// time.Date normalizes the overflowing day of month
+		weekday := time.Date(y, m, d+offset, 12, 0, 0, 0, lt.Location()).Weekday()
+
+		for _, w := range s.Windows {
+			if !w.Days[weekday] {
+				continue
+			}
+
+			start := at(y, m, d+offset, w.Start, lt.Location())
+			end := at(y, m, d+offset, w.End, lt.Location())
+			if w.End <= w.Start {
+				end = at(y, m, d+offset+1, w.End, lt.Location())
+			}
+			fn(start, end)
+		}
+	}
+}
+
+// Open reports whether t falls into one of the windows
+func (s Schedule) Open(t time.Time) bool {
+	open := false
+	// a window opening yesterday may still be running past midnight
+	s.spans(t, -1, 0, func(start, end time.Time) {
+		if !t.Before(start) && t.Before(end) {
+			open = true
+		}
+	})
+	return open
+}
+
+// NextChange returns when Open flips next after t, zero if it never does (no windows, or always open)
+func (s Schedule) NextChange(t time.Time) time.Time {
+	var edges []time.Time
+	// a bit over a week covers every window at least once
+	s.spans(t, -1, 8, func(start, end time.Time) {
+		edges = append(edges, start, end)
+	})
+	slices.SortFunc(edges, time.Time.Compare)
+
+	// back to back windows leave edges where nothing changes, skip those
+	open := s.Open(t)
+	for _, edge := range edges {
+		if edge.After(t) && s.Open(edge) != open {
+			return edge
+		}
+	}
+	return time.Time{}
+}
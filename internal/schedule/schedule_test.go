@@ -0,0 +1,161 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, s string) Window {
+	t.Helper()
+	w, err := ParseWindow(s)
+	if err != nil {
+		t.Fatalf("ParseWindow(%q) error = %v", s, err)
+	}
+	return w
+}
+
+func TestParseWindow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string // formatted back, empty when an error is expected
+		wantErr bool
+	}{
+		{"ok - every day", "17:00-23:30", "17:00-23:30", false},
+		{"ok - weekdays", "mon-fri 17:00-23:30", "mon,tue,wed,thu,fri 17:00-23:30", false},
+		{"ok - list and case", "Sat,SUN 10:00-24:00", "sun,sat 10:00-24:00", false},
+		{"ok - range wrapping the week", "fri-mon 20:00-02:00", "sun,mon,fri,sat 20:00-02:00", false},
+		{"ok - full week range is every day", "mon-sun 08:00-09:00", "08:00-09:00", false},
+		{"fail - no range", "17:00", "", true},
+		{"fail - unknown day", "monday 17:00-18:00", "", true},
+		{"fail - bad range end", "mon-xyz 17:00-18:00", "", true},
+		{"fail - hour out of range", "25:00-26:00", "", true},
+		{"fail - minute out of range", "17:60-18:00", "", true},
+		{"fail - single digit minute", "17:0-18:00", "", true},
+		{"fail - start at 24:00", "24:00-01:00", "", true},
+		{"fail - empty window", "mon 10:00-10:00", "", true},
+		{"fail - too many fields", "mon 10:00 11:00", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseWindow(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWindow(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("ParseWindow(%q) = %q, want %q", tt.input, got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleOpen(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("test", 2*60*60)
+	s := Schedule{
+		Windows: []Window{
+			mustParse(t, "mon-fri 17:00-23:30"),
+			mustParse(t, "fri 23:30-02:00"), // back to back with friday's first window
+		},
+		Location: loc,
+	}
+
+	// 2026-03-13 is a friday
+	date := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{"ok - before opening", date(12, 16, 59), false},
+		{"ok - opening minute", date(12, 17, 0), true},
+		{"ok - closing minute is closed", date(12, 23, 30), false},
+		{"ok - thursday past midnight", date(13, 0, 30), false},
+		{"ok - friday late", date(13, 23, 45), true},
+		{"ok - saturday early from friday's window", date(14, 1, 59), true},
+		{"ok - saturday after friday's window", date(14, 2, 0), false},
+		{"ok - saturday evening", date(14, 18, 0), false},
+		{"ok - other location same instant", date(12, 17, 0).In(time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := s.Open(tt.t); got != tt.want {
+				t.Errorf("Open(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleNextChange(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("test", -5*60*60)
+	date := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, loc)
+	}
+
+	weekdays := Schedule{
+		Windows: []Window{
+			mustParse(t, "mon-fri 17:00-23:30"),
+			mustParse(t, "fri 23:30-02:00"),
+		},
+		Location: loc,
+	}
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		t        time.Time
+		want     time.Time
+	}{
+		{"ok - opens later today", weekdays, date(3, 12, 9, 0), date(3, 12, 17, 0)},
+		{"ok - closes tonight", weekdays, date(3, 12, 20, 0), date(3, 12, 23, 30)},
+		{"ok - friday windows merge past midnight", weekdays, date(3, 13, 20, 0), date(3, 14, 2, 0)},
+		{"ok - weekend skipped", weekdays, date(3, 14, 2, 0), date(3, 16, 17, 0)},
+		{"ok - on an edge the next one counts", weekdays, date(3, 12, 17, 0), date(3, 12, 23, 30)},
+		{"ok - no windows never changes", Schedule{Location: loc}, date(3, 12, 9, 0), time.Time{}},
+		{"ok - always open never changes", Schedule{Windows: []Window{mustParse(t, "00:00-24:00")}, Location: loc}, date(3, 12, 9, 0), time.Time{}},
+		{"ok - end of month", weekdays, date(3, 31, 23, 45), date(4, 1, 17, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.schedule.NextChange(tt.t); !got.Equal(tt.want) {
+				t.Errorf("NextChange(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleDST(t *testing.T) {
+	t.Parallel()
+
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no tz database: %v", err)
+	}
+
+	// clocks go from 02:00 to 03:00 on 2026-03-29, the window is still 22:00-06:00 on the wall clock
+	s := Schedule{Windows: []Window{mustParse(t, "22:00-06:00")}, Location: loc}
+
+	start := time.Date(2026, 3, 28, 22, 0, 0, 0, loc)
+	next := s.NextChange(start.Add(time.Minute))
+	if want := time.Date(2026, 3, 29, 6, 0, 0, 0, loc); !next.Equal(want) {
+		t.Fatalf("NextChange() = %v, want %v", next, want)
+	}
+	if got := next.Sub(start); got != 7*time.Hour {
+		t.Errorf("window lasted %v, want 7h on the night the clocks go forward", got)
+	}
+}
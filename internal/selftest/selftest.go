@@ -0,0 +1,419 @@
+// Package selftest checks a running server the way a renderer finds it and plays from it: an SSDP search,
+// the device description, a Browse and a ranged stream. The -selftest mode runs it against the server
+// itself, the integration tests against the app they boot
+package selftest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// the steps, in the order Run takes them
+const (
+	StepSearch      = "ssdp search"
+	StepDescription = "device description"
+	StepBrowse      = "browse"
+	StepStream      = "ranged stream"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+	mediaServerST  = "urn:schemas-upnp-org:device:MediaServer:1"
+	contentDirType = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	browseDepth    = 3  // containers Browse walks into looking for a video
+	rangeLength    = 16 // bytes the stream step asks for
+)
+
+// libraryFiles are the videos Library writes
+var libraryFiles = []string{"Selftest/Big Buck.mp4", "Selftest/Sintel.mp4", "Selftest/Tears of Steel.mp4"}
+
+// Library writes a few small but well formed MP4 files to dir for the server to scan and returns their
+// paths in it
+func Library(dir string) ([]string, error) {
+	for _, name := range libraryFiles {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("write library: %w", err)
+		}
+		if err := os.WriteFile(path, mp4Stub(), 0o644); err != nil {
+			return nil, fmt.Errorf("write library: %w", err)
+		}
+	}
+	return libraryFiles, nil
+}
+
+// mp4Stub is an MP4 without tracks: an ftyp box, a moov holding only the movie header and some media data
+func mp4Stub() []byte {
+	box := func(typ string, payload ...[]byte) []byte {
+		body := bytes.Join(payload, nil)
+		b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+		return append(append(b, typ...), body...)
+	}
+	u32 := func(v ...uint32) []byte {
+		var b []byte
+		for _, x := range v {
+			b = binary.BigEndian.AppendUint32(b, x)
+		}
+		return b
+	}
+
+	ftyp := box("ftyp", []byte("isom"), u32(0x200), []byte("isomiso2mp41"))
+	mvhd := box("mvhd",
+		u32(0, 0, 0, 1000, 0), // version and flags, creation and modification time, timescale, duration
+		u32(0x00010000),       // rate 1.0
+		[]byte{0x01, 0x00},    // volume 1.0
+		make([]byte, 10),      // reserved
+		u32(0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000), // unity matrix
+		make([]byte, 24), // pre-defined
+		u32(1),           // next track id
+	)
+	mdat := box("mdat", bytes.Repeat([]byte("selftest"), 512))
+	return bytes.Join([][]byte{ftyp, box("moov", mvhd), mdat}, nil)
+}
+
+// Checker runs the steps against one server
+type Checker struct {
+	BaseURL string        // the server, e.g. http://192.168.1.10:8080, for description.xml when there is no search
+	UUID    string        // the UDN the server announces, "uuid:..."
+	SSDP    string        // host:port the M-SEARCH goes to, empty skips the search
+	Client  *http.Client  // nil uses one timing out after Timeout
+	Timeout time.Duration // per step, 0 is 5s
+}
+
+// Result is how a step went, Detail says what it found or why it was skipped
+type Result struct {
+	Step    string
+	Err     error
+	Skipped bool
+	Detail  string
+	Took    time.Duration
+}
+
+// Report holds the results of the steps in the order they ran
+type Report []Result
+
+// OK reports whether no step failed
+func (r Report) OK() bool {
+	return r.Err() == nil
+}
+
+// Err joins the failed steps, nil when they all passed or were skipped
+func (r Report) Err() error {
+	var errs []error
+	for _, res := range r {
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.Step, res.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Print writes a line per step to w
+func (r Report) Print(w io.Writer) {
+	for _, res := range r {
+		status, detail := "PASS", res.Detail
+		switch {
+		case res.Err != nil:
+			status, detail = "FAIL", res.Err.Error()
+		case res.Skipped:
+			status = "SKIP"
+		}
+		fmt.Fprintf(w, "%-4s  %-18s  %6s  %s\n", status, res.Step, res.Took.Round(time.Millisecond), detail)
+	}
+	if r.OK() {
+		fmt.Fprintln(w, "selftest passed")
+	} else {
+		fmt.Fprintln(w, "selftest failed")
+	}
+}
+
+// Run takes every step, one that depends on a failed step is skipped
+func (c *Checker) Run(ctx context.Context) Report {
+	var report Report
+	failed := ""
+	step := func(name string, run func(ctx context.Context) (string, error)) {
+		if failed != "" {
+			report = append(report, Result{Step: name, Skipped: true, Detail: "after " + failed + " failed"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, c.timeout())
+		defer cancel()
+
+		start := time.Now()
+		detail, err := run(ctx)
+		report = append(report, Result{Step: name, Err: err, Detail: detail, Took: time.Since(start)})
+		if err != nil {
+			failed = name
+		}
+	}
+
+	location := strings.TrimSuffix(c.BaseURL, "/") + "/description.xml"
+	if c.SSDP == "" {
+		report = append(report, Result{Step: StepSearch, Skipped: true, Detail: "no ssdp address"})
+	} else {
+		step(StepSearch, func(ctx context.Context) (string, error) {
+			found, err := c.Search(ctx)
+			if err != nil {
+				return "", err
+			}
+			location = found
+			return "found at " + found, nil
+		})
+	}
+
+	var controlURL string
+	step(StepDescription, func(ctx context.Context) (string, error) {
+		name, control, err := c.Description(ctx, location)
+		if err != nil {
+			return "", err
+		}
+		controlURL = control
+		return fmt.Sprintf("%q, control at %s", name, control), nil
+	})
+
+	var item Item
+	step(StepBrowse, func(ctx context.Context) (string, error) {
+		found, err := c.Browse(ctx, controlURL)
+		if err != nil {
+			return "", err
+		}
+		item = found
+		return fmt.Sprintf("%q in %s", item.Title, item.ParentID), nil
+	})
+
+	step(StepStream, func(ctx context.Context) (string, error) {
+		return c.Stream(ctx, item.URL)
+	})
+	return report
+}
+
+func (c *Checker) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return c.Timeout
+}
+
+func (c *Checker) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return &http.Client{Timeout: c.timeout()}
+}
+
+// Search sends an M-SEARCH for media servers to c.SSDP and returns the LOCATION of the answer carrying
+// c.UUID, answers of other servers on the network are passed over
+func (c *Checker) Search(ctx context.Context) (string, error) {
+	dst, err := net.ResolveUDPAddr("udp4", c.SSDP)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", c.SSDP, err)
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return "", fmt.Errorf("listen: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	msg := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + c.SSDP + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: " + mediaServerST + "\r\n" +
+		"\r\n"
+	// UDP gets lost, a second search is what renderers send too
+	for range 2 {
+		if _, err := conn.WriteToUDP([]byte(msg), dst); err != nil {
+			return "", fmt.Errorf("send M-SEARCH: %w", err)
+		}
+	}
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", fmt.Errorf("no answer carrying %s: %w", c.UUID, ctx.Err())
+			}
+			return "", fmt.Errorf("read answer: %w", err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if strings.HasPrefix(resp.Header.Get("USN"), c.UUID) && resp.Header.Get("LOCATION") != "" {
+			return resp.Header.Get("LOCATION"), nil
+		}
+	}
+}
+
+// Description fetches the device description at location, checks it is c.UUID's and returns the friendly
+// name and the ContentDirectory control URL
+func (c *Checker) Description(ctx context.Context, location string) (name, controlURL string, err error) {
+	body, err := c.do(ctx, http.MethodGet, location, nil, nil, http.StatusOK)
+	if err != nil {
+		return "", "", err
+	}
+
+	var desc struct {
+		Device struct {
+			FriendlyName string `xml:"friendlyName"`
+			UDN          string `xml:"UDN"`
+			Services     []struct {
+				Type       string `xml:"serviceType"`
+				ControlURL string `xml:"controlURL"`
+			} `xml:"serviceList>service"`
+		} `xml:"device"`
+	}
+	if err := xml.Unmarshal(body, &desc); err != nil {
+		return "", "", fmt.Errorf("parse %s: %w", location, err)
+	}
+	if desc.Device.UDN != c.UUID {
+		return "", "", fmt.Errorf("UDN is %q, want %q", desc.Device.UDN, c.UUID)
+	}
+	for _, s := range desc.Device.Services {
+		if s.Type == contentDirType && s.ControlURL != "" {
+			return desc.Device.FriendlyName, s.ControlURL, nil
+		}
+	}
+	return "", "", fmt.Errorf("no ContentDirectory in %s", location)
+}
+
+// Item is a video a Browse returned
+type Item struct {
+	Title    string
+	ParentID string
+	URL      string
+}
+
+// Browse lists the root at controlURL and walks into its first containers until it finds a video
+func (c *Checker) Browse(ctx context.Context, controlURL string) (Item, error) {
+	id := "0"
+	for range browseDepth {
+		didl, err := c.browse(ctx, controlURL, id)
+		if err != nil {
+			return Item{}, err
+		}
+		for _, i := range didl.Items {
+			if i.Res != "" {
+				return Item{Title: i.Title, ParentID: i.ParentID, URL: i.Res}, nil
+			}
+		}
+		if len(didl.Containers) == 0 {
+			break
+		}
+		id = didl.Containers[0].ID
+	}
+	return Item{}, errors.New("no video found, is the library empty?")
+}
+
+type didlLite struct {
+	Containers []struct {
+		ID string `xml:"id,attr"`
+	} `xml:"container"`
+	Items []struct {
+		ParentID string `xml:"parentID,attr"`
+		Title    string `xml:"title"`
+		Res      string `xml:"res"`
+	} `xml:"item"`
+}
+
+// browse asks for the direct children of id
+func (c *Checker) browse(ctx context.Context, controlURL, id string) (didlLite, error) {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(id))
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:Browse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">
+<ObjectID>` + escaped.String() + `</ObjectID><BrowseFlag>BrowseDirectChildren</BrowseFlag><Filter>*</Filter>
+<StartingIndex>0</StartingIndex><RequestedCount>20</RequestedCount><SortCriteria></SortCriteria>
+</u:Browse></s:Body></s:Envelope>`
+	header := http.Header{}
+	header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#Browse"`)
+	resp, err := c.do(ctx, http.MethodPost, controlURL, strings.NewReader(body), header, http.StatusOK)
+	if err != nil {
+		return didlLite{}, fmt.Errorf("browse %s: %w", id, err)
+	}
+
+	var envelope struct {
+		Result string `xml:"Body>BrowseResponse>Result"`
+	}
+	if err := xml.Unmarshal(resp, &envelope); err != nil {
+		return didlLite{}, fmt.Errorf("browse %s: parse response: %w", id, err)
+	}
+	var didl didlLite
+	if err := xml.Unmarshal([]byte(envelope.Result), &didl); err != nil {
+		return didlLite{}, fmt.Errorf("browse %s: parse DIDL: %w", id, err)
+	}
+	return didl, nil
+}
+
+// Stream asks url for its first bytes the way renderers seek, and checks they come back as a partial
+// response
+func (c *Checker) Stream(ctx context.Context, url string) (string, error) {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=0-%d", rangeLength-1))
+	body, err := c.doResponse(ctx, http.MethodGet, url, nil, header, http.StatusPartialContent, func(resp *http.Response) error {
+		if want := fmt.Sprintf("bytes 0-%d/", rangeLength-1); !strings.HasPrefix(resp.Header.Get("Content-Range"), want) {
+			return fmt.Errorf("Content-Range is %q, want %s...", resp.Header.Get("Content-Range"), want)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(body) != rangeLength {
+		return "", fmt.Errorf("got %d bytes, want %d", len(body), rangeLength)
+	}
+	return fmt.Sprintf("%d bytes from %s", len(body), url), nil
+}
+
+// do sends a request and returns the body of a want answer
+func (c *Checker) do(ctx context.Context, method, url string, body io.Reader, header http.Header, want int) ([]byte, error) {
+	return c.doResponse(ctx, method, url, body, header, want, nil)
+}
+
+// doResponse is do, check looks at the response before its body is read
+func (c *Checker) doResponse(ctx context.Context, method, url string, body io.Reader, header http.Header, want int, check func(*http.Response) error) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		return nil, fmt.Errorf("%s %s: status %s, want %d", method, url, resp.Status, want)
+	}
+	if check != nil {
+		if err := check(resp); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", method, url, err)
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: read body: %w", method, url, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,181 @@
+package selftest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLibrary(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	names, err := Library(dir)
+	if err != nil {
+		t.Fatalf("Library() error = %v", err)
+	}
+	if len(names) == 0 {
+		t.Fatal("Library() wrote no files")
+	}
+
+	// the top level boxes fill the file exactly
+	data, err := os.ReadFile(filepath.Join(dir, names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var boxes []string
+	for rest := data; len(rest) > 0; {
+		size := int(binary.BigEndian.Uint32(rest))
+		if size < 8 || size > len(rest) {
+			t.Fatalf("box %q sized %d with %d bytes left", rest[4:8], size, len(rest))
+		}
+		boxes = append(boxes, string(rest[4:8]))
+		rest = rest[size:]
+	}
+	if got := strings.Join(boxes, " "); got != "ftyp moov mdat" {
+		t.Errorf("boxes = %s, want ftyp moov mdat", got)
+	}
+}
+
+// fakeServer answers the description, Browse and stream requests like the real server, udn is the UDN of
+// its description
+func fakeServer(t *testing.T, udn string, items string) *httptest.Server {
+	t.Helper()
+
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /description.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<root><device><friendlyName>Fake</friendlyName><UDN>` + udn + `</UDN><serviceList>
+<service><serviceType>urn:schemas-upnp-org:service:ContentDirectory:1</serviceType><controlURL>` + srv.URL + `/control</controlURL></service>
+</serviceList></device></root>`))
+	})
+	mux.HandleFunc("POST /control", func(w http.ResponseWriter, r *http.Request) {
+		var body bytes.Buffer
+		body.ReadFrom(r.Body)
+		didl := `<DIDL-Lite><container id="all"/></DIDL-Lite>`
+		if strings.Contains(body.String(), "<ObjectID>all</ObjectID>") {
+			didl = `<DIDL-Lite>` + strings.ReplaceAll(items, "URL", srv.URL) + `</DIDL-Lite>`
+		}
+		var escaped strings.Builder
+		xml.EscapeText(&escaped, []byte(didl))
+		w.Write([]byte(`<Envelope><Body><BrowseResponse><Result>` + escaped.String() + `</Result></BrowseResponse></Body></Envelope>`))
+	})
+	mux.HandleFunc("GET /film.mp4", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "film.mp4", time.Time{}, bytes.NewReader(mp4Stub()))
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheckerRun(t *testing.T) {
+	t.Parallel()
+
+	const udn = "uuid:00000000-0000-0000-0000-000000000001"
+	film := `<item parentID="all"><title>Film</title><res>URL/film.mp4</res></item>`
+
+	tests := []struct {
+		name    string
+		udn     string
+		items   string
+		want    []string // status per step
+		wantErr string
+	}{
+		{"ok - every step", udn, film, []string{"SKIP", "PASS", "PASS", "PASS"}, ""},
+		{"fail - another server", "uuid:other", film, []string{"SKIP", "FAIL", "SKIP", "SKIP"}, "UDN is"},
+		{"fail - empty library", udn, "", []string{"SKIP", "PASS", "FAIL", "SKIP"}, "no video found"},
+		{"fail - stream gone", udn, strings.ReplaceAll(film, "film.mp4", "gone.mp4"), []string{"SKIP", "PASS", "PASS", "FAIL"}, "status 404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := fakeServer(t, tt.udn, tt.items)
+			c := Checker{BaseURL: srv.URL, UUID: udn}
+			report := c.Run(t.Context())
+
+			var got []string
+			for _, res := range report {
+				switch {
+				case res.Err != nil:
+					got = append(got, "FAIL")
+				case res.Skipped:
+					got = append(got, "SKIP")
+				default:
+					got = append(got, "PASS")
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("steps = %q, want %q", got, tt.want)
+			}
+			err := report.Err()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Err() = %v, want %q", err, tt.wantErr)
+			}
+
+			var out bytes.Buffer
+			report.Print(&out)
+			if wantLast := map[bool]string{true: "selftest passed\n", false: "selftest failed\n"}[tt.wantErr == ""]; !strings.HasSuffix(out.String(), wantLast) {
+				t.Errorf("Print() = %q, want it to end in %q", out.String(), wantLast)
+			}
+		})
+	}
+}
+
+func TestCheckerSearch(t *testing.T) {
+	t.Parallel()
+
+	const udn = "uuid:00000000-0000-0000-0000-000000000001"
+
+	// a stand in for the multicast group: another server answers first, then ours
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil || !strings.HasPrefix(string(buf[:n]), "M-SEARCH") {
+			return
+		}
+		answer := "HTTP/1.1 200 OK\r\nST: urn:schemas-upnp-org:device:MediaServer:1\r\nUSN: %s::urn:schemas-upnp-org:device:MediaServer:1\r\nLOCATION: %s\r\n\r\n"
+		conn.WriteToUDP(fmt.Appendf(nil, answer, "uuid:other", "http://10.0.0.9/description.xml"), src)
+		conn.WriteToUDP(fmt.Appendf(nil, answer, udn, "http://10.0.0.1/description.xml"), src)
+	}()
+
+	c := Checker{UUID: udn, SSDP: conn.LocalAddr().String()}
+	got, err := c.Search(t.Context())
+	if err != nil || got != "http://10.0.0.1/description.xml" {
+		t.Errorf("Search() = %q, %v, want ours at http://10.0.0.1/description.xml", got, err)
+	}
+
+	t.Run("fail - no answer", func(t *testing.T) {
+		t.Parallel()
+
+		silent, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { silent.Close() })
+
+		c := Checker{UUID: udn, SSDP: silent.LocalAddr().String()}
+		ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+		defer cancel()
+		if _, err := c.Search(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Search() error = %v, want the deadline", err)
+		}
+	})
+}
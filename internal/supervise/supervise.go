@@ -0,0 +1,115 @@
+// Package supervise runs the long-lived goroutines of the server. A panic in one of them is logged with
+// its stack and the goroutine restarted after a backoff, instead of taking the whole process down
+package supervise
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// defaults for New, a component that keeps panicking is given up on after about half a minute
+const (
+	defaultMaxRestarts = 5
+	defaultBackoff     = time.Second
+	defaultMaxBackoff  = time.Minute
+)
+
+// PanicError is a recovered panic, the last one of a component that was given up on
+type PanicError struct {
+	Component string
+	Value     any
+	Stack     []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s panicked: %v", e.Component, e.Value)
+}
+
+// Supervisor restarts panicking components. A nil Supervisor runs them unsupervised
+type Supervisor struct {
+	Logger      *slog.Logger
+	MaxRestarts int           // restarts per component before it is given up on
+	Backoff     time.Duration // wait before the first restart, doubled for each further one
+	MaxBackoff  time.Duration
+
+	OnPanic  func(component string)            // optional, e.g. counts the panic in a metric
+	OnGiveUp func(component string, err error) // optional, e.g. shuts the server down
+}
+
+// New returns a Supervisor with the default limits
+func New(logger *slog.Logger) *Supervisor {
+	return &Supervisor{
+		Logger:      logger,
+		MaxRestarts: defaultMaxRestarts,
+		Backoff:     defaultBackoff,
+		MaxBackoff:  defaultMaxBackoff,
+	}
+}
+
+// Go runs fn in its own goroutine. When fn panics it is started again after the backoff, as long as
+// ctx isn't done and the component has restarts left. fn must be safe to run again, state that has to
+// survive a restart lives outside of it. The returned channel is closed once fn has returned for good
+func (s *Supervisor) Go(ctx context.Context, name string, fn func(ctx context.Context)) <-chan struct{} {
+	done := make(chan struct{})
+
+	if s == nil {
+		go func() {
+			defer close(done)
+			fn(ctx)
+		}()
+		return done
+	}
+
+	go func() {
+		defer close(done)
+
+		backoff := s.Backoff
+		for restarts := 0; ; restarts++ {
+			perr := run(ctx, name, fn)
+			if perr == nil {
+				return
+			}
+
+			if s.OnPanic != nil {
+				s.OnPanic(name)
+			}
+
+			if restarts >= s.MaxRestarts {
+				s.Logger.Error("component panicked, giving up", "component", name, "panic", perr.Value,
+					"restarts", restarts, "stack", string(perr.Stack))
+				if s.OnGiveUp != nil {
+					s.OnGiveUp(name, perr)
+				}
+				return
+			}
+
+			s.Logger.Error("component panicked, restarting", "component", name, "panic", perr.Value,
+				"restart_in", backoff, "restarts", restarts, "stack", string(perr.Stack))
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			backoff = min(backoff*2, s.MaxBackoff)
+		}
+	}()
+	return done
+}
+
+// run calls fn once, a panic comes back as the error
+func run(ctx context.Context, name string, fn func(ctx context.Context)) (perr *PanicError) {
+	defer func() {
+		if v := recover(); v != nil {
+			perr = &PanicError{Component: name, Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	fn(ctx)
+	return nil
+}
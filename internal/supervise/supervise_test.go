@@ -0,0 +1,133 @@
+package supervise
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestSupervisorRestartsAfterPanic(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		s := New(discardLogger())
+		var panics atomic.Int32
+		s.OnPanic = func(component string) {
+			if component != "flaky" {
+				t.Errorf("OnPanic component = %q, want flaky", component)
+			}
+			panics.Add(1)
+		}
+		s.OnGiveUp = func(string, error) { t.Error("gave up on a component that recovered") }
+
+		// panics twice, then does its work until ctx is done
+		var runs atomic.Int32
+		ctx, cancel := context.WithCancel(t.Context())
+		start := time.Now()
+		done := s.Go(ctx, "flaky", func(ctx context.Context) {
+			if runs.Add(1) <= 2 {
+				panic("boom")
+			}
+			<-ctx.Done()
+		})
+
+		synctest.Wait()
+		if got := runs.Load(); got != 1 {
+			t.Fatalf("ran %d times before the backoff, want 1", got)
+		}
+
+		// 1s then 2s of backoff
+		time.Sleep(3 * time.Second)
+		synctest.Wait()
+		if got := runs.Load(); got != 3 {
+			t.Fatalf("ran %d times after %v, want 3", got, time.Since(start))
+		}
+		if got := panics.Load(); got != 2 {
+			t.Errorf("OnPanic called %d times, want 2", got)
+		}
+
+		select {
+		case <-done:
+			t.Fatal("done closed while the component is running")
+		default:
+		}
+
+		cancel()
+		<-done
+	})
+}
+
+func TestSupervisorGivesUp(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		s := New(discardLogger())
+		s.MaxRestarts = 2
+
+		var gaveUp error
+		s.OnGiveUp = func(component string, err error) { gaveUp = err }
+
+		var runs atomic.Int32
+		done := s.Go(t.Context(), "broken", func(ctx context.Context) {
+			runs.Add(1)
+			panic("always")
+		})
+		<-done
+
+		if got := runs.Load(); got != 3 {
+			t.Errorf("ran %d times, want 3 (first run and 2 restarts)", got)
+		}
+
+		var perr *PanicError
+		if !errors.As(gaveUp, &perr) {
+			t.Fatalf("OnGiveUp error = %v, want a *PanicError", gaveUp)
+		}
+		if perr.Component != "broken" || perr.Value != "always" || len(perr.Stack) == 0 {
+			t.Errorf("PanicError = %q %v with %d bytes of stack", perr.Component, perr.Value, len(perr.Stack))
+		}
+	})
+}
+
+func TestSupervisorStopsDuringBackoff(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		s := New(discardLogger())
+
+		ctx, cancel := context.WithCancel(t.Context())
+		var runs atomic.Int32
+		done := s.Go(ctx, "flaky", func(ctx context.Context) {
+			runs.Add(1)
+			panic("boom")
+		})
+
+		synctest.Wait()
+		cancel()
+		<-done
+
+		if got := runs.Load(); got != 1 {
+			t.Errorf("ran %d times, a cancelled component must not be restarted", got)
+		}
+	})
+}
+
+func TestNilSupervisor(t *testing.T) {
+	t.Parallel()
+
+	var s *Supervisor
+	ran := false
+	<-s.Go(t.Context(), "plain", func(ctx context.Context) { ran = true })
+
+	if !ran {
+		t.Error("nil Supervisor did not run the component")
+	}
+}
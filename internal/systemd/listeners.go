@@ -0,0 +1,82 @@
+// Package systemd speaks the parts of the systemd protocols the server uses, without linking libsystemd
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFdsStart is the first inherited fd, 0-2 are stdin/stdout/stderr
+const listenFdsStart = 3
+
+// Listener is a socket handed over by systemd, Name comes from FileDescriptorName= in the .socket unit
+type Listener struct {
+	Name string
+	net.Listener
+}
+
+// Listeners returns the sockets passed by socket activation in the order systemd passed them.
+// It returns nil when the process was not socket activated
+func Listeners() ([]Listener, error) {
+	n, names, err := listenEnv(os.Getenv, os.Getpid())
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	// child processes must not think the sockets are theirs
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]Listener, 0, n)
+	for i := range n {
+		l, err := fileListener(listenFdsStart+i, names[i])
+		if err != nil {
+			for _, prev := range listeners {
+				prev.Close()
+			}
+			return nil, fmt.Errorf("inherit fd %d (%s): %w", listenFdsStart+i, names[i], err)
+		}
+		listeners = append(listeners, Listener{Name: names[i], Listener: l})
+	}
+	return listeners, nil
+}
+
+// listenEnv reads the LISTEN_* variables, n is 0 when they are missing or meant for another process
+func listenEnv(getenv func(string) string, pid int) (int, []string, error) {
+	pidStr := getenv("LISTEN_PID")
+	if pidStr == "" {
+		return 0, nil, nil
+	}
+
+	listenPid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid LISTEN_PID %q: %w", pidStr, err)
+	}
+	// the variables were inherited from a parent that was activated, not us
+	if listenPid != pid {
+		return 0, nil, nil
+	}
+
+	fdsStr := getenv("LISTEN_FDS")
+	n, err := strconv.Atoi(fdsStr)
+	if err != nil || n < 0 {
+		return 0, nil, fmt.Errorf("invalid LISTEN_FDS %q", fdsStr)
+	}
+
+	names := make([]string, n)
+	if fdNames := getenv("LISTEN_FDNAMES"); fdNames != "" {
+		parts := strings.Split(fdNames, ":")
+		if len(parts) != n {
+			return 0, nil, fmt.Errorf("LISTEN_FDNAMES has %d names for %d fds", len(parts), n)
+		}
+		copy(names, parts)
+	}
+	return n, names, nil
+}
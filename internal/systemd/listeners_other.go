@@ -0,0 +1,12 @@
+//go:build !unix
+
+package systemd
+
+import (
+	"errors"
+	"net"
+)
+
+func fileListener(fd int, name string) (net.Listener, error) {
+	return nil, errors.New("socket activation is not supported on this platform")
+}
@@ -0,0 +1,49 @@
+package systemd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestListenEnv(t *testing.T) {
+	t.Parallel()
+
+	const pid = 4242
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantN     int
+		wantNames []string
+		wantErr   bool
+	}{
+		{"ok - not activated", map[string]string{}, 0, nil, false},
+		{"ok - meant for another process", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}, 0, nil, false},
+		{"ok - single unnamed fd", map[string]string{"LISTEN_PID": "4242", "LISTEN_FDS": "1"}, 1, []string{""}, false},
+		{"ok - named fds", map[string]string{"LISTEN_PID": "4242", "LISTEN_FDS": "2", "LISTEN_FDNAMES": "http:metrics"}, 2, []string{"http", "metrics"}, false},
+		{"ok - zero fds", map[string]string{"LISTEN_PID": "4242", "LISTEN_FDS": "0"}, 0, []string{}, false},
+		{"fail - bad pid", map[string]string{"LISTEN_PID": "abc", "LISTEN_FDS": "1"}, 0, nil, true},
+		{"fail - missing fds", map[string]string{"LISTEN_PID": "4242"}, 0, nil, true},
+		{"fail - negative fds", map[string]string{"LISTEN_PID": "4242", "LISTEN_FDS": "-1"}, 0, nil, true},
+		{"fail - names do not match fds", map[string]string{"LISTEN_PID": "4242", "LISTEN_FDS": "2", "LISTEN_FDNAMES": "http"}, 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			getenv := func(k string) string { return tt.env[k] }
+
+			n, names, err := listenEnv(getenv, pid)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("listenEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n != tt.wantN {
+				t.Errorf("listenEnv() n = %d, want %d", n, tt.wantN)
+			}
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("listenEnv() names = %q, want %q", names, tt.wantNames)
+			}
+		})
+	}
+}
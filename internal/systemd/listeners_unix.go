@@ -0,0 +1,19 @@
+//go:build unix
+
+package systemd
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+func fileListener(fd int, name string) (net.Listener, error) {
+	syscall.CloseOnExec(fd)
+
+	// FileListener dups the fd, the original can go
+	f := os.NewFile(uintptr(fd), name)
+	defer f.Close()
+
+	return net.FileListener(f)
+}
@@ -0,0 +1,86 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notifier sends sd_notify state changes to the service manager. It does nothing when the process
+// was not started by systemd with Type=notify, so callers don't have to check
+type Notifier struct {
+	socket string // NOTIFY_SOCKET, a path or an abstract name starting with '@'
+}
+
+func NewNotifier() *Notifier {
+	return &Notifier{socket: os.Getenv("NOTIFY_SOCKET")}
+}
+
+// Enabled reports whether there is a service manager listening
+func (n *Notifier) Enabled() bool {
+	return n.socket != ""
+}
+
+// Notify sends a raw state string such as "READY=1", see sd_notify(3)
+func (n *Notifier) Notify(state string) error {
+	if !n.Enabled() {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: n.socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("dial notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("write notify socket: %w", err)
+	}
+	return nil
+}
+
+// Ready tells systemd startup is complete, the unit moves from "activating" to "active"
+func (n *Notifier) Ready() error {
+	return n.Notify("READY=1")
+}
+
+// Stopping tells systemd the shutdown has begun
+func (n *Notifier) Stopping() error {
+	return n.Notify("STOPPING=1")
+}
+
+// Watchdog keeps the watchdog timer from firing
+func (n *Notifier) Watchdog() error {
+	return n.Notify("WATCHDOG=1")
+}
+
+// WatchdogInterval returns the WatchdogSec= of the unit, zero when the watchdog is off or meant for another process
+func WatchdogInterval() (time.Duration, error) {
+	return watchdogEnv(os.Getenv, os.Getpid())
+}
+
+func watchdogEnv(getenv func(string) string, pid int) (time.Duration, error) {
+	usecStr := getenv("WATCHDOG_USEC")
+	if usecStr == "" {
+		return 0, nil
+	}
+
+	// WATCHDOG_PID is optional, when set the watchdog may belong to a parent
+	if pidStr := getenv("WATCHDOG_PID"); pidStr != "" {
+		watchdogPid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			return 0, fmt.Errorf("invalid WATCHDOG_PID %q: %w", pidStr, err)
+		}
+		if watchdogPid != pid {
+			return 0, nil
+		}
+	}
+
+	usec, err := strconv.ParseInt(usecStr, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %q", usecStr)
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
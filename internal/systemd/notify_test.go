@@ -0,0 +1,119 @@
+package systemd
+
+import (
+	"net"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// fakeSocket plays the service manager end of NOTIFY_SOCKET
+func fakeSocket(t *testing.T) (*Notifier, *net.UnixConn) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not available on windows")
+	}
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &Notifier{socket: path}, conn
+}
+
+func readState(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotifierSendsStates(t *testing.T) {
+	t.Parallel()
+
+	n, conn := fakeSocket(t)
+
+	steps := []struct {
+		name string
+		send func() error
+		want string
+	}{
+		{"ready", n.Ready, "READY=1"},
+		{"watchdog", n.Watchdog, "WATCHDOG=1"},
+		{"stopping", n.Stopping, "STOPPING=1"},
+	}
+
+	for _, s := range steps {
+		if err := s.send(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if got := readState(t, conn); got != s.want {
+			t.Errorf("%s sent %q, want %q", s.name, got, s.want)
+		}
+	}
+}
+
+func TestNotifierDisabled(t *testing.T) {
+	t.Parallel()
+
+	n := &Notifier{}
+	if n.Enabled() {
+		t.Fatal("notifier without a socket reports enabled")
+	}
+	if err := n.Ready(); err != nil {
+		t.Errorf("Ready() on a disabled notifier error = %v", err)
+	}
+}
+
+func TestNotifierMissingSocket(t *testing.T) {
+	t.Parallel()
+
+	n := &Notifier{socket: filepath.Join(t.TempDir(), "gone.sock")}
+	if err := n.Ready(); err == nil {
+		t.Error("Ready() to a missing socket should fail")
+	}
+}
+
+func TestWatchdogEnv(t *testing.T) {
+	t.Parallel()
+
+	const pid = 4242
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"ok - watchdog off", map[string]string{}, 0, false},
+		{"ok - interval", map[string]string{"WATCHDOG_USEC": "30000000"}, 30 * time.Second, false},
+		{"ok - interval for this pid", map[string]string{"WATCHDOG_USEC": "5000000", "WATCHDOG_PID": "4242"}, 5 * time.Second, false},
+		{"ok - meant for another process", map[string]string{"WATCHDOG_USEC": "5000000", "WATCHDOG_PID": "1"}, 0, false},
+		{"fail - bad interval", map[string]string{"WATCHDOG_USEC": "soon"}, 0, true},
+		{"fail - zero interval", map[string]string{"WATCHDOG_USEC": "0"}, 0, true},
+		{"fail - bad pid", map[string]string{"WATCHDOG_USEC": "5000000", "WATCHDOG_PID": "me"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := watchdogEnv(func(k string) string { return tt.env[k] }, pid)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("watchdogEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("watchdogEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,471 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"streamer/internal/config"
+	"streamer/internal/media"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeDiscovery stands in for SSDP so the test never touches multicast
+type fakeDiscovery struct {
+	started   atomic.Bool
+	announced atomic.Int32
+	paused    atomic.Bool
+	handedOff atomic.Bool
+	port      atomic.Int32 // what Start was told to advertise
+}
+
+func (d *fakeDiscovery) Start(ctx context.Context, hostIP string, port int) <-chan struct{} {
+	d.port.Store(int32(port))
+	d.started.Store(true)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+	}()
+	return done
+}
+
+func (d *fakeDiscovery) Announce() {
+	d.announced.Add(1)
+}
+
+func (d *fakeDiscovery) Pause() {
+	d.paused.Store(true)
+}
+
+func (d *fakeDiscovery) Resume() {
+	d.paused.Store(false)
+}
+
+func (d *fakeDiscovery) HandOff() {
+	d.handedOff.Store(true)
+}
+
+// startTestServer boots the whole app on an ephemeral port against dir, it is stopped when the test ends.
+// setup may adjust the config, it can be nil. The returned channel is closed once Run has returned
+func startTestServer(t *testing.T, dir string, setup func(*config.Config), opts ...Option) (*Server, string, <-chan struct{}) {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Media.UUID = "uuid:00000000-0000-0000-0000-000000000001"
+	cfg.Media.Volumes = []config.VolumeConfig{{ID: "vol", MaxIO: 2, Paths: []string{dir}}}
+	cfg.Metrics.Runtime = false
+	cfg.Media.Settle = 0 // the tests scan files they just wrote
+	if setup != nil {
+		setup(cfg)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	opts = append([]Option{WithListener(ln), WithHostIP("127.0.0.1"), WithoutSignals()}, opts...)
+	app, err := New(cfg, discardLogger(), opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var runErr error
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		runErr = app.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-stopped:
+			if runErr != nil {
+				t.Errorf("Run() error = %v", runErr)
+			}
+		case <-time.After(10 * time.Second):
+			t.Error("Run() did not return after cancel")
+		}
+	})
+
+	return app, "http://" + ln.Addr().String(), stopped
+}
+
+// waitForEntries polls the registry until the first scan has found n files
+func waitForEntries(t *testing.T, app *Server, n int) []media.Video {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		files, err := app.api.Media.ListFiles()
+		if err != nil {
+			t.Fatalf("ListFiles() error = %v", err)
+		}
+		if len(files) == n {
+			return files
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scan found %d files, want %d", len(files), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAppStreamsScannedFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	disc := &fakeDiscovery{}
+	app, baseURL, _ := startTestServer(t, dir, nil, WithDiscovery(disc))
+
+	files := waitForEntries(t, app, 1)
+	url := baseURL + "/direct/" + files[0].UUID.String() + ".mp4"
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if string(body) != string(content) {
+		t.Errorf("body = %q, want %q", body, content)
+	}
+
+	// renderers seek with ranges
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Range", "bytes=10-15")
+
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("ranged GET: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("ranged status = %d, want %d", resp.StatusCode, http.StatusPartialContent)
+	}
+	if string(body) != "abcdef" {
+		t.Errorf("ranged body = %q, want %q", body, "abcdef")
+	}
+
+	if !disc.started.Load() {
+		t.Error("discovery was never started")
+	}
+}
+
+// TestAppPositionalPath starts the app the way the single root setups before volumes did, with only a path
+// on the command line, and lists and streams from it
+func TestAppPositionalPath(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	app, baseURL, _ := startTestServer(t, dir, func(cfg *config.Config) {
+		// what main gets, apart from what would touch the host: its port, the uuid file and the runtime metrics
+		*cfg = *config.DefaultConfig()
+		args := []string{"-media.uuid=uuid:00000000-0000-0000-0000-000000000001", "-media.uuidFile=", "-preflight=false", "-metrics.runtime=false", "-media.settle=0", dir}
+		if err := config.ParseArgs(cfg, args, io.Discard); err != nil {
+			t.Fatalf("ParseArgs(%q) error = %v", args, err)
+		}
+	}, WithDiscovery(&fakeDiscovery{}))
+
+	// one volume of the one path, with the default read slots
+	vols := app.cfg.Media.Volumes
+	if len(vols) != 1 || len(vols[0].Paths) != 1 || vols[0].Paths[0] != dir || vols[0].MaxIO != 10 {
+		t.Fatalf("volumes = %+v, want one of %s", vols, dir)
+	}
+	if _, err := app.api.Media.GetMount(vols[0].ID + "_0"); err != nil {
+		t.Fatalf("no mount for the path: %v", err)
+	}
+	waitForEntries(t, app, 1)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	defer client.CloseIdleConnections()
+
+	get := func(url string) []byte {
+		t.Helper()
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s status = %d, want %d", url, resp.StatusCode, http.StatusOK)
+		}
+		return body
+	}
+
+	// the playlist lists the file, its link streams it
+	var stream string
+	for line := range strings.Lines(string(get(baseURL + "/playlist.m3u"))) {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "http") {
+			stream = line
+		}
+	}
+	if stream == "" {
+		t.Fatal("playlist.m3u lists nothing")
+	}
+	if body := get(stream); string(body) != string(content) {
+		t.Errorf("%s body = %q, want %q", stream, body, content)
+	}
+}
+
+func TestAppTwoMounts(t *testing.T) {
+	t.Parallel()
+
+	usb, nas, shows := t.TempDir(), t.TempDir(), t.TempDir()
+	for path, content := range map[string]string{
+		filepath.Join(usb, "Heat.mp4"):    "heat",
+		filepath.Join(nas, "Ronin.mkv"):   "ronin",
+		filepath.Join(shows, "Pilot.mp4"): "pilot",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app, baseURL, _ := startTestServer(t, "", func(cfg *config.Config) {
+		*cfg = *config.DefaultConfig()
+		args := []string{"-media.uuid=uuid:00000000-0000-0000-0000-000000000001", "-media.uuidFile=", "-preflight=false", "-metrics.runtime=false", "-media.settle=0",
+			"-media.mount", "usb:1:" + usb, "-media.mount", "nas:3:" + nas + "," + shows}
+		if err := config.ParseArgs(cfg, args, io.Discard); err != nil {
+			t.Fatalf("ParseArgs(%q) error = %v", args, err)
+		}
+	}, WithDiscovery(&fakeDiscovery{}))
+
+	// a mount per path, the paths of a volume share its read slots
+	mounts := map[string]*media.MountPoint{}
+	for _, id := range []string{"usb_0", "nas_0", "nas_1"} {
+		m, err := app.api.Media.GetMount(id)
+		if err != nil {
+			t.Fatalf("GetMount(%s) error = %v", id, err)
+		}
+		mounts[id] = m
+	}
+	if mounts["usb_0"].Limiter.Cap() != 1 || mounts["nas_0"].Limiter.Cap() != 3 {
+		t.Errorf("read slots usb %d nas %d, want 1 and 3", mounts["usb_0"].Limiter.Cap(), mounts["nas_0"].Limiter.Cap())
+	}
+	if mounts["nas_0"].Limiter != mounts["nas_1"].Limiter || mounts["usb_0"].Limiter == mounts["nas_0"].Limiter {
+		t.Error("want one limiter per volume, shared by its paths")
+	}
+
+	// the startup scan reads every root and the web ui lists them all
+	waitForEntries(t, app, 3)
+	resp, err := http.Get(baseURL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Heat", "Ronin", "Pilot"} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("GET / doesn't list %s", name)
+		}
+	}
+}
+
+func TestAppUsesInjectedClock(t *testing.T) {
+	t.Parallel()
+
+	sleepOneHour := func(cfg *config.Config) { cfg.ShutdownTimers.SleepTimer = time.Hour }
+	_, baseURL, _ := startTestServer(t, t.TempDir(), sleepOneHour, WithClock(fixedClock{now: testNow}), WithDiscovery(&fakeDiscovery{}))
+
+	// the monitor starts in the background, poll until it has scheduled something
+	var scheduled time.Time
+	deadline := time.Now().Add(5 * time.Second)
+	for scheduled.IsZero() && time.Now().Before(deadline) {
+		scheduled = fetchScheduled(t, baseURL)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the sleep timer counts from the injected now, not the wall clock
+	if want := testNow.Add(time.Hour); !scheduled.Equal(want) {
+		t.Errorf("scheduled = %v, want %v", scheduled, want)
+	}
+}
+
+func fetchScheduled(t *testing.T, baseURL string) time.Time {
+	t.Helper()
+
+	resp, err := http.Get(baseURL + "/api/status")
+	if err != nil {
+		t.Fatalf("GET /api/status: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status struct {
+		Shutdown struct {
+			Scheduled time.Time `json:"scheduled"`
+		} `json:"shutdown"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	return status.Shutdown.Scheduled
+}
+
+func TestAppAdminRescan(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	app, baseURL, _ := startTestServer(t, dir, func(cfg *config.Config) {
+		cfg.Admin.Token = "secret"
+	}, WithDiscovery(&fakeDiscovery{}))
+	waitForEntries(t, app, 0)
+	<-app.api.Media.FirstScanDone()
+
+	// copied in after the first scan, the next periodic one is minutes away
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rescan := func(token string) int {
+		req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/rescan", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /api/rescan: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := rescan(""); got != http.StatusUnauthorized {
+		t.Errorf("rescan without the token status = %d, want 401", got)
+	}
+	if got := rescan("secret"); got != http.StatusAccepted {
+		t.Fatalf("rescan status = %d, want 202", got)
+	}
+	waitForEntries(t, app, 1)
+}
+
+func TestAppJunkPaths(t *testing.T) {
+	t.Parallel()
+
+	app, baseURL, _ := startTestServer(t, t.TempDir(), nil, WithDiscovery(&fakeDiscovery{}))
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	defer client.CloseIdleConnections()
+
+	for path, want := range map[string]int{
+		"/favicon.ico":          http.StatusOK,
+		"/robots.txt":           http.StatusOK,
+		"/apple-touch-icon.png": http.StatusNoContent,
+		"/":                     http.StatusOK,
+		"/nope":                 http.StatusNotFound,
+	} {
+		resp, err := client.Get(baseURL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s status = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+
+	// the web ui is counted, what browsers fetch on their own is not
+	requests := func(path, status string) float64 {
+		return testutil.ToFloat64(app.metrics.RequestsTotal.WithLabelValues(http.MethodGet, path, status))
+	}
+	if got := requests("/", "200"); got != 1 {
+		t.Errorf("requests of / = %v, want 1", got)
+	}
+	for _, path := range []string{"/favicon.ico", "/robots.txt"} {
+		if got := requests(path, "200"); got != 0 {
+			t.Errorf("requests of %s = %v, want them left out", path, got)
+		}
+	}
+	if got := requests("/apple-touch-icon.png", "204"); got != 0 {
+		t.Errorf("requests of /apple-touch-icon.png = %v, want them left out", got)
+	}
+}
+
+func TestAppVolumeSpace(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	app, baseURL, _ := startTestServer(t, dir, nil, WithDiscovery(&fakeDiscovery{}))
+	<-app.api.Media.FirstScanDone()
+
+	resp, err := http.Get(baseURL + "/api/status")
+	if err != nil {
+		t.Fatalf("GET /api/status: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status struct {
+		Volumes []struct {
+			ID           string `json:"id"`
+			Entries      int    `json:"entries"`
+			LibraryBytes int64  `json:"library_bytes"`
+			TotalBytes   int64  `json:"total_bytes"`
+			FreeBytes    *int64 `json:"free_bytes"`
+		} `json:"volumes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if len(status.Volumes) != 1 {
+		t.Fatalf("volumes = %+v, want one", status.Volumes)
+	}
+	v := status.Volumes[0]
+	if v.ID != "vol_0" || v.Entries != 1 || v.LibraryBytes != 10 {
+		t.Errorf("volume = %+v, want vol_0 with 1 entry of 10 bytes", v)
+	}
+	if v.TotalBytes <= 0 || v.FreeBytes == nil {
+		t.Errorf("volume total %d free %v, want the disk's space", v.TotalBytes, v.FreeBytes)
+	}
+
+	if got := testutil.ToFloat64(app.metrics.LibraryBytes.WithLabelValues("vol_0")); got != 10 {
+		t.Errorf("streamer_library_bytes = %v, want 10", got)
+	}
+	if got := testutil.ToFloat64(app.metrics.VolumeTotalBytes.WithLabelValues("vol_0")); got != float64(v.TotalBytes) {
+		t.Errorf("streamer_volume_total_bytes = %v, want %d", got, v.TotalBytes)
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"streamer/internal/bookmark"
+	"streamer/internal/media"
+	"streamer/internal/playlist"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// how often the registry cache is written when something in it changed
+const cacheSaveInterval = time.Minute
+
+// cacheFile is what -media.cache keeps across restarts
+type cacheFile struct {
+	Entries   []media.CachedEntry `json:"entries"`
+	Bookmarks []bookmark.Bookmark `json:"bookmarks"`
+	Playlists []playlist.Playlist `json:"playlists"`
+}
+
+// loadCache reads the cache, a missing file is an empty one
+func loadCache(path string) (cacheFile, error) {
+	var c cacheFile
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("read cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("parse cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// writeFileAtomic replaces path with data, a crash halfway leaves the old file in place
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// restoreCache hands the cached UUIDs, bookmarks and playlists to the registry and their stores. A cache
+// that can't be read costs them, not the start
+func (s *Server) restoreCache() {
+	c, err := loadCache(s.cfg.Media.Cache)
+	if err != nil {
+		s.logger.Warn("registry cache unusable, starting without it", "path", s.cfg.Media.Cache, "error", err)
+		return
+	}
+
+	s.api.Media.Registry.Restore(c.Entries)
+	s.api.Bookmarks.Restore(c.Bookmarks)
+	s.api.Playlists.Restore(c.Playlists)
+	s.logger.Info("registry cache loaded", "path", s.cfg.Media.Cache,
+		"entries", len(c.Entries), "bookmarks", len(c.Bookmarks), "playlists", len(c.Playlists))
+}
+
+// pruneBookmarks drops the resume positions of entries the last scan didn't find anymore
+func (s *Server) pruneBookmarks() {
+	registry := s.api.Media.Registry
+	pruned := s.api.Bookmarks.Prune(func(id uuid.UUID) bool {
+		_, err := registry.Get(id)
+		return err == nil
+	})
+	if pruned > 0 {
+		s.logger.Info("bookmarks of removed entries pruned", "count", pruned)
+	}
+}
+
+// saveCache writes the cache when it differs from what was written last
+func (s *Server) saveCache() error {
+	data, err := json.MarshalIndent(cacheFile{
+		Entries:   s.api.Media.Registry.Cached(),
+		Bookmarks: s.api.Bookmarks.List(),
+		Playlists: s.api.Playlists.List(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode cache: %w", err)
+	}
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	if bytes.Equal(data, s.cacheSaved) {
+		return nil
+	}
+	if err := writeFileAtomic(s.cfg.Media.Cache, data); err != nil {
+		return fmt.Errorf("write cache: %w", err)
+	}
+	s.cacheSaved = data
+	return nil
+}
+
+// runCache saves the cache now and then until ctx is done, the last save is up to the shutdown
+func (s *Server) runCache(ctx context.Context) {
+	ticker := time.NewTicker(cacheSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.saveCache(); err != nil {
+				s.logger.Warn("saving registry cache failed", "path", s.cfg.Media.Cache, "error", err)
+			}
+		}
+	}
+}
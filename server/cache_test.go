@@ -0,0 +1,175 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"streamer/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppCacheKeepsBookmarksAcrossRestarts(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Heat.mp4"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache := filepath.Join(t.TempDir(), "cache.json")
+	withCache := func(cfg *config.Config) { cfg.Media.Cache = cache }
+
+	var id string
+	var added time.Time
+	t.Run("first run", func(t *testing.T) {
+		app, baseURL, _ := startTestServer(t, dir, withCache, WithDiscovery(&fakeDiscovery{}))
+		entry := waitForEntries(t, app, 1)[0]
+		id, added = entry.UUID.String(), entry.AddedAt
+
+		resp, err := http.PostForm(baseURL+"/api/progress/"+id, url.Values{"position": {"2520.5"}})
+		if err != nil {
+			t.Fatalf("POST progress: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST progress status = %d", resp.StatusCode)
+		}
+	})
+
+	// the first app saved on its way out
+	data, err := os.ReadFile(cache)
+	if err != nil {
+		t.Fatalf("cache not written on shutdown: %v", err)
+	}
+	if !strings.Contains(string(data), id) {
+		t.Errorf("cache has no entry %s:\n%s", id, data)
+	}
+
+	t.Run("second run", func(t *testing.T) {
+		app, baseURL, _ := startTestServer(t, dir, withCache, WithDiscovery(&fakeDiscovery{}))
+		entry := waitForEntries(t, app, 1)[0]
+		if got := entry.UUID.String(); got != id {
+			t.Fatalf("entry got UUID %s after the restart, want %s", got, id)
+		}
+		if added.IsZero() || !entry.AddedAt.Equal(added) {
+			t.Errorf("entry added at %v after the restart, want %v", entry.AddedAt, added)
+		}
+
+		resp, err := http.Get(baseURL + "/api/progress/" + id)
+		if err != nil {
+			t.Fatalf("GET progress: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var got struct{ Position float64 }
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("decode progress: %v", err)
+		}
+		if got.Position != 2520.5 {
+			t.Errorf("position after the restart = %v, want 2520.5", got.Position)
+		}
+	})
+}
+
+func TestAppCacheKeepsPlaylistsAcrossRestarts(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Heat.mp4"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache := filepath.Join(t.TempDir(), "cache.json")
+	withCache := func(cfg *config.Config) { cfg.Media.Cache = cache }
+
+	var id, playlistURL string
+	t.Run("first run", func(t *testing.T) {
+		app, baseURL, _ := startTestServer(t, dir, withCache, WithDiscovery(&fakeDiscovery{}))
+		id = waitForEntries(t, app, 1)[0].UUID.String()
+
+		body := `{"name": "movie night", "ids": ["` + id + `"]}`
+		resp, err := http.Post(baseURL+"/api/playlists", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST playlist: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST playlist status = %d", resp.StatusCode)
+		}
+		playlistURL = resp.Header.Get("Location")
+	})
+
+	t.Run("second run", func(t *testing.T) {
+		app, baseURL, _ := startTestServer(t, dir, withCache, WithDiscovery(&fakeDiscovery{}))
+		waitForEntries(t, app, 1)
+
+		resp, err := http.Get(baseURL + playlistURL)
+		if err != nil {
+			t.Fatalf("GET playlist: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(data), "/stream?id="+id) {
+			t.Errorf("playlist after the restart = %d %q, want the entry", resp.StatusCode, data)
+		}
+	})
+}
+
+func TestAppBrokenCache(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Heat.mp4"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(cache, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a cache that can't be read is started over, not a reason to stay down
+	app, _, _ := startTestServer(t, dir, func(cfg *config.Config) {
+		cfg.Media.Cache = cache
+	}, WithDiscovery(&fakeDiscovery{}))
+	waitForEntries(t, app, 1)
+
+	if err := app.saveCache(); err != nil {
+		t.Fatalf("saveCache() error = %v", err)
+	}
+	if _, err := loadCache(cache); err != nil {
+		t.Errorf("loadCache() after a save error = %v", err)
+	}
+}
+
+func TestAppPrunesBookmarksOnScan(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Heat.mp4")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	app, baseURL, _ := startTestServer(t, dir, nil, WithDiscovery(&fakeDiscovery{}))
+	id := waitForEntries(t, app, 1)[0].UUID.String()
+
+	resp, err := http.PostForm(baseURL+"/api/progress/"+id, url.Values{"position": {"60"}})
+	if err != nil {
+		t.Fatalf("POST progress: %v", err)
+	}
+	resp.Body.Close()
+	if got := app.api.Bookmarks.Len(); got != 1 {
+		t.Fatalf("%d bookmarks, want 1", got)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	app.api.Media.RescanNow()
+	waitForEntries(t, app, 0)
+	waitFor(t, "the bookmark of the removed entry to be pruned", func() bool { return app.api.Bookmarks.Len() == 0 })
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// component is a subsystem Run stops on the way out. stop returns once the component has finished
+// or ctx expired, whichever comes first
+type component struct {
+	name string
+	stop func(ctx context.Context) error
+
+	// timeout gives the component its own deadline instead of a share of the budget, for stages
+	// that are expected to take long (draining streams)
+	timeout time.Duration
+}
+
+// stopComponents stops the components one after the other, in order. Components without their own
+// timeout share budget, a component starting after it ran out still gets called with an expired ctx
+// so it can do its non-blocking part
+func stopComponents(logger *slog.Logger, budget time.Duration, components []component) error {
+	var errs []error
+
+	remaining := budget
+	for _, c := range components {
+		timeout := max(remaining, 0)
+		if c.timeout > 0 {
+			timeout = c.timeout
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		err := c.stop(ctx)
+		cancel()
+
+		elapsed := time.Since(start)
+		if c.timeout == 0 {
+			remaining -= elapsed
+		}
+
+		if err != nil {
+			logger.Warn("component did not stop cleanly", "component", c.name, "took", elapsed, "error", err)
+			errs = append(errs, fmt.Errorf("stop %s: %w", c.name, err))
+			continue
+		}
+		logger.Debug("component stopped", "component", c.name, "took", elapsed)
+	}
+	return errors.Join(errs...)
+}
+
+// waitDone waits for a done channel within ctx
+func waitDone(ctx context.Context, done <-chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeOnceListener lets Run stop accepting connections early, http.Server.Shutdown closes it again later
+type closeOnceListener struct {
+	net.Listener
+	once sync.Once
+	err  error
+}
+
+func (l *closeOnceListener) Close() error {
+	l.once.Do(func() { l.err = l.Listener.Close() })
+	return l.err
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+// recorder collects what the fake components did, in the order they did it
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// fake stops after taking d, or fails with the ctx error if the deadline comes first
+func (r *recorder) fake(name string, d time.Duration) component {
+	return component{name: name, stop: func(ctx context.Context) error {
+		r.add(name + " start")
+		defer r.add(name + " done")
+
+		select {
+		case <-time.After(d):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}
+}
+
+func TestStopComponentsOrder(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		r := &recorder{}
+
+		components := []component{
+			r.fake("http accept", 0),
+			r.fake("discovery", 200*time.Millisecond),
+			r.fake("streams", time.Second),
+			r.fake("http", 0),
+			r.fake("scanner", 100*time.Millisecond),
+			r.fake("monitor", 0),
+		}
+
+		if err := stopComponents(discardLogger(), 5*time.Second, components); err != nil {
+			t.Fatalf("stopComponents() error = %v", err)
+		}
+
+		// each component is done before the next one starts
+		want := []string{
+			"http accept start", "http accept done",
+			"discovery start", "discovery done",
+			"streams start", "streams done",
+			"http start", "http done",
+			"scanner start", "scanner done",
+			"monitor start", "monitor done",
+		}
+		if !slices.Equal(r.events, want) {
+			t.Errorf("events = %q, want %q", r.events, want)
+		}
+	})
+}
+
+func TestStopComponentsSharedBudget(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		r := &recorder{}
+
+		// the first one eats most of the budget, the second can't finish in what is left
+		components := []component{
+			r.fake("discovery", 4*time.Second),
+			r.fake("scanner", 2*time.Second),
+			r.fake("monitor", 0),
+		}
+
+		start := time.Now()
+		err := stopComponents(discardLogger(), 5*time.Second, components)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("stopComponents() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if elapsed := time.Since(start); elapsed != 5*time.Second {
+			t.Errorf("shutdown took %v, want the 5s budget", elapsed)
+		}
+
+		// the monitor still gets its turn, with an expired ctx
+		if !slices.Contains(r.events, "monitor done") {
+			t.Errorf("monitor not stopped after the budget ran out, events = %q", r.events)
+		}
+	})
+}
+
+func TestStopComponentsOwnTimeout(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		r := &recorder{}
+
+		streams := r.fake("streams", 10*time.Minute)
+		streams.timeout = 30 * time.Minute
+
+		components := []component{
+			r.fake("discovery", time.Second),
+			streams,
+			r.fake("http", 3*time.Second),
+		}
+
+		// ten minutes of draining don't count against the 5s shared by the others
+		if err := stopComponents(discardLogger(), 5*time.Second, components); err != nil {
+			t.Fatalf("stopComponents() error = %v", err)
+		}
+	})
+}
+
+func TestStopComponentsErrors(t *testing.T) {
+	t.Parallel()
+
+	r := &recorder{}
+	boom := errors.New("boom")
+
+	components := []component{
+		{name: "discovery", stop: func(ctx context.Context) error { return boom }},
+		r.fake("monitor", 0),
+	}
+
+	err := stopComponents(discardLogger(), time.Second, components)
+	if !errors.Is(err, boom) {
+		t.Fatalf("stopComponents() error = %v, want %v", err, boom)
+	}
+	if !slices.Contains(r.events, "monitor done") {
+		t.Error("a failing component kept the next one from stopping")
+	}
+}
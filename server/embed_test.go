@@ -0,0 +1,233 @@
+package server_test
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"streamer/server"
+)
+
+// nopDiscovery keeps an embedded server off multicast
+type nopDiscovery struct{}
+
+func (nopDiscovery) Start(ctx context.Context, hostIP string, port int) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+	}()
+	return done
+}
+
+func (nopDiscovery) Announce() {}
+func (nopDiscovery) Pause()    {}
+func (nopDiscovery) Resume()   {}
+func (nopDiscovery) HandOff()  {}
+
+// embedded is a server the way a program embedding it sets one up, on a listener of its own and with a
+// library of one file
+type embedded struct {
+	srv     *server.Server
+	baseURL string
+	file    string
+}
+
+func newEmbedded(t *testing.T, file string) embedded {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// no UUID, each server makes up its own
+	cfg := server.DefaultConfig()
+	cfg.Media.UUIDFile = ""
+	cfg.Media.Volumes = []server.VolumeConfig{{ID: "vol", MaxIO: 2, Paths: []string{dir}}}
+	cfg.Media.Settle = 0
+	cfg.Preflight = false
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv, err := server.New(cfg, logger, server.WithListener(ln), server.WithHostIP("127.0.0.1"), server.WithoutSignals(), server.WithDiscovery(nopDiscovery{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return embedded{srv: srv, baseURL: "http://" + ln.Addr().String(), file: file}
+}
+
+// get fetches url and returns its body, failing on anything but a 200
+func get(t *testing.T, url string) string {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s status = %d, want 200", url, resp.StatusCode)
+	}
+	return string(body)
+}
+
+// udn is the UUID the server at baseURL tells renderers
+func udn(t *testing.T, baseURL string) string {
+	t.Helper()
+
+	var desc struct {
+		UDN string `xml:"device>UDN"`
+	}
+	if err := xml.Unmarshal([]byte(get(t, baseURL+"/description.xml")), &desc); err != nil {
+		t.Fatal(err)
+	}
+	return desc.UDN
+}
+
+// streamURL waits for the scan to list the one file and returns its stream link from the playlist
+func streamURL(t *testing.T, baseURL string) string {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for line := range strings.Lines(get(t, baseURL+"/playlist.m3u")) {
+			if line = strings.TrimSpace(line); strings.HasPrefix(line, "http") {
+				return line
+			}
+		}
+	}
+	t.Fatalf("%s lists nothing", baseURL)
+	return ""
+}
+
+func TestServerEmbedded(t *testing.T) {
+	t.Parallel()
+
+	a, b := newEmbedded(t, "Heat.mp4"), newEmbedded(t, "Ronin.mp4")
+
+	// the program's own mux, with b under /b/
+	host := http.NewServeMux()
+	host.Handle("/b/", http.StripPrefix("/b", b.srv.Handler()))
+	hostSrv := httptest.NewServer(host)
+	t.Cleanup(hostSrv.Close)
+
+	resp, err := http.Get(hostSrv.URL + "/b/description.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("handler before Start status = %d, want 503", resp.StatusCode)
+	}
+
+	for _, e := range []embedded{a, b} {
+		if err := e.srv.Start(t.Context()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, e := range []embedded{a, b} {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := e.srv.Shutdown(ctx); err != nil {
+				t.Errorf("Shutdown() error = %v", err)
+			}
+			cancel()
+		}
+	})
+
+	// two servers, two identities and two libraries
+	if a.srv.Addr() == b.srv.Addr() {
+		t.Errorf("both servers advertise %s", a.srv.Addr())
+	}
+	if udnA, udnB := udn(t, a.baseURL), udn(t, b.baseURL); udnA == "" || udnA == udnB {
+		t.Errorf("UDNs %q and %q, want two", udnA, udnB)
+	}
+	for _, e := range []embedded{a, b} {
+		if body := get(t, streamURL(t, e.baseURL)); body != e.file {
+			t.Errorf("%s streams %q, want %q", e.baseURL, body, e.file)
+		}
+	}
+
+	// and b answers the same under the program's mux
+	if got := udn(t, hostSrv.URL+"/b"); got != udn(t, b.baseURL) {
+		t.Errorf("UDN under the host mux = %q, want b's", got)
+	}
+	if !strings.Contains(get(t, hostSrv.URL+"/b/playlist.m3u"), "Ronin") {
+		t.Error("playlist under the host mux doesn't list b's file")
+	}
+
+	// each keeps its own metrics
+	for _, e := range []embedded{a, b} {
+		if metrics := get(t, e.baseURL+"/metrics"); !strings.Contains(metrics, "streamer_") {
+			t.Errorf("%s/metrics has no streamer metrics", e.baseURL)
+		}
+	}
+}
+
+func TestServerStartFails(t *testing.T) {
+	t.Parallel()
+
+	// the drive with the library is unplugged
+	cfg := server.DefaultConfig()
+	cfg.Media.UUIDFile = ""
+	cfg.Media.Volumes = []server.VolumeConfig{{ID: "usb", MaxIO: 1, Paths: []string{filepath.Join(t.TempDir(), "unplugged")}}}
+	cfg.Preflight = false
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	srv, err := server.New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), server.WithListener(ln), server.WithHostIP("127.0.0.1"), server.WithoutSignals(), server.WithDiscovery(nopDiscovery{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := srv.Start(t.Context()); !errors.As(err, new(*server.StartupError)) {
+		t.Errorf("Start() error = %v, want a startup error", err)
+	}
+	if err := srv.Shutdown(t.Context()); !errors.As(err, new(*server.StartupError)) {
+		t.Errorf("Shutdown() error = %v, want the startup error again", err)
+	}
+}
+
+func TestServerStartShutdownConcurrent(t *testing.T) {
+	t.Parallel()
+
+	e := newEmbedded(t, "Heat.mp4")
+	ctx, cancel := context.WithTimeout(t.Context(), 30*time.Second)
+	defer cancel()
+
+	// the host stops the server from another goroutine while it is still starting
+	started := make(chan error, 1)
+	go func() { started <- e.srv.Start(ctx) }()
+	for {
+		err := e.srv.Shutdown(ctx)
+		if err == nil || !strings.Contains(err.Error(), "not started") {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case <-started:
+	case <-ctx.Done():
+		t.Fatal("Start() still running after Shutdown")
+	}
+}
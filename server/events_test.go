@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"streamer/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextLibraryEvent reads up to the data line of the next library event
+func nextLibraryEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading events: %v", err)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			return strings.TrimSpace(data)
+		}
+	}
+}
+
+func TestAppEvents(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Heat.mp4"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var body io.ReadCloser
+	t.Run("running", func(t *testing.T) {
+		app, baseURL, _ := startTestServer(t, dir, func(cfg *config.Config) {
+			cfg.HTTP.Timeouts.Write = 100 * time.Millisecond
+		}, WithDiscovery(&fakeDiscovery{}))
+		waitForEntries(t, app, 1)
+
+		resp, err := http.Get(baseURL + "/api/events")
+		if err != nil {
+			t.Fatalf("GET events: %v", err)
+		}
+		body = resp.Body
+		events := bufio.NewReader(body)
+		if got := nextLibraryEvent(t, events); !strings.Contains(got, `"entries":1`) {
+			t.Fatalf("first event = %s, want the scanned file", got)
+		}
+
+		// past the write timeout, the event stream is exempt from it
+		time.Sleep(300 * time.Millisecond)
+		if err := os.WriteFile(filepath.Join(dir, "Alien.mkv"), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		app.api.Media.RescanNow()
+		if got := nextLibraryEvent(t, events); !strings.Contains(got, `"entries":2`) {
+			t.Errorf("event after the rescan = %s, want the new file", got)
+		}
+	})
+
+	// the app stopped with the page still open, the stream ended instead of holding the shutdown up
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(io.Discard, body)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("event stream still open after the app stopped")
+	}
+	body.Close()
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"streamer/internal/pidfile"
+	"strings"
+)
+
+// On SIGUSR2 the server hands its listeners to a new copy of itself: the new process inherits the
+// sockets, says when it is serving, and only then does the old one stop accepting, drain its streams
+// and exit. Connections never see a closed port and renderers never get a byebye
+const (
+	envHandoffFDs    = "STREAMER_HANDOFF_FDS"    // inherited listeners as name=fd pairs, comma separated
+	envHandoffReady  = "STREAMER_HANDOFF_READY"  // fd the new process writes to once it is serving
+	envHandoffBootID = "STREAMER_HANDOFF_BOOTID" // BOOTID.UPNP.ORG of the old process
+)
+
+// handoffFD is a listener passed down by the old process
+type handoffFD struct {
+	name string
+	fd   int
+}
+
+// handoff is what the old process left in the environment
+type handoff struct {
+	listeners []handoffFD
+	readyFD   int
+	bootID    int64
+}
+
+// handoffEnv reads the handoff variables, ok is false when the process wasn't started by an upgrade
+func handoffEnv(getenv func(string) string) (h handoff, ok bool, err error) {
+	fds := getenv(envHandoffFDs)
+	if fds == "" {
+		return handoff{}, false, nil
+	}
+
+	for pair := range strings.SplitSeq(fds, ",") {
+		name, fdStr, found := strings.Cut(pair, "=")
+		fd, err := strconv.Atoi(fdStr)
+		if !found || name == "" || err != nil || fd < 3 {
+			return handoff{}, false, fmt.Errorf("%s: bad entry %q", envHandoffFDs, pair)
+		}
+		h.listeners = append(h.listeners, handoffFD{name: name, fd: fd})
+	}
+
+	h.readyFD, err = strconv.Atoi(getenv(envHandoffReady))
+	if err != nil || h.readyFD < 3 {
+		return handoff{}, false, fmt.Errorf("%s: bad fd %q", envHandoffReady, getenv(envHandoffReady))
+	}
+
+	// only used to go higher, a missing one is no reason to refuse the handoff
+	h.bootID, _ = strconv.ParseInt(getenv(envHandoffBootID), 10, 64)
+
+	return h, true, nil
+}
+
+// encodeHandoffFDs is the envHandoffFDs value for listeners passed in order from fd 3 on
+func encodeHandoffFDs(names []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%d", name, 3+i)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// releasePIDFile gives up the pid file, at exit or for the process taking over on an upgrade
+func (s *Server) releasePIDFile() {
+	if s.pid == nil {
+		return
+	}
+	if err := s.pid.Release(); err != nil {
+		s.logger.Warn("failed to release pid file", "path", s.cfg.PIDFile, "error", err)
+	}
+	s.pid = nil
+}
+
+// reacquirePIDFile takes the pid file back after a failed upgrade
+func (s *Server) reacquirePIDFile() {
+	if s.cfg.PIDFile == "" {
+		return
+	}
+	pid, err := pidfile.Acquire(s.cfg.PIDFile)
+	if err != nil {
+		s.logger.Warn("could not take the pid file back", "path", s.cfg.PIDFile, "error", err)
+		return
+	}
+	s.pid = pid
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// handedOverListeners finds nothing, upgrades by handoff need unix fd passing
+func (s *Server) handedOverListeners() (httpLn, metricsLn net.Listener, err error) {
+	return nil, nil, nil
+}
+
+func (s *Server) signalHandoffReady() {}
+
+func (s *Server) handOff(ctx context.Context, httpLn, metricsLn net.Listener) error {
+	return errors.New("upgrade handoff is only supported on unix")
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestHandoffEnv(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantOK  bool
+		wantErr bool
+		want    handoff
+	}{
+		{"ok - not an upgrade", map[string]string{}, false, false, handoff{}},
+		{"ok - http only", map[string]string{envHandoffFDs: "http=3", envHandoffReady: "4", envHandoffBootID: "1700000000"}, true, false,
+			handoff{listeners: []handoffFD{{"http", 3}}, readyFD: 4, bootID: 1700000000}},
+		{"ok - with metrics", map[string]string{envHandoffFDs: encodeHandoffFDs([]string{"http", "metrics"}), envHandoffReady: "5"}, true, false,
+			handoff{listeners: []handoffFD{{"http", 3}, {"metrics", 4}}, readyFD: 5}},
+		{"fail - stdio fd", map[string]string{envHandoffFDs: "http=1", envHandoffReady: "4"}, false, true, handoff{}},
+		{"fail - no name", map[string]string{envHandoffFDs: "=3", envHandoffReady: "4"}, false, true, handoff{}},
+		{"fail - bad fd", map[string]string{envHandoffFDs: "http=three", envHandoffReady: "4"}, false, true, handoff{}},
+		{"fail - no ready fd", map[string]string{envHandoffFDs: "http=3"}, false, true, handoff{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok, err := handoffEnv(func(k string) string { return tt.env[k] })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handoffEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("handoffEnv() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got.readyFD != tt.want.readyFD || got.bootID != tt.want.bootID || len(got.listeners) != len(tt.want.listeners) {
+				t.Fatalf("handoffEnv() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got.listeners {
+				if got.listeners[i] != tt.want.listeners[i] {
+					t.Errorf("listener %d = %+v, want %+v", i, got.listeners[i], tt.want.listeners[i])
+				}
+			}
+		})
+	}
+}
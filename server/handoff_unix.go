@@ -0,0 +1,183 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"streamer/internal/discovery"
+	"syscall"
+	"time"
+)
+
+// handedOverListeners picks up the listeners of the process this one is upgrading, nil when it was
+// started normally
+func (s *Server) handedOverListeners() (httpLn, metricsLn net.Listener, err error) {
+	h, ok, err := handoffEnv(os.Getenv)
+	if err != nil || !ok {
+		return nil, nil, err
+	}
+
+	// our own children must not pick these up again
+	os.Unsetenv(envHandoffFDs)
+	os.Unsetenv(envHandoffReady)
+	os.Unsetenv(envHandoffBootID)
+
+	httpLn, metricsLn, ready, err := listenersFromHandoff(h)
+	if err != nil {
+		return nil, nil, fmt.Errorf("upgrade handoff: %w", err)
+	}
+
+	discovery.FollowBootID(h.bootID)
+	s.handoffReady = ready
+	return httpLn, metricsLn, nil
+}
+
+func listenersFromHandoff(h handoff) (httpLn, metricsLn net.Listener, ready *os.File, err error) {
+	closeAll := func() {
+		for _, ln := range []net.Listener{httpLn, metricsLn} {
+			if ln != nil {
+				ln.Close()
+			}
+		}
+	}
+
+	for _, l := range h.listeners {
+		ln, err := inheritedFileListener(l.fd, l.name)
+		if err != nil {
+			closeAll()
+			return nil, nil, nil, fmt.Errorf("listener %s (fd %d): %w", l.name, l.fd, err)
+		}
+
+		switch l.name {
+		case "http":
+			httpLn = ln
+		case metricsSocketName:
+			metricsLn = ln
+		default:
+			ln.Close()
+		}
+	}
+
+	if httpLn == nil {
+		closeAll()
+		return nil, nil, nil, errors.New("no http listener handed over")
+	}
+
+	syscall.CloseOnExec(h.readyFD)
+	return httpLn, metricsLn, os.NewFile(uintptr(h.readyFD), "handoff-ready"), nil
+}
+
+func inheritedFileListener(fd int, name string) (net.Listener, error) {
+	syscall.CloseOnExec(fd)
+
+	// FileListener dups the fd, the original can go
+	f := os.NewFile(uintptr(fd), name)
+	defer f.Close()
+
+	return net.FileListener(f)
+}
+
+// signalHandoffReady tells the old process we are serving, it stops accepting and drains from here on
+func (s *Server) signalHandoffReady() {
+	if s.handoffReady == nil {
+		return
+	}
+	if _, err := s.handoffReady.Write([]byte("ready\n")); err != nil {
+		s.logger.Warn("could not tell the old process we are ready", "error", err)
+	}
+	s.handoffReady.Close()
+	s.handoffReady = nil
+}
+
+// handOff starts a new copy of the binary on our listeners and waits until it is serving. On failure,
+// or when ctx is done first, the new process is killed and this one carries on as if nothing happened
+func (s *Server) handOff(ctx context.Context, httpLn, metricsLn net.Listener) error {
+	names := []string{"http"}
+	listeners := []net.Listener{httpLn}
+	if metricsLn != nil {
+		names = append(names, metricsSocketName)
+		listeners = append(listeners, metricsLn)
+	}
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, ln := range listeners {
+		filer, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener %s can't be handed over", ln.Addr())
+		}
+		f, err := filer.File()
+		if err != nil {
+			return fmt.Errorf("dup listener %s: %w", ln.Addr(), err)
+		}
+		files = append(files, f)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("ready pipe: %w", err)
+	}
+	defer readyR.Close()
+	files = append(files, readyW)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("find executable: %w", err)
+	}
+
+	// the same UUID keeps the device the same for renderers, even when it was generated at startup
+	args := append([]string{"-media.uuid", s.cfg.Media.UUID}, os.Args[1:]...)
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		envHandoffFDs+"="+encodeHandoffFDs(names),
+		fmt.Sprintf("%s=%d", envHandoffReady, 3+len(names)),
+		fmt.Sprintf("%s=%d", envHandoffBootID, discovery.BootID()),
+	)
+
+	// the new process takes over the pid file, it can't lock it while we do
+	s.releasePIDFile()
+
+	if err := cmd.Start(); err != nil {
+		s.reacquirePIDFile()
+		return fmt.Errorf("start new process: %w", err)
+	}
+	// only the child's copy of the write end may stay open, or a dying child would go unnoticed
+	readyW.Close()
+
+	s.logger.Info("upgrade: new process started, waiting for it to serve", "pid", cmd.Process.Pid, "timeout", s.cfg.UpgradeTimeout)
+
+	readyR.SetReadDeadline(time.Now().Add(s.cfg.UpgradeTimeout))
+	// called off, the wait ends as if it timed out
+	stopWait := context.AfterFunc(ctx, func() { readyR.SetReadDeadline(time.Now()) })
+	defer stopWait()
+	buf := make([]byte, 16)
+	if _, err := readyR.Read(buf); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		s.reacquirePIDFile()
+		if ctx.Err() != nil {
+			return fmt.Errorf("upgrade called off: %w", ctx.Err())
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("new process not serving after %s", s.cfg.UpgradeTimeout)
+		}
+		return fmt.Errorf("new process exited before serving: %w", err)
+	}
+
+	s.logger.Info("upgrade: new process is serving, handing over", "pid", cmd.Process.Pid)
+	// it outlives us, whoever adopts it reaps it
+	cmd.Process.Release()
+	return nil
+}
@@ -0,0 +1,113 @@
+//go:build unix
+
+package server
+
+import (
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// dupListener returns a fresh fd for ln the way a child process would inherit it
+func dupListener(t *testing.T, ln net.Listener) int {
+	t.Helper()
+
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+func TestListenersFromHandoff(t *testing.T) {
+	t.Parallel()
+
+	// the old process' listeners
+	oldHTTP, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldHTTP.Close()
+	oldMetrics, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldMetrics.Close()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readyR.Close()
+	readyFD, err := syscall.Dup(int(readyW.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readyW.Close()
+
+	h := handoff{
+		listeners: []handoffFD{{"http", dupListener(t, oldHTTP)}, {"metrics", dupListener(t, oldMetrics)}},
+		readyFD:   readyFD,
+	}
+
+	httpLn, metricsLn, ready, err := listenersFromHandoff(h)
+	if err != nil {
+		t.Fatalf("listenersFromHandoff() error = %v", err)
+	}
+	defer httpLn.Close()
+	defer metricsLn.Close()
+
+	// same sockets, same ports
+	if httpLn.Addr().String() != oldHTTP.Addr().String() {
+		t.Errorf("http listener on %s, want %s", httpLn.Addr(), oldHTTP.Addr())
+	}
+	if metricsLn.Addr().String() != oldMetrics.Addr().String() {
+		t.Errorf("metrics listener on %s, want %s", metricsLn.Addr(), oldMetrics.Addr())
+	}
+
+	// the old process stops accepting, connections keep arriving at the new one
+	oldHTTP.Close()
+
+	conn, err := net.Dial("tcp", httpLn.Addr().String())
+	if err != nil {
+		t.Fatalf("dial after the old listener closed: %v", err)
+	}
+	defer conn.Close()
+
+	accepted, err := httpLn.Accept()
+	if err != nil {
+		t.Fatalf("accept on the inherited listener: %v", err)
+	}
+	accepted.Close()
+
+	// the old process waits for this
+	a := &Server{logger: discardLogger(), handoffReady: ready}
+	a.signalHandoffReady()
+
+	got, err := io.ReadAll(readyR)
+	if err != nil || string(got) != "ready\n" {
+		t.Errorf("old process read %q, %v from the ready pipe", got, err)
+	}
+}
+
+func TestListenersFromHandoffWithoutHTTP(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	if _, _, _, err := listenersFromHandoff(handoff{listeners: []handoffFD{{"metrics", dupListener(t, ln)}}, readyFD: 100}); err == nil {
+		t.Error("listenersFromHandoff() without an http listener succeeded")
+	}
+}
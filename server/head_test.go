@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// headers sends method to url and returns the answer, without Date which moves between two requests
+func headers(t *testing.T, client *http.Client, method, url, userAgent string) (int, http.Header, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	resp.Header.Del("Date")
+	return resp.StatusCode, resp.Header, body
+}
+
+func TestAppHEADMatchesGET(t *testing.T) {
+	t.Parallel()
+
+	// enough files for a playlist past what net/http measures by itself
+	dir := t.TempDir()
+	for i := range 40 {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("film %02d.mp4", i)), []byte("0123456789"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app, baseURL, _ := startTestServer(t, dir, nil, WithDiscovery(&fakeDiscovery{}))
+	id := waitForEntries(t, app, 40)[0].UUID.String()
+
+	// keep-alive on, a HEAD answered with a body would break the next request on the connection
+	client := &http.Client{Timeout: 5 * time.Second}
+	defer client.CloseIdleConnections()
+
+	tests := []struct {
+		name      string
+		path      string
+		userAgent string
+	}{
+		{"ok - stream", "/stream?id=" + id, ""},
+		{"ok - direct", "/direct/" + id + ".mp4", ""},
+		{"ok - direct to a renderer", "/direct/" + id + ".mp4", "Samsung DLNADOC/1.50"},
+		{"ok - playlist", "/playlist.m3u", ""},
+		{"ok - description", "/description.xml", ""},
+		{"ok - not found", "/stream?id=0194d3c2-0000-7000-8000-000000000000", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getStatus, get, body := headers(t, client, http.MethodGet, baseURL+tt.path, tt.userAgent)
+			headStatus, head, headBody := headers(t, client, http.MethodHead, baseURL+tt.path, tt.userAgent)
+
+			if headStatus != getStatus {
+				t.Errorf("HEAD status = %d, GET got %d", headStatus, getStatus)
+			}
+			if len(headBody) != 0 {
+				t.Errorf("HEAD body = %q, want none", headBody)
+			}
+			if get.Get("Content-Length") == "" {
+				t.Errorf("GET has no Content-Length for its %d bytes", len(body))
+			}
+			if !maps.EqualFunc(get, head, func(a, b []string) bool { return maps.Equal(toSet(a), toSet(b)) }) {
+				t.Errorf("HEAD headers\n%v\nGET headers\n%v", head, get)
+			}
+		})
+	}
+}
+
+func toSet(values []string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"streamer/internal/config"
+	"streamer/internal/hls"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAppHLS(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Alien.mkv"), []byte("matroska"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// runs until its session is stopped, like ffmpeg on a long file
+	var running atomic.Int32
+	transcode := func(ctx context.Context, input, dir string) error {
+		running.Add(1)
+		defer running.Add(-1)
+		if err := os.WriteFile(filepath.Join(dir, hls.PlaylistName), []byte("#EXTM3U\n"), 0o644); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return nil
+	}
+
+	// registered first so it runs once the app has stopped
+	t.Cleanup(func() {
+		if got := running.Load(); got != 0 {
+			t.Errorf("%d remuxes still running after Run returned", got)
+		}
+	})
+
+	app, baseURL, _ := startTestServer(t, dir, func(cfg *config.Config) {
+		cfg.HLS.Enabled = true
+	}, WithDiscovery(&fakeDiscovery{}), WithTranscoder(transcode))
+	<-app.api.Media.FirstScanDone()
+
+	entries := app.api.Media.Registry.List()
+	if len(entries) != 1 {
+		t.Fatalf("%d entries, want the mkv", len(entries))
+	}
+
+	resp, err := http.Get(baseURL + "/hls/" + entries[0].UUID.String() + "/index.m3u8")
+	if err != nil {
+		t.Fatalf("GET playlist: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("playlist status = %d, want 200", resp.StatusCode)
+	}
+	if got := app.api.HLS.Len(); got != 1 {
+		t.Errorf("%d hls sessions, want 1", got)
+	}
+}
+
+func TestAppHLSWithoutFFmpeg(t *testing.T) {
+	t.Parallel()
+
+	app, baseURL, _ := startTestServer(t, t.TempDir(), func(cfg *config.Config) {
+		cfg.HLS.Enabled = true
+		cfg.HLS.FFmpeg = filepath.Join(t.TempDir(), "no-ffmpeg-here")
+	}, WithDiscovery(&fakeDiscovery{}))
+
+	if app.api.HLS != nil {
+		t.Fatal("hls enabled without ffmpeg")
+	}
+
+	resp, err := http.Get(baseURL + "/hls/00000000-0000-0000-0000-000000000001/index.m3u8")
+	if err != nil {
+		t.Fatalf("GET playlist: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("playlist status = %d, want 404", resp.StatusCode)
+	}
+}
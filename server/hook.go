@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// hookWaitDelay bounds how long a killed hook may keep its output open, e.g. through a child the shell left behind
+const hookWaitDelay = 2 * time.Second
+
+// shutdownReason says what ended Run, it is passed to the shutdown hook
+type shutdownReason string
+
+const (
+	reasonSignal  shutdownReason = "signal"  // ctrl+c, SIGTERM or a service stop
+	reasonTimer   shutdownReason = "timer"   // the shutdown monitor fired
+	reasonUpgrade shutdownReason = "upgrade" // a new process took over the listeners
+	reasonFailure shutdownReason = "failure" // a background component kept panicking
+)
+
+// ShutdownReason reports why Run stopped, empty while it is still running
+func (s *Server) ShutdownReason() shutdownReason {
+	return s.reason
+}
+
+// timerName is the short name of a monitor stop error, passed to the hook in STREAMER_SHUTDOWN_TIMER
+func timerName(err error) string {
+	switch {
+	case errors.Is(err, ErrInactivityLimit):
+		return "inactivity"
+	case errors.Is(err, ErrSleepTimer):
+		return "sleep"
+	case errors.Is(err, ErrScheduledTime):
+		return "scheduled"
+	}
+	return ""
+}
+
+// runShutdownHook runs -shutdown.exec through the shell, with the reason in STREAMER_SHUTDOWN_REASON
+// and the timer that fired in STREAMER_SHUTDOWN_TIMER
+func (s *Server) runShutdownHook() {
+	command := s.cfg.ShutdownTimers.Exec
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimers.ExecTimeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(os.Environ(),
+		"STREAMER_SHUTDOWN_REASON="+string(s.reason),
+		"STREAMER_SHUTDOWN_TIMER="+timerName(s.timer),
+	)
+	cmd.WaitDelay = hookWaitDelay
+
+	s.logger.Info("running shutdown hook", "command", command, "timer", timerName(s.timer), "timeout", s.cfg.ShutdownTimers.ExecTimeout)
+
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		s.logger.Info("shutdown hook finished", "exit_code", 0, "output", output)
+	case ctx.Err() != nil:
+		s.logger.Error("shutdown hook timed out", "timeout", s.cfg.ShutdownTimers.ExecTimeout, "output", output)
+	case errors.As(err, &exitErr):
+		s.logger.Error("shutdown hook failed", "exit_code", exitErr.ExitCode(), "output", output)
+	default:
+		s.logger.Error("shutdown hook could not run", "error", err)
+	}
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"streamer/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func skipWithoutShell(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hook tests use /bin/sh")
+	}
+}
+
+func TestShutdownHookRunsAfterTimer(t *testing.T) {
+	t.Parallel()
+	skipWithoutShell(t)
+
+	out := filepath.Join(t.TempDir(), "hook.out")
+
+	setup := func(cfg *config.Config) {
+		cfg.ShutdownTimers.InactiveLimit = 200 * time.Millisecond
+		cfg.ShutdownTimers.Warning = 0
+		cfg.ShutdownTimers.Exec = `echo "$STREAMER_SHUTDOWN_REASON $STREAMER_SHUTDOWN_TIMER" > ` + out
+	}
+	app, _, stopped := startTestServer(t, t.TempDir(), setup, WithDiscovery(&fakeDiscovery{}))
+
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("inactivity shutdown did not happen")
+	}
+
+	if got := app.ShutdownReason(); got != reasonTimer {
+		t.Errorf("ShutdownReason() = %q, want %q", got, reasonTimer)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook did not run: %v", err)
+	}
+	if got, want := strings.TrimSpace(string(data)), string(reasonTimer)+" inactivity"; got != want {
+		t.Errorf("hook saw %q, want %q", got, want)
+	}
+}
+
+func TestShutdownHookSkippedOnStop(t *testing.T) {
+	t.Parallel()
+	skipWithoutShell(t)
+
+	out := filepath.Join(t.TempDir(), "hook.out")
+
+	setup := func(cfg *config.Config) {
+		cfg.ShutdownTimers.Exec = "touch " + out
+	}
+
+	// the cleanup cancels Run like ctrl+c would, the hook must stay quiet
+	t.Run("stop", func(t *testing.T) {
+		startTestServer(t, t.TempDir(), setup, WithDiscovery(&fakeDiscovery{}))
+	})
+
+	if _, err := os.Stat(out); err == nil {
+		t.Error("hook ran after a ctrl+c style shutdown")
+	}
+}
+
+func TestShutdownHookTimeout(t *testing.T) {
+	t.Parallel()
+	skipWithoutShell(t)
+
+	cfg := config.DefaultConfig()
+	cfg.ShutdownTimers.Exec = "sleep 10"
+	cfg.ShutdownTimers.ExecTimeout = 100 * time.Millisecond
+
+	a := &Server{cfg: cfg, logger: discardLogger(), reason: reasonTimer}
+
+	start := time.Now()
+	a.runShutdownHook()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hook ran for %v, the timeout should have killed it", elapsed)
+	}
+}
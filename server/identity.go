@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"streamer/internal/config"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// where the server UUID came from, for the startup log
+const (
+	uuidFromFlag = "flag"      // -media.uuid
+	uuidFromFile = "file"      // read from -media.uuidFile
+	uuidNew      = "new"       // generated and written to -media.uuidFile
+	uuidOnce     = "generated" // generated for this run only, renderers see a new server after a restart
+)
+
+// resolveUUID settles the UUID renderers know the server by and returns where it came from. One given
+// with -media.uuid wins; otherwise it's read from -media.uuidFile, or generated and written there on the
+// first start, so renderers don't collect a new server on every restart. A file that can't be read or
+// written costs the stable UUID with a warning, not the start
+func resolveUUID(cfg *config.MediaConfig, logger *slog.Logger) (string, error) {
+	if cfg.UUID != "" {
+		return uuidFromFlag, nil
+	}
+
+	if cfg.UUIDFile != "" {
+		id, err := readUUIDFile(cfg.UUIDFile)
+		if err == nil {
+			cfg.UUID = "uuid:" + id.String()
+			return uuidFromFile, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("server uuid file unusable, replacing it", "path", cfg.UUIDFile, "error", err)
+		}
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("generate server uuid: %w", err)
+	}
+	cfg.UUID = "uuid:" + id.String()
+	if cfg.UUIDFile == "" {
+		return uuidOnce, nil
+	}
+
+	if err := writeUUIDFile(cfg.UUIDFile, id); err != nil {
+		logger.Warn("server uuid not kept, renderers will see a new server after a restart", "path", cfg.UUIDFile, "error", err)
+		return uuidOnce, nil
+	}
+	return uuidNew, nil
+}
+
+// readUUIDFile reads the UUID kept at path, with or without its "uuid:" prefix
+func readUUIDFile(path string) (uuid.UUID, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, err := uuid.FromString(strings.TrimPrefix(strings.TrimSpace(string(data)), "uuid:"))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("parse server uuid: %w", err)
+	}
+	return id, nil
+}
+
+// writeUUIDFile keeps id at path, creating its directory
+func writeUUIDFile(path string, id uuid.UUID) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(id.String()+"\n"))
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"streamer/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestResolveUUID(t *testing.T) {
+	t.Parallel()
+
+	const kept = "0194d3c2-0000-7000-8000-000000000001"
+
+	tests := []struct {
+		name       string
+		uuid       string
+		file       func(dir string) string // the -media.uuidFile, set up under dir
+		wantSource string
+		wantUUID   string // empty for any new one
+		wantKept   bool   // the file holds the UUID afterwards
+	}{
+		{"ok - given", "uuid:" + kept, func(dir string) string { return filepath.Join(dir, "uuid") }, uuidFromFlag, "uuid:" + kept, false},
+		{"ok - first start writes it", "", func(dir string) string { return filepath.Join(dir, "streamer", "uuid") }, uuidNew, "", true},
+		{"ok - read back", "", func(dir string) string {
+			path := filepath.Join(dir, "uuid")
+			writeTestFile(t, path, kept+"\n")
+			return path
+		}, uuidFromFile, "uuid:" + kept, true},
+		{"ok - read back with its prefix", "", func(dir string) string {
+			path := filepath.Join(dir, "uuid")
+			writeTestFile(t, path, "uuid:"+kept)
+			return path
+		}, uuidFromFile, "uuid:" + kept, true},
+		{"ok - broken file replaced", "", func(dir string) string {
+			path := filepath.Join(dir, "uuid")
+			writeTestFile(t, path, "not a uuid")
+			return path
+		}, uuidNew, "", true},
+		{"ok - no file", "", func(string) string { return "" }, uuidOnce, "", false},
+		{"ok - unwritable falls back", "", func(dir string) string {
+			// a file where the directory should be
+			writeTestFile(t, filepath.Join(dir, "streamer"), "x")
+			return filepath.Join(dir, "streamer", "uuid")
+		}, uuidOnce, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.MediaConfig{UUID: tt.uuid, UUIDFile: tt.file(t.TempDir())}
+			source, err := resolveUUID(&cfg, discardLogger())
+			if err != nil || source != tt.wantSource {
+				t.Fatalf("resolveUUID() = %q, %v, want %q", source, err, tt.wantSource)
+			}
+			if !strings.HasPrefix(cfg.UUID, "uuid:") || tt.wantUUID != "" && cfg.UUID != tt.wantUUID {
+				t.Errorf("UUID = %q, want %q", cfg.UUID, tt.wantUUID)
+			}
+			if !tt.wantKept {
+				return
+			}
+			id, err := readUUIDFile(cfg.UUIDFile)
+			if err != nil || "uuid:"+id.String() != cfg.UUID {
+				t.Errorf("%s holds %v, %v, want %s", cfg.UUIDFile, id, err, cfg.UUID)
+			}
+		})
+	}
+
+	t.Run("ok - same after a restart", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "uuid")
+		first := config.MediaConfig{UUIDFile: path}
+		second := config.MediaConfig{UUIDFile: path}
+		if _, err := resolveUUID(&first, discardLogger()); err != nil {
+			t.Fatal(err)
+		}
+		if source, err := resolveUUID(&second, discardLogger()); err != nil || source != uuidFromFile || second.UUID != first.UUID {
+			t.Errorf("second start = %q from %q, %v, want %q from the file", second.UUID, source, err, first.UUID)
+		}
+	})
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"streamer/internal/config"
+)
+
+func TestAppKiosk(t *testing.T) {
+	t.Parallel()
+
+	const token = "secret"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string // {id} is the id of the one video
+		body   string
+		// the answer outside kiosk mode, in kiosk mode every mutation is a 404
+		want     int
+		mutation bool
+	}{
+		{"ok - admin page", http.MethodGet, "/admin", "", http.StatusOK, true},
+		{"ok - status", http.MethodGet, "/api/status", "", http.StatusOK, true},
+		{"ok - shutdown status", http.MethodGet, "/api/shutdown", "", http.StatusOK, true},
+		{"ok - cancel shutdown", http.MethodPost, "/api/shutdown/cancel", "", http.StatusOK, true},
+		{"ok - rescan", http.MethodPost, "/api/rescan", "", http.StatusAccepted, true},
+		{"ok - debug didl", http.MethodGet, "/debug/didl", "", http.StatusOK, true},
+		{"ok - create playlist", http.MethodPost, "/api/playlists", "name=Evening&id={id}", http.StatusSeeOther, true},
+		{"ok - delete playlist", http.MethodDelete, "/api/playlists/nope", "", http.StatusNotFound, true},
+		{"ok - save progress", http.MethodPost, "/api/progress/{id}", "position=42", http.StatusOK, true},
+		{"ok - hidden", http.MethodGet, "/api/videos/hidden", "", http.StatusOK, true},
+		{"ok - hide", http.MethodPost, "/api/videos/{id}/hide", "", http.StatusOK, true},
+		{"ok - unhide", http.MethodPost, "/api/videos/{id}/unhide", "", http.StatusOK, true},
+		{"ok - event subscription without a callback", "SUBSCRIBE", "/content/event", "", http.StatusPreconditionFailed, true},
+		{"ok - web", http.MethodGet, "/", "", http.StatusOK, false},
+		{"ok - playlist", http.MethodGet, "/playlist.m3u", "", http.StatusOK, false},
+		{"ok - playlists", http.MethodGet, "/api/playlists", "", http.StatusOK, false},
+		{"ok - description", http.MethodGet, "/description.xml", "", http.StatusOK, false},
+		{"ok - stream", http.MethodGet, "/stream?id={id}", "", http.StatusOK, false},
+		{"ok - progress", http.MethodGet, "/api/progress/{id}", "", http.StatusOK, false},
+		{"ok - stats", http.MethodGet, "/api/stats", "", http.StatusOK, false},
+	}
+
+	for _, kiosk := range []bool{false, true} {
+		t.Run(map[bool]string{false: "full", true: "kiosk"}[kiosk], func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "Heat.mp4"), []byte("0123456789"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			app, baseURL, _ := startTestServer(t, dir, func(cfg *config.Config) {
+				cfg.Admin.Token = token
+				cfg.Kiosk = kiosk
+			}, WithDiscovery(&fakeDiscovery{}))
+			id := waitForEntries(t, app, 1)[0].UUID.String()
+			client := &http.Client{
+				Timeout:       5 * time.Second,
+				CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+			}
+
+			// one at a time, the hide and unhide cases follow each other
+			for _, tt := range tests {
+				req, err := http.NewRequest(tt.method, baseURL+strings.ReplaceAll(tt.path, "{id}", id), strings.NewReader(strings.ReplaceAll(tt.body, "{id}", id)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Authorization", "Bearer "+token)
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+				}
+				resp.Body.Close()
+
+				want := tt.want
+				if kiosk && tt.mutation {
+					want = http.StatusNotFound
+				}
+				if resp.StatusCode != want {
+					t.Errorf("%s: %s %s status = %d, want %d", tt.name, tt.method, tt.path, resp.StatusCode, want)
+				}
+			}
+
+			if got := app.api.Playlists.List(); kiosk != (len(got) == 0) {
+				t.Errorf("%d playlists saved", len(got))
+			}
+		})
+	}
+}
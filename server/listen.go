@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"streamer/internal/preflight"
+	"streamer/internal/systemd"
+	"time"
+)
+
+// metricsSocketName is the FileDescriptorName= that moves /metrics to its own socket
+const metricsSocketName = "metrics"
+
+// inheritedListeners picks up the sockets passed by systemd socket activation. The one named "metrics"
+// serves /metrics, the HTTP one is named "http" or is the first other socket. Both are nil when not
+// socket activated and the server has to bind cfg.HTTP.Addr itself
+func (s *Server) inheritedListeners() (httpLn, metricsLn net.Listener, err error) {
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		return nil, nil, fmt.Errorf("socket activation: %w", err)
+	}
+
+	for _, l := range listeners {
+		switch {
+		case l.Name == metricsSocketName && metricsLn == nil:
+			metricsLn = l.Listener
+		case l.Name == "http" && httpLn == nil:
+			httpLn = l.Listener
+		}
+	}
+	if httpLn == nil {
+		for _, l := range listeners {
+			if l.Listener != metricsLn {
+				httpLn = l.Listener
+				break
+			}
+		}
+	}
+
+	// anything left over is not ours to serve
+	for _, l := range listeners {
+		if l.Listener != httpLn && l.Listener != metricsLn {
+			s.logger.Warn("ignoring inherited socket", "name", l.Name, "addr", l.Addr())
+			l.Close()
+		}
+	}
+
+	if len(listeners) > 0 && httpLn == nil {
+		if metricsLn != nil {
+			metricsLn.Close()
+		}
+		return nil, nil, fmt.Errorf("socket activation: no socket for http among %d inherited", len(listeners))
+	}
+	return httpLn, metricsLn, nil
+}
+
+// listenerPort is the port advertised over SSDP, whatever address the listener ended up on
+func listenerPort(ln net.Listener) (int, error) {
+	addr, ok := ln.Addr().(*net.TCPAddr)
+	if !ok {
+		return 0, fmt.Errorf("listener is not TCP: %s", ln.Addr())
+	}
+	return addr.Port, nil
+}
+
+// boundIP is the IPv4 address the server is bound to, taken from ln when there is one and from addr
+// otherwise. It is empty for wildcard and IPv6 binds (LOCATION urls are built for IPv4) and host names
+func boundIP(ln net.Listener, addr string) string {
+	var ip net.IP
+
+	if ln != nil {
+		tcpAddr, ok := ln.Addr().(*net.TCPAddr)
+		if !ok {
+			return ""
+		}
+		ip = tcpAddr.IP
+	} else {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return ""
+		}
+		ip = net.ParseIP(host)
+	}
+
+	if ip == nil || ip.IsUnspecified() || ip.To4() == nil {
+		return ""
+	}
+	return ip.To4().String()
+}
+
+// maxBindBackoff caps the doubling wait between bind attempts
+const maxBindBackoff = 30 * time.Second
+
+// listenWithRetry binds addr, retrying up to retries times while the port is still in use, e.g. by the
+// socket of a process that just died. Other errors are returned at once
+func listenWithRetry(ctx context.Context, logger *slog.Logger, listen func(network, addr string) (net.Listener, error),
+	addr string, retries int, backoff time.Duration) (net.Listener, error) {
+	delay := backoff
+
+	for attempt := 1; ; attempt++ {
+		ln, err := listen("tcp", addr)
+		if err == nil {
+			if attempt > 1 {
+				logger.Info("bound http port", "addr", addr, "attempt", attempt)
+			}
+			return ln, nil
+		}
+		if !preflight.IsAddrInUse(err) || attempt > retries {
+			return nil, err
+		}
+
+		logger.Warn("http port in use, retrying", "addr", addr, "attempt", attempt, "retries", retries, "in", delay)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("gave up binding %s: %w", addr, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxBindBackoff)
+	}
+}
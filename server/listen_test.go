@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"streamer/internal/config"
+	"syscall"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestListenerPortAndBoundIP(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		addr   string
+		wantIP string
+		ipv6   bool
+	}{
+		{"ok - all interfaces", ":0", "", false},
+		{"ok - ipv4 wildcard", "0.0.0.0:0", "", false},
+		{"ok - ipv4 loopback", "127.0.0.1:0", "127.0.0.1", false},
+		{"ok - host name", "localhost:0", "", false},
+		{"ok - ipv6 wildcard", "[::]:0", "", true},
+		{"ok - ipv6 loopback", "[::1]:0", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ln, err := net.Listen("tcp", tt.addr)
+			if err != nil {
+				if tt.ipv6 {
+					t.Skipf("no IPv6 here: %v", err)
+				}
+				t.Fatalf("listen on %s: %v", tt.addr, err)
+			}
+			defer ln.Close()
+
+			// port 0 must be advertised as the port the kernel picked
+			port, err := listenerPort(ln)
+			if err != nil {
+				t.Fatalf("listenerPort() error = %v", err)
+			}
+			if port == 0 || port != ln.Addr().(*net.TCPAddr).Port {
+				t.Errorf("listenerPort() = %d, listener is on %s", port, ln.Addr())
+			}
+
+			// a host name resolves to loopback, which the listener knows better than the flag
+			want := tt.wantIP
+			if tt.addr == "localhost:0" && ln.Addr().(*net.TCPAddr).IP.To4() != nil {
+				want = "127.0.0.1"
+			}
+			if got := boundIP(ln, tt.addr); got != want {
+				t.Errorf("boundIP(listener) = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestBoundIPFromAddr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		addr string
+		want string
+	}{
+		{"ok - specific ipv4", "192.168.1.50:8081", "192.168.1.50"},
+		{"ok - port only", ":8081", ""},
+		{"ok - ipv4 wildcard", "0.0.0.0:8081", ""},
+		{"ok - ipv6 wildcard", "[::]:8081", ""},
+		{"ok - ipv6 address", "[fe80::1]:8081", ""},
+		{"ok - host name", "media.lan:8081", ""},
+		{"ok - malformed", "8081", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := boundIP(nil, tt.addr); got != tt.want {
+				t.Errorf("boundIP(nil, %q) = %q, want %q", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+// flakyListen fails with err the first failures times, then hands out a loopback listener
+type flakyListen struct {
+	failures int
+	err      error
+	calls    []time.Time
+}
+
+func (f *flakyListen) listen(network, addr string) (net.Listener, error) {
+	f.calls = append(f.calls, time.Now())
+	if len(f.calls) <= f.failures {
+		return nil, f.err
+	}
+	return net.Listen("tcp", "127.0.0.1:0")
+}
+
+// addrInUse returns the error this platform gives for binding a taken port
+func addrInUse(t *testing.T) error {
+	t.Helper()
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	ln, err := net.Listen("tcp", taken.Addr().String())
+	if err == nil {
+		ln.Close()
+		t.Fatal("binding a taken port succeeded")
+	}
+	return err
+}
+
+func TestListenWithRetry(t *testing.T) {
+	t.Parallel()
+
+	inUse := addrInUse(t)
+	denied := &net.OpError{Op: "listen", Net: "tcp", Err: syscall.EACCES}
+
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		retries   int
+		wantErr   bool
+		wantCalls int
+		wantWaits []time.Duration
+	}{
+		{"ok - first attempt", 0, nil, 3, false, 1, nil},
+		{"ok - port frees up", 3, inUse, 5, false, 4, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}},
+		{"fail - retries used up", 10, inUse, 2, true, 3, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}},
+		{"fail - in use without retries", 1, inUse, 0, true, 1, nil},
+		{"fail - other errors are not retried", 1, denied, 5, true, 1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Test(t, func(t *testing.T) {
+				f := &flakyListen{failures: tt.failures, err: tt.err}
+
+				ln, err := listenWithRetry(context.Background(), discardLogger(), f.listen, ":8081", tt.retries, 100*time.Millisecond)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("listenWithRetry() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if ln != nil {
+					ln.Close()
+				}
+
+				if len(f.calls) != tt.wantCalls {
+					t.Fatalf("listen called %d times, want %d", len(f.calls), tt.wantCalls)
+				}
+				for i, want := range tt.wantWaits {
+					if got := f.calls[i+1].Sub(f.calls[i]); got != want {
+						t.Errorf("wait before attempt %d = %v, want %v", i+2, got, want)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestListenWithRetryCancelled(t *testing.T) {
+	t.Parallel()
+
+	inUse := addrInUse(t)
+
+	synctest.Test(t, func(t *testing.T) {
+		f := &flakyListen{failures: 100, err: inUse}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		_, err := listenWithRetry(ctx, discardLogger(), f.listen, ":8081", 100, time.Second)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("listenWithRetry() error = %v, want the ctx error", err)
+		}
+	})
+}
+
+func TestAppEphemeralPort(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.DefaultConfig()
+	cfg.HTTP.Addr = "127.0.0.1:0"
+	cfg.Media.Volumes = []config.VolumeConfig{{ID: "vol", MaxIO: 1, Paths: []string{t.TempDir()}}}
+	cfg.Metrics.Runtime = false
+
+	disc := &fakeDiscovery{}
+	app, err := New(cfg, discardLogger(), WithoutSignals(), WithDiscovery(disc))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- app.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-runErr; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	})
+
+	waitFor(t, "discovery to start", disc.started.Load)
+
+	host, port, err := net.SplitHostPort(app.Addr())
+	if err != nil {
+		t.Fatalf("Addr() = %q: %v", app.Addr(), err)
+	}
+	if host != "127.0.0.1" || port == "0" {
+		t.Fatalf("Addr() = %q, want 127.0.0.1 with the port the OS picked", app.Addr())
+	}
+	if got := strconv.Itoa(int(disc.port.Load())); got != port {
+		t.Errorf("discovery advertises port %s, want %s", got, port)
+	}
+
+	resp, err := http.Get("http://" + app.Addr() + "/api/status")
+	if err != nil {
+		t.Fatalf("GET /api/status: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if status.Address != app.Addr() {
+		t.Errorf("/api/status address = %q, want %q", status.Address, app.Addr())
+	}
+}
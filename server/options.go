@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"streamer/internal/discovery"
+	"streamer/internal/hls"
+	"streamer/internal/supervise"
+)
+
+// Option changes how New wires the Server, without options it runs exactly like the binary
+type Option func(*appOptions)
+
+type appOptions struct {
+	listener  net.Listener
+	clock     clock
+	discovery Discovery
+	hostIP    string
+	signals   bool
+	upgrade   bool
+	transcode hls.Transcoder
+}
+
+func defaultAppOptions() appOptions {
+	return appOptions{
+		clock:   realClock{},
+		signals: true,
+	}
+}
+
+// WithListener serves on ln instead of binding cfg.HTTP.Addr or using a socket-activated one
+func WithListener(ln net.Listener) Option {
+	return func(o *appOptions) { o.listener = ln }
+}
+
+// WithClock sets where the shutdown monitor and the scanner get "now" from
+func WithClock(c clock) Option {
+	return func(o *appOptions) { o.clock = c }
+}
+
+// WithDiscovery replaces SSDP, e.g. with a fake that doesn't touch the network
+func WithDiscovery(d Discovery) Option {
+	return func(o *appOptions) { o.discovery = d }
+}
+
+// WithHostIP skips looking up the outbound IP, it's only used in the advertised URLs
+func WithHostIP(ip string) Option {
+	return func(o *appOptions) { o.hostIP = ip }
+}
+
+// WithoutSignals leaves the process signals alone, Run then stops when its ctx is cancelled
+func WithoutSignals() Option {
+	return func(o *appOptions) { o.signals = false }
+}
+
+// WithUpgrade lets SIGUSR2 hand the listeners to the binary started again with the arguments of this
+// process, for the command whose flags are the server's config. Without it SIGUSR2 is ignored: a program
+// embedding the server has arguments of its own
+func WithUpgrade() Option {
+	return func(o *appOptions) { o.upgrade = true }
+}
+
+// WithTranscoder remuxes /hls with transcode instead of ffmpeg, which then doesn't have to be installed
+func WithTranscoder(transcode hls.Transcoder) Option {
+	return func(o *appOptions) { o.transcode = transcode }
+}
+
+// Discovery advertises the server to renderers on the network
+type Discovery interface {
+	// Start advertises until ctx is done, the returned channel is closed once the goodbyes went out
+	Start(ctx context.Context, hostIP string, port int) <-chan struct{}
+	// Announce re-advertises right away
+	Announce()
+	// Pause says goodbye and stays quiet until Resume, it may be called before Start
+	Pause()
+	// Resume advertises again after a Pause
+	Resume()
+	// HandOff skips the goodbyes when stopping, a new process is announcing the same device
+	HandOff()
+}
+
+// ssdpDiscovery is the real Discovery, NOTIFY broadcasts plus answers to M-SEARCH
+type ssdpDiscovery struct {
+	logger     *slog.Logger
+	deviceUUID string
+	announcer  *discovery.Announcer
+}
+
+func newSSDPDiscovery(logger *slog.Logger, deviceUUID string, sup *supervise.Supervisor) *ssdpDiscovery {
+	announcer := discovery.NewAnnouncer()
+	announcer.Supervisor = sup
+
+	return &ssdpDiscovery{
+		logger:     logger,
+		deviceUUID: deviceUUID,
+		announcer:  announcer,
+	}
+}
+
+func (d *ssdpDiscovery) Start(ctx context.Context, hostIP string, port int) <-chan struct{} {
+	d.announcer.Start(ctx, d.logger, hostIP, port, d.deviceUUID)
+	searchDone := discovery.ListenForSearch(ctx, d.logger, hostIP, port, d.deviceUUID, d.announcer.Paused, d.announcer.Supervisor)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-d.announcer.Done()
+		<-searchDone
+	}()
+	return done
+}
+
+func (d *ssdpDiscovery) Announce() {
+	d.announcer.Announce()
+}
+
+func (d *ssdpDiscovery) Pause() {
+	d.announcer.Pause()
+}
+
+func (d *ssdpDiscovery) Resume() {
+	d.announcer.Resume()
+}
+
+func (d *ssdpDiscovery) HandOff() {
+	d.announcer.HandOff()
+}
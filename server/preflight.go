@@ -0,0 +1,54 @@
+package server
+
+import (
+	"fmt"
+	"streamer/internal/discovery"
+	"streamer/internal/preflight"
+)
+
+// runPreflight checks the environment and logs every problem with a hint. /readyz reports the results,
+// only the failures the server can't start with are returned
+func (s *Server) runPreflight(hostIP string, bind bool) error {
+	report := preflight.Run(s.preflightChecks(hostIP, bind))
+	s.api.SetPreflight(report)
+
+	for _, res := range report {
+		if res.OK() {
+			s.logger.Debug("preflight check passed", "check", res.Name)
+			continue
+		}
+		s.logger.Warn("preflight check failed", "check", res.Name, "error", res.Error, "hint", res.Hint, "fatal", res.Fatal)
+	}
+
+	if err := report.Err(); err != nil {
+		return fmt.Errorf("preflight: %w", err)
+	}
+	if failed := len(report.Failed()); failed > 0 {
+		s.logger.Warn("starting despite failed preflight checks, /readyz reports not ready", "failed", failed)
+	}
+	return nil
+}
+
+// preflightChecks lists what applies to this setup, bind is false when the listener came from elsewhere
+func (s *Server) preflightChecks(hostIP string, bind bool) []preflight.Check {
+	var checks []preflight.Check
+
+	// with retries a busy port may still free up, the bind loop has the final say then
+	if bind && s.cfg.HTTP.BindRetries == 0 {
+		checks = append(checks, preflight.Bindable(s.cfg.HTTP.Addr))
+	}
+
+	// a stand-in discovery doesn't touch multicast
+	if _, ok := s.discovery.(*ssdpDiscovery); ok {
+		checks = append(checks, preflight.Multicast(discovery.MulticastAddr))
+	}
+
+	checks = append(checks, preflight.LocalAddress(hostIP))
+
+	for _, vol := range s.cfg.Media.Volumes {
+		for _, path := range vol.Paths {
+			checks = append(checks, preflight.Directory(path))
+		}
+	}
+	return checks
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"streamer/internal/config"
+	"testing"
+)
+
+func TestAppReadyz(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		setup      func(cfg *config.Config)
+		wantCode   int
+		wantFailed int
+	}{
+		{"ok - all checks pass", nil, http.StatusOK, 0},
+		{"fail - volume not mounted", func(cfg *config.Config) {
+			missing := filepath.Join(t.TempDir(), "unplugged")
+			cfg.Media.Volumes = append(cfg.Media.Volumes, config.VolumeConfig{ID: "usb", MaxIO: 1, Paths: []string{missing}})
+		}, http.StatusServiceUnavailable, 1},
+		{"ok - preflight disabled", func(cfg *config.Config) {
+			cfg.Preflight = false
+			cfg.Media.Volumes = append(cfg.Media.Volumes, config.VolumeConfig{ID: "usb", MaxIO: 1, Paths: []string{"/nonexistent"}})
+		}, http.StatusOK, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			app, baseURL, _ := startTestServer(t, t.TempDir(), tt.setup, WithDiscovery(&fakeDiscovery{}))
+			// /readyz is 503 until the first scan is done too
+			<-app.api.Media.FirstScanDone()
+
+			resp, err := http.Get(baseURL + "/readyz")
+			if err != nil {
+				t.Fatalf("GET /readyz: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+
+			var body struct {
+				Ready  bool `json:"ready"`
+				Checks []struct {
+					Name  string `json:"name"`
+					Error string `json:"error"`
+					Hint  string `json:"hint"`
+				} `json:"checks"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+
+			failed := 0
+			for _, c := range body.Checks {
+				if c.Error != "" {
+					failed++
+					if c.Hint == "" {
+						t.Errorf("check %q failed without a hint", c.Name)
+					}
+				}
+			}
+			if failed != tt.wantFailed {
+				t.Errorf("%d checks failed, want %d: %+v", failed, tt.wantFailed, body.Checks)
+			}
+			if body.Ready != (tt.wantFailed == 0) {
+				t.Errorf("ready = %v with %d failed checks", body.Ready, failed)
+			}
+		})
+	}
+}
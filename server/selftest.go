@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"streamer/internal/config"
+	"streamer/internal/discovery"
+	"streamer/internal/selftest"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// selfTestReadyTimeout is how long the server gets to scan the generated library and report ready
+const selfTestReadyTimeout = 30 * time.Second
+
+// SelfTest boots the server against a generated library and checks it the way a renderer would, over
+// the network: SSDP search, description, Browse and a ranged stream. The report goes to w, an error
+// means a step failed
+func SelfTest(cfg *config.Config, logger *slog.Logger, w io.Writer) error {
+	dir, err := os.MkdirTemp("", "streamer-selftest-")
+	if err != nil {
+		return startupErr(fmt.Errorf("selftest library: %w", err))
+	}
+	defer os.RemoveAll(dir)
+	if _, err := selftest.Library(dir); err != nil {
+		return startupErr(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestReadyTimeout)
+	defer cancel()
+
+	st, err := startSelfTest(ctx, cfg, dir, logger)
+	if err != nil {
+		return startupErr(err)
+	}
+
+	checker := selftest.Checker{BaseURL: st.baseURL, UUID: st.app.cfg.Media.UUID, SSDP: discovery.MulticastAddr}
+	report := checker.Run(context.Background())
+	report.Print(w)
+
+	if err := st.stop(); err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// selfTestServer is the app a selftest runs against
+type selfTestServer struct {
+	app     *Server
+	baseURL string // as advertised, the address renderers would use
+	stop    func() error
+}
+
+// startSelfTest boots the app described by cfg on a free port with dir as its only volume, and returns
+// once it reports ready. Anything that would touch the installed server is off: the pid file, the cache,
+// the serve window and the shutdown hook. It gets a UUID of its own so renderers don't mistake it for
+// the installed server
+func startSelfTest(ctx context.Context, cfg *config.Config, dir string, logger *slog.Logger, opts ...Option) (*selfTestServer, error) {
+	c := *cfg
+	c.Media.Volumes = []config.VolumeConfig{{ID: "selftest", MaxIO: 2, Paths: []string{dir}}}
+	c.Media.Cache = ""
+	c.Media.Startup = config.StartupServeEmpty
+	c.Media.ScanOnStart = config.ScanBlock
+	c.Media.Settle = 0 // the sample was written just now
+	c.Media.FriendlyName = cfg.Media.FriendlyName + " (selftest)"
+	c.Media.UUID = "uuid:" + uuid.Must(uuid.NewV7()).String()
+	c.PIDFile = ""
+	c.Preflight = false
+	c.Serve.Windows = nil
+	c.ShutdownTimers.Exec = ""
+
+	// the host of -http.addr, so the advertised address is the one the installed server would use
+	host, _, err := net.SplitHostPort(cfg.HTTP.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("selftest: %w", err)
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("selftest: listen: %w", err)
+	}
+
+	opts = append([]Option{WithListener(ln), WithoutSignals()}, opts...)
+	app, err := New(&c, logger, opts...)
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("selftest: %w", err)
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	var runErr error
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		runErr = app.Run(runCtx)
+	}()
+	stop := func() error {
+		cancel()
+		<-stopped
+		return runErr
+	}
+
+	// the first scan is done once /readyz says so
+	ready := "http://" + ln.Addr().String() + "/readyz"
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ready, nil)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("selftest: %w", err)
+		}
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				break
+			}
+		}
+
+		select {
+		case <-stopped:
+			if runErr == nil {
+				runErr = errors.New("server stopped before it was ready")
+			}
+			return nil, fmt.Errorf("selftest: %w", runErr)
+		case <-ctx.Done():
+			stop()
+			return nil, fmt.Errorf("selftest: server not ready: %w", ctx.Err())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	return &selfTestServer{app: app, baseURL: "http://" + app.Addr(), stop: stop}, nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"streamer/internal/config"
+	"streamer/internal/selftest"
+	"testing"
+	"time"
+)
+
+func TestSelfTest(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if _, err := selftest.Library(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.HTTP.Addr = "127.0.0.1:0"
+	cfg.Metrics.Runtime = false
+	cfg.Media.UUID = "uuid:00000000-0000-0000-0000-000000000001"
+	cfg.Media.Cache = "/nonexistent/cache.json"
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+	disc := &fakeDiscovery{}
+	st, err := startSelfTest(ctx, cfg, dir, discardLogger(), WithDiscovery(disc), WithHostIP("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("startSelfTest() error = %v", err)
+	}
+	t.Cleanup(func() {
+		if err := st.stop(); err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	})
+
+	// the installed server's identity and cache are left alone
+	if st.app.cfg.Media.UUID == cfg.Media.UUID || st.app.cfg.Media.Cache != "" {
+		t.Errorf("selftest runs with UUID %s and cache %q, want a UUID of its own and no cache", st.app.cfg.Media.UUID, st.app.cfg.Media.Cache)
+	}
+	if !disc.started.Load() {
+		t.Error("discovery not started")
+	}
+
+	// multicast isn't for tests, the search is left out
+	checker := selftest.Checker{BaseURL: st.baseURL, UUID: st.app.cfg.Media.UUID}
+	report := checker.Run(t.Context())
+	if err := report.Err(); err != nil {
+		t.Fatalf("selftest failed: %v", err)
+	}
+
+	var steps []string
+	for _, res := range report {
+		if !res.Skipped {
+			steps = append(steps, res.Step)
+		}
+	}
+	want := []string{selftest.StepDescription, selftest.StepBrowse, selftest.StepStream}
+	if !slices.Equal(steps, want) {
+		t.Errorf("steps taken = %q, want %q", steps, want)
+	}
+}
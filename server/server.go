@@ -0,0 +1,856 @@
+// Package server is the whole media server: the volumes and their scans, SSDP, the HTTP routes and the
+// shutdown timers. cmd/server is a thin wrapper around it, other programs can embed it with New and
+// Start, on their own listener and under their own mux. Every Server has its own metrics registry
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"streamer/internal/api"
+	"streamer/internal/hls"
+	"streamer/internal/media"
+	"streamer/internal/middleware"
+	"streamer/internal/observability"
+	"streamer/internal/pidfile"
+	"streamer/internal/remux"
+	"streamer/internal/schedule"
+	"streamer/internal/supervise"
+	"streamer/internal/systemd"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"streamer/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type Server struct {
+	logger   *slog.Logger
+	api      *api.Handler
+	cfg      *config.Config
+	monitor  *shutdownMonitor
+	registry *prometheus.Registry
+	metrics  *observability.Metrics
+
+	discovery Discovery
+	window    *serveWindow // nil without -serve.window
+	opts      appOptions
+	reason    shutdownReason // why Run stopped, set once the shutdown begins
+	timer     error          // which timer fired when reason is reasonTimer, e.g. ErrSleepTimer
+
+	addr atomic.Value                  // string, host:port renderers are sent to, set once the listener is bound
+	mux  atomic.Pointer[http.ServeMux] // the routes, set once Run has registered them
+
+	started   chan struct{}      // closed once Run serves
+	runDone   chan struct{}      // closed once the Run of Start returned
+	runErr    error              // what it returned
+	startMu   sync.Mutex         // guards cancelRun, Start and Shutdown may come from goroutines of their own
+	cancelRun context.CancelFunc // asks the Run of Start to shut down, nil before Start
+
+	cacheMu    sync.Mutex
+	cacheSaved []byte // the registry cache as last written, saves are skipped while it is unchanged
+
+	supervisor *supervise.Supervisor // runs the background goroutines, restarting them on panics
+	failCh     chan error            // a component kept panicking and was given up on
+	failure    error                 // what failCh delivered, Run returns it after the shutdown
+
+	pid          *pidfile.File // held pid file, nil once handed to an upgraded process
+	upgradeCh    chan struct{} // SIGUSR2 asks for a handoff to a new process
+	handoffReady *os.File      // the old process waits on it when we were started by an upgrade
+}
+
+// Config and VolumeConfig are what New takes, the configuration the flags of the binary fill in. Programs
+// outside this module can't import internal/config, they build theirs from DefaultConfig
+type (
+	Config       = config.Config
+	VolumeConfig = config.VolumeConfig
+)
+
+// DefaultConfig is the configuration of the binary run without flags
+func DefaultConfig() *Config {
+	return config.DefaultConfig()
+}
+
+// StartupError marks failures that happen before the server is serving, e.g. the pid file is locked or
+// the port is taken
+type StartupError struct {
+	Err error
+}
+
+func (e *StartupError) Error() string { return e.Err.Error() }
+func (e *StartupError) Unwrap() error { return e.Err }
+
+func startupErr(err error) error {
+	return &StartupError{Err: err}
+}
+
+// New wires up a server as cfg describes it, nothing runs until Run or Start. The server keeps cfg and
+// fills in what was left to it, like the UUID, so two servers need two configs
+func New(cfg *config.Config, logger *slog.Logger, opts ...Option) (*Server, error) {
+	o := defaultAppOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	uuidSource, err := resolveUUID(&cfg.Media, logger)
+	if err != nil {
+		return nil, err
+	}
+	// renderers tell servers apart by both, two instances sharing either get merged or flip
+	logger.Info("server identity", "friendly_name", cfg.Media.FriendlyName, "uuid", cfg.Media.UUID, "uuid_source", uuidSource)
+
+	// create media Manager with values from cfg
+	myMedia := media.NewManager(
+		cfg.Media.BufferSize,
+		cfg.Media.Mode,
+	)
+	myMedia.Clock = o.clock
+	myMedia.ZeroCopy = cfg.Media.ZeroCopy
+	myMedia.IncrementalScan = cfg.Media.Incremental
+	myMedia.FullScanEvery = cfg.Media.FullEvery
+
+	// private metrics registry so nothing leaks into (or collides with) the global default one
+	registry := observability.NewRegistry(cfg.Metrics.Runtime)
+	metrics := observability.NewMetrics(registry)
+
+	// a component that keeps panicking takes the server down gracefully instead of the process
+	failCh := make(chan error, 1)
+	sup := supervise.New(logger)
+	sup.OnPanic = func(component string) {
+		metrics.ComponentPanics.WithLabelValues(component).Inc()
+	}
+	sup.OnGiveUp = func(component string, err error) {
+		select {
+		case failCh <- err:
+		default:
+		}
+	}
+	myMedia.Supervisor = sup
+	myMedia.BufferSized = func(name string, size int, reason string) {
+		logger.Debug("read buffer sized", "name", name, "size", size, "reason", reason)
+		metrics.ReadBufferSize.WithLabelValues(reason).Observe(float64(size))
+	}
+	myMedia.MinFree = cfg.Media.MinFree
+	myMedia.VolumeScanned = func(id string, scan media.VolumeScan) {
+		metrics.LibraryBytes.WithLabelValues(id).Set(float64(scan.Library))
+		if scan.DiskErr == nil {
+			metrics.VolumeTotalBytes.WithLabelValues(id).Set(float64(scan.Disk.Total))
+			metrics.VolumeFreeBytes.WithLabelValues(id).Set(float64(scan.Disk.Free))
+		}
+	}
+	myMedia.FileGone = func(e media.Entry, err error) {
+		logger.Warn("file gone while streaming, dropped from the library", "name", e.Name, "vol_id", e.MountID, "err", err)
+		metrics.FilesGone.WithLabelValues(e.MountID).Inc()
+	}
+	myMedia.VolumeOffline = func(id string, offline bool, err error) {
+		if offline {
+			logger.Warn("volume offline, its entries are kept until it's back", "vol_id", id, "err", err)
+		} else {
+			logger.Info("volume back online", "vol_id", id)
+		}
+	}
+
+	// the extensions with a media type of their own are videos to the scans too
+	myMedia.Registry.AddExtensions(slices.Collect(maps.Keys(cfg.Media.MediaTypes))...)
+	myMedia.Registry.SetCollation(cfg.Media.Collation)
+	myMedia.Registry.SetJournalSize(cfg.Media.Journal)
+	myMedia.Registry.SetSettle(cfg.Media.Settle)
+
+	for _, volGroup := range cfg.Media.Volumes {
+		ioLimiter := media.NewIOLimiter(volGroup.MaxIO)
+		ioLimiter.Fair = cfg.Media.FairIO
+		ioLimiter.MaxWait = cfg.Media.MaxWait
+
+		for i, rootPath := range volGroup.Paths {
+			mountID := fmt.Sprintf("%s_%d", volGroup.ID, i)
+			myMedia.AddMount(mountID, rootPath, ioLimiter)
+
+			logger.Info("volume mounted", "id", mountID, "path", rootPath, "group_id", volGroup.ID, "max_io", volGroup.MaxIO)
+		}
+	}
+
+	// Map main config to API config
+	apiCfg := api.Config{
+		FriendlyName: cfg.Media.FriendlyName,
+		UUID:         cfg.Media.UUID,
+		Folders:      cfg.Media.Folders,
+		Recent:       cfg.Media.Recent,
+		BrowseMax:    cfg.Media.BrowseMax,
+		WarmUp:       cfg.Media.WarmUp,
+		MediaTypes:   cfg.Media.MediaTypes,
+		Priorities:   cfg.Media.Priorities,
+		ReadOnly:     cfg.Kiosk,
+
+		ExternalURL:    cfg.HTTP.ExternalURL,
+		TrustedProxies: cfg.HTTP.TrustedProxies,
+	}
+
+	// and a Handler from the newly created media Manager together with logger
+	apiHandler, err := api.NewHandler(myMedia, apiCfg, metrics, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to created handler: %w", err)
+	}
+
+	// /hls only exists with ffmpeg around, the web page then links the containers browsers can't play to it
+	if cfg.HLS.Enabled {
+		transcode := o.transcode
+		if transcode == nil {
+			if ffmpeg, err := exec.LookPath(cfg.HLS.FFmpeg); err != nil {
+				logger.Warn("hls disabled, ffmpeg not found", "ffmpeg", cfg.HLS.FFmpeg, "error", err)
+			} else {
+				transcode = hls.FFmpeg(ffmpeg)
+			}
+		}
+		if transcode != nil {
+			apiHandler.HLS = hls.NewManager(transcode, cfg.HLS.Idle, logger)
+		}
+	}
+
+	// renderers refusing MKV are only offered /remux with ffmpeg around, otherwise they get the MKV as before
+	if len(cfg.Remux.NoMKV) > 0 {
+		if ffmpeg, err := exec.LookPath(cfg.Remux.FFmpeg); err != nil {
+			logger.Warn("remux disabled, ffmpeg not found", "ffmpeg", cfg.Remux.FFmpeg, "error", err)
+		} else {
+			apiHandler.Remux = remux.FFmpeg(ffmpeg)
+			apiHandler.NoMKV = cfg.Remux.NoMKV
+		}
+	}
+
+	monitor := NewShutdownMonitor(cfg.ShutdownTimers, logger)
+	monitor.clock = o.clock
+	monitor.gate = apiHandler
+	monitor.supervisor = sup
+	apiHandler.Shutdown = monitor
+
+	disc := o.discovery
+	if disc == nil {
+		disc = newSSDPDiscovery(logger, cfg.Media.UUID, sup)
+	}
+
+	var window *serveWindow
+	if len(cfg.Serve.Windows) > 0 {
+		sched := schedule.Schedule{Windows: cfg.Serve.Windows, Location: cfg.Serve.Location}
+		window = newServeWindow(sched, o.clock, logger, disc, monitor)
+		window.supervisor = sup
+	}
+
+	app := &Server{
+		logger:   logger,
+		api:      apiHandler,
+		cfg:      cfg,
+		monitor:  monitor,
+		registry: registry,
+		metrics:  metrics,
+
+		discovery: disc,
+		window:    window,
+		opts:      o,
+		upgradeCh: make(chan struct{}, 1),
+		started:   make(chan struct{}),
+		runDone:   make(chan struct{}),
+
+		supervisor: sup,
+		failCh:     failCh,
+	}
+
+	// entries keep their UUIDs across restarts, and with them the resume positions
+	if cfg.Media.Cache != "" {
+		app.restoreCache()
+	}
+	myMedia.AfterScan = app.pruneBookmarks
+
+	return app, nil
+}
+
+// Addr is the host:port the server advertises, with the port it really got when -http.addr asked for
+// :0. It is empty until Run has bound the listener
+func (s *Server) Addr() string {
+	addr, _ := s.addr.Load().(string)
+	return addr
+}
+
+// Handler serves the routes of the server, for a program embedding it to mount under its own mux. They
+// are there once Start returned, before that every request gets a 503
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux := s.mux.Load()
+		if mux == nil {
+			http.Error(w, "server not started", http.StatusServiceUnavailable)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Start runs the server in the background and returns once it serves, or with the error that kept it
+// from starting. ctx only bounds the start, cancelling it before then stops the server again. A program
+// embedding it that handles the signals itself passes WithoutSignals to New
+func (s *Server) Start(ctx context.Context) error {
+	s.startMu.Lock()
+	if s.cancelRun != nil {
+		s.startMu.Unlock()
+		return errors.New("server already started")
+	}
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	s.cancelRun = cancel
+	s.startMu.Unlock()
+
+	go func() {
+		defer close(s.runDone)
+		s.runErr = s.Run(runCtx)
+	}()
+
+	select {
+	case <-s.started:
+		return nil
+	case <-s.runDone:
+		return s.runErr
+	case <-ctx.Done():
+		cancel()
+		<-s.runDone
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops a server started with Start the way a signal would: discovery says byebye, streams get
+// the drain timeout, and it returns what Run returned. When ctx ends first Shutdown returns its error
+// and the server goes on stopping in the background
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.startMu.Lock()
+	cancelRun := s.cancelRun
+	s.startMu.Unlock()
+	if cancelRun == nil {
+		return errors.New("server not started")
+	}
+	cancelRun()
+
+	select {
+	case <-s.runDone:
+		return s.runErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) Run(rootCtx context.Context) error {
+	// two instances would announce the same UUID, the lock keeps the second one out
+	if s.cfg.PIDFile != "" {
+		pid, err := pidfile.Acquire(s.cfg.PIDFile)
+		if err != nil {
+			return startupErr(err)
+		}
+		s.pid = pid
+		// after an upgrade the new process owns it
+		defer s.releasePIDFile()
+	}
+
+	// create ctx watching ctrl+c, cancelling rootCtx asks for the same graceful shutdown
+	var (
+		ctx  context.Context
+		stop context.CancelFunc
+	)
+	if s.opts.signals {
+		ctx, stop = signal.NotifyContext(rootCtx, os.Interrupt, syscall.SIGTERM)
+	} else {
+		ctx, stop = context.WithCancel(rootCtx)
+	}
+	defer stop()
+
+	// subsystems don't stop with ctx but when the shutdown sequence gets to them
+	baseCtx := context.WithoutCancel(rootCtx)
+
+	// an injected listener wins, then those of the process we are upgrading, then the sockets systemd may
+	// own, then binding cfg.HTTP.Addr ourselves. The port advertised over SSDP comes from whichever it is
+	httpLn, metricsLn := s.opts.listener, net.Listener(nil)
+	socketActivated, handedOver := false, false
+	if httpLn == nil {
+		var err error
+		httpLn, metricsLn, err = s.handedOverListeners()
+		if err != nil {
+			return startupErr(err)
+		}
+		handedOver = httpLn != nil
+	}
+	if httpLn == nil {
+		var err error
+		httpLn, metricsLn, err = s.inheritedListeners()
+		if err != nil {
+			return startupErr(err)
+		}
+		socketActivated = httpLn != nil
+	}
+
+	// advertise the address we are bound to, the outbound IP only when listening on all interfaces
+	hostIP := s.opts.hostIP
+	if hostIP == "" {
+		hostIP = boundIP(httpLn, s.cfg.HTTP.Addr)
+	}
+	if hostIP == "" {
+		ip, err := getLocalIP()
+		if err != nil {
+			return startupErr(fmt.Errorf("failed to determine local IP: %w", err))
+		}
+		hostIP = ip
+	}
+
+	// everything that can be checked up front is, so all problems show up in one go
+	if s.cfg.Preflight {
+		if err := s.runPreflight(hostIP, httpLn == nil); err != nil {
+			return startupErr(err)
+		}
+	}
+
+	// with the drive that holds the media unplugged there is nothing to serve
+	if err := s.checkVolumes(); err != nil {
+		return startupErr(err)
+	}
+
+	if httpLn == nil {
+		var err error
+		// bind up front so readiness is only reported once the port is really ours, and discovery
+		// only announces a port we hold
+		httpLn, err = listenWithRetry(ctx, s.logger, net.Listen, s.cfg.HTTP.Addr, s.cfg.HTTP.BindRetries, s.cfg.HTTP.BindBackoff)
+		if err != nil {
+			return startupErr(fmt.Errorf("listen on %s: %w", s.cfg.HTTP.Addr, err))
+		}
+	}
+
+	// Serve would close the listener too, the wrapper lets shutdown stop accepting before that.
+	// An upgrade hands over the unwrapped one
+	rawHTTPLn := httpLn
+	httpLn = &closeOnceListener{Listener: httpLn}
+
+	// the real port, -http.addr :0 leaves the pick to the OS
+	serverPort, err := listenerPort(httpLn)
+	if err != nil {
+		return startupErr(err)
+	}
+	advertised := net.JoinHostPort(hostIP, strconv.Itoa(serverPort))
+	s.addr.Store(advertised)
+	s.api.SetAddress(advertised)
+
+	if err := s.monitor.Start(baseCtx); err != nil {
+		return startupErr(fmt.Errorf("start shutdown monitor: %w", err))
+	}
+	defer s.monitor.Stop()
+
+	scanCtx, stopScanning := context.WithCancel(baseCtx)
+	defer stopScanning()
+	scanDone := s.api.Media.StartScanning(scanCtx, s.logger)
+	s.initialScan(ctx)
+	go s.logLibrary(scanCtx)
+
+	var cacheDone <-chan struct{}
+	cacheCtx, stopCache := context.WithCancel(baseCtx)
+	defer stopCache()
+	if s.cfg.Media.Cache != "" {
+		cacheDone = s.supervisor.Go(cacheCtx, "cache", s.runCache)
+	}
+
+	// remuxes may feed draining streams, their temp dirs are gone once Run returns
+	if s.api.HLS != nil {
+		hlsCtx, stopHLS := context.WithCancel(baseCtx)
+		hlsDone := s.supervisor.Go(hlsCtx, "hls", s.api.HLS.Run)
+		defer func() {
+			stopHLS()
+			<-hlsDone
+			// Run doesn't get to it when the reaper was given up on
+			s.api.HLS.Close()
+		}()
+	}
+
+	// discovery gets its own ctx so byebye can be sent before the HTTP server goes away
+	discoveryCtx, stopDiscovery := context.WithCancel(baseCtx)
+	defer stopDiscovery()
+
+	// outside the serving window discovery must start paused, not announce and take it back
+	var windowDone <-chan struct{}
+	windowCtx, stopWindow := context.WithCancel(baseCtx)
+	defer stopWindow()
+	if s.window != nil {
+		s.window.update()
+		windowDone = s.window.start(windowCtx)
+	}
+
+	startDiscovery := func() <-chan struct{} {
+		return s.discovery.Start(discoveryCtx, hostIP, serverPort)
+	}
+
+	// renderers would remember an empty library, so with -media.startup=wait they only hear of us
+	// once there is media
+	var discoveryDone <-chan struct{}
+	if s.cfg.Media.Startup == config.StartupWait {
+		discoveryDone = s.waitForVolumes(discoveryCtx, startDiscovery)
+	} else {
+		discoveryDone = startDiscovery()
+	}
+
+	// SIGHUP and SIGUSR1, next to the shutdown signals above
+	if s.opts.signals {
+		s.handleSignals(ctx, s.discovery)
+	}
+
+	// setup router
+	mux := http.NewServeMux()
+
+	// Create the limiter (e.g., 20 req/sec, burst of 50)
+	// TODO fix magicNumbers
+	limiter := middleware.NewIPRateLimiter(ctx, 20, 50, s.cfg.HTTP.TrustedProxy)
+
+	defaultStack := []middleware.Middleware{
+		middleware.WithObservability(s.metrics),
+		middleware.WithRejections(s.api),
+		limiter.Middleware,
+		middleware.WithLogging(s.logger),
+		middleware.WithHEAD,
+	}
+
+	// every route tells the monitor which class of request it serves, the ones set in shutdown.ignore
+	// (discovery, what idle tvs poll all night) don't keep the server up.
+	// renderer facing routes are closed outside the serving window, status and admin stay reachable
+	publicStack := func(class middleware.ActivityClass) []middleware.Middleware {
+		stack := append(slices.Clone(defaultStack), middleware.WithActivity(s.monitor, class))
+		if s.window != nil {
+			stack = append(stack, middleware.WithGate(s.window))
+		}
+		return stack
+	}
+
+	handle := func(pattern string, class middleware.ActivityClass, handler http.HandlerFunc) {
+		finalHandler := middleware.Chain(http.HandlerFunc(handler), publicStack(class)...)
+		mux.Handle(pattern, finalHandler)
+	}
+
+	// an open web ui page listens on /api/events for as long as it is open, that alone must not keep the
+	// server up, so it doesn't count as activity
+	eventsStack := slices.Clone(defaultStack)
+	if s.window != nil {
+		eventsStack = append(eventsStack, middleware.WithGate(s.window))
+	}
+
+	// the icons and robots.txt browsers and scanners fetch by themselves are no activity, and not worth a
+	// log line or a metric
+	junkStack := []middleware.Middleware{limiter.Middleware}
+
+	// streams can run for hours on one request so they hold the inactivity timer while in flight
+	streamStack := append(publicStack(middleware.ActivityStream), middleware.WithStreamTracking(s.monitor))
+
+	handleStream := func(pattern string, handler http.HandlerFunc) {
+		finalHandler := middleware.Chain(http.HandlerFunc(handler), streamStack...)
+		mux.Handle(pattern, finalHandler)
+	}
+
+	// no middlewares for metrics! a dedicated socket keeps them off the public port
+	metricsHandler := promhttp.InstrumentMetricHandler(s.registry, promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}))
+
+	var metricsSrv *http.Server
+	if metricsLn != nil {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", metricsHandler)
+		metricsSrv = &http.Server{
+			Handler:     metricsMux,
+			ReadTimeout: s.cfg.HTTP.Timeouts.Read,
+			IdleTimeout: s.cfg.HTTP.Timeouts.Idle,
+		}
+	} else {
+		mux.Handle("GET /metrics", metricsHandler)
+	}
+
+	// probes must not count as activity, so no middlewares here either
+	mux.HandleFunc("GET /readyz", s.api.HandleReady)
+
+	handleStream("/stream", s.api.Stream)
+	handleStream("/direct/", s.api.AdapterDirectStream)
+	handleStream("GET /download/{uuid}", s.api.HandleDownload)
+	handleStream("GET /files/{path...}", s.api.HandleFiles)
+	handleStream("GET /remux/{file}", s.api.HandleRemux)
+
+	// in kiosk mode the routes that administer, store something or list what was hidden are never
+	// registered, whatever the token, so they fall through to the 404 of /
+	handleUnlessKiosk := func(pattern string, class middleware.ActivityClass, handler http.HandlerFunc) {
+		if !s.cfg.Kiosk {
+			handle(pattern, class, handler)
+		}
+	}
+
+	adminActivity := middleware.WithActivity(s.monitor, middleware.ActivityAdmin)
+	if !s.cfg.Kiosk {
+		mux.Handle("GET /api/status", middleware.Chain(http.HandlerFunc(s.api.HandleStatus), append(slices.Clone(defaultStack), adminActivity)...))
+	}
+	mux.Handle("GET /api/stats", middleware.Chain(http.HandlerFunc(s.api.HandleStats), append(slices.Clone(defaultStack), adminActivity)...))
+
+	// admin routes need the token on top of the default stack
+	adminStack := append(slices.Clone(defaultStack), adminActivity, middleware.RequireToken(s.cfg.Admin.Token))
+
+	handleAdmin := func(pattern string, handler http.HandlerFunc) {
+		if s.cfg.Kiosk {
+			return
+		}
+		finalHandler := middleware.Chain(http.HandlerFunc(handler), adminStack...)
+		mux.Handle(pattern, finalHandler)
+	}
+
+	handleAdmin("GET /admin", s.api.HandleAdmin)
+	handleAdmin("GET /api/shutdown", s.api.HandleShutdownStatus)
+	handleAdmin("POST /api/shutdown", s.api.HandleShutdownSchedule)
+	handleAdmin("POST /api/shutdown/cancel", s.api.HandleShutdownCancel)
+	handleAdmin("POST /api/rescan", s.api.HandleRescan)
+	handleAdmin("GET /debug/didl", s.api.HandleDebugDIDL)
+
+	if s.api.HLS != nil {
+		handle("GET /hls/{uuid}/{file}", middleware.ActivityStream, s.api.HandleHLS)
+	}
+
+	handle("/playlist.m3u", middleware.ActivityPlaylist, s.api.HandleM3U)
+	handle("/playlist.xspf", middleware.ActivityPlaylist, s.api.HandleXSPF)
+	handle("/playlist.pls", middleware.ActivityPlaylist, s.api.HandlePLS)
+	handle("GET /feed.xml", middleware.ActivityPlaylist, s.api.HandleFeed)
+	handle("GET /playlist/{file...}", middleware.ActivityPlaylist, s.api.HandlePlaylistM3U)
+	handle("GET /api/playlists", middleware.ActivityPlaylist, s.api.HandlePlaylists)
+	handleUnlessKiosk("POST /api/playlists", middleware.ActivityPlaylist, s.api.HandleCreatePlaylist)
+	handleUnlessKiosk("DELETE /api/playlists/{id}", middleware.ActivityPlaylist, s.api.HandleDeletePlaylist)
+	handle("/description.xml", middleware.ActivityDiscovery, s.api.HandleXML)
+
+	handle("/content", middleware.ActivityDiscovery, s.api.HandleSCPD)
+	handleUnlessKiosk("/content/event", middleware.ActivityDiscovery, s.api.HandleContentEvent)
+	handle("/content/control", middleware.ActivityBrowse, s.api.HandleDummyControl)
+
+	handle("/connection", middleware.ActivityDiscovery, s.api.HandleConnectionSCPD)
+	handleUnlessKiosk("/connection/event", middleware.ActivityDiscovery, s.api.HandleConnectionEvent)
+	handle("/connection/control", middleware.ActivityDiscovery, s.api.HandleDummyControl)
+
+	handle("GET /static/", middleware.ActivityWeb, s.api.HandleStatic)
+	handle("GET /qr.png", middleware.ActivityWeb, s.api.HandleQR)
+	handle("GET /api/progress/{uuid}", middleware.ActivityWeb, s.api.HandleProgress)
+	handleUnlessKiosk("POST /api/progress/{uuid}", middleware.ActivityWeb, s.api.HandleProgress)
+	handle("GET /web/items", middleware.ActivityWeb, s.api.HandleWebItems)
+	handle("GET /watch/{uuid}", middleware.ActivityWeb, s.api.HandleWatch)
+	handle("GET /thumb/{uuid}", middleware.ActivityWeb, s.api.HandleThumb)
+	handle("GET /api/categories", middleware.ActivityWeb, s.api.HandleCategories)
+	handle("GET /api/changes", middleware.ActivityWeb, s.api.HandleChanges)
+	handleUnlessKiosk("GET /api/videos/hidden", middleware.ActivityWeb, s.api.HandleHidden)
+	handleUnlessKiosk("POST /api/videos/{uuid}/hide", middleware.ActivityWeb, s.api.HandleHide)
+	handleUnlessKiosk("POST /api/videos/{uuid}/unhide", middleware.ActivityWeb, s.api.HandleUnhide)
+	mux.Handle("GET /api/events", middleware.Chain(http.HandlerFunc(s.api.HandleEvents), eventsStack...))
+	for _, path := range api.JunkPaths {
+		mux.Handle("GET "+path, middleware.Chain(http.HandlerFunc(s.api.HandleJunk), junkStack...))
+	}
+	handle("/", middleware.ActivityWeb, s.api.HandleWeb)
+
+	s.mux.Store(mux)
+
+	srv := &http.Server{
+		Handler:      mux,
+		Addr:         s.cfg.HTTP.Addr,
+		ReadTimeout:  s.cfg.HTTP.Timeouts.Read,
+		IdleTimeout:  s.cfg.HTTP.Timeouts.Idle,
+		WriteTimeout: s.cfg.HTTP.Timeouts.Write,
+	}
+
+	// run the server
+	errChan := make(chan error, 1)
+	// serving goes false when Serve returns, stopping marks that it is meant to
+	var serving, stopping atomic.Bool
+	serving.Store(true)
+
+	go func() {
+		defer close(errChan)
+		defer serving.Store(false)
+
+		s.logger.Info("starting", "addr", httpLn.Addr().String(), "advertised", advertised, "socket_activated", socketActivated, "handed_over", handedOver, "kiosk", s.cfg.Kiosk)
+		if err := srv.Serve(httpLn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errChan <- fmt.Errorf("server closed unexpectedly: %w", err)
+		}
+	}()
+
+	// metrics are not worth taking the server down for
+	if metricsSrv != nil {
+		go func() {
+			s.logger.Info("serving metrics", "addr", metricsLn.Addr().String())
+			if err := metricsSrv.Serve(metricsLn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.logger.Error("metrics server stopped", "error", err)
+			}
+		}()
+	}
+
+	// the listener is bound and discovery is running, tell systemd (Type=notify) we are up
+	notifier := systemd.NewNotifier()
+	if handedOver {
+		// we are the service's process now, this needs NotifyAccess=all
+		if err := notifier.Notify(fmt.Sprintf("MAINPID=%d", os.Getpid())); err != nil {
+			s.logger.Warn("sd_notify mainpid failed", "error", err)
+		}
+	}
+	if err := notifier.Ready(); err != nil {
+		s.logger.Warn("sd_notify ready failed", "error", err)
+	}
+	s.signalHandoffReady()
+	close(s.started)
+
+	// the watchdog outlives ctx, draining streams can take longer than WatchdogSec
+	watchdogCtx, stopWatchdog := context.WithCancel(baseCtx)
+	defer stopWatchdog()
+	s.startWatchdog(watchdogCtx, notifier, func() bool { return serving.Load() || stopping.Load() })
+
+	// a handoff waits up to UpgradeTimeout for the new process, it runs on its own so signals, failures and
+	// the timers are still seen meanwhile. One at a time, SIGUSR2 waits in upgradeCh until it's over
+	handoffCtx, cancelHandoff := context.WithCancel(baseCtx)
+	defer cancelHandoff()
+	upgradeCh := s.upgradeCh
+	var handoffDone chan error
+
+	// wait for shutdown signal, server error or a successful upgrade
+	for s.reason == "" {
+		select {
+		case <-ctx.Done():
+			// restore default signal behaviour so a second ctrl+c kills the process without draining
+			stop()
+			s.reason = reasonSignal
+			s.logger.Info("shutting down gracefully...", "delay", s.cfg.HTTP.Timeouts.Shutdown)
+		case err := <-errChan:
+			return err
+		case err := <-s.failCh:
+			s.reason, s.failure = reasonFailure, err
+			s.logger.Error("component failed for good, shutting down", "error", err)
+		case err := <-s.monitor.StopCh:
+			s.reason, s.timer = reasonTimer, err
+			s.logger.Info("auto-shutdown triggered", "reason", err, "timer", timerName(err))
+		case <-upgradeCh:
+			upgradeCh, handoffDone = nil, make(chan error, 1)
+			go func() { handoffDone <- s.handOff(handoffCtx, rawHTTPLn, metricsLn) }()
+		case err := <-handoffDone:
+			upgradeCh, handoffDone = s.upgradeCh, nil
+			if err != nil {
+				s.logger.Error("upgrade failed, carrying on", "error", err)
+				continue
+			}
+			s.reason = reasonUpgrade
+			// the new process announces the same device, renderers must not drop it
+			s.discovery.HandOff()
+		}
+	}
+
+	// stopping for another reason calls off a handoff still waiting, the new process is killed
+	if handoffDone != nil {
+		cancelHandoff()
+		if err := <-handoffDone; err == nil {
+			s.logger.Warn("upgrade: new process took over while shutting down", "reason", s.reason)
+		}
+	}
+
+	stopping.Store(true)
+
+	// after an upgrade the service isn't stopping, it just changed hands
+	if s.reason != reasonUpgrade {
+		if err := notifier.Stopping(); err != nil {
+			s.logger.Warn("sd_notify stopping failed", "error", err)
+		}
+	}
+
+	// order matters: renderers get byebye while streams still play, the monitor goes last so nothing
+	// is left running unobserved
+	components := []component{
+		{name: "serve window", stop: func(ctx context.Context) error {
+			// it would otherwise resume discovery in the middle of the shutdown
+			stopWindow()
+			if windowDone == nil {
+				return nil
+			}
+			return waitDone(ctx, windowDone)
+		}},
+		{name: "http accept", stop: func(ctx context.Context) error {
+			// new streams are refused from here on, in-flight requests keep going
+			s.api.BeginDrain()
+			if err := httpLn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			return nil
+		}},
+		{name: "discovery", stop: func(ctx context.Context) error {
+			stopDiscovery()
+			return waitDone(ctx, discoveryDone)
+		}},
+		{name: "streams", timeout: s.cfg.HTTP.Timeouts.Drain, stop: func(ctx context.Context) error {
+			s.drainStreams(ctx)
+			return nil
+		}},
+		{name: "http", stop: func(ctx context.Context) error {
+			if metricsSrv != nil {
+				if err := metricsSrv.Shutdown(ctx); err != nil {
+					s.logger.Warn("metrics server shutdown", "error", err)
+				}
+			}
+			return srv.Shutdown(ctx)
+		}},
+		{name: "scanner", stop: func(ctx context.Context) error {
+			stopScanning()
+			return waitDone(ctx, scanDone)
+		}},
+		{name: "cache", stop: func(ctx context.Context) error {
+			if cacheDone == nil {
+				return nil
+			}
+			stopCache()
+			if err := waitDone(ctx, cacheDone); err != nil {
+				return err
+			}
+			// the positions saved by the players that just stopped
+			return s.saveCache()
+		}},
+		{name: "monitor", stop: func(ctx context.Context) error {
+			s.monitor.Stop()
+			return nil
+		}},
+	}
+
+	if err := stopComponents(s.logger, s.cfg.HTTP.Timeouts.Shutdown, components); err != nil {
+		return fmt.Errorf("shutdown error: %w", err)
+	}
+
+	s.logger.Info("server stopped", "reason", s.reason, "timer", timerName(s.timer))
+
+	// only a timer shutdown means nobody is around, ctrl+c must not power the machine off
+	if s.reason == reasonTimer && s.cfg.ShutdownTimers.Exec != "" {
+		s.runShutdownHook()
+	}
+	return s.failure
+}
+
+// drainStreams waits for in-flight streams to finish, ctx carries the drain timeout
+func (s *Server) drainStreams(ctx context.Context) {
+	active := s.api.ActiveStreams()
+	if active == 0 {
+		return
+	}
+
+	s.logger.Info("waiting for active streams to finish", "active", active, "timeout", s.cfg.HTTP.Timeouts.Drain)
+
+	if err := s.api.WaitForStreams(ctx); err != nil {
+		s.logger.Warn("drain timeout reached, cutting remaining streams", "active", s.api.ActiveStreams())
+		return
+	}
+	s.logger.Info("all streams finished")
+}
+
+func getLocalIP() (string, error) {
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err != nil {
+		return "", fmt.Errorf("get local IP: %w", err)
+	}
+	defer conn.Close()
+
+	localAddr := conn.LocalAddr().(*net.UDPAddr)
+	return localAddr.IP.String(), nil
+}
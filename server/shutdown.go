@@ -0,0 +1,527 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"streamer/internal/api"
+	"streamer/internal/config"
+	"streamer/internal/middleware"
+	"streamer/internal/supervise"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// what the monitor sends on StopCh, one per timer
+	ErrInactivityLimit = errors.New("inactivity limit reached")
+	ErrSleepTimer      = errors.New("sleep timer elapsed")
+	ErrScheduledTime   = errors.New("scheduled shutdown time reached")
+
+	ErrMonitorRunning     = errors.New("shutdown monitor already running")
+	errShutdownTimeInPast = errors.New("shutdown time is in the past")
+)
+
+// clock is where the monitor gets "now" from, tests pin it to a fixed instant
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+type shutdownMonitor struct {
+	cfg        config.ShutdownTimersConfig // guarded by mu, replaced by Restart
+	logger     *slog.Logger
+	clock      clock
+	gate       streamGate            // optional, refuses new streams during a non-cancellable warning
+	supervisor *supervise.Supervisor // optional, restarts the run loop when it panics
+	activityCh chan struct{}         // signals activity
+	streamCh   chan struct{}         // signals a change in the number of active streams
+	scheduleCh chan struct{}         // signals the deadline was changed from outside
+	reloadCh   chan struct{}         // signals cfg was replaced by Reload
+	streams    atomic.Int64          // active streams, the inactivity timer is on hold while non-zero
+	StopCh     chan error            // it's time to stop
+
+	mu             sync.Mutex
+	deadline       time.Time // scheduled shutdown (sleep timer / shutdown.at), zero if none
+	deadlineReason error     // which timer set the deadline, ErrSleepTimer or ErrScheduledTime
+	warningReason  error     // why the server is about to stop
+	warningAt      time.Time // when it will stop, zero outside the warning phase
+
+	runMu  sync.Mutex
+	cancel context.CancelFunc // stops the running goroutine, nil before the first Start
+	done   <-chan struct{}    // closed once the goroutine has exited
+}
+
+func NewShutdownMonitor(cfg config.ShutdownTimersConfig, l *slog.Logger) *shutdownMonitor {
+	return &shutdownMonitor{
+		cfg:        cfg,
+		logger:     l,
+		clock:      realClock{},
+		activityCh: make(chan struct{}, 1),
+		streamCh:   make(chan struct{}, 1),
+		scheduleCh: make(chan struct{}, 1),
+		reloadCh:   make(chan struct{}, 1),
+		StopCh:     make(chan error, 1),
+	}
+}
+
+// NotifyActivity resets the inactivity timer, unless requests of this class are set to be ignored
+func (s *shutdownMonitor) NotifyActivity(class middleware.ActivityClass) {
+	s.mu.Lock()
+	ignored := slices.Contains(s.cfg.Ignore, class)
+	s.mu.Unlock()
+	if ignored {
+		return
+	}
+	nudge(s.activityCh)
+}
+
+// StreamStarted puts the inactivity timer on hold until the matching StreamEnded
+func (s *shutdownMonitor) StreamStarted() {
+	s.streams.Add(1)
+	// the count lives in s.streams so a dropped signal loses nothing
+	nudge(s.streamCh)
+}
+
+// StreamEnded releases the hold, the inactivity countdown restarts once the last stream ends
+func (s *shutdownMonitor) StreamEnded() {
+	s.streams.Add(-1)
+	nudge(s.streamCh)
+}
+
+// HoldInactivity puts the inactivity timer on hold the way a stream does, until ReleaseInactivity
+func (s *shutdownMonitor) HoldInactivity() {
+	s.StreamStarted()
+}
+
+// ReleaseInactivity undoes a HoldInactivity
+func (s *shutdownMonitor) ReleaseInactivity() {
+	s.StreamEnded()
+}
+
+// Reschedule moves the scheduled shutdown to the given time, replacing the sleep timer or shutdown.at
+func (s *shutdownMonitor) Reschedule(at time.Time) {
+	s.schedule(at, ErrScheduledTime)
+}
+
+func (s *shutdownMonitor) schedule(at time.Time, reason error) {
+	s.mu.Lock()
+	s.deadline = at
+	s.deadlineReason = reason
+	s.mu.Unlock()
+
+	nudge(s.scheduleCh)
+}
+
+// CancelShutdown drops the scheduled shutdown and any running warning. The inactivity limit stays in place
+func (s *shutdownMonitor) CancelShutdown() {
+	s.Reschedule(time.Time{})
+}
+
+// nudge does a non-blocking send, the receiving loop only needs to know something changed
+func nudge(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+const (
+	defaultTimerDuration = 24 * 365 * 100 * time.Hour // long long
+	noTimeout            = time.Duration(0)
+)
+
+// streamGate lets the monitor stop new streams from starting during the shutdown warning
+type streamGate interface {
+	RefuseStreams(reason string)
+	AcceptStreams()
+}
+
+// ShutdownStatus reports the current schedule and an upcoming shutdown while the warning phase is running
+func (s *shutdownMonitor) ShutdownStatus() api.ShutdownStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := api.ShutdownStatus{
+		Scheduled:     s.deadline,
+		InactiveLimit: s.cfg.InactiveLimit.String(),
+	}
+
+	if !s.warningAt.IsZero() {
+		status.Pending = true
+		status.Reason = s.warningReason.Error()
+		status.At = s.warningAt
+	}
+	return status
+}
+
+func (s *shutdownMonitor) setWarning(reason error, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.warningReason = reason
+	s.warningAt = at
+}
+
+func (s *shutdownMonitor) getDeadline() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deadline
+}
+
+func (s *shutdownMonitor) getDeadlineReason() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deadlineReason
+}
+
+// effectiveDeadline picks the earliest of shutdown.at and the sleep timer, zero if neither is set.
+// reason says which one it was. It fails when shutdown.at has already passed
+func effectiveDeadline(cfg config.ShutdownTimersConfig, now time.Time) (deadline time.Time, reason error, err error) {
+	// user provided a value for time to end
+	if !cfg.TimeToEnd.IsZero() {
+		if now.After(cfg.TimeToEnd) {
+			return time.Time{}, nil, errShutdownTimeInPast
+		}
+		deadline, reason = cfg.TimeToEnd, ErrScheduledTime
+	}
+
+	// user provides a timer duration
+	if cfg.SleepTimer > 0 {
+		// choose the earliest between the timeToEnd and sleepTimer
+		sleepDeadline := now.Add(cfg.SleepTimer)
+		if deadline.IsZero() || sleepDeadline.Before(deadline) {
+			deadline, reason = sleepDeadline, ErrSleepTimer
+		}
+	}
+	return deadline, reason, nil
+}
+
+// inactivityDuration is how long the inactivity timer runs before the warning phase starts
+func inactivityDuration(cfg config.ShutdownTimersConfig) time.Duration {
+	// user provides an inactivity limit
+	if cfg.InactiveLimit > 0 {
+		return min(defaultTimerDuration, max(noTimeout, cfg.InactiveLimit-max(noTimeout, cfg.Warning)))
+	}
+	return defaultTimerDuration
+}
+
+// Reload applies new timers to the running monitor. The inactivity limit counts from the last activity,
+// so a shorter one may fire right away. A changed sleep timer or shutdown.at replaces the scheduled
+// shutdown and is computed from now, removing both cancels it. Unchanged, they leave a schedule set
+// through the admin api alone
+func (s *shutdownMonitor) Reload(cfg config.ShutdownTimersConfig) error {
+	now := s.clock.Now()
+	if !cfg.TimeToEnd.IsZero() {
+		cfg.TimeToEnd = nextTimeOfDay(cfg.TimeToEnd, now)
+	}
+
+	s.mu.Lock()
+	old := s.cfg
+	s.cfg = cfg
+	s.mu.Unlock()
+
+	nudge(s.reloadCh)
+
+	if old.SleepTimer == cfg.SleepTimer && timeOfDay(old.TimeToEnd) == timeOfDay(cfg.TimeToEnd) {
+		return nil
+	}
+
+	deadline, reason, err := effectiveDeadline(cfg, now)
+	if err != nil {
+		return fmt.Errorf("reload shutdown timers: %w", err)
+	}
+	s.schedule(deadline, reason)
+	return nil
+}
+
+// nextTimeOfDay moves t to the next time the wall clock shows its time of day after now
+func nextTimeOfDay(t, now time.Time) time.Time {
+	now = now.In(t.Location())
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// timeOfDay is what shutdown.at was set to, ignoring which day it was resolved to
+func timeOfDay(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.TimeOnly)
+}
+
+// Start runs the monitor until it fires StopCh, ctx is cancelled or Stop is called.
+// A stopped monitor can be started again, starting a running one fails
+func (s *shutdownMonitor) Start(ctx context.Context) error {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	if s.done != nil {
+		select {
+		case <-s.done:
+		default:
+			return ErrMonitorRunning
+		}
+	}
+
+	// worked out here rather than in run, a restart after a panic must keep the schedule
+	s.mu.Lock()
+	cfg := s.cfg
+	s.mu.Unlock()
+
+	deadline, reason, err := effectiveDeadline(cfg, s.clock.Now())
+
+	s.mu.Lock()
+	s.deadline = deadline
+	s.deadlineReason = reason
+	s.mu.Unlock()
+
+	run := s.run
+	if err != nil {
+		// if it happens in the past, fail fast
+		run = func(ctx context.Context) {
+			s.logger.Warn("shutdown time is in the past; shutting down immediately")
+			select {
+			case s.StopCh <- ErrScheduledTime:
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.done = s.supervisor.Go(runCtx, "shutdown monitor", run)
+	return nil
+}
+
+// Stop ends the monitor goroutine and waits for it to exit. It's a no-op if the monitor isn't running
+func (s *shutdownMonitor) Stop() {
+	s.runMu.Lock()
+	cancel, done := s.cancel, s.done
+	s.runMu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Restart stops the monitor and starts it again with a fresh config
+func (s *shutdownMonitor) Restart(ctx context.Context, cfg config.ShutdownTimersConfig) error {
+	s.Stop()
+
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+
+	return s.Start(ctx)
+}
+
+func (s *shutdownMonitor) run(ctx context.Context) {
+	s.mu.Lock()
+	cfg := s.cfg
+	deadline := s.deadline
+	s.mu.Unlock()
+
+	// the warning phase eats into the timers so the server still stops when it was told to
+	warningDuration := max(noTimeout, cfg.Warning)
+
+	// untilWarning is how long the deadline timer has to wait for a given deadline
+	untilWarning := func(deadline time.Time) time.Duration {
+		if deadline.IsZero() {
+			return defaultTimerDuration
+		}
+		return max(noTimeout, deadline.Sub(s.clock.Now())-warningDuration)
+	}
+
+	deadlineTimer := time.NewTimer(untilWarning(deadline))
+	defer deadlineTimer.Stop()
+
+	inactivityDurationToEnd := inactivityDuration(cfg)
+	inactivityTimer := time.NewTimer(inactivityDurationToEnd)
+	defer inactivityTimer.Stop()
+	idleSince := s.clock.Now() // when the inactivity countdown last started
+
+	s.logger.Info("shutdown monitor started",
+		"inactive_limit", cfg.InactiveLimit,
+		"sleep_timer", cfg.SleepTimer,
+		"warning", warningDuration)
+
+	// stopTimer prevents a timer from firing
+	stopTimer := func(t *time.Timer) {
+		if !t.Stop() {
+			// timer was stopped
+			select {
+			// if there a value in the channel, we consume it so it becomes empty
+			case <-t.C:
+				// prevents blocking if there was no value in the channel
+			default:
+			}
+		}
+	}
+
+	// warning phase state, a nil channel blocks forever so the case stays idle until a warning starts
+	var (
+		warningTimer       *time.Timer
+		warningC           <-chan time.Time
+		warningCancellable bool
+		warningReason      error
+		streamsRefused     bool
+	)
+
+	stopWarning := func() {
+		if warningTimer != nil {
+			warningTimer.Stop()
+		}
+		warningTimer, warningC = nil, nil
+		s.setWarning(nil, time.Time{})
+
+		if streamsRefused {
+			s.gate.AcceptStreams()
+			streamsRefused = false
+		}
+	}
+	defer stopWarning()
+
+	// beginWarning starts the countdown to StopCh. Inactivity warnings can be called off by new activity,
+	// deadline ones can't and may refuse new streams instead
+	beginWarning := func(reason error, cancellable bool) {
+		stopWarning()
+
+		at := s.clock.Now().Add(warningDuration)
+		s.setWarning(reason, at)
+		s.logger.Warn("server shutting down soon", "reason", reason, "in", warningDuration, "at", at.Format(time.TimeOnly), "cancellable", cancellable)
+
+		if !cancellable && cfg.WarningRefuse && s.gate != nil {
+			s.gate.RefuseStreams(fmt.Sprintf("server is shutting down at %s", at.Format("15:04")))
+			streamsRefused = true
+		}
+
+		warningTimer = time.NewTimer(warningDuration)
+		warningC = warningTimer.C
+		warningCancellable = cancellable
+		warningReason = reason
+	}
+
+	cancelWarning := func() {
+		if warningC == nil || !warningCancellable {
+			return
+		}
+		stopWarning()
+		s.logger.Info("shutdown warning cancelled, activity detected")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Debug("shutdown monitor stopped")
+			return
+
+		case <-s.activityCh:
+			cancelWarning()
+			// while streams are active the timer is on hold and must stay that way
+			if s.streams.Load() > 0 {
+				continue
+			}
+			// activity detected so prevent the timer from firing
+			stopTimer(inactivityTimer)
+			inactivityTimer.Reset(inactivityDurationToEnd)
+			idleSince = s.clock.Now()
+			s.logger.Debug("activity detected, timer reset")
+
+		case <-s.streamCh:
+			stopTimer(inactivityTimer)
+			if active := s.streams.Load(); active > 0 {
+				cancelWarning()
+				s.logger.Debug("streams active, inactivity timer on hold", "active", active)
+				continue
+			}
+			// last stream ended, start counting again from now
+			inactivityTimer.Reset(inactivityDurationToEnd)
+			idleSince = s.clock.Now()
+			s.logger.Debug("streams finished, inactivity timer restarted")
+
+		case <-s.scheduleCh:
+			// whoever changed the schedule wants the server up, so any running warning goes too
+			stopWarning()
+			stopTimer(deadlineTimer)
+
+			deadline := s.getDeadline()
+			deadlineTimer.Reset(untilWarning(deadline))
+
+			if deadline.IsZero() {
+				s.logger.Info("scheduled shutdown cancelled")
+			} else {
+				s.logger.Info("shutdown rescheduled", "at", deadline.Format(time.DateTime))
+			}
+
+		case <-s.reloadCh:
+			s.mu.Lock()
+			cfg = s.cfg
+			s.mu.Unlock()
+
+			warningDuration = max(noTimeout, cfg.Warning)
+			inactivityDurationToEnd = inactivityDuration(cfg)
+
+			s.logger.Info("shutdown timers reloaded",
+				"inactive_limit", cfg.InactiveLimit,
+				"sleep_timer", cfg.SleepTimer,
+				"warning", warningDuration)
+
+			// a running warning keeps its time, the server is about to stop either way
+			if warningC != nil {
+				continue
+			}
+
+			// a new warning length moves the deadline timer, a new deadline comes through scheduleCh
+			stopTimer(deadlineTimer)
+			deadlineTimer.Reset(untilWarning(s.getDeadline()))
+
+			// the countdown keeps its start, only its length changes. On hold there is nothing to move
+			if s.streams.Load() > 0 {
+				continue
+			}
+			stopTimer(inactivityTimer)
+			inactivityTimer.Reset(max(noTimeout, idleSince.Add(inactivityDurationToEnd).Sub(s.clock.Now())))
+
+		case <-inactivityTimer.C:
+			// a stream may have started right as the timer fired, or a warning is already running
+			if s.streams.Load() > 0 || warningC != nil {
+				continue
+			}
+			// inactivity limit reached
+			s.logger.Info("timer limit reached")
+			beginWarning(ErrInactivityLimit, true)
+
+		case <-deadlineTimer.C:
+			// the far-future placeholder firing means nothing was scheduled
+			if s.getDeadline().IsZero() {
+				continue
+			}
+			// deadline reached
+			s.logger.Info("deadline reached")
+			beginWarning(s.getDeadlineReason(), false)
+
+		case <-warningC:
+			// streams stay refused, the server is going down
+			streamsRefused = false
+			s.logger.Info("shutdown warning elapsed", "reason", warningReason)
+			// StopCh may still hold the reason of an earlier run nobody read, Stop mustn't wait on that
+			select {
+			case s.StopCh <- warningReason:
+			case <-ctx.Done():
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,769 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"streamer/internal/config"
+	"streamer/internal/middleware"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// stopped reports whether the monitor has asked for a shutdown, without blocking
+func stopped(m *shutdownMonitor) bool {
+	select {
+	case <-m.StopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestShutdownMonitorStreamHoldsInactivity(t *testing.T) {
+	// synctest runs the monitor against a fake clock, time only moves when every goroutine is blocked
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		m := NewShutdownMonitor(config.ShutdownTimersConfig{InactiveLimit: 30 * time.Minute}, discardLogger())
+		m.Start(ctx)
+
+		// a three hour film on a single request
+		m.NotifyActivity(middleware.ActivityWeb)
+		m.StreamStarted()
+		time.Sleep(3 * time.Hour)
+		synctest.Wait()
+
+		if stopped(m) {
+			t.Fatal("monitor stopped while a stream was active")
+		}
+
+		// countdown resumes from the end of the stream
+		m.StreamEnded()
+		time.Sleep(29 * time.Minute)
+		synctest.Wait()
+
+		if stopped(m) {
+			t.Fatal("monitor stopped before the inactivity limit elapsed after the stream ended")
+		}
+
+		time.Sleep(2 * time.Minute)
+		synctest.Wait()
+
+		if !stopped(m) {
+			t.Fatal("monitor did not stop after the inactivity limit elapsed")
+		}
+	})
+}
+
+func TestShutdownMonitorActivityDuringStream(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		m := NewShutdownMonitor(config.ShutdownTimersConfig{InactiveLimit: 10 * time.Minute}, discardLogger())
+		m.Start(ctx)
+
+		m.StreamStarted()
+		synctest.Wait()
+
+		// other requests arriving mid-stream must not restart the countdown
+		m.NotifyActivity(middleware.ActivityWeb)
+		time.Sleep(time.Hour)
+		synctest.Wait()
+
+		if stopped(m) {
+			t.Fatal("monitor stopped while a stream was active")
+		}
+
+		m.StreamEnded()
+		time.Sleep(10*time.Minute + time.Second)
+		synctest.Wait()
+
+		if !stopped(m) {
+			t.Fatal("monitor did not stop after the stream ended and the limit elapsed")
+		}
+	})
+}
+
+func TestShutdownMonitorIgnoredActivity(t *testing.T) {
+	tests := []struct {
+		name        string
+		class       middleware.ActivityClass
+		wantStopped bool
+	}{
+		{"ok - description fetches are ignored", middleware.ActivityDiscovery, true},
+		{"ok - a browse resets the timer", middleware.ActivityBrowse, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(t.Context())
+				defer cancel()
+
+				cfg := config.ShutdownTimersConfig{
+					InactiveLimit: 30 * time.Minute,
+					Ignore:        []middleware.ActivityClass{middleware.ActivityDiscovery},
+				}
+				m := NewShutdownMonitor(cfg, discardLogger())
+				m.Start(ctx)
+
+				// a tv polling every five minutes
+				for range 5 {
+					time.Sleep(5 * time.Minute)
+					m.NotifyActivity(tt.class)
+				}
+				time.Sleep(5*time.Minute + time.Second)
+				synctest.Wait()
+
+				if got := stopped(m); got != tt.wantStopped {
+					t.Errorf("stopped after 30 minutes = %v, want %v", got, tt.wantStopped)
+				}
+			})
+		})
+	}
+}
+
+// fakeGate records the reason new streams were refused with
+type fakeGate struct {
+	mu     sync.Mutex
+	reason string
+}
+
+func (f *fakeGate) RefuseStreams(reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reason = reason
+}
+
+func (f *fakeGate) AcceptStreams() { f.RefuseStreams("") }
+
+func (f *fakeGate) refused() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reason != ""
+}
+
+func TestShutdownMonitorDeadlineWarning(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		cfg := config.ShutdownTimersConfig{
+			SleepTimer:    2 * time.Hour,
+			Warning:       time.Minute,
+			WarningRefuse: true,
+		}
+		gate := &fakeGate{}
+
+		m := NewShutdownMonitor(cfg, discardLogger())
+		m.gate = gate
+		m.Start(ctx)
+
+		time.Sleep(2*time.Hour - 30*time.Second)
+		synctest.Wait()
+
+		status := m.ShutdownStatus()
+		if !status.Pending {
+			t.Fatal("ShutdownStatus().Pending = false during the warning phase")
+		}
+		if !gate.refused() {
+			t.Error("new streams were not refused during a scheduled shutdown warning")
+		}
+
+		// activity can't call off a deadline
+		m.NotifyActivity(middleware.ActivityWeb)
+		time.Sleep(31 * time.Second)
+		synctest.Wait()
+
+		if !stopped(m) {
+			t.Fatal("monitor did not stop at the deadline")
+		}
+	})
+}
+
+func TestShutdownMonitorInactivityWarningCancelled(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		cfg := config.ShutdownTimersConfig{
+			InactiveLimit: 30 * time.Minute,
+			Warning:       time.Minute,
+			WarningRefuse: true,
+		}
+		gate := &fakeGate{}
+
+		m := NewShutdownMonitor(cfg, discardLogger())
+		m.gate = gate
+		m.Start(ctx)
+
+		time.Sleep(29*time.Minute + 30*time.Second)
+		synctest.Wait()
+
+		if !m.ShutdownStatus().Pending {
+			t.Fatal("ShutdownStatus().Pending = false during the warning phase")
+		}
+		if gate.refused() {
+			t.Error("inactivity warning refused new streams, it should stay cancellable")
+		}
+
+		// a new stream arrives and calls the shutdown off
+		m.StreamStarted()
+		synctest.Wait()
+
+		if m.ShutdownStatus().Pending {
+			t.Fatal("ShutdownStatus().Pending = true after activity cancelled the warning")
+		}
+
+		time.Sleep(time.Hour)
+		synctest.Wait()
+
+		if stopped(m) {
+			t.Fatal("monitor stopped although the warning was cancelled")
+		}
+
+		m.StreamEnded()
+		time.Sleep(30 * time.Minute)
+		synctest.Wait()
+
+		if !stopped(m) {
+			t.Fatal("monitor did not stop after the inactivity limit")
+		}
+	})
+}
+
+func TestShutdownMonitorReschedule(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		cfg := config.ShutdownTimersConfig{
+			SleepTimer:    time.Hour,
+			Warning:       time.Minute,
+			WarningRefuse: true,
+		}
+		gate := &fakeGate{}
+
+		m := NewShutdownMonitor(cfg, discardLogger())
+		m.gate = gate
+		m.Start(ctx)
+
+		// in the warning phase of the original deadline
+		time.Sleep(time.Hour - 30*time.Second)
+		synctest.Wait()
+
+		if !m.ShutdownStatus().Pending {
+			t.Fatal("ShutdownStatus().Pending = false during the warning phase")
+		}
+
+		// the film runs long, push it back
+		postponed := time.Now().Add(30 * time.Minute)
+		m.Reschedule(postponed)
+		synctest.Wait()
+
+		status := m.ShutdownStatus()
+		if status.Pending {
+			t.Error("warning still pending after rescheduling")
+		}
+		if !status.Scheduled.Equal(postponed) {
+			t.Errorf("ShutdownStatus().Scheduled = %v, want %v", status.Scheduled, postponed)
+		}
+		if gate.refused() {
+			t.Error("streams still refused after rescheduling")
+		}
+
+		time.Sleep(29*time.Minute + 30*time.Second)
+		synctest.Wait()
+
+		if stopped(m) {
+			t.Fatal("monitor stopped before the rescheduled deadline")
+		}
+
+		time.Sleep(31 * time.Second)
+		synctest.Wait()
+
+		if !stopped(m) {
+			t.Fatal("monitor did not stop at the rescheduled deadline")
+		}
+	})
+}
+
+func TestShutdownMonitorCancel(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		m := NewShutdownMonitor(config.ShutdownTimersConfig{SleepTimer: time.Hour}, discardLogger())
+		m.Start(ctx)
+
+		time.Sleep(30 * time.Minute)
+		m.CancelShutdown()
+		synctest.Wait()
+
+		if !m.ShutdownStatus().Scheduled.IsZero() {
+			t.Error("ShutdownStatus().Scheduled is set after CancelShutdown")
+		}
+
+		time.Sleep(24 * time.Hour)
+		synctest.Wait()
+
+		if stopped(m) {
+			t.Fatal("monitor stopped although the shutdown was cancelled")
+		}
+
+		// schedule again so the monitor goroutine exits before the bubble ends
+		m.Reschedule(time.Now().Add(time.Minute))
+		time.Sleep(time.Minute)
+		synctest.Wait()
+
+		if !stopped(m) {
+			t.Fatal("monitor did not stop at the new deadline")
+		}
+	})
+}
+
+// fixedClock pins "now", the timers themselves still run on the synctest clock
+type fixedClock struct{ now time.Time }
+
+func (c fixedClock) Now() time.Time { return c.now }
+
+var testNow = time.Date(2026, time.March, 14, 20, 0, 0, 0, time.UTC)
+
+func TestEffectiveDeadline(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		cfg        config.ShutdownTimersConfig
+		want       time.Time
+		wantReason error
+		wantErr    error
+	}{
+		{"ok - nothing scheduled", config.ShutdownTimersConfig{InactiveLimit: time.Hour}, time.Time{}, nil, nil},
+		{"ok - sleep timer only", config.ShutdownTimersConfig{SleepTimer: 90 * time.Minute}, testNow.Add(90 * time.Minute), ErrSleepTimer, nil},
+		{"ok - time to end only", config.ShutdownTimersConfig{TimeToEnd: testNow.Add(3 * time.Hour)}, testNow.Add(3 * time.Hour), ErrScheduledTime, nil},
+		{"ok - sleep timer earlier than time to end", config.ShutdownTimersConfig{SleepTimer: time.Hour, TimeToEnd: testNow.Add(2 * time.Hour)}, testNow.Add(time.Hour), ErrSleepTimer, nil},
+		{"ok - time to end earlier than sleep timer", config.ShutdownTimersConfig{SleepTimer: 4 * time.Hour, TimeToEnd: testNow.Add(2 * time.Hour)}, testNow.Add(2 * time.Hour), ErrScheduledTime, nil},
+		{"ok - time to end is now", config.ShutdownTimersConfig{TimeToEnd: testNow}, testNow, ErrScheduledTime, nil},
+		{"fail - time to end in the past", config.ShutdownTimersConfig{TimeToEnd: testNow.Add(-time.Minute)}, time.Time{}, nil, errShutdownTimeInPast},
+		{"fail - past time to end wins over sleep timer", config.ShutdownTimersConfig{SleepTimer: time.Hour, TimeToEnd: testNow.Add(-time.Minute)}, time.Time{}, nil, errShutdownTimeInPast},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, reason, err := effectiveDeadline(tt.cfg, testNow)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("effectiveDeadline() error = %v, want %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("effectiveDeadline() = %v, want %v", got, tt.want)
+			}
+			if reason != tt.wantReason {
+				t.Errorf("effectiveDeadline() reason = %v, want %v", reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestShutdownMonitorStopReason(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		cfg   config.ShutdownTimersConfig
+		setup func(m *shutdownMonitor)
+		want  error
+		after time.Duration
+	}{
+		{"ok - inactivity", config.ShutdownTimersConfig{InactiveLimit: time.Hour, Warning: time.Minute}, nil, ErrInactivityLimit, time.Hour},
+		{"ok - sleep timer", config.ShutdownTimersConfig{InactiveLimit: 3 * time.Hour, SleepTimer: time.Hour, Warning: time.Minute}, nil, ErrSleepTimer, time.Hour},
+		{"ok - shutdown.at", config.ShutdownTimersConfig{TimeToEnd: testNow.Add(time.Hour)}, nil, ErrScheduledTime, time.Hour},
+		{"ok - shutdown.at before the sleep timer", config.ShutdownTimersConfig{SleepTimer: 2 * time.Hour, TimeToEnd: testNow.Add(time.Hour)}, nil, ErrScheduledTime, time.Hour},
+		{"ok - shutdown.at already passed", config.ShutdownTimersConfig{TimeToEnd: testNow.Add(-time.Minute)}, nil, ErrScheduledTime, 0},
+		{"ok - rescheduled via api", config.ShutdownTimersConfig{SleepTimer: 3 * time.Hour}, func(m *shutdownMonitor) {
+			m.Reschedule(testNow.Add(time.Hour))
+		}, ErrScheduledTime, time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Test(t, func(t *testing.T) {
+				m := NewShutdownMonitor(tt.cfg, discardLogger())
+				// the fake clock starts at testNow and moves with the synctest one
+				start := time.Now()
+				m.clock = offsetClock{base: testNow, start: start}
+				m.Start(t.Context())
+				synctest.Wait()
+
+				if tt.setup != nil {
+					tt.setup(m)
+				}
+
+				select {
+				case got := <-m.StopCh:
+					if got != tt.want {
+						t.Errorf("StopCh sent %v, want %v", got, tt.want)
+					}
+					if elapsed := time.Since(start); elapsed != tt.after {
+						t.Errorf("stopped after %v, want %v", elapsed, tt.after)
+					}
+				case <-time.After(4 * time.Hour):
+					t.Fatal("monitor never stopped")
+				}
+				m.Stop()
+			})
+		})
+	}
+}
+
+func TestInactivityDuration(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  config.ShutdownTimersConfig
+		want time.Duration
+	}{
+		{"ok - no limit", config.ShutdownTimersConfig{}, defaultTimerDuration},
+		{"ok - no limit with warning", config.ShutdownTimersConfig{Warning: time.Minute}, defaultTimerDuration},
+		{"ok - limit without warning", config.ShutdownTimersConfig{InactiveLimit: 30 * time.Minute}, 30 * time.Minute},
+		{"ok - warning eats into the limit", config.ShutdownTimersConfig{InactiveLimit: 30 * time.Minute, Warning: time.Minute}, 29 * time.Minute},
+		{"ok - warning longer than the limit", config.ShutdownTimersConfig{InactiveLimit: time.Minute, Warning: 5 * time.Minute}, noTimeout},
+		{"ok - negative warning is ignored", config.ShutdownTimersConfig{InactiveLimit: time.Minute, Warning: -time.Minute}, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := inactivityDuration(tt.cfg); got != tt.want {
+				t.Errorf("inactivityDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestShutdownMonitorPrecedence runs the whole loop, the earliest of the three timers must win
+func TestShutdownMonitorPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.ShutdownTimersConfig
+		wantStop time.Duration
+	}{
+		{"ok - inactivity only", config.ShutdownTimersConfig{InactiveLimit: 30 * time.Minute}, 30 * time.Minute},
+		{"ok - sleep timer before inactivity", config.ShutdownTimersConfig{InactiveLimit: 2 * time.Hour, SleepTimer: 45 * time.Minute}, 45 * time.Minute},
+		{"ok - inactivity before sleep timer", config.ShutdownTimersConfig{InactiveLimit: 20 * time.Minute, SleepTimer: time.Hour}, 20 * time.Minute},
+		{"ok - time to end before sleep timer", config.ShutdownTimersConfig{SleepTimer: 3 * time.Hour, TimeToEnd: testNow.Add(time.Hour)}, time.Hour},
+		{"ok - time to end before everything", config.ShutdownTimersConfig{InactiveLimit: 2 * time.Hour, SleepTimer: 3 * time.Hour, TimeToEnd: testNow.Add(10 * time.Minute)}, 10 * time.Minute},
+		{"ok - warning included in the total", config.ShutdownTimersConfig{SleepTimer: time.Hour, Warning: 5 * time.Minute}, time.Hour},
+		{"ok - time to end in the past stops at once", config.ShutdownTimersConfig{TimeToEnd: testNow.Add(-time.Hour)}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				m := NewShutdownMonitor(tt.cfg, discardLogger())
+				m.clock = fixedClock{now: testNow}
+				if err := m.Start(t.Context()); err != nil {
+					t.Fatalf("Start() error = %v", err)
+				}
+				defer m.Stop()
+
+				if tt.wantStop > 0 {
+					time.Sleep(tt.wantStop - time.Second)
+					synctest.Wait()
+					if stopped(m) {
+						t.Fatalf("monitor stopped before %v", tt.wantStop)
+					}
+				}
+
+				time.Sleep(time.Second)
+				synctest.Wait()
+				if !stopped(m) {
+					t.Fatalf("monitor did not stop after %v", tt.wantStop)
+				}
+			})
+		})
+	}
+}
+
+func TestShutdownMonitorLifecycle(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		m := NewShutdownMonitor(config.ShutdownTimersConfig{InactiveLimit: 10 * time.Minute}, discardLogger())
+
+		// stopping a monitor that never ran is harmless
+		m.Stop()
+
+		if err := m.Start(t.Context()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		if err := m.Start(t.Context()); !errors.Is(err, ErrMonitorRunning) {
+			t.Fatalf("second Start() error = %v, want %v", err, ErrMonitorRunning)
+		}
+
+		// a stopped monitor fires nothing
+		m.Stop()
+		time.Sleep(time.Hour)
+		synctest.Wait()
+		if stopped(m) {
+			t.Fatal("monitor fired after Stop")
+		}
+
+		// and can be started again with a fresh config
+		if err := m.Restart(t.Context(), config.ShutdownTimersConfig{InactiveLimit: time.Minute}); err != nil {
+			t.Fatalf("Restart() error = %v", err)
+		}
+		if got := m.ShutdownStatus().InactiveLimit; got != "1m0s" {
+			t.Errorf("InactiveLimit = %q, want %q", got, "1m0s")
+		}
+
+		time.Sleep(time.Minute)
+		synctest.Wait()
+		if !stopped(m) {
+			t.Fatal("restarted monitor did not stop after the new inactivity limit")
+		}
+
+		// the goroutine has exited after firing, so Start is allowed again
+		if err := m.Start(t.Context()); err != nil {
+			t.Fatalf("Start() after firing error = %v", err)
+		}
+		m.Stop()
+	})
+}
+
+func TestShutdownMonitorStopAfterUnreadFire(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		m := NewShutdownMonitor(config.ShutdownTimersConfig{InactiveLimit: time.Minute}, discardLogger())
+		if err := m.Start(t.Context()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		time.Sleep(time.Minute)
+		synctest.Wait()
+
+		// the first reason is still in StopCh when the restarted monitor fires again
+		if err := m.Restart(t.Context(), config.ShutdownTimersConfig{InactiveLimit: time.Minute}); err != nil {
+			t.Fatalf("Restart() error = %v", err)
+		}
+		time.Sleep(time.Minute)
+		synctest.Wait()
+
+		returned := make(chan struct{})
+		go func() {
+			m.Stop()
+			close(returned)
+		}()
+		synctest.Wait()
+		select {
+		case <-returned:
+		default:
+			t.Fatal("Stop() hangs on a monitor blocked sending to a full StopCh")
+		}
+		if !stopped(m) || stopped(m) {
+			t.Error("StopCh should hold the first reason alone")
+		}
+	})
+}
+
+func TestShutdownMonitorStopPastDeadlineUnread(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		m := NewShutdownMonitor(config.ShutdownTimersConfig{TimeToEnd: time.Now().Add(-time.Minute)}, discardLogger())
+		if err := m.Start(t.Context()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		synctest.Wait()
+
+		// restarted with a deadline still in the past while the first reason is unread
+		if err := m.Restart(t.Context(), config.ShutdownTimersConfig{TimeToEnd: time.Now().Add(-time.Minute)}); err != nil {
+			t.Fatalf("Restart() error = %v", err)
+		}
+		synctest.Wait()
+
+		returned := make(chan struct{})
+		go func() {
+			m.Stop()
+			close(returned)
+		}()
+		synctest.Wait()
+		select {
+		case <-returned:
+		default:
+			t.Fatal("Stop() hangs on a past deadline blocked sending to a full StopCh")
+		}
+	})
+}
+
+func TestShutdownMonitorContextCancel(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+
+		m := NewShutdownMonitor(config.ShutdownTimersConfig{InactiveLimit: 10 * time.Minute}, discardLogger())
+		if err := m.Start(ctx); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+
+		cancel()
+		synctest.Wait()
+
+		// the goroutine is gone, so starting again succeeds
+		if err := m.Start(t.Context()); err != nil {
+			t.Fatalf("Start() after cancel error = %v", err)
+		}
+		m.Stop()
+
+		if stopped(m) {
+			t.Fatal("cancelling ctx must not ask for a shutdown")
+		}
+	})
+}
+
+func TestShutdownMonitorReloadInactivity(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		limit    time.Duration
+		reloadAt time.Duration // since start
+		newLimit time.Duration
+		stopsAt  time.Duration // since start
+	}{
+		{"ok - shorter limit", 30 * time.Minute, 10 * time.Minute, 15 * time.Minute, 15 * time.Minute},
+		{"ok - shorter limit already elapsed", 30 * time.Minute, 20 * time.Minute, 15 * time.Minute, 20 * time.Minute},
+		{"ok - longer limit", 10 * time.Minute, 5 * time.Minute, 30 * time.Minute, 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Test(t, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(t.Context())
+				defer cancel()
+
+				m := NewShutdownMonitor(config.ShutdownTimersConfig{InactiveLimit: tt.limit}, discardLogger())
+				m.Start(ctx)
+				start := time.Now()
+
+				time.Sleep(tt.reloadAt)
+				if err := m.Reload(config.ShutdownTimersConfig{InactiveLimit: tt.newLimit}); err != nil {
+					t.Fatalf("Reload() error = %v", err)
+				}
+
+				select {
+				case <-m.StopCh:
+				case <-time.After(24 * time.Hour):
+					t.Fatal("monitor never stopped")
+				}
+
+				if got := time.Since(start); got != tt.stopsAt {
+					t.Errorf("stopped after %v, want %v", got, tt.stopsAt)
+				}
+				if got := m.ShutdownStatus().InactiveLimit; got != tt.newLimit.String() {
+					t.Errorf("status inactive limit = %s, want %s", got, tt.newLimit)
+				}
+			})
+		})
+	}
+}
+
+func TestShutdownMonitorReloadDeadline(t *testing.T) {
+	t.Parallel()
+
+	hour := config.ShutdownTimersConfig{SleepTimer: time.Hour}
+
+	tests := []struct {
+		name       string
+		initial    config.ShutdownTimersConfig
+		reschedule time.Duration // set through the admin api before the reload, 0 for none
+		reloaded   config.ShutdownTimersConfig
+		want       time.Duration // scheduled shutdown after the reload, counted from start, 0 for none
+	}{
+		{"ok - sleep timer added counts from the reload", config.ShutdownTimersConfig{}, 0, hour, 10*time.Minute + time.Hour},
+		{"ok - sleep timer removed cancels", hour, 0, config.ShutdownTimersConfig{}, 0},
+		{"ok - sleep timer changed", hour, 0, config.ShutdownTimersConfig{SleepTimer: 2 * time.Hour}, 10*time.Minute + 2*time.Hour},
+		{"ok - unchanged keeps the admin schedule", hour, 3 * time.Hour, hour, 3 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Test(t, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(t.Context())
+				defer cancel()
+
+				m := NewShutdownMonitor(tt.initial, discardLogger())
+				m.Start(ctx)
+				synctest.Wait()
+				start := time.Now()
+
+				if tt.reschedule > 0 {
+					m.Reschedule(start.Add(tt.reschedule))
+				}
+
+				time.Sleep(10 * time.Minute)
+				if err := m.Reload(tt.reloaded); err != nil {
+					t.Fatalf("Reload() error = %v", err)
+				}
+				synctest.Wait()
+
+				var want time.Time
+				if tt.want > 0 {
+					want = start.Add(tt.want)
+				}
+				if got := m.ShutdownStatus().Scheduled; !got.Equal(want) {
+					t.Errorf("scheduled = %v, want %v", got, want)
+				}
+
+				// a removed deadline must really be gone
+				time.Sleep(4 * time.Hour)
+				synctest.Wait()
+				if stopped(m) != (tt.want > 0) {
+					t.Errorf("stopped = %v after the deadline passed, want %v", stopped(m), tt.want > 0)
+				}
+			})
+		})
+	}
+}
+
+func TestNextTimeOfDay(t *testing.T) {
+	t.Parallel()
+
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.March, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		now  time.Time
+		want time.Time
+	}{
+		{"ok - later today", at(1, 23, 0), at(14, 20, 0), at(14, 23, 0)},
+		{"ok - passed today is tomorrow", at(14, 19, 0), at(14, 20, 0), at(15, 19, 0)},
+		{"ok - now is tomorrow", at(14, 20, 0), at(14, 20, 0), at(15, 20, 0)},
+		{"ok - stale date moves forward", at(20, 8, 30), at(14, 20, 0), at(15, 8, 30)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := nextTimeOfDay(tt.t, tt.now); !got.Equal(tt.want) {
+				t.Errorf("nextTimeOfDay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
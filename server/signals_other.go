@@ -0,0 +1,8 @@
+//go:build !unix
+
+package server
+
+import "context"
+
+// handleSignals is a no-op, SIGHUP, SIGUSR1 and SIGUSR2 only exist on unix
+func (s *Server) handleSignals(ctx context.Context, disc Discovery) {}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleSignals serves the operational signals until ctx is done. SIGINT and SIGTERM stay with the
+// shutdown context in Run
+//
+//	SIGHUP  rescan every volume and re-announce over SSDP, e.g. after a drive was plugged back in
+//	SIGUSR1 log a snapshot of the server state
+//	SIGUSR2 hand the listeners to a freshly started binary and exit once it serves (upgrade)
+func (s *Server) handleSignals(ctx context.Context, disc Discovery) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	// a restart after a panic keeps listening on the same channel
+	s.supervisor.Go(ctx, "signal handler", func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				signal.Stop(sigCh)
+				return
+			case sig := <-sigCh:
+				switch sig {
+				case syscall.SIGHUP:
+					s.logger.Info("SIGHUP received, rescanning and re-announcing")
+					s.api.Media.RescanNow()
+					disc.Announce()
+				case syscall.SIGUSR1:
+					s.logState()
+				case syscall.SIGUSR2:
+					if !s.opts.upgrade {
+						s.logger.Warn("SIGUSR2 ignored, upgrades need the server started by its own binary")
+						continue
+					}
+					s.logger.Info("SIGUSR2 received, upgrading")
+					nudge(s.upgradeCh)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"runtime"
+	"slices"
+)
+
+// logState writes a snapshot of what the server is doing, cheap enough to ask for at any time
+func (s *Server) logState() {
+	counts := s.api.Media.Registry.CountByMount()
+	scans := s.api.Media.VolumeScans()
+
+	ids := make([]string, 0, len(s.api.Media.Volumes))
+	for id := range s.api.Media.Volumes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		vol := s.api.Media.Volumes[id]
+		s.logger.Info("state: volume",
+			"id", id,
+			"path", vol.RootPath,
+			"entries", counts[id],
+			"io_in_use", vol.Limiter.InUse(),
+			"io_max", vol.Limiter.Cap(),
+			"last_scan_took", scans[id].Took,
+			"last_scan_err", scans[id].Err)
+	}
+
+	s.logger.Info("state: server",
+		"active_streams", s.api.ActiveStreams(),
+		"scan_running_for", s.api.Media.ScanRunningFor(),
+		"goroutines", runtime.NumGoroutine())
+}
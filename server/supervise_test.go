@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"streamer/internal/config"
+	"streamer/internal/supervise"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAppShutsDownWhenComponentGivesUp(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.DefaultConfig()
+	cfg.Media.Volumes = []config.VolumeConfig{{ID: "vol", MaxIO: 1, Paths: []string{t.TempDir()}}}
+	cfg.Metrics.Runtime = false
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	disc := &fakeDiscovery{}
+	app, err := New(cfg, discardLogger(), WithListener(ln), WithHostIP("127.0.0.1"), WithoutSignals(), WithDiscovery(disc))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	app.supervisor.MaxRestarts = 1
+	app.supervisor.Backoff = time.Millisecond
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- app.Run(context.Background()) }()
+	waitFor(t, "discovery to start", disc.started.Load)
+
+	// a component that panics on every run, it is restarted once and then given up on
+	app.supervisor.Go(t.Context(), "broken", func(ctx context.Context) {
+		panic("boom")
+	})
+
+	select {
+	case err := <-runErr:
+		var perr *supervise.PanicError
+		if !errors.As(err, &perr) || perr.Component != "broken" {
+			t.Errorf("Run() error = %v, want the panic of the broken component", err)
+		}
+		// the server was up, the binary exits with its runtime failure code
+		if errors.As(err, new(*StartupError)) {
+			t.Errorf("Run() error = %v is a startup error", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run() did not return after a component was given up on")
+	}
+
+	if got := app.ShutdownReason(); got != reasonFailure {
+		t.Errorf("ShutdownReason() = %q, want %q", got, reasonFailure)
+	}
+	if got := testutil.ToFloat64(app.metrics.ComponentPanics.WithLabelValues("broken")); got != 2 {
+		t.Errorf("streamer_component_panics_total{component=broken} = %v, want 2", got)
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"streamer/internal/config"
+	"streamer/internal/preflight"
+	"time"
+)
+
+// volumeRetry is how often a server started with -media.startup=wait scans again while it has no media
+const volumeRetry = 30 * time.Second
+
+var errNoUsableVolume = errors.New("no usable volume")
+
+// checkVolumes refuses the startup under -media.startup=fail when not a single volume path can be
+// listed, one usable path is enough
+func (s *Server) checkVolumes() error {
+	if s.cfg.Media.Startup != config.StartupFail {
+		return nil
+	}
+
+	var errs []error
+	for _, vol := range s.cfg.Media.Volumes {
+		for _, path := range vol.Paths {
+			err := preflight.Directory(path).Run()
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+	}
+	return fmt.Errorf("%w (use -media.startup=wait to wait for it): %w", errNoUsableVolume, errors.Join(errs...))
+}
+
+// waitForVolumes calls start once a scan has found media, rescanning every volumeRetry until then.
+// Meanwhile /readyz is 503 and the inactivity timer is on hold, nobody can use an empty server. The
+// returned channel is closed once ctx is done and whatever start returned is
+func (s *Server) waitForVolumes(ctx context.Context, start func() <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+
+	s.api.SetPending("volumes", "waiting for a volume with media")
+	s.monitor.HoldInactivity()
+
+	// only the waiting is supervised, so a restart can't release the hold or start discovery twice
+	warned, found := false, false
+	waited := s.supervisor.Go(ctx, "volume wait", func(ctx context.Context) {
+		ticker := time.NewTicker(volumeRetry)
+		defer ticker.Stop()
+
+		for s.api.Media.Registry.Len() == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.api.Media.RescanNow()
+			case <-s.api.Media.Scanned():
+				if !warned && s.api.Media.Registry.Len() == 0 {
+					s.logger.Warn("no media on any volume, waiting before announcing", "retry", volumeRetry)
+					warned = true
+				}
+			}
+		}
+		found = true
+	})
+
+	go func() {
+		defer close(done)
+
+		<-waited
+		s.monitor.ReleaseInactivity()
+		if !found {
+			return
+		}
+
+		s.api.SetPending("volumes", "")
+		s.logger.Info("media found, announcing", "entries", s.api.Media.Registry.Len())
+		<-start()
+	}()
+	return done
+}
+
+// initialScan waits for the first scan under -media.scanOnStart=block, at most -media.scanTimeout, so
+// the first Browse of a TV doesn't see (and cache) an empty library. In the background /readyz is 503
+// until the scan is done
+func (s *Server) initialScan(ctx context.Context) {
+	if s.cfg.Media.ScanOnStart != config.ScanBlock {
+		return
+	}
+
+	start := time.Now()
+	timer := time.NewTimer(s.cfg.Media.ScanTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-s.api.Media.FirstScanDone():
+		s.logger.Info("initial scan done", "entries", s.api.Media.Registry.Len(), "took", time.Since(start))
+	case <-timer.C:
+		s.logger.Warn("initial scan still running, serving anyway", "timeout", s.cfg.Media.ScanTimeout)
+	case <-ctx.Done():
+	}
+}
+
+// logLibrary logs a summary of the library once the first scan is done
+func (s *Server) logLibrary(ctx context.Context) {
+	select {
+	case <-s.api.Media.FirstScanDone():
+	case <-ctx.Done():
+		return
+	}
+
+	stats := s.api.Media.Registry.Stats()
+	attrs := []any{
+		"entries", stats.Entries,
+		"bytes", stats.Bytes,
+		"volumes", stats.ByVolume,
+		"categories", stats.ByCategory,
+	}
+	if stats.Largest != nil {
+		attrs = append(attrs, "largest", stats.Largest.Name, "largest_bytes", stats.Largest.Size)
+		attrs = append(attrs, "newest", stats.Newest.Name, "newest_mod_time", stats.Newest.ModTime)
+	}
+	s.logger.Info("library scanned", attrs...)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"streamer/internal/config"
+	"testing"
+	"time"
+)
+
+func TestAppStartupPolicyFail(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.DefaultConfig()
+	cfg.Media.Volumes = []config.VolumeConfig{{ID: "usb", MaxIO: 1, Paths: []string{filepath.Join(t.TempDir(), "unplugged")}}}
+	cfg.Metrics.Runtime = false
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	app, err := New(cfg, discardLogger(), WithListener(ln), WithHostIP("127.0.0.1"), WithoutSignals(), WithDiscovery(&fakeDiscovery{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	err = app.Run(t.Context())
+	if !errors.Is(err, errNoUsableVolume) {
+		t.Fatalf("Run() error = %v, want %v", err, errNoUsableVolume)
+	}
+	if !errors.As(err, new(*StartupError)) {
+		t.Errorf("Run() error = %v, want a startup error", err)
+	}
+}
+
+func TestAppStartupPolicyServeEmpty(t *testing.T) {
+	t.Parallel()
+
+	setup := func(cfg *config.Config) {
+		cfg.Media.Startup = config.StartupServeEmpty
+		cfg.Media.Volumes[0].Paths = []string{filepath.Join(t.TempDir(), "unplugged")}
+	}
+
+	disc := &fakeDiscovery{}
+	startTestServer(t, t.TempDir(), setup, WithDiscovery(disc))
+	waitFor(t, "discovery to start", disc.started.Load)
+}
+
+func TestAppStartupPolicyWait(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	setup := func(cfg *config.Config) {
+		cfg.Media.Startup = config.StartupWait
+	}
+
+	disc := &fakeDiscovery{}
+	app, baseURL, _ := startTestServer(t, dir, setup, WithDiscovery(disc))
+
+	readyz := func() (int, map[string]string) {
+		t.Helper()
+		resp, err := http.Get(baseURL + "/readyz")
+		if err != nil {
+			t.Fatalf("GET /readyz: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var body struct {
+			Pending map[string]string `json:"pending"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.StatusCode, body.Pending
+	}
+
+	// the volume is empty, whatever the scanner does discovery has to stay quiet
+	time.Sleep(100 * time.Millisecond)
+
+	if disc.started.Load() {
+		t.Fatal("discovery started without any media")
+	}
+	if code, pending := readyz(); code != http.StatusServiceUnavailable || pending["volumes"] == "" {
+		t.Errorf("/readyz = %d %v while waiting for media, want 503 with a volumes reason", code, pending)
+	}
+
+	// the drive gets plugged in, the next rescan picks it up
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("not really a film"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	app.api.Media.RescanNow()
+
+	waitFor(t, "discovery to start", disc.started.Load)
+	if code, pending := readyz(); code != http.StatusOK {
+		t.Errorf("/readyz = %d %v with media, want 200", code, pending)
+	}
+}
+
+// waitFor polls cond until it holds or a few seconds have passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestAppScanOnStartBlock(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("not really a film"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	setup := func(cfg *config.Config) {
+		cfg.Media.ScanOnStart = config.ScanBlock
+	}
+
+	disc := &fakeDiscovery{}
+	app, baseURL, _ := startTestServer(t, dir, setup, WithDiscovery(disc))
+
+	// the listener is bound before Run starts, the request waits in the backlog until the scan is done
+	resp, err := http.Get(baseURL + "/readyz")
+	if err != nil {
+		t.Fatalf("GET /readyz: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/readyz = %d on the first request, want 200", resp.StatusCode)
+	}
+	if got := app.api.Media.Registry.Len(); got != 1 {
+		t.Errorf("first request served with %d entries, want 1", got)
+	}
+	if !disc.started.Load() {
+		t.Error("first request served before discovery started")
+	}
+}
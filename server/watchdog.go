@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"streamer/internal/systemd"
+	"time"
+)
+
+// startWatchdog pings the systemd watchdog at half its interval for as long as the server looks alive.
+// A failed check skips the ping, so systemd restarts the service once the interval runs out
+func (s *Server) startWatchdog(ctx context.Context, notifier *systemd.Notifier, serving func() bool) {
+	if !notifier.Enabled() {
+		return
+	}
+
+	interval, err := systemd.WatchdogInterval()
+	if err != nil {
+		s.logger.Warn("watchdog disabled", "error", err)
+		return
+	}
+	if interval == 0 {
+		return
+	}
+
+	// alive is deliberately cheap, it runs every few seconds
+	alive := func() (bool, string) {
+		if !serving() {
+			return false, "http listener stopped"
+		}
+		// a big volume takes a while, only a scan that stopped getting anywhere is stuck
+		if d := s.api.Media.ScanStalledFor(); d > s.cfg.Media.ScanStall {
+			return false, "scan stalled for " + d.Round(time.Second).String()
+		}
+		return true, ""
+	}
+
+	s.logger.Info("systemd watchdog enabled", "interval", interval)
+
+	s.supervisor.Go(ctx, "watchdog", func(ctx context.Context) {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if ok, reason := alive(); !ok {
+					s.logger.Error("liveness check failed, skipping watchdog ping", "reason", reason)
+					continue
+				}
+				if err := notifier.Watchdog(); err != nil {
+					s.logger.Warn("sd_notify watchdog failed", "error", err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"streamer/internal/schedule"
+	"streamer/internal/supervise"
+	"sync"
+	"time"
+)
+
+// windowRecheck caps how long the window sleeps, so a wall clock jump (suspend, NTP) is noticed
+const windowRecheck = time.Minute
+
+// serveWindow keeps the server on the air only during the configured windows. Outside them discovery
+// is paused, new requests are refused and the inactivity timer is on hold so the process is still
+// there when the window opens again
+type serveWindow struct {
+	schedule schedule.Schedule
+	clock    clock
+	logger   *slog.Logger
+	disc     Discovery
+	monitor  *shutdownMonitor
+
+	supervisor *supervise.Supervisor // optional, restarts the loop when it panics
+
+	mu   sync.Mutex
+	open bool      // renderers can see and use the server
+	next time.Time // when open flips, zero if never
+}
+
+func newServeWindow(s schedule.Schedule, c clock, logger *slog.Logger, disc Discovery, monitor *shutdownMonitor) *serveWindow {
+	return &serveWindow{
+		schedule: s,
+		clock:    c,
+		logger:   logger,
+		disc:     disc,
+		monitor:  monitor,
+		open:     true, // like a server without windows until the first update says otherwise
+	}
+}
+
+// Refusal implements middleware.Gate
+func (w *serveWindow) Refusal() (string, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.open {
+		return "", 0
+	}
+	if w.next.IsZero() {
+		return "outside serving hours", 0
+	}
+	return "outside serving hours, back at " + w.next.Format("Mon 15:04"), w.next.Sub(w.clock.Now())
+}
+
+// update applies the window for the current time and returns when it changes next
+func (w *serveWindow) update() time.Time {
+	now := w.clock.Now()
+	open := w.schedule.Open(now)
+	next := w.schedule.NextChange(now)
+
+	w.mu.Lock()
+	changed := open != w.open
+	w.open, w.next = open, next
+	w.mu.Unlock()
+
+	if !changed {
+		return next
+	}
+
+	if open {
+		w.logger.Info("serving window opened", "until", next)
+		w.monitor.ReleaseInactivity()
+		w.disc.Resume()
+	} else {
+		w.logger.Info("outside serving window, going off the air", "until", next)
+		w.monitor.HoldInactivity()
+		w.disc.Pause()
+	}
+	return next
+}
+
+// start follows the schedule until ctx is done, the returned channel is closed once it has stopped.
+// Call update once before so discovery never announces outside the window
+func (w *serveWindow) start(ctx context.Context) <-chan struct{} {
+	return w.supervisor.Go(ctx, "serve window", func(ctx context.Context) {
+		timer := time.NewTimer(windowRecheck)
+		defer timer.Stop()
+
+		for {
+			wait := windowRecheck
+			if next := w.update(); !next.IsZero() {
+				wait = min(wait, max(noTimeout, next.Sub(w.clock.Now())))
+			}
+			timer.Reset(wait)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+		}
+	})
+}
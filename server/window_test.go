@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"streamer/internal/config"
+	"streamer/internal/schedule"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+// offsetClock runs from base at the pace of the (synctest) clock
+type offsetClock struct {
+	base  time.Time
+	start time.Time
+}
+
+func (c offsetClock) Now() time.Time { return c.base.Add(time.Since(c.start)) }
+
+func TestServeWindowCrossingMidnight(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		// UTC+2, testNow is saturday 22:00 there
+		loc := time.FixedZone("test", 2*60*60)
+		window, err := schedule.ParseWindow("sat 23:00-01:30")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		disc := &fakeDiscovery{}
+		monitor := NewShutdownMonitor(config.DefaultConfig().ShutdownTimers, discardLogger())
+		c := offsetClock{base: testNow, start: time.Now()}
+		w := newServeWindow(schedule.Schedule{Windows: []schedule.Window{window}, Location: loc}, c, discardLogger(), disc, monitor)
+
+		check := func(step string, wantOpen bool, wantRetry time.Duration) {
+			t.Helper()
+			reason, retry := w.Refusal()
+			if open := reason == ""; open != wantOpen {
+				t.Errorf("%s: open = %v (%q), want %v", step, open, reason, wantOpen)
+			}
+			if retry != wantRetry {
+				t.Errorf("%s: retry after = %v, want %v", step, retry, wantRetry)
+			}
+			if paused := disc.paused.Load(); paused == wantOpen {
+				t.Errorf("%s: discovery paused = %v", step, paused)
+			}
+			wantHeld := int64(1)
+			if wantOpen {
+				wantHeld = 0
+			}
+			if held := monitor.streams.Load(); held != wantHeld {
+				t.Errorf("%s: inactivity holds = %d, want %d", step, held, wantHeld)
+			}
+		}
+
+		w.update()
+		check("before the window", false, time.Hour)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := w.start(ctx)
+
+		time.Sleep(time.Hour)
+		synctest.Wait()
+		check("window opened", true, 0)
+
+		// past midnight local time, it is sunday but the window opened on saturday
+		time.Sleep(2*time.Hour + time.Minute)
+		synctest.Wait()
+		check("after midnight", true, 0)
+
+		time.Sleep(29 * time.Minute)
+		synctest.Wait()
+		check("window closed", false, 7*24*time.Hour-150*time.Minute)
+
+		cancel()
+		<-done
+	})
+}
+
+func TestAppOutsideServeWindow(t *testing.T) {
+	t.Parallel()
+
+	// testNow is saturday 20:00 UTC, two hours before the window opens
+	setup := func(cfg *config.Config) {
+		window, err := schedule.ParseWindow("22:00-23:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Serve.Windows = []schedule.Window{window}
+		cfg.Serve.Location = time.UTC
+	}
+
+	disc := &fakeDiscovery{}
+	_, baseURL, _ := startTestServer(t, t.TempDir(), setup, WithClock(fixedClock{now: testNow}), WithDiscovery(disc))
+
+	// Run may still be starting up, the window is applied before discovery starts
+	for deadline := time.Now().Add(5 * time.Second); !disc.started.Load(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("discovery was never started")
+		}
+	}
+	if !disc.paused.Load() {
+		t.Error("discovery is announcing outside the serving window")
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		wantCode  int
+		wantRetry string
+	}{
+		{"ok - web refused", "/", http.StatusServiceUnavailable, "7200"},
+		{"ok - description refused", "/description.xml", http.StatusServiceUnavailable, "7200"},
+		{"ok - status still answers", "/api/status", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(baseURL + tt.path)
+			if err != nil {
+				t.Fatalf("GET %s: %v", tt.path, err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("GET %s status = %d, want %d", tt.path, resp.StatusCode, tt.wantCode)
+			}
+			if got := resp.Header.Get("Retry-After"); got != tt.wantRetry {
+				t.Errorf("GET %s Retry-After = %q, want %q", tt.path, got, tt.wantRetry)
+			}
+		})
+	}
+}